@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/rl1809/flash-sale/internal/adapter/storage"
+	"github.com/rl1809/flash-sale/internal/config"
+	"github.com/rl1809/flash-sale/migrations"
+)
+
+const usage = `usage: migrate <command>
+
+Applies the embedded schema migrations to the MySQL database at MYSQL_DSN.
+
+commands:
+  up         apply every pending migration
+  down [n]   revert the latest n migrations, 1 by default
+  status     list migrations and when they were applied
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, err := sql.Open("mysql", cfg.MySQLDSN)
+	if err != nil {
+		log.Fatalf("failed to open mysql: %v", err)
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		log.Fatalf("failed to connect mysql: %v", err)
+	}
+
+	migrator, err := storage.NewMigrator(db, migrations.FS)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %v", err)
+	}
+
+	switch command := flag.Arg(0); command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			if steps, err = strconv.Atoi(flag.Arg(1)); err != nil || steps < 1 {
+				log.Fatalf("invalid number of migrations %q", flag.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -3,126 +3,750 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/netutil"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/rl1809/flash-sale/internal/adapter/analytics"
+	"github.com/rl1809/flash-sale/internal/adapter/auth"
+	"github.com/rl1809/flash-sale/internal/adapter/blob"
+	"github.com/rl1809/flash-sale/internal/adapter/botcheck"
 	"github.com/rl1809/flash-sale/internal/adapter/handler"
-	"github.com/rl1809/flash-sale/internal/adapter/handler/pb"
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/adapter/messaging"
+	"github.com/rl1809/flash-sale/internal/adapter/metrics"
+	"github.com/rl1809/flash-sale/internal/adapter/notify"
+	"github.com/rl1809/flash-sale/internal/adapter/payment"
+	"github.com/rl1809/flash-sale/internal/adapter/risk"
 	"github.com/rl1809/flash-sale/internal/adapter/storage"
+	"github.com/rl1809/flash-sale/internal/adapter/tracing"
+	"github.com/rl1809/flash-sale/internal/config"
 	"github.com/rl1809/flash-sale/internal/core/domain"
 	"github.com/rl1809/flash-sale/internal/core/service"
 	"github.com/rl1809/flash-sale/internal/port"
-)
-
-const (
-	httpPort     = ":8080"
-	grpcPort     = ":50051"
-	mysqlDSN     = "root:root@tcp(localhost:3306)/flashsale?parseTime=true"
-	redisAddr    = "localhost:6379"
-	workerCount  = 10
-	queueSize    = 10000
-	initialStock = 100
-	itemID       = "iphone-15"
+	"github.com/rl1809/flash-sale/migrations"
+	"github.com/rl1809/flash-sale/pkg/pb"
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "run with in-memory stores instead of MySQL and Redis")
+	flag.Parse()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Initialize MySQL
-	db, err := sql.Open("mysql", mysqlDSN)
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("failed to connect mysql: %v", err)
+		log.Fatalf("failed to load config: %v", err)
 	}
-	db.SetMaxOpenConns(50)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
 
-	if err := db.PingContext(ctx); err != nil {
-		log.Fatalf("failed to ping mysql: %v", err)
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, "flash-sale", cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
 	}
-	log.Println("connected to mysql")
 
-	// Initialize Redis
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisAddr,
-		PoolSize: 100,
-	})
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("failed to connect redis: %v", err)
-	}
-	log.Println("connected to redis")
+	// Initialize stores
+	var (
+		dbs          []*sql.DB
+		sqlAdapter   sqlStore
+		rdb          redis.UniversalClient
+		redisAdapter *storage.RedisAdapter
+		stockStore   cacheStore
+		locker       port.Locker
+		healthChecks = make(map[string]handler.HealthCheck)
+	)
+	if *dev {
+		// Nothing outlives the process, so there is no spool or migration
+		memoryDB := memory.NewDatabase()
+		now := time.Now()
+		memoryDB.CreateItem(ctx, domain.Item{ID: cfg.ItemID, Name: cfg.ItemID, Stock: cfg.InitialStock, Currency: domain.DefaultCurrency, CreatedAt: now, UpdatedAt: now})
+		sqlAdapter = memoryDB
+		stockStore = memory.NewCache(memory.WithCampaign(cfg.CampaignID))
+		locker = memory.NewLocker()
+		cfg.RateLimitStore = config.RateLimitStoreMemory
+		log.Println("dev mode: using in-memory stores, all data is lost on exit")
+	} else {
+		dbs, sqlAdapter, err = openDatabase(ctx, cfg)
+		if err != nil {
+			log.Fatalf("failed to open %s database: %v", cfg.DatabaseDriver, err)
+		}
+		// A shard that is down fails only its own items' work, so readiness
+		// follows the primary alone
+		healthChecks[cfg.DatabaseDriver] = dbs[0].PingContext
+
+		rdb = storage.NewRedisClient(storage.RedisSettings{
+			Addr:             cfg.RedisAddr,
+			ClusterAddrs:     cfg.RedisClusterAddrs,
+			SentinelMaster:   cfg.RedisSentinelMaster,
+			SentinelAddrs:    cfg.RedisSentinelAddrs,
+			SentinelPassword: cfg.RedisSentinelPassword,
+			FailoverTimeout:  cfg.RedisFailoverTimeout,
+		})
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Fatalf("failed to connect redis: %v", err)
+		}
+		switch {
+		case len(cfg.RedisClusterAddrs) > 0:
+			log.Printf("connected to redis cluster via %s", strings.Join(cfg.RedisClusterAddrs, ","))
+		case cfg.RedisSentinelMaster != "":
+			log.Printf("connected to redis master %s via sentinel", cfg.RedisSentinelMaster)
+		default:
+			log.Println("connected to redis")
+		}
+		healthChecks["redis"] = func(ctx context.Context) error { return rdb.Ping(ctx).Err() }
 
-	// Initialize adapters
-	redisAdapter := storage.NewRedisAdapter(rdb)
-	mysqlAdapter := storage.NewMySQLAdapter(db)
+		// Keys belong to the tenant of the request, or of the item for
+		// work outside one
+		redisAdapter = storage.NewRedisAdapter(rdb, storage.WithItemTenants(service.NewItemTenants(sqlAdapter).TenantOf), storage.WithCampaignKeys(cfg.CampaignID), storage.WithStockShards(cfg.StockShards), storage.WithRetries(cfg.RedisRetryAttempts, cfg.RedisRetryBackoff))
+		stockStore = redisAdapter
+		locker = redisAdapter
+	}
 
-	// Sync stock to Redis
-	if err := redisAdapter.SetStock(ctx, itemID, initialStock); err != nil {
+	// Sync stock to the cache, this region's share of it if stock is split
+	initialStock := cfg.InitialStock
+	var regionalStock *service.RegionalStock
+	if len(cfg.RegionStockShares) > 0 {
+		regionalStock = newRegionalStock(cfg, *dev, stockStore, sqlAdapter)
+		initialStock = regionalStock.LocalShare(cfg.InitialStock)
+		log.Printf("selling region %s's share of stock, split %v", cfg.Region, cfg.RegionStockShares)
+	}
+	if err := stockStore.SetStock(ctx, cfg.ItemID, initialStock); err != nil {
 		log.Fatalf("failed to set initial stock: %v", err)
 	}
-	log.Printf("initialized stock: %s = %d", itemID, initialStock)
+	log.Printf("initialized stock: %s = %d", cfg.ItemID, initialStock)
+
+	// Instrument adapters
+	promMetrics := metrics.NewPrometheus(metrics.WithSlowCallLog(slog.Default(), cfg.RedisSlowThreshold, cfg.MySQLSlowThreshold))
+	var stockCache port.CacheRepository = stockStore
+	var leasedStock *storage.LeasedStock
+	if cfg.StockLeaseSize > 0 && redisAdapter != nil {
+		// Sell from batches of stock leased to this server
+		leasedStock = storage.NewLeasedStock(redisAdapter, cfg.StockLeaseSize, cfg.StockLeaseTTL)
+		go leasedStock.Run(ctx)
+		stockCache = leasedStock
+		log.Printf("leasing stock in batches of %d", cfg.StockLeaseSize)
+	}
+	cache := metrics.NewInstrumentedCache(stockCache, promMetrics)
+	// A request sees only its tenant's items, campaigns, inventory and
+	// orders, and every order written is projected into the read model
+	database := service.NewOrderProjection(
+		service.NewTenantScope(metrics.NewInstrumentedDatabase(sqlAdapter, promMetrics)),
+		sqlAdapter,
+	)
+
+	// Check the stock before compensations start changing it. A region's
+	// cache only holds part of the database stock, so it cannot be checked
+	if cfg.StartupStockCheck != config.StockCheckOff && regionalStock != nil {
+		log.Println("stock check: skipped, stock is split between regions")
+	} else if cfg.StartupStockCheck != config.StockCheckOff {
+		if err := checkStock(ctx, cfg, stockStore, database, redisAdapter, sqlAdapter); err != nil {
+			log.Fatalf("startup stock check: %v", err)
+		}
+	}
+
+	// Metrics and notifications follow orders through the event bus, which
+	// also forwards every event to Kafka when a topic is set
+	var events port.EventBus = memory.NewEventBus()
+	var saleEvents *messaging.KafkaEventBus
+	if cfg.SaleEventsTopic != "" {
+		saleEvents = messaging.NewKafkaEventBus(events, cfg.KafkaBrokers, cfg.SaleEventsTopic)
+		events = saleEvents
+		log.Printf("publishing sale events to %s", cfg.SaleEventsTopic)
+	}
+	service.SubscribeOrderMetrics(events, promMetrics)
+
+	// Initialize services
+	scheduler := service.NewScheduler(locker, service.WithJobMetrics(promMetrics))
+	compensator := service.NewStockCompensator(cache, sqlAdapter)
+	scheduler.Add(newJob(cfg, "stock-compensation", cfg.CompensationInterval, compensator.RetryPending))
 
-	// Initialize service
-	orderService := service.NewOrderService(redisAdapter, queueSize)
+	catalog := service.NewCatalog(database, cfg.CatalogRefreshInterval)
+	if err := catalog.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load catalog: %v", err)
+	}
+	go catalog.Run(ctx)
+
+	// Coupons are reloaded as often as the catalog
+	couponService := service.NewCouponService(sqlAdapter, stockStore, cfg.CatalogRefreshInterval)
+	if err := couponService.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load coupons: %v", err)
+	}
+	go couponService.Run(ctx)
+
+	tierService := service.NewTierService(sqlAdapter, cfg.CatalogRefreshInterval)
+	if err := tierService.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load user tiers: %v", err)
+	}
+	go tierService.Run(ctx)
+
+	blacklistService := service.NewBlacklistService(stockStore, cfg.CatalogRefreshInterval)
+	if err := blacklistService.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load blacklist: %v", err)
+	}
+	go blacklistService.Run(ctx)
+
+	partitions := 1
+	if cfg.PartitionByItem {
+		partitions = cfg.WorkerCount
+	}
+	campaigns := service.NewCachedCampaigns(database, cfg.CampaignCacheTTL)
+	orderOpts := []service.OrderServiceOption{
+		service.WithItemPartitions(partitions),
+		service.WithIdempotency(cfg.IdempotencyMode, cfg.IdempotencyTTL),
+		service.WithCampaign(cfg.CampaignID),
+		service.WithPurchasePool(cfg.PurchaseWorkers, cfg.PurchaseBacklog),
+		service.WithLoadShedding(cfg.LoadShedThreshold),
+		service.WithConcurrencyLimit(cfg.ConcurrencyLimits),
+		service.WithEnqueueTimeout(cfg.EnqueueTimeout),
+		service.WithStageTimeouts(cfg.StageTimeouts),
+		service.WithMetrics(promMetrics),
+		service.WithEvents(events),
+		service.WithPricing(cfg.Pricing),
+		service.WithCatalog(catalog),
+		service.WithPurchaseQuota(stockStore),
+		service.WithCoupons(couponService),
+		service.WithOrderResults(stockStore),
+		service.WithCompensator(compensator),
+		service.WithHoldTTL(cfg.HoldTTL),
+		service.WithUserTiers(tierService),
+		service.WithBlacklist(blacklistService),
+		service.WithPurchaseRecords(stockStore, cfg.PurchaseRecordTTL),
+		service.WithSaleCounters(stockStore),
+		service.WithStockHintCache(cfg.StockHintCacheTTL),
+	}
+	if cfg.VIPPriority {
+		orderOpts = append(orderOpts, service.WithVIPPriority())
+	}
+	if len(cfg.VIPReservedStock) > 0 {
+		orderOpts = append(orderOpts, service.WithVIPReserve(stockStore, cfg.VIPReservedStock))
+	}
+	if redisAdapter != nil {
+		orderOpts = append(orderOpts, service.WithOrderSpool(redisAdapter))
+	}
+	shards, sharded := sqlAdapter.(port.ShardRouter)
+	if sharded {
+		orderOpts = append(orderOpts, service.WithShardRouter(shards))
+	}
+	var riskRules []risk.Rule
+	if cfg.RiskIPVelocity > 0 {
+		riskRules = append(riskRules, risk.NewIPVelocity(stockStore, cfg.RiskIPVelocity, cfg.RiskVelocityWindow, risk.VelocityPoints))
+	}
+	if cfg.RiskDeviceVelocity > 0 {
+		riskRules = append(riskRules, risk.NewDeviceVelocity(stockStore, cfg.RiskDeviceVelocity, cfg.RiskVelocityWindow, risk.VelocityPoints))
+	}
+	if cfg.RiskNewAccountAge > 0 {
+		riskRules = append(riskRules, risk.NewAccountAge(stockStore, cfg.RiskNewAccountAge, risk.NewAccountPoints))
+	}
+	if len(riskRules) > 0 {
+		orderOpts = append(orderOpts, service.WithRiskScorer(risk.NewRules(cfg.RiskFlagScore, cfg.RiskRejectScore, riskRules...)))
+		log.Printf("risk scoring with %d rules: flag at %d, reject at %d", len(riskRules), cfg.RiskFlagScore, cfg.RiskRejectScore)
+	}
+	if cfg.ItemFilter {
+		itemFilter := service.NewItemFilter(database, cfg.CatalogRefreshInterval, cfg.ItemFilterFalsePositiveRate)
+		if err := itemFilter.Refresh(ctx); err != nil {
+			log.Fatalf("failed to load item filter: %v", err)
+		}
+		go itemFilter.Run(ctx)
+		orderOpts = append(orderOpts, service.WithItemFilter(itemFilter))
+	}
+	if cfg.SoldOutBroadcast {
+		soldOutBoard := service.NewSoldOutBoard(stockStore, stockStore, cache)
+		go soldOutBoard.Run(ctx)
+		orderOpts = append(orderOpts, service.WithSoldOutBoard(soldOutBoard))
+	}
+	if cfg.DegradedPurchases && !*dev {
+		cacheBreaker := service.NewCircuitBreaker("redis", cfg.CacheBreakerThreshold, cfg.CacheBreakerCooldown)
+		degradedLimit := memory.NewRateLimiter(float64(cfg.DegradedPurchaseRate), cfg.DegradedPurchaseRate)
+		orderOpts = append(orderOpts, service.WithDegradedPurchases(campaigns, cacheBreaker, degradedLimit))
+		log.Printf("degraded purchases: up to %d per second straight to the database while redis is down", cfg.DegradedPurchaseRate)
+	}
+	var purchaseAnalytics *service.PurchaseAnalytics
+	if sink := newAnalyticsSink(cfg); sink != nil {
+		purchaseAnalytics = service.NewPurchaseAnalytics(sink, cfg.AnalyticsQueueSize, cfg.AnalyticsBatchSize, cfg.AnalyticsFlushInterval)
+		go purchaseAnalytics.Run(ctx)
+		orderOpts = append(orderOpts, service.WithPurchaseAnalytics(purchaseAnalytics))
+		log.Printf("streaming purchase outcomes to %s", cfg.AnalyticsSink)
+	}
+	orderService := service.NewOrderService(cache, cfg.QueueSize, orderOpts...)
+	allocationService := service.NewAllocationService(cache, database, service.WithAllocationCompensator(compensator))
+	var campaignOpts []service.CampaignServiceOption
+	var inventoryOpts []service.InventoryServiceOption
+	if regionalStock != nil {
+		campaignOpts = append(campaignOpts, service.WithWarmupRegions(regionalStock))
+		inventoryOpts = append(inventoryOpts, service.WithRegionalStock(regionalStock))
+	}
+	campaignService := service.NewCampaignService(stockStore, campaigns, cfg.CampaignID, campaignOpts...)
+	stockService := service.NewStockService(cache, stockStore)
+	resultService := service.NewOrderResultService(orderService, database, stockStore)
+	inventoryService := service.NewInventoryService(cache, database, locker, inventoryOpts...)
+	var lotteryService *service.LotteryService
+	if cfg.SaleMode == config.SaleModeLottery {
+		lotteryService = service.NewLotteryService(orderService, stockStore, locker, cfg.LotteryClosesAt)
+		go lotteryService.Run(ctx)
+		log.Printf("lottery mode: entries close at %s", cfg.LotteryClosesAt.Format(time.RFC3339))
+	}
+	var payments port.PaymentGateway
+	var reservationOpts []service.ReservationServiceOption
+	if cfg.PaymentGateway == config.PaymentGatewayMock {
+		payments = payment.NewMock()
+		reservationOpts = append(reservationOpts, service.WithPaymentGateway(payments))
+	}
+	if cfg.RebuyAfterCancel {
+		reservationOpts = append(reservationOpts, service.WithRebuyAfterCancel(orderService))
+	}
+	reservationOpts = append(reservationOpts, service.WithOrderEvents(stockStore))
+	reservationService := service.NewReservationService(database, compensator, reservationOpts...)
+	scheduler.Add(newJob(cfg, "hold-sweep", cfg.HoldSweepInterval, reservationService.ReleaseExpired))
+	refundService := service.NewRefundService(database, sqlAdapter, payments, cfg.RefundRetryInterval)
+	scheduler.Add(newJob(cfg, "refund-retry", cfg.RefundRetryInterval, refundService.ResumeStalled))
+	if cfg.OrderRetentionDays > 0 {
+		retention := time.Duration(cfg.OrderRetentionDays) * 24 * time.Hour
+		var archiverOpts []service.OrderArchiverOption
+		if cfg.OrderArchiveTarget == config.OrderArchiveBlob {
+			s3 := blob.NewS3(cfg.ArchiveS3Endpoint, cfg.ArchiveS3Region, cfg.ArchiveS3Bucket, cfg.ArchiveS3AccessKey, cfg.ArchiveS3SecretKey, cfg.ArchiveS3Timeout)
+			archiverOpts = append(archiverOpts, service.WithBlobArchive(s3, sqlAdapter, cfg.ArchiveS3Prefix))
+		}
+		archiver := service.NewOrderArchiver(sqlAdapter, locker, retention, cfg.OrderArchiveBatchSize, archiverOpts...)
+		scheduler.Add(newJob(cfg, "order-archive", cfg.OrderArchiveInterval, archiver.Archive))
+	}
+	if cfg.OrderPartitions != config.OrderPartitionsOff {
+		retention := time.Duration(cfg.OrderRetentionDays) * 24 * time.Hour
+		for i, db := range dbs {
+			name := "order-partitions"
+			if i > 0 {
+				name = fmt.Sprintf("order-partitions-shard-%d", i)
+			}
+			partitions := storage.NewOrderPartitions(db, storage.PartitionPeriod(cfg.OrderPartitions), cfg.OrderPartitionsAhead, retention)
+			scheduler.Add(newJob(cfg, name, cfg.OrderPartitionInterval, partitions.Maintain))
+		}
+	}
+	go scheduler.Run(ctx)
+	promMetrics.RegisterQueueDepth(orderService.QueueDepth)
+	if cfg.ConcurrencyLimits.Initial > 0 {
+		promMetrics.RegisterConcurrencyLimit(orderService.ConcurrencyLimit)
+	}
+	expvar.Publish("order_queue_depth", expvar.Func(func() any { return orderService.QueueDepth() }))
 
 	// Start worker pool
+	workerTuning, err := service.NewWorkerTuning(cfg.Worker)
+	if err != nil {
+		log.Fatalf("invalid worker settings: %v", err)
+	}
+
+	workerOpts := []service.OrderWorkerOption{
+		service.WithWorkerEvents(events),
+		service.WithWorkerResults(stockStore),
+		service.WithWorkerRecords(stockStore, cfg.PurchaseRecordTTL),
+		service.WithWorkerSaleCounters(stockStore),
+		service.WithWorkerCompensator(compensator),
+		service.WithWorkerTimeouts(cfg.StageTimeouts),
+		service.WithWorkerMetrics(promMetrics),
+	}
+	// Closed at shutdown, so workers held up by the breaker spool their
+	// orders rather than keep the process waiting on the database
+	workersShutdown := make(chan struct{})
+	if cfg.DBBreakerThreshold > 0 {
+		var spool port.OrderSpool
+		if redisAdapter != nil {
+			spool = redisAdapter
+		}
+		workerOpts = append(workerOpts, service.WithWorkerShutdown(workersShutdown, spool))
+		if sharded {
+			// A shard that fails must not pause the writes to the others
+			breakers := make([]*service.CircuitBreaker, shards.Shards())
+			for i := range breakers {
+				breakers[i] = service.NewCircuitBreaker(fmt.Sprintf("%s shard %d", cfg.DatabaseDriver, i), cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+			}
+			workerOpts = append(workerOpts, service.WithShardBreakers(shards, breakers))
+		} else {
+			breaker := service.NewCircuitBreaker(cfg.DatabaseDriver, cfg.DBBreakerThreshold, cfg.DBBreakerCooldown)
+			workerOpts = append(workerOpts, service.WithWorkerBreaker(breaker))
+		}
+	}
+	if notifier := newNotifier(cfg); notifier != nil {
+		notifications := service.NewNotificationService(notifier, cfg.NotifyQueueSize, cfg.NotifyAttempts, cfg.NotifyRetryBackoff)
+		go notifications.Run(ctx)
+		if err := notifications.WatchExpiries(ctx, stockStore, locker); err != nil {
+			log.Fatalf("failed to watch order events: %v", err)
+		}
+		notifications.Subscribe(events)
+		log.Printf("notifying buyers through %s", cfg.Notifier)
+	}
 	var wg sync.WaitGroup
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			workerLoop(id, orderService.GetOrderQueue(), mysqlAdapter, redisAdapter)
-		}(i)
+	var pool *service.WorkerPool
+	workerCount := func() int { return cfg.WorkerCount }
+	if cfg.PartitionByItem {
+		// One worker per partition, so each item has a single writer
+		priority := orderService.PriorityQueues()
+		for i, queue := range orderService.OrderQueues() {
+			opts := workerOpts
+			if priority != nil {
+				opts = append(opts[:len(opts):len(opts)], service.WithPriorityQueue(priority[i]))
+			}
+			wg.Add(1)
+			worker := service.NewOrderWorker(i, queue, database, cache, workerTuning, opts...)
+			go func() {
+				defer wg.Done()
+				worker.Run()
+			}()
+		}
+	} else {
+		if priority := orderService.PriorityQueues(); priority != nil {
+			workerOpts = append(workerOpts, service.WithPriorityQueue(priority[0]))
+		}
+		pool, err = service.NewWorkerPool(cfg.WorkerPool, orderService.GetOrderQueue(), database, cache, workerTuning, workerOpts...)
+		if err != nil {
+			log.Fatalf("invalid worker pool settings: %v", err)
+		}
+		pool.Start()
+		go pool.Run(ctx)
+		workerCount = pool.Size
+	}
+	promMetrics.RegisterWorkerCount(workerCount)
+	expvar.Publish("order_workers", expvar.Func(func() any { return workerCount() }))
+	log.Printf("started %d workers", cfg.WorkerCount)
+
+	// Finish orders a previous shutdown left queued
+	if n, err := orderService.RecoverSpooled(ctx); err != nil {
+		log.Printf("failed to recover spooled orders (%d queued): %v", n, err)
+	} else if n > 0 {
+		log.Printf("recovered %d spooled orders", n)
+	}
+
+	// Start payment events consumer
+	consumerCtx, stopConsumer := context.WithCancel(ctx)
+	consumerDone := make(chan struct{})
+	if len(cfg.KafkaBrokers) > 0 {
+		paymentService := service.NewPaymentService(cache, database, service.WithPaymentCompensator(compensator))
+		paymentEvents := messaging.NewKafkaPaymentEvents(cfg.KafkaBrokers, cfg.PaymentEventsTopic, cfg.KafkaGroupID)
+		go func() {
+			defer close(consumerDone)
+			defer paymentEvents.Close()
+			log.Printf("consuming payment events from %s", cfg.PaymentEventsTopic)
+			if err := paymentEvents.Consume(consumerCtx, paymentService.HandlePaymentEvent); err != nil {
+				log.Printf("payment events consumer error: %v", err)
+			}
+		}()
+	} else {
+		close(consumerDone)
 	}
-	log.Printf("started %d workers", workerCount)
+
+	// Operators authenticate with static API keys or signed bearer tokens
+	adminKeys := maps.Clone(cfg.AdminAPIKeys)
+	if cfg.AdminAPIKey != "" {
+		adminKeys[cfg.AdminAPIKey] = domain.Principal{Subject: "admin", Roles: []domain.Role{domain.RoleAdmin}}
+	}
+	adminAuthorizer := auth.Chain{auth.NewStaticKeys(adminKeys)}
+	if cfg.AdminJWTSecret != "" {
+		adminAuthorizer = append(adminAuthorizer, auth.NewJWT([]byte(cfg.AdminJWTSecret), auth.WithIssuer(cfg.AdminJWTIssuer)))
+	}
+
+	// Health checks shared by the HTTP probes and gRPC health service
+	healthHandler := handler.NewHealthHandler(healthChecks, orderService.QueueDepth, orderService.QueueCapacity())
 
 	// Initialize gRPC server
-	grpcServer := grpc.NewServer()
-	grpcHandler := handler.NewGRPCHandler(orderService)
+	rateLimits := handler.RateLimits{TrustForwardedFor: cfg.TrustForwardedFor}
+	if cfg.UserRateLimit > 0 {
+		rateLimits.Users = newRateLimiter(cfg.RateLimitStore, rdb, "user", cfg.UserRateLimit, cfg.UserRateBurst)
+	}
+	if cfg.IPRateLimit > 0 {
+		rateLimits.IPs = newRateLimiter(cfg.RateLimitStore, rdb, "ip", cfg.IPRateLimit, cfg.IPRateBurst)
+	}
+
+	accessLog := handler.NewAccessLogger(slog.Default(), cfg.AccessLogSampleRate, cfg.AccessLogMaxPerSecond)
+
+	// Calls are made for the tenant of the caller's bearer token, like the
+	// HTTP API's
+	interceptors := []grpc.UnaryServerInterceptor{handler.RecoveryInterceptor, accessLog.UnaryInterceptor(), handler.TenantInterceptor(adminAuthorizer)}
+	if rateLimits.Users != nil || rateLimits.IPs != nil {
+		interceptors = append(interceptors, handler.RateLimitInterceptor(rateLimits))
+	}
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(handler.TenantStreamInterceptor(adminAuthorizer)),
+	)
+	validatorOpts := []handler.PurchaseValidatorOption{
+		handler.WithMaxQuantity(cfg.MaxQuantity),
+		handler.WithItemQuantityLimits(cfg.ItemQuantityLimits),
+	}
+	if cfg.RequireUUIDRequestIDs {
+		validatorOpts = append(validatorOpts, handler.WithUUIDRequestIDs())
+	}
+	validator := handler.NewPurchaseValidator(validatorOpts...)
+
+	var botGuard *service.BotGuard
+	if cfg.BotCheckVerifyURL != "" {
+		botGuard = service.NewBotGuard(botcheck.NewSiteVerify(cfg.BotCheckVerifyURL, cfg.BotCheckSecret, cfg.BotCheckTimeout), cfg.BotCheckTrusted)
+		log.Printf("bot check enabled, %d trusted client ranges", len(cfg.BotCheckTrusted))
+	}
+
+	// Tokens are only issued once the campaign starts, if it is scheduled
+	var purchaseTokens *service.PurchaseTokens
+	if cfg.PurchaseTokenSecret != "" {
+		var opensAt time.Time
+		campaign, err := database.GetCampaign(ctx, cfg.CampaignID)
+		if err != nil {
+			log.Fatalf("failed to load campaign %s: %v", cfg.CampaignID, err)
+		}
+		if campaign != nil {
+			opensAt = campaign.StartsAt
+		}
+		purchaseTokens = service.NewPurchaseTokens([]byte(cfg.PurchaseTokenSecret), cfg.PurchaseTokenTTL, cache, opensAt)
+	}
+
+	grpcOpts := []handler.GRPCHandlerOption{
+		handler.WithGRPCPurchaseValidator(validator),
+		handler.WithGRPCTrustForwardedFor(cfg.TrustForwardedFor),
+	}
+	if lotteryService != nil {
+		grpcOpts = append(grpcOpts, handler.WithGRPCLottery(lotteryService))
+	}
+	if botGuard != nil {
+		grpcOpts = append(grpcOpts, handler.WithGRPCBotCheck(botGuard, cfg.TrustForwardedFor))
+	}
+	if purchaseTokens != nil {
+		grpcOpts = append(grpcOpts, handler.WithGRPCPurchaseTokens(purchaseTokens))
+	}
+	grpcHandler := handler.NewGRPCHandler(orderService, stockService, grpcOpts...)
 	pb.RegisterOrderServiceServer(grpcServer, grpcHandler)
 
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+	go handler.ServeGRPCHealth(ctx, healthServer, healthHandler, map[string][]string{
+		pb.OrderService_ServiceDesc.ServiceName: {"redis", "order_queue"},
+	})
+
 	// Start gRPC server
-	lis, err := net.Listen("tcp", grpcPort)
+	lis, err := net.Listen("tcp", cfg.GRPCPort)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
 	go func() {
-		log.Printf("gRPC server listening on %s", grpcPort)
+		log.Printf("gRPC server listening on %s", cfg.GRPCPort)
 		if err := grpcServer.Serve(lis); err != nil {
 			log.Printf("gRPC server error: %v", err)
 		}
 	}()
 
 	// Initialize HTTP server
-	httpHandler := handler.NewHTTPHandler(orderService)
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", httpHandler.HealthCheck)
-	mux.HandleFunc("/api/purchase", httpHandler.Purchase)
+	httpOpts := []handler.HTTPHandlerOption{
+		handler.WithPurchaseValidator(validator),
+		handler.WithTrustForwardedFor(cfg.TrustForwardedFor),
+	}
+	if cfg.AsyncPurchases {
+		httpOpts = append(httpOpts, handler.WithAsyncPurchases())
+	}
+	if lotteryService != nil {
+		httpOpts = append(httpOpts, handler.WithLottery(lotteryService))
+	}
+	if botGuard != nil {
+		httpOpts = append(httpOpts, handler.WithBotCheck(botGuard, cfg.TrustForwardedFor))
+	}
+	if purchaseTokens != nil {
+		httpOpts = append(httpOpts, handler.WithPurchaseTokens(purchaseTokens))
+	}
+	httpHandler := handler.NewHTTPHandler(orderService, httpOpts...)
+	stockHandler := handler.NewStockHandler(stockService)
+	notificationHandler := handler.NewNotificationHandler(resultService)
+	partnerHandler := handler.NewPartnerHandler(allocationService, cfg.PartnerAPIKeys)
+	orderHandler := handler.NewOrderHandler(reservationService)
+	orderHistory := service.NewOrderHistoryService(sqlAdapter)
+	orderHistoryHandler := handler.NewOrderHistoryHandler(orderHistory)
+	graphQLHandler := handler.NewGraphQLHandler(reservationService, orderHistory, catalog, orderService, campaignService)
+	catalogHandler := handler.NewCatalogHandler(catalog, orderService)
+	refundHandler := handler.NewRefundHandler(refundService)
+	auditService := service.NewAuditService(sqlAdapter)
+	couponHandler := handler.NewCouponHandler(couponService, auditService)
+	lotteryHandler := handler.NewLotteryHandler(lotteryService)
+	tierHandler := handler.NewTierHandler(tierService, auditService)
+	blacklistHandler := handler.NewBlacklistHandler(blacklistService, auditService)
+	tokenHandler := handler.NewTokenHandler(purchaseTokens)
+	statsHandler := handler.NewStatsHandler(service.NewSaleStatsService(stockStore, campaigns, sqlAdapter))
+	exportHandler := handler.NewExportHandler(service.NewOrderExporter(database, cfg.ExportBatchSize, cfg.ExportRowsPerSecond))
+	auditHandler := handler.NewAuditHandler(auditService)
+	orderChangeHandler := handler.NewOrderChangeHandler(service.NewOrderChangeService(sqlAdapter))
+	adminHandler := handler.NewAdminHandler(workerTuning, campaignService, inventoryService, auditService)
+	regionHandler := handler.NewRegionHandler(regionalStock, auditService)
+	rateLimit := func(next http.Handler) http.Handler { return handler.RateLimit(rateLimits, next) }
+	adminAuth := func(next http.Handler) http.Handler { return handler.AdminAuth(adminAuthorizer, next) }
+	tenantAuth := func(next http.Handler) http.Handler { return handler.TenantAuth(adminAuthorizer, next) }
+	apiRoutes := func(api *handler.Router) {
+		// Partners sell for whichever tenant owns the items allocated to them
+		api.HandleFunc("/partner/allocations", partnerHandler.Allocate)
+		api.HandleFunc("/partner/allocations/{id}/fulfill", partnerHandler.Fulfill)
+
+		// Customers buy from the tenant their bearer token was issued for
+		api = api.Group("", tenantAuth)
+		api.HandleFunc("/purchase", httpHandler.Purchase, rateLimit)
+		api.HandleFunc("GET /purchase/{request_id}", httpHandler.PurchaseStatus)
+		if purchaseTokens != nil {
+			api.HandleFunc("/token", tokenHandler.Issue, rateLimit)
+		}
+		api.HandleFunc("GET /items", catalogHandler.Items)
+		api.HandleFunc("GET /items/{id}", catalogHandler.Item)
+		api.HandleFunc("/orders/{id}/confirm", orderHandler.Confirm)
+		api.HandleFunc("/orders/{id}/cancel", orderHandler.Cancel)
+		api.HandleFunc("GET /users/{user_id}/orders", orderHistoryHandler.List)
+		api.HandleFunc("GET /users/{user_id}/orders/{id}", orderHandler.Get)
+		api.Handle("/graphql", graphQLHandler)
+		api.HandleFunc("GET /stock/{item_id}/stream", stockHandler.Stream)
+	}
+	// Tenant admins manage their own items and campaigns and see their own
+	// sale's statistics and purchases. Coupons, tiers, the blacklist and the
+	// audit log span tenants, and exports, refunds and the order change log
+	// stay with operators
+	adminRoutes := func(admin *handler.Router) {
+		admin.HandleFunc("/worker-settings", adminHandler.WorkerSettings, handler.OperatorOnly)
+		admin.HandleFunc("/campaigns", adminHandler.Campaigns)
+		admin.HandleFunc("/campaigns/{id}", adminHandler.Campaign)
+		admin.HandleFunc("DELETE /campaigns/{id}", adminHandler.TeardownCampaign)
+		admin.HandleFunc("/campaigns/{id}/warmup", adminHandler.WarmupCampaign)
+		admin.HandleFunc("GET /stats/{campaign}", statsHandler.Campaign)
+		admin.HandleFunc("GET /orders/export", exportHandler.Orders, handler.OperatorOnly)
+		admin.HandleFunc("GET /audit", auditHandler.List, handler.OperatorOnly)
+		admin.HandleFunc("/items", adminHandler.Items)
+		admin.HandleFunc("/items/{id}", adminHandler.Item)
+		admin.HandleFunc("/items/{id}/restock", adminHandler.Restock)
+		admin.HandleFunc("/orders/{id}/refund", refundHandler.Refund, handler.OperatorOnly)
+		if cfg.OrderStore == config.OrderStoreEvents {
+			admin.HandleFunc("GET /orders/{id}/changes", orderChangeHandler.Order, handler.OperatorOnly)
+			admin.HandleFunc("GET /order-changes", orderChangeHandler.List, handler.OperatorOnly)
+		}
+		admin.HandleFunc("/coupons", couponHandler.Coupons, handler.OperatorOnly)
+		admin.HandleFunc("/coupons/{code}", couponHandler.Coupon, handler.OperatorOnly)
+		admin.HandleFunc("/tiers", tierHandler.Tiers, handler.OperatorOnly)
+		admin.HandleFunc("/tiers/{user_id}", tierHandler.Tier, handler.OperatorOnly)
+		admin.HandleFunc("GET /purchases/{request_id}", httpHandler.PurchaseRecord)
+		admin.HandleFunc("/blacklist", blacklistHandler.Blacklist, handler.OperatorOnly)
+		admin.HandleFunc("/blacklist/users/{user_id}", blacklistHandler.User, handler.OperatorOnly)
+		admin.HandleFunc("/blacklist/ip-ranges/{cidr...}", blacklistHandler.IPRange, handler.OperatorOnly)
+		if lotteryService != nil {
+			admin.HandleFunc("/lottery/{item_id}/draw", lotteryHandler.Draw)
+		}
+		if regionalStock != nil {
+			admin.HandleFunc("GET /items/{id}/regions", regionHandler.Regions)
+			admin.HandleFunc("/items/{id}/rebalance", regionHandler.Rebalance)
+		}
+	}
+
+	apiSpec := handler.APISpec()
+	v1Middleware := []handler.Middleware{accessLog.Middleware()}
+	switch cfg.OpenAPIValidation {
+	case config.OpenAPIValidationRequests:
+		v1Middleware = append(v1Middleware, handler.ValidateAPI(apiSpec, "/v1"))
+	case config.OpenAPIValidationResponses:
+		v1Middleware = append(v1Middleware, handler.ValidateAPI(apiSpec, "/v1", handler.WithResponseValidation(handler.LogResponseMismatches)))
+	}
+
+	router := handler.NewRouter()
+	router.HandleFunc("/health", httpHandler.HealthCheck)
+	router.HandleFunc("/healthz", healthHandler.Liveness)
+	router.HandleFunc("/readyz", healthHandler.Readiness)
+	router.Handle("/metrics", promMetrics.Handler())
+	router.HandleFunc("GET /openapi.json", handler.ServeOpenAPI(apiSpec))
+
+	v1 := router.Group("/v1", v1Middleware...)
+	apiRoutes(v1)
+	v1.HandleFunc("GET /ws", notificationHandler.ServeWS, tenantAuth)
+	adminRoutes(v1.Group("/admin", adminAuth))
+
+	// Unversioned routes from before /v1, kept until clients have moved
+	legacy := router.Group("", accessLog.Middleware())
+	apiRoutes(legacy.Group("/api", handler.Deprecated("/api", "/v1")))
+	legacy.HandleFunc("GET /ws", notificationHandler.ServeWS, handler.Deprecated("", "/v1"), tenantAuth)
+	adminRoutes(legacy.Group("/admin", handler.Deprecated("", "/v1"), adminAuth))
+
+	httpMiddleware := []handler.Middleware{handler.LimitBody(int64(cfg.MaxBodyBytes))}
+	if len(cfg.CompressionEncodings) > 0 {
+		httpMiddleware = append(httpMiddleware, handler.Compress(cfg.CompressionMinBytes, cfg.CompressionEncodings...))
+	}
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		// Preflights are answered before routing, which knows nothing of OPTIONS
+		httpMiddleware = append([]handler.Middleware{handler.CORS(handler.CORSPolicy{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		})}, httpMiddleware...)
+	}
 
 	httpServer := &http.Server{
-		Addr:    httpPort,
-		Handler: mux,
+		Addr:              cfg.HTTPPort,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		Handler: otelhttp.NewHandler(handler.Chain(router, httpMiddleware...), "http",
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				switch r.URL.Path {
+				case "/metrics", "/health", "/healthz", "/readyz":
+					return false
+				}
+				return true
+			}),
+		),
+	}
+
+	httpLis, err := net.Listen("tcp", cfg.HTTPPort)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	if cfg.HTTPMaxConnections > 0 {
+		// Connections past the cap wait in the accept backlog
+		httpLis = netutil.LimitListener(httpLis, cfg.HTTPMaxConnections)
 	}
 
 	go func() {
-		log.Printf("HTTP server listening on %s", httpPort)
-		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Printf("HTTP server listening on %s", cfg.HTTPPort)
+		if err := httpServer.Serve(httpLis); err != http.ErrServerClosed {
 			log.Printf("HTTP server error: %v", err)
 		}
 	}()
 
+	// Start diagnostics listener
+	var debugServer *http.Server
+	if cfg.DebugAddr != "" {
+		debugServer = &http.Server{
+			Addr:    cfg.DebugAddr,
+			Handler: handler.NewDebugHandler(orderService.QueueDepth),
+		}
+		go func() {
+			log.Printf("debug server listening on %s", cfg.DebugAddr)
+			if err := debugServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Printf("debug server error: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -130,44 +754,353 @@ func main() {
 
 	log.Println("shutting down...")
 
+	// End stock streams so they don't hold up the HTTP and gRPC shutdowns
+	stockService.Close()
+
 	// Stop HTTP server
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
 	httpServer.Shutdown(shutdownCtx)
+	if debugServer != nil {
+		debugServer.Shutdown(shutdownCtx)
+	}
 	log.Println("HTTP server stopped")
 
 	// Stop gRPC server
+	healthServer.Shutdown()
 	grpcServer.GracefulStop()
 	log.Println("gRPC server stopped")
 
-	// Close order queue and wait for workers
+	// Spool orders no worker has picked up, then close the queue and wait
+	// for workers to finish the ones they hold
+	spoolCtx, spoolCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer spoolCancel()
+	if n, err := orderService.SpoolQueued(spoolCtx); err != nil {
+		log.Printf("failed to spool queued orders, persisting them instead: %v", err)
+	} else if n > 0 {
+		log.Printf("spooled %d queued orders", n)
+	}
 	orderService.Close()
+	close(workersShutdown)
 	wg.Wait()
+	if pool != nil {
+		pool.Wait()
+	}
 	log.Println("workers stopped")
 
+	// Write the purchase outcomes still queued, now that no more can come
+	if purchaseAnalytics != nil {
+		if err := purchaseAnalytics.Close(shutdownCtx); err != nil {
+			log.Printf("purchase analytics close error: %v", err)
+		}
+	}
+
+	// Flush the events the workers published last
+	if saleEvents != nil {
+		if err := saleEvents.Close(); err != nil {
+			log.Printf("sale events writer close error: %v", err)
+		}
+	}
+
+	// Stop payment events consumer
+	stopConsumer()
+	<-consumerDone
+
+	// Put unsold leased stock back on sale
+	if leasedStock != nil {
+		if err := leasedStock.Close(shutdownCtx); err != nil {
+			log.Printf("failed to return leased stock: %v", err)
+		}
+	}
+
 	// Close connections
-	rdb.Close()
-	db.Close()
+	if rdb != nil {
+		rdb.Close()
+	}
+	if len(dbs) > 0 {
+		// Prepared statements go before the connections they live on
+		if closer, ok := sqlAdapter.(io.Closer); ok {
+			closer.Close()
+		}
+		for _, db := range dbs {
+			db.Close()
+		}
+	}
 	log.Println("connections closed")
+
+	// Flush remaining spans
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("tracing shutdown error: %v", err)
+	}
 }
 
-func workerLoop(id int, queue <-chan domain.Order, db port.DatabaseRepository, cache port.CacheRepository) {
-	for order := range queue {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// cacheStore is what the server keeps in Redis, or in memory with -dev.
+type cacheStore interface {
+	port.CacheRepository
+	port.StockFeed
+	port.SoldOutFeed
+	port.OrderResultFeed
+	port.OrderEventFeed
+	port.CampaignKeyspace
+	port.PurchaseQuota
+	port.CouponRedemptions
+	port.LotteryEntries
+	port.StockReserve
+	port.Blacklist
+	port.RiskSignals
+	port.PurchaseRecords
+	port.SaleCounters
+}
 
-		if err := db.CreateOrder(ctx, order); err != nil {
-			log.Printf("worker %d: failed to save order %s: %v", id, order.ID, err)
+// sqlStore is what the server keeps in its SQL database, or in memory with
+// -dev.
+type sqlStore interface {
+	port.DatabaseRepository
+	port.CompensationLog
+	port.RefundRepository
+	port.CouponRepository
+	port.UserTierRepository
+	port.AuditLog
+	port.OrderArchive
+	port.OrderOffload
+	port.OrderReadModel
+	port.OrderChangeLog
+}
 
-			// Rollback: restore stock in Redis
-			if rollbackErr := cache.IncrementStock(ctx, order.ItemID, order.Quantity); rollbackErr != nil {
-				log.Printf("worker %d: CRITICAL rollback failed for order %s: %v", id, order.ID, rollbackErr)
-			} else {
-				log.Printf("worker %d: rolled back stock for order %s", id, order.ID)
+// checkStock compares the cache stock of the campaign's items with the
+// database and handles any excess as cfg.StartupStockCheck says.
+func checkStock(ctx context.Context, cfg *config.Config, cache port.CacheRepository, database port.DatabaseRepository, redisAdapter *storage.RedisAdapter, compensations port.CompensationLog) error {
+	itemIDs := []string{cfg.ItemID}
+	campaign, err := database.GetCampaign(ctx, cfg.CampaignID)
+	if err != nil {
+		return fmt.Errorf("load campaign %s: %w", cfg.CampaignID, err)
+	}
+	if campaign != nil {
+		for _, itemID := range campaign.ItemIDs {
+			if !slices.Contains(itemIDs, itemID) {
+				itemIDs = append(itemIDs, itemID)
 			}
+		}
+	}
+
+	var spool port.OrderSpool
+	if redisAdapter != nil {
+		spool = redisAdapter
+	}
+	check := service.NewStockCheck(cache, database, spool, compensations)
+	drifts, err := check.Check(ctx, itemIDs)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		log.Printf("stock check: cache stock of %d items matches the database", len(itemIDs))
+		return nil
+	}
+
+	for _, drift := range drifts {
+		log.Printf("stock check: %s has %d units in the cache, only %d expected from the database", drift.ItemID, drift.Cache, drift.Expected)
+	}
+	switch cfg.StartupStockCheck {
+	case config.StockCheckCorrect:
+		return check.Correct(ctx, drifts)
+	case config.StockCheckRefuse:
+		return fmt.Errorf("cache holds more stock than the database for %d items", len(drifts))
+	default:
+		log.Printf("WARNING: stock check: excess cache stock may be sold twice; set STARTUP_STOCK_CHECK=%s to take it off", config.StockCheckCorrect)
+		return nil
+	}
+}
+
+// openDatabase connects to MySQL, and its shards if there are any, and
+// applies pending migrations if MIGRATE_ON_START is set, or opens SQLite and
+// creates its schema and the configured item, since no migration runs
+// against it. The first database returned is the primary, followed by the
+// shards.
+func openDatabase(ctx context.Context, cfg *config.Config) ([]*sql.DB, sqlStore, error) {
+	var opts []storage.MySQLOption
+	if cfg.OrderStore == config.OrderStoreEvents {
+		opts = append(opts, storage.WithOrderChanges())
+	}
+	if !cfg.PreparedStatements {
+		opts = append(opts, storage.WithoutPreparedStatements())
+	}
+
+	if cfg.DatabaseDriver == config.DatabaseDriverSQLite {
+		db, err := storage.OpenSQLite(ctx, cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		adapter := storage.NewSQLiteAdapter(db, opts...)
+		now := time.Now()
+		if _, err := adapter.CreateItem(ctx, domain.Item{ID: cfg.ItemID, Name: cfg.ItemID, Stock: cfg.InitialStock, Currency: domain.DefaultCurrency, CreatedAt: now, UpdatedAt: now}); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("create item: %w", err)
+		}
+		log.Printf("opened sqlite database %s", cfg.SQLitePath)
+		return []*sql.DB{db}, adapter, nil
+	}
+
+	db, err := openMySQL(ctx, cfg, cfg.MySQLDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Println("connected to mysql")
+
+	if len(cfg.MySQLShardDSNs) > 0 {
+		dbs := []*sql.DB{db}
+		closeAll := func() {
+			for _, db := range dbs {
+				db.Close()
+			}
+		}
+		for i, dsn := range cfg.MySQLShardDSNs {
+			shard, err := openMySQL(ctx, cfg, dsn)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("shard %d: %w", i+1, err)
+			}
+			dbs = append(dbs, shard)
+		}
+		adapters := make([]*storage.MySQLAdapter, 0, len(dbs))
+		for _, db := range dbs {
+			adapters = append(adapters, storage.NewMySQLAdapter(db, opts...))
+		}
+		sharded := storage.NewShardedDatabase(adapters...)
+		go sharded.CheckShards(ctx, cfg.MySQLShardCheckInterval)
+		log.Printf("sharding items over %d mysql databases", len(dbs))
+		return dbs, sharded, nil
+	}
+
+	if cfg.MySQLReplicaDSN != "" {
+		replica, err := sql.Open("mysql", cfg.MySQLReplicaDSN)
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("open replica: %w", err)
+		}
+		setMySQLPool(replica)
+		// A replica that is down only sends its reads to the primary, so
+		// the server starts without it.
+		if err := replica.PingContext(ctx); err != nil {
+			log.Printf("mysql replica is down, reading from the primary until it answers: %v", err)
 		} else {
-			log.Printf("worker %d: saved order %s", id, order.ID)
+			log.Println("connected to mysql replica")
+		}
+		opts = append(opts, storage.WithReplica(replica))
+	}
+	adapter := storage.NewMySQLAdapter(db, opts...)
+	go adapter.CheckReplica(ctx, cfg.MySQLReplicaCheckInterval)
+	return []*sql.DB{db}, adapter, nil
+}
+
+// openMySQL connects to the MySQL database at dsn, with a pool of its own,
+// and applies pending migrations if MIGRATE_ON_START is set.
+func openMySQL(ctx context.Context, cfg *config.Config, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	setMySQLPool(db)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+
+	if cfg.MigrateOnStart {
+		migrator, err := storage.NewMigrator(db, migrations.FS)
+		if err != nil {
+			db.Close()
+			return nil, err
 		}
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied migration %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+	}
+	return db, nil
+}
+
+func setMySQLPool(db *sql.DB) {
+	db.SetMaxOpenConns(50)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+}
+
+// newRegionalStock returns the stock of the regions in
+// cfg.RegionStockShares, reaching this region's through cache and every
+// other region's through its own Redis, or memory with -dev.
+func newRegionalStock(cfg *config.Config, dev bool, cache port.CacheRepository, db port.DatabaseRepository) *service.RegionalStock {
+	regions := map[string]port.CacheRepository{cfg.Region: cache}
+	itemTenants := service.NewItemTenants(db)
+	for region := range cfg.RegionStockShares {
+		if region == cfg.Region {
+			continue
+		}
+		if dev {
+			regions[region] = memory.NewCache(memory.WithCampaign(cfg.CampaignID))
+			continue
+		}
+		rdb := storage.NewRedisClient(storage.RedisSettings{Addr: cfg.RegionRedisAddrs[region], FailoverTimeout: cfg.RedisFailoverTimeout})
+		regions[region] = storage.NewRedisAdapter(rdb, storage.WithItemTenants(itemTenants.TenantOf), storage.WithCampaignKeys(cfg.CampaignID), storage.WithStockShards(cfg.StockShards), storage.WithRetries(cfg.RedisRetryAttempts, cfg.RedisRetryBackoff))
+	}
+	return service.NewRegionalStock(cfg.Region, cfg.RegionStockShares, regions)
+}
+
+// newNotifier returns the notifier named by cfg.Notifier, or nil for none.
+func newNotifier(cfg *config.Config) port.Notifier {
+	switch cfg.Notifier {
+	case config.NotifierLog:
+		return notify.NewLog()
+	case config.NotifierSMTP:
+		return notify.NewSMTP(notify.SMTPSettings{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			To:       cfg.SMTPTo,
+		})
+	default:
+		return nil
+	}
+}
+
+func newAnalyticsSink(cfg *config.Config) port.AnalyticsSink {
+	switch cfg.AnalyticsSink {
+	case config.AnalyticsSinkLog:
+		return analytics.NewLog()
+	case config.AnalyticsSinkClickHouse:
+		return analytics.NewClickHouse(cfg.ClickHouseURL, cfg.ClickHouseTable, cfg.ClickHouseUser, cfg.ClickHousePassword, cfg.ClickHouseTimeout)
+	default:
+		return nil
+	}
+}
+
+// newJob schedules run, a pass of background work reporting how much it did,
+// on one server per interval.
+func newJob(cfg *config.Config, name string, interval time.Duration, run func(context.Context) (int, error)) service.Job {
+	return service.Job{
+		Name:       name,
+		Interval:   interval,
+		Jitter:     time.Duration(float64(interval) * cfg.JobJitter),
+		LeaderOnly: true,
+		Run: func(ctx context.Context) error {
+			_, err := run(ctx)
+			return err
+		},
+	}
+}
 
-		cancel()
+// newRateLimiter allows perSecond requests per key with bursts of burst. In
+// Redis this becomes a sliding window of burst requests per burst/perSecond
+// seconds, which sustains the same rate.
+func newRateLimiter(store string, rdb redis.UniversalClient, scope string, perSecond float64, burst int) port.RateLimiter {
+	if store == config.RateLimitStoreRedis {
+		window := time.Duration(float64(burst) / perSecond * float64(time.Second))
+		return storage.NewRedisRateLimiter(rdb, scope, burst, window)
 	}
+	return memory.NewRateLimiter(perSecond, burst)
 }
@@ -2,21 +2,32 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/rl1809/flash-sale/internal/adapter/storage"
 	"github.com/rl1809/flash-sale/internal/core/service"
+	"github.com/rl1809/flash-sale/internal/loadgen"
+	"github.com/rl1809/flash-sale/internal/loadgen/pb"
 )
 
 const (
 	redisAddr     = "localhost:6379"
+	campaignID    = "stress-test"
 	itemID        = "flash-sale-item"
 	initialStock  = 20
 	totalRequests = 50
@@ -24,6 +35,158 @@ const (
 )
 
 func main() {
+	mode := flag.String("mode", "local", "local, remote, generator or coordinator")
+	listen := flag.String("listen", ":7070", "generator: address to serve LoadGenerator on")
+	generators := flag.String("generators", "", "coordinator: comma-separated generator addresses")
+	target := flag.String("target", "localhost:50051", "coordinator, remote: gRPC address of the server under test")
+	healthURL := flag.String("health-url", "http://localhost:8080/readyz", "coordinator: readiness URL of the server under test")
+	item := flag.String("item", "iphone-15", "coordinator, remote: item to buy")
+	requests := flag.Int("requests", 1000, "coordinator: total purchases")
+	roundSize := flag.Int("round-size", 100, "coordinator: purchases per generator per round")
+	concurrency := flag.Int("concurrency", 20, "coordinator: purchases in flight per generator; remote: purchases in flight")
+	protocol := flag.String("protocol", "http", "remote: http or grpc")
+	baseURL := flag.String("base-url", "http://localhost:8080", "remote: HTTP address of the server under test")
+	duration := flag.Duration("duration", 30*time.Second, "remote: how long to send purchases for")
+	qps := flag.Float64("qps", 0, "remote: purchases started per second; 0 starts each as soon as one finishes")
+	users := flag.Int("users", 0, "remote: distinct users buying in turn; 0 makes each purchase a new user")
+	token := flag.String("token", "", "remote: bearer token sent with each purchase, for a gateway that requires one")
+	timeout := flag.Duration("timeout", 5*time.Second, "remote: timeout of each purchase")
+	flag.Parse()
+
+	switch *mode {
+	case "local":
+		runLocal()
+	case "remote":
+		runRemote(*protocol, *baseURL, *target, *token, *timeout, loadgen.Load{
+			ItemID:      *item,
+			UserPrefix:  "stress-user-",
+			Users:       *users,
+			Concurrency: *concurrency,
+			QPS:         *qps,
+			Duration:    *duration,
+		})
+	case "generator":
+		runGenerator(*listen)
+	case "coordinator":
+		runCoordinator(strings.Split(*generators, ","), *healthURL, loadgen.Plan{
+			Target:      *target,
+			ItemID:      *item,
+			Requests:    *requests,
+			RoundSize:   *roundSize,
+			Concurrency: *concurrency,
+			MinBackoff:  500 * time.Millisecond,
+			MaxBackoff:  10 * time.Second,
+		})
+	default:
+		log.Fatalf("unknown mode %q", *mode)
+	}
+}
+
+// runGenerator serves LoadGenerator so a coordinator can drive this process.
+func runGenerator(listen string) {
+	lis, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	gen := loadgen.NewGenerator()
+	defer gen.Close()
+
+	server := grpc.NewServer()
+	pb.RegisterLoadGeneratorServer(server, gen)
+	log.Printf("generator listening on %s", listen)
+	if err := server.Serve(lis); err != nil {
+		log.Fatalf("generator server error: %v", err)
+	}
+}
+
+// runCoordinator drives the generators against the target and prints the
+// aggregated results.
+func runCoordinator(addrs []string, healthURL string, plan loadgen.Plan) {
+	var clients []pb.LoadGeneratorClient
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("failed to dial generator %s: %v", addr, err)
+		}
+		defer conn.Close()
+		clients = append(clients, pb.NewLoadGeneratorClient(conn))
+	}
+
+	probe := loadgen.HTTPHealthProbe(&http.Client{Timeout: 2 * time.Second}, healthURL)
+	report, err := loadgen.NewCoordinator(clients, probe).Run(context.Background(), plan)
+	if err != nil {
+		log.Fatalf("load test failed: %v", err)
+	}
+
+	fmt.Println("========== DISTRIBUTED LOAD TEST ==========")
+	fmt.Printf("Generators:       %d\n", len(clients))
+	fmt.Printf("Total Requests:   %d\n", plan.Requests)
+	fmt.Printf("Successful:       %d\n", report.Succeeded)
+	fmt.Printf("Rejected:         %d\n", report.Rejected)
+	fmt.Printf("Failed:           %d\n", report.Failed)
+	fmt.Printf("Rounds:           %d\n", report.Rounds)
+	fmt.Printf("Health Backoffs:  %d\n", report.Backoffs)
+	fmt.Printf("Worst p99:        %v\n", report.WorstP99)
+	fmt.Printf("Duration:         %v\n", report.Duration)
+	fmt.Println("===========================================")
+}
+
+// runRemote drives load against a running server through its HTTP or gRPC
+// API and prints what it saw.
+func runRemote(protocol, baseURL, target, token string, timeout time.Duration, load loadgen.Load) {
+	if load.Concurrency < 1 || load.Duration <= 0 || load.QPS < 0 || load.Users < 0 {
+		log.Fatalf("concurrency and duration must be positive, qps and users must not be negative")
+	}
+
+	var purchaser loadgen.Purchaser
+	var address string
+	switch protocol {
+	case "http":
+		purchaser, address = loadgen.NewHTTPPurchaser(baseURL, token, load.Concurrency, timeout), baseURL
+	case "grpc":
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("failed to dial %s: %v", target, err)
+		}
+		defer conn.Close()
+		purchaser, address = loadgen.NewGRPCPurchaser(conn, token, timeout), target
+	default:
+		log.Fatalf("unknown protocol %q", protocol)
+	}
+
+	// Stop sending on Ctrl-C and report what was sent until then
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	log.Printf("buying %s from %s over %s for %v", load.ItemID, address, protocol, load.Duration)
+	report := loadgen.Drive(ctx, purchaser, load)
+
+	fmt.Println("========== REMOTE LOAD TEST ==========")
+	fmt.Printf("Target:           %s (%s)\n", address, protocol)
+	fmt.Printf("Sent:             %d\n", report.Sent)
+	fmt.Printf("Successful:       %d\n", report.Succeeded)
+	fmt.Printf("Rejected:         %d\n", report.Rejected)
+	fmt.Printf("Failed:           %d\n", report.Failed)
+	if load.QPS > 0 {
+		fmt.Printf("Skipped:          %d\n", report.Skipped)
+	}
+	fmt.Printf("Throughput:       %.1f/s\n", report.Throughput())
+	fmt.Printf("Latency p50:      %v\n", report.P50)
+	fmt.Printf("Latency p99:      %v\n", report.P99)
+	fmt.Printf("Latency max:      %v\n", report.Max)
+	fmt.Printf("Duration:         %v\n", report.Duration)
+	fmt.Println("Answers:")
+	for _, answer := range report.AnswerNames() {
+		fmt.Printf("  %-16s %d\n", answer+":", report.Answers[answer])
+	}
+	fmt.Println("======================================")
+}
+
+// runLocal runs purchases in-process against Redis, without the server.
+func runLocal() {
 	ctx := context.Background()
 
 	// Initialize Redis
@@ -33,15 +196,13 @@ func main() {
 	}
 	defer rdb.Close()
 
-	// Clear previous test data
-	rdb.Del(ctx, "stock:"+itemID)
-	keys, _ := rdb.Keys(ctx, "idempotency:*").Result()
-	for _, k := range keys {
-		rdb.Del(ctx, k)
+	// Initialize adapter and clear previous test data
+	redisAdapter := storage.NewRedisAdapter(rdb, storage.WithCampaignKeys(campaignID))
+	if _, err := redisAdapter.DeleteCampaign(ctx, campaignID); err != nil {
+		log.Fatalf("failed to clear previous run: %v", err)
 	}
 
-	// Initialize adapter and service
-	redisAdapter := storage.NewRedisAdapter(rdb)
+	// Initialize service
 	if err := redisAdapter.SetStock(ctx, itemID, initialStock); err != nil {
 		log.Fatalf("failed to set stock: %v", err)
 	}
@@ -69,7 +230,7 @@ func main() {
 			defer wg.Done()
 
 			requestID := uuid.New().String()
-			err := orderService.Purchase(ctx, requestID, fmt.Sprintf("user-%d", userID), itemID, 1)
+			_, err := orderService.Purchase(ctx, requestID, fmt.Sprintf("user-%d", userID), itemID, 1)
 			if err == nil {
 				successCount.Add(1)
 			} else {
@@ -102,7 +263,11 @@ func main() {
 	}
 
 	// Verify final stock in Redis
-	finalStock, _ := rdb.Get(ctx, "stock:"+itemID).Int()
+	archive, err := redisAdapter.SnapshotCampaign(ctx, campaignID)
+	if err != nil {
+		log.Fatalf("failed to read final stock: %v", err)
+	}
+	finalStock := archive.Stock[itemID]
 	fmt.Printf("Final Redis Stock: %d\n", finalStock)
 
 	if finalStock == 0 {
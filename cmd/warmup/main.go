@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/rl1809/flash-sale/internal/adapter/storage"
+	"github.com/rl1809/flash-sale/internal/config"
+	"github.com/rl1809/flash-sale/internal/core/service"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const usage = `usage: warmup [-campaign id]
+
+Prepares a campaign before its sale opens: checks that every item has stock
+in the database, clears keys left in the campaign's Redis keyspace, writes
+each item's stock to Redis and prints a readiness report. Exits with status
+1 if the campaign is not ready. The keys are those of the campaign's
+tenant, and with REGION_STOCK_SHARES set only REGION's share of the stock is
+written.
+
+flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	campaignID := flag.String("campaign", cfg.CampaignID, "campaign to warm up")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, database, err := openDatabase(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to open %s database: %v", cfg.DatabaseDriver, err)
+	}
+	defer db.Close()
+
+	rdb := storage.NewRedisClient(storage.RedisSettings{
+		Addr:             cfg.RedisAddr,
+		ClusterAddrs:     cfg.RedisClusterAddrs,
+		SentinelMaster:   cfg.RedisSentinelMaster,
+		SentinelAddrs:    cfg.RedisSentinelAddrs,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		FailoverTimeout:  cfg.RedisFailoverTimeout,
+	})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("failed to connect redis: %v", err)
+	}
+
+	keyspace := storage.NewRedisAdapter(rdb, storage.WithStockShards(cfg.StockShards))
+	var opts []service.CampaignServiceOption
+	if len(cfg.RegionStockShares) > 0 {
+		// Only the share is needed, other regions warm up their own Redis
+		opts = append(opts, service.WithWarmupRegions(service.NewRegionalStock(cfg.Region, cfg.RegionStockShares, nil)))
+	}
+	campaigns := service.NewCampaignService(keyspace, service.NewTenantScope(database), cfg.CampaignID, opts...)
+	warmup, err := campaigns.Warmup(ctx, *campaignID)
+	if err != nil {
+		log.Fatalf("warmup %s: %v", *campaignID, err)
+	}
+
+	fmt.Printf("campaign %s, sale opens %s\n", warmup.CampaignID, warmup.StartsAt.Format(time.RFC3339))
+	fmt.Printf("cleared %d leftover keys\n\n", warmup.KeysCleared)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ITEM\tINVENTORY\tSHARE\tSTOCK\tSTATUS")
+	for _, item := range warmup.Items {
+		status := "ok"
+		if item.Problem != "" {
+			status = item.Problem
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", item.ItemID, item.Inventory, item.Share, item.Stock, status)
+	}
+	tw.Flush()
+
+	if !warmup.Ready {
+		fmt.Println("\nnot ready")
+		os.Exit(1)
+	}
+	fmt.Println("\nready")
+}
+
+// openDatabase connects to the database the server uses. Unlike the server
+// it neither migrates nor seeds it.
+func openDatabase(ctx context.Context, cfg *config.Config) (*sql.DB, port.DatabaseRepository, error) {
+	if cfg.DatabaseDriver == config.DatabaseDriverSQLite {
+		db, err := storage.OpenSQLite(ctx, cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, storage.NewSQLiteAdapter(db), nil
+	}
+
+	db, err := sql.Open("mysql", cfg.MySQLDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("ping: %w", err)
+	}
+	return db, storage.NewMySQLAdapter(db), nil
+}
@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// maxErrorBytes bounds how much of an error response is read into the
+// error.
+const maxErrorBytes = 1 << 10
+
+// ClickHouse inserts purchase outcomes into a ClickHouse table over its
+// HTTP interface, one INSERT per batch in the JSONEachRow format. The
+// table needs the columns of clickHouseRow; see the README for one.
+type ClickHouse struct {
+	client   *http.Client
+	url      string
+	user     string
+	password string
+}
+
+func NewClickHouse(endpoint, table, user, password string, timeout time.Duration) *ClickHouse {
+	query := url.Values{"query": {"INSERT INTO " + table + " FORMAT JSONEachRow"}}
+	return &ClickHouse{
+		client:   &http.Client{Timeout: timeout},
+		url:      strings.TrimRight(endpoint, "/") + "/?" + query.Encode(),
+		user:     user,
+		password: password,
+	}
+}
+
+// clickHouseRow is one row of the table. The lines of a purchase are in
+// the parallel arrays item_ids and quantities.
+type clickHouseRow struct {
+	OccurredAt string   `json:"occurred_at"`
+	RequestID  string   `json:"request_id"`
+	UserID     string   `json:"user_id"`
+	ItemIDs    []string `json:"item_ids"`
+	Quantities []int    `json:"quantities"`
+	Outcome    string   `json:"outcome"`
+	Reason     string   `json:"reason"`
+	OrderID    string   `json:"order_id"`
+	ClientIP   string   `json:"client_ip"`
+	DeviceID   string   `json:"device_id"`
+	Coupon     string   `json:"coupon"`
+	DurationMS float64  `json:"duration_ms"`
+}
+
+func (c *ClickHouse) WritePurchaseOutcomes(ctx context.Context, outcomes []domain.PurchaseOutcome) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, outcome := range outcomes {
+		row := clickHouseRow{
+			OccurredAt: outcome.OccurredAt.UTC().Format("2006-01-02 15:04:05.000"),
+			RequestID:  outcome.RequestID,
+			UserID:     outcome.UserID,
+			ItemIDs:    make([]string, len(outcome.Items)),
+			Quantities: make([]int, len(outcome.Items)),
+			Outcome:    outcome.Outcome,
+			Reason:     outcome.Reason,
+			OrderID:    outcome.OrderID,
+			ClientIP:   outcome.ClientIP,
+			DeviceID:   outcome.DeviceID,
+			Coupon:     outcome.Coupon,
+			DurationMS: float64(outcome.Duration.Microseconds()) / 1000,
+		}
+		for i, line := range outcome.Items {
+			row.ItemIDs[i], row.Quantities[i] = line.ItemID, line.Quantity
+		}
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("encode purchase outcome: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, &body)
+	if err != nil {
+		return fmt.Errorf("build insert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.user != "" {
+		req.Header.Set("X-ClickHouse-User", c.user)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("insert purchase outcomes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+		return fmt.Errorf("insert purchase outcomes: status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestClickHouse_WritePurchaseOutcomes(t *testing.T) {
+	var query, user string
+	var rows []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, user = r.URL.Query().Get("query"), r.Header.Get("X-ClickHouse-User")
+		body, _ := io.ReadAll(r.Body)
+		for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			var row map[string]any
+			if err := json.Unmarshal([]byte(line), &row); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rows = append(rows, row)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewClickHouse(server.URL, "sale.purchase_outcomes", "writer", "secret", time.Second)
+	at := time.Date(2026, 3, 31, 12, 0, 0, 250e6, time.UTC)
+	outcomes := []domain.PurchaseOutcome{
+		{RequestID: "req-1", UserID: "user-1", Outcome: "success", OrderID: "order-1", OccurredAt: at, Duration: 1500 * time.Microsecond,
+			Items: []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 2}}},
+		{RequestID: "req-2", UserID: "user-2", Outcome: "sold_out", Reason: "insufficient stock", OccurredAt: at,
+			Items: []domain.OrderItem{{ItemID: "item-1", Quantity: 1}}},
+	}
+	if err := sink.WritePurchaseOutcomes(context.Background(), outcomes); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if query != "INSERT INTO sale.purchase_outcomes FORMAT JSONEachRow" || user != "writer" {
+		t.Errorf("unexpected query %q as %q", query, user)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", rows)
+	}
+	if rows[0]["occurred_at"] != "2026-03-31 12:00:00.250" || rows[0]["duration_ms"] != 1.5 {
+		t.Errorf("unexpected time columns: %v", rows[0])
+	}
+	if ids := rows[0]["item_ids"].([]any); len(ids) != 2 || ids[1] != "item-2" || rows[0]["quantities"].([]any)[1] != 2.0 {
+		t.Errorf("expected the lines in parallel arrays, got %v", rows[0])
+	}
+	if rows[1]["outcome"] != "sold_out" || rows[1]["reason"] != "insufficient stock" {
+		t.Errorf("expected the rejection, got %v", rows[1])
+	}
+}
+
+func TestClickHouse_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table sale.purchase_outcomes does not exist", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	sink := NewClickHouse(server.URL, "sale.purchase_outcomes", "", "", time.Second)
+	err := sink.WritePurchaseOutcomes(context.Background(), []domain.PurchaseOutcome{{RequestID: "req-1"}})
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+}
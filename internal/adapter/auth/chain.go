@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Chain tries each authorizer in turn and returns the first principal found.
+// An empty chain authenticates no one.
+type Chain []port.Authorizer
+
+func (c Chain) Authenticate(ctx context.Context, creds domain.Credentials) (*domain.Principal, error) {
+	for _, authorizer := range c {
+		principal, err := authorizer.Authenticate(ctx, creds)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// clockSkew is how far token times may be off from the local clock.
+const clockSkew = 30 * time.Second
+
+// JWT authenticates callers by HS256-signed bearer tokens. The token's sub
+// claim becomes the principal's subject, its roles claim its roles and its
+// optional tenant claim the tenant it is limited to.
+type JWT struct {
+	secret []byte
+	issuer string
+	now    func() time.Time
+}
+
+type JWTOption func(*JWT)
+
+// WithIssuer only accepts tokens whose iss claim is issuer.
+func WithIssuer(issuer string) JWTOption {
+	return func(j *JWT) {
+		j.issuer = issuer
+	}
+}
+
+func NewJWT(secret []byte, opts ...JWTOption) *JWT {
+	j := &JWT{secret: secret, now: time.Now}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Roles     []string `json:"roles"`
+	Tenant    string   `json:"tenant"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// Authenticate verifies the token's signature, issuer and validity window.
+// Tokens without an exp claim are rejected.
+func (j *JWT) Authenticate(ctx context.Context, creds domain.Credentials) (*domain.Principal, error) {
+	header, payload, signature, ok := splitToken(creds.BearerToken)
+	if !ok {
+		return nil, nil
+	}
+
+	var h jwtHeader
+	if !decodeSegment(header, &h) || h.Alg != "HS256" {
+		return nil, nil
+	}
+
+	mac := hmac.New(sha256.New, j.secret)
+	mac.Write([]byte(header + "." + payload))
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, nil
+	}
+
+	var claims jwtClaims
+	if !decodeSegment(payload, &claims) || claims.Subject == "" || claims.ExpiresAt == 0 {
+		return nil, nil
+	}
+	if j.issuer != "" && claims.Issuer != j.issuer {
+		return nil, nil
+	}
+	now := j.now()
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return nil, nil
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, nil
+	}
+
+	if claims.Tenant != "" && !domain.ValidTenantID(claims.Tenant) {
+		return nil, nil
+	}
+
+	principal := &domain.Principal{Subject: claims.Subject, Tenant: claims.Tenant}
+	for _, role := range claims.Roles {
+		principal.Roles = append(principal.Roles, domain.Role(role))
+	}
+	return principal, nil
+}
+
+func splitToken(token string) (header, payload, signature string, ok bool) {
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", "", false
+	}
+	payload, signature, ok = strings.Cut(rest, ".")
+	if !ok || strings.Contains(signature, ".") {
+		return "", "", "", false
+	}
+	return header, payload, signature, true
+}
+
+func decodeSegment(segment string, v any) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func signToken(t *testing.T, secret, alg string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWT_Authenticate(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	authorizer := NewJWT([]byte("secret"), WithIssuer("idp"))
+	authorizer.now = func() time.Time { return now }
+
+	valid := map[string]any{"sub": "alice", "iss": "idp", "roles": []string{"viewer"}, "exp": now.Add(time.Minute).Unix()}
+	principal, err := authorizer.Authenticate(context.Background(), domain.Credentials{BearerToken: signToken(t, "secret", "HS256", valid)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal == nil || principal.Subject != "alice" || !principal.HasRole(domain.RoleViewer) || principal.HasRole(domain.RoleAdmin) {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+
+	with := func(key string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+	tenanted, _ := authorizer.Authenticate(context.Background(), domain.Credentials{BearerToken: signToken(t, "secret", "HS256", with("tenant", "acme"))})
+	if tenanted == nil || tenanted.Tenant != "acme" {
+		t.Errorf("unexpected tenant principal: %+v", tenanted)
+	}
+
+	rejected := map[string]string{
+		"wrong secret":   signToken(t, "other", "HS256", valid),
+		"alg none":       signToken(t, "secret", "none", valid),
+		"expired":        signToken(t, "secret", "HS256", with("exp", now.Add(-time.Minute).Unix())),
+		"no expiry":      signToken(t, "secret", "HS256", with("exp", 0)),
+		"not yet valid":  signToken(t, "secret", "HS256", with("nbf", now.Add(time.Minute).Unix())),
+		"wrong issuer":   signToken(t, "secret", "HS256", with("iss", "elsewhere")),
+		"invalid tenant": signToken(t, "secret", "HS256", with("tenant", "acme:eu")),
+		"malformed":      "not-a-token",
+	}
+	for name, token := range rejected {
+		t.Run(name, func(t *testing.T) {
+			principal, err := authorizer.Authenticate(context.Background(), domain.Credentials{BearerToken: token})
+			if err != nil || principal != nil {
+				t.Errorf("expected rejection, got %+v %v", principal, err)
+			}
+		})
+	}
+}
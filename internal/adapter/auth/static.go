@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// StaticKeys authenticates callers by fixed API keys.
+type StaticKeys struct {
+	keys map[string]domain.Principal
+}
+
+// NewStaticKeys returns an Authorizer accepting the given keys, each mapped
+// to the principal it authenticates as.
+func NewStaticKeys(keys map[string]domain.Principal) *StaticKeys {
+	return &StaticKeys{keys: keys}
+}
+
+func (s *StaticKeys) Authenticate(ctx context.Context, creds domain.Credentials) (*domain.Principal, error) {
+	if creds.APIKey == "" {
+		return nil, nil
+	}
+
+	// Compare against every key so the time taken does not reveal a prefix match
+	var match *domain.Principal
+	for key, principal := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(creds.APIKey), []byte(key)) == 1 {
+			match = &principal
+		}
+	}
+	return match, nil
+}
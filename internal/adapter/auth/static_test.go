@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestChain_StaticKeysThenJWT(t *testing.T) {
+	chain := Chain{
+		NewStaticKeys(map[string]domain.Principal{
+			"ops-key": {Subject: "ops", Roles: []domain.Role{domain.RoleAdmin}},
+		}),
+		NewJWT([]byte("secret")),
+	}
+	ctx := context.Background()
+
+	principal, err := chain.Authenticate(ctx, domain.Credentials{APIKey: "ops-key"})
+	if err != nil || principal == nil || principal.Subject != "ops" {
+		t.Errorf("expected ops, got %+v %v", principal, err)
+	}
+
+	principal, err = chain.Authenticate(ctx, domain.Credentials{APIKey: "ops-key-2"})
+	if err != nil || principal != nil {
+		t.Errorf("expected unknown key to be rejected, got %+v %v", principal, err)
+	}
+
+	if principal, _ := (Chain{}).Authenticate(ctx, domain.Credentials{APIKey: "ops-key"}); principal != nil {
+		t.Error("an empty chain must reject everyone")
+	}
+}
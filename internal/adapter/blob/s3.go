@@ -0,0 +1,177 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxErrorBytes bounds how much of an error response is read into the
+// error.
+const maxErrorBytes = 1 << 10
+
+// S3 keeps objects in a bucket of S3 or a service with its API, such as
+// MinIO or R2. Requests are signed with AWS Signature Version 4 and address
+// the bucket in the path, which every such service accepts.
+type S3 struct {
+	client    *http.Client
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	now       func() time.Time
+}
+
+func NewS3(endpoint, region, bucket, accessKey, secretKey string, timeout time.Duration) *S3 {
+	return &S3{
+		client:    &http.Client{Timeout: timeout},
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		now:       time.Now,
+	}
+}
+
+func (s *S3) PutBlob(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError("put", key, resp)
+	}
+	return nil
+}
+
+func (s *S3) GetBlob(ctx context.Context, key string) ([]byte, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, nil)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError("get", key, resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *S3) newRequest(ctx context.Context, method, key string, data []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+escapePath("/"+s.bucket+"/"+key), bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("build %s request: %w", strings.ToLower(method), err)
+	}
+	if data == nil {
+		req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+	}
+	return req, nil
+}
+
+func statusError(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+	return fmt.Errorf("%s %s: status %d: %s", op, key, resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// sign adds the Signature Version 4 headers to req, covering the host and
+// every header already set.
+func (s *S3) sign(req *http.Request, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := hashHex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath percent-encodes every byte of path but the unreserved
+// characters and slashes, as Signature Version 4 expects of S3 keys.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
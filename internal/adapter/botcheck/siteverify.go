@@ -0,0 +1,69 @@
+package botcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxResponseBytes bounds how much of a verify response is read.
+const maxResponseBytes = 64 << 10
+
+// SiteVerify checks tokens against a siteverify endpoint, the API shared by
+// Cloudflare Turnstile, reCAPTCHA and hCaptcha: the secret, token and client
+// IP are posted as a form and the JSON answer says whether the token is
+// valid.
+type SiteVerify struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+func NewSiteVerify(verifyURL, secret string, timeout time.Duration) *SiteVerify {
+	return &SiteVerify{client: &http.Client{Timeout: timeout}, url: verifyURL, secret: secret}
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *SiteVerify) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("build verify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("verify token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("verify token: status %d", resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&result); err != nil {
+		return false, fmt.Errorf("decode verify response: %w", err)
+	}
+	// A bad secret is the server's fault, not the client's
+	for _, code := range result.ErrorCodes {
+		if strings.HasSuffix(code, "-secret") {
+			return false, fmt.Errorf("verify token: %s", code)
+		}
+	}
+	return result.Success, nil
+}
@@ -0,0 +1,57 @@
+package botcheck
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSiteVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if r.PostForm.Get("remoteip") != "203.0.113.7" {
+			t.Errorf("expected the client IP to be passed on, got %q", r.PostForm.Get("remoteip"))
+		}
+
+		resp := siteVerifyResponse{Success: r.PostForm.Get("response") == "good"}
+		switch {
+		case r.PostForm.Get("secret") != "s3cret":
+			resp.ErrorCodes = []string{"invalid-input-secret"}
+		case !resp.Success:
+			resp.ErrorCodes = []string{"invalid-input-response"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	verify := NewSiteVerify(server.URL, "s3cret", time.Second)
+
+	if ok, err := verify.Verify(ctx, "good", "203.0.113.7"); err != nil || !ok {
+		t.Errorf("expected a valid token to pass, got %v, %v", ok, err)
+	}
+	if ok, err := verify.Verify(ctx, "forged", "203.0.113.7"); err != nil || ok {
+		t.Errorf("expected a forged token to fail, got %v, %v", ok, err)
+	}
+
+	wrongSecret := NewSiteVerify(server.URL, "wrong", time.Second)
+	if _, err := wrongSecret.Verify(ctx, "good", "203.0.113.7"); err == nil {
+		t.Error("expected an error for a rejected secret")
+	}
+}
+
+func TestSiteVerify_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if _, err := NewSiteVerify(server.URL, "s3cret", time.Second).Verify(context.Background(), "good", ""); err == nil {
+		t.Error("expected an error for a failed verify call")
+	}
+}
@@ -0,0 +1,568 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Request is a GraphQL request as clients post it.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is the result of a request. Data is left out when the request
+// failed before running, and is null when a field that may not be null
+// could not be resolved.
+type Response struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []*Error        `json:"errors,omitempty"`
+}
+
+// Error is an error in a request, or in resolving one of its fields. A
+// resolver may return one to set Extensions; its Path and Locations are
+// filled in by the executor.
+type Error struct {
+	Message    string         `json:"message"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+const typenameField = "__typename"
+
+// Execute runs the query in req against schema. Fields are resolved one at
+// a time, in the order of the query.
+func Execute(ctx context.Context, schema *Schema, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+
+	v := &validator{schema: schema, doc: doc, variables: make(map[string]bool)}
+	for _, def := range op.variables {
+		v.variables[def.name] = true
+	}
+	v.selections(schema.query, op.selections, 1, nil)
+	if len(v.errors) > 0 {
+		return &Response{Errors: v.errors}
+	}
+
+	variables, errs := schema.coerceVariables(op.variables, req.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{doc: doc, variables: variables}
+	data, _ := e.object(ctx, schema.query, op.selections, nil, nil)
+	resp := &Response{Errors: e.errors}
+	if data == nil {
+		resp.Data = json.RawMessage("null")
+		return resp
+	}
+	if resp.Data, err = json.Marshal(data); err != nil {
+		return &Response{Errors: []*Error{{Message: fmt.Sprintf("encode response: %v", err)}}}
+	}
+	return resp
+}
+
+func selectOperation(doc *document, name string) (*operation, error) {
+	var op *operation
+	switch {
+	case name != "":
+		for _, candidate := range doc.operations {
+			if candidate.name == name {
+				op = candidate
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+	case len(doc.operations) == 1:
+		op = doc.operations[0]
+	default:
+		return nil, errors.New("operationName is required for a document with several operations")
+	}
+	if op.kind != "query" {
+		return nil, &Error{Message: fmt.Sprintf("%s operations are not supported", op.kind), Locations: []Location{op.loc}}
+	}
+	return op, nil
+}
+
+func asError(err error) *Error {
+	var gqlErr *Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+	return &Error{Message: err.Error()}
+}
+
+// validator checks a query against the schema before it runs, collecting
+// every error.
+type validator struct {
+	schema    *Schema
+	doc       *document
+	variables map[string]bool
+	errors    []*Error
+}
+
+func (v *validator) errorf(loc Location, format string, args ...any) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+// selections checks selections made on obj at depth, through the fragments
+// in spreads, which catches fragments that spread themselves.
+func (v *validator) selections(obj *Object, selections []selection, depth int, spreads []string) {
+	if depth > v.schema.maxDepth {
+		v.errorf(selections[0].location(), "query is nested deeper than %d fields", v.schema.maxDepth)
+		return
+	}
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			v.field(obj, sel, depth, spreads)
+		case *inlineFragment:
+			if sel.typeCondition != "" && sel.typeCondition != obj.Name {
+				v.errorf(sel.loc, "fragment on %s cannot be spread on %s", sel.typeCondition, obj.Name)
+				continue
+			}
+			v.selections(obj, sel.selections, depth, spreads)
+		case *fragmentSpread:
+			frag, ok := v.doc.fragments[sel.name]
+			switch {
+			case !ok:
+				v.errorf(sel.loc, "unknown fragment %q", sel.name)
+			case slices.Contains(spreads, sel.name):
+				v.errorf(sel.loc, "fragment %q spreads itself", sel.name)
+			case frag.typeCondition != obj.Name:
+				v.errorf(sel.loc, "fragment %q on %s cannot be spread on %s", sel.name, frag.typeCondition, obj.Name)
+			default:
+				v.selections(obj, frag.selections, depth, append(spreads, sel.name))
+			}
+		}
+	}
+}
+
+func (v *validator) field(obj *Object, f *field, depth int, spreads []string) {
+	if f.name == typenameField {
+		if f.selections != nil {
+			v.errorf(f.loc, "field %s cannot have a selection", f.name)
+		}
+		return
+	}
+	def, ok := obj.Fields[f.name]
+	if !ok {
+		v.errorf(f.loc, "cannot query field %q on type %s", f.name, obj.Name)
+		return
+	}
+
+	for _, arg := range f.args {
+		if _, ok := def.Args[arg.name]; !ok {
+			v.errorf(arg.loc, "unknown argument %q on field %s.%s", arg.name, obj.Name, f.name)
+		}
+		v.value(arg.value)
+	}
+	for name, arg := range def.Args {
+		if _, required := arg.Type.(*NonNull); !required || arg.Default != nil {
+			continue
+		}
+		given := false
+		for _, a := range f.args {
+			given = given || a.name == name && a.value.kind != valueNull
+		}
+		if !given {
+			v.errorf(f.loc, "field %s.%s requires argument %q", obj.Name, f.name, name)
+		}
+	}
+
+	child, composite := namedType(def.Type).(*Object)
+	switch {
+	case composite && f.selections == nil:
+		v.errorf(f.loc, "field %s.%s of type %s needs a selection of its fields", obj.Name, f.name, def.Type)
+	case !composite && f.selections != nil:
+		v.errorf(f.loc, "field %s.%s of type %s has no fields to select", obj.Name, f.name, def.Type)
+	case composite:
+		v.selections(child, f.selections, depth+1, spreads)
+	}
+}
+
+func (v *validator) value(val value) {
+	switch val.kind {
+	case valueVariable:
+		if !v.variables[val.raw] {
+			v.errorf(val.loc, "variable $%s is not defined", val.raw)
+		}
+	case valueList:
+		for _, item := range val.list {
+			v.value(item)
+		}
+	case valueObject:
+		for _, f := range val.fields {
+			v.value(f.value)
+		}
+	}
+}
+
+// coerceVariables checks the variables given against their definitions and
+// fills in defaults.
+func (s *Schema) coerceVariables(defs []*variableDefinition, given map[string]any) (map[string]any, []*Error) {
+	variables := make(map[string]any)
+	var errs []*Error
+	fail := func(def *variableDefinition, format string, args ...any) {
+		errs = append(errs, &Error{Message: fmt.Sprintf("variable $%s: "+format, append([]any{def.name}, args...)...), Locations: []Location{def.loc}})
+	}
+
+	for _, def := range defs {
+		t, err := s.inputType(def.typ)
+		if err != nil {
+			fail(def, "%v", err)
+			continue
+		}
+		raw, ok := given[def.name]
+		if !ok && def.defaultVal.kind != valueNone {
+			raw, ok = literal(def.defaultVal, nil), true
+		}
+		if !ok {
+			if _, required := t.(*NonNull); required {
+				fail(def, "of required type %s was not provided", t)
+			}
+			continue
+		}
+		if variables[def.name], err = coerceInput(t, raw); err != nil {
+			fail(def, "%v", err)
+		}
+	}
+	return variables, errs
+}
+
+// inputType looks up the type a variable is declared with.
+func (s *Schema) inputType(ref typeRef) (Type, error) {
+	var t Type
+	if ref.list != nil {
+		of, err := s.inputType(*ref.list)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: of}
+	} else {
+		var ok bool
+		if t, ok = s.inputs[ref.name]; !ok {
+			return nil, fmt.Errorf("unknown type %s", ref.name)
+		}
+	}
+	if ref.nonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, nil
+}
+
+// literal turns a value in the query into the form variables are given in,
+// substituting variables. A variable that was not given is nil.
+func literal(val value, variables map[string]any) any {
+	switch val.kind {
+	case valueVariable:
+		return variables[val.raw]
+	case valueInt, valueFloat:
+		return json.Number(val.raw)
+	case valueString:
+		return val.raw
+	case valueBoolean:
+		return val.raw == "true"
+	case valueEnum:
+		return enumLiteral(val.raw)
+	case valueList:
+		list := make([]any, len(val.list))
+		for i, item := range val.list {
+			list[i] = literal(item, variables)
+		}
+		return list
+	case valueObject:
+		obj := make(map[string]any, len(val.fields))
+		for _, f := range val.fields {
+			obj[f.name] = literal(f.value, variables)
+		}
+		return obj
+	}
+	return nil
+}
+
+// coerceInput checks v against t and converts it to the value resolvers
+// are given.
+func coerceInput(t Type, v any) (any, error) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("expected a non-null %s", nonNull.Of)
+		}
+		return coerceInput(nonNull.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		return t.ParseValue(v)
+	case *Enum:
+		return t.parseValue(v)
+	case *List:
+		items, ok := v.([]any)
+		if !ok {
+			// A single value is a list of one
+			items = []any{v}
+		}
+		coerced := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = coerceInput(t.Of, item); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return coerced, nil
+	}
+	return nil, fmt.Errorf("%s is not an input type", t)
+}
+
+// executor resolves the fields of a validated query.
+type executor struct {
+	doc       *document
+	variables map[string]any
+	errors    []*Error
+}
+
+func (e *executor) fail(err error, f *field, path []any) {
+	gqlErr := &Error{Message: err.Error()}
+	var resolverErr *Error
+	if errors.As(err, &resolverErr) {
+		gqlErr.Message, gqlErr.Extensions = resolverErr.Message, resolverErr.Extensions
+	}
+	gqlErr.Locations = []Location{f.loc}
+	gqlErr.Path = append([]any(nil), path...)
+	e.errors = append(e.errors, gqlErr)
+}
+
+// object resolves the selected fields of obj on source. It returns nil if a
+// field that may not be null was, which makes obj null in turn.
+func (e *executor) object(ctx context.Context, obj *Object, selections []selection, source any, path []any) (*orderedMap, bool) {
+	result := &orderedMap{}
+	for _, group := range e.collect(obj, selections, &orderedFields{}).groups {
+		f := group[0]
+		fieldPath := append(path, f.responseKey())
+		if f.name == typenameField {
+			result.set(f.responseKey(), obj.Name)
+			continue
+		}
+
+		def := obj.Fields[f.name]
+		value, ok := e.field(ctx, def, group, source, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		result.set(f.responseKey(), value)
+	}
+	return result, true
+}
+
+// collect groups the fields selected on obj by response key, in the order
+// they are first selected, following fragments.
+func (e *executor) collect(obj *Object, selections []selection, fields *orderedFields) *orderedFields {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			fields.add(sel)
+		case *inlineFragment:
+			e.collect(obj, sel.selections, fields)
+		case *fragmentSpread:
+			e.collect(obj, e.doc.fragments[sel.name].selections, fields)
+		}
+	}
+	return fields
+}
+
+// field resolves the field selected by group on source. It reports false
+// if the field may not be null but is.
+func (e *executor) field(ctx context.Context, def *Field, group []*field, source any, path []any) (any, bool) {
+	f := group[0]
+	args, err := e.arguments(def, f)
+	var value any
+	if err == nil {
+		value, err = resolve(ctx, def, f.name, source, args)
+	}
+	if err != nil {
+		e.fail(err, f, path)
+		_, required := def.Type.(*NonNull)
+		return nil, !required
+	}
+
+	var selections []selection
+	for _, same := range group {
+		selections = append(selections, same.selections...)
+	}
+	return e.complete(ctx, def.Type, f, selections, value, path)
+}
+
+func resolve(ctx context.Context, def *Field, name string, source any, args map[string]any) (any, error) {
+	if def.Resolve != nil {
+		return def.Resolve(ctx, source, args)
+	}
+	if m, ok := source.(map[string]any); ok {
+		return m[name], nil
+	}
+	return nil, nil
+}
+
+func (e *executor) arguments(def *Field, f *field) (map[string]any, error) {
+	args := make(map[string]any, len(def.Args))
+	for name, arg := range def.Args {
+		var raw any
+		given := false
+		for _, a := range f.args {
+			if a.name != name {
+				continue
+			}
+			if a.value.kind == valueVariable {
+				raw, given = e.variables[a.value.raw]
+			} else {
+				raw, given = literal(a.value, e.variables), true
+			}
+		}
+		if !given {
+			if arg.Default != nil {
+				args[name] = arg.Default
+				continue
+			}
+			raw = nil
+		}
+		value, err := coerceInput(arg.Type, raw)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %w", name, err)
+		}
+		args[name] = value
+	}
+	return args, nil
+}
+
+// complete turns a resolved value into its place in the response. It
+// reports false if the value may not be null but is.
+func (e *executor) complete(ctx context.Context, t Type, f *field, selections []selection, value any, path []any) (any, bool) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if isNull(value) {
+			e.fail(fmt.Errorf("cannot return null for non-nullable field %s", f.name), f, path)
+			return nil, false
+		}
+		completed, ok := e.complete(ctx, nonNull.Of, f, selections, value, path)
+		return completed, ok && completed != nil
+	}
+	if isNull(value) {
+		return nil, true
+	}
+
+	var err error
+	switch t := t.(type) {
+	case *Scalar:
+		if value, err = t.Serialize(value); err == nil {
+			return value, true
+		}
+	case *Enum:
+		if value, err = t.serialize(value); err == nil {
+			return value, true
+		}
+	case *Object:
+		result, ok := e.object(ctx, t, selections, value, path)
+		if !ok {
+			// The object is null, as is its place in its parent
+			return nil, true
+		}
+		return result, true
+	case *List:
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice {
+			err = fmt.Errorf("expected a list, got %T", value)
+			break
+		}
+		list := make([]any, items.Len())
+		for i := range list {
+			item, ok := e.complete(ctx, t.Of, f, selections, items.Index(i).Interface(), append(path, i))
+			if !ok {
+				return nil, true
+			}
+			list[i] = item
+		}
+		return list, true
+	}
+	e.fail(err, f, path)
+	return nil, true
+}
+
+func isNull(value any) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// orderedFields groups fields by response key in the order the keys first
+// appear.
+type orderedFields struct {
+	keys   map[string]int
+	groups [][]*field
+}
+
+func (o *orderedFields) add(f *field) {
+	if o.keys == nil {
+		o.keys = make(map[string]int)
+	}
+	if i, ok := o.keys[f.responseKey()]; ok {
+		o.groups[i] = append(o.groups[i], f)
+		return
+	}
+	o.keys[f.responseKey()] = len(o.groups)
+	o.groups = append(o.groups, []*field{f})
+}
+
+// orderedMap is a JSON object that keeps its keys in the order they were
+// set, which is the order the query selected them.
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m *orderedMap) set(key string, value any) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, _ := json.Marshal(key)
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		encoded, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
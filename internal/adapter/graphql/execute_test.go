@@ -0,0 +1,160 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testSchema() *Schema {
+	color := &Enum{Name: "Color", Values: []string{"RED", "BLUE"}}
+	widget := &Object{Name: "Widget", Fields: map[string]*Field{
+		"name":  {Type: &NonNull{Of: String}},
+		"color": {Type: color},
+		"size":  {Type: Int},
+		"broken": {Type: &NonNull{Of: String}, Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return nil, &Error{Message: "broken", Extensions: map[string]any{"code": "broken"}}
+		}},
+	}}
+	widget.Fields["parts"] = &Field{Type: &List{Of: &NonNull{Of: widget}}}
+
+	widgets := []map[string]any{
+		{"name": "a", "color": "RED", "size": 1, "parts": []map[string]any{{"name": "a1"}}},
+		{"name": "b", "color": "BLUE", "size": 2},
+	}
+	return NewSchema(&Object{Name: "Query", Fields: map[string]*Field{
+		"widgets": {
+			Type: &NonNull{Of: &List{Of: &NonNull{Of: widget}}},
+			Args: map[string]*Argument{"color": {Type: color}, "first": {Type: Int, Default: 10}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				var matched []map[string]any
+				for _, w := range widgets {
+					if color, ok := args["color"].(string); !ok || w["color"] == color {
+						matched = append(matched, w)
+					}
+				}
+				return matched[:min(len(matched), args["first"].(int))], nil
+			},
+		},
+		"widget": {
+			Type: widget,
+			Args: map[string]*Argument{"name": {Type: &NonNull{Of: String}}},
+			Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+				for _, w := range widgets {
+					if w["name"] == args["name"] {
+						return w, nil
+					}
+				}
+				return nil, errors.New("no such widget")
+			},
+		},
+	}}, 3)
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]any
+		data      string
+		errors    []string
+	}{
+		{
+			name:  "aliases and fragments",
+			query: `{ first: widgets(first: 1) { ...W parts { name } } all: widgets { ... on Widget { name } } } fragment W on Widget { name color __typename }`,
+			data:  `{"first":[{"name":"a","color":"RED","__typename":"Widget","parts":[{"name":"a1"}]}],"all":[{"name":"a"},{"name":"b"}]}`,
+		},
+		{
+			name:      "variables and defaults",
+			query:     `query Q($color: Color = RED, $name: String!) { widgets(color: $color) { name } widget(name: $name) { size } }`,
+			variables: map[string]any{"name": "b"},
+			data:      `{"widgets":[{"name":"a"}],"widget":{"size":2}}`,
+		},
+		{
+			name:   "nullable field errors",
+			query:  `{ widget(name: "z") { name } widgets { name } }`,
+			data:   `{"widget":null,"widgets":[{"name":"a"},{"name":"b"}]}`,
+			errors: []string{"no such widget"},
+		},
+		{
+			name:   "non-null errors null the nearest nullable parent",
+			query:  `{ widget(name: "a") { name broken } }`,
+			data:   `{"widget":null}`,
+			errors: []string{"broken"},
+		},
+		{
+			name:   "non-null errors reach the root",
+			query:  `{ widgets { broken } }`,
+			data:   `null`,
+			errors: []string{"broken"},
+		},
+		{
+			name:   "validation",
+			query:  `{ widget { nope } widgets(color: GREEN, size: 1) { name { x } } }`,
+			errors: []string{`field Query.widget requires argument "name"`, `cannot query field "nope" on type Widget`, `unknown argument "size" on field Query.widgets`, `field Widget.name of type String! has no fields to select`},
+		},
+		{
+			name:   "bad enum",
+			query:  `{ widgets(color: GREEN) { name } }`,
+			data:   `null`,
+			errors: []string{`argument "color": "GREEN" is not a Color value`},
+		},
+		{
+			name:   "depth",
+			query:  `{ widgets { parts { parts { name } } } }`,
+			errors: []string{"query is nested deeper than 3 fields"},
+		},
+		{
+			name:   "fragment cycle",
+			query:  `{ widgets { ...A } } fragment A on Widget { parts { ...A } }`,
+			errors: []string{`fragment "A" spreads itself`},
+		},
+		{
+			name:      "variables checked",
+			query:     `query($name: String!, $size: Int) { widget(name: $name) { name } }`,
+			variables: map[string]any{"size": json.Number("1.5")},
+			errors:    []string{"variable $name: of required type String! was not provided", "variable $size: expected an integer, got 1.5"},
+		},
+		{
+			name:   "mutations",
+			query:  `mutation { widgets { name } }`,
+			errors: []string{"mutation operations are not supported"},
+		},
+		{
+			name:   "syntax",
+			query:  "{\n  widgets { name ",
+			errors: []string{"syntax error: unexpected end of query"},
+		},
+	}
+
+	schema := testSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := Execute(context.Background(), schema, Request{Query: tt.query, Variables: tt.variables})
+			if string(resp.Data) != tt.data {
+				t.Errorf("expected data %s, got %s", tt.data, resp.Data)
+			}
+			var messages []string
+			for _, err := range resp.Errors {
+				messages = append(messages, err.Message)
+			}
+			if strings.Join(messages, "\n") != strings.Join(tt.errors, "\n") {
+				t.Errorf("expected errors %q, got %q", tt.errors, messages)
+			}
+		})
+	}
+}
+
+func TestExecute_ErrorPaths(t *testing.T) {
+	resp := Execute(context.Background(), testSchema(), Request{Query: "{\n  w: widget(name: \"a\") { broken }\n}"})
+	if len(resp.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %+v", resp.Errors)
+	}
+	err := resp.Errors[0]
+	encoded, _ := json.Marshal(err)
+	if string(encoded) != `{"message":"broken","locations":[{"line":2,"column":26}],"path":["w","broken"],"extensions":{"code":"broken"}}` {
+		t.Errorf("unexpected error %s", encoded)
+	}
+}
@@ -0,0 +1,690 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parser reads executable documents: operations and fragments. Type
+// system definitions, directives and subscriptions are not supported.
+
+// Location is a position in the query, 1-based.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // query or mutation
+	name       string
+	variables  []*variableDefinition
+	selections []selection
+	loc        Location
+}
+
+type variableDefinition struct {
+	name       string
+	typ        typeRef
+	defaultVal value
+	loc        Location
+}
+
+// typeRef is a type as written in a variable definition.
+type typeRef struct {
+	name    string
+	list    *typeRef
+	nonNull bool
+}
+
+func (t typeRef) String() string {
+	s := t.name
+	if t.list != nil {
+		s = "[" + t.list.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []selection
+	loc           Location
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment.
+type selection interface{ location() Location }
+
+type field struct {
+	alias      string
+	name       string
+	args       []*argument
+	selections []selection
+	loc        Location
+}
+
+type argument struct {
+	name  string
+	value value
+	loc   Location
+}
+
+type fragmentSpread struct {
+	name string
+	loc  Location
+}
+
+type inlineFragment struct {
+	typeCondition string
+	selections    []selection
+	loc           Location
+}
+
+func (f *field) location() Location          { return f.loc }
+func (f *fragmentSpread) location() Location { return f.loc }
+func (f *inlineFragment) location() Location { return f.loc }
+
+// responseKey is the name the field is given in the response.
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// value is a literal or variable in the query.
+type value struct {
+	kind   valueKind
+	raw    string // variable name, scalar or enum text
+	list   []value
+	fields []objectField
+	loc    Location
+}
+
+type objectField struct {
+	name  string
+	value value
+}
+
+type valueKind int
+
+const (
+	valueNone valueKind = iota
+	valueVariable
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	loc   Location
+}
+
+// lexer splits a query into tokens, skipping whitespace, commas and
+// comments.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	col  int
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	loc := Location{Line: l.line, Column: l.col}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, loc: loc}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		l.advance(1)
+		return token{kind: tokenPunct, value: string(c), loc: loc}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			return token{}, syntaxError(loc, "unexpected %q", ".")
+		}
+		l.advance(3)
+		return token{kind: tokenPunct, value: "...", loc: loc}, nil
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance(1)
+		}
+		return token{kind: tokenName, value: l.src[start:l.pos], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			return l.blockString(loc)
+		}
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return token{}, syntaxError(loc, "unexpected character %q", r)
+}
+
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case ' ', '\t', ',', '\r', '\n':
+			l.advance(1)
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		default:
+			if strings.HasPrefix(l.src[l.pos:], "\ufeff") {
+				l.advance(len("\ufeff"))
+				continue
+			}
+			return
+		}
+	}
+}
+
+// advance moves n bytes forward, keeping track of lines.
+func (l *lexer) advance(n int) {
+	for i := 0; i < n && l.pos < len(l.src); i++ {
+		if l.src[l.pos] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+		l.pos++
+	}
+}
+
+func (l *lexer) number(loc Location) (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.src[l.pos] == '-' {
+		l.advance(1)
+	}
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.advance(1)
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return token{}, syntaxError(loc, "invalid number")
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.advance(1)
+		if digits() == 0 {
+			return token{}, syntaxError(loc, "invalid number")
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.advance(1)
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.advance(1)
+		}
+		if digits() == 0 {
+			return token{}, syntaxError(loc, "invalid number")
+		}
+	}
+	return token{kind: kind, value: l.src[start:l.pos], loc: loc}, nil
+}
+
+func (l *lexer) string(loc Location) (token, error) {
+	l.advance(1)
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.advance(1)
+			return token{kind: tokenString, value: b.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return token{}, syntaxError(loc, "unterminated string")
+		case c == '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, syntaxError(loc, "unterminated string")
+			}
+			escape := l.src[l.pos+1]
+			if escape == 'u' {
+				if l.pos+6 > len(l.src) {
+					return token{}, syntaxError(loc, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 32)
+				if err != nil {
+					return token{}, syntaxError(loc, "invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				l.advance(6)
+				continue
+			}
+			unescaped, ok := map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}[escape]
+			if !ok {
+				return token{}, syntaxError(loc, "invalid escape \\%c", escape)
+			}
+			b.WriteByte(unescaped)
+			l.advance(2)
+		default:
+			b.WriteByte(c)
+			l.advance(1)
+		}
+	}
+	return token{}, syntaxError(loc, "unterminated string")
+}
+
+// blockString reads a """ string. Its indentation is kept as written.
+func (l *lexer) blockString(loc Location) (token, error) {
+	l.advance(3)
+	end := strings.Index(l.src[l.pos:], `"""`)
+	if end < 0 {
+		return token{}, syntaxError(loc, "unterminated string")
+	}
+	s := l.src[l.pos : l.pos+end]
+	l.advance(end + 3)
+	return token{kind: tokenString, value: strings.ReplaceAll(s, `\"""`, `"""`), loc: loc}, nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+// parser builds a document from the lexer's tokens, one token ahead.
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func parse(query string) (*document, error) {
+	p := &parser{lex: &lexer{src: query, line: 1, col: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek("{"), p.peekName("query"), p.peekName("mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peekName("fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[frag.name]; ok {
+				return nil, syntaxError(frag.loc, "fragment %q is defined twice", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, syntaxError(p.tok.loc, "no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == punct
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.tok.kind == tokenName && p.tok.value == name
+}
+
+// skip consumes punct if it is next and reports whether it was.
+func (p *parser) skip(punct string) (bool, error) {
+	if !p.peek(punct) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return syntaxError(p.tok.loc, "unexpected end of query")
+	}
+	return syntaxError(p.tok.loc, "unexpected %q", p.tok.value)
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: "query", loc: p.tok.loc}
+	if p.tok.kind == tokenName {
+		op.kind = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokenName {
+			op.name = p.tok.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+		if ok, err := p.skip("("); err != nil {
+			return nil, err
+		} else if ok {
+			for !p.peek(")") {
+				def, err := p.variableDefinition()
+				if err != nil {
+					return nil, err
+				}
+				op.variables = append(op.variables, def)
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*variableDefinition, error) {
+	def := &variableDefinition{loc: p.tok.loc}
+	if err := p.expect("$"); err != nil {
+		return nil, err
+	}
+	var err error
+	if def.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if def.typ, err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		if def.defaultVal, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	return def, nil
+}
+
+func (p *parser) typeRef() (typeRef, error) {
+	var t typeRef
+	if ok, err := p.skip("["); err != nil {
+		return t, err
+	} else if ok {
+		of, err := p.typeRef()
+		if err != nil {
+			return t, err
+		}
+		t.list = &of
+		if err := p.expect("]"); err != nil {
+			return t, err
+		}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return t, err
+		}
+		t.name = name
+	}
+	nonNull, err := p.skip("!")
+	t.nonNull = nonNull
+	return t, err
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	frag := &fragment{loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if frag.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.name == "on" {
+		return nil, syntaxError(frag.loc, "a fragment cannot be named on")
+	}
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if frag.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []selection
+	for !p.peek("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, syntaxError(p.tok.loc, "empty selection set")
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (selection, error) {
+	loc := p.tok.loc
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		if p.peekName("on") || p.peek("{") {
+			inline := &inlineFragment{loc: loc}
+			if p.peekName("on") {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if inline.typeCondition, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+			if inline.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			return inline, nil
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &fragmentSpread{name: name, loc: loc}, nil
+	}
+
+	f := &field{loc: loc}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	f.name = name
+
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(")") {
+			arg := &argument{loc: p.tok.loc}
+			if arg.name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if arg.value, err = p.value(false); err != nil {
+				return nil, err
+			}
+			f.args = append(f.args, arg)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("@") {
+		return nil, syntaxError(p.tok.loc, "directives are not supported")
+	}
+	if p.peek("{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// value reads a value; constant values, such as variable defaults, cannot
+// refer to variables.
+func (p *parser) value(constant bool) (value, error) {
+	v := value{loc: p.tok.loc, raw: p.tok.value}
+	switch p.tok.kind {
+	case tokenInt:
+		v.kind = valueInt
+	case tokenFloat:
+		v.kind = valueFloat
+	case tokenString:
+		v.kind = valueString
+	case tokenName:
+		switch p.tok.value {
+		case "true", "false":
+			v.kind = valueBoolean
+		case "null":
+			v.kind = valueNull
+		default:
+			v.kind = valueEnum
+		}
+	case tokenPunct:
+		switch p.tok.value {
+		case "$":
+			if constant {
+				return v, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return v, err
+			}
+			v.kind = valueVariable
+			name, err := p.name()
+			v.raw = name
+			return v, err
+		case "[":
+			v.kind = valueList
+			if err := p.advance(); err != nil {
+				return v, err
+			}
+			for !p.peek("]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return v, err
+				}
+				v.list = append(v.list, item)
+			}
+			return v, p.advance()
+		case "{":
+			v.kind = valueObject
+			if err := p.advance(); err != nil {
+				return v, err
+			}
+			for !p.peek("}") {
+				name, err := p.name()
+				if err != nil {
+					return v, err
+				}
+				if err := p.expect(":"); err != nil {
+					return v, err
+				}
+				fieldValue, err := p.value(constant)
+				if err != nil {
+					return v, err
+				}
+				v.fields = append(v.fields, objectField{name: name, value: fieldValue})
+			}
+			return v, p.advance()
+		default:
+			return v, p.unexpected()
+		}
+	default:
+		return v, p.unexpected()
+	}
+	return v, p.advance()
+}
+
+func syntaxError(loc Location, format string, args ...any) *Error {
+	return &Error{Message: "syntax error: " + fmt.Sprintf(format, args...), Locations: []Location{loc}}
+}
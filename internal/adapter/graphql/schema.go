@@ -0,0 +1,276 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Type is a GraphQL type: *Scalar, *Enum, *Object, *List or *NonNull.
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type. Serialize turns what a resolver returned into its
+// JSON form; ParseValue turns an argument or variable into the value the
+// resolver is given. Numbers arrive as json.Number.
+type Scalar struct {
+	Name       string
+	Serialize  func(v any) (any, error)
+	ParseValue func(v any) (any, error)
+}
+
+// Enum is a leaf type whose values are names. Resolvers return and are given
+// the names as strings.
+type Enum struct {
+	Name   string
+	Values []string
+}
+
+// Object is a type with fields, each resolved on its own.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+type List struct{ Of Type }
+
+type NonNull struct{ Of Type }
+
+func (t *Scalar) String() string  { return t.Name }
+func (t *Enum) String() string    { return t.Name }
+func (t *Object) String() string  { return t.Name }
+func (t *List) String() string    { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string { return t.Of.String() + "!" }
+
+// ResolveFunc returns a field's value on source, the value its parent field
+// resolved to; the query's fields are resolved on a nil source. Lists may
+// be any slice.
+type ResolveFunc func(ctx context.Context, source any, args map[string]any) (any, error)
+
+// Field is a field of an object. A nil Resolve reads the field from a
+// map[string]any source by name.
+type Field struct {
+	Type    Type
+	Args    map[string]*Argument
+	Resolve ResolveFunc
+}
+
+// Argument is an argument of a field. Default is used when the query does
+// not give the argument, and is given to the resolver as is.
+type Argument struct {
+	Type    Type
+	Default any
+}
+
+// Schema is what queries can read, starting from the fields of Query.
+type Schema struct {
+	query    *Object
+	maxDepth int
+	// inputs are the types variables may be declared with, by name
+	inputs map[string]Type
+}
+
+// NewSchema serves queries against query, refusing those that nest fields
+// deeper than maxDepth.
+func NewSchema(query *Object, maxDepth int) *Schema {
+	s := &Schema{query: query, maxDepth: maxDepth, inputs: make(map[string]Type)}
+	for _, scalar := range []*Scalar{String, Int, Float, Boolean, ID} {
+		s.inputs[scalar.Name] = scalar
+	}
+	s.collectInputs(query, make(map[*Object]bool))
+	return s
+}
+
+func (s *Schema) collectInputs(obj *Object, seen map[*Object]bool) {
+	if seen[obj] {
+		return
+	}
+	seen[obj] = true
+	for _, f := range obj.Fields {
+		for _, arg := range f.Args {
+			switch t := namedType(arg.Type).(type) {
+			case *Scalar:
+				s.inputs[t.Name] = t
+			case *Enum:
+				s.inputs[t.Name] = t
+			}
+		}
+		if child, ok := namedType(f.Type).(*Object); ok {
+			s.collectInputs(child, seen)
+		}
+	}
+}
+
+// namedType strips the list and non-null wrappers off t.
+func namedType(t Type) Type {
+	for {
+		switch wrapper := t.(type) {
+		case *List:
+			t = wrapper.Of
+		case *NonNull:
+			t = wrapper.Of
+		default:
+			return t
+		}
+	}
+}
+
+// Built-in scalars
+var (
+	String = &Scalar{
+		Name:      "String",
+		Serialize: serializeString,
+		ParseValue: func(v any) (any, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("expected a string, got %s", describe(v))
+		},
+	}
+	ID = &Scalar{
+		Name:      "ID",
+		Serialize: serializeString,
+		ParseValue: func(v any) (any, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case json.Number:
+				if _, err := v.Int64(); err == nil {
+					return v.String(), nil
+				}
+			}
+			return nil, fmt.Errorf("expected an ID, got %s", describe(v))
+		},
+	}
+	Int = &Scalar{
+		Name: "Int",
+		Serialize: func(v any) (any, error) {
+			switch v := v.(type) {
+			case int, int32, int64:
+				return v, nil
+			}
+			return nil, fmt.Errorf("cannot serialize %T as Int", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			var n int64
+			switch v := v.(type) {
+			case int:
+				n = int64(v)
+			case json.Number:
+				var err error
+				if n, err = strconv.ParseInt(v.String(), 10, 64); err != nil {
+					return nil, fmt.Errorf("expected an integer, got %s", v)
+				}
+			case float64:
+				if v != math.Trunc(v) {
+					return nil, fmt.Errorf("expected an integer, got %v", v)
+				}
+				n = int64(v)
+			default:
+				return nil, fmt.Errorf("expected an integer, got %s", describe(v))
+			}
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("integer %d out of range", n)
+			}
+			return int(n), nil
+		},
+	}
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(v any) (any, error) {
+			switch v := v.(type) {
+			case float64:
+				return v, nil
+			case float32:
+				return float64(v), nil
+			}
+			return nil, fmt.Errorf("cannot serialize %T as Float", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			switch v := v.(type) {
+			case float64:
+				return v, nil
+			case int:
+				return float64(v), nil
+			case json.Number:
+				return v.Float64()
+			}
+			return nil, fmt.Errorf("expected a number, got %s", describe(v))
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("cannot serialize %T as Boolean", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("expected a boolean, got %s", describe(v))
+		},
+	}
+)
+
+func serializeString(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return nil, fmt.Errorf("cannot serialize %T as a string", v)
+}
+
+// enumLiteral is an enum value written in the query, as opposed to a string.
+type enumLiteral string
+
+func (t *Enum) parseValue(v any) (any, error) {
+	var name string
+	switch v := v.(type) {
+	case enumLiteral:
+		name = string(v)
+	case string:
+		name = v
+	default:
+		return nil, fmt.Errorf("expected a %s value, got %s", t.Name, describe(v))
+	}
+	if !slices.Contains(t.Values, name) {
+		return nil, fmt.Errorf("%q is not a %s value", name, t.Name)
+	}
+	return name, nil
+}
+
+func (t *Enum) serialize(v any) (any, error) {
+	name, ok := v.(string)
+	if !ok || !slices.Contains(t.Values, name) {
+		return nil, fmt.Errorf("cannot serialize %v as %s", v, t.Name)
+	}
+	return name, nil
+}
+
+// describe names a value's kind for error messages.
+func describe(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case enumLiteral:
+		return string(v)
+	case json.Number:
+		return v.String()
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprint(v)
+}
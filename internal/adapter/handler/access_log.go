@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AccessLogger logs one line per HTTP request or gRPC call. During a sale
+// spike most requests are alike, so successes and client errors are
+// sampled and the total rate is capped; server errors are always
+// considered. Lines dropped by the cap are counted on the next line logged.
+type AccessLogger struct {
+	logger     *slog.Logger
+	sampleRate float64
+	limiter    *rate.Limiter
+	dropped    atomic.Int64
+}
+
+// NewAccessLogger logs sampleRate (0 to 1) of successful and client error
+// requests, and at most maxPerSecond lines a second; 0 leaves it uncapped.
+func NewAccessLogger(logger *slog.Logger, sampleRate float64, maxPerSecond int) *AccessLogger {
+	l := &AccessLogger{logger: logger, sampleRate: sampleRate}
+	if maxPerSecond > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(maxPerSecond), maxPerSecond)
+	}
+	return l
+}
+
+// accessRecord collects what handlers know about a request for its access
+// log line.
+type accessRecord struct {
+	userID  string
+	outcome string
+}
+
+type accessRecordKey struct{}
+
+// recordAccess lets the handler fill in the request's access log fields.
+// It is a no-op for requests that are not being logged.
+func recordAccess(ctx context.Context, userID, outcome string) {
+	rec, ok := ctx.Value(accessRecordKey{}).(*accessRecord)
+	if !ok {
+		return
+	}
+	if userID != "" {
+		rec.userID = userID
+	}
+	if outcome != "" {
+		rec.outcome = outcome
+	}
+}
+
+// sampled reports whether a request is logged.
+func (l *AccessLogger) sampled(serverError bool) bool {
+	if !serverError && rand.Float64() >= l.sampleRate {
+		return false
+	}
+	if l.limiter != nil && !l.limiter.Allow() {
+		l.dropped.Add(1)
+		return false
+	}
+	return true
+}
+
+func (l *AccessLogger) log(ctx context.Context, msg string, serverError bool, rec *accessRecord, attrs []any) {
+	if !l.sampled(serverError) {
+		return
+	}
+	if rec.userID != "" {
+		attrs = append(attrs, "user_id", rec.userID)
+	}
+	if rec.outcome != "" {
+		attrs = append(attrs, "outcome", rec.outcome)
+	}
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		attrs = append(attrs, "dropped", dropped)
+	}
+
+	level := slog.LevelInfo
+	if serverError {
+		level = slog.LevelError
+	}
+	l.logger.Log(ctx, level, msg, attrs...)
+}
+
+// Middleware logs HTTP requests with their method, path, status, duration
+// and, for purchases, user and outcome.
+func (l *AccessLogger) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &accessRecord{}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessRecordKey{}, rec)))
+
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			l.log(r.Context(), "http request", status >= http.StatusInternalServerError, rec, []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"duration", time.Since(start),
+			})
+		})
+	}
+}
+
+// UnaryInterceptor logs gRPC calls with their method, status code, duration
+// and, for purchases, user and outcome.
+func (l *AccessLogger) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		rec := &accessRecord{}
+		if r, ok := req.(userRequest); ok {
+			rec.userID = r.GetUserId()
+		}
+		resp, err := next(context.WithValue(ctx, accessRecordKey{}, rec), req)
+
+		code := status.Code(err)
+		attrs := []any{
+			"method", info.FullMethod,
+			"code", code.String(),
+			"duration", time.Since(start),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		l.log(ctx, "grpc request", serverCode(code), rec, attrs)
+
+		return resp, err
+	}
+}
+
+// serverCode reports whether a gRPC code is the server's fault.
+func serverCode(code codes.Code) bool {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Hijack records the switch to a WebSocket connection.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+func (w *statusWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logLines decodes the JSON lines written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if raw == "" {
+			continue
+		}
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("decode log line %q: %v", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestAccessLogger_Purchase(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLogger(slog.New(slog.NewJSONHandler(&buf, nil)), 1, 0)
+	h := l.Middleware()(http.HandlerFunc(newTestHTTPHandler(t, newFakeCache(0)).Purchase))
+
+	body := `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/purchase", strings.NewReader(body)))
+
+	lines := logLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("expected one line, got %d", len(lines))
+	}
+	line := lines[0]
+	if line["path"] != "/v1/purchase" || line["status"] != float64(http.StatusGone) ||
+		line["user_id"] != "user-1" || line["outcome"] != "sold_out" {
+		t.Errorf("unexpected line: %v", line)
+	}
+}
+
+func TestAccessLogger_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewAccessLogger(slog.New(slog.NewJSONHandler(&buf, nil)), 0, 2)
+	status := http.StatusOK
+	h := l.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	serve := func() { h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/items", nil)) }
+
+	// Successes are sampled out entirely at rate 0
+	for range 5 {
+		serve()
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no lines, got %s", buf.String())
+	}
+
+	// Server errors are logged up to the cap, and the next line counts the rest
+	status = http.StatusInternalServerError
+	for range 5 {
+		serve()
+	}
+	if lines := logLines(t, &buf); len(lines) != 2 {
+		t.Fatalf("expected 2 lines under the cap, got %d", len(lines))
+	}
+	if dropped := l.dropped.Load(); dropped != 3 {
+		t.Errorf("expected 3 dropped lines, got %d", dropped)
+	}
+}
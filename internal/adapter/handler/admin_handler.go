@@ -0,0 +1,487 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// AdminHandler serves operator endpoints. It does no authentication of its
+// own and must be wrapped in AdminAuth.
+type AdminHandler struct {
+	workerTuning *service.WorkerTuning
+	campaigns    *service.CampaignService
+	inventory    *service.InventoryService
+	audit        *service.AuditService
+}
+
+// WorkerSettingsHTTP is the wire format of service.WorkerSettings. Durations
+// are in milliseconds. Fields omitted from an update keep their value.
+type WorkerSettingsHTTP struct {
+	BatchSize       *int   `json:"batch_size,omitempty"`
+	FlushIntervalMs *int64 `json:"flush_interval_ms,omitempty"`
+	RetryAttempts   *int   `json:"retry_attempts,omitempty"`
+	RetryBackoffMs  *int64 `json:"retry_backoff_ms,omitempty"`
+	MaxBackoffMs    *int64 `json:"max_backoff_ms,omitempty"`
+}
+
+type CampaignArchiveHTTP struct {
+	CampaignID      string         `json:"campaign_id"`
+	Stock           map[string]int `json:"stock"`
+	FrozenItems     []string       `json:"frozen_items"`
+	ClosedItems     []string       `json:"closed_items"`
+	IdempotencyKeys int            `json:"idempotency_keys"`
+	ArchivedAt      time.Time      `json:"archived_at"`
+}
+
+// CampaignWarmupHTTP reports a campaign warmup. Items with a problem are
+// not ready to be sold; nothing is written to the cache unless every item
+// has stock in the database.
+type CampaignWarmupHTTP struct {
+	CampaignID  string           `json:"campaign_id"`
+	StartsAt    time.Time        `json:"starts_at"`
+	Items       []WarmupItemHTTP `json:"items"`
+	KeysCleared int              `json:"keys_cleared"`
+	Ready       bool             `json:"ready"`
+	WarmedAt    time.Time        `json:"warmed_at"`
+}
+
+type WarmupItemHTTP struct {
+	ItemID    string `json:"item_id"`
+	Inventory int    `json:"inventory"`
+	Share     int    `json:"share"`
+	Stock     int    `json:"stock"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+// RestockHTTPRequest is the body of a restock. Actor defaults to the
+// authenticated caller.
+type RestockHTTPRequest struct {
+	Quantity int    `json:"quantity"`
+	Actor    string `json:"actor"`
+	Reason   string `json:"reason"`
+}
+
+type RestockHTTPResponse struct {
+	ItemID      string    `json:"item_id"`
+	Quantity    int       `json:"quantity"`
+	StockBefore int       `json:"stock_before"`
+	StockAfter  int       `json:"stock_after"`
+	Actor       string    `json:"actor"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ItemHTTP is an item. Price is in minor units of Currency, which defaults
+// to USD; a MaxPerUser of 0 puts no limit on purchases per user.
+type ItemHTTP struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id,omitempty"` // set from the server's tenant, ignored in requests
+	Name       string    `json:"name"`
+	Stock      int       `json:"stock"`
+	Price      int64     `json:"price"`
+	Currency   string    `json:"currency"`
+	MaxPerUser int       `json:"max_per_user"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ItemUpdateHTTP changes an item's details. Fields omitted from an update
+// keep their value. Stock is changed through restocks only.
+type ItemUpdateHTTP struct {
+	Name       *string `json:"name,omitempty"`
+	Price      *int64  `json:"price,omitempty"`
+	Currency   *string `json:"currency,omitempty"`
+	MaxPerUser *int    `json:"max_per_user,omitempty"`
+}
+
+type CampaignHTTP struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id,omitempty"` // set from the server's tenant, ignored in requests
+	Name      string    `json:"name"`
+	ItemIDs   []string  `json:"item_ids"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CampaignUpdateHTTP changes a campaign. Fields omitted from an update keep
+// their value.
+type CampaignUpdateHTTP struct {
+	Name     *string    `json:"name,omitempty"`
+	ItemIDs  []string   `json:"item_ids,omitempty"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+}
+
+func NewAdminHandler(workerTuning *service.WorkerTuning, campaigns *service.CampaignService, inventory *service.InventoryService, audit *service.AuditService) *AdminHandler {
+	return &AdminHandler{workerTuning: workerTuning, campaigns: campaigns, inventory: inventory, audit: audit}
+}
+
+// WorkerSettings handles GET and PUT /v1/admin/worker-settings.
+func (h *AdminHandler) WorkerSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, toWorkerSettingsHTTP(h.workerTuning.Settings()))
+
+	case http.MethodPut:
+		var req WorkerSettingsHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		before := h.workerTuning.Settings()
+		settings := mergeWorkerSettings(before, req)
+		if err := h.workerTuning.Update(settings); err != nil {
+			writeError(w, r, "", fmt.Errorf("%w: %w", errInvalidSettings, err))
+			return
+		}
+
+		resp := toWorkerSettingsHTTP(settings)
+		recordAudit(r, h.audit, domain.AuditWorkerSettings, "", toWorkerSettingsHTTP(before), resp, auditReason(r))
+		writeJSON(w, http.StatusOK, resp)
+
+	default:
+		writeError(w, r, "", errMethodNotAllowed)
+	}
+}
+
+// TeardownCampaign handles DELETE /v1/admin/campaigns/{id}. It archives the
+// campaign's final cache values and deletes its keys.
+func (h *AdminHandler) TeardownCampaign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	archive, err := h.campaigns.Teardown(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := CampaignArchiveHTTP{
+		CampaignID:      archive.CampaignID,
+		Stock:           archive.Stock,
+		FrozenItems:     archive.FrozenItems,
+		ClosedItems:     archive.ClosedItems,
+		IdempotencyKeys: archive.IdempotencyKeys,
+		ArchivedAt:      archive.ArchivedAt,
+	}
+	recordAudit(r, h.audit, domain.AuditCampaignTeardown, archive.CampaignID, resp, nil, auditReason(r))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// WarmupCampaign handles POST /v1/admin/campaigns/{id}/warmup. It loads the
+// campaign's stock into the cache before the sale opens and reports whether
+// the campaign is ready.
+func (h *AdminHandler) WarmupCampaign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	warmup, err := h.campaigns.Warmup(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := CampaignWarmupHTTP{
+		CampaignID:  warmup.CampaignID,
+		StartsAt:    warmup.StartsAt,
+		Items:       make([]WarmupItemHTTP, len(warmup.Items)),
+		KeysCleared: warmup.KeysCleared,
+		Ready:       warmup.Ready,
+		WarmedAt:    warmup.WarmedAt,
+	}
+	for i, item := range warmup.Items {
+		resp.Items[i] = WarmupItemHTTP{ItemID: item.ItemID, Inventory: item.Inventory, Share: item.Share, Stock: item.Stock, Problem: item.Problem}
+	}
+	recordAudit(r, h.audit, domain.AuditCampaignWarmup, warmup.CampaignID, nil, resp, auditReason(r))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Restock handles POST /v1/admin/items/{id}/restock. It adds units to the
+// item in MySQL and Redis and records who did it and why.
+func (h *AdminHandler) Restock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	var req RestockHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	// Default the actor to whoever authenticated the request
+	if principal := principalFrom(r.Context()); req.Actor == "" && principal != nil {
+		req.Actor = principal.Subject
+	}
+
+	restock, err := h.inventory.Restock(r.Context(), r.PathValue("id"), req.Quantity, req.Actor, req.Reason)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	reason := restock.Reason
+	if reason == "" {
+		reason = auditReason(r)
+	}
+	recordAudit(r, h.audit, domain.AuditRestock, restock.ItemID,
+		map[string]int{"stock": restock.StockBefore}, map[string]int{"stock": restock.StockAfter}, reason)
+
+	writeJSON(w, http.StatusOK, RestockHTTPResponse{
+		ItemID:      restock.ItemID,
+		Quantity:    restock.Quantity,
+		StockBefore: restock.StockBefore,
+		StockAfter:  restock.StockAfter,
+		Actor:       restock.Actor,
+		Reason:      restock.Reason,
+		CreatedAt:   restock.CreatedAt,
+	})
+}
+
+// Items handles GET and POST /v1/admin/items.
+func (h *AdminHandler) Items(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.inventory.ListItems(r.Context())
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		resp := make([]ItemHTTP, 0, len(items))
+		for _, item := range items {
+			resp = append(resp, toItemHTTP(item))
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req ItemHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		item, err := h.inventory.CreateItem(r.Context(), domain.Item{
+			ID:         req.ID,
+			Name:       req.Name,
+			Stock:      req.Stock,
+			Price:      req.Price,
+			Currency:   req.Currency,
+			MaxPerUser: req.MaxPerUser,
+		})
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		resp := toItemHTTP(*item)
+		recordAudit(r, h.audit, domain.AuditItemCreate, item.ID, nil, resp, auditReason(r))
+		writeJSON(w, http.StatusCreated, resp)
+
+	default:
+		writeError(w, r, "", errMethodNotAllowed)
+	}
+}
+
+// Item handles GET and PUT /v1/admin/items/{id}.
+func (h *AdminHandler) Item(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	item, err := h.inventory.GetItem(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req ItemUpdateHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		before := toItemHTTP(*item)
+		if req.Name != nil {
+			item.Name = *req.Name
+		}
+		if req.Price != nil {
+			item.Price = *req.Price
+		}
+		if req.Currency != nil {
+			item.Currency = *req.Currency
+		}
+		if req.MaxPerUser != nil {
+			item.MaxPerUser = *req.MaxPerUser
+		}
+
+		if item, err = h.inventory.UpdateItem(r.Context(), *item); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		recordAudit(r, h.audit, domain.AuditItemUpdate, item.ID, before, toItemHTTP(*item), auditReason(r))
+	}
+
+	writeJSON(w, http.StatusOK, toItemHTTP(*item))
+}
+
+// Campaigns handles GET and POST /v1/admin/campaigns.
+func (h *AdminHandler) Campaigns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		campaigns, err := h.campaigns.ListCampaigns(r.Context())
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		resp := make([]CampaignHTTP, 0, len(campaigns))
+		for _, campaign := range campaigns {
+			resp = append(resp, toCampaignHTTP(campaign))
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req CampaignHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		campaign, err := h.campaigns.CreateCampaign(r.Context(), domain.Campaign{
+			ID:       req.ID,
+			Name:     req.Name,
+			ItemIDs:  req.ItemIDs,
+			StartsAt: req.StartsAt,
+			EndsAt:   req.EndsAt,
+		})
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		resp := toCampaignHTTP(*campaign)
+		recordAudit(r, h.audit, domain.AuditCampaignCreate, campaign.ID, nil, resp, auditReason(r))
+		writeJSON(w, http.StatusCreated, resp)
+
+	default:
+		writeError(w, r, "", errMethodNotAllowed)
+	}
+}
+
+// Campaign handles GET and PUT /v1/admin/campaigns/{id}.
+func (h *AdminHandler) Campaign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	campaign, err := h.campaigns.GetCampaign(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req CampaignUpdateHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		before := toCampaignHTTP(*campaign)
+		if campaign, err = h.campaigns.UpdateCampaign(r.Context(), mergeCampaign(*campaign, req)); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		recordAudit(r, h.audit, domain.AuditCampaignUpdate, campaign.ID, before, toCampaignHTTP(*campaign), auditReason(r))
+	}
+
+	writeJSON(w, http.StatusOK, toCampaignHTTP(*campaign))
+}
+
+func toWorkerSettingsHTTP(s service.WorkerSettings) WorkerSettingsHTTP {
+	flush := s.FlushInterval.Milliseconds()
+	backoff := s.RetryBackoff.Milliseconds()
+	maxBackoff := s.MaxBackoff.Milliseconds()
+	return WorkerSettingsHTTP{
+		BatchSize:       &s.BatchSize,
+		FlushIntervalMs: &flush,
+		RetryAttempts:   &s.RetryAttempts,
+		RetryBackoffMs:  &backoff,
+		MaxBackoffMs:    &maxBackoff,
+	}
+}
+
+func mergeWorkerSettings(s service.WorkerSettings, req WorkerSettingsHTTP) service.WorkerSettings {
+	if req.BatchSize != nil {
+		s.BatchSize = *req.BatchSize
+	}
+	if req.FlushIntervalMs != nil {
+		s.FlushInterval = time.Duration(*req.FlushIntervalMs) * time.Millisecond
+	}
+	if req.RetryAttempts != nil {
+		s.RetryAttempts = *req.RetryAttempts
+	}
+	if req.RetryBackoffMs != nil {
+		s.RetryBackoff = time.Duration(*req.RetryBackoffMs) * time.Millisecond
+	}
+	if req.MaxBackoffMs != nil {
+		s.MaxBackoff = time.Duration(*req.MaxBackoffMs) * time.Millisecond
+	}
+	return s
+}
+
+func toItemHTTP(item domain.Item) ItemHTTP {
+	return ItemHTTP{
+		ID:         item.ID,
+		TenantID:   item.TenantID,
+		Name:       item.Name,
+		Stock:      item.Stock,
+		Price:      item.Price,
+		Currency:   item.Currency,
+		MaxPerUser: item.MaxPerUser,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.UpdatedAt,
+	}
+}
+
+func toCampaignHTTP(c domain.Campaign) CampaignHTTP {
+	return CampaignHTTP{
+		ID:        c.ID,
+		TenantID:  c.TenantID,
+		Name:      c.Name,
+		ItemIDs:   c.ItemIDs,
+		StartsAt:  c.StartsAt,
+		EndsAt:    c.EndsAt,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+func mergeCampaign(c domain.Campaign, req CampaignUpdateHTTP) domain.Campaign {
+	if req.Name != nil {
+		c.Name = *req.Name
+	}
+	if req.ItemIDs != nil {
+		c.ItemIDs = req.ItemIDs
+	}
+	if req.StartsAt != nil {
+		c.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		c.EndsAt = *req.EndsAt
+	}
+	return c
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func TestAuditHandler_RecordsAdminChanges(t *testing.T) {
+	db := memory.NewDatabase()
+	audit := service.NewAuditService(db)
+	tiers := NewTierHandler(service.NewTierService(db, 0), audit)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/admin/tiers/{user_id}", tiers.Tier)
+	mux.HandleFunc("GET /api/admin/audit", NewAuditHandler(audit).List)
+
+	setTier := func(userID, tier string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/admin/tiers/"+userID, strings.NewReader(`{"tier":"`+tier+`"}`))
+		req.Header.Set(auditReasonHeader, "launch partner")
+		req = req.WithContext(withPrincipal(req.Context(), &domain.Principal{Subject: "ops@example.com"}))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("set tier: %d %s", rec.Code, rec.Body)
+		}
+	}
+	list := func(query string) (*httptest.ResponseRecorder, AuditHTTPResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/audit?"+query, nil))
+		var resp AuditHTTPResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	setTier("user-1", "vip")
+	setTier("user-2", "vip")
+
+	rec, resp := list("limit=1")
+	if rec.Code != http.StatusOK || len(resp.Records) != 1 || resp.NextBefore == 0 {
+		t.Fatalf("unexpected first page: %d %+v", rec.Code, resp)
+	}
+	record := resp.Records[0]
+	if record.Actor != "ops@example.com" || record.Action != string(domain.AuditTierSet) || record.Target != "user-2" ||
+		record.Reason != "launch partner" || string(record.After) != `{"user_id":"user-2","tier":"vip"}` {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	_, resp = list("target=user-1")
+	if len(resp.Records) != 1 || string(resp.Records[0].Before) != `{"user_id":"user-1","tier":"normal"}` {
+		t.Errorf("expected user-1's change with its previous tier, got %+v", resp)
+	}
+
+	for _, query := range []string{"limit=0", "limit=501", "before=x"} {
+		if rec, _ := list(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
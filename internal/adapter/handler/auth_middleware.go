@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+type principalKey struct{}
+
+// tenantHeader names the tenant an operator's admin request acts for.
+const tenantHeader = "X-Tenant-ID"
+
+// AdminAuth only lets through callers the authorizer recognises. Reads need
+// the viewer role and everything else the admin role. Credentials are taken
+// from the X-API-Key header or an Authorization bearer token. The request
+// acts for the principal's tenant; see actingTenant.
+func AdminAuth(authorizer port.Authorizer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		creds := domain.Credentials{
+			APIKey:      r.Header.Get(apiKeyHeader),
+			BearerToken: bearerToken(r.Header.Get("Authorization")),
+		}
+
+		principal, err := authorizer.Authenticate(r.Context(), creds)
+		if err != nil {
+			log.Printf("authorizer error: %v", err)
+			writeError(w, r, "", errAuthUnavailable)
+			return
+		}
+		if principal == nil {
+			writeError(w, r, "", errUnauthorized)
+			return
+		}
+		if !principal.HasRole(requiredRole(r.Method)) {
+			writeError(w, r, "", errForbidden)
+			return
+		}
+		ctx, err := actingTenant(r.Context(), principal, r.Header.Get(tenantHeader))
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withPrincipal(ctx, principal)))
+	})
+}
+
+// actingTenant marks ctx with the tenant an admin request acts for: the
+// principal's own, or for an operator, whose principal carries no tenant,
+// the one named in the X-Tenant-ID header. An operator naming none acts
+// across every tenant.
+func actingTenant(ctx context.Context, principal *domain.Principal, named string) (context.Context, error) {
+	if principal.Tenant != "" {
+		if named != "" && named != principal.Tenant {
+			return nil, errForbidden
+		}
+		return port.WithTenant(ctx, principal.Tenant), nil
+	}
+	if named == "" {
+		return ctx, nil
+	}
+	if !domain.ValidTenantID(named) {
+		return nil, errInvalidTenant
+	}
+	return port.WithTenant(ctx, named), nil
+}
+
+// TenantAuth marks a public API request with its caller's tenant, the
+// merchant whose customers the Authorization bearer token was issued to.
+// Requests without a token are the default tenant's; one with a token the
+// authorizer does not accept is turned away. No role is needed.
+func TenantAuth(authorizer port.Authorizer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := callerTenant(r.Context(), authorizer, bearerToken(r.Header.Get("Authorization")))
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// callerTenant authenticates the bearer token of a public API call, if it
+// has one, and returns ctx marked with the caller's tenant.
+func callerTenant(ctx context.Context, authorizer port.Authorizer, token string) (context.Context, error) {
+	if token == "" {
+		return port.WithTenant(ctx, ""), nil
+	}
+	principal, err := authorizer.Authenticate(ctx, domain.Credentials{BearerToken: token})
+	if err != nil {
+		log.Printf("authorizer error: %v", err)
+		return nil, errAuthUnavailable
+	}
+	if principal == nil {
+		return nil, errUnauthorized
+	}
+	return port.WithTenant(ctx, principal.Tenant), nil
+}
+
+// OperatorOnly turns away principals limited to a tenant, for routes over
+// data every tenant shares such as coupons and the blacklist. It goes
+// inside AdminAuth.
+func OperatorOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal := principalFrom(r.Context()); principal == nil || principal.Tenant != "" {
+			writeError(w, r, "", errForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredRole returns the role needed for an admin request with method.
+func requiredRole(method string) domain.Role {
+	if method == http.MethodGet || method == http.MethodHead {
+		return domain.RoleViewer
+	}
+	return domain.RoleAdmin
+}
+
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func withPrincipal(ctx context.Context, principal *domain.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// principalFrom returns the caller authenticated by AdminAuth or
+// AuthInterceptor, if any.
+func principalFrom(ctx context.Context) *domain.Principal {
+	principal, _ := ctx.Value(principalKey{}).(*domain.Principal)
+	return principal
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/adapter/auth"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestAdminAuth(t *testing.T) {
+	authorizer := auth.NewStaticKeys(map[string]domain.Principal{
+		"admin-key":  {Subject: "alice", Roles: []domain.Role{domain.RoleAdmin}},
+		"viewer-key": {Subject: "grafana", Roles: []domain.Role{domain.RoleViewer}},
+	})
+
+	var subject string
+	h := AdminAuth(authorizer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = principalFrom(r.Context()).Subject
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		key     string
+		want    int
+		subject string
+	}{
+		{"no key", http.MethodGet, "", http.StatusUnauthorized, ""},
+		{"unknown key", http.MethodGet, "guess", http.StatusUnauthorized, ""},
+		{"viewer reads", http.MethodGet, "viewer-key", http.StatusOK, "grafana"},
+		{"viewer writes", http.MethodPost, "viewer-key", http.StatusForbidden, ""},
+		{"admin writes", http.MethodPost, "admin-key", http.StatusOK, "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject = ""
+			req := httptest.NewRequest(tt.method, "/admin/items", nil)
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if subject != tt.subject {
+				t.Errorf("expected subject %q, got %q", tt.subject, subject)
+			}
+		})
+	}
+}
+
+func TestAdminAuth_Tenant(t *testing.T) {
+	authorizer := auth.NewStaticKeys(map[string]domain.Principal{
+		"operator-key": {Subject: "alice", Roles: []domain.Role{domain.RoleAdmin}},
+		"acme-key":     {Subject: "bob", Roles: []domain.Role{domain.RoleAdmin}, Tenant: "acme"},
+	})
+	var tenant string
+	var scoped bool
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, scoped = port.TenantOf(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	tenantRoute := AdminAuth(authorizer, ok)
+	operatorRoute := AdminAuth(authorizer, OperatorOnly(ok))
+
+	tests := []struct {
+		name   string
+		route  http.Handler
+		key    string
+		named  string
+		want   int
+		tenant string
+		scoped bool
+	}{
+		{"operator", tenantRoute, "operator-key", "", http.StatusOK, "", false},
+		{"operator naming a tenant", tenantRoute, "operator-key", "acme", http.StatusOK, "acme", true},
+		{"operator naming an invalid tenant", tenantRoute, "operator-key", "acme:eu", http.StatusBadRequest, "", false},
+		{"own tenant", tenantRoute, "acme-key", "", http.StatusOK, "acme", true},
+		{"naming own tenant", tenantRoute, "acme-key", "acme", http.StatusOK, "acme", true},
+		{"naming other tenant", tenantRoute, "acme-key", "globex", http.StatusForbidden, "", false},
+		{"operator on shared data", operatorRoute, "operator-key", "", http.StatusOK, "", false},
+		{"tenant on shared data", operatorRoute, "acme-key", "", http.StatusForbidden, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, scoped = "", false
+			req := httptest.NewRequest(http.MethodGet, "/admin/items", nil)
+			req.Header.Set(apiKeyHeader, tt.key)
+			if tt.named != "" {
+				req.Header.Set(tenantHeader, tt.named)
+			}
+			rec := httptest.NewRecorder()
+			tt.route.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if tenant != tt.tenant || scoped != tt.scoped {
+				t.Errorf("expected tenant %q (%v), got %q (%v)", tt.tenant, tt.scoped, tenant, scoped)
+			}
+		})
+	}
+}
+
+// bearerTokens authenticates bearer tokens from a fixed set.
+type bearerTokens map[string]domain.Principal
+
+func (b bearerTokens) Authenticate(_ context.Context, creds domain.Credentials) (*domain.Principal, error) {
+	if principal, ok := b[creds.BearerToken]; ok {
+		return &principal, nil
+	}
+	return nil, nil
+}
+
+func TestTenantAuth(t *testing.T) {
+	authorizer := bearerTokens{
+		"acme-token":  {Subject: "u1", Tenant: "acme"},
+		"plain-token": {Subject: "u2"},
+	}
+	tenant := "unset"
+	h := TenantAuth(authorizer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if tenant, ok = port.TenantOf(r.Context()); !ok {
+			tenant = "unscoped"
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		token  string
+		want   int
+		tenant string
+	}{
+		{"no token", "", http.StatusOK, ""},
+		{"tenant token", "acme-token", http.StatusOK, "acme"},
+		{"default tenant token", "plain-token", http.StatusOK, ""},
+		{"unknown token", "guess", http.StatusUnauthorized, "unset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant = "unset"
+			req := httptest.NewRequest(http.MethodPost, "/v1/purchase", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if tenant != tt.tenant {
+				t.Errorf("expected tenant %q, got %q", tt.tenant, tenant)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	if got := bearerToken("Bearer abc.def.ghi"); got != "abc.def.ghi" {
+		t.Errorf("unexpected token %q", got)
+	}
+	if got := bearerToken("Basic dXNlcjpwYXNz"); got != "" {
+		t.Errorf("expected no token for basic auth, got %q", got)
+	}
+}
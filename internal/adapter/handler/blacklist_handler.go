@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// BlacklistHandler serves blacklist management. It does no authentication
+// of its own and must be wrapped in AdminAuth.
+type BlacklistHandler struct {
+	blacklist *service.BlacklistService
+	audit     *service.AuditService
+}
+
+// BlacklistHTTP lists the banned users and client IP ranges.
+type BlacklistHTTP struct {
+	Users    []string `json:"users"`
+	IPRanges []string `json:"ip_ranges"`
+}
+
+// BlacklistUserHTTP is a banned or unbanned user.
+type BlacklistUserHTTP struct {
+	UserID string `json:"user_id"`
+	Banned bool   `json:"banned"`
+}
+
+// BlacklistIPRangeHTTP is a banned or unbanned client IP range.
+type BlacklistIPRangeHTTP struct {
+	IPRange string `json:"ip_range"`
+	Banned  bool   `json:"banned"`
+}
+
+func NewBlacklistHandler(blacklist *service.BlacklistService, audit *service.AuditService) *BlacklistHandler {
+	return &BlacklistHandler{blacklist: blacklist, audit: audit}
+}
+
+// Blacklist handles GET /v1/admin/blacklist.
+func (h *BlacklistHandler) Blacklist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	users, err := h.blacklist.BannedUsers(r.Context())
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	if err := h.blacklist.Refresh(r.Context()); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := BlacklistHTTP{Users: users, IPRanges: []string{}}
+	if resp.Users == nil {
+		resp.Users = []string{}
+	}
+	for _, prefix := range h.blacklist.BannedIPRanges() {
+		resp.IPRanges = append(resp.IPRanges, prefix.String())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// User handles PUT and DELETE /v1/admin/blacklist/users/{user_id}, which
+// ban and unban the user.
+func (h *BlacklistHandler) User(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("user_id")
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		err = h.blacklist.BanUser(r.Context(), userID)
+	case http.MethodDelete:
+		err = h.blacklist.UnbanUser(r.Context(), userID)
+	default:
+		err = errMethodNotAllowed
+	}
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	ban := BlacklistUserHTTP{UserID: userID, Banned: true}
+	if r.Method == http.MethodPut {
+		recordAudit(r, h.audit, domain.AuditUserBan, userID, nil, ban, auditReason(r))
+	} else {
+		recordAudit(r, h.audit, domain.AuditUserUnban, userID, ban, nil, auditReason(r))
+	}
+	writeJSON(w, http.StatusOK, BlacklistUserHTTP{UserID: userID, Banned: r.Method == http.MethodPut})
+}
+
+// IPRange handles PUT and DELETE /v1/admin/blacklist/ip-ranges/{cidr...},
+// which ban and unban a CIDR range such as 203.0.113.0/24, or a single
+// address.
+func (h *BlacklistHandler) IPRange(w http.ResponseWriter, r *http.Request) {
+	cidr := r.PathValue("cidr")
+
+	var prefix netip.Prefix
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		prefix, err = h.blacklist.BanIPRange(r.Context(), cidr)
+	case http.MethodDelete:
+		prefix, err = h.blacklist.UnbanIPRange(r.Context(), cidr)
+	default:
+		err = errMethodNotAllowed
+	}
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	ban := BlacklistIPRangeHTTP{IPRange: prefix.String(), Banned: true}
+	if r.Method == http.MethodPut {
+		recordAudit(r, h.audit, domain.AuditIPRangeBan, ban.IPRange, nil, ban, auditReason(r))
+	} else {
+		recordAudit(r, h.audit, domain.AuditIPRangeUnban, ban.IPRange, ban, nil, auditReason(r))
+	}
+	writeJSON(w, http.StatusOK, BlacklistIPRangeHTTP{IPRange: prefix.String(), Banned: r.Method == http.MethodPut})
+}
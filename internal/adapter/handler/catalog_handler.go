@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// CatalogHandler serves the items on sale to shoppers from the in-memory
+// catalog, keeping the database off the read path.
+type CatalogHandler struct {
+	catalog *service.Catalog
+	orders  *service.OrderService
+}
+
+// CatalogItemHTTP is an item as shown to shoppers. UnitPrice is what one
+// unit costs now, in minor units of Currency; larger purchases may get a
+// lower tier price.
+type CatalogItemHTTP struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	UnitPrice  int64  `json:"unit_price"`
+	Currency   string `json:"currency"`
+	MaxPerUser int    `json:"max_per_user,omitempty"`
+}
+
+func NewCatalogHandler(catalog *service.Catalog, orders *service.OrderService) *CatalogHandler {
+	return &CatalogHandler{catalog: catalog, orders: orders}
+}
+
+// Items handles GET /v1/items.
+func (h *CatalogHandler) Items(w http.ResponseWriter, r *http.Request) {
+	items := h.catalog.ItemsIn(r.Context())
+	resp := make([]CatalogItemHTTP, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, h.toCatalogItemHTTP(item))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Item handles GET /v1/items/{id}.
+func (h *CatalogHandler) Item(w http.ResponseWriter, r *http.Request) {
+	item, ok := h.catalog.ItemIn(r.Context(), r.PathValue("id"))
+	if !ok {
+		writeError(w, r, "", service.ErrItemNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.toCatalogItemHTTP(item))
+}
+
+func (h *CatalogHandler) toCatalogItemHTTP(item domain.Item) CatalogItemHTTP {
+	unitPrice, _ := h.orders.Quote(item.ID, 1)
+	return CatalogItemHTTP{
+		ID:         item.ID,
+		Name:       item.Name,
+		UnitPrice:  unitPrice,
+		Currency:   item.Currency,
+		MaxPerUser: item.MaxPerUser,
+	}
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings Compress can apply.
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// encoder is the part of gzip.Writer and zstd.Encoder that Compress uses.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+	EncodingZstd: {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return enc
+	}},
+}
+
+// compressibleTypes are the content types worth compressing. Event streams
+// are left alone so each event reaches the client as it is written.
+var compressibleTypes = map[string]bool{
+	"application/json": true,
+	"text/plain":       true,
+	"text/html":        true,
+}
+
+// Compress encodes responses of at least minSize bytes with the first of
+// encodings, in order of preference, that the client accepts. Smaller
+// responses, such as most purchase answers, are sent as they are: the
+// encoding overhead would outweigh the saving.
+func Compress(minSize int, encodings ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings)
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the first of supported that the Accept-Encoding
+// header allows, or "" if none is.
+func negotiateEncoding(header string, supported []string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+
+	for _, encoding := range supported {
+		if allowed, ok := accepted[encoding]; ok {
+			if allowed {
+				return encoding
+			}
+			continue
+		}
+		if accepted["*"] {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the response is large enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+	// Responses without a body have nothing to compress
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide()
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) >= w.minSize {
+			if err := w.decide(); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far, compressing it only if it
+// already reached minSize.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header, compressing the body if it is large enough and
+// of a compressible type, then writes out the buffered start of the body.
+func (w *compressWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if compressibleTypes[mediaType] && header.Get("Content-Encoding") == "" {
+		header.Add("Vary", "Accept-Encoding")
+		if len(w.buf) >= w.minSize {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			w.enc = encoderPools[w.encoding].Get().(encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close ends the response once the handler returns.
+func (w *compressWriter) close() {
+	if !w.decided && w.status != 0 {
+		w.decide()
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	w.enc.Reset(nil)
+	encoderPools[w.encoding].Put(w.enc)
+	w.enc = nil
+}
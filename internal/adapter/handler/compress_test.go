@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"gzip, deflate, br", EncodingGzip},
+		{"zstd, gzip", EncodingZstd},
+		{"zstd;q=0, gzip;q=0.5", EncodingGzip},
+		{"*", EncodingZstd},
+		{"gzip;q=0, *", EncodingZstd},
+		{"identity", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header, []string{EncodingZstd, EncodingGzip}); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"items":"` + strings.Repeat("iphone-15 ", 200) + `"}`
+	h := Compress(1024, EncodingZstd, EncodingGzip)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			writeJSON(w, http.StatusOK, large)
+			return
+		}
+		writeJSON(w, http.StatusOK, "ok")
+	}))
+
+	send := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		EncodingGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		EncodingZstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		rec := send("/large", encoding)
+		if got := rec.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("expected %s encoding, got %q", encoding, got)
+		}
+		r, err := decode(rec.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if !strings.Contains(string(body), "iphone-15 iphone-15") {
+			t.Errorf("%s: unexpected body %q", encoding, body)
+		}
+	}
+
+	// Small responses are sent as they are
+	rec := send("/small", EncodingGzip)
+	if rec.Header().Get("Content-Encoding") != "" || strings.TrimSpace(rec.Body.String()) != `"ok"` {
+		t.Errorf("expected uncompressed response, got %q: %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+	if rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected Vary header, got %q", rec.Header().Get("Vary"))
+	}
+}
+
+func TestCompress_EventStream(t *testing.T) {
+	h := Compress(0, EncodingGzip)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: stock\ndata: {}\n\n")
+		http.NewResponseController(w).Flush()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/stock/item-1/stream", nil)
+	req.Header.Set("Accept-Encoding", EncodingGzip)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "" || !rec.Flushed {
+		t.Errorf("expected a flushed, uncompressed stream")
+	}
+	if rec.Body.String() != "event: stock\ndata: {}\n\n" {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+}
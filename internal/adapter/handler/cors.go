@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsExposedHeaders are the response headers browser clients may read.
+var corsExposedHeaders = []string{
+	idempotencyKeyHeader, requestIDHeader, "Retry-After", "Location", "Deprecation", "Link",
+}
+
+// CORSPolicy lists the browser origins allowed to call the API and what they
+// may send. "*" in AllowedOrigins allows any origin.
+type CORSPolicy struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and HTTP auth.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+func (p CORSPolicy) allows(origin string) bool {
+	return slices.Contains(p.AllowedOrigins, "*") || slices.Contains(p.AllowedOrigins, origin)
+}
+
+// CORS answers preflight requests from allowed origins and marks their
+// responses as readable. Requests from other origins are served without
+// CORS headers, so browsers block them.
+func CORS(policy CORSPolicy) Middleware {
+	methods := strings.Join(policy.AllowedMethods, ", ")
+	headers := strings.Join(policy.AllowedHeaders, ", ")
+	exposed := strings.Join(corsExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if !policy.allows(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Echo the origin rather than "*", which browsers reject
+			// alongside credentials
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
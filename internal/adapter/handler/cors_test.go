@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	var served int
+	h := CORS(CORSPolicy{
+		AllowedOrigins: []string{"https://shop.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "Idempotency-Key"},
+		MaxAge:         10 * time.Minute,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ }))
+
+	send := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/purchase", nil)
+		req.Header.Set("Origin", origin)
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodOptions, "https://shop.example.com", true)
+	if rec.Code != http.StatusNoContent || served != 0 {
+		t.Fatalf("expected preflight to be answered, got %d (served %d)", rec.Code, served)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" ||
+		rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight headers: %v", rec.Header())
+	}
+
+	rec = send(http.MethodPost, "https://shop.example.com", false)
+	if served != 1 || rec.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" {
+		t.Errorf("expected request to be served with CORS headers: %v", rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Error("expected exposed headers")
+	}
+
+	// Other origins get no CORS headers, so browsers block them
+	rec = send(http.MethodOptions, "https://evil.example.com", true)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers for unknown origin: %v", rec.Header())
+	}
+}
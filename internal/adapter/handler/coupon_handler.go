@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// CouponHandler serves coupon management. It does no authentication of its
+// own and must be wrapped in AdminAuth.
+type CouponHandler struct {
+	coupons *service.CouponService
+	audit   *service.AuditService
+}
+
+// CouponHTTP is a coupon. AmountOff is in minor units of Currency. Uses is
+// only reported for a single coupon.
+type CouponHTTP struct {
+	Code       string    `json:"code"`
+	PercentOff int       `json:"percent_off,omitempty"`
+	AmountOff  int64     `json:"amount_off,omitempty"`
+	Currency   string    `json:"currency,omitempty"`
+	MaxUses    int       `json:"max_uses"`
+	Uses       *int      `json:"uses,omitempty"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CouponUpdateHTTP changes a coupon. Fields omitted from an update keep
+// their value.
+type CouponUpdateHTTP struct {
+	PercentOff *int       `json:"percent_off,omitempty"`
+	AmountOff  *int64     `json:"amount_off,omitempty"`
+	Currency   *string    `json:"currency,omitempty"`
+	MaxUses    *int       `json:"max_uses,omitempty"`
+	StartsAt   *time.Time `json:"starts_at,omitempty"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+}
+
+func NewCouponHandler(coupons *service.CouponService, audit *service.AuditService) *CouponHandler {
+	return &CouponHandler{coupons: coupons, audit: audit}
+}
+
+// Coupons handles GET and POST /v1/admin/coupons.
+func (h *CouponHandler) Coupons(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		coupons, err := h.coupons.ListCoupons(r.Context())
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		resp := make([]CouponHTTP, 0, len(coupons))
+		for _, coupon := range coupons {
+			resp = append(resp, toCouponHTTP(coupon))
+		}
+		writeJSON(w, http.StatusOK, resp)
+
+	case http.MethodPost:
+		var req CouponHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		coupon, err := h.coupons.CreateCoupon(r.Context(), domain.Coupon{
+			Code:       req.Code,
+			PercentOff: req.PercentOff,
+			AmountOff:  req.AmountOff,
+			Currency:   req.Currency,
+			MaxUses:    req.MaxUses,
+			StartsAt:   req.StartsAt,
+			EndsAt:     req.EndsAt,
+		})
+		if err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		resp := toCouponHTTP(*coupon)
+		recordAudit(r, h.audit, domain.AuditCouponCreate, coupon.Code, nil, resp, auditReason(r))
+		writeJSON(w, http.StatusCreated, resp)
+
+	default:
+		writeError(w, r, "", errMethodNotAllowed)
+	}
+}
+
+// Coupon handles GET and PUT /v1/admin/coupons/{code}.
+func (h *CouponHandler) Coupon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	coupon, uses, err := h.coupons.GetCoupon(r.Context(), r.PathValue("code"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req CouponUpdateHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+
+		before := toCouponHTTP(*coupon)
+		if coupon, err = h.coupons.UpdateCoupon(r.Context(), mergeCoupon(*coupon, req)); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		recordAudit(r, h.audit, domain.AuditCouponUpdate, coupon.Code, before, toCouponHTTP(*coupon), auditReason(r))
+	}
+
+	resp := toCouponHTTP(*coupon)
+	resp.Uses = &uses
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func toCouponHTTP(c domain.Coupon) CouponHTTP {
+	resp := CouponHTTP{
+		Code:       c.Code,
+		PercentOff: c.PercentOff,
+		AmountOff:  c.AmountOff,
+		MaxUses:    c.MaxUses,
+		StartsAt:   c.StartsAt,
+		EndsAt:     c.EndsAt,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+	// A percentage applies in any currency
+	if c.AmountOff > 0 {
+		resp.Currency = c.Currency
+	}
+	return resp
+}
+
+func mergeCoupon(c domain.Coupon, req CouponUpdateHTTP) domain.Coupon {
+	if req.PercentOff != nil {
+		c.PercentOff = *req.PercentOff
+	}
+	if req.AmountOff != nil {
+		c.AmountOff = *req.AmountOff
+	}
+	if req.Currency != nil {
+		c.Currency = *req.Currency
+	}
+	if req.MaxUses != nil {
+		c.MaxUses = *req.MaxUses
+	}
+	if req.StartsAt != nil {
+		c.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		c.EndsAt = *req.EndsAt
+	}
+	return c
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+)
+
+// NewDebugHandler returns the mux for the diagnostics listener: pprof,
+// expvar and a plain-text dump of goroutines and queue state. It has no
+// authentication of its own and must only be bound to a private address.
+func NewDebugHandler(queueDepth func() int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/dump", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "order_queue_depth: %d\n", queueDepth())
+		fmt.Fprintf(w, "goroutines: %d\n\n", runtime.NumGoroutine())
+		rpprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	return mux
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler_Dump(t *testing.T) {
+	h := NewDebugHandler(func() int { return 42 })
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/dump", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "order_queue_depth: 42") {
+		t.Errorf("dump missing queue depth:\n%s", body)
+	}
+	if !strings.Contains(body, "goroutine ") {
+		t.Errorf("dump missing goroutine stacks")
+	}
+}
+
+func TestDebugHandler_Pprof(t *testing.T) {
+	h := NewDebugHandler(func() int { return 0 })
+
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// requestIDHeader tags a request so its error can be matched to server logs.
+// Purchases report their own request ID instead.
+const requestIDHeader = "X-Request-ID"
+
+// ErrorCode identifies an error for clients. Codes are stable; messages are
+// meant for people and may change.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest        ErrorCode = "invalid_request"
+	CodeInvalidIdempotencyKey ErrorCode = "invalid_idempotency_key"
+	CodeMissingFields         ErrorCode = "missing_fields"
+	CodeInvalidFields         ErrorCode = "invalid_fields"
+	CodeBodyTooLarge          ErrorCode = "body_too_large"
+	CodeMethodNotAllowed      ErrorCode = "method_not_allowed"
+	CodeUnauthorized          ErrorCode = "unauthorized"
+	CodeForbidden             ErrorCode = "forbidden"
+	CodeAuthUnavailable       ErrorCode = "authorization_unavailable"
+	CodeRateLimited           ErrorCode = "rate_limited"
+	CodeServerBusy            ErrorCode = "server_busy"
+	CodeInternal              ErrorCode = "internal_error"
+
+	CodeDuplicateRequest  ErrorCode = "duplicate_request"
+	CodePreviousFailure   ErrorCode = "previous_attempt_failed"
+	CodePurchaseNotFound  ErrorCode = "purchase_not_found"
+	CodePriceMismatch     ErrorCode = "price_mismatch"
+	CodeSoldOut           ErrorCode = "sold_out"
+	CodeSaleClosed        ErrorCode = "sale_closed"
+	CodeSalePaused        ErrorCode = "sale_paused"
+	CodePurchaseLimit     ErrorCode = "purchase_limit_exceeded"
+	CodeMixedCurrency     ErrorCode = "mixed_currency"
+	CodeCartUnsupported   ErrorCode = "cart_unsupported"
+	CodeCouponRejected    ErrorCode = "coupon_rejected"
+	CodeCouponExhausted   ErrorCode = "coupon_exhausted"
+	CodeAlreadyEntered    ErrorCode = "already_entered"
+	CodeNotDrawn          ErrorCode = "not_drawn"
+	CodeItemNotFound      ErrorCode = "item_not_found"
+	CodeStockUnavailable  ErrorCode = "stock_unavailable"
+	CodeOrderNotFound     ErrorCode = "order_not_found"
+	CodeOrderCancelled    ErrorCode = "order_cancelled"
+	CodeOrderConfirmed    ErrorCode = "order_confirmed"
+	CodeOrderNotConfirmed ErrorCode = "order_not_confirmed"
+	CodeHoldExpired       ErrorCode = "hold_expired"
+	CodePaymentRequired   ErrorCode = "payment_required"
+	CodePaymentDeclined   ErrorCode = "payment_declined"
+	CodeInvalidFilter     ErrorCode = "invalid_filter"
+
+	CodeAllocationNotFound  ErrorCode = "allocation_not_found"
+	CodeAllocationExhausted ErrorCode = "allocation_exhausted"
+
+	CodeInvalidItem       ErrorCode = "invalid_item"
+	CodeItemExists        ErrorCode = "item_exists"
+	CodeInvalidQuantity   ErrorCode = "invalid_quantity"
+	CodeRestockInProgress ErrorCode = "restock_in_progress"
+	CodeInvalidCampaign   ErrorCode = "invalid_campaign"
+	CodeCampaignNotFound  ErrorCode = "campaign_not_found"
+	CodeCampaignExists    ErrorCode = "campaign_exists"
+	CodeCampaignActive    ErrorCode = "campaign_active"
+	CodeCampaignStarted   ErrorCode = "campaign_started"
+	CodeUnknownRegion     ErrorCode = "unknown_region"
+	CodeRegionStockShort  ErrorCode = "region_stock_short"
+	CodeInvalidCoupon     ErrorCode = "invalid_coupon"
+	CodeCouponNotFound    ErrorCode = "coupon_not_found"
+	CodeCouponExists      ErrorCode = "coupon_exists"
+	CodeLotteryOpen       ErrorCode = "lottery_open"
+	CodeDrawInProgress    ErrorCode = "draw_in_progress"
+	CodeInvalidTier       ErrorCode = "invalid_tier"
+	CodeBotCheckFailed    ErrorCode = "bot_check_failed"
+	CodeInvalidToken      ErrorCode = "invalid_purchase_token"
+	CodeTokenUsed         ErrorCode = "purchase_token_used"
+	CodeSaleNotOpen       ErrorCode = "sale_not_open"
+	CodeBlacklisted       ErrorCode = "blacklisted"
+	CodeInvalidIPRange    ErrorCode = "invalid_ip_range"
+	CodeRiskRejected      ErrorCode = "risk_rejected"
+	CodeInvalidSettings   ErrorCode = "invalid_settings"
+)
+
+// ErrorHTTPResponse is the body of every HTTP error response.
+type ErrorHTTPResponse struct {
+	Error ErrorHTTP `json:"error"`
+}
+
+// ErrorHTTP describes an error. Retryable requests may succeed if sent again
+// unchanged, after any Retry-After delay.
+type ErrorHTTP struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	Retryable bool      `json:"retryable"`
+	RequestID string    `json:"request_id,omitempty"`
+
+	// Fields lists the rejected fields of an invalid_fields error.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// Errors raised by the handlers themselves
+var (
+	errInvalidBody           = errors.New("invalid request body")
+	errInvalidIdempotencyKey = errors.New("invalid idempotency key")
+	errMissingFields         = errors.New("missing required fields")
+	errValidation            = errors.New("invalid request")
+	errBodyTooLarge          = errors.New("request body too large")
+	errMethodNotAllowed      = errors.New("method not allowed")
+	errUnauthorized          = errors.New("unauthorized")
+	errForbidden             = errors.New("forbidden")
+	errAuthUnavailable       = errors.New("authorization unavailable")
+	errInvalidTenant         = errors.New("invalid tenant")
+	errRateLimited           = errors.New("rate limit exceeded")
+	errStockUnavailable      = errors.New("stock updates unavailable")
+	errUserIDRequired        = errors.New("user_id is required")
+	errInvalidSettings       = errors.New("invalid worker settings")
+)
+
+// errorSpec is how an error is reported over HTTP. An empty message uses the
+// error's own text, for errors that carry details for the caller.
+type errorSpec struct {
+	status    int
+	code      ErrorCode
+	message   string
+	retryable bool
+}
+
+// errorRegistry maps errors to their HTTP response, checked in order with
+// errors.Is. Errors not listed are internal errors.
+var errorRegistry = []struct {
+	err  error
+	spec errorSpec
+}{
+	{errInvalidBody, errorSpec{http.StatusBadRequest, CodeInvalidRequest, "invalid request body", false}},
+	{errInvalidIdempotencyKey, errorSpec{http.StatusBadRequest, CodeInvalidIdempotencyKey, "invalid idempotency key", false}},
+	{errMissingFields, errorSpec{http.StatusBadRequest, CodeMissingFields, "missing required fields", false}},
+	{errValidation, errorSpec{http.StatusBadRequest, CodeInvalidFields, "invalid request", false}},
+	{errBodyTooLarge, errorSpec{http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body too large", false}},
+	{errUserIDRequired, errorSpec{http.StatusBadRequest, CodeMissingFields, "user_id is required", false}},
+	{errMethodNotAllowed, errorSpec{http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed", false}},
+	{errUnauthorized, errorSpec{http.StatusUnauthorized, CodeUnauthorized, "unauthorized", false}},
+	{errForbidden, errorSpec{http.StatusForbidden, CodeForbidden, "forbidden", false}},
+	{errAuthUnavailable, errorSpec{http.StatusServiceUnavailable, CodeAuthUnavailable, "authorization unavailable", true}},
+	{errInvalidTenant, errorSpec{http.StatusBadRequest, CodeInvalidRequest, "invalid tenant", false}},
+	{errRateLimited, errorSpec{http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded", true}},
+	{errStockUnavailable, errorSpec{http.StatusServiceUnavailable, CodeStockUnavailable, "stock updates unavailable", true}},
+
+	{service.ErrOverloaded, errorSpec{http.StatusServiceUnavailable, CodeServerBusy, "server busy", true}},
+	{service.ErrPriceMismatch, errorSpec{http.StatusUnprocessableEntity, CodePriceMismatch, "price mismatch", false}},
+	{service.ErrDuplicateRequest, errorSpec{http.StatusConflict, CodeDuplicateRequest, "duplicate request", true}},
+	{service.ErrPreviousFailure, errorSpec{http.StatusConflict, CodePreviousFailure, "previous attempt failed", false}},
+	{service.ErrPurchaseNotFound, errorSpec{http.StatusNotFound, CodePurchaseNotFound, "purchase not found", false}},
+	{service.ErrInsufficientStock, errorSpec{http.StatusGone, CodeSoldOut, "sold out", false}},
+	{service.ErrSaleClosed, errorSpec{http.StatusGone, CodeSaleClosed, "sale closed", false}},
+	{service.ErrPurchaseLimit, errorSpec{http.StatusConflict, CodePurchaseLimit, "", false}},
+	{service.ErrMixedCurrency, errorSpec{http.StatusUnprocessableEntity, CodeMixedCurrency, "", false}},
+	{service.ErrCartUnsupported, errorSpec{http.StatusBadRequest, CodeCartUnsupported, "", false}},
+	{service.ErrCrossShardCart, errorSpec{http.StatusBadRequest, CodeCartUnsupported, "", false}},
+	{service.ErrBotCheckFailed, errorSpec{http.StatusForbidden, CodeBotCheckFailed, "bot check failed", false}},
+	{service.ErrInvalidPurchaseToken, errorSpec{http.StatusForbidden, CodeInvalidToken, "", false}},
+	{service.ErrPurchaseTokenUsed, errorSpec{http.StatusConflict, CodeTokenUsed, "purchase token already used", false}},
+	{service.ErrSaleNotOpen, errorSpec{http.StatusConflict, CodeSaleNotOpen, "", true}},
+	{service.ErrBlacklisted, errorSpec{http.StatusForbidden, CodeBlacklisted, "blacklisted", false}},
+	{service.ErrRiskRejected, errorSpec{http.StatusForbidden, CodeRiskRejected, "purchase rejected", false}},
+	{service.ErrCouponRejected, errorSpec{http.StatusUnprocessableEntity, CodeCouponRejected, "", false}},
+	{service.ErrCouponExhausted, errorSpec{http.StatusConflict, CodeCouponExhausted, "", false}},
+	{service.ErrLotteryCart, errorSpec{http.StatusBadRequest, CodeCartUnsupported, "", false}},
+	{service.ErrAlreadyEntered, errorSpec{http.StatusConflict, CodeAlreadyEntered, "already entered", false}},
+	{service.ErrNotDrawn, errorSpec{http.StatusGone, CodeNotDrawn, "not drawn", false}},
+	{service.ErrSaleFrozen, errorSpec{http.StatusServiceUnavailable, CodeSalePaused, "sale paused", true}},
+	{service.ErrItemNotFound, errorSpec{http.StatusNotFound, CodeItemNotFound, "item not found", false}},
+	{service.ErrOrderNotFound, errorSpec{http.StatusNotFound, CodeOrderNotFound, "order not found", false}},
+	{service.ErrOrderCancelled, errorSpec{http.StatusConflict, CodeOrderCancelled, "order cancelled", false}},
+	{service.ErrOrderConfirmed, errorSpec{http.StatusConflict, CodeOrderConfirmed, "order already confirmed", false}},
+	{service.ErrOrderNotConfirmed, errorSpec{http.StatusConflict, CodeOrderNotConfirmed, "order not confirmed", false}},
+	{service.ErrHoldExpired, errorSpec{http.StatusGone, CodeHoldExpired, "hold expired", false}},
+	{service.ErrPaymentRequired, errorSpec{http.StatusPaymentRequired, CodePaymentRequired, "payment_token is required", false}},
+	{service.ErrPaymentDeclined, errorSpec{http.StatusPaymentRequired, CodePaymentDeclined, "", false}},
+	{service.ErrInvalidOrderFilter, errorSpec{http.StatusBadRequest, CodeInvalidFilter, "", false}},
+	{service.ErrInvalidAuditFilter, errorSpec{http.StatusBadRequest, CodeInvalidFilter, "", false}},
+	{service.ErrInvalidOrderChangeFilter, errorSpec{http.StatusBadRequest, CodeInvalidFilter, "", false}},
+	{service.ErrAllocationNotFound, errorSpec{http.StatusNotFound, CodeAllocationNotFound, "allocation not found", false}},
+	{service.ErrAllocationExhausted, errorSpec{http.StatusConflict, CodeAllocationExhausted, "allocation exhausted", false}},
+	{service.ErrInvalidItem, errorSpec{http.StatusBadRequest, CodeInvalidItem, "", false}},
+	{service.ErrItemExists, errorSpec{http.StatusConflict, CodeItemExists, "item already exists", false}},
+	{service.ErrInvalidQuantity, errorSpec{http.StatusBadRequest, CodeInvalidQuantity, "", false}},
+	{service.ErrRestockInProgress, errorSpec{http.StatusConflict, CodeRestockInProgress, "restock in progress", true}},
+	{service.ErrInvalidCampaign, errorSpec{http.StatusBadRequest, CodeInvalidCampaign, "", false}},
+	{service.ErrCampaignNotFound, errorSpec{http.StatusNotFound, CodeCampaignNotFound, "campaign not found", false}},
+	{service.ErrCampaignExists, errorSpec{http.StatusConflict, CodeCampaignExists, "campaign already exists", false}},
+	{service.ErrInvalidCoupon, errorSpec{http.StatusBadRequest, CodeInvalidCoupon, "", false}},
+	{service.ErrCouponNotFound, errorSpec{http.StatusNotFound, CodeCouponNotFound, "coupon not found", false}},
+	{service.ErrCouponExists, errorSpec{http.StatusConflict, CodeCouponExists, "coupon already exists", false}},
+	{service.ErrLotteryOpen, errorSpec{http.StatusConflict, CodeLotteryOpen, "lottery entries are still open", false}},
+	{service.ErrDrawInProgress, errorSpec{http.StatusConflict, CodeDrawInProgress, "draw in progress", true}},
+	{service.ErrInvalidTier, errorSpec{http.StatusBadRequest, CodeInvalidTier, "", false}},
+	{service.ErrInvalidIPRange, errorSpec{http.StatusBadRequest, CodeInvalidIPRange, "", false}},
+	{service.ErrCampaignActive, errorSpec{http.StatusConflict, CodeCampaignActive, "campaign is active", false}},
+	{service.ErrCampaignStarted, errorSpec{http.StatusConflict, CodeCampaignStarted, "campaign has started", false}},
+	{service.ErrUnknownRegion, errorSpec{http.StatusBadRequest, CodeUnknownRegion, "", false}},
+	{service.ErrRegionStockShort, errorSpec{http.StatusConflict, CodeRegionStockShort, "", false}},
+	{errInvalidSettings, errorSpec{http.StatusBadRequest, CodeInvalidSettings, "", false}},
+}
+
+var internalError = errorSpec{http.StatusInternalServerError, CodeInternal, "internal error", true}
+
+// lookupError returns the registered response for err.
+func lookupError(err error) (errorSpec, bool) {
+	for _, entry := range errorRegistry {
+		if errors.Is(err, entry.err) {
+			return entry.spec, true
+		}
+	}
+	return internalError, false
+}
+
+// writeError reports err with its registered code, logging errors that are
+// not registered. requestID is the purchase request ID if there is one;
+// otherwise the client's X-Request-ID is echoed.
+func writeError(w http.ResponseWriter, r *http.Request, requestID string, err error) {
+	spec, ok := lookupError(err)
+	if !ok {
+		log.Printf("%s %s failed: %v", r.Method, r.URL.Path, err)
+	}
+
+	message := spec.message
+	if message == "" {
+		message = err.Error()
+	}
+	if requestID == "" {
+		requestID = r.Header.Get(requestIDHeader)
+	}
+
+	body := ErrorHTTP{
+		Code:      spec.code,
+		Message:   message,
+		Retryable: spec.retryable,
+		RequestID: requestID,
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		body.Fields = verr.Fields
+	}
+
+	writeJSON(w, spec.status, ErrorHTTPResponse{Error: body})
+}
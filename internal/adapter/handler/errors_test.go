@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) ErrorHTTP {
+	t.Helper()
+	var resp ErrorHTTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	return resp.Error
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		code      ErrorCode
+		message   string
+		retryable bool
+	}{
+		{"registered", service.ErrInsufficientStock, http.StatusGone, CodeSoldOut, "sold out", false},
+		{"wrapped", fmt.Errorf("%w: order queue full", service.ErrOverloaded), http.StatusServiceUnavailable, CodeServerBusy, "server busy", true},
+		{"detailed", fmt.Errorf("%w: name is required", service.ErrInvalidItem), http.StatusBadRequest, CodeInvalidItem, "invalid item: name is required", false},
+		{"unregistered", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, "internal error", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, httptest.NewRequest(http.MethodGet, "/", nil), "", tt.err)
+
+			if rec.Code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, rec.Code)
+			}
+			got := decodeError(t, rec)
+			if got.Code != tt.code || got.Message != tt.message || got.Retryable != tt.retryable {
+				t.Errorf("unexpected error: %+v", got)
+			}
+		})
+	}
+}
+
+func TestWriteError_RequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "trace-1")
+
+	rec := httptest.NewRecorder()
+	writeError(rec, req, "", errInvalidBody)
+	if got := decodeError(t, rec); got.RequestID != "trace-1" {
+		t.Errorf("expected echoed request ID, got %q", got.RequestID)
+	}
+
+	// A purchase reports its own request ID
+	rec = httptest.NewRecorder()
+	writeError(rec, req, "req-1", errInvalidBody)
+	if got := decodeError(t, rec); got.RequestID != "req-1" {
+		t.Errorf("expected purchase request ID, got %q", got.RequestID)
+	}
+}
+
+func TestPurchase_ErrorEnvelope(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(0))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusGone {
+		t.Fatalf("expected 410, got %d: %s", rec.Code, rec.Body.String())
+	}
+	got := decodeError(t, rec)
+	if got.Code != CodeSoldOut || got.RequestID != "req-1" || got.Retryable {
+		t.Errorf("unexpected error: %+v", got)
+	}
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// exportWriteTimeout bounds writing one batch of an export; the deadline is
+// pushed back before each batch so a long export outlives the server's
+// write timeout while a stalled client still gets cut off.
+const exportWriteTimeout = 30 * time.Second
+
+// exportColumns is the CSV header of an order export.
+var exportColumns = []string{
+	"id", "user_id", "item_id", "quantity", "status", "unit_price", "total_price",
+	"currency", "coupon_code", "discount", "created_at", "updated_at",
+}
+
+// ExportHandler streams orders out for offline reporting.
+type ExportHandler struct {
+	exporter *service.OrderExporter
+}
+
+// OrderExportHTTP is one line of an NDJSON order export. Prices are in
+// minor units of Currency.
+type OrderExportHTTP struct {
+	OrderID    string             `json:"order_id"`
+	UserID     string             `json:"user_id"`
+	ItemID     string             `json:"item_id"`
+	Quantity   int                `json:"quantity"`
+	Items      []PurchaseLineHTTP `json:"items,omitempty"`
+	Status     string             `json:"status"`
+	UnitPrice  int64              `json:"unit_price"`
+	TotalPrice int64              `json:"total_price"`
+	Currency   string             `json:"currency"`
+	CouponCode string             `json:"coupon_code,omitempty"`
+	Discount   int64              `json:"discount,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+func NewExportHandler(exporter *service.OrderExporter) *ExportHandler {
+	return &ExportHandler{exporter: exporter}
+}
+
+// Orders handles GET /v1/admin/orders/export. The optional item_id
+// parameter limits the export to orders of one item, from and to, as RFC
+// 3339 times, to orders created in that window, and format picks csv, the
+// default, or ndjson. Each batch is flushed as soon as it is written,
+// so a failure part way through ends the response early rather than with
+// an error status.
+func (h *ExportHandler) Orders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	verr := &ValidationError{}
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		verr.add("format", "must be csv or ndjson")
+	}
+	parseTime := func(name string) time.Time {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			verr.add(name, "must be an RFC 3339 time")
+		}
+		return t
+	}
+	window := domain.OrderWindow{ItemID: query.Get("item_id"), From: parseTime("from"), To: parseTime("to")}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, "", verr)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	buf := bufio.NewWriter(w)
+	csvw := csv.NewWriter(buf)
+	enc := json.NewEncoder(buf)
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="orders.`+format+`"`)
+		w.WriteHeader(http.StatusOK)
+		if format == "csv" {
+			csvw.Write(exportColumns)
+		}
+	}
+	flush := func() error {
+		csvw.Flush()
+		if err := csvw.Error(); err != nil {
+			return err
+		}
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err := h.exporter.Export(r.Context(), window, func(orders []domain.Order) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if !started {
+			start()
+		}
+		for _, order := range orders {
+			if format == "csv" {
+				csvw.Write(exportRecord(order))
+				continue
+			}
+			if err := enc.Encode(toOrderExportHTTP(order)); err != nil {
+				return err
+			}
+		}
+		return flush()
+	})
+	switch {
+	case err != nil && !started:
+		writeError(w, r, "", err)
+	case err != nil:
+		log.Printf("export orders: %v", err)
+	case !started:
+		// Nothing matched, which is still an export
+		start()
+		_ = flush()
+	}
+}
+
+func exportRecord(order domain.Order) []string {
+	return []string{
+		order.ID,
+		order.UserID,
+		order.ItemID,
+		strconv.Itoa(order.Quantity),
+		string(order.Status),
+		strconv.FormatInt(order.UnitPrice, 10),
+		strconv.FormatInt(order.TotalPrice, 10),
+		order.Currency,
+		order.CouponCode,
+		strconv.FormatInt(order.Discount, 10),
+		order.CreatedAt.UTC().Format(time.RFC3339),
+		order.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func toOrderExportHTTP(order domain.Order) OrderExportHTTP {
+	line := OrderExportHTTP{
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		ItemID:     order.ItemID,
+		Quantity:   order.Quantity,
+		Status:     string(order.Status),
+		UnitPrice:  order.UnitPrice,
+		TotalPrice: order.TotalPrice,
+		Currency:   order.Currency,
+		CouponCode: order.CouponCode,
+		Discount:   order.Discount,
+		CreatedAt:  order.CreatedAt,
+		UpdatedAt:  order.UpdatedAt,
+	}
+	for _, item := range order.Items {
+		line.Items = append(line.Items, PurchaseLineHTTP{ItemID: item.ItemID, Quantity: item.Quantity})
+	}
+	return line
+}
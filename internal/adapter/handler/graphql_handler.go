@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/graphql"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// graphQLMaxDepth is how deeply a query may nest fields. The schema has no
+// cycles deeper than order, line and item, so only hostile queries reach it.
+const graphQLMaxDepth = 8
+
+// GraphQLHandler serves read-only queries over orders, items and campaigns,
+// so a sale page can fetch what it shows in one round trip. It reads
+// through the same services as the REST API, with the same rules: a user's
+// orders are theirs alone and items come from the in-memory catalog.
+type GraphQLHandler struct {
+	schema *graphql.Schema
+}
+
+func NewGraphQLHandler(reservations *service.ReservationService, history *service.OrderHistoryService, catalog *service.Catalog, orders *service.OrderService, campaigns *service.CampaignService) *GraphQLHandler {
+	r := &graphQLResolvers{reservations: reservations, history: history, catalog: catalog, orders: orders, campaigns: campaigns, now: time.Now}
+	return &GraphQLHandler{schema: graphql.NewSchema(r.schema(), graphQLMaxDepth)}
+}
+
+// ServeHTTP handles POST /v1/graphql with a JSON body of query,
+// operationName and variables, and GET /v1/graphql with the same as
+// parameters, variables JSON encoded, for responses caches can keep.
+// Errors in the query are reported in the body with status 200, as GraphQL
+// clients expect.
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := decodeVariables(strings.NewReader(variables), &req.Variables); err != nil {
+				verr := &ValidationError{}
+				verr.add("variables", "must be a JSON object")
+				writeError(w, r, "", verr)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := decodeVariables(r.Body, &req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				err = errBodyTooLarge
+			} else {
+				err = fmt.Errorf("%w: %w", errInvalidBody, err)
+			}
+			writeError(w, r, "", err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		writeError(w, r, "", errMissingFields)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, graphql.Execute(r.Context(), h.schema, req))
+}
+
+// decodeVariables decodes JSON keeping numbers as json.Number, which is
+// how the executor takes variables.
+func decodeVariables(body io.Reader, v any) error {
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// graphQLResolvers reads the schema's fields from the services.
+type graphQLResolvers struct {
+	reservations *service.ReservationService
+	history      *service.OrderHistoryService
+	catalog      *service.Catalog
+	orders       *service.OrderService
+	campaigns    *service.CampaignService
+	now          func() time.Time
+}
+
+var (
+	dateTimeType = &graphql.Scalar{
+		Name: "DateTime",
+		Serialize: func(v any) (any, error) {
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("cannot serialize %T as DateTime", v)
+			}
+			return t.Format(time.RFC3339Nano), nil
+		},
+		ParseValue: func(v any) (any, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("expected an RFC 3339 time")
+			}
+			return time.Parse(time.RFC3339, s)
+		},
+	}
+	orderStatusType = &graphql.Enum{
+		Name:   "OrderStatus",
+		Values: []string{"PENDING", "CONFIRMED", "CANCELLED", "EXPIRED", "REFUNDED"},
+	}
+	campaignStatusType = &graphql.Enum{
+		Name:   "CampaignStatus",
+		Values: []string{"UPCOMING", "LIVE", "ENDED"},
+	}
+)
+
+func nonNull(t graphql.Type) graphql.Type { return &graphql.NonNull{Of: t} }
+func listOf(t graphql.Type) graphql.Type  { return &graphql.List{Of: t} }
+
+// schema builds the types of the schema:
+//
+//	type Query {
+//	  order(id: ID!, userId: ID!): Order
+//	  orders(userId: ID!, status: OrderStatus, from: DateTime, to: DateTime, first: Int = 20, after: String): OrderPage
+//	  item(id: ID!): Item
+//	  items: [Item!]!
+//	  campaign(id: ID!): Campaign
+//	}
+//
+// Objects are resolved to maps of their fields, except for the fields that
+// cost a lookup of their own, resolved only when asked for.
+func (g *graphQLResolvers) schema() *graphql.Object {
+	item := &graphql.Object{Name: "Item", Fields: map[string]*graphql.Field{
+		"id":         {Type: nonNull(graphql.ID)},
+		"name":       {Type: nonNull(graphql.String)},
+		"unitPrice":  {Type: nonNull(graphql.Int)},
+		"currency":   {Type: nonNull(graphql.String)},
+		"maxPerUser": {Type: graphql.Int},
+		"stock":      {Type: graphql.Int, Resolve: g.itemStock},
+	}}
+	itemField := &graphql.Field{Type: item, Resolve: g.itemOf}
+	line := &graphql.Object{Name: "OrderLine", Fields: map[string]*graphql.Field{
+		"itemId":   {Type: nonNull(graphql.ID)},
+		"quantity": {Type: nonNull(graphql.Int)},
+		"item":     itemField,
+	}}
+	order := &graphql.Object{Name: "Order", Fields: map[string]*graphql.Field{
+		"id":         {Type: nonNull(graphql.ID)},
+		"status":     {Type: nonNull(orderStatusType)},
+		"itemId":     {Type: nonNull(graphql.ID)},
+		"quantity":   {Type: nonNull(graphql.Int)},
+		"lines":      {Type: nonNull(listOf(nonNull(line)))},
+		"totalPrice": {Type: nonNull(graphql.Int)},
+		"currency":   {Type: nonNull(graphql.String)},
+		"couponCode": {Type: graphql.String},
+		"discount":   {Type: graphql.Int},
+		"createdAt":  {Type: nonNull(dateTimeType)},
+		"expiresAt":  {Type: dateTimeType},
+		"item":       itemField,
+	}}
+	orderPage := &graphql.Object{Name: "OrderPage", Fields: map[string]*graphql.Field{
+		"orders":     {Type: nonNull(listOf(nonNull(order)))},
+		"nextCursor": {Type: graphql.String},
+	}}
+	campaign := &graphql.Object{Name: "Campaign", Fields: map[string]*graphql.Field{
+		"id":       {Type: nonNull(graphql.ID)},
+		"name":     {Type: nonNull(graphql.String)},
+		"startsAt": {Type: nonNull(dateTimeType)},
+		"endsAt":   {Type: nonNull(dateTimeType)},
+		"status":   {Type: nonNull(campaignStatusType)},
+		"items":    {Type: nonNull(listOf(nonNull(item))), Resolve: g.campaignItems},
+	}}
+
+	return &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"order": {
+			Type:    order,
+			Args:    map[string]*graphql.Argument{"id": {Type: nonNull(graphql.ID)}, "userId": {Type: nonNull(graphql.ID)}},
+			Resolve: g.order,
+		},
+		"orders": {
+			Type: orderPage,
+			Args: map[string]*graphql.Argument{
+				"userId": {Type: nonNull(graphql.ID)},
+				"status": {Type: orderStatusType},
+				"from":   {Type: dateTimeType},
+				"to":     {Type: dateTimeType},
+				"first":  {Type: graphql.Int, Default: service.DefaultOrderPageSize},
+				"after":  {Type: graphql.String},
+			},
+			Resolve: g.userOrders,
+		},
+		"item": {
+			Type:    item,
+			Args:    map[string]*graphql.Argument{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: g.item,
+		},
+		"items": {Type: nonNull(listOf(nonNull(item))), Resolve: g.items},
+		"campaign": {
+			Type:    campaign,
+			Args:    map[string]*graphql.Argument{"id": {Type: nonNull(graphql.ID)}},
+			Resolve: g.campaign,
+		},
+	}}
+}
+
+func (g *graphQLResolvers) order(ctx context.Context, _ any, args map[string]any) (any, error) {
+	order, err := g.reservations.Order(ctx, args["id"].(string), args["userId"].(string))
+	if errors.Is(err, service.ErrOrderNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	return orderFields(*order), nil
+}
+
+func (g *graphQLResolvers) userOrders(ctx context.Context, _ any, args map[string]any) (any, error) {
+	var filter domain.OrderFilter
+	filter.Limit, _ = args["first"].(int)
+	if status, ok := args["status"].(string); ok {
+		filter.Status = domain.OrderStatus(strings.ToLower(status))
+	}
+	filter.From, _ = args["from"].(time.Time)
+	filter.To, _ = args["to"].(time.Time)
+	if after, ok := args["after"].(string); ok {
+		cursor, err := decodeOrderCursor(after)
+		if err != nil {
+			return nil, &graphql.Error{Message: "invalid cursor", Extensions: map[string]any{"code": CodeInvalidFilter}}
+		}
+		filter.After = cursor
+	}
+
+	page, err := g.history.List(ctx, args["userId"].(string), filter)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	orders := make([]map[string]any, 0, len(page.Orders))
+	for _, order := range page.Orders {
+		orders = append(orders, orderFields(order))
+	}
+	resp := map[string]any{"orders": orders}
+	if page.Next != nil {
+		resp["nextCursor"] = encodeOrderCursor(*page.Next)
+	}
+	return resp, nil
+}
+
+func (g *graphQLResolvers) item(ctx context.Context, _ any, args map[string]any) (any, error) {
+	item, ok := g.catalog.ItemIn(ctx, args["id"].(string))
+	if !ok {
+		return nil, nil
+	}
+	return g.itemFields(item), nil
+}
+
+func (g *graphQLResolvers) items(ctx context.Context, _ any, _ map[string]any) (any, error) {
+	items := g.catalog.ItemsIn(ctx)
+	resp := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, g.itemFields(item))
+	}
+	return resp, nil
+}
+
+// itemOf resolves the item of an order or order line from its itemId. Items
+// no longer in the catalog are null.
+func (g *graphQLResolvers) itemOf(ctx context.Context, source any, _ map[string]any) (any, error) {
+	item, ok := g.catalog.ItemIn(ctx, source.(map[string]any)["itemId"].(string))
+	if !ok {
+		return nil, nil
+	}
+	return g.itemFields(item), nil
+}
+
+func (g *graphQLResolvers) itemStock(ctx context.Context, source any, _ map[string]any) (any, error) {
+	stock, err := g.orders.StockHint(ctx, source.(map[string]any)["id"].(string))
+	if err != nil {
+		return nil, graphQLError(fmt.Errorf("stock of %s: %w", source.(map[string]any)["id"], err))
+	}
+	return stock, nil
+}
+
+func (g *graphQLResolvers) campaign(ctx context.Context, _ any, args map[string]any) (any, error) {
+	campaign, err := g.campaigns.GetCampaign(ctx, args["id"].(string))
+	if errors.Is(err, service.ErrCampaignNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+
+	status := "LIVE"
+	switch now := g.now(); {
+	case now.Before(campaign.StartsAt):
+		status = "UPCOMING"
+	case !now.Before(campaign.EndsAt):
+		status = "ENDED"
+	}
+	return map[string]any{
+		"id":       campaign.ID,
+		"name":     campaign.Name,
+		"startsAt": campaign.StartsAt,
+		"endsAt":   campaign.EndsAt,
+		"status":   status,
+		"itemIds":  campaign.ItemIDs,
+	}, nil
+}
+
+// campaignItems resolves a campaign's items from the catalog, leaving out
+// those no longer in it.
+func (g *graphQLResolvers) campaignItems(ctx context.Context, source any, _ map[string]any) (any, error) {
+	var items []map[string]any
+	for _, id := range source.(map[string]any)["itemIds"].([]string) {
+		if item, ok := g.catalog.ItemIn(ctx, id); ok {
+			items = append(items, g.itemFields(item))
+		}
+	}
+	if items == nil {
+		items = []map[string]any{}
+	}
+	return items, nil
+}
+
+func (g *graphQLResolvers) itemFields(item domain.Item) map[string]any {
+	unitPrice, _ := g.orders.Quote(item.ID, 1)
+	fields := map[string]any{
+		"id":        item.ID,
+		"name":      item.Name,
+		"unitPrice": unitPrice,
+		"currency":  item.Currency,
+	}
+	if item.MaxPerUser > 0 {
+		fields["maxPerUser"] = item.MaxPerUser
+	}
+	return fields
+}
+
+func orderFields(order domain.Order) map[string]any {
+	fields := map[string]any{
+		"id":         order.ID,
+		"status":     strings.ToUpper(string(order.Status)),
+		"itemId":     order.ItemID,
+		"quantity":   order.Quantity,
+		"totalPrice": order.TotalPrice,
+		"currency":   order.Currency,
+		"createdAt":  order.CreatedAt,
+	}
+	lines := make([]map[string]any, 0, len(order.Lines()))
+	for _, line := range order.Lines() {
+		lines = append(lines, map[string]any{"itemId": line.ItemID, "quantity": line.Quantity})
+	}
+	fields["lines"] = lines
+	if order.CouponCode != "" {
+		fields["couponCode"] = order.CouponCode
+		fields["discount"] = order.Discount
+	}
+	if !order.ExpiresAt.IsZero() {
+		fields["expiresAt"] = order.ExpiresAt
+	}
+	return fields
+}
+
+// graphQLError reports err with its registered code, like writeError does
+// for the REST API, logging errors that are not registered.
+func graphQLError(err error) error {
+	spec, ok := lookupError(err)
+	if !ok {
+		log.Printf("graphql: resolve failed: %v", err)
+	}
+	message := spec.message
+	if message == "" {
+		message = err.Error()
+	}
+	return &graphql.Error{Message: message, Extensions: map[string]any{"code": spec.code, "retryable": spec.retryable}}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/graphql"
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func newTestGraphQLHandler(t *testing.T) *GraphQLHandler {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+	cache := memory.NewCache()
+	db := memory.NewDatabase()
+	db.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 10, Price: 1000, Currency: "USD", CreatedAt: now, UpdatedAt: now})
+	db.CreateCampaign(ctx, domain.Campaign{ID: "spring", Name: "Spring sale", ItemIDs: []string{"item-1", "gone"},
+		StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)})
+	cache.SetStock(ctx, "item-1", 7)
+	for i, id := range []string{"a", "b", "c"} {
+		db.CreateOrder(ctx, domain.Order{ID: id, UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusConfirmed,
+			TotalPrice: 1000, Currency: "USD", CreatedAt: now.Add(time.Duration(i) * time.Minute)})
+	}
+	db.ProjectOrders(ctx, []string{"a", "b", "c"})
+
+	catalog := service.NewCatalog(db, time.Minute)
+	if err := catalog.Refresh(ctx); err != nil {
+		t.Fatalf("refresh catalog: %v", err)
+	}
+	orders := service.NewOrderService(cache, 10)
+	t.Cleanup(orders.Close)
+	reservations := service.NewReservationService(db, service.NewStockCompensator(cache, nil))
+	campaigns := service.NewCampaignService(cache, db, "spring")
+	return NewGraphQLHandler(reservations, service.NewOrderHistoryService(db), catalog, orders, campaigns)
+}
+
+func postGraphQL(h http.Handler, query string, variables map[string]any) (*httptest.ResponseRecorder, graphql.Response) {
+	body, _ := json.Marshal(graphql.Request{Query: query, Variables: variables})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(string(body))))
+	var resp graphql.Response
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec, resp
+}
+
+func TestGraphQLHandler_SalePage(t *testing.T) {
+	h := newTestGraphQLHandler(t)
+
+	rec, resp := postGraphQL(h, `
+		query SalePage($user: ID!) {
+			campaign(id: "spring") { name status items { id stock } }
+			mine: orders(userId: $user, first: 2) { orders { id status item { name unitPrice } } nextCursor }
+			order(id: "a", userId: $user) { id lines { itemId quantity } }
+			theirs: order(id: "a", userId: "user-2") { id }
+		}`, map[string]any{"user": "user-1"})
+	if rec.Code != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("expected 200 without errors, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var data struct {
+		Campaign struct {
+			Name, Status string
+			Items        []struct {
+				ID    string
+				Stock int
+			}
+		}
+		Mine struct {
+			Orders []struct {
+				ID, Status string
+				Item       struct{ Name string }
+			}
+			NextCursor *string
+		}
+		Order *struct {
+			ID    string
+			Lines []struct{ Quantity int }
+		}
+		Theirs *struct{ ID string }
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+	if data.Campaign.Status != "LIVE" || len(data.Campaign.Items) != 1 || data.Campaign.Items[0].Stock != 7 {
+		t.Errorf("unexpected campaign %+v", data.Campaign)
+	}
+	if len(data.Mine.Orders) != 2 || data.Mine.Orders[0].ID != "c" || data.Mine.Orders[0].Status != "CONFIRMED" ||
+		data.Mine.Orders[0].Item.Name != "Phone" || data.Mine.NextCursor == nil {
+		t.Errorf("unexpected orders %+v", data.Mine)
+	}
+	if data.Order == nil || data.Order.ID != "a" || len(data.Order.Lines) != 1 {
+		t.Errorf("unexpected order %+v", data.Order)
+	}
+	if data.Theirs != nil {
+		t.Errorf("expected another user's order to be null, got %+v", data.Theirs)
+	}
+
+	// The cursor continues the listing
+	_, resp = postGraphQL(h, `query($after: String) { orders(userId: "user-1", first: 2, after: $after) { orders { id } } }`,
+		map[string]any{"after": *data.Mine.NextCursor})
+	if !strings.Contains(string(resp.Data), `"orders":[{"id":"a"}]`) {
+		t.Errorf("unexpected last page %s", resp.Data)
+	}
+}
+
+func TestGraphQLHandler_Errors(t *testing.T) {
+	h := newTestGraphQLHandler(t)
+
+	// Errors in the query are reported without running it
+	_, resp := postGraphQL(h, `{ item(id: "item-1") { id secret } orders { orders { id } } }`, nil)
+	if resp.Data != nil || len(resp.Errors) != 2 {
+		t.Errorf("expected 2 validation errors and no data, got %s %+v", resp.Data, resp.Errors)
+	}
+
+	// Errors of a field leave the rest of the response
+	_, resp = postGraphQL(h, `{ item(id: "item-1") { id } orders(userId: "user-1", first: 1000) { orders { id } } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != string(CodeInvalidFilter) || !strings.Contains(string(resp.Data), `"item":{"id":"item-1"}`) {
+		t.Errorf("expected an invalid filter error alongside the item, got %s %+v", resp.Data, resp.Errors)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/graphql?query="+url.QueryEscape(`{ items { id } }`), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `{"data":{"items":[{"id":"item-1"}]}}`) {
+		t.Errorf("unexpected GET response %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ := postGraphQL(h, "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing query rejected, got %d", rec.Code)
+	}
+}
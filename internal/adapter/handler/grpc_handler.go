@@ -3,43 +3,330 @@ package handler
 import (
 	"context"
 	"errors"
+	"log"
+	"net/http"
+	"strings"
 
-	"github.com/rl1809/flash-sale/internal/adapter/handler/pb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
 	"github.com/rl1809/flash-sale/internal/core/service"
+	"github.com/rl1809/flash-sale/pkg/pb"
 )
 
+// errorDomain identifies this service in ErrorInfo details.
+const errorDomain = "flashsale"
+
 type GRPCHandler struct {
 	pb.UnimplementedOrderServiceServer
 	orderService *service.OrderService
+	stockService *service.StockService
+	validator    *PurchaseValidator
+	lottery      *service.LotteryService
+
+	bots              *service.BotGuard
+	trustForwardedFor bool
+	tokens            *service.PurchaseTokens
+}
+
+type GRPCHandlerOption func(*GRPCHandler)
+
+// WithGRPCPurchaseValidator replaces the default validator, which only
+// checks that fields are present and well formed.
+func WithGRPCPurchaseValidator(v *PurchaseValidator) GRPCHandlerOption {
+	return func(h *GRPCHandler) {
+		h.validator = v
+	}
+}
+
+// WithGRPCLottery enters purchases into the lottery instead of buying at
+// once; a successful response then carries no order ID.
+func WithGRPCLottery(l *service.LotteryService) GRPCHandlerOption {
+	return func(h *GRPCHandler) {
+		h.lottery = l
+	}
+}
+
+// WithGRPCBotCheck requires purchases to carry a captcha_token that bots
+// accepts, unless they come from a trusted client IP. trustForwardedFor
+// takes the IP from the x-forwarded-for metadata, as for rate limiting.
+func WithGRPCBotCheck(bots *service.BotGuard, trustForwardedFor bool) GRPCHandlerOption {
+	return func(h *GRPCHandler) {
+		h.bots = bots
+		h.trustForwardedFor = trustForwardedFor
+	}
+}
+
+// WithGRPCTrustForwardedFor takes the client IP of purchases from the
+// x-forwarded-for metadata, as for rate limiting.
+func WithGRPCTrustForwardedFor(trust bool) GRPCHandlerOption {
+	return func(h *GRPCHandler) {
+		h.trustForwardedFor = trust
+	}
 }
 
-func NewGRPCHandler(orderService *service.OrderService) *GRPCHandler {
-	return &GRPCHandler{orderService: orderService}
+// WithGRPCPurchaseTokens requires purchases to redeem a purchase_token
+// issued by tokens.
+func WithGRPCPurchaseTokens(tokens *service.PurchaseTokens) GRPCHandlerOption {
+	return func(h *GRPCHandler) {
+		h.tokens = tokens
+	}
+}
+
+func NewGRPCHandler(orderService *service.OrderService, stockService *service.StockService, opts ...GRPCHandlerOption) *GRPCHandler {
+	h := &GRPCHandler{orderService: orderService, stockService: stockService, validator: NewPurchaseValidator()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *GRPCHandler) Purchase(ctx context.Context, req *pb.PurchaseRequest) (*pb.PurchaseResponse, error) {
-	err := h.orderService.Purchase(ctx, req.GetRequestId(), req.GetUserId(), req.GetItemId(), int(req.GetQuantity()))
-	if err != nil {
-		if errors.Is(err, service.ErrDuplicateRequest) {
-			return &pb.PurchaseResponse{
-				Success: false,
-				Message: "duplicate request",
-			}, nil
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("purchase.user_id", req.GetUserId()))
+
+	lines := purchaseLines(req)
+	if err := h.validatePurchase(req, lines); err != nil {
+		return nil, err
+	}
+	ip := peerIP(ctx, h.trustForwardedFor)
+	if h.bots != nil {
+		if err := h.bots.Verify(ctx, req.GetCaptchaToken(), ip); err != nil {
+			recordAccess(ctx, "", service.OutcomeOf(err))
+			return nil, h.purchaseError(ctx, req, err)
 		}
-		if errors.Is(err, service.ErrInsufficientStock) {
-			return &pb.PurchaseResponse{
-				Success: false,
-				Message: "sold out",
-			}, nil
+	}
+	if h.tokens != nil {
+		if err := h.tokens.Redeem(ctx, req.GetPurchaseToken(), req.GetUserId(), purchasedItems(req.GetItemId(), lines)...); err != nil {
+			recordAccess(ctx, "", service.OutcomeOf(err))
+			return nil, h.purchaseError(ctx, req, err)
 		}
-		return &pb.PurchaseResponse{
-			Success: false,
-			Message: "internal error",
-		}, nil
+	}
+
+	opts := []service.PurchaseOption{service.FromClientIP(ip), service.FromDevice(req.GetDeviceId())}
+	if req.GetCouponCode() != "" {
+		opts = append(opts, service.UsingCoupon(req.GetCouponCode()))
+	}
+
+	if req.ExpectedTotal != nil {
+		err := h.orderService.CheckPrice(req.GetItemId(), int(req.GetQuantity()), req.GetExpectedTotal(), opts...)
+		if lines != nil {
+			err = h.orderService.CheckCartPrice(lines, req.GetExpectedTotal(), opts...)
+		}
+		if err != nil {
+			return nil, h.purchaseError(ctx, req, err)
+		}
+	}
+
+	if h.lottery != nil {
+		return h.enterLottery(ctx, req, lines, opts)
+	}
+
+	var orderID string
+	var err error
+	if lines != nil {
+		orderID, err = h.orderService.PurchaseCart(ctx, req.GetRequestId(), req.GetUserId(), lines, opts...)
+	} else {
+		orderID, err = h.orderService.Purchase(ctx, req.GetRequestId(), req.GetUserId(), req.GetItemId(), int(req.GetQuantity()), opts...)
+	}
+	recordAccess(ctx, "", service.OutcomeOf(err))
+	if err != nil {
+		return nil, h.purchaseError(ctx, req, err)
 	}
 
 	return &pb.PurchaseResponse{
-		Success: true,
-		Message: "order placed successfully",
+		Success:            true,
+		Message:            "order placed successfully",
+		OrderId:            orderID,
+		RemainingStockHint: h.remainingStock(ctx, req.GetItemId()),
 	}, nil
 }
+
+func (h *GRPCHandler) enterLottery(ctx context.Context, req *pb.PurchaseRequest, lines []domain.OrderItem, opts []service.PurchaseOption) (*pb.PurchaseResponse, error) {
+	err := service.ErrLotteryCart
+	if lines == nil {
+		err = h.lottery.Enter(ctx, req.GetRequestId(), req.GetUserId(), req.GetItemId(), int(req.GetQuantity()), opts...)
+	}
+	recordAccess(ctx, "", lotteryOutcome(err))
+	if err != nil {
+		return nil, h.purchaseError(ctx, req, err)
+	}
+	return &pb.PurchaseResponse{Success: true, Message: "lottery entry accepted"}, nil
+}
+
+// purchaseLines returns the lines of a multi-item purchase, or nil for a
+// purchase of a single item.
+func purchaseLines(req *pb.PurchaseRequest) []domain.OrderItem {
+	if len(req.GetItems()) == 0 {
+		return nil
+	}
+	lines := make([]domain.OrderItem, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		lines[i] = domain.OrderItem{ItemID: item.GetItemId(), Quantity: int(item.GetQuantity())}
+	}
+	return lines
+}
+
+// WatchStock streams the item's stock level until the client goes away.
+func (h *GRPCHandler) WatchStock(req *pb.WatchStockRequest, stream pb.OrderService_WatchStockServer) error {
+	if req.GetItemId() == "" {
+		return statusWithDetails(codes.InvalidArgument, "invalid request",
+			&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: "item_id", Description: "required"},
+			}})
+	}
+
+	levels, err := h.stockService.Watch(stream.Context(), req.GetItemId())
+	if err != nil {
+		log.Printf("watch stock %s: %v", req.GetItemId(), err)
+		return status.Error(codes.Unavailable, "stock updates unavailable")
+	}
+
+	for level := range levels {
+		if err := stream.Send(&pb.StockUpdate{ItemId: req.GetItemId(), Remaining: int32(max(level, 0))}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remainingStock returns the stock hint, or nil if it could not be read.
+func (h *GRPCHandler) remainingStock(ctx context.Context, itemID string) *int32 {
+	stock, err := h.orderService.StockHint(ctx, itemID)
+	if err != nil {
+		return nil
+	}
+	hint := int32(max(stock, 0))
+	return &hint
+}
+
+// validatePurchase reports invalid fields as BadRequest field violations.
+func (h *GRPCHandler) validatePurchase(req *pb.PurchaseRequest, lines []domain.OrderItem) error {
+	var verr *ValidationError
+	err := h.validator.ValidatePurchase(req.GetRequestId(), req.GetUserId(), req.GetItemId(), int(req.GetQuantity()), lines, req.GetCouponCode())
+	if !errors.As(err, &verr) {
+		return nil
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(verr.Fields))
+	for i, f := range verr.Fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message}
+	}
+	return statusWithDetails(codes.InvalidArgument, "invalid request",
+		&errdetails.BadRequest{FieldViolations: violations},
+		&pb.PurchaseResponse{Message: "invalid request", ErrorCode: pb.ErrorCode_ERROR_CODE_INVALID_ARGUMENT})
+}
+
+// grpcSpec is how an error of a registered code is reported over gRPC.
+type grpcSpec struct {
+	code      codes.Code
+	errorCode pb.ErrorCode
+}
+
+// grpcErrors maps the codes of errorRegistry to their gRPC status, so both
+// transports report a service error the same way. Registered codes not
+// listed get the status grpcStatus derives from their HTTP status and no
+// error code.
+var grpcErrors = map[ErrorCode]grpcSpec{
+	CodeInvalidFields:    {codes.InvalidArgument, pb.ErrorCode_ERROR_CODE_INVALID_ARGUMENT},
+	CodeDuplicateRequest: {codes.AlreadyExists, pb.ErrorCode_ERROR_CODE_DUPLICATE_REQUEST},
+	CodePreviousFailure:  {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_PREVIOUS_ATTEMPT_FAILED},
+	CodeSoldOut:          {codes.ResourceExhausted, pb.ErrorCode_ERROR_CODE_SOLD_OUT},
+	CodeSaleClosed:       {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_SALE_CLOSED},
+	CodeItemNotFound:     {codes.NotFound, pb.ErrorCode_ERROR_CODE_ITEM_NOT_FOUND},
+	CodeSalePaused:       {codes.Unavailable, pb.ErrorCode_ERROR_CODE_SALE_PAUSED},
+	CodeServerBusy:       {codes.Unavailable, pb.ErrorCode_ERROR_CODE_OVERLOADED},
+	CodeRateLimited:      {codes.ResourceExhausted, pb.ErrorCode_ERROR_CODE_RATE_LIMITED},
+	CodePurchaseLimit:    {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_PURCHASE_LIMIT},
+	CodeMixedCurrency:    {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_MIXED_CURRENCY},
+	CodeCouponRejected:   {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_COUPON_REJECTED},
+	CodeCouponExhausted:  {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_COUPON_EXHAUSTED},
+	CodeAlreadyEntered:   {codes.AlreadyExists, pb.ErrorCode_ERROR_CODE_ALREADY_ENTERED},
+	CodeNotDrawn:         {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_NOT_DRAWN},
+	CodeCartUnsupported:  {codes.InvalidArgument, pb.ErrorCode_ERROR_CODE_INVALID_ARGUMENT},
+	CodeBotCheckFailed:   {codes.PermissionDenied, pb.ErrorCode_ERROR_CODE_BOT_CHECK_FAILED},
+	CodeInvalidToken:     {codes.PermissionDenied, pb.ErrorCode_ERROR_CODE_INVALID_PURCHASE_TOKEN},
+	CodeTokenUsed:        {codes.AlreadyExists, pb.ErrorCode_ERROR_CODE_PURCHASE_TOKEN_USED},
+	CodeBlacklisted:      {codes.PermissionDenied, pb.ErrorCode_ERROR_CODE_BLACKLISTED},
+	CodeRiskRejected:     {codes.PermissionDenied, pb.ErrorCode_ERROR_CODE_RISK_REJECTED},
+	CodePriceMismatch:    {codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_PRICE_MISMATCH},
+	CodeInternal:         {codes.Internal, pb.ErrorCode_ERROR_CODE_INTERNAL},
+}
+
+// grpcStatus is the gRPC code closest to an HTTP status.
+func grpcStatus(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict, http.StatusGone, http.StatusUnprocessableEntity, http.StatusPaymentRequired:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// purchaseError maps a service error to a status carrying an ErrorInfo whose
+// reason clients can switch on, and a PurchaseResponse with the error code.
+// Errors are looked up in errorRegistry, like those of the HTTP API.
+func (h *GRPCHandler) purchaseError(ctx context.Context, req *pb.PurchaseRequest, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+
+	spec, ok := lookupError(err)
+	if !ok {
+		log.Printf("purchase failed: %v", err)
+	}
+	message := spec.message
+	if message == "" {
+		message = err.Error()
+	}
+	grpcErr, mapped := grpcErrors[spec.code]
+	reason := errorReason(grpcErr.errorCode)
+	if !mapped {
+		grpcErr = grpcSpec{code: grpcStatus(spec.status)}
+		reason = strings.ToUpper(string(spec.code))
+	}
+
+	resp := &pb.PurchaseResponse{Message: message, ErrorCode: grpcErr.errorCode}
+	if grpcErr.errorCode == pb.ErrorCode_ERROR_CODE_SOLD_OUT {
+		resp.RemainingStockHint = h.remainingStock(ctx, req.GetItemId())
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}, resp}
+	if grpcErr.errorCode == pb.ErrorCode_ERROR_CODE_OVERLOADED {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(overloadRetryAfter)})
+	}
+	return statusWithDetails(grpcErr.code, message, details...)
+}
+
+// errorReason is the ErrorInfo reason for an error code, e.g. SOLD_OUT.
+func errorReason(code pb.ErrorCode) string {
+	return strings.TrimPrefix(code.String(), "ERROR_CODE_")
+}
+
+func statusWithDetails(code codes.Code, message string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, message)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
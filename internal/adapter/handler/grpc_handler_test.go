@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+func newTestGRPCHandler(t *testing.T, cache *fakeCache) *GRPCHandler {
+	svc := service.NewOrderService(cache, 100)
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	t.Cleanup(svc.Close)
+	return NewGRPCHandler(svc, service.NewStockService(cache, nil))
+}
+
+func statusReason(t *testing.T, err error) (codes.Code, string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("expected status error, got %v", err)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return st.Code(), info.GetReason()
+		}
+	}
+	return st.Code(), ""
+}
+
+func purchaseDetail(t *testing.T, err error) *pb.PurchaseResponse {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		if resp, ok := d.(*pb.PurchaseResponse); ok {
+			return resp
+		}
+	}
+	t.Fatalf("no PurchaseResponse detail in %v", err)
+	return nil
+}
+
+func TestGRPCPurchase_StatusCodes(t *testing.T) {
+	cache := newFakeCache(1)
+	cache.keys["idempotency:req-in-flight"] = true
+	h := newTestGRPCHandler(t, cache)
+	ctx := context.Background()
+
+	resp, err := h.Purchase(ctx, &pb.PurchaseRequest{RequestId: "req-1", UserId: "user-1", ItemId: "item-1", Quantity: 1})
+	if err != nil || !resp.GetSuccess() || resp.GetOrderId() == "" {
+		t.Fatalf("expected success, got %v, %v", resp, err)
+	}
+	if resp.RemainingStockHint == nil || resp.GetRemainingStockHint() != 0 {
+		t.Errorf("expected remaining stock hint 0, got %v", resp.RemainingStockHint)
+	}
+
+	_, err = h.Purchase(ctx, &pb.PurchaseRequest{RequestId: "req-in-flight", UserId: "user-1", ItemId: "item-1", Quantity: 1})
+	if code, reason := statusReason(t, err); code != codes.AlreadyExists || reason != "DUPLICATE_REQUEST" {
+		t.Errorf("duplicate: got %v %q", code, reason)
+	}
+
+	_, err = h.Purchase(ctx, &pb.PurchaseRequest{RequestId: "req-2", UserId: "user-2", ItemId: "item-1", Quantity: 1})
+	if code, reason := statusReason(t, err); code != codes.ResourceExhausted || reason != "SOLD_OUT" {
+		t.Errorf("sold out: got %v %q", code, reason)
+	}
+	detail := purchaseDetail(t, err)
+	if detail.GetErrorCode() != pb.ErrorCode_ERROR_CODE_SOLD_OUT || detail.RemainingStockHint == nil {
+		t.Errorf("sold out: expected error code and stock hint in details, got %v", detail)
+	}
+}
+
+func TestGRPCPurchase_ReplayedOutcomes(t *testing.T) {
+	tests := []struct {
+		status    domain.PurchaseStatus
+		code      codes.Code
+		errorCode pb.ErrorCode
+	}{
+		{domain.PurchaseStatusFailed, codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_PREVIOUS_ATTEMPT_FAILED},
+		{domain.PurchaseStatusNotDrawn, codes.FailedPrecondition, pb.ErrorCode_ERROR_CODE_NOT_DRAWN},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			cache := newFakeCache(10)
+			cache.keys["idempotency:req-1"] = true
+			cache.results["idempotency:req-1"] = domain.PurchaseResult{Status: tt.status}
+			h := newTestGRPCHandler(t, cache)
+
+			_, err := h.Purchase(context.Background(), &pb.PurchaseRequest{RequestId: "req-1", UserId: "user-1", ItemId: "item-1", Quantity: 1})
+			if code, reason := statusReason(t, err); code != tt.code || reason != errorReason(tt.errorCode) {
+				t.Errorf("got %v %q, want %v %q", code, reason, tt.code, errorReason(tt.errorCode))
+			}
+			if detail := purchaseDetail(t, err); detail.GetErrorCode() != tt.errorCode {
+				t.Errorf("got error code %v, want %v", detail.GetErrorCode(), tt.errorCode)
+			}
+		})
+	}
+}
+
+func TestGRPCPurchase_InvalidArgument(t *testing.T) {
+	h := newTestGRPCHandler(t, newFakeCache(1))
+
+	_, err := h.Purchase(context.Background(), &pb.PurchaseRequest{RequestId: "req-1", ItemId: "item-1"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", st.Code())
+	}
+
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "user_id" || fields[1] != "quantity" {
+		t.Errorf("expected user_id and quantity violations, got %v", fields)
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const grpcHealthInterval = 5 * time.Second
+
+// ServeGRPCHealth keeps the gRPC health service in step with the readiness
+// checks until ctx is cancelled. Each service in deps is serving only while
+// the checks it depends on pass; the server as a whole ("") needs all of
+// them.
+func ServeGRPCHealth(ctx context.Context, server *health.Server, checker *HealthHandler, deps map[string][]string) {
+	ticker := time.NewTicker(grpcHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		updateGRPCHealth(server, checker.Check(ctx), deps)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func updateGRPCHealth(server *health.Server, report HealthReport, deps map[string][]string) {
+	server.SetServingStatus("", servingStatus(report.Ready))
+
+	for service, names := range deps {
+		ok := true
+		for _, name := range names {
+			if report.Checks[name] != nil {
+				ok = false
+			}
+		}
+		server.SetServingStatus(service, servingStatus(ok))
+	}
+}
+
+func servingStatus(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestUpdateGRPCHealth_PerService(t *testing.T) {
+	server := health.NewServer()
+	deps := map[string][]string{
+		"flashsale.OrderService": {"redis", "order_queue"},
+	}
+
+	// MySQL is down: the server is not ready but purchases still work
+	updateGRPCHealth(server, HealthReport{
+		Ready:  false,
+		Checks: map[string]error{"redis": nil, "mysql": errors.New("down"), "order_queue": nil},
+	}, deps)
+
+	want := map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"":                       healthpb.HealthCheckResponse_NOT_SERVING,
+		"flashsale.OrderService": healthpb.HealthCheckResponse_SERVING,
+	}
+	for service, status := range want {
+		resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("check %q: %v", service, err)
+		}
+		if resp.Status != status {
+			t.Errorf("%q: expected %v, got %v", service, status, resp.Status)
+		}
+	}
+
+	// Redis is down: purchases fail
+	updateGRPCHealth(server, HealthReport{
+		Ready:  false,
+		Checks: map[string]error{"redis": errors.New("down"), "mysql": nil, "order_queue": nil},
+	}, deps)
+
+	resp, _ := server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "flashsale.OrderService"})
+	if resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected NOT_SERVING, got %v", resp.Status)
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// userRequest is implemented by requests that carry a user ID.
+type userRequest interface {
+	GetUserId() string
+}
+
+// RecoveryInterceptor turns a panicking handler into an Internal error
+// instead of crashing the server.
+func RecoveryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("panic in %s: %v\n%s", info.FullMethod, p, debug.Stack())
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return next(ctx, req)
+}
+
+// RateLimitInterceptor rejects calls over the per-IP or per-user limit
+// with ResourceExhausted, carrying RetryInfo and a retry-after header in
+// seconds. Users are taken from requests that carry a user ID and IPs from
+// the peer address or, if trusted, the x-forwarded-for metadata.
+func RateLimitInterceptor(limits RateLimits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		var userID string
+		if r, ok := req.(userRequest); ok {
+			userID = r.GetUserId()
+		}
+		ip := peerIP(ctx, limits.TrustForwardedFor)
+
+		wait := limits.check(ctx, ip, userID)
+		if wait == 0 {
+			return next(ctx, req)
+		}
+
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfterSeconds(wait))))
+		return nil, statusWithDetails(codes.ResourceExhausted, "rate limit exceeded",
+			&errdetails.ErrorInfo{Reason: errorReason(pb.ErrorCode_ERROR_CODE_RATE_LIMITED), Domain: errorDomain},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)},
+		)
+	}
+}
+
+// peerIP returns the IP a call came from: the peer address or, if
+// trustForwardedFor is set, the x-forwarded-for metadata.
+func peerIP(ctx context.Context, trustForwardedFor bool) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return clientIP(p.Addr.String(), strings.Join(md.Get("x-forwarded-for"), ","), trustForwardedFor)
+}
+
+// AuthInterceptor requires callers of the given services to authenticate
+// and hold the role mapped to the service. Credentials are read from the
+// x-api-key or authorization metadata. Other services are not checked.
+func AuthInterceptor(authorizer port.Authorizer, services map[string]domain.Role) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		ctx, err := authorizeCall(ctx, authorizer, services, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of AuthInterceptor.
+func AuthStreamInterceptor(authorizer port.Authorizer, services map[string]domain.Role) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		ctx, err := authorizeCall(ss.Context(), authorizer, services, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return next(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// TenantInterceptor marks each call with its caller's tenant like
+// TenantAuth, from the bearer token in the authorization metadata.
+func TenantInterceptor(authorizer port.Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+		ctx, err := tenantCall(ctx, authorizer)
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// TenantStreamInterceptor is the streaming counterpart of TenantInterceptor.
+func TenantStreamInterceptor(authorizer port.Authorizer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		ctx, err := tenantCall(ss.Context(), authorizer)
+		if err != nil {
+			return err
+		}
+		return next(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func tenantCall(ctx context.Context, authorizer port.Authorizer) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, err := callerTenant(ctx, authorizer, bearerToken(firstValue(md, "authorization")))
+	switch {
+	case errors.Is(err, errAuthUnavailable):
+		return nil, status.Error(codes.Unavailable, "authorization unavailable")
+	case err != nil:
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	return ctx, nil
+}
+
+// authorizeCall checks the caller of fullMethod ("/package.Service/Method")
+// and returns ctx carrying its principal.
+func authorizeCall(ctx context.Context, authorizer port.Authorizer, services map[string]domain.Role, fullMethod string) (context.Context, error) {
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	role, protected := services[service]
+	if !protected {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	creds := domain.Credentials{
+		APIKey:      firstValue(md, "x-api-key"),
+		BearerToken: bearerToken(firstValue(md, "authorization")),
+	}
+
+	principal, err := authorizer.Authenticate(ctx, creds)
+	if err != nil {
+		log.Printf("authorizer error: %v", err)
+		return nil, status.Error(codes.Unavailable, "authorization unavailable")
+	}
+	if principal == nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	if !principal.HasRole(role) {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return withPrincipal(ctx, principal), nil
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// authorizedStream overrides the stream context so handlers see the
+// authenticated principal or tenant.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/rl1809/flash-sale/internal/adapter/auth"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+var testInfo = &grpc.UnaryServerInfo{FullMethod: pb.OrderService_Purchase_FullMethodName}
+
+type denyUser string
+
+func (d denyUser) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if key == string(d) {
+		return false, 1500 * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	_, err := RecoveryInterceptor(context.Background(), &pb.PurchaseRequest{}, testInfo,
+		func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	interceptor := RateLimitInterceptor(RateLimits{Users: denyUser("user-1"), IPs: denyUser("10.0.0.9")})
+	next := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+
+	_, err := interceptor(context.Background(), &pb.PurchaseRequest{UserId: "user-1"}, testInfo, next)
+	if code, reason := statusReason(t, err); code != codes.ResourceExhausted || reason != "RATE_LIMITED" {
+		t.Errorf("expected ResourceExhausted RATE_LIMITED, got %v", err)
+	}
+	var retry *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = d
+		}
+	}
+	if retry == nil || retry.GetRetryDelay().AsDuration() != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s RetryInfo, got %v", retry)
+	}
+
+	fromIP := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 4000}})
+	if _, err := interceptor(fromIP, &pb.PurchaseRequest{UserId: "user-2"}, testInfo, next); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected limited IP to be rejected, got %v", err)
+	}
+
+	resp, err := interceptor(context.Background(), &pb.PurchaseRequest{UserId: "user-2"}, testInfo, next)
+	if err != nil || resp != "ok" {
+		t.Errorf("expected call to pass, got %v %v", resp, err)
+	}
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	authorizer := auth.NewStaticKeys(map[string]domain.Principal{
+		"viewer-key": {Subject: "grafana", Roles: []domain.Role{domain.RoleViewer}},
+	})
+	interceptor := AuthInterceptor(authorizer, map[string]domain.Role{"flashsale.Admin": domain.RoleAdmin})
+	next := func(ctx context.Context, req any) (any, error) { return principalFrom(ctx), nil }
+	adminInfo := &grpc.UnaryServerInfo{FullMethod: "/flashsale.Admin/Restock"}
+	withKey := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", key))
+	}
+
+	if _, err := interceptor(context.Background(), nil, adminInfo, next); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	if _, err := interceptor(withKey("viewer-key"), nil, adminInfo, next); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+
+	// Services without a rule are not checked
+	if _, err := interceptor(context.Background(), &pb.PurchaseRequest{}, testInfo, next); err != nil {
+		t.Errorf("expected unprotected call to pass, got %v", err)
+	}
+
+	viewer := AuthInterceptor(authorizer, map[string]domain.Role{"flashsale.Admin": domain.RoleViewer})
+	resp, err := viewer(withKey("viewer-key"), nil, adminInfo, next)
+	if principal, _ := resp.(*domain.Principal); err != nil || principal == nil || principal.Subject != "grafana" {
+		t.Errorf("expected principal in context, got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckTimeout = time.Second
+
+	// queueSaturation is the fill ratio of the order queue above which the
+	// server reports itself as not ready
+	queueSaturation = 0.9
+)
+
+// HealthCheck reports whether a dependency is reachable.
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves liveness and readiness probes.
+type HealthHandler struct {
+	checks        map[string]HealthCheck
+	queueDepth    func() int
+	queueCapacity int
+}
+
+type HealthHTTPResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthReport is the result of running every check.
+type HealthReport struct {
+	Ready  bool
+	Checks map[string]error
+}
+
+func NewHealthHandler(checks map[string]HealthCheck, queueDepth func() int, queueCapacity int) *HealthHandler {
+	return &HealthHandler{checks: checks, queueDepth: queueDepth, queueCapacity: queueCapacity}
+}
+
+// Liveness handles GET /healthz. It only shows that the process is serving
+// requests, so orchestrators do not restart it because a dependency is down.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthHTTPResponse{Status: "ok"})
+}
+
+// Readiness handles GET /readyz, reporting each dependency and the order
+// queue.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+
+	resp := HealthHTTPResponse{Status: "ok", Checks: make(map[string]string, len(report.Checks))}
+	for name, err := range report.Checks {
+		if err != nil {
+			resp.Checks[name] = err.Error()
+		} else {
+			resp.Checks[name] = "ok"
+		}
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// Check runs all dependency checks concurrently and checks the order queue.
+func (h *HealthHandler) Check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := HealthReport{Ready: true, Checks: make(map[string]error, len(h.checks)+1)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			report.Checks[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if depth := h.queueDepth(); float64(depth) >= queueSaturation*float64(h.queueCapacity) {
+		report.Checks["order_queue"] = fmt.Errorf("saturated: %d/%d", depth, h.queueCapacity)
+	} else {
+		report.Checks["order_queue"] = nil
+	}
+
+	for _, err := range report.Checks {
+		if err != nil {
+			report.Ready = false
+		}
+	}
+	return report
+}
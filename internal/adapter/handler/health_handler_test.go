@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readiness(t *testing.T, h *HealthHandler) (int, HealthHTTPResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var resp HealthHTTPResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestReadiness_AllHealthy(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	h := NewHealthHandler(map[string]HealthCheck{"redis": ok, "mysql": ok}, func() int { return 0 }, 10)
+
+	code, resp := readiness(t, h)
+	if code != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("expected ready, got %d %+v", code, resp)
+	}
+	if resp.Checks["redis"] != "ok" || resp.Checks["mysql"] != "ok" || resp.Checks["order_queue"] != "ok" {
+		t.Errorf("unexpected checks: %v", resp.Checks)
+	}
+}
+
+func TestReadiness_DependencyDown(t *testing.T) {
+	h := NewHealthHandler(map[string]HealthCheck{
+		"redis": func(ctx context.Context) error { return nil },
+		"mysql": func(ctx context.Context) error { return errors.New("connection refused") },
+	}, func() int { return 0 }, 10)
+
+	code, resp := readiness(t, h)
+	if code != http.StatusServiceUnavailable || resp.Status != "unavailable" {
+		t.Fatalf("expected unavailable, got %d %+v", code, resp)
+	}
+	if resp.Checks["mysql"] != "connection refused" || resp.Checks["redis"] != "ok" {
+		t.Errorf("unexpected checks: %v", resp.Checks)
+	}
+}
+
+func TestReadiness_QueueSaturated(t *testing.T) {
+	h := NewHealthHandler(nil, func() int { return 95 }, 100)
+
+	code, resp := readiness(t, h)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	if resp.Checks["order_queue"] == "ok" {
+		t.Errorf("expected saturated queue, got %v", resp.Checks)
+	}
+}
+
+func TestLiveness_IgnoresDependencies(t *testing.T) {
+	h := NewHealthHandler(map[string]HealthCheck{
+		"mysql": func(ctx context.Context) error { return errors.New("down") },
+	}, func() int { return 0 }, 10)
+
+	rec := httptest.NewRecorder()
+	h.Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+}
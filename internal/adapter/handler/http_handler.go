@@ -4,79 +4,377 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
 	"github.com/rl1809/flash-sale/internal/core/service"
 )
 
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// overloadRetryAfter is how long clients are told to back off when the
+// server is shedding load
+const overloadRetryAfter = time.Second
+
+// idempotencyKeyPattern accepts UUIDs and similar opaque tokens
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+
 type HTTPHandler struct {
 	orderService *service.OrderService
+	validator    *PurchaseValidator
+	async        bool
+	lottery      *service.LotteryService
+
+	// bots, if set, checks the captcha_token of purchases
+	bots *service.BotGuard
+
+	// trustForwardedFor takes the client IP passed to bot checks and the
+	// blacklist from the X-Forwarded-For header
+	trustForwardedFor bool
+
+	// tokens, if set, requires a purchase_token from POST /v1/token
+	tokens *service.PurchaseTokens
+}
+
+type HTTPHandlerOption func(*HTTPHandler)
+
+// WithAsyncPurchases makes Purchase answer 202 Accepted once the purchase is
+// queued; clients poll PurchaseStatus for the outcome.
+func WithAsyncPurchases() HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.async = true
+	}
+}
+
+// WithLottery makes Purchase enter requests into the lottery, answering 202
+// Accepted; clients poll PurchaseStatus for the outcome of the draw.
+func WithLottery(l *service.LotteryService) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.lottery = l
+	}
+}
+
+// WithBotCheck requires purchases to carry a captcha_token that bots
+// accepts, unless they come from a trusted client IP. trustForwardedFor
+// takes the IP from the X-Forwarded-For header, as for rate limiting.
+func WithBotCheck(bots *service.BotGuard, trustForwardedFor bool) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.bots = bots
+		h.trustForwardedFor = trustForwardedFor
+	}
+}
+
+// WithTrustForwardedFor takes the client IP of purchases from the
+// X-Forwarded-For header, as for rate limiting.
+func WithTrustForwardedFor(trust bool) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.trustForwardedFor = trust
+	}
+}
+
+// WithPurchaseTokens requires purchases to redeem a purchase_token issued
+// by tokens.
+func WithPurchaseTokens(tokens *service.PurchaseTokens) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.tokens = tokens
+	}
+}
+
+// WithPurchaseValidator replaces the default validator, which only checks
+// that fields are present and well formed.
+func WithPurchaseValidator(v *PurchaseValidator) HTTPHandlerOption {
+	return func(h *HTTPHandler) {
+		h.validator = v
+	}
 }
 
 type PurchaseHTTPRequest struct {
-	RequestID string `json:"request_id"`
+	// RequestID may instead be sent as the Idempotency-Key header
+	RequestID string `json:"request_id,omitempty"`
 	UserID    string `json:"user_id"`
-	ItemID    string `json:"item_id"`
-	Quantity  int    `json:"quantity"`
+	ItemID    string `json:"item_id,omitempty"`
+	Quantity  int    `json:"quantity,omitempty"`
+
+	// ExpectedTotal is the total shown to the user, in minor currency units.
+	// When set, the purchase is rejected if the server price differs.
+	ExpectedTotal *int64 `json:"expected_total,omitempty"`
+
+	// CouponCode applies a coupon; ExpectedTotal is then the discounted total
+	CouponCode string `json:"coupon_code,omitempty"`
+
+	// Items buys several items in one order, all or none of them. It
+	// replaces ItemID and Quantity, which must then be left out.
+	Items []PurchaseLineHTTP `json:"items,omitempty"`
+
+	// CaptchaToken is the solved CAPTCHA, required when bots are checked
+	CaptchaToken string `json:"captcha_token,omitempty"`
+
+	// PurchaseToken is a token from POST /v1/token, required when purchase
+	// tokens are enabled
+	PurchaseToken string `json:"purchase_token,omitempty"`
+
+	// DeviceID identifies the client device for risk scoring
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// PurchaseLineHTTP is one item of a multi-item purchase.
+type PurchaseLineHTTP struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+}
+
+// cart returns the lines of a multi-item purchase, or nil for a purchase
+// of a single item.
+func (req PurchaseHTTPRequest) cart() []domain.OrderItem {
+	if req.Items == nil {
+		return nil
+	}
+	lines := make([]domain.OrderItem, len(req.Items))
+	for i, item := range req.Items {
+		lines[i] = domain.OrderItem{ItemID: item.ItemID, Quantity: item.Quantity}
+	}
+	return lines
 }
 
 type PurchaseHTTPResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	OrderID   string `json:"order_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PurchaseStatusHTTPResponse is the state of an asynchronous purchase:
+// queued, confirmed, sold_out, item_not_found, sale_closed or failed. A
+// lottery entry is entered until the draw, then not_drawn if it lost.
+type PurchaseStatusHTTPResponse struct {
+	RequestID string `json:"request_id"`
+	State     string `json:"state"`
+	OrderID   string `json:"order_id,omitempty"`
 }
 
-func NewHTTPHandler(orderService *service.OrderService) *HTTPHandler {
-	return &HTTPHandler{orderService: orderService}
+// PurchaseRecordHTTPResponse is everything recorded about a request. Reason
+// says why a request that did not succeed failed.
+type PurchaseRecordHTTPResponse struct {
+	RequestID string    `json:"request_id"`
+	UserID    string    `json:"user_id"`
+	State     string    `json:"state"`
+	OrderID   string    `json:"order_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewHTTPHandler(orderService *service.OrderService, opts ...HTTPHandlerOption) *HTTPHandler {
+	h := &HTTPHandler{orderService: orderService, validator: NewPurchaseValidator()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *HTTPHandler) Purchase(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "", errMethodNotAllowed)
 		return
 	}
 
 	var req PurchaseHTTPRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, PurchaseHTTPResponse{
-			Success: false,
-			Message: "invalid request body",
-		})
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
 		return
 	}
 
-	if req.RequestID == "" || req.UserID == "" || req.ItemID == "" || req.Quantity <= 0 {
-		writeJSON(w, http.StatusBadRequest, PurchaseHTTPResponse{
-			Success: false,
-			Message: "missing required fields",
-		})
+	// The Idempotency-Key header takes precedence over the body field
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		if !idempotencyKeyPattern.MatchString(key) {
+			writeError(w, r, "", errInvalidIdempotencyKey)
+			return
+		}
+		req.RequestID = key
+		w.Header().Set(idempotencyKeyHeader, key)
+	}
+
+	lines := req.cart()
+	if err := h.validator.ValidatePurchase(req.RequestID, req.UserID, req.ItemID, req.Quantity, lines, req.CouponCode); err != nil {
+		writeError(w, r, req.RequestID, err)
 		return
 	}
 
-	err := h.orderService.Purchase(r.Context(), req.RequestID, req.UserID, req.ItemID, req.Quantity)
-	if err != nil {
-		status := http.StatusInternalServerError
-		message := "internal error"
-
-		if errors.Is(err, service.ErrDuplicateRequest) {
-			status = http.StatusConflict
-			message = "duplicate request"
-		} else if errors.Is(err, service.ErrInsufficientStock) {
-			status = http.StatusGone
-			message = "sold out"
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("purchase.user_id", req.UserID))
+	recordAccess(r.Context(), req.UserID, "")
+
+	ip := clientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"), h.trustForwardedFor)
+	if h.bots != nil {
+		if err := h.bots.Verify(r.Context(), req.CaptchaToken, ip); err != nil {
+			recordAccess(r.Context(), "", service.OutcomeOf(err))
+			writeError(w, r, req.RequestID, err)
+			return
+		}
+	}
+	if h.tokens != nil {
+		if err := h.tokens.Redeem(r.Context(), req.PurchaseToken, req.UserID, purchasedItems(req.ItemID, lines)...); err != nil {
+			recordAccess(r.Context(), "", service.OutcomeOf(err))
+			writeError(w, r, req.RequestID, err)
+			return
+		}
+	}
+
+	opts := []service.PurchaseOption{service.FromClientIP(ip), service.FromDevice(req.DeviceID)}
+	if req.CouponCode != "" {
+		opts = append(opts, service.UsingCoupon(req.CouponCode))
+	}
+
+	if req.ExpectedTotal != nil {
+		err := h.orderService.CheckPrice(req.ItemID, req.Quantity, *req.ExpectedTotal, opts...)
+		if lines != nil {
+			err = h.orderService.CheckCartPrice(lines, *req.ExpectedTotal, opts...)
 		}
+		if err != nil {
+			writeError(w, r, req.RequestID, err)
+			return
+		}
+	}
+
+	if h.lottery != nil {
+		h.enterLottery(w, r, req, lines, opts)
+		return
+	}
+	if h.async {
+		h.submitPurchase(w, r, req, lines, opts)
+		return
+	}
 
-		writeJSON(w, status, PurchaseHTTPResponse{
-			Success: false,
-			Message: message,
-		})
+	var orderID string
+	var err error
+	if lines != nil {
+		orderID, err = h.orderService.PurchaseCart(r.Context(), req.RequestID, req.UserID, lines, opts...)
+	} else {
+		orderID, err = h.orderService.Purchase(r.Context(), req.RequestID, req.UserID, req.ItemID, req.Quantity, opts...)
+	}
+	recordAccess(r.Context(), "", service.OutcomeOf(err))
+	if err != nil {
+		writePurchaseError(w, r, req.RequestID, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, PurchaseHTTPResponse{
 		Success: true,
 		Message: "order placed successfully",
+		OrderID: orderID,
 	})
 }
 
+func (h *HTTPHandler) submitPurchase(w http.ResponseWriter, r *http.Request, req PurchaseHTTPRequest, lines []domain.OrderItem, opts []service.PurchaseOption) {
+	var err error
+	if lines != nil {
+		err = h.orderService.SubmitCart(r.Context(), req.RequestID, req.UserID, lines, opts...)
+	} else {
+		err = h.orderService.SubmitPurchase(r.Context(), req.RequestID, req.UserID, req.ItemID, req.Quantity, opts...)
+	}
+	if err != nil {
+		recordAccess(r.Context(), "", service.OutcomeOf(err))
+		writePurchaseError(w, r, req.RequestID, err)
+		return
+	}
+	recordAccess(r.Context(), "", "queued")
+
+	// The status lives under the path the purchase was sent to, whichever
+	// API version that was
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+url.PathEscape(req.RequestID))
+	writeJSON(w, http.StatusAccepted, PurchaseHTTPResponse{
+		Success:   true,
+		Message:   "purchase accepted",
+		RequestID: req.RequestID,
+	})
+}
+
+func (h *HTTPHandler) enterLottery(w http.ResponseWriter, r *http.Request, req PurchaseHTTPRequest, lines []domain.OrderItem, opts []service.PurchaseOption) {
+	err := service.ErrLotteryCart
+	if lines == nil {
+		err = h.lottery.Enter(r.Context(), req.RequestID, req.UserID, req.ItemID, req.Quantity, opts...)
+	}
+	recordAccess(r.Context(), "", lotteryOutcome(err))
+	if err != nil {
+		writePurchaseError(w, r, req.RequestID, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+url.PathEscape(req.RequestID))
+	writeJSON(w, http.StatusAccepted, PurchaseHTTPResponse{
+		Success:   true,
+		Message:   "lottery entry accepted",
+		RequestID: req.RequestID,
+	})
+}
+
+// lotteryOutcome is the access log outcome of a lottery entry.
+func lotteryOutcome(err error) string {
+	if err == nil {
+		return "entered"
+	}
+	return service.OutcomeOf(err)
+}
+
+// PurchaseStatus serves GET /v1/purchase/{request_id}.
+func (h *HTTPHandler) PurchaseStatus(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PathValue("request_id")
+
+	result, err := h.orderService.PurchaseState(r.Context(), requestID)
+	if err != nil {
+		writeError(w, r, requestID, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PurchaseStatusHTTPResponse{
+		RequestID: requestID,
+		State:     purchaseState(result.Status),
+		OrderID:   result.OrderID,
+	})
+}
+
+// PurchaseRecord serves GET /v1/admin/purchases/{request_id}, the support
+// view of a request. It does no authentication of its own and must be
+// wrapped in AdminAuth.
+func (h *HTTPHandler) PurchaseRecord(w http.ResponseWriter, r *http.Request) {
+	requestID := r.PathValue("request_id")
+
+	record, err := h.orderService.PurchaseRecord(r.Context(), requestID)
+	if err != nil {
+		writeError(w, r, requestID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, PurchaseRecordHTTPResponse{
+		RequestID: record.RequestID,
+		UserID:    record.UserID,
+		State:     purchaseState(record.Status),
+		OrderID:   record.OrderID,
+		Reason:    record.Reason,
+		UpdatedAt: record.UpdatedAt,
+	})
+}
+
+// purchaseState is the state reported for a purchase status.
+func purchaseState(status domain.PurchaseStatus) string {
+	if status == domain.PurchaseStatusSucceeded {
+		return "confirmed"
+	}
+	return string(status)
+}
+
+// writePurchaseError tells clients of an overloaded server when to retry.
+func writePurchaseError(w http.ResponseWriter, r *http.Request, requestID string, err error) {
+	if errors.Is(err, service.ErrOverloaded) {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(overloadRetryAfter)))
+	}
+	writeError(w, r, requestID, err)
+}
+
 func (h *HTTPHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
@@ -0,0 +1,465 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/adapter/risk"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// In-memory CacheRepository
+type fakeCache struct {
+	stock   int
+	keys    map[string]bool
+	results map[string]domain.PurchaseResult
+	mu      sync.Mutex
+}
+
+func newFakeCache(stock int) *fakeCache {
+	return &fakeCache{
+		stock:   stock,
+		keys:    make(map[string]bool),
+		results: make(map[string]domain.PurchaseResult),
+	}
+}
+
+func (f *fakeCache) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stock < quantity {
+		return domain.StockInsufficient, nil
+	}
+	f.stock -= quantity
+	return domain.StockDecremented, nil
+}
+
+func (f *fakeCache) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := 0
+	for _, line := range lines {
+		total += line.Quantity
+	}
+	if f.stock < total {
+		return domain.StockInsufficient, lines[0].ItemID, nil
+	}
+	f.stock -= total
+	return domain.StockDecremented, "", nil
+}
+
+func (f *fakeCache) GetStock(ctx context.Context, itemID string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stock, nil
+}
+
+func (f *fakeCache) SetStock(ctx context.Context, itemID string, quantity int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stock = quantity
+	return nil
+}
+
+func (f *fakeCache) IncrementStock(ctx context.Context, itemID string, quantity int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stock += quantity
+	return nil
+}
+
+func (f *fakeCache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.keys[key] {
+		return false, nil
+	}
+	f.keys[key] = true
+	return true, nil
+}
+
+func (f *fakeCache) ReleaseIdempotency(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.keys, key)
+	return nil
+}
+
+func (f *fakeCache) SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[key] = result
+	return nil
+}
+
+func (f *fakeCache) GetIdempotencyResult(ctx context.Context, key string) (*domain.PurchaseResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result, ok := f.results[key]
+	if !ok {
+		return nil, nil
+	}
+	return &result, nil
+}
+
+func newTestHTTPHandler(t *testing.T, cache *fakeCache, opts ...service.OrderServiceOption) *HTTPHandler {
+	svc := service.NewOrderService(cache, 100, opts...)
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	t.Cleanup(svc.Close)
+	return NewHTTPHandler(svc)
+}
+
+func doPurchase(h *HTTPHandler, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/purchase", strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.Purchase(rec, req)
+	return rec
+}
+
+func TestPurchase_IdempotencyKeyHeader(t *testing.T) {
+	cache := newFakeCache(10)
+	h := newTestHTTPHandler(t, cache)
+
+	body := `{"user_id":"user-1","item_id":"item-1","quantity":1}`
+	headers := map[string]string{idempotencyKeyHeader: "key-123"}
+
+	rec := doPurchase(h, body, headers)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(idempotencyKeyHeader); got != "key-123" {
+		t.Errorf("expected echoed key, got %q", got)
+	}
+
+	var first PurchaseHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&first)
+
+	// Header wins over a different body request_id
+	rec = doPurchase(h, `{"request_id":"other","user_id":"user-1","item_id":"item-1","quantity":1}`, headers)
+	var second PurchaseHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&second)
+
+	if second.OrderID != first.OrderID {
+		t.Errorf("expected replayed order %s, got %s", first.OrderID, second.OrderID)
+	}
+	if cache.stock != 9 {
+		t.Errorf("expected stock 9, got %d", cache.stock)
+	}
+}
+
+func TestPurchase_InvalidIdempotencyKey(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+
+	for _, key := range []string{"has space", strings.Repeat("a", 129), "semi;colon"} {
+		rec := doPurchase(h, `{"user_id":"user-1","item_id":"item-1","quantity":1}`,
+			map[string]string{idempotencyKeyHeader: key})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("key %q: expected 400, got %d", key, rec.Code)
+		}
+	}
+}
+
+func TestPurchase_BodyRequestID(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(idempotencyKeyHeader); got != "" {
+		t.Errorf("expected no echoed key, got %q", got)
+	}
+}
+
+func TestPurchase_ExpectedTotal(t *testing.T) {
+	cache := newFakeCache(10)
+	h := newTestHTTPHandler(t, cache, service.WithPricing(map[string]domain.PriceSchedule{
+		"item-1": {{MinQuantity: 1, UnitPrice: 1000}, {MinQuantity: 2, UnitPrice: 900}},
+	}))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":2,"expected_total":2000}`, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for stale total, got %d", rec.Code)
+	}
+	if cache.stock != 10 {
+		t.Errorf("rejected purchase should not take stock, got %d", cache.stock)
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":2,"expected_total":1800}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for matching total, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurchase_Cart(t *testing.T) {
+	cache := newFakeCache(10)
+	h := newTestHTTPHandler(t, cache, service.WithPricing(map[string]domain.PriceSchedule{
+		"item-1": {{MinQuantity: 1, UnitPrice: 1000}},
+		"item-2": {{MinQuantity: 1, UnitPrice: 300}},
+	}))
+
+	body := `{"request_id":"req-1","user_id":"user-1","expected_total":1600,"items":[{"item_id":"item-1","quantity":1},{"item_id":"item-2","quantity":2}]}`
+	rec := doPurchase(h, body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if cache.stock != 7 {
+		t.Errorf("expected every line taken from stock, got %d", cache.stock)
+	}
+}
+
+func TestPurchase_LoadShedRetryAfter(t *testing.T) {
+	// Nothing drains the queue, so the first order fills it to the threshold
+	svc := service.NewOrderService(newFakeCache(10), 1, service.WithLoadShedding(1))
+	t.Cleanup(svc.Close)
+	h := NewHTTPHandler(svc)
+
+	if rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	rec := doPurchase(h, `{"request_id":"req-2","user_id":"user-2","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+}
+
+func TestPurchase_Lottery(t *testing.T) {
+	cache := newFakeCache(10)
+	svc := service.NewOrderService(cache, 100)
+	t.Cleanup(svc.Close)
+	lottery := service.NewLotteryService(svc, memory.NewCache(), memory.NewLocker(), time.Now().Add(time.Hour))
+	h := NewHTTPHandler(svc, WithLottery(lottery))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Location"); got != "/api/purchase/req-1" {
+		t.Errorf("unexpected Location %q", got)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/purchase/{request_id}", h.PurchaseStatus)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/purchase/req-1", nil))
+	var status PurchaseStatusHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&status)
+	if status.State != "entered" {
+		t.Errorf("expected entered, got %+v", status)
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusConflict || decodeError(t, rec).Code != CodeAlreadyEntered {
+		t.Errorf("expected 409 already_entered, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-3","user_id":"user-2","items":[{"item_id":"a","quantity":1},{"item_id":"b","quantity":1}]}`, nil)
+	if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != CodeCartUnsupported {
+		t.Errorf("expected 400 cart_unsupported, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// fakeBotCheck accepts only its own token
+type fakeBotCheck string
+
+func (f fakeBotCheck) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return token == string(f), nil
+}
+
+func TestPurchase_BotCheck(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+	guard := service.NewBotGuard(fakeBotCheck("solved"), []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	WithBotCheck(guard, true)(h)
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != CodeBotCheckFailed {
+		t.Errorf("expected 403 bot_check_failed without a token, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":1,"captcha_token":"solved"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with a solved token, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-3","user_id":"user-2","item_id":"item-1","quantity":1}`, map[string]string{"X-Forwarded-For": "10.0.0.5"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 from a trusted client, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurchase_PurchaseTokens(t *testing.T) {
+	cache := newFakeCache(10)
+	tokens := service.NewPurchaseTokens([]byte("secret"), time.Minute, cache, time.Time{})
+	h := newTestHTTPHandler(t, cache)
+	WithPurchaseTokens(tokens)(h)
+
+	rec := httptest.NewRecorder()
+	NewTokenHandler(tokens).Issue(rec, httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader(`{"user_id":"user-1","item_id":"item-1"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var issued TokenHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&issued)
+
+	rec = doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != CodeInvalidToken {
+		t.Errorf("expected 403 invalid_purchase_token without a token, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":1,"purchase_token":"` + issued.Token + `"}`
+	if rec = doPurchase(h, body, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec = doPurchase(h, body, nil); rec.Code != http.StatusConflict || decodeError(t, rec).Code != CodeTokenUsed {
+		t.Errorf("expected 409 purchase_token_used on replay, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurchase_Blacklist(t *testing.T) {
+	ctx := context.Background()
+	blacklist := service.NewBlacklistService(memory.NewCache(), time.Minute)
+	blacklist.BanUser(ctx, "user-bad")
+	blacklist.BanIPRange(ctx, "203.0.113.0/24")
+	h := newTestHTTPHandler(t, newFakeCache(10), service.WithBlacklist(blacklist))
+	WithTrustForwardedFor(true)(h)
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-bad","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != CodeBlacklisted {
+		t.Errorf("expected 403 blacklisted for a banned user, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	headers := map[string]string{"X-Forwarded-For": "203.0.113.9"}
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":1}`, headers)
+	if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != CodeBlacklisted {
+		t.Errorf("expected 403 blacklisted for a banned IP, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = doPurchase(h, `{"request_id":"req-3","user_id":"user-1","item_id":"item-1","quantity":1}`, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurchase_RiskRejected(t *testing.T) {
+	scorer := risk.NewRules(50, 80, risk.NewDeviceVelocity(memory.NewCache(), 1, time.Minute, 100))
+	h := newTestHTTPHandler(t, newFakeCache(10), service.WithRiskScorer(scorer))
+
+	if rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1,"device_id":"d1"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := doPurchase(h, `{"request_id":"req-2","user_id":"user-2","item_id":"item-1","quantity":1,"device_id":"d1"}`, nil)
+	if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != CodeRiskRejected {
+		t.Errorf("expected 403 risk_rejected for a fast device, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPurchase_ReplayedOutcomes(t *testing.T) {
+	tests := []struct {
+		status    domain.PurchaseStatus
+		want      int
+		code      ErrorCode
+		retryable bool
+	}{
+		{domain.PurchaseStatusFailed, http.StatusConflict, CodePreviousFailure, false},
+		{domain.PurchaseStatusNotDrawn, http.StatusGone, CodeNotDrawn, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			cache := newFakeCache(10)
+			cache.keys["idempotency:req-1"] = true
+			cache.results["idempotency:req-1"] = domain.PurchaseResult{Status: tt.status}
+			h := newTestHTTPHandler(t, cache)
+
+			rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if e := decodeError(t, rec); e.Code != tt.code || e.Retryable != tt.retryable {
+				t.Errorf("expected %s retryable=%v, got %+v", tt.code, tt.retryable, e)
+			}
+			if cache.stock != 10 {
+				t.Errorf("a replay should not take stock, got %d", cache.stock)
+			}
+		})
+	}
+}
+
+func TestPurchaseRecord(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(0), service.WithPurchaseRecords(memory.NewCache(), time.Hour))
+	doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+
+	get := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/purchases/"+requestID, nil)
+		req.SetPathValue("request_id", requestID)
+		rec := httptest.NewRecorder()
+		h.PurchaseRecord(rec, req)
+		return rec
+	}
+
+	rec := get("req-1")
+	var resp PurchaseRecordHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.State != "sold_out" || resp.UserID != "user-1" || resp.Reason == "" {
+		t.Errorf("expected a sold out record, got %d: %+v", rec.Code, resp)
+	}
+	if rec := get("req-unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestPurchase_Async(t *testing.T) {
+	cache := newFakeCache(10)
+	svc := service.NewOrderService(cache, 100)
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	t.Cleanup(svc.Close)
+	h := NewHTTPHandler(svc, WithAsyncPurchases())
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1}`, nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Location"); got != "/api/purchase/req-1" {
+		t.Errorf("unexpected Location %q", got)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/purchase/{request_id}", h.PurchaseStatus)
+
+	var status PurchaseStatusHTTPResponse
+	deadline := time.Now().Add(time.Second)
+	for status.State != "confirmed" && time.Now().Before(deadline) {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/purchase/req-1", nil))
+		json.NewDecoder(rec.Body).Decode(&status)
+	}
+	if status.State != "confirmed" || status.OrderID == "" {
+		t.Errorf("expected confirmed with order ID, got %+v", status)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/purchase/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown request, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// LotteryHandler serves lottery draws. It does no authentication of its own
+// and must be wrapped in AdminAuth.
+type LotteryHandler struct {
+	lottery *service.LotteryService
+}
+
+// LotteryDrawHTTP is the outcome of a draw: how many entries were drawn and
+// how many of them became orders.
+type LotteryDrawHTTP struct {
+	ItemID  string    `json:"item_id"`
+	Entries int       `json:"entries"`
+	Winners int       `json:"winners"`
+	DrawnAt time.Time `json:"drawn_at"`
+}
+
+func NewLotteryHandler(lottery *service.LotteryService) *LotteryHandler {
+	return &LotteryHandler{lottery: lottery}
+}
+
+// Draw handles POST /v1/admin/lottery/{item_id}/draw. Draws run on their
+// own when entries close; this runs one again, e.g. for entries put back
+// while the sale was paused.
+func (h *LotteryHandler) Draw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	draw, err := h.lottery.Draw(r.Context(), r.PathValue("item_id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, LotteryDrawHTTP{
+		ItemID:  draw.ItemID,
+		Entries: draw.Entries,
+		Winners: draw.Winners,
+		DrawnAt: draw.DrawnAt,
+	})
+}
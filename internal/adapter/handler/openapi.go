@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rl1809/flash-sale/internal/adapter/graphql"
+	"github.com/rl1809/flash-sale/internal/adapter/openapi"
+)
+
+// APISpec documents the public API served under /v1, built from the types
+// the handlers decode and encode. The admin API is not part of it.
+func APISpec() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "Flash Sale API",
+		Version:     "1",
+		Description: "Purchases, orders and stock of flash sales. Errors share one body, whose code identifies the error.",
+	}, openapi.Server{URL: "/v1"})
+	doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		"partnerKey": {Type: "apiKey", In: "header", Name: apiKeyHeader},
+	}
+
+	// Every error is reported with the same body; its codes are those of
+	// the error registry
+	errorBody := doc.JSON(ErrorHTTPResponse{})
+	codes := []any{string(CodeInternal)}
+	for _, entry := range errorRegistry {
+		if !slices.Contains(codes, any(string(entry.spec.code))) {
+			codes = append(codes, string(entry.spec.code))
+		}
+	}
+	doc.Components.Schemas["Error"].Properties["code"].Enum = codes
+
+	respond := func(status int, description string, content map[string]*openapi.MediaType) map[string]*openapi.Response {
+		return map[string]*openapi.Response{
+			fmt.Sprint(status): {Description: description, Content: content},
+			"default":          {Description: "Error", Content: errorBody},
+		}
+	}
+	body := func(v any) *openapi.RequestBody {
+		return &openapi.RequestBody{Required: true, Content: doc.JSON(v)}
+	}
+	query := func(name, description string, schema *openapi.Schema) *openapi.Parameter {
+		return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+	}
+	partner := []map[string][]string{{"partnerKey": {}}}
+
+	purchased := respond(http.StatusOK, "Order placed", doc.JSON(PurchaseHTTPResponse{}))
+	purchased["202"] = &openapi.Response{Description: "Purchase queued or lottery entry accepted; poll its status", Content: doc.JSON(PurchaseHTTPResponse{})}
+	doc.Add(http.MethodPost, "/purchase", &openapi.Operation{
+		OperationID: "purchase",
+		Summary:     "Buy an item or a cart",
+		Tags:        []string{"purchases"},
+		Parameters: []*openapi.Parameter{{
+			Name: idempotencyKeyHeader, In: "header", Description: "Request ID, taking precedence over request_id",
+			Schema: &openapi.Schema{Type: "string", Pattern: idempotencyKeyPattern.String()},
+		}},
+		RequestBody: body(PurchaseHTTPRequest{}),
+		Responses:   purchased,
+	})
+	doc.Add(http.MethodGet, "/purchase/{request_id}", &openapi.Operation{
+		OperationID: "getPurchaseStatus",
+		Summary:     "Outcome of an asynchronous purchase or lottery entry",
+		Tags:        []string{"purchases"},
+		Responses:   respond(http.StatusOK, "Purchase state", doc.JSON(PurchaseStatusHTTPResponse{})),
+	})
+	doc.Add(http.MethodPost, "/token", &openapi.Operation{
+		OperationID: "issuePurchaseToken",
+		Summary:     "Issue a purchase token, when purchase tokens are enabled",
+		Tags:        []string{"purchases"},
+		RequestBody: body(TokenHTTPRequest{}),
+		Responses:   respond(http.StatusOK, "Token", doc.JSON(TokenHTTPResponse{})),
+	})
+
+	doc.Add(http.MethodGet, "/items", &openapi.Operation{
+		OperationID: "listItems",
+		Summary:     "Items on sale",
+		Tags:        []string{"catalog"},
+		Responses:   respond(http.StatusOK, "Items by ID", doc.JSON([]CatalogItemHTTP{})),
+	})
+	doc.Add(http.MethodGet, "/items/{id}", &openapi.Operation{
+		OperationID: "getItem",
+		Summary:     "An item on sale",
+		Tags:        []string{"catalog"},
+		Responses:   respond(http.StatusOK, "Item", doc.JSON(CatalogItemHTTP{})),
+	})
+	doc.Add(http.MethodGet, "/stock/{item_id}/stream", &openapi.Operation{
+		OperationID: "streamStock",
+		Summary:     "Live stock levels as server-sent events",
+		Tags:        []string{"catalog"},
+		Responses:   respond(http.StatusOK, "Stock events", map[string]*openapi.MediaType{"text/event-stream": {}}),
+	})
+
+	doc.Add(http.MethodPost, "/orders/{id}/confirm", &openapi.Operation{
+		OperationID: "confirmOrder",
+		Summary:     "Pay for and confirm a held order",
+		Tags:        []string{"orders"},
+		RequestBody: body(ConfirmOrderHTTPRequest{}),
+		Responses:   respond(http.StatusOK, "Order confirmed", doc.JSON(OrderHTTPResponse{})),
+	})
+	doc.Add(http.MethodPost, "/orders/{id}/cancel", &openapi.Operation{
+		OperationID: "cancelOrder",
+		Summary:     "Cancel a pending order",
+		Tags:        []string{"orders"},
+		RequestBody: body(CancelOrderHTTPRequest{}),
+		Responses:   respond(http.StatusOK, "Order cancelled", doc.JSON(OrderHTTPResponse{})),
+	})
+	doc.Add(http.MethodGet, "/users/{user_id}/orders", &openapi.Operation{
+		OperationID: "listOrders",
+		Summary:     "A user's orders, newest first",
+		Tags:        []string{"orders"},
+		Parameters: []*openapi.Parameter{
+			query("status", "pending, confirmed, cancelled, expired or refunded", &openapi.Schema{Type: "string"}),
+			query("from", "Orders placed at or after", &openapi.Schema{Type: "string", Format: "date-time"}),
+			query("to", "Orders placed before", &openapi.Schema{Type: "string", Format: "date-time"}),
+			query("limit", "Page size, at most 100", &openapi.Schema{Type: "integer", Format: "int32"}),
+			query("cursor", "next_cursor of the previous page", &openapi.Schema{Type: "string"}),
+		},
+		Responses: respond(http.StatusOK, "Page of orders", doc.JSON(OrderHistoryHTTPResponse{})),
+	})
+	doc.Add(http.MethodGet, "/users/{user_id}/orders/{id}", &openapi.Operation{
+		OperationID: "getOrder",
+		Summary:     "One of a user's orders",
+		Tags:        []string{"orders"},
+		Responses:   respond(http.StatusOK, "Order", doc.JSON(OrderHistoryItemHTTP{})),
+	})
+
+	doc.Add(http.MethodGet, "/graphql", &openapi.Operation{
+		OperationID: "queryGraphQL",
+		Summary:     "Run a read-only GraphQL query, cacheably",
+		Tags:        []string{"graphql"},
+		Parameters: []*openapi.Parameter{
+			query("query", "The query document", &openapi.Schema{Type: "string"}),
+			query("operationName", "The operation to run", &openapi.Schema{Type: "string"}),
+			query("variables", "Variables as a JSON object", &openapi.Schema{Type: "string"}),
+		},
+		Responses: respond(http.StatusOK, "Result, with any query errors", doc.JSON(graphql.Response{})),
+	})
+	doc.Add(http.MethodPost, "/graphql", &openapi.Operation{
+		OperationID: "postGraphQL",
+		Summary:     "Run a read-only GraphQL query",
+		Tags:        []string{"graphql"},
+		RequestBody: body(graphql.Request{}),
+		Responses:   respond(http.StatusOK, "Result, with any query errors", doc.JSON(graphql.Response{})),
+	})
+
+	doc.Add(http.MethodPost, "/partner/allocations", &openapi.Operation{
+		OperationID: "allocateStock",
+		Summary:     "Set stock aside for a partner",
+		Tags:        []string{"partners"},
+		RequestBody: body(AllocateHTTPRequest{}),
+		Responses:   respond(http.StatusCreated, "Allocation created", doc.JSON(PartnerHTTPResponse{})),
+		Security:    partner,
+	})
+	doc.Add(http.MethodPost, "/partner/allocations/{id}/fulfill", &openapi.Operation{
+		OperationID: "fulfillAllocation",
+		Summary:     "Place an order from a partner allocation",
+		Tags:        []string{"partners"},
+		RequestBody: body(FulfillHTTPRequest{}),
+		Responses:   respond(http.StatusOK, "Order placed", doc.JSON(PartnerHTTPResponse{})),
+		Security:    partner,
+	})
+	return doc
+}
+
+// ServeOpenAPI serves doc as JSON.
+func ServeOpenAPI(doc *openapi.Document) http.HandlerFunc {
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		panic(fmt.Sprintf("encode OpenAPI document: %v", err))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+type apiValidation struct {
+	doc    *openapi.Document
+	prefix string
+	report func(r *http.Request, err error)
+}
+
+type APIValidationOption func(*apiValidation)
+
+// WithResponseValidation also checks responses against the spec, passing
+// report each response that does not match. Responses are sent unchanged.
+func WithResponseValidation(report func(r *http.Request, err error)) APIValidationOption {
+	return func(v *apiValidation) {
+		v.report = report
+	}
+}
+
+// LogResponseMismatches reports responses that do not match the spec in
+// the log.
+func LogResponseMismatches(r *http.Request, err error) {
+	log.Printf("%s %s: response does not match the OpenAPI spec: %v", r.Method, r.URL.Path, err)
+}
+
+// ValidateAPI rejects requests to the routes doc documents under prefix
+// that do not match it, as the handlers would: a body that is not JSON with
+// invalid_request and mistyped, malformed or missing fields with
+// invalid_fields. Requests to undocumented routes and methods pass through.
+func ValidateAPI(doc *openapi.Document, prefix string, opts ...APIValidationOption) Middleware {
+	v := &apiValidation{doc: doc, prefix: prefix}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, ok := strings.CutPrefix(r.URL.EscapedPath(), v.prefix)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op, params, _ := doc.Find(r.Method, path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			violations, err := doc.ValidateRequest(op, r, params)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, r, "", errBodyTooLarge)
+				} else {
+					writeError(w, r, "", fmt.Errorf("%w: %w", errInvalidBody, err))
+				}
+				return
+			}
+			if len(violations) > 0 {
+				verr := &ValidationError{}
+				for _, violation := range violations {
+					verr.add(violation.Field, violation.Message)
+				}
+				writeError(w, r, "", verr)
+				return
+			}
+
+			if v.report == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &specRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.skip {
+				return
+			}
+			if err := doc.ValidateResponse(op, rec.statusCode(), w.Header(), rec.body.Bytes()); err != nil {
+				v.report(r, err)
+			}
+		})
+	}
+}
+
+// specRecorder passes a response through, keeping a copy of JSON bodies to
+// check them once sent.
+type specRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	// skip is set for bodies that are not JSON, such as event streams,
+	// which are neither kept nor checked
+	skip bool
+}
+
+func (r *specRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		mediaType, _, _ := mime.ParseMediaType(r.Header().Get("Content-Type"))
+		r.skip = mediaType != "" && mediaType != "application/json"
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *specRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.skip {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *specRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func (r *specRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/adapter/openapi"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// newSpecRouter serves the public API as the server does, under /v1 with
+// the spec enforced, failing the test on responses that do not match it.
+// It returns the operations requests reached.
+func newSpecRouter(t *testing.T) (*Router, map[string]bool) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+	cache := memory.NewCache()
+	db := memory.NewDatabase()
+	db.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 100, Price: 1000, Currency: "USD", CreatedAt: now, UpdatedAt: now})
+	cache.SetStock(ctx, "item-1", 50)
+	for _, id := range []string{"held", "held-2"} {
+		db.CreateOrder(ctx, domain.Order{ID: id, UserID: "user-1", ItemID: "item-1", Quantity: 1, TotalPrice: 1000, Currency: "USD",
+			Status: domain.OrderStatusPending, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+	}
+	db.ProjectOrders(ctx, []string{"held", "held-2"})
+
+	catalog := service.NewCatalog(db, time.Minute)
+	if err := catalog.Refresh(ctx); err != nil {
+		t.Fatalf("refresh catalog: %v", err)
+	}
+	orders := service.NewOrderService(cache, 100)
+	go func() {
+		for range orders.GetOrderQueue() {
+		}
+	}()
+	t.Cleanup(orders.Close)
+	reservations := service.NewReservationService(db, service.NewStockCompensator(cache, nil))
+	history := service.NewOrderHistoryService(db)
+	tokens := service.NewPurchaseTokens([]byte("secret"), time.Minute, cache, time.Time{})
+
+	httpHandler := NewHTTPHandler(orders)
+	orderHandler := NewOrderHandler(reservations)
+	partnerHandler := NewPartnerHandler(service.NewAllocationService(cache, db), map[string]string{"partner-key": "partner-1"})
+	catalogHandler := NewCatalogHandler(catalog, orders)
+
+	doc := APISpec()
+	reached := make(map[string]bool)
+	track := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if op, _, _ := doc.Find(r.Method, strings.TrimPrefix(r.URL.EscapedPath(), "/v1")); op != nil {
+				reached[op.OperationID] = true
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	router := NewRouter()
+	router.HandleFunc("GET /openapi.json", ServeOpenAPI(doc))
+	api := router.Group("/v1", track, ValidateAPI(doc, "/v1", WithResponseValidation(func(r *http.Request, err error) {
+		t.Errorf("%s %s: %v", r.Method, r.URL, err)
+	})))
+	api.HandleFunc("/purchase", httpHandler.Purchase)
+	api.HandleFunc("GET /purchase/{request_id}", httpHandler.PurchaseStatus)
+	api.HandleFunc("/token", NewTokenHandler(tokens).Issue)
+	api.HandleFunc("GET /items", catalogHandler.Items)
+	api.HandleFunc("GET /items/{id}", catalogHandler.Item)
+	api.HandleFunc("/orders/{id}/confirm", orderHandler.Confirm)
+	api.HandleFunc("/orders/{id}/cancel", orderHandler.Cancel)
+	api.HandleFunc("GET /users/{user_id}/orders", NewOrderHistoryHandler(history).List)
+	api.HandleFunc("GET /users/{user_id}/orders/{id}", orderHandler.Get)
+	api.Handle("/graphql", NewGraphQLHandler(reservations, history, catalog, orders, service.NewCampaignService(cache, db, "spring")))
+	api.HandleFunc("GET /stock/{item_id}/stream", NewStockHandler(service.NewStockService(cache, cache)).Stream)
+	api.HandleFunc("/partner/allocations", partnerHandler.Allocate)
+	api.HandleFunc("/partner/allocations/{id}/fulfill", partnerHandler.Fulfill)
+	api.HandleFunc("GET /undocumented", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return router, reached
+}
+
+func serve(h http.Handler, method, target, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	router, _ := newSpecRouter(t)
+
+	rec := serve(router, http.MethodGet, "/openapi.json", "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON document, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	if doc.OpenAPI != openapi.Version || doc.Paths["/purchase"] == nil || (*doc.Paths["/purchase"])["post"] == nil {
+		t.Fatalf("unexpected document: %s", rec.Body.String()[:200])
+	}
+
+	// Every reference must name a component
+	var refs []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				if ref, ok := child.(string); ok && k == "$ref" {
+					refs = append(refs, ref)
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var raw any
+	json.Unmarshal(rec.Body.Bytes(), &raw)
+	walk(raw)
+	if len(refs) == 0 {
+		t.Fatal("expected references to components")
+	}
+	for _, ref := range refs {
+		if doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")] == nil {
+			t.Errorf("dangling reference %s", ref)
+		}
+	}
+}
+
+func TestValidateAPI_Requests(t *testing.T) {
+	router, _ := newSpecRouter(t)
+
+	tests := []struct {
+		name, method, target, body string
+		code                       ErrorCode
+		fields                     []FieldError
+	}{
+		{"mistyped quantity", http.MethodPost, "/v1/purchase", `{"request_id":"r1","user_id":"u","item_id":"item-1","quantity":"2"}`,
+			CodeInvalidFields, []FieldError{{"quantity", "must be a number"}}},
+		{"missing user", http.MethodPost, "/v1/purchase", `{"request_id":"r1","item_id":"item-1","quantity":1}`,
+			CodeInvalidFields, []FieldError{{"user_id", "required"}}},
+		{"cart line", http.MethodPost, "/v1/purchase", `{"request_id":"r1","user_id":"u","items":[{"item_id":"item-1","quantity":1.5},{"item_id":7}]}`,
+			CodeInvalidFields, []FieldError{{"items[0].quantity", "must be an integer"}, {"items[1].item_id", "must be a string"}, {"items[1].quantity", "required"}}},
+		{"not JSON", http.MethodPost, "/v1/purchase", `{"request_id":`, CodeInvalidRequest, nil},
+		{"limit", http.MethodGet, "/v1/users/u/orders?limit=ten&from=yesterday", "",
+			CodeInvalidFields, []FieldError{{"from", "must be an RFC 3339 time"}, {"limit", "must be a number"}}},
+		{"partner quantity", http.MethodPost, "/v1/partner/allocations", `{"item_id":"item-1","quantity":-1e400}`,
+			CodeInvalidFields, []FieldError{{"quantity", "must be a number"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(router, tt.method, tt.target, tt.body, nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			got := decodeError(t, rec)
+			if got.Code != tt.code || len(got.Fields) != len(tt.fields) {
+				t.Fatalf("expected %s %v, got %+v", tt.code, tt.fields, got)
+			}
+			for i := range tt.fields {
+				if got.Fields[i] != tt.fields[i] {
+					t.Errorf("field %d: expected %v, got %v", i, tt.fields[i], got.Fields[i])
+				}
+			}
+		})
+	}
+
+	if rec := serve(router, http.MethodGet, "/v1/undocumented?limit=ten", "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("expected undocumented routes to pass through, got %d", rec.Code)
+	}
+	if rec := serve(router, http.MethodDelete, "/v1/purchase", "{", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected undocumented methods to reach the handler, got %d", rec.Code)
+	}
+}
+
+// TestAPISpec_MatchesHandlers sends a request to every documented
+// operation, failing if a response does not match the spec, so the spec
+// and the handlers cannot drift apart.
+func TestAPISpec_MatchesHandlers(t *testing.T) {
+	router, reached := newSpecRouter(t)
+
+	expect := func(rec *httptest.ResponseRecorder, status int) *httptest.ResponseRecorder {
+		t.Helper()
+		if rec.Code != status {
+			t.Errorf("expected %d, got %d: %s", status, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	rec := expect(serve(router, http.MethodPost, "/v1/purchase", `{"user_id":"user-2","item_id":"item-1","quantity":1}`,
+		map[string]string{"Idempotency-Key": "req-1"}), http.StatusOK)
+	var purchase PurchaseHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&purchase)
+	expect(serve(router, http.MethodPost, "/v1/purchase", `{"request_id":"req-2","user_id":"user-2","item_id":"missing","quantity":1}`, nil), http.StatusNotFound)
+	expect(serve(router, http.MethodGet, "/v1/purchase/req-1", "", nil), http.StatusOK)
+	expect(serve(router, http.MethodGet, "/v1/purchase/req-unknown", "", nil), http.StatusNotFound)
+	expect(serve(router, http.MethodPost, "/v1/token", `{"user_id":"user-2","item_id":"item-1"}`, nil), http.StatusOK)
+
+	expect(serve(router, http.MethodGet, "/v1/items", "", nil), http.StatusOK)
+	expect(serve(router, http.MethodGet, "/v1/items/item-1", "", nil), http.StatusOK)
+	expect(serve(router, http.MethodGet, "/v1/items/missing", "", nil), http.StatusNotFound)
+
+	streamCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stream := httptest.NewRecorder()
+	router.ServeHTTP(stream, httptest.NewRequest(http.MethodGet, "/v1/stock/item-1/stream", nil).WithContext(streamCtx))
+	expect(stream, http.StatusOK)
+
+	expect(serve(router, http.MethodPost, "/v1/orders/held/confirm", `{"user_id":"user-1"}`, nil), http.StatusOK)
+	expect(serve(router, http.MethodPost, "/v1/orders/held-2/cancel", `{"user_id":"user-1"}`, nil), http.StatusOK)
+	expect(serve(router, http.MethodPost, "/v1/orders/held/cancel", `{"user_id":"user-1"}`, nil), http.StatusConflict)
+	expect(serve(router, http.MethodGet, "/v1/users/user-1/orders?limit=1&status=pending", "", nil), http.StatusOK)
+	expect(serve(router, http.MethodGet, "/v1/users/user-1/orders?limit=500", "", nil), http.StatusBadRequest)
+	expect(serve(router, http.MethodGet, "/v1/users/user-1/orders/held", "", nil), http.StatusOK)
+	expect(serve(router, http.MethodGet, "/v1/users/user-2/orders/held", "", nil), http.StatusNotFound)
+
+	query := `{ item(id: "item-1") { name stock } order(id: "held", userId: "user-1") { id status } }`
+	expect(serve(router, http.MethodGet, "/v1/graphql?query="+url.QueryEscape(query), "", nil), http.StatusOK)
+	expect(serve(router, http.MethodPost, "/v1/graphql", `{"query":"{ nope }"}`, nil), http.StatusOK)
+
+	partner := map[string]string{apiKeyHeader: "partner-key"}
+	rec = expect(serve(router, http.MethodPost, "/v1/partner/allocations", `{"item_id":"item-1","quantity":2}`, partner), http.StatusCreated)
+	var alloc PartnerHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&alloc)
+	expect(serve(router, http.MethodPost, "/v1/partner/allocations/"+alloc.AllocationID+"/fulfill", `{"user_id":"user-3","quantity":1}`, partner), http.StatusOK)
+	expect(serve(router, http.MethodPost, "/v1/partner/allocations", `{"item_id":"item-1","quantity":2}`, nil), http.StatusUnauthorized)
+
+	for _, item := range APISpec().Paths {
+		for method, op := range *item {
+			if !reached[op.OperationID] {
+				t.Errorf("%s %s is not exercised", strings.ToUpper(method), op.OperationID)
+			}
+		}
+	}
+}
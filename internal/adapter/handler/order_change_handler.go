@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// OrderChangeHandler serves the change log of the event-sourced order
+// store. It does no authentication of its own and must be wrapped in
+// AdminAuth.
+type OrderChangeHandler struct {
+	changes *service.OrderChangeService
+}
+
+// OrderChangesHTTPResponse is an order's changes, oldest first, and the
+// order they derive, left out once it was archived.
+type OrderChangesHTTPResponse struct {
+	Changes []OrderChangeHTTP `json:"changes"`
+	Order   *OrderStateHTTP   `json:"order,omitempty"`
+}
+
+// OrderChangeLogHTTPResponse is one page of the change log. NextAfter is
+// passed as the after parameter to fetch the next page and is left out on
+// the last.
+type OrderChangeLogHTTPResponse struct {
+	Changes   []OrderChangeHTTP `json:"changes"`
+	NextAfter int64             `json:"next_after,omitempty"`
+}
+
+// OrderChangeHTTP is one change of an order. Order is the order as
+// accepted, on accepted changes.
+type OrderChangeHTTP struct {
+	Seq        int64           `json:"seq"`
+	OrderID    string          `json:"order_id"`
+	Type       string          `json:"type"`
+	Order      *OrderStateHTTP `json:"order,omitempty"`
+	PaymentID  string          `json:"payment_id,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// OrderStateHTTP is an order as its changes leave it.
+type OrderStateHTTP struct {
+	OrderHistoryItemHTTP
+	UserID    string    `json:"user_id"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewOrderChangeHandler(changes *service.OrderChangeService) *OrderChangeHandler {
+	return &OrderChangeHandler{changes: changes}
+}
+
+// Order handles GET /v1/admin/orders/{id}/changes.
+func (h *OrderChangeHandler) Order(w http.ResponseWriter, r *http.Request) {
+	history, err := h.changes.History(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := OrderChangesHTTPResponse{Changes: toOrderChangesHTTP(history.Changes)}
+	if history.Order != nil {
+		resp.Order = toOrderStateHTTP(*history.Order)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// List handles GET /v1/admin/order-changes, the changes of every order in
+// the order they were made. limit sets the page size and after continues
+// from a previous page.
+func (h *OrderChangeHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	verr := &ValidationError{}
+	var after int64
+	var limit int
+	if value := query.Get("after"); value != "" {
+		var err error
+		if after, err = strconv.ParseInt(value, 10, 64); err != nil || after < 0 {
+			verr.add("after", "must be a change sequence number")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			verr.add("limit", "must be a positive integer")
+		}
+	}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, "", verr)
+		return
+	}
+
+	page, err := h.changes.Page(r.Context(), after, limit)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, OrderChangeLogHTTPResponse{Changes: toOrderChangesHTTP(page.Changes), NextAfter: page.NextAfter})
+}
+
+func toOrderChangesHTTP(changes []domain.OrderChange) []OrderChangeHTTP {
+	resp := make([]OrderChangeHTTP, 0, len(changes))
+	for _, change := range changes {
+		item := OrderChangeHTTP{
+			Seq:        change.Seq,
+			OrderID:    change.OrderID,
+			Type:       string(change.Type),
+			PaymentID:  change.PaymentID,
+			OccurredAt: change.OccurredAt,
+		}
+		if change.Order != nil {
+			item.Order = toOrderStateHTTP(*change.Order)
+		}
+		resp = append(resp, item)
+	}
+	return resp
+}
+
+func toOrderStateHTTP(order domain.Order) *OrderStateHTTP {
+	return &OrderStateHTTP{
+		OrderHistoryItemHTTP: toOrderHistoryItemHTTP(order),
+		UserID:               order.UserID,
+		PaymentID:            order.PaymentID,
+		UpdatedAt:            order.UpdatedAt,
+	}
+}
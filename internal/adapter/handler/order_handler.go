@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// OrderHandler serves actions on placed orders.
+type OrderHandler struct {
+	reservations *service.ReservationService
+}
+
+type ConfirmOrderHTTPRequest struct {
+	UserID       string `json:"user_id"`
+	PaymentToken string `json:"payment_token,omitempty"`
+}
+
+type CancelOrderHTTPRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type OrderHTTPResponse struct {
+	Success   bool       `json:"success"`
+	Message   string     `json:"message"`
+	OrderID   string     `json:"order_id,omitempty"`
+	Status    string     `json:"status,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func NewOrderHandler(reservations *service.ReservationService) *OrderHandler {
+	return &OrderHandler{reservations: reservations}
+}
+
+// Get handles GET /v1/users/{user_id}/orders/{id}. Unlike the order
+// history, it reads the order from the primary store, so clients can poll
+// an order they just placed.
+func (h *OrderHandler) Get(w http.ResponseWriter, r *http.Request) {
+	order, err := h.reservations.Order(r.Context(), r.PathValue("id"), r.PathValue("user_id"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toOrderHistoryItemHTTP(*order))
+}
+
+// Confirm handles POST /v1/orders/{id}/confirm, finalizing a held order.
+func (h *OrderHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	var req ConfirmOrderHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, r, "", errUserIDRequired)
+		return
+	}
+
+	order, err := h.reservations.Confirm(r.Context(), r.PathValue("id"), req.UserID, req.PaymentToken)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toOrderHTTP(order, "order confirmed"))
+}
+
+// Cancel handles POST /v1/orders/{id}/cancel, cancelling a pending order
+// and returning its stock.
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	var req CancelOrderHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	if req.UserID == "" {
+		writeError(w, r, "", errUserIDRequired)
+		return
+	}
+
+	order, err := h.reservations.Cancel(r.Context(), r.PathValue("id"), req.UserID)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toOrderHTTP(order, "order cancelled"))
+}
+
+func toOrderHTTP(order *domain.Order, message string) OrderHTTPResponse {
+	resp := OrderHTTPResponse{
+		Success: true,
+		Message: message,
+		OrderID: order.ID,
+		Status:  string(order.Status),
+	}
+	if !order.ExpiresAt.IsZero() {
+		resp.ExpiresAt = &order.ExpiresAt
+	}
+	return resp
+}
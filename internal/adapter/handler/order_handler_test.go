@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/adapter/payment"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func TestOrderHandler_Confirm(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.NewCache()
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.CreateOrder(ctx, domain.Order{ID: "held", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending, ExpiresAt: time.Now().Add(time.Minute)})
+	db.CreateOrder(ctx, domain.Order{ID: "lapsed", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending, ExpiresAt: time.Now().Add(-time.Minute)})
+
+	reservations := service.NewReservationService(db, service.NewStockCompensator(cache, nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/orders/{id}/confirm", NewOrderHandler(reservations).Confirm)
+
+	confirm := func(id, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders/"+id+"/confirm", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := confirm("held", `{"user_id":"user-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp OrderHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Status != string(domain.OrderStatusConfirmed) || resp.ExpiresAt == nil {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	tests := []struct {
+		id, body string
+		want     int
+	}{
+		{"held", `{}`, http.StatusBadRequest},
+		{"held", `{"user_id":"user-2"}`, http.StatusNotFound},
+		{"lapsed", `{"user_id":"user-1"}`, http.StatusGone},
+	}
+	for _, tt := range tests {
+		if rec := confirm(tt.id, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.id, tt.body, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestOrderHandler_Get(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.CreateOrder(ctx, domain.Order{ID: "held", UserID: "user-1", ItemID: "item-1", Quantity: 2, TotalPrice: 2000, Currency: "USD", Status: domain.OrderStatusPending})
+
+	reservations := service.NewReservationService(db, service.NewStockCompensator(memory.NewCache(), nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/{user_id}/orders/{id}", NewOrderHandler(reservations).Get)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/users/user-1/orders/held")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp OrderHistoryItemHTTP
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.OrderID != "held" || resp.Status != string(domain.OrderStatusPending) || resp.Quantity != 2 || resp.TotalPrice != 2000 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	for _, path := range []string{"/api/users/user-2/orders/held", "/api/users/user-1/orders/missing"} {
+		if rec := get(path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestOrderHandler_ConfirmPayment(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.CreateOrder(ctx, domain.Order{ID: "held", UserID: "user-1", ItemID: "item-1", Quantity: 1, TotalPrice: 1000, Status: domain.OrderStatusPending, ExpiresAt: time.Now().Add(time.Minute)})
+
+	gateway := payment.NewMock()
+	reservations := service.NewReservationService(db, service.NewStockCompensator(memory.NewCache(), nil),
+		service.WithPaymentGateway(gateway))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/orders/{id}/confirm", NewOrderHandler(reservations).Confirm)
+
+	confirm := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders/held/confirm", strings.NewReader(body)))
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"user_id":"user-1"}`,
+		`{"user_id":"user-1","payment_token":"tok_decline_insufficient_funds"}`,
+	} {
+		if rec := confirm(body); rec.Code != http.StatusPaymentRequired {
+			t.Errorf("%s: expected 402, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := confirm(`{"user_id":"user-1","payment_token":"tok_visa"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	order, _ := db.GetOrder(ctx, "held")
+	if order.PaymentID == "" || gateway.Captured(order.PaymentID) != 1000 {
+		t.Errorf("expected 1000 captured for the order, got %+v", order)
+	}
+}
+
+func TestOrderHandler_Cancel(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.NewCache()
+	cache.SetStock(ctx, "item-1", 9)
+	cache.SetIdempotency(ctx, "idempotency:req-1", time.Minute)
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.CreateOrder(ctx, domain.Order{ID: "held", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending, IdempotencyKey: "idempotency:req-1"})
+	db.CreateOrder(ctx, domain.Order{ID: "paid", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusConfirmed})
+
+	orders := service.NewOrderService(cache, 10)
+	t.Cleanup(orders.Close)
+	reservations := service.NewReservationService(db, service.NewStockCompensator(cache, nil),
+		service.WithRebuyAfterCancel(orders))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/orders/{id}/cancel", NewOrderHandler(reservations).Cancel)
+
+	cancel := func(id, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/orders/"+id+"/cancel", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := cancel("held", `{"user_id":"user-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp OrderHTTPResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Status != string(domain.OrderStatusCancelled) {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if stock, _ := cache.GetStock(ctx, "item-1"); stock != 10 {
+		t.Errorf("expected Redis stock 10, got %d", stock)
+	}
+	if inv, _ := db.GetInventory(ctx, "item-1"); inv.Quantity != 9 {
+		t.Errorf("expected MySQL inventory 9, got %d", inv.Quantity)
+	}
+	if ok, _ := cache.SetIdempotency(ctx, "idempotency:req-1", time.Minute); !ok {
+		t.Error("expected the idempotency key released")
+	}
+
+	tests := []struct {
+		id, body string
+		want     int
+	}{
+		{"held", `{}`, http.StatusBadRequest},
+		{"held", `{"user_id":"user-2"}`, http.StatusNotFound},
+		{"paid", `{"user_id":"user-1"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := cancel(tt.id, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.id, tt.body, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestOrderHistoryHandler_List(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		db.CreateOrder(ctx, domain.Order{ID: id, UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusConfirmed,
+			CreatedAt: base.Add(time.Duration(i) * time.Hour)})
+	}
+	db.ProjectOrders(ctx, []string{"a", "b", "c"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/{user_id}/orders", NewOrderHistoryHandler(service.NewOrderHistoryService(db)).List)
+
+	list := func(query string) (*httptest.ResponseRecorder, OrderHistoryHTTPResponse) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users/user-1/orders?"+query, nil))
+		var resp OrderHistoryHTTPResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	rec, resp := list("limit=2")
+	if rec.Code != http.StatusOK || len(resp.Orders) != 2 || resp.Orders[0].OrderID != "c" || resp.NextCursor == "" {
+		t.Fatalf("unexpected first page: %d %+v", rec.Code, resp)
+	}
+	rec, resp = list("limit=2&cursor=" + resp.NextCursor)
+	if rec.Code != http.StatusOK || len(resp.Orders) != 1 || resp.Orders[0].OrderID != "a" || resp.NextCursor != "" {
+		t.Fatalf("unexpected last page: %d %+v", rec.Code, resp)
+	}
+	rec, resp = list("from=2026-01-01T01:00:00Z&to=2026-01-01T02:00:00Z")
+	if rec.Code != http.StatusOK || len(resp.Orders) != 1 || resp.Orders[0].OrderID != "b" {
+		t.Errorf("unexpected filtered page: %d %+v", rec.Code, resp)
+	}
+
+	for _, query := range []string{"limit=abc", "limit=101", "from=yesterday", "cursor=!!", "status=shipped"} {
+		if rec, _ := list(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestExportHandler_Orders(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.SetInventory("item-2", 10)
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, order := range []domain.Order{
+		{ID: "a", ItemID: "item-1"},
+		{ID: "b", ItemID: "item-2"},
+		{ID: "c", ItemID: "item-1", CouponCode: "SAVE"},
+	} {
+		order.UserID, order.Quantity, order.Status, order.UnitPrice, order.TotalPrice, order.Currency = "user-1", 1, domain.OrderStatusConfirmed, 500, 500, "USD"
+		order.CreatedAt, order.UpdatedAt = at, at
+		db.CreateOrder(ctx, order)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/admin/orders/export", NewExportHandler(service.NewOrderExporter(db, 2, 0)).Orders)
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/orders/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("item_id=item-1")
+	want := "id,user_id,item_id,quantity,status,unit_price,total_price,currency,coupon_code,discount,created_at,updated_at\n" +
+		"a,user-1,item-1,1,confirmed,500,500,USD,,0,2026-01-01T00:00:00Z,2026-01-01T00:00:00Z\n" +
+		"c,user-1,item-1,1,confirmed,500,500,USD,SAVE,0,2026-01-01T00:00:00Z,2026-01-01T00:00:00Z\n"
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv" || rec.Body.String() != want {
+		t.Fatalf("unexpected csv export: %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = export("format=ndjson")
+	var ids []string
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var line OrderExportHTTP
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("decode line: %v", err)
+		}
+		ids = append(ids, line.OrderID)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" || strings.Join(ids, " ") != "a b c" {
+		t.Errorf("unexpected ndjson export: %d %v", rec.Code, ids)
+	}
+
+	if rec := export("item_id=missing"); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("expected just the header for no orders, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := export("from=2026-01-01T00:00:01Z"); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("expected just the header for a window after every order, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := export("from=2025-12-31T00:00:00Z&to=2026-01-02T00:00:00Z"); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 4 {
+		t.Errorf("expected every order in the window, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := export("format=xml"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+	if rec := export("to=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad time, got %d", rec.Code)
+	}
+}
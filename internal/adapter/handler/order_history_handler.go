@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// OrderHistoryHandler serves a user's past orders for order history pages.
+type OrderHistoryHandler struct {
+	history *service.OrderHistoryService
+}
+
+// OrderHistoryHTTPResponse is one page of orders. NextCursor is passed as
+// the cursor parameter to fetch the next page and is left out on the last.
+type OrderHistoryHTTPResponse struct {
+	Orders     []OrderHistoryItemHTTP `json:"orders"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// OrderHistoryItemHTTP is an order as shown in its buyer's history. Prices
+// are in minor units of Currency.
+type OrderHistoryItemHTTP struct {
+	OrderID    string             `json:"order_id"`
+	Status     string             `json:"status"`
+	ItemID     string             `json:"item_id"`
+	Quantity   int                `json:"quantity"`
+	Items      []PurchaseLineHTTP `json:"items,omitempty"`
+	TotalPrice int64              `json:"total_price"`
+	Currency   string             `json:"currency"`
+	CouponCode string             `json:"coupon_code,omitempty"`
+	Discount   int64              `json:"discount,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty"`
+}
+
+func NewOrderHistoryHandler(history *service.OrderHistoryService) *OrderHistoryHandler {
+	return &OrderHistoryHandler{history: history}
+}
+
+// List handles GET /v1/users/{user_id}/orders. The optional status, from
+// and to parameters filter the orders, from and to as RFC 3339 times; limit
+// sets the page size and cursor continues from a previous page.
+func (h *OrderHistoryHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	page, err := h.history.List(r.Context(), r.PathValue("user_id"), filter)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := OrderHistoryHTTPResponse{Orders: make([]OrderHistoryItemHTTP, 0, len(page.Orders))}
+	for _, order := range page.Orders {
+		resp.Orders = append(resp.Orders, toOrderHistoryItemHTTP(order))
+	}
+	if page.Next != nil {
+		resp.NextCursor = encodeOrderCursor(*page.Next)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseOrderFilter reads the filter from the query, reporting every bad
+// parameter at once.
+func parseOrderFilter(r *http.Request) (domain.OrderFilter, error) {
+	query := r.URL.Query()
+	verr := &ValidationError{}
+	filter := domain.OrderFilter{Status: domain.OrderStatus(query.Get("status"))}
+
+	parseTime := func(name string) time.Time {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			verr.add(name, "must be an RFC 3339 time")
+		}
+		return t
+	}
+	filter.From = parseTime("from")
+	filter.To = parseTime("to")
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			verr.add("limit", "must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeOrderCursor(value)
+		if err != nil {
+			verr.add("cursor", "invalid cursor")
+		}
+		filter.After = cursor
+	}
+
+	if len(verr.Fields) > 0 {
+		return domain.OrderFilter{}, verr
+	}
+	return filter, nil
+}
+
+// Cursors are opaque to clients: the order's creation time in unix
+// nanoseconds and its ID, base64 encoded.
+func encodeOrderCursor(cursor domain.OrderCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(value string) (*domain.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.OrderCursor{CreatedAt: time.Unix(0, n), ID: id}, nil
+}
+
+func toOrderHistoryItemHTTP(order domain.Order) OrderHistoryItemHTTP {
+	item := OrderHistoryItemHTTP{
+		OrderID:    order.ID,
+		Status:     string(order.Status),
+		ItemID:     order.ItemID,
+		Quantity:   order.Quantity,
+		TotalPrice: order.TotalPrice,
+		Currency:   order.Currency,
+		CouponCode: order.CouponCode,
+		Discount:   order.Discount,
+		CreatedAt:  order.CreatedAt,
+	}
+	for _, line := range order.Items {
+		item.Items = append(item.Items, PurchaseLineHTTP{ItemID: line.ItemID, Quantity: line.Quantity})
+	}
+	if !order.ExpiresAt.IsZero() {
+		item.ExpiresAt = &order.ExpiresAt
+	}
+	return item
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// PartnerHandler serves the B2B allocation API. Partners authenticate with
+// a static API key that maps to their partner ID.
+type PartnerHandler struct {
+	allocationService *service.AllocationService
+	apiKeys           map[string]string
+}
+
+type AllocateHTTPRequest struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type FulfillHTTPRequest struct {
+	UserID   string `json:"user_id"`
+	Quantity int    `json:"quantity"`
+}
+
+type PartnerHTTPResponse struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message"`
+	AllocationID string `json:"allocation_id,omitempty"`
+	OrderID      string `json:"order_id,omitempty"`
+}
+
+// NewPartnerHandler creates a handler accepting the given API key to
+// partner ID mapping.
+func NewPartnerHandler(allocationService *service.AllocationService, apiKeys map[string]string) *PartnerHandler {
+	return &PartnerHandler{allocationService: allocationService, apiKeys: apiKeys}
+}
+
+// Allocate handles POST /v1/partner/allocations.
+func (h *PartnerHandler) Allocate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	partnerID, ok := h.authenticate(r)
+	if !ok {
+		writeError(w, r, "", errUnauthorized)
+		return
+	}
+
+	var req AllocateHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	if req.ItemID == "" || req.Quantity <= 0 {
+		writeError(w, r, "", errMissingFields)
+		return
+	}
+
+	alloc, err := h.allocationService.Allocate(r.Context(), partnerID, req.ItemID, req.Quantity)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, PartnerHTTPResponse{
+		Success:      true,
+		Message:      "allocation created",
+		AllocationID: alloc.ID,
+	})
+}
+
+// Fulfill handles POST /v1/partner/allocations/{id}/fulfill.
+func (h *PartnerHandler) Fulfill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	partnerID, ok := h.authenticate(r)
+	if !ok {
+		writeError(w, r, "", errUnauthorized)
+		return
+	}
+
+	var req FulfillHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	if req.UserID == "" || req.Quantity <= 0 {
+		writeError(w, r, "", errMissingFields)
+		return
+	}
+
+	allocationID := r.PathValue("id")
+	orderID, err := h.allocationService.Fulfill(r.Context(), partnerID, allocationID, req.UserID, req.Quantity)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PartnerHTTPResponse{
+		Success:      true,
+		Message:      "order fulfilled",
+		AllocationID: allocationID,
+		OrderID:      orderID,
+	})
+}
+
+func (h *PartnerHandler) authenticate(r *http.Request) (string, bool) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return "", false
+	}
+	partnerID, ok := h.apiKeys[key]
+	return partnerID, ok
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// maxLimitedBody bounds how much of a request body is read to find its user.
+const maxLimitedBody = 64 << 10
+
+// RateLimits throttles purchases per user and per client IP. Either limiter
+// may be nil to skip that check. When a limiter fails the request is let
+// through rather than turning a Redis outage into an outage of the sale.
+type RateLimits struct {
+	Users port.RateLimiter
+	IPs   port.RateLimiter
+
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For
+	// entry, the one added by the proxy in front of the server. Only enable
+	// it behind a proxy, as clients can set the header themselves.
+	TrustForwardedFor bool
+}
+
+// check returns how long the caller must wait, or 0 if it may proceed.
+func (l RateLimits) check(ctx context.Context, ip, userID string) time.Duration {
+	if l.IPs != nil && ip != "" {
+		if wait := allow(ctx, l.IPs, ip); wait > 0 {
+			return wait
+		}
+	}
+	if l.Users != nil && userID != "" {
+		return allow(ctx, l.Users, userID)
+	}
+	return 0
+}
+
+func allow(ctx context.Context, limiter port.RateLimiter, key string) time.Duration {
+	allowed, retryAfter, err := limiter.Allow(ctx, key)
+	if err != nil {
+		log.Printf("rate limiter error: %v", err)
+		return 0
+	}
+	if allowed {
+		return 0
+	}
+	// Never report zero, which would read as "allowed"
+	return max(retryAfter, time.Millisecond)
+}
+
+// RateLimit rejects requests over the per-IP or per-user limit with 429 Too
+// Many Requests and a Retry-After header. The user is read from the user_id
+// field of a JSON body.
+func RateLimit(limits RateLimits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userID string
+		if limits.Users != nil && r.Body != nil {
+			userID = peekUserID(r)
+		}
+
+		wait := limits.check(r.Context(), limits.clientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For")), userID)
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+			writeError(w, r, "", errRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peekUserID reads the user ID from the request body and puts the body back
+// for the handler.
+func peekUserID(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLimitedBody))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	json.Unmarshal(body, &req)
+	return req.UserID
+}
+
+// clientIP returns the IP a request came from, given the peer address and
+// the X-Forwarded-For value.
+func (l RateLimits) clientIP(remoteAddr, forwardedFor string) string {
+	return clientIP(remoteAddr, forwardedFor, l.TrustForwardedFor)
+}
+
+// clientIP returns the IP a request came from: the last X-Forwarded-For
+// entry if trustForwardedFor is set, otherwise the peer address.
+func clientIP(remoteAddr, forwardedFor string, trustForwardedFor bool) string {
+	if trustForwardedFor && forwardedFor != "" {
+		entries := strings.Split(forwardedFor, ",")
+		if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, as Retry-After has no
+// finer resolution.
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	var body string
+	h := RateLimit(RateLimits{Users: denyUser("user-1"), IPs: denyUser("10.0.0.9"), TrustForwardedFor: true},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	tests := []struct {
+		name      string
+		user      string
+		forwarded string
+		want      int
+	}{
+		{"allowed", "user-2", "", http.StatusOK},
+		{"limited user", "user-1", "", http.StatusTooManyRequests},
+		{"limited ip", "user-2", "203.0.113.7, 10.0.0.9", http.StatusTooManyRequests},
+		{"spoofed first hop", "user-2", "10.0.0.9, 203.0.113.7", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := `{"request_id":"r","user_id":"` + tt.user + `","item_id":"i","quantity":1}`
+			req := httptest.NewRequest(http.MethodPost, "/api/purchase", strings.NewReader(payload))
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if tt.want == http.StatusTooManyRequests {
+				if got := rec.Header().Get("Retry-After"); got != "2" {
+					t.Errorf("expected Retry-After 2, got %q", got)
+				}
+			} else if body != payload {
+				t.Errorf("handler got body %q", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// RefundHandler serves refunds of confirmed orders. It does no
+// authentication of its own and must be wrapped in AdminAuth.
+type RefundHandler struct {
+	refunds *service.RefundService
+}
+
+type RefundHTTPRequest struct {
+	Reason string `json:"reason"`
+}
+
+type RefundHTTPResponse struct {
+	ID        string    `json:"id"`
+	OrderID   string    `json:"order_id"`
+	Amount    int64     `json:"amount"`
+	Reason    string    `json:"reason"`
+	Step      string    `json:"step"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewRefundHandler(refunds *service.RefundService) *RefundHandler {
+	return &RefundHandler{refunds: refunds}
+}
+
+// Refund handles POST /v1/admin/orders/{id}/refund. It answers 200 once the
+// refund is done and 202 if a step failed and will be retried.
+func (h *RefundHandler) Refund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	// The body is optional
+	var req RefundHTTPRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, "", err)
+		return
+	}
+
+	refund, err := h.refunds.Refund(r.Context(), r.PathValue("id"), req.Reason)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	status := http.StatusOK
+	if refund.Step != domain.RefundStepDone {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, RefundHTTPResponse{
+		ID:        refund.ID,
+		OrderID:   refund.OrderID,
+		Amount:    refund.Amount,
+		Reason:    refund.Reason,
+		Step:      string(refund.Step),
+		Attempts:  refund.Attempts,
+		LastError: refund.LastError,
+		CreatedAt: refund.CreatedAt,
+		UpdatedAt: refund.UpdatedAt,
+	})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// RegionHandler serves the stock of items split between regions. It does
+// no authentication of its own and must be wrapped in AdminAuth.
+type RegionHandler struct {
+	regions *service.RegionalStock
+	audit   *service.AuditService
+}
+
+type RegionStockHTTP struct {
+	Region string `json:"region"`
+	Stock  int    `json:"stock"`
+}
+
+// RegionStocksHTTP is an item's unsold stock in each region.
+type RegionStocksHTTP struct {
+	ItemID  string            `json:"item_id"`
+	Regions []RegionStockHTTP `json:"regions"`
+}
+
+// RebalanceHTTPRequest moves Quantity unsold units from one region to
+// another.
+type RebalanceHTTPRequest struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Quantity int    `json:"quantity"`
+}
+
+type RebalanceHTTPResponse struct {
+	ItemID       string            `json:"item_id"`
+	From         string            `json:"from"`
+	To           string            `json:"to"`
+	Quantity     int               `json:"quantity"`
+	Regions      []RegionStockHTTP `json:"regions"`
+	RebalancedAt time.Time         `json:"rebalanced_at"`
+}
+
+func NewRegionHandler(regions *service.RegionalStock, audit *service.AuditService) *RegionHandler {
+	return &RegionHandler{regions: regions, audit: audit}
+}
+
+// Regions handles GET /v1/admin/items/{id}/regions.
+func (h *RegionHandler) Regions(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("id")
+	stocks, err := h.regions.Stock(r.Context(), itemID)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RegionStocksHTTP{ItemID: itemID, Regions: toRegionStocksHTTP(stocks)})
+}
+
+// Rebalance handles POST /v1/admin/items/{id}/rebalance.
+func (h *RegionHandler) Rebalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	var req RebalanceHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	rebalance, err := h.regions.Rebalance(r.Context(), r.PathValue("id"), req.From, req.To, req.Quantity)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	resp := RebalanceHTTPResponse{
+		ItemID:       rebalance.ItemID,
+		From:         rebalance.From,
+		To:           rebalance.To,
+		Quantity:     rebalance.Quantity,
+		Regions:      toRegionStocksHTTP(rebalance.Regions),
+		RebalancedAt: rebalance.RebalancedAt,
+	}
+	recordAudit(r, h.audit, domain.AuditStockRebalance, rebalance.ItemID, nil, resp, auditReason(r))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func toRegionStocksHTTP(stocks []domain.RegionStock) []RegionStockHTTP {
+	resp := make([]RegionStockHTTP, len(stocks))
+	for i, stock := range stocks {
+		resp[i] = RegionStockHTTP{Region: stock.Region, Stock: stock.Stock}
+	}
+	return resp
+}
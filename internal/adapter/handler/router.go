@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler, for example to authenticate or rate limit it.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middleware, the first being the outermost.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Router registers routes under a path prefix, wrapped in the middleware of
+// the router and its parents. Patterns follow http.ServeMux, with an
+// optional method and {name} path parameters read with r.PathValue.
+type Router struct {
+	mux        *http.ServeMux
+	prefix     string
+	middleware []Middleware
+}
+
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Group returns a router for routes under prefix that share middleware.
+// Groups register on the same mux as their parent.
+func (rt *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		mux:        rt.mux,
+		prefix:     rt.prefix + prefix,
+		middleware: append(append([]Middleware(nil), rt.middleware...), middleware...),
+	}
+}
+
+// Handle registers h for pattern, inside the router's middleware and then
+// the route's own.
+func (rt *Router) Handle(pattern string, h http.Handler, middleware ...Middleware) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if ok {
+		pattern = method + " " + rt.prefix + strings.TrimSpace(path)
+	} else {
+		pattern = rt.prefix + pattern
+	}
+	rt.mux.Handle(pattern, Chain(h, append(append([]Middleware(nil), rt.middleware...), middleware...)...))
+}
+
+// HandleFunc registers fn for pattern, see Handle.
+func (rt *Router) HandleFunc(pattern string, fn http.HandlerFunc, middleware ...Middleware) {
+	rt.Handle(pattern, fn, middleware...)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Deprecated marks routes kept for clients of an older API version. The
+// Link header points to the same route under successor.
+func Deprecated(prefix, successor string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if path, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+				w.Header().Set("Link", "<"+successor+path+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
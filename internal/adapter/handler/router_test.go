@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag appends name to the X-Trace header, recording middleware order.
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	v1 := router.Group("/v1", tag("v1"))
+	admin := v1.Group("/admin", tag("admin"))
+
+	admin.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	}, tag("route"))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/admin/items/item-1", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "item-1" {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := strings.Join(rec.Header().Values("X-Trace"), ","); got != "v1,admin,route" {
+		t.Errorf("expected middleware v1,admin,route, got %s", got)
+	}
+
+	// Methods and prefixes are part of the route
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/v1/admin/items/item-1", nil),
+		httptest.NewRequest(http.MethodGet, "/admin/items/item-1", nil),
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code == http.StatusOK {
+			t.Errorf("%s %s: expected no route", req.Method, req.URL.Path)
+		}
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	router := NewRouter()
+	router.Group("/api", Deprecated("/api", "/v1")).HandleFunc("/purchase", func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/purchase", nil))
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("expected Deprecation header")
+	}
+	if got := rec.Header().Get("Link"); got != `</v1/purchase>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// StatsHandler serves the live statistics of a sale to operators.
+type StatsHandler struct {
+	stats *service.SaleStatsService
+}
+
+// SaleStatsHTTP is how a campaign's sale is going. Failures counts the
+// purchases turned away and the orders that could not be saved, by outcome.
+// TimeToSelloutSeconds is set once every item of the campaign sold out.
+// Items totals the saved orders of the campaign's items by status.
+type SaleStatsHTTP struct {
+	CampaignID           string                `json:"campaign_id"`
+	OrdersPerSecond      float64               `json:"orders_per_second"`
+	Orders               int64                 `json:"orders"`
+	SoldUnits            int64                 `json:"sold_units"`
+	Failures             map[string]int64      `json:"failures"`
+	QueueDepth           int64                 `json:"queue_depth"`
+	StartedAt            *time.Time            `json:"started_at,omitempty"`
+	SoldOut              map[string]time.Time  `json:"sold_out"`
+	TimeToSelloutSeconds *float64              `json:"time_to_sellout_seconds,omitempty"`
+	Items                []ItemOrderTotalsHTTP `json:"items,omitempty"`
+}
+
+// ItemOrderTotalsHTTP counts the orders of one item in one status. Revenue
+// is in minor units of the item's currency.
+type ItemOrderTotalsHTTP struct {
+	ItemID  string `json:"item_id"`
+	Status  string `json:"status"`
+	Orders  int64  `json:"orders"`
+	Units   int64  `json:"units"`
+	Revenue int64  `json:"revenue"`
+}
+
+func NewStatsHandler(stats *service.SaleStatsService) *StatsHandler {
+	return &StatsHandler{stats: stats}
+}
+
+// Campaign handles GET /v1/admin/stats/{campaign}.
+func (h *StatsHandler) Campaign(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.stats.Stats(r.Context(), r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSaleStatsHTTP(stats))
+}
+
+func toSaleStatsHTTP(stats *domain.SaleStats) SaleStatsHTTP {
+	resp := SaleStatsHTTP{
+		CampaignID:      stats.CampaignID,
+		OrdersPerSecond: stats.OrdersPerSecond,
+		Orders:          stats.Orders,
+		SoldUnits:       stats.SoldUnits,
+		Failures:        stats.Failures,
+		QueueDepth:      stats.QueueDepth,
+		SoldOut:         stats.SoldOutAt,
+	}
+	if !stats.StartedAt.IsZero() {
+		resp.StartedAt = &stats.StartedAt
+	}
+	if stats.SoldOut {
+		seconds := stats.TimeToSellout.Seconds()
+		resp.TimeToSelloutSeconds = &seconds
+	}
+	for _, t := range stats.Items {
+		resp.Items = append(resp.Items, ItemOrderTotalsHTTP{ItemID: t.ItemID, Status: string(t.Status), Orders: t.Orders, Units: t.Units, Revenue: t.Revenue})
+	}
+	return resp
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// sseKeepAlive is how often an idle stream sends a comment so proxies do
+// not close it.
+const sseKeepAlive = 15 * time.Second
+
+type StockHandler struct {
+	stockService *service.StockService
+}
+
+type StockLevelHTTPResponse struct {
+	ItemID    string `json:"item_id"`
+	Remaining int    `json:"remaining"`
+}
+
+func NewStockHandler(stockService *service.StockService) *StockHandler {
+	return &StockHandler{stockService: stockService}
+}
+
+// Stream serves GET /v1/stock/{item_id}/stream as server-sent events: a
+// "stock" event with the current level, then one per change.
+func (h *StockHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	itemID := r.PathValue("item_id")
+
+	levels, err := h.stockService.Watch(r.Context(), itemID)
+	if err != nil {
+		log.Printf("watch stock %s: %v", itemID, err)
+		writeError(w, r, "", errStockUnavailable)
+		return
+	}
+
+	// The stream outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case level, ok := <-levels:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(StockLevelHTTPResponse{ItemID: itemID, Remaining: max(level, 0)})
+			if _, err := fmt.Fprintf(w, "event: stock\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func TestStockHandler_Stream(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.NewCache()
+	cache.SetStock(ctx, "item-1", 5)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/stock/{item_id}/stream", NewStockHandler(service.NewStockService(cache, cache)).Stream)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/stock/item-1/stream")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	events := bufio.NewScanner(resp.Body)
+	nextData := func() string {
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				return data
+			}
+		}
+		t.Fatalf("stream ended: %v", events.Err())
+		return ""
+	}
+
+	if got := nextData(); got != `{"item_id":"item-1","remaining":5}` {
+		t.Errorf("unexpected initial event %s", got)
+	}
+	cache.DecrementStock(ctx, "item-1", 2)
+	if got := nextData(); got != `{"item_id":"item-1","remaining":3}` {
+		t.Errorf("unexpected update event %s", got)
+	}
+}
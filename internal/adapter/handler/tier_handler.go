@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// TierHandler serves user tier management. It does no authentication of its
+// own and must be wrapped in AdminAuth.
+type TierHandler struct {
+	tiers *service.TierService
+	audit *service.AuditService
+}
+
+// UserTierHTTP is a user's tier.
+type UserTierHTTP struct {
+	UserID string          `json:"user_id"`
+	Tier   domain.UserTier `json:"tier"`
+}
+
+func NewTierHandler(tiers *service.TierService, audit *service.AuditService) *TierHandler {
+	return &TierHandler{tiers: tiers, audit: audit}
+}
+
+// Tiers handles GET /v1/admin/tiers, listing the users who are not normal
+// by user ID.
+func (h *TierHandler) Tiers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	tiers := h.tiers.Tiers()
+	resp := make([]UserTierHTTP, 0, len(tiers))
+	for userID, tier := range tiers {
+		resp = append(resp, UserTierHTTP{UserID: userID, Tier: tier})
+	}
+	slices.SortFunc(resp, func(a, b UserTierHTTP) int { return strings.Compare(a.UserID, b.UserID) })
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Tier handles GET and PUT /v1/admin/tiers/{user_id}.
+func (h *TierHandler) Tier(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("user_id")
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, UserTierHTTP{UserID: userID, Tier: h.tiers.Tier(userID)})
+
+	case http.MethodPut:
+		var req UserTierHTTP
+		if err := decodeJSON(r, &req); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		before := UserTierHTTP{UserID: userID, Tier: h.tiers.Tier(userID)}
+		if err := h.tiers.SetTier(r.Context(), userID, req.Tier); err != nil {
+			writeError(w, r, "", err)
+			return
+		}
+		resp := UserTierHTTP{UserID: userID, Tier: req.Tier}
+		recordAudit(r, h.audit, domain.AuditTierSet, userID, before, resp, auditReason(r))
+		writeJSON(w, http.StatusOK, resp)
+
+	default:
+		writeError(w, r, "", errMethodNotAllowed)
+	}
+}
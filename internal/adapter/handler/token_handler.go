@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// TokenHandler issues purchase tokens.
+type TokenHandler struct {
+	tokens *service.PurchaseTokens
+}
+
+// TokenHTTPRequest asks for a token for the user to buy the item.
+type TokenHTTPRequest struct {
+	UserID string `json:"user_id"`
+	ItemID string `json:"item_id"`
+}
+
+// TokenHTTPResponse is a token to send as purchase_token before it expires.
+type TokenHTTPResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewTokenHandler(tokens *service.PurchaseTokens) *TokenHandler {
+	return &TokenHandler{tokens: tokens}
+}
+
+// Issue handles POST /v1/token.
+func (h *TokenHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, "", errMethodNotAllowed)
+		return
+	}
+
+	var req TokenHTTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+
+	verr := &ValidationError{}
+	if req.UserID == "" {
+		verr.add("user_id", "required")
+	}
+	switch {
+	case req.ItemID == "":
+		verr.add("item_id", "required")
+	case !domain.ValidItemID(req.ItemID):
+		verr.add("item_id", "invalid format")
+	}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, "", verr)
+		return
+	}
+
+	token, expiresAt, err := h.tokens.Issue(req.UserID, req.ItemID)
+	if err != nil {
+		writeError(w, r, "", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, TokenHTTPResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+// purchasedItems lists the items of a purchase of one item or of lines.
+func purchasedItems(itemID string, lines []domain.OrderItem) []string {
+	if lines == nil {
+		return []string{itemID}
+	}
+	items := make([]string, len(lines))
+	for i, line := range lines {
+		items[i] = line.ItemID
+	}
+	return items
+}
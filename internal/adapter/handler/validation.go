@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// FieldError reports why one request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rejected field of a request, so clients can
+// fix them all at once.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return errValidation
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// PurchaseValidator checks purchase requests before they reach the order
+// service. It is shared by the HTTP and gRPC handlers so both reject the
+// same requests.
+type PurchaseValidator struct {
+	maxQuantity    int
+	itemLimits     map[string]int
+	uuidRequestIDs bool
+}
+
+type PurchaseValidatorOption func(*PurchaseValidator)
+
+// WithMaxQuantity caps the units a single purchase may buy. Zero leaves
+// quantities uncapped.
+func WithMaxQuantity(n int) PurchaseValidatorOption {
+	return func(v *PurchaseValidator) {
+		v.maxQuantity = n
+	}
+}
+
+// WithItemQuantityLimits caps the units per purchase of individual items,
+// overriding WithMaxQuantity for them.
+func WithItemQuantityLimits(limits map[string]int) PurchaseValidatorOption {
+	return func(v *PurchaseValidator) {
+		v.itemLimits = limits
+	}
+}
+
+// WithUUIDRequestIDs only accepts request IDs that are UUIDs.
+func WithUUIDRequestIDs() PurchaseValidatorOption {
+	return func(v *PurchaseValidator) {
+		v.uuidRequestIDs = true
+	}
+}
+
+func NewPurchaseValidator(opts ...PurchaseValidatorOption) *PurchaseValidator {
+	v := &PurchaseValidator{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Validate returns a *ValidationError naming every invalid field, or nil.
+func (v *PurchaseValidator) Validate(requestID, userID, itemID string, quantity int) error {
+	verr := &ValidationError{}
+	v.validateBuyer(verr, requestID, userID)
+	v.validateLine(verr, "", itemID, quantity)
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// ValidateCart is Validate for a multi-item purchase. Fields of a line are
+// named after its index, as in items[1].quantity, and an item may only
+// appear once.
+func (v *PurchaseValidator) ValidateCart(requestID, userID string, lines []domain.OrderItem) error {
+	verr := &ValidationError{}
+	v.validateBuyer(verr, requestID, userID)
+
+	if len(lines) == 0 {
+		verr.add("items", "required")
+	}
+	seen := make(map[string]bool, len(lines))
+	for i, line := range lines {
+		prefix := fmt.Sprintf("items[%d].", i)
+		if seen[line.ItemID] {
+			verr.add(prefix+"item_id", "duplicate item")
+			continue
+		}
+		seen[line.ItemID] = true
+		v.validateLine(verr, prefix, line.ItemID, line.Quantity)
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// ValidatePurchase checks a purchase request as the handlers receive it: a
+// single item, or a cart of lines, which then must not also name an item,
+// and an optional coupon code.
+func (v *PurchaseValidator) ValidatePurchase(requestID, userID, itemID string, quantity int, lines []domain.OrderItem, couponCode string) error {
+	var err error
+	if lines == nil {
+		err = v.Validate(requestID, userID, itemID, quantity)
+	} else {
+		err = v.ValidateCart(requestID, userID, lines)
+	}
+
+	verr := &ValidationError{}
+	errors.As(err, &verr)
+	if lines != nil && (itemID != "" || quantity != 0) {
+		verr.add("items", "cannot be combined with item_id and quantity")
+	}
+	if couponCode != "" && !domain.ValidCouponCode(couponCode) {
+		verr.add("coupon_code", "invalid format")
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func (v *PurchaseValidator) validateBuyer(verr *ValidationError, requestID, userID string) {
+	switch {
+	case requestID == "":
+		verr.add("request_id", "required")
+	case v.uuidRequestIDs && uuid.Validate(requestID) != nil:
+		verr.add("request_id", "must be a UUID")
+	}
+
+	if userID == "" {
+		verr.add("user_id", "required")
+	}
+}
+
+func (v *PurchaseValidator) validateLine(verr *ValidationError, prefix, itemID string, quantity int) {
+	switch {
+	case itemID == "":
+		verr.add(prefix+"item_id", "required")
+	case !domain.ValidItemID(itemID):
+		verr.add(prefix+"item_id", "invalid format")
+	}
+
+	switch limit := v.QuantityLimit(itemID); {
+	case quantity <= 0:
+		verr.add(prefix+"quantity", "must be positive")
+	case limit > 0 && quantity > limit:
+		verr.add(prefix+"quantity", fmt.Sprintf("must be at most %d", limit))
+	}
+}
+
+// QuantityLimit returns the most units one purchase of the item may buy,
+// or 0 if there is no limit.
+func (v *PurchaseValidator) QuantityLimit(itemID string) int {
+	if limit, ok := v.itemLimits[itemID]; ok {
+		return limit
+	}
+	return v.maxQuantity
+}
+
+// LimitBody rejects request bodies larger than n bytes. Handlers see the
+// limit as errBodyTooLarge from decodeJSON.
+func LimitBody(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decodeJSON decodes the request body into v, returning errBodyTooLarge or
+// errInvalidBody on failure. Unknown fields are ignored.
+func decodeJSON(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errBodyTooLarge
+	}
+	return fmt.Errorf("%w: %w", errInvalidBody, err)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPurchaseValidator(t *testing.T) {
+	v := NewPurchaseValidator(
+		WithMaxQuantity(5),
+		WithItemQuantityLimits(map[string]int{"iphone-15": 2}),
+		WithUUIDRequestIDs(),
+	)
+	id := uuid.NewString()
+
+	tests := []struct {
+		name      string
+		requestID string
+		userID    string
+		itemID    string
+		quantity  int
+		fields    []string
+	}{
+		{"valid", id, "user-1", "ipad", 5, nil},
+		{"item limit", id, "user-1", "iphone-15", 3, []string{"quantity"}},
+		{"global limit", id, "user-1", "ipad", 6, []string{"quantity"}},
+		{"not a uuid", "req-1", "user-1", "ipad", 1, []string{"request_id"}},
+		{"item format", id, "user-1", "{ipad}", 1, []string{"item_id"}},
+		{"all missing", "", "", "", 0, []string{"request_id", "user_id", "item_id", "quantity"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate(tt.requestID, tt.userID, tt.itemID, tt.quantity)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			var fields []string
+			for _, f := range verr.Fields {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("expected fields %v, got %v", tt.fields, verr.Fields)
+			}
+		})
+	}
+}
+
+func TestPurchase_FieldErrors(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+
+	rec := doPurchase(h, `{"request_id":"req-1","item_id":"item-1","quantity":-1}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	got := decodeError(t, rec)
+	if got.Code != CodeInvalidFields || len(got.Fields) != 2 {
+		t.Fatalf("unexpected error: %+v", got)
+	}
+	if got.Fields[0] != (FieldError{Field: "user_id", Message: "required"}) ||
+		got.Fields[1] != (FieldError{Field: "quantity", Message: "must be positive"}) {
+		t.Errorf("unexpected fields: %+v", got.Fields)
+	}
+}
+
+func TestPurchase_CartFieldErrors(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","items":[{"item_id":"item-1","quantity":1},{"item_id":"item-2"},{"item_id":"item-1","quantity":1}]}`, nil)
+	got := decodeError(t, rec)
+	if rec.Code != http.StatusBadRequest || got.Code != CodeInvalidFields || len(got.Fields) != 2 {
+		t.Fatalf("unexpected error: %d %+v", rec.Code, got)
+	}
+	if got.Fields[0] != (FieldError{Field: "items[1].quantity", Message: "must be positive"}) ||
+		got.Fields[1] != (FieldError{Field: "items[2].item_id", Message: "duplicate item"}) {
+		t.Errorf("unexpected fields: %+v", got.Fields)
+	}
+
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","items":[{"item_id":"item-2","quantity":1}]}`, nil)
+	if got := decodeError(t, rec); len(got.Fields) != 1 || got.Fields[0].Field != "items" {
+		t.Errorf("expected items combined with item_id to be rejected, got %+v", got)
+	}
+}
+
+func TestPurchase_CouponCodeFormat(t *testing.T) {
+	h := newTestHTTPHandler(t, newFakeCache(10))
+
+	rec := doPurchase(h, `{"request_id":"req-1","user_id":"user-1","item_id":"item-1","quantity":1,"coupon_code":"10% off"}`, nil)
+	got := decodeError(t, rec)
+	if rec.Code != http.StatusBadRequest || len(got.Fields) != 1 || got.Fields[0].Field != "coupon_code" {
+		t.Errorf("expected coupon_code rejected, got %d %+v", rec.Code, got)
+	}
+
+	// Without coupons enabled a well-formed code does not apply
+	rec = doPurchase(h, `{"request_id":"req-2","user_id":"user-1","item_id":"item-1","quantity":1,"coupon_code":"TEN"}`, nil)
+	if got := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || got.Code != CodeCouponRejected {
+		t.Errorf("expected 422 coupon_rejected, got %d %+v", rec.Code, got)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	h := Chain(http.HandlerFunc(newTestHTTPHandler(t, newFakeCache(10)).Purchase), LimitBody(64))
+
+	body := `{"request_id":"req-1","user_id":"` + strings.Repeat("u", 64) + `","item_id":"item-1","quantity":1}`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/purchase", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := decodeError(t, rec); got.Code != CodeBodyTooLarge {
+		t.Errorf("unexpected error: %+v", got)
+	}
+}
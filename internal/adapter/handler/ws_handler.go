@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// maxWSSubscriptions bounds the results one connection can wait on at once.
+const maxWSSubscriptions = 32
+
+// NotificationHandler pushes order results to clients over WebSocket.
+type NotificationHandler struct {
+	results *service.OrderResultService
+}
+
+// WSClientMessage subscribes the connection to a request's result.
+type WSClientMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id"`
+}
+
+// WSServerMessage is either a "result" or an "error" for a subscription.
+type WSServerMessage struct {
+	Type      string                `json:"type"`
+	RequestID string                `json:"request_id"`
+	OrderID   string                `json:"order_id,omitempty"`
+	Status    domain.PurchaseStatus `json:"status,omitempty"`
+	Message   string                `json:"message,omitempty"`
+}
+
+func NewNotificationHandler(results *service.OrderResultService) *NotificationHandler {
+	return &NotificationHandler{results: results}
+}
+
+// ServeWS handles /ws. Clients send {"type":"subscribe","request_id":...}
+// and receive one message per subscription once its result is final.
+func (h *NotificationHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	slots := make(chan struct{}, maxWSSubscriptions)
+	for {
+		var msg WSClientMessage
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			return
+		}
+		if msg.Type != "subscribe" || msg.RequestID == "" {
+			wsjson.Write(ctx, conn, WSServerMessage{Type: "error", RequestID: msg.RequestID, Message: "expected subscribe with request_id"})
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			wsjson.Write(ctx, conn, WSServerMessage{Type: "error", RequestID: msg.RequestID, Message: "too many subscriptions"})
+			continue
+		}
+
+		wg.Add(1)
+		go func(requestID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			h.awaitResult(ctx, conn, requestID)
+		}(msg.RequestID)
+	}
+}
+
+func (h *NotificationHandler) awaitResult(ctx context.Context, conn *websocket.Conn, requestID string) {
+	result, err := h.results.Await(ctx, requestID)
+	switch {
+	case err == nil:
+		wsjson.Write(ctx, conn, WSServerMessage{
+			Type:      "result",
+			RequestID: requestID,
+			OrderID:   result.OrderID,
+			Status:    result.Status,
+		})
+	case errors.Is(err, service.ErrPurchaseNotFound):
+		wsjson.Write(ctx, conn, WSServerMessage{Type: "error", RequestID: requestID, Message: "purchase not found"})
+	case ctx.Err() != nil:
+	default:
+		log.Printf("await result of %s: %v", requestID, err)
+		wsjson.Write(ctx, conn, WSServerMessage{Type: "error", RequestID: requestID, Message: "internal error"})
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func TestNotificationHandler_PushesResult(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cache := memory.NewCache()
+	cache.SetStock(ctx, "item-1", 1)
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", 1)
+
+	orders := service.NewOrderService(cache, 10, service.WithOrderResults(cache))
+	tuning, _ := service.NewWorkerTuning(service.DefaultWorkerSettings())
+	worker := service.NewOrderWorker(0, orders.GetOrderQueue(), db, cache, tuning, service.WithWorkerResults(cache))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws", NewNotificationHandler(service.NewOrderResultService(orders, db, cache)).ServeWS)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.CloseNow()
+
+	orderID, err := orders.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	if err != nil {
+		t.Fatalf("purchase failed: %v", err)
+	}
+
+	wsjson.Write(ctx, conn, WSClientMessage{Type: "subscribe", RequestID: "req-unknown"})
+	var msg WSServerMessage
+	if err := wsjson.Read(ctx, conn, &msg); err != nil || msg.Type != "error" || msg.RequestID != "req-unknown" {
+		t.Fatalf("expected error for unknown request, got %+v, %v", msg, err)
+	}
+
+	// The result arrives whether the order is persisted before or after
+	// the subscription is in place
+	wsjson.Write(ctx, conn, WSClientMessage{Type: "subscribe", RequestID: "req-1"})
+	orders.Close()
+	go worker.Run()
+
+	if err := wsjson.Read(ctx, conn, &msg); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if msg.Type != "result" || msg.OrderID != orderID || msg.Status != domain.PurchaseStatusSucceeded {
+		t.Errorf("unexpected result %+v", msg)
+	}
+}
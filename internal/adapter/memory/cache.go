@@ -0,0 +1,772 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+type idempotencyEntry struct {
+	result    *domain.PurchaseResult
+	expiresAt time.Time
+}
+
+// Cache is an in-memory CacheRepository. A single mutex makes every
+// operation atomic, matching the guarantees of the Redis Lua scripts.
+type Cache struct {
+	mu          sync.Mutex
+	stock       map[string]int
+	frozen      map[string]bool
+	closed      map[string]bool
+	idempotency map[string]idempotencyEntry
+	records     map[string]recordEntry
+	quota       map[quotaKey]int
+	couponUses  map[string]int                            // not part of the campaign, like in Redis
+	lottery     map[string]map[string]domain.LotteryEntry // by item, then user
+	bannedUsers map[string]bool                           // not part of the campaign either
+	bannedIPs   map[netip.Prefix]bool
+	attempts    map[string]attemptWindow
+	firstSeen   map[string]time.Time // not part of the campaign, like bans
+	sale        saleCounters
+	watchers    map[string][]chan int
+	results     map[string][]chan domain.OrderResult
+	soldOut     []chan string
+	orderEvents []chan domain.OrderEvent
+	campaign    string
+	now         func() time.Time
+}
+
+// CacheOption configures a Cache.
+type CacheOption func(*Cache)
+
+// WithCampaign makes the cache hold the keys of campaignID, the one campaign
+// whose keys SnapshotCampaign and DeleteCampaign see.
+func WithCampaign(campaignID string) CacheOption {
+	return func(c *Cache) {
+		c.campaign = campaignID
+	}
+}
+
+func NewCache(opts ...CacheOption) *Cache {
+	c := &Cache{
+		stock:       make(map[string]int),
+		frozen:      make(map[string]bool),
+		closed:      make(map[string]bool),
+		idempotency: make(map[string]idempotencyEntry),
+		records:     make(map[string]recordEntry),
+		quota:       make(map[quotaKey]int),
+		couponUses:  make(map[string]int),
+		lottery:     make(map[string]map[string]domain.LotteryEntry),
+		bannedUsers: make(map[string]bool),
+		bannedIPs:   make(map[netip.Prefix]bool),
+		attempts:    make(map[string]attemptWindow),
+		firstSeen:   make(map[string]time.Time),
+		watchers:    make(map[string][]chan int),
+		results:     make(map[string][]chan domain.OrderResult),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Cache) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := c.checkStock(itemID, quantity)
+	if result == domain.StockDecremented {
+		c.stock[itemID] -= quantity
+		c.notify(itemID)
+	}
+	return result, nil
+}
+
+// DecrementStockAbove takes quantity units only while floor units remain.
+func (c *Cache) DecrementStockAbove(ctx context.Context, itemID string, quantity, floor int) (domain.StockDecrement, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := c.checkStock(itemID, quantity+floor)
+	if result == domain.StockDecremented {
+		c.stock[itemID] -= quantity
+		c.notify(itemID)
+	}
+	return result, nil
+}
+
+// DecrementStocks checks every line before taking any stock.
+func (c *Cache) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, line := range lines {
+		if result := c.checkStock(line.ItemID, line.Quantity); result != domain.StockDecremented {
+			return result, line.ItemID, nil
+		}
+	}
+	for _, line := range lines {
+		c.stock[line.ItemID] -= line.Quantity
+		c.notify(line.ItemID)
+	}
+	return domain.StockDecremented, "", nil
+}
+
+// checkStock reports whether quantity units of an item can be taken. It
+// must be called with c.mu held.
+func (c *Cache) checkStock(itemID string, quantity int) domain.StockDecrement {
+	if c.closed[itemID] {
+		return domain.StockSaleClosed
+	}
+	if c.frozen[itemID] {
+		return domain.StockFrozen
+	}
+	current, ok := c.stock[itemID]
+	if !ok {
+		return domain.StockNoSuchItem
+	}
+	if current < quantity {
+		return domain.StockInsufficient
+	}
+	return domain.StockDecremented
+}
+
+func (c *Cache) IncrementStock(ctx context.Context, itemID string, quantity int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stock[itemID] += quantity
+	c.notify(itemID)
+	return nil
+}
+
+func (c *Cache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.idempotency[key]; ok && c.now().Before(entry.expiresAt) {
+		return false, nil
+	}
+	c.idempotency[key] = idempotencyEntry{expiresAt: c.now().Add(ttl)}
+	return true, nil
+}
+
+func (c *Cache) ReleaseIdempotency(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.idempotency, key)
+	return nil
+}
+
+func (c *Cache) SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.idempotency[key]
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return nil
+	}
+	entry.result = &result
+	c.idempotency[key] = entry
+	return nil
+}
+
+func (c *Cache) GetIdempotencyResult(ctx context.Context, key string) (*domain.PurchaseResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.idempotency[key]
+	if !ok || entry.result == nil || !c.now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+	result := *entry.result
+	return &result, nil
+}
+
+type recordEntry struct {
+	record    domain.PurchaseRecord
+	expiresAt time.Time
+}
+
+func (c *Cache) SavePurchaseRecord(ctx context.Context, record domain.PurchaseRecord, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.records[record.RequestID] = recordEntry{record: record, expiresAt: c.now().Add(ttl)}
+	return nil
+}
+
+func (c *Cache) GetPurchaseRecord(ctx context.Context, requestID string) (*domain.PurchaseRecord, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.records[requestID]
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return nil, nil
+	}
+	record := entry.record
+	return &record, nil
+}
+
+// SetStock sets the stock counter for an item.
+func (c *Cache) SetStock(ctx context.Context, itemID string, quantity int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stock[itemID] = quantity
+	c.notify(itemID)
+	return nil
+}
+
+// SetFrozen pauses or resumes sales of an item.
+func (c *Cache) SetFrozen(ctx context.Context, itemID string, frozen bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.frozen[itemID] = frozen
+	return nil
+}
+
+// SetSaleClosed ends or reopens the sale of an item.
+func (c *Cache) SetSaleClosed(ctx context.Context, itemID string, closed bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed[itemID] = closed
+	return nil
+}
+
+// GetStock returns the stock counter for an item.
+func (c *Cache) GetStock(ctx context.Context, itemID string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stock[itemID], nil
+}
+
+// WatchStock delivers the item's stock level after each change until ctx is done.
+func (c *Cache) WatchStock(ctx context.Context, itemID string) (<-chan int, error) {
+	ch := make(chan int, 1)
+
+	c.mu.Lock()
+	c.watchers[itemID] = append(c.watchers[itemID], ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.watchers[itemID] = slices.DeleteFunc(c.watchers[itemID], func(w chan int) bool { return w == ch })
+		if len(c.watchers[itemID]) == 0 {
+			delete(c.watchers, itemID)
+		}
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// PublishOrderResult delivers a result to the request's current watchers.
+func (c *Cache) PublishOrderResult(ctx context.Context, result domain.OrderResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.results[result.RequestID] {
+		select {
+		case ch <- result:
+		default:
+		}
+	}
+	return nil
+}
+
+// WatchOrderResult delivers results published for the request until ctx is done.
+func (c *Cache) WatchOrderResult(ctx context.Context, requestID string) (<-chan domain.OrderResult, error) {
+	ch := make(chan domain.OrderResult, 1)
+
+	c.mu.Lock()
+	c.results[requestID] = append(c.results[requestID], ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.results[requestID] = slices.DeleteFunc(c.results[requestID], func(w chan domain.OrderResult) bool { return w == ch })
+		if len(c.results[requestID]) == 0 {
+			delete(c.results, requestID)
+		}
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// PublishSoldOut delivers the item to the current sold out watchers. A
+// watcher that is not keeping up misses it.
+func (c *Cache) PublishSoldOut(ctx context.Context, itemID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.soldOut {
+		select {
+		case ch <- itemID:
+		default:
+		}
+	}
+	return nil
+}
+
+// WatchSoldOut delivers items published as sold out until ctx is done.
+func (c *Cache) WatchSoldOut(ctx context.Context) (<-chan string, error) {
+	ch := make(chan string, 16)
+
+	c.mu.Lock()
+	c.soldOut = append(c.soldOut, ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.soldOut = slices.DeleteFunc(c.soldOut, func(w chan string) bool { return w == ch })
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// PublishOrderEvent delivers the event to the current order event watchers.
+// A watcher that is not keeping up misses it.
+func (c *Cache) PublishOrderEvent(ctx context.Context, event domain.OrderEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, ch := range c.orderEvents {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// WatchOrderEvents delivers the order events published until ctx is done.
+func (c *Cache) WatchOrderEvents(ctx context.Context) (<-chan domain.OrderEvent, error) {
+	ch := make(chan domain.OrderEvent, 16)
+
+	c.mu.Lock()
+	c.orderEvents = append(c.orderEvents, ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.orderEvents = slices.DeleteFunc(c.orderEvents, func(w chan domain.OrderEvent) bool { return w == ch })
+		close(ch)
+	}()
+
+	return ch, nil
+}
+
+// SnapshotCampaign reads the final values of the campaign's keys. Other
+// campaigns have no keys in this cache.
+func (c *Cache) SnapshotCampaign(ctx context.Context, campaignID string) (*domain.CampaignArchive, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	archive := &domain.CampaignArchive{
+		CampaignID: campaignID,
+		Stock:      make(map[string]int),
+		ArchivedAt: c.now(),
+	}
+	if campaignID != c.campaign {
+		return archive, nil
+	}
+	maps.Copy(archive.Stock, c.stock)
+	archive.FrozenItems = flagged(c.frozen)
+	archive.ClosedItems = flagged(c.closed)
+	archive.IdempotencyKeys = len(c.idempotency)
+	return archive, nil
+}
+
+// SetCampaignStock sets an item's stock if campaignID is the cache's
+// campaign. The cache holds no other campaign's keys.
+func (c *Cache) SetCampaignStock(ctx context.Context, campaignID, itemID string, quantity int) error {
+	if campaignID != c.campaign {
+		return fmt.Errorf("cache holds campaign %q, not %q", c.campaign, campaignID)
+	}
+	return c.SetStock(ctx, itemID, quantity)
+}
+
+// DeleteCampaign removes the campaign's keys and returns how many were deleted.
+func (c *Cache) DeleteCampaign(ctx context.Context, campaignID string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if campaignID != c.campaign {
+		return 0, nil
+	}
+	deleted := len(c.stock) + len(flagged(c.frozen)) + len(flagged(c.closed)) + len(c.idempotency) + len(quotaItems(c.quota))
+	now := c.now()
+	for _, r := range c.records {
+		if now.Before(r.expiresAt) {
+			deleted++
+		}
+	}
+	for _, w := range c.attempts {
+		if now.Before(w.expiresAt) {
+			deleted++
+		}
+	}
+	if len(c.lottery) > 0 {
+		// Redis keeps two keys per item plus the list of items
+		deleted += 2*len(c.lottery) + 1
+	}
+	clear(c.stock)
+	clear(c.frozen)
+	clear(c.closed)
+	clear(c.idempotency)
+	clear(c.records)
+	clear(c.quota)
+	clear(c.lottery)
+	clear(c.attempts)
+	deleted += c.sale.keys(now)
+	c.sale = saleCounters{}
+	return deleted, nil
+}
+
+type quotaKey struct {
+	itemID, userID string
+}
+
+func (c *Cache) ReserveQuota(ctx context.Context, itemID, userID string, quantity, limit int) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := quotaKey{itemID, userID}
+	if c.quota[key]+quantity > limit {
+		return false, nil
+	}
+	c.quota[key] += quantity
+	return true, nil
+}
+
+func (c *Cache) ReleaseQuota(ctx context.Context, itemID, userID string, quantity int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.quota[quotaKey{itemID, userID}] -= quantity
+	return nil
+}
+
+func (c *Cache) RedeemCoupon(ctx context.Context, code string, maxUses int) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if maxUses > 0 && c.couponUses[code] >= maxUses {
+		return false, nil
+	}
+	c.couponUses[code]++
+	return true, nil
+}
+
+func (c *Cache) ReleaseCoupon(ctx context.Context, code string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.couponUses[code]--
+	return nil
+}
+
+func (c *Cache) CouponUses(ctx context.Context, code string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.couponUses[code], nil
+}
+
+func (c *Cache) BanUser(ctx context.Context, userID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bannedUsers[userID] = true
+	return nil
+}
+
+func (c *Cache) UnbanUser(ctx context.Context, userID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.bannedUsers, userID)
+	return nil
+}
+
+func (c *Cache) IsUserBanned(ctx context.Context, userID string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.bannedUsers[userID], nil
+}
+
+func (c *Cache) BannedUsers(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return flagged(c.bannedUsers), nil
+}
+
+func (c *Cache) BanIPRange(ctx context.Context, prefix netip.Prefix) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bannedIPs[prefix.Masked()] = true
+	return nil
+}
+
+func (c *Cache) UnbanIPRange(ctx context.Context, prefix netip.Prefix) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.bannedIPs, prefix.Masked())
+	return nil
+}
+
+func (c *Cache) BannedIPRanges(ctx context.Context) ([]netip.Prefix, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ranges := slices.Collect(maps.Keys(c.bannedIPs))
+	return ranges, nil
+}
+
+type attemptWindow struct {
+	count     int
+	expiresAt time.Time
+}
+
+func (c *Cache) CountAttempt(ctx context.Context, key string, window time.Duration) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	w := c.attempts[key]
+	if !now.Before(w.expiresAt) {
+		w = attemptWindow{expiresAt: now.Add(window)}
+	}
+	w.count++
+	c.attempts[key] = w
+	return w.count, nil
+}
+
+func (c *Cache) FirstSeen(ctx context.Context, userID string, at time.Time) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seen, ok := c.firstSeen[userID]; ok {
+		return seen, nil
+	}
+	c.firstSeen[userID] = at
+	return at, nil
+}
+
+// saleCounters are the counters of the cache's campaign. rate holds the
+// orders saved in each second, by unix time, for as long as Redis keeps them.
+type saleCounters struct {
+	orders, units, queued int64
+	startedAt             time.Time
+	failures              map[string]int64
+	soldOut               map[string]time.Time
+	rate                  map[int64]int64
+}
+
+const saleRateTTL = 10 * time.Minute
+
+// keys returns how many keys the counters would take in Redis: the hash and
+// each second still counted.
+func (s saleCounters) keys(now time.Time) int {
+	n := 0
+	if s.orders != 0 || s.units != 0 || s.queued != 0 || len(s.failures) > 0 || len(s.soldOut) > 0 {
+		n++
+	}
+	for sec := range s.rate {
+		if now.Before(time.Unix(sec, 0).Add(saleRateTTL)) {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cache) RecordOrders(ctx context.Context, orders, units int, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sale.orders += int64(orders)
+	c.sale.units += int64(units)
+	if c.sale.startedAt.IsZero() {
+		c.sale.startedAt = at
+	}
+	if c.sale.rate == nil {
+		c.sale.rate = make(map[int64]int64)
+	}
+	now := c.now()
+	for sec := range c.sale.rate {
+		if !now.Before(time.Unix(sec, 0).Add(saleRateTTL)) {
+			delete(c.sale.rate, sec)
+		}
+	}
+	c.sale.rate[at.Unix()] += int64(orders)
+	return nil
+}
+
+func (c *Cache) RecordFailure(ctx context.Context, outcome string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sale.failures == nil {
+		c.sale.failures = make(map[string]int64)
+	}
+	c.sale.failures[outcome]++
+	return nil
+}
+
+func (c *Cache) RecordSoldOut(ctx context.Context, itemID string, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sale.soldOut == nil {
+		c.sale.soldOut = make(map[string]time.Time)
+	}
+	if _, ok := c.sale.soldOut[itemID]; !ok {
+		c.sale.soldOut[itemID] = at
+	}
+	return nil
+}
+
+func (c *Cache) AddQueued(ctx context.Context, delta int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sale.queued += int64(delta)
+	return nil
+}
+
+// SaleCounters reads the counters of the cache's campaign; other campaigns
+// have none.
+func (c *Cache) SaleCounters(ctx context.Context, campaignID string, now time.Time, window time.Duration) (*domain.SaleCounters, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counters := &domain.SaleCounters{
+		Failures:  make(map[string]int64),
+		SoldOutAt: make(map[string]time.Time),
+	}
+	if campaignID != c.campaign {
+		return counters, nil
+	}
+	counters.Orders = c.sale.orders
+	counters.SoldUnits = c.sale.units
+	counters.QueueDepth = max(c.sale.queued, 0)
+	counters.StartedAt = c.sale.startedAt
+	maps.Copy(counters.Failures, c.sale.failures)
+	maps.Copy(counters.SoldOutAt, c.sale.soldOut)
+	end := now.Unix()
+	for sec := end - int64(window/time.Second); sec < end; sec++ {
+		counters.RecentOrders += c.sale.rate[sec]
+	}
+	return counters, nil
+}
+
+func (c *Cache) AddEntry(ctx context.Context, entry domain.LotteryEntry) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := c.lottery[entry.ItemID]
+	if entries == nil {
+		entries = make(map[string]domain.LotteryEntry)
+		c.lottery[entry.ItemID] = entries
+	}
+	if _, ok := entries[entry.UserID]; ok {
+		return false, nil
+	}
+	entries[entry.UserID] = entry
+	return true, nil
+}
+
+func (c *Cache) DrawEntries(ctx context.Context, itemID string, n int) ([]domain.LotteryEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := c.lottery[itemID]
+	users := slices.Collect(maps.Keys(entries))
+	rand.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+
+	drawn := make([]domain.LotteryEntry, 0, min(n, len(users)))
+	for _, user := range users[:min(n, len(users))] {
+		drawn = append(drawn, entries[user])
+		delete(entries, user)
+	}
+	if len(entries) == 0 {
+		delete(c.lottery, itemID)
+	}
+	return drawn, nil
+}
+
+func (c *Cache) LotteryItems(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	items := slices.Collect(maps.Keys(c.lottery))
+	slices.Sort(items)
+	return items, nil
+}
+
+// quotaItems returns the items with quota counts, one key each in Redis.
+func quotaItems(quota map[quotaKey]int) map[string]bool {
+	items := make(map[string]bool)
+	for key := range quota {
+		items[key.itemID] = true
+	}
+	return items
+}
+
+func flagged(flags map[string]bool) []string {
+	var items []string
+	for item, set := range flags {
+		if set {
+			items = append(items, item)
+		}
+	}
+	slices.Sort(items)
+	return items
+}
+
+// notify must be called with c.mu held.
+func (c *Cache) notify(itemID string) {
+	for _, ch := range c.watchers[itemID] {
+		sendLatest(ch, c.stock[itemID])
+	}
+}
+
+// sendLatest replaces any undelivered level so the channel never blocks.
+func sendLatest(ch chan int, level int) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- level
+}
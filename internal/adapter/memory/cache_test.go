@@ -0,0 +1,384 @@
+package memory
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestCache_DecrementStock_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	cache.SetStock(ctx, "item", 20)
+
+	var successCount atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, _ := cache.DecrementStock(ctx, "item", 1); res == domain.StockDecremented {
+				successCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successCount.Load() != 20 {
+		t.Errorf("expected 20 successes, got %d", successCount.Load())
+	}
+	if stock, _ := cache.GetStock(ctx, "item"); stock != 0 {
+		t.Errorf("expected stock 0, got %d", stock)
+	}
+}
+
+func TestCache_DecrementStock_KeyNotExists(t *testing.T) {
+	res, err := NewCache().DecrementStock(context.Background(), "missing", 1)
+	if err != nil || res != domain.StockNoSuchItem {
+		t.Errorf("expected no_such_item without error, got %v err=%v", res, err)
+	}
+}
+
+func TestCache_DecrementStock_FrozenAndClosed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	cache.SetStock(ctx, "item", 5)
+
+	cache.SetFrozen(ctx, "item", true)
+	if res, _ := cache.DecrementStock(ctx, "item", 1); res != domain.StockFrozen {
+		t.Errorf("expected frozen, got %v", res)
+	}
+
+	cache.SetSaleClosed(ctx, "item", true)
+	if res, _ := cache.DecrementStock(ctx, "item", 1); res != domain.StockSaleClosed {
+		t.Errorf("closed should take precedence over frozen, got %v", res)
+	}
+
+	cache.SetFrozen(ctx, "item", false)
+	cache.SetSaleClosed(ctx, "item", false)
+	if res, _ := cache.DecrementStock(ctx, "item", 1); res != domain.StockDecremented {
+		t.Errorf("expected decrement after clearing flags, got %v", res)
+	}
+	if stock, _ := cache.GetStock(ctx, "item"); stock != 4 {
+		t.Errorf("expected stock 4, got %d", stock)
+	}
+}
+
+func TestCache_DecrementStocks(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	cache.SetStock(ctx, "item-a", 5)
+	cache.SetStock(ctx, "item-b", 2)
+
+	res, itemID, err := cache.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "item-a", Quantity: 2}, {ItemID: "item-b", Quantity: 3}})
+	if err != nil || res != domain.StockInsufficient || itemID != "item-b" {
+		t.Fatalf("expected item-b insufficient, got %v on %q err=%v", res, itemID, err)
+	}
+	if stock, _ := cache.GetStock(ctx, "item-a"); stock != 5 {
+		t.Errorf("expected item-a untouched at 5, got %d", stock)
+	}
+
+	if res, itemID, _ := cache.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "item-a", Quantity: 1}, {ItemID: "missing", Quantity: 1}}); res != domain.StockNoSuchItem || itemID != "missing" {
+		t.Errorf("expected missing item, got %v on %q", res, itemID)
+	}
+
+	if res, _, _ := cache.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "item-a", Quantity: 2}, {ItemID: "item-b", Quantity: 2}}); res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v", res)
+	}
+	a, _ := cache.GetStock(ctx, "item-a")
+	b, _ := cache.GetStock(ctx, "item-b")
+	if a != 3 || b != 0 {
+		t.Errorf("expected stocks 3 and 0, got %d and %d", a, b)
+	}
+}
+
+func TestCache_Idempotency(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	if ok, _ := cache.SetIdempotency(ctx, "key", time.Minute); !ok {
+		t.Fatal("expected first claim to succeed")
+	}
+	if ok, _ := cache.SetIdempotency(ctx, "key", time.Minute); ok {
+		t.Error("expected second claim to fail")
+	}
+
+	if result, _ := cache.GetIdempotencyResult(ctx, "key"); result != nil {
+		t.Error("expected no result while pending")
+	}
+
+	cache.SetIdempotencyResult(ctx, "key", domain.PurchaseResult{OrderID: "o-1", Status: domain.PurchaseStatusSucceeded})
+	result, _ := cache.GetIdempotencyResult(ctx, "key")
+	if result == nil || result.OrderID != "o-1" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// Expired keys can be claimed again
+	now = now.Add(2 * time.Minute)
+	if ok, _ := cache.SetIdempotency(ctx, "key", time.Minute); !ok {
+		t.Error("expected claim after expiry to succeed")
+	}
+}
+
+func TestCache_PurchaseQuota(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	if ok, _ := cache.ReserveQuota(ctx, "item", "user-1", 2, 3); !ok {
+		t.Fatal("expected reservation within the limit")
+	}
+	if ok, _ := cache.ReserveQuota(ctx, "item", "user-1", 2, 3); ok {
+		t.Error("expected reservation past the limit to fail")
+	}
+	if ok, _ := cache.ReserveQuota(ctx, "other", "user-1", 3, 3); !ok {
+		t.Error("expected each item to have its own quota")
+	}
+
+	cache.ReleaseQuota(ctx, "item", "user-1", 2)
+	if ok, _ := cache.ReserveQuota(ctx, "item", "user-1", 3, 3); !ok {
+		t.Error("expected released units to be available again")
+	}
+}
+
+func TestCache_CouponRedemptions(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	if ok, _ := cache.RedeemCoupon(ctx, "ONCE", 1); !ok {
+		t.Fatal("expected first redemption to succeed")
+	}
+	if ok, _ := cache.RedeemCoupon(ctx, "ONCE", 1); ok {
+		t.Error("expected redemption past the limit to fail")
+	}
+	if ok, _ := cache.RedeemCoupon(ctx, "ANY", 0); !ok {
+		t.Error("expected unlimited coupon to be redeemed")
+	}
+
+	cache.ReleaseCoupon(ctx, "ONCE")
+	if uses, _ := cache.CouponUses(ctx, "ONCE"); uses != 0 {
+		t.Errorf("expected released use, got %d uses", uses)
+	}
+}
+
+func TestCache_LotteryEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	for _, user := range []string{"u1", "u2", "u3"} {
+		if ok, _ := cache.AddEntry(ctx, domain.LotteryEntry{RequestID: "req-" + user, UserID: user, ItemID: "item", Quantity: 1}); !ok {
+			t.Fatalf("expected entry for %s", user)
+		}
+	}
+	if ok, _ := cache.AddEntry(ctx, domain.LotteryEntry{RequestID: "req-again", UserID: "u1", ItemID: "item", Quantity: 1}); ok {
+		t.Error("expected a second entry by the same user to be refused")
+	}
+	if items, _ := cache.LotteryItems(ctx); len(items) != 1 || items[0] != "item" {
+		t.Errorf("expected item to have entries, got %v", items)
+	}
+
+	drawn, _ := cache.DrawEntries(ctx, "item", 2)
+	rest, _ := cache.DrawEntries(ctx, "item", 2)
+	if len(drawn) != 2 || len(rest) != 1 {
+		t.Fatalf("expected 2 then 1 entries, got %d and %d", len(drawn), len(rest))
+	}
+	seen := map[string]bool{}
+	for _, entry := range append(drawn, rest...) {
+		seen[entry.UserID] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected every user drawn once, got %v", seen)
+	}
+	if items, _ := cache.LotteryItems(ctx); len(items) != 0 {
+		t.Errorf("expected no items left to draw, got %v", items)
+	}
+}
+
+func TestCache_WatchStock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := NewCache()
+	cache.SetStock(ctx, "item", 5)
+
+	levels, _ := cache.WatchStock(ctx, "item")
+	cache.DecrementStock(ctx, "item", 2)
+	cache.IncrementStock(ctx, "item", 1)
+
+	// Only the latest level is kept for a receiver that has not caught up
+	if level := <-levels; level != 4 {
+		t.Errorf("expected latest level 4, got %d", level)
+	}
+
+	cancel()
+	for range levels {
+	}
+}
+
+func TestCache_SoldOutFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := NewCache()
+
+	items, _ := cache.WatchSoldOut(ctx)
+	cache.PublishSoldOut(ctx, "item")
+	if itemID := <-items; itemID != "item" {
+		t.Errorf("expected item, got %q", itemID)
+	}
+
+	cancel()
+	for range items {
+	}
+}
+
+func TestCache_OrderEventFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := NewCache()
+
+	events, _ := cache.WatchOrderEvents(ctx)
+	cache.PublishOrderEvent(ctx, domain.OrderEvent{Type: domain.OrderEventExpired, OrderID: "order-1"})
+	if event := <-events; event.OrderID != "order-1" {
+		t.Errorf("expected order-1, got %+v", event)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestCache_CampaignKeyspace(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(WithCampaign("summer"))
+	cache.SetStock(ctx, "a", 3)
+	cache.SetStock(ctx, "b", 0)
+	cache.SetFrozen(ctx, "b", true)
+	cache.SetIdempotency(ctx, "key", time.Minute)
+
+	archive, _ := cache.SnapshotCampaign(ctx, "summer")
+	if archive.Stock["a"] != 3 || len(archive.Stock) != 2 || !slices.Equal(archive.FrozenItems, []string{"b"}) || archive.IdempotencyKeys != 1 {
+		t.Errorf("unexpected archive: %+v", archive)
+	}
+
+	// Keys of other campaigns are never in this cache
+	if other, _ := cache.SnapshotCampaign(ctx, "winter"); len(other.Stock) != 0 {
+		t.Errorf("expected empty archive, got %+v", other)
+	}
+	if deleted, _ := cache.DeleteCampaign(ctx, "winter"); deleted != 0 {
+		t.Errorf("expected nothing deleted, got %d", deleted)
+	}
+
+	if deleted, _ := cache.DeleteCampaign(ctx, "summer"); deleted != 4 {
+		t.Errorf("expected 4 keys deleted, got %d", deleted)
+	}
+	if res, _ := cache.DecrementStock(ctx, "a", 1); res != domain.StockNoSuchItem {
+		t.Errorf("expected no_such_item after delete, got %v", res)
+	}
+}
+
+func TestCache_PurchaseRecords(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	record := domain.PurchaseRecord{RequestID: "req-1", UserID: "user-1", OrderID: "o-1", Status: domain.PurchaseStatusSucceeded}
+	cache.SavePurchaseRecord(ctx, record, time.Minute)
+	if got, _ := cache.GetPurchaseRecord(ctx, "req-1"); got == nil || *got != record {
+		t.Errorf("expected %+v, got %+v", record, got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got, _ := cache.GetPurchaseRecord(ctx, "req-1"); got != nil {
+		t.Errorf("expected the record to expire, got %+v", got)
+	}
+}
+
+func TestCache_SaleCounters(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(WithCampaign("spring"))
+	now := time.Unix(1_700_000_000, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.AddQueued(ctx, 3)
+	cache.RecordOrders(ctx, 2, 5, now.Add(-3*time.Second))
+	cache.RecordOrders(ctx, 1, 1, now.Add(-time.Minute))
+	cache.AddQueued(ctx, -3)
+	cache.AddQueued(ctx, -1) // from a server that died, never below zero
+	cache.RecordFailure(ctx, "sold_out")
+	cache.RecordFailure(ctx, "sold_out")
+	cache.RecordSoldOut(ctx, "item-1", now)
+	cache.RecordSoldOut(ctx, "item-1", now.Add(time.Second))
+
+	got, err := cache.SaleCounters(ctx, "spring", now, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Orders != 3 || got.SoldUnits != 6 || got.RecentOrders != 2 || got.QueueDepth != 0 {
+		t.Errorf("unexpected counters: %+v", got)
+	}
+	if !got.StartedAt.Equal(now.Add(-3*time.Second)) || got.Failures["sold_out"] != 2 || !got.SoldOutAt["item-1"].Equal(now) {
+		t.Errorf("unexpected counters: %+v", got)
+	}
+	if other, _ := cache.SaleCounters(ctx, "summer", now, 10*time.Second); other.Orders != 0 {
+		t.Errorf("expected no counters for another campaign, got %+v", other)
+	}
+
+	if deleted, _ := cache.DeleteCampaign(ctx, "spring"); deleted != 3 {
+		t.Errorf("expected the hash and two rate keys deleted, got %d", deleted)
+	}
+	if got, _ := cache.SaleCounters(ctx, "spring", now, 10*time.Second); got.Orders != 0 || len(got.Failures) != 0 {
+		t.Errorf("expected the counters deleted, got %+v", got)
+	}
+}
+
+func TestCache_RiskSignals(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for want := 1; want <= 3; want++ {
+		if n, _ := cache.CountAttempt(ctx, "ip:10.0.0.1", time.Minute); n != want {
+			t.Fatalf("expected count %d, got %d", want, n)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if n, _ := cache.CountAttempt(ctx, "ip:10.0.0.1", time.Minute); n != 1 {
+		t.Errorf("expected a new window after expiry, got count %d", n)
+	}
+
+	if seen, _ := cache.FirstSeen(ctx, "user-1", now); !seen.Equal(now) {
+		t.Errorf("expected %v, got %v", now, seen)
+	}
+	if seen, _ := cache.FirstSeen(ctx, "user-1", now.Add(time.Hour)); !seen.Equal(now) {
+		t.Errorf("expected the first sighting to stick, got %v", seen)
+	}
+}
+
+func TestCache_Blacklist(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache()
+
+	cache.BanUser(ctx, "user-1")
+	cache.BanIPRange(ctx, netip.MustParsePrefix("10.1.2.3/8"))
+	if banned, _ := cache.IsUserBanned(ctx, "user-1"); !banned {
+		t.Error("expected user-1 to be banned")
+	}
+	if ranges, _ := cache.BannedIPRanges(ctx); len(ranges) != 1 || ranges[0].String() != "10.0.0.0/8" {
+		t.Errorf("expected the masked range, got %v", ranges)
+	}
+
+	cache.UnbanUser(ctx, "user-1")
+	cache.UnbanIPRange(ctx, netip.MustParsePrefix("10.0.0.0/8"))
+	if users, _ := cache.BannedUsers(ctx); len(users) != 0 {
+		t.Errorf("expected no banned users, got %v", users)
+	}
+	if ranges, _ := cache.BannedIPRanges(ctx); len(ranges) != 0 {
+		t.Errorf("expected no banned ranges, got %v", ranges)
+	}
+}
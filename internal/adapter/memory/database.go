@@ -0,0 +1,906 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrOptimisticLock      = port.ErrOptimisticLock
+	ErrAllocationExhausted = port.ErrAllocationExhausted
+	ErrDuplicateOrder      = errors.New("duplicate order id")
+)
+
+// Database is an in-memory DatabaseRepository with the same transactional
+// semantics as the MySQL adapter: multi-row writes apply all or nothing.
+type Database struct {
+	mu          sync.Mutex
+	inventory   map[string]domain.Inventory
+	orders      map[string]domain.Order
+	allocations map[string]domain.Allocation
+	archives    []domain.CampaignArchive
+	restocks    []domain.Restock
+	items       map[string]domain.Item
+	archived    map[string]domain.Order
+	views       map[string]domain.Order
+	campaigns   map[string]domain.Campaign
+	coupons     map[string]domain.Coupon
+	tiers       map[string]domain.UserTier
+
+	// compensations are kept in creation order; resolved marks done ones
+	compensations []domain.StockCompensation
+	resolved      map[string]bool
+
+	// refunds are keyed by order ID
+	refunds map[string]domain.Refund
+
+	// audit holds the audit log oldest first; a record's ID is its
+	// position plus one
+	audit []domain.AuditRecord
+
+	// changes is the order change log, always kept; a change's Seq is its
+	// position plus one
+	changes []domain.OrderChange
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		inventory:   make(map[string]domain.Inventory),
+		orders:      make(map[string]domain.Order),
+		allocations: make(map[string]domain.Allocation),
+		items:       make(map[string]domain.Item),
+		archived:    make(map[string]domain.Order),
+		views:       make(map[string]domain.Order),
+		campaigns:   make(map[string]domain.Campaign),
+		coupons:     make(map[string]domain.Coupon),
+		tiers:       make(map[string]domain.UserTier),
+		resolved:    make(map[string]bool),
+		refunds:     make(map[string]domain.Refund),
+	}
+}
+
+func (d *Database) CreateOrder(ctx context.Context, order domain.Order) error {
+	return d.CreateOrders(ctx, []domain.Order{order})
+}
+
+func (d *Database) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Validate against a scratch copy of the affected stock so a failing
+	// order leaves nothing behind
+	stock := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, order := range orders {
+		if _, exists := d.orders[order.ID]; exists || seen[order.ID] {
+			return fmt.Errorf("insert order: %w", ErrDuplicateOrder)
+		}
+		seen[order.ID] = true
+
+		for _, line := range order.Lines() {
+			inv, ok := d.inventory[line.ItemID]
+			if !ok {
+				return ErrOptimisticLock
+			}
+			if _, ok := stock[line.ItemID]; !ok {
+				stock[line.ItemID] = inv.Quantity
+			}
+			if stock[line.ItemID] < line.Quantity {
+				return ErrOptimisticLock
+			}
+			stock[line.ItemID] -= line.Quantity
+		}
+	}
+
+	for _, order := range orders {
+		d.orders[order.ID] = order
+		for _, line := range order.Lines() {
+			d.applyStockChange(line.ItemID, -line.Quantity)
+		}
+		d.recordCreated(order)
+	}
+	return nil
+}
+
+func (d *Database) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	order, ok := d.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return &order, nil
+}
+
+func (d *Database) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	order, ok := d.orders[id]
+	if !ok || order.Status != from {
+		return false, nil
+	}
+
+	if to.ReleasesStock() {
+		if order.AllocationID != "" {
+			alloc := d.allocations[order.AllocationID]
+			alloc.Fulfilled -= order.Quantity
+			alloc.Status = domain.AllocationStatusOpen
+			alloc.UpdatedAt = time.Now()
+			d.allocations[alloc.ID] = alloc
+		} else {
+			for _, line := range order.Lines() {
+				d.applyStockChange(line.ItemID, line.Quantity)
+			}
+		}
+	}
+
+	order.Status = to
+	order.UpdatedAt = time.Now()
+	d.orders[id] = order
+	d.record(domain.OrderChange{OrderID: id, Type: domain.StatusChange(to), OccurredAt: order.UpdatedAt})
+	return true, nil
+}
+
+func (d *Database) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	order, ok := d.orders[id]
+	if !ok || order.Status != domain.OrderStatusPending {
+		return false, nil
+	}
+	order.Status = domain.OrderStatusConfirmed
+	order.PaymentID = paymentID
+	order.UpdatedAt = time.Now()
+	d.orders[id] = order
+	d.record(domain.OrderChange{OrderID: id, Type: domain.OrderChangeConfirmed, PaymentID: paymentID, OccurredAt: order.UpdatedAt})
+	return true, nil
+}
+
+func (d *Database) ExpiredOrders(ctx context.Context, before time.Time, limit int) ([]domain.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var expired []domain.Order
+	for _, order := range d.orders {
+		if order.Status == domain.OrderStatusPending && !order.ExpiresAt.IsZero() && !order.ExpiresAt.After(before) {
+			expired = append(expired, order)
+		}
+	}
+	slices.SortFunc(expired, func(a, b domain.Order) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return expired, nil
+}
+
+func (d *Database) ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return listByUser(ctx, d.orders, userID, filter), nil
+}
+
+// listByUser pages through a user's orders among orders, newest first.
+func listByUser(ctx context.Context, orders map[string]domain.Order, userID string, filter domain.OrderFilter) []domain.Order {
+	var matched []domain.Order
+	for _, order := range orders {
+		if order.UserID != userID || !inTenant(ctx, order.TenantID) || !filter.Matches(order) {
+			continue
+		}
+		matched = append(matched, order)
+	}
+	slices.SortFunc(matched, func(a, b domain.Order) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
+
+// inTenant reports whether a row of tenant is visible to ctx: every row is
+// to work without a tenant, as in the SQL adapters.
+func inTenant(ctx context.Context, tenant string) bool {
+	scoped, ok := port.TenantOf(ctx)
+	return !ok || scoped == tenant
+}
+
+// ProjectOrders copies the orders into the read model, which is only read
+// by ListOrderViews and ItemOrderTotals.
+func (d *Database) ProjectOrders(ctx context.Context, ids []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, id := range ids {
+		if order, ok := d.orders[id]; ok {
+			d.views[id] = order
+		}
+	}
+	return nil
+}
+
+func (d *Database) ListOrderViews(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return listByUser(ctx, d.views, userID, filter), nil
+}
+
+func (d *Database) ItemOrderTotals(ctx context.Context, itemIDs []string) ([]domain.ItemOrderTotals, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	type key struct {
+		itemID string
+		status domain.OrderStatus
+	}
+	totals := make(map[key]*domain.ItemOrderTotals)
+	for _, order := range d.views {
+		counted := make(map[string]bool)
+		for _, line := range order.Lines() {
+			if !slices.Contains(itemIDs, line.ItemID) {
+				continue
+			}
+			k := key{line.ItemID, order.Status}
+			t, ok := totals[k]
+			if !ok {
+				t = &domain.ItemOrderTotals{ItemID: line.ItemID, Status: order.Status}
+				totals[k] = t
+			}
+			if !counted[line.ItemID] {
+				t.Orders++
+				counted[line.ItemID] = true
+			}
+			t.Units += int64(line.Quantity)
+			t.Revenue += line.TotalPrice
+		}
+	}
+
+	result := make([]domain.ItemOrderTotals, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	slices.SortFunc(result, func(a, b domain.ItemOrderTotals) int {
+		if c := strings.Compare(a.ItemID, b.ItemID); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.Status), string(b.Status))
+	})
+	return result, nil
+}
+
+func (d *Database) ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) ([]domain.Order, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var orders []domain.Order
+	for _, order := range d.orders {
+		if order.ID <= afterID || !inTenant(ctx, order.TenantID) || !window.Matches(order) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	slices.SortFunc(orders, func(a, b domain.Order) int { return strings.Compare(a.ID, b.ID) })
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (d *Database) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old := d.oldOrders(before, limit)
+	for _, order := range old {
+		d.archived[order.ID] = order
+		d.removeOrder(order.ID)
+	}
+	return len(old), nil
+}
+
+// OffloadOrders hands the oldest orders to keep and deletes them once it
+// has stored them.
+func (d *Database) OffloadOrders(ctx context.Context, before time.Time, limit int, keep func([]domain.Order) error) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old := d.oldOrders(before, limit)
+	if len(old) == 0 {
+		return 0, nil
+	}
+	if err := keep(old); err != nil {
+		return 0, err
+	}
+	for _, order := range old {
+		d.removeOrder(order.ID)
+	}
+	return len(old), nil
+}
+
+// oldOrders returns up to limit of the oldest orders created before the
+// given time, leaving out unpaid holds. It must be called with mu held.
+func (d *Database) oldOrders(before time.Time, limit int) []domain.Order {
+	var old []domain.Order
+	for _, order := range d.orders {
+		held := order.Status == domain.OrderStatusPending && !order.ExpiresAt.IsZero()
+		if order.CreatedAt.Before(before) && !held {
+			old = append(old, order)
+		}
+	}
+	slices.SortFunc(old, func(a, b domain.Order) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	if len(old) > limit {
+		old = old[:limit]
+	}
+	return old
+}
+
+// removeOrder must be called with mu held.
+func (d *Database) removeOrder(id string) {
+	delete(d.orders, id)
+	delete(d.views, id)
+	d.record(domain.OrderChange{OrderID: id, Type: domain.OrderChangeArchived, OccurredAt: time.Now()})
+}
+
+// recordCreated appends the accepted and persisted changes of a new order.
+// It must be called with mu held.
+func (d *Database) recordCreated(order domain.Order) {
+	order.Tier, order.TraceContext = "", nil
+	d.record(domain.OrderChange{OrderID: order.ID, Type: domain.OrderChangeAccepted, Order: &order, OccurredAt: order.CreatedAt})
+	d.record(domain.OrderChange{OrderID: order.ID, Type: domain.OrderChangePersisted, OccurredAt: time.Now()})
+}
+
+// record must be called with mu held.
+func (d *Database) record(change domain.OrderChange) {
+	change.Seq = int64(len(d.changes) + 1)
+	d.changes = append(d.changes, change)
+}
+
+func (d *Database) OrderChanges(ctx context.Context, orderID string) ([]domain.OrderChange, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var changes []domain.OrderChange
+	for _, change := range d.changes {
+		if change.OrderID == orderID {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (d *Database) OrderChangesAfter(ctx context.Context, afterSeq int64, limit int) ([]domain.OrderChange, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	start := min(max(int(afterSeq), 0), len(d.changes))
+	end := min(start+limit, len(d.changes))
+	return slices.Clone(d.changes[start:end]), nil
+}
+
+// ArchivedOrders returns the orders moved out by ArchiveOrders.
+func (d *Database) ArchivedOrders() []domain.Order {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.Collect(maps.Values(d.archived))
+}
+
+func (d *Database) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	inv, ok := d.inventory[itemID]
+	if !ok {
+		return nil, nil
+	}
+	return &inv, nil
+}
+
+func (d *Database) UpdateInventory(ctx context.Context, inv domain.Inventory) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.inventory[inv.ItemID]
+	if !ok || current.Version != inv.Version {
+		return ErrOptimisticLock
+	}
+	current.Quantity = inv.Quantity
+	current.Version++
+	current.UpdatedAt = time.Now()
+	d.inventory[inv.ItemID] = current
+	return nil
+}
+
+func (d *Database) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.inventory[inv.ItemID]
+	if !ok || current.Version != inv.Version {
+		return ErrOptimisticLock
+	}
+	current.Quantity = inv.Quantity
+	current.Version++
+	current.UpdatedAt = time.Now()
+	d.inventory[inv.ItemID] = current
+	d.restocks = append(d.restocks, restock)
+	return nil
+}
+
+func (d *Database) AppendAudit(ctx context.Context, record domain.AuditRecord) (*domain.AuditRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	record.ID = int64(len(d.audit) + 1)
+	d.audit = append(d.audit, record)
+	return &record, nil
+}
+
+func (d *Database) ListAudit(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditRecord, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var records []domain.AuditRecord
+	for i := len(d.audit) - 1; i >= 0 && len(records) < filter.Limit; i-- {
+		if filter.Matches(d.audit[i]) {
+			records = append(records, d.audit[i])
+		}
+	}
+	return records, nil
+}
+
+// Restocks returns the restock audit entries in the order they were made.
+func (d *Database) Restocks() []domain.Restock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]domain.Restock(nil), d.restocks...)
+}
+
+func (d *Database) CreateAllocation(ctx context.Context, alloc domain.Allocation) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	inv, ok := d.inventory[alloc.ItemID]
+	if !ok || inv.Quantity < alloc.Quantity {
+		return ErrOptimisticLock
+	}
+	d.allocations[alloc.ID] = alloc
+	d.applyStockChange(alloc.ItemID, -alloc.Quantity)
+	return nil
+}
+
+func (d *Database) GetAllocation(ctx context.Context, id string) (*domain.Allocation, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	alloc, ok := d.allocations[id]
+	if !ok {
+		return nil, nil
+	}
+	return &alloc, nil
+}
+
+func (d *Database) FulfillAllocation(ctx context.Context, order domain.Order) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	alloc, ok := d.allocations[order.AllocationID]
+	if !ok || alloc.Fulfilled+order.Quantity > alloc.Quantity {
+		return ErrAllocationExhausted
+	}
+	if _, exists := d.orders[order.ID]; exists {
+		return fmt.Errorf("insert order: %w", ErrDuplicateOrder)
+	}
+
+	alloc.Fulfilled += order.Quantity
+	if alloc.Fulfilled >= alloc.Quantity {
+		alloc.Status = domain.AllocationStatusFulfilled
+	}
+	alloc.UpdatedAt = time.Now()
+	d.allocations[alloc.ID] = alloc
+	order.TenantID = d.items[order.ItemID].TenantID
+	d.orders[order.ID] = order
+	d.recordCreated(order)
+	return nil
+}
+
+func (d *Database) SaveCampaignArchive(ctx context.Context, archive domain.CampaignArchive) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.archives = append(d.archives, archive)
+	return nil
+}
+
+func (d *Database) CreateItem(ctx context.Context, item domain.Item) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.items[item.ID]; exists {
+		return false, nil
+	}
+	if _, exists := d.inventory[item.ID]; exists {
+		return false, fmt.Errorf("insert inventory: duplicate item id %s", item.ID)
+	}
+
+	d.items[item.ID] = item
+	d.inventory[item.ID] = domain.Inventory{
+		ID:        item.ID,
+		ItemID:    item.ID,
+		TenantID:  item.TenantID,
+		Quantity:  item.Stock,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+	return true, nil
+}
+
+func (d *Database) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	item, ok := d.items[id]
+	if !ok {
+		return nil, nil
+	}
+	item.Stock = d.inventory[id].Quantity
+	return &item, nil
+}
+
+func (d *Database) ListItems(ctx context.Context) ([]domain.Item, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	items := make([]domain.Item, 0, len(d.items))
+	for id, item := range d.items {
+		item.Stock = d.inventory[id].Quantity
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b domain.Item) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return items, nil
+}
+
+func (d *Database) UpdateItem(ctx context.Context, item domain.Item) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.items[item.ID]
+	if !ok {
+		return false, nil
+	}
+	current.Name = item.Name
+	current.Price = item.Price
+	current.Currency = item.Currency
+	current.MaxPerUser = item.MaxPerUser
+	current.UpdatedAt = item.UpdatedAt
+	d.items[item.ID] = current
+	return true, nil
+}
+
+func (d *Database) CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.campaigns[campaign.ID]; exists {
+		return false, nil
+	}
+	campaign.ItemIDs = slices.Clone(campaign.ItemIDs)
+	d.campaigns[campaign.ID] = campaign
+	return true, nil
+}
+
+func (d *Database) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaign, ok := d.campaigns[id]
+	if !ok {
+		return nil, nil
+	}
+	campaign.ItemIDs = slices.Clone(campaign.ItemIDs)
+	return &campaign, nil
+}
+
+func (d *Database) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	campaigns := make([]domain.Campaign, 0, len(d.campaigns))
+	for _, campaign := range d.campaigns {
+		campaign.ItemIDs = slices.Clone(campaign.ItemIDs)
+		campaigns = append(campaigns, campaign)
+	}
+	slices.SortFunc(campaigns, func(a, b domain.Campaign) int {
+		if c := a.StartsAt.Compare(b.StartsAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return campaigns, nil
+}
+
+func (d *Database) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.campaigns[campaign.ID]
+	if !ok {
+		return false, nil
+	}
+	campaign.ItemIDs = slices.Clone(campaign.ItemIDs)
+	campaign.TenantID, campaign.CreatedAt = current.TenantID, current.CreatedAt
+	d.campaigns[campaign.ID] = campaign
+	return true, nil
+}
+
+func (d *Database) CreateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.coupons[coupon.Code]; exists {
+		return false, nil
+	}
+	d.coupons[coupon.Code] = coupon
+	return true, nil
+}
+
+func (d *Database) GetCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	coupon, ok := d.coupons[code]
+	if !ok {
+		return nil, nil
+	}
+	return &coupon, nil
+}
+
+func (d *Database) ListCoupons(ctx context.Context) ([]domain.Coupon, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	coupons := make([]domain.Coupon, 0, len(d.coupons))
+	for _, coupon := range d.coupons {
+		coupons = append(coupons, coupon)
+	}
+	slices.SortFunc(coupons, func(a, b domain.Coupon) int { return strings.Compare(a.Code, b.Code) })
+	return coupons, nil
+}
+
+func (d *Database) UpdateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.coupons[coupon.Code]
+	if !ok {
+		return false, nil
+	}
+	coupon.CreatedAt = current.CreatedAt
+	d.coupons[coupon.Code] = coupon
+	return true, nil
+}
+
+func (d *Database) SetUserTier(ctx context.Context, userID string, tier domain.UserTier) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if tier == domain.TierNormal {
+		delete(d.tiers, userID)
+	} else {
+		d.tiers[userID] = tier
+	}
+	return nil
+}
+
+func (d *Database) ListUserTiers(ctx context.Context) (map[string]domain.UserTier, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return maps.Clone(d.tiers), nil
+}
+
+// SetInventory creates or replaces the inventory row for an item.
+func (d *Database) SetInventory(itemID string, quantity int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.inventory[itemID] = domain.Inventory{
+		ID:        itemID,
+		ItemID:    itemID,
+		TenantID:  d.items[itemID].TenantID,
+		Quantity:  quantity,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Orders returns a snapshot of all stored orders.
+func (d *Database) Orders() []domain.Order {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	orders := make([]domain.Order, 0, len(d.orders))
+	for _, order := range d.orders {
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// applyStockChange must be called with mu held.
+func (d *Database) applyStockChange(itemID string, delta int) {
+	inv := d.inventory[itemID]
+	inv.Quantity += delta
+	inv.Version++
+	inv.UpdatedAt = time.Now()
+	d.inventory[itemID] = inv
+}
+
+func (d *Database) RecordCompensation(ctx context.Context, c domain.StockCompensation) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.compensations = append(d.compensations, c)
+	return nil
+}
+
+func (d *Database) PendingCompensations(ctx context.Context, limit int) ([]domain.StockCompensation, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var pending []domain.StockCompensation
+	for _, c := range d.compensations {
+		if len(pending) == limit {
+			break
+		}
+		if !d.resolved[c.ID] {
+			pending = append(pending, c)
+		}
+	}
+	return pending, nil
+}
+
+func (d *Database) ResolveCompensation(ctx context.Context, id string, at time.Time) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.compensationIndex(id)
+	if i < 0 || d.resolved[id] {
+		return false, nil
+	}
+	d.resolved[id] = true
+	d.compensations[i].UpdatedAt = at
+	return true, nil
+}
+
+func (d *Database) ReopenCompensation(ctx context.Context, id, lastError string, at time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	i := d.compensationIndex(id)
+	if i < 0 {
+		return nil
+	}
+	delete(d.resolved, id)
+	d.compensations[i].Attempts++
+	d.compensations[i].LastError = lastError
+	d.compensations[i].UpdatedAt = at
+	return nil
+}
+
+func (d *Database) compensationIndex(id string) int {
+	return slices.IndexFunc(d.compensations, func(c domain.StockCompensation) bool { return c.ID == id })
+}
+
+func (d *Database) CreateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.refunds[refund.OrderID]; exists {
+		return false, nil
+	}
+	d.refunds[refund.OrderID] = refund
+	return true, nil
+}
+
+func (d *Database) GetRefundByOrder(ctx context.Context, orderID string) (*domain.Refund, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	refund, ok := d.refunds[orderID]
+	if !ok {
+		return nil, nil
+	}
+	return &refund, nil
+}
+
+func (d *Database) StaleRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Refund, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var stale []domain.Refund
+	for _, refund := range d.refunds {
+		if refund.Step != domain.RefundStepDone && refund.UpdatedAt.Before(before) {
+			stale = append(stale, refund)
+		}
+	}
+	slices.SortFunc(stale, func(a, b domain.Refund) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	if len(stale) > limit {
+		stale = stale[:limit]
+	}
+	return stale, nil
+}
+
+func (d *Database) UpdateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.refunds[refund.OrderID]
+	if !ok || current.ID != refund.ID || current.Version != refund.Version {
+		return false, nil
+	}
+	refund.Version++
+	d.refunds[refund.OrderID] = refund
+	return true, nil
+}
+
+func (d *Database) RestockRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.refunds[refund.OrderID]
+	if !ok || current.ID != refund.ID || current.Version != refund.Version || current.Step != domain.RefundStepInventory {
+		return false, nil
+	}
+
+	if order, ok := d.orders[refund.OrderID]; ok {
+		if order.AllocationID != "" {
+			alloc := d.allocations[order.AllocationID]
+			alloc.Fulfilled -= order.Quantity
+			alloc.Status = domain.AllocationStatusOpen
+			alloc.UpdatedAt = refund.UpdatedAt
+			d.allocations[alloc.ID] = alloc
+		} else {
+			for _, line := range order.Lines() {
+				d.applyStockChange(line.ItemID, line.Quantity)
+				d.compensations = append(d.compensations, domain.StockCompensation{
+					ID:        uuid.New().String(),
+					ItemID:    line.ItemID,
+					Quantity:  line.Quantity,
+					Reason:    "refund " + refund.ID,
+					CreatedAt: refund.UpdatedAt,
+					UpdatedAt: refund.UpdatedAt,
+				})
+			}
+		}
+	}
+
+	current.Step = domain.RefundStepStatus
+	current.Attempts = 0
+	current.LastError = ""
+	current.Version++
+	current.UpdatedAt = refund.UpdatedAt
+	d.refunds[refund.OrderID] = current
+	return true, nil
+}
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestDatabase_CreateOrders_AllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+	db.SetInventory("item", 2)
+
+	orders := []domain.Order{
+		{ID: "o-1", ItemID: "item", Quantity: 1},
+		{ID: "o-2", ItemID: "item", Quantity: 1},
+		{ID: "o-3", ItemID: "item", Quantity: 1},
+	}
+
+	if err := db.CreateOrders(ctx, orders); !errors.Is(err, ErrOptimisticLock) {
+		t.Fatalf("expected ErrOptimisticLock, got: %v", err)
+	}
+	if len(db.Orders()) != 0 {
+		t.Errorf("expected no orders after failed batch, got %d", len(db.Orders()))
+	}
+
+	if err := db.CreateOrders(ctx, orders[:2]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inv, _ := db.GetInventory(ctx, "item")
+	if inv.Quantity != 0 {
+		t.Errorf("expected stock 0, got %d", inv.Quantity)
+	}
+}
+
+func TestDatabase_UpdateInventory_OptimisticLock(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+	db.SetInventory("item", 100)
+
+	inv, _ := db.GetInventory(ctx, "item")
+	inv.Quantity = 90
+	if err := db.UpdateInventory(ctx, *inv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Stale version
+	if err := db.UpdateInventory(ctx, *inv); !errors.Is(err, ErrOptimisticLock) {
+		t.Errorf("expected ErrOptimisticLock, got: %v", err)
+	}
+}
+
+func TestDatabase_Items(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+
+	for _, id := range []string{"b", "a"} {
+		created, err := db.CreateItem(ctx, domain.Item{ID: id, Name: id, Stock: 5})
+		if err != nil || !created {
+			t.Fatalf("create %s: created=%v err=%v", id, created, err)
+		}
+	}
+	if created, _ := db.CreateItem(ctx, domain.Item{ID: "a", Name: "again"}); created {
+		t.Error("expected duplicate item to be rejected")
+	}
+
+	// Stock follows the inventory row
+	if err := db.CreateOrder(ctx, domain.Order{ID: "o-1", ItemID: "a", Quantity: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	items, _ := db.ListItems(ctx)
+	if len(items) != 2 || items[0].ID != "a" || items[0].Stock != 3 {
+		t.Errorf("unexpected items: %+v", items)
+	}
+}
+
+func TestDatabase_ListOrdersByUser_Tenant(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+	db.SetInventory("item", 10)
+	orders := []domain.Order{
+		{ID: "o-1", TenantID: "acme", UserID: "u1", ItemID: "item", Quantity: 1, CreatedAt: time.Now()},
+		{ID: "o-2", TenantID: "globex", UserID: "u1", ItemID: "item", Quantity: 1, CreatedAt: time.Now()},
+	}
+	if err := db.CreateOrders(ctx, orders); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	acme, _ := db.ListOrdersByUser(port.WithTenant(ctx, "acme"), "u1", domain.OrderFilter{Limit: 10})
+	if len(acme) != 1 || acme[0].ID != "o-1" {
+		t.Errorf("acme orders = %+v, want o-1", acme)
+	}
+	// System work spans every tenant
+	if all, _ := db.ListOrdersByUser(ctx, "u1", domain.OrderFilter{Limit: 10}); len(all) != 2 {
+		t.Errorf("unscoped orders = %+v, want both", all)
+	}
+}
+
+func TestDatabase_Compensations(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+
+	db.RecordCompensation(ctx, domain.StockCompensation{ID: "c1", ItemID: "item-1", Quantity: 1})
+	db.RecordCompensation(ctx, domain.StockCompensation{ID: "c2", ItemID: "item-1", Quantity: 2})
+
+	if resolved, _ := db.ResolveCompensation(ctx, "c1", time.Now()); !resolved {
+		t.Error("expected first resolve to win")
+	}
+	if resolved, _ := db.ResolveCompensation(ctx, "c1", time.Now()); resolved {
+		t.Error("expected second resolve to lose")
+	}
+
+	pending, _ := db.PendingCompensations(ctx, 10)
+	if len(pending) != 1 || pending[0].ID != "c2" {
+		t.Errorf("unexpected pending: %+v", pending)
+	}
+
+	db.ReopenCompensation(ctx, "c1", "still down", time.Now())
+	pending, _ = db.PendingCompensations(ctx, 10)
+	if len(pending) != 2 || pending[0].ID != "c1" || pending[0].Attempts != 1 {
+		t.Errorf("expected c1 pending again, got %+v", pending)
+	}
+}
+
+func TestDatabase_RestockRefund(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+	db.SetInventory("item-1", 10)
+	db.CreateOrder(ctx, domain.Order{ID: "order-1", ItemID: "item-1", Quantity: 3, Status: domain.OrderStatusConfirmed})
+
+	refund := domain.Refund{ID: "refund-1", OrderID: "order-1", Step: domain.RefundStepInventory}
+	if created, _ := db.CreateRefund(ctx, refund); !created {
+		t.Fatal("expected the refund created")
+	}
+	if created, _ := db.CreateRefund(ctx, domain.Refund{ID: "refund-2", OrderID: "order-1"}); created {
+		t.Error("expected one refund per order")
+	}
+
+	if ok, _ := db.RestockRefund(ctx, refund); !ok {
+		t.Fatal("expected the restock to apply")
+	}
+	// The version moved on, so a second restock loses
+	if ok, _ := db.RestockRefund(ctx, refund); ok {
+		t.Error("expected a stale restock to lose")
+	}
+
+	if inv, _ := db.GetInventory(ctx, "item-1"); inv.Quantity != 10 {
+		t.Errorf("expected inventory 10, got %d", inv.Quantity)
+	}
+	pending, _ := db.PendingCompensations(ctx, 10)
+	if len(pending) != 1 || pending[0].Quantity != 3 {
+		t.Errorf("expected the cache units logged, got %+v", pending)
+	}
+	stored, _ := db.GetRefundByOrder(ctx, "order-1")
+	if stored.Step != domain.RefundStepStatus || stored.Version != 1 {
+		t.Errorf("unexpected refund: %+v", stored)
+	}
+}
+
+func TestDatabase_ArchiveOrders(t *testing.T) {
+	ctx := context.Background()
+	db := NewDatabase()
+	db.SetInventory("item", 10)
+	now := time.Now()
+
+	db.CreateOrders(ctx, []domain.Order{
+		{ID: "old", ItemID: "item", Quantity: 1, Status: domain.OrderStatusConfirmed, CreatedAt: now.Add(-time.Hour)},
+		{ID: "held", ItemID: "item", Quantity: 1, Status: domain.OrderStatusPending, CreatedAt: now.Add(-time.Hour), ExpiresAt: now},
+		{ID: "new", ItemID: "item", Quantity: 1, Status: domain.OrderStatusConfirmed, CreatedAt: now},
+	})
+
+	if n, err := db.ArchiveOrders(ctx, now.Add(-time.Minute), 10); err != nil || n != 1 {
+		t.Fatalf("expected one order archived, got %d, %v", n, err)
+	}
+	if order, _ := db.GetOrder(ctx, "old"); order != nil {
+		t.Error("expected the archived order gone")
+	}
+	if archived := db.ArchivedOrders(); len(archived) != 1 || archived[0].ID != "old" {
+		t.Errorf("unexpected archive: %+v", archived)
+	}
+}
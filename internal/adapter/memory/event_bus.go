@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// EventBus delivers events to the handlers subscribed in this process.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[domain.EventType][]func(context.Context, domain.Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[domain.EventType][]func(context.Context, domain.Event))}
+}
+
+func (b *EventBus) Publish(ctx context.Context, event domain.Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.EventType()]
+	b.mu.RUnlock()
+
+	for _, handle := range handlers {
+		handle(ctx, event)
+	}
+}
+
+func (b *EventBus) Subscribe(eventType domain.EventType, handle func(context.Context, domain.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// Publish reads the slice without the lock, so it is never appended to in place
+	handlers := b.handlers[eventType]
+	b.handlers[eventType] = append(handlers[:len(handlers):len(handlers)], handle)
+}
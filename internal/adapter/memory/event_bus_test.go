@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	var got []string
+	bus.Subscribe(domain.EventOrderPersisted, func(ctx context.Context, event domain.Event) {
+		got = append(got, "first:"+event.EventKey())
+	})
+	bus.Subscribe(domain.EventOrderPersisted, func(ctx context.Context, event domain.Event) {
+		got = append(got, "second:"+event.EventKey())
+	})
+
+	bus.Publish(context.Background(), domain.OrderPersisted{OrderSummary: domain.OrderSummary{OrderID: "order-1"}})
+	bus.Publish(context.Background(), domain.StockDepleted{ItemID: "item-1"})
+
+	if len(got) != 2 || got[0] != "first:order-1" || got[1] != "second:order-1" {
+		t.Errorf("expected both handlers to get order-1 in order, got %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Locker is an in-memory port.Locker for a single process.
+type Locker struct {
+	mu    sync.Mutex
+	locks map[string]lockEntry
+	next  uint64
+	now   func() time.Time
+}
+
+type lockEntry struct {
+	token     uint64
+	expiresAt time.Time
+}
+
+func NewLocker() *Locker {
+	return &Locker{locks: make(map[string]lockEntry), now: time.Now}
+}
+
+func (l *Locker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(context.Context) error, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.locks[name]; ok && l.now().Before(entry.expiresAt) {
+		return nil, false, nil
+	}
+	l.next++
+	token := l.next
+	l.locks[name] = lockEntry{token: token, expiresAt: l.now().Add(ttl)}
+
+	release := func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if entry, ok := l.locks[name]; ok && entry.token == token {
+			delete(l.locks, name)
+		}
+		return nil
+	}
+	return release, true, nil
+}
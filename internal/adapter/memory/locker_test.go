@@ -0,0 +1,33 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocker_TryLock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	locker := NewLocker()
+	locker.now = func() time.Time { return now }
+
+	release, ok, _ := locker.TryLock(ctx, "a", time.Second)
+	if !ok {
+		t.Fatal("expected first lock to succeed")
+	}
+	if _, ok, _ := locker.TryLock(ctx, "a", time.Second); ok {
+		t.Error("expected held lock to be refused")
+	}
+
+	// An expired lock can be taken over, and the old holder can't release it
+	now = now.Add(2 * time.Second)
+	_, ok, _ = locker.TryLock(ctx, "a", time.Second)
+	if !ok {
+		t.Fatal("expected expired lock to be acquired")
+	}
+	release(ctx)
+	if _, ok, _ := locker.TryLock(ctx, "a", time.Second); ok {
+		t.Error("stale release must not free the new holder's lock")
+	}
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter is a per-key token bucket limiter held in process memory, so
+// each server instance enforces its own limit.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	idleTTL   time.Duration
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	// A bucket idle for this long has refilled, so dropping it changes nothing
+	idleTTL := time.Minute
+	if refill := time.Duration(float64(burst) / perSecond * float64(time.Second)); refill > idleTTL {
+		idleTTL = refill
+	}
+	return &RateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		idleTTL: idleTTL,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > l.idleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	// Reserve to learn the wait, then hand the token back if it is not free now
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay, nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_PerKeyBurst(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	limiter := NewRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := limiter.Allow(ctx, "user-1"); !ok {
+			t.Fatalf("request %d should be within burst", i)
+		}
+	}
+	if ok, retryAfter, _ := limiter.Allow(ctx, "user-1"); ok || retryAfter != time.Second {
+		t.Errorf("expected third request to be limited for 1s, got ok=%v retry after %v", ok, retryAfter)
+	}
+	if ok, _, _ := limiter.Allow(ctx, "user-2"); !ok {
+		t.Error("other users should have their own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _, _ := limiter.Allow(ctx, "user-1"); !ok {
+		t.Error("expected a token after one second")
+	}
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow(ctx, "user-1")
+	now = now.Add(2 * time.Minute)
+	limiter.Allow(ctx, "user-2")
+
+	if _, ok := limiter.buckets["user-1"]; ok {
+		t.Error("expected idle bucket to be evicted")
+	}
+}
@@ -0,0 +1,65 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// KafkaEventBus delivers events to the subscribers in this process through
+// the local bus, and also writes every event to a Kafka topic for consumers
+// outside the server, such as webhook dispatchers or analytics. Writes are
+// batched in the background so publishing never waits on the broker; events
+// that cannot be written are logged and dropped.
+type KafkaEventBus struct {
+	port.EventBus
+	writer *kafka.Writer
+}
+
+// eventMessage is the JSON written to the topic, keyed by the event's key
+// so the events of one order or item stay in order.
+type eventMessage struct {
+	Type domain.EventType `json:"type"`
+	Data domain.Event     `json:"data"`
+}
+
+func NewKafkaEventBus(local port.EventBus, brokers []string, topic string) *KafkaEventBus {
+	return &KafkaEventBus{
+		EventBus: local,
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+			Async:    true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Printf("sale events: %d events not written: %v", len(messages), err)
+				}
+			},
+		},
+	}
+}
+
+func (k *KafkaEventBus) Publish(ctx context.Context, event domain.Event) {
+	k.EventBus.Publish(ctx, event)
+
+	value, err := json.Marshal(eventMessage{Type: event.EventType(), Data: event})
+	if err != nil {
+		log.Printf("sale events: encode %s: %v", event.EventType(), err)
+		return
+	}
+	msg := kafka.Message{Key: []byte(event.EventKey()), Value: value}
+	if err := k.writer.WriteMessages(context.WithoutCancel(ctx), msg); err != nil {
+		log.Printf("sale events: write %s: %v", event.EventType(), err)
+	}
+}
+
+// Close writes the events still buffered and closes the connection.
+func (k *KafkaEventBus) Close() error {
+	return k.writer.Close()
+}
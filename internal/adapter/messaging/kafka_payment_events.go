@@ -0,0 +1,88 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+const (
+	handleAttempts = 5
+	handleBackoff  = 500 * time.Millisecond
+)
+
+// KafkaPaymentEvents reads payment events from a Kafka topic as part of a
+// consumer group. Offsets are committed only after an event is handled, so
+// events in flight during a restart are redelivered.
+type KafkaPaymentEvents struct {
+	reader *kafka.Reader
+}
+
+func NewKafkaPaymentEvents(brokers []string, topic, groupID string) *KafkaPaymentEvents {
+	return &KafkaPaymentEvents{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: groupID,
+		}),
+	}
+}
+
+func (k *KafkaPaymentEvents) Consume(ctx context.Context, handle func(context.Context, domain.PaymentEvent) error) error {
+	for {
+		msg, err := k.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch message: %w", err)
+		}
+
+		var event domain.PaymentEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Printf("payment events: skipping malformed message at %d/%d: %v", msg.Partition, msg.Offset, err)
+		} else if err := handleWithRetry(ctx, handle, event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("payment events: giving up on order %s: %v", event.OrderID, err)
+		}
+
+		if err := k.reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit message: %w", err)
+		}
+	}
+}
+
+func (k *KafkaPaymentEvents) Close() error {
+	return k.reader.Close()
+}
+
+// handleWithRetry retries failed events with exponential backoff. Most
+// failures are events racing ahead of the order worker.
+func handleWithRetry(ctx context.Context, handle func(context.Context, domain.PaymentEvent) error, event domain.PaymentEvent) error {
+	backoff := handleBackoff
+	var err error
+	for attempt := 0; attempt < handleAttempts; attempt++ {
+		if err = handle(ctx, event); err == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
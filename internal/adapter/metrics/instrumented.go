@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// InstrumentedCache records the latency of every CacheRepository call.
+type InstrumentedCache struct {
+	next    port.CacheRepository
+	metrics *Prometheus
+}
+
+func NewInstrumentedCache(next port.CacheRepository, metrics *Prometheus) *InstrumentedCache {
+	return &InstrumentedCache{next: next, metrics: metrics}
+}
+
+func (c *InstrumentedCache) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	defer c.metrics.observeRedis(ctx, "decrement_stock", time.Now())
+	return c.next.DecrementStock(ctx, itemID, quantity)
+}
+
+func (c *InstrumentedCache) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	defer c.metrics.observeRedis(ctx, "decrement_stocks", time.Now())
+	return c.next.DecrementStocks(ctx, lines)
+}
+
+func (c *InstrumentedCache) GetStock(ctx context.Context, itemID string) (int, error) {
+	defer c.metrics.observeRedis(ctx, "get_stock", time.Now())
+	return c.next.GetStock(ctx, itemID)
+}
+
+func (c *InstrumentedCache) SetStock(ctx context.Context, itemID string, quantity int) error {
+	defer c.metrics.observeRedis(ctx, "set_stock", time.Now())
+	return c.next.SetStock(ctx, itemID, quantity)
+}
+
+func (c *InstrumentedCache) IncrementStock(ctx context.Context, itemID string, quantity int) error {
+	defer c.metrics.observeRedis(ctx, "increment_stock", time.Now())
+	return c.next.IncrementStock(ctx, itemID, quantity)
+}
+
+func (c *InstrumentedCache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	defer c.metrics.observeRedis(ctx, "set_idempotency", time.Now())
+	return c.next.SetIdempotency(ctx, key, ttl)
+}
+
+func (c *InstrumentedCache) ReleaseIdempotency(ctx context.Context, key string) error {
+	defer c.metrics.observeRedis(ctx, "release_idempotency", time.Now())
+	return c.next.ReleaseIdempotency(ctx, key)
+}
+
+func (c *InstrumentedCache) SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) error {
+	defer c.metrics.observeRedis(ctx, "set_idempotency_result", time.Now())
+	return c.next.SetIdempotencyResult(ctx, key, result)
+}
+
+func (c *InstrumentedCache) GetIdempotencyResult(ctx context.Context, key string) (*domain.PurchaseResult, error) {
+	defer c.metrics.observeRedis(ctx, "get_idempotency_result", time.Now())
+	return c.next.GetIdempotencyResult(ctx, key)
+}
+
+// InstrumentedDatabase records the latency of every DatabaseRepository call.
+type InstrumentedDatabase struct {
+	next    port.DatabaseRepository
+	metrics *Prometheus
+}
+
+func NewInstrumentedDatabase(next port.DatabaseRepository, metrics *Prometheus) *InstrumentedDatabase {
+	return &InstrumentedDatabase{next: next, metrics: metrics}
+}
+
+func (d *InstrumentedDatabase) CreateOrder(ctx context.Context, order domain.Order) error {
+	defer d.metrics.observeMySQL(ctx, "create_order", time.Now())
+	return d.next.CreateOrder(ctx, order)
+}
+
+func (d *InstrumentedDatabase) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	defer d.metrics.observeMySQL(ctx, "create_orders", time.Now())
+	return d.next.CreateOrders(ctx, orders)
+}
+
+func (d *InstrumentedDatabase) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	defer d.metrics.observeMySQL(ctx, "get_order", time.Now())
+	return d.next.GetOrder(ctx, id)
+}
+
+func (d *InstrumentedDatabase) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "update_order_status", time.Now())
+	return d.next.UpdateOrderStatus(ctx, id, from, to)
+}
+
+func (d *InstrumentedDatabase) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "confirm_order", time.Now())
+	return d.next.ConfirmOrder(ctx, id, paymentID)
+}
+
+func (d *InstrumentedDatabase) ExpiredOrders(ctx context.Context, before time.Time, limit int) ([]domain.Order, error) {
+	defer d.metrics.observeMySQL(ctx, "expired_orders", time.Now())
+	return d.next.ExpiredOrders(ctx, before, limit)
+}
+
+func (d *InstrumentedDatabase) ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	defer d.metrics.observeMySQL(ctx, "list_orders_by_user", time.Now())
+	return d.next.ListOrdersByUser(ctx, userID, filter)
+}
+
+func (d *InstrumentedDatabase) ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) ([]domain.Order, error) {
+	defer d.metrics.observeMySQL(ctx, "list_orders_after", time.Now())
+	return d.next.ListOrdersAfter(ctx, window, afterID, limit)
+}
+
+func (d *InstrumentedDatabase) SaveCampaignArchive(ctx context.Context, archive domain.CampaignArchive) error {
+	defer d.metrics.observeMySQL(ctx, "save_campaign_archive", time.Now())
+	return d.next.SaveCampaignArchive(ctx, archive)
+}
+
+func (d *InstrumentedDatabase) CreateItem(ctx context.Context, item domain.Item) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "create_item", time.Now())
+	return d.next.CreateItem(ctx, item)
+}
+
+func (d *InstrumentedDatabase) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	defer d.metrics.observeMySQL(ctx, "get_item", time.Now())
+	return d.next.GetItem(ctx, id)
+}
+
+func (d *InstrumentedDatabase) ListItems(ctx context.Context) ([]domain.Item, error) {
+	defer d.metrics.observeMySQL(ctx, "list_items", time.Now())
+	return d.next.ListItems(ctx)
+}
+
+func (d *InstrumentedDatabase) UpdateItem(ctx context.Context, item domain.Item) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "update_item", time.Now())
+	return d.next.UpdateItem(ctx, item)
+}
+
+func (d *InstrumentedDatabase) CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "create_campaign", time.Now())
+	return d.next.CreateCampaign(ctx, campaign)
+}
+
+func (d *InstrumentedDatabase) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	defer d.metrics.observeMySQL(ctx, "get_campaign", time.Now())
+	return d.next.GetCampaign(ctx, id)
+}
+
+func (d *InstrumentedDatabase) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	defer d.metrics.observeMySQL(ctx, "list_campaigns", time.Now())
+	return d.next.ListCampaigns(ctx)
+}
+
+func (d *InstrumentedDatabase) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	defer d.metrics.observeMySQL(ctx, "update_campaign", time.Now())
+	return d.next.UpdateCampaign(ctx, campaign)
+}
+
+func (d *InstrumentedDatabase) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error {
+	defer d.metrics.observeMySQL(ctx, "restock_inventory", time.Now())
+	return d.next.RestockInventory(ctx, inv, restock)
+}
+
+func (d *InstrumentedDatabase) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
+	defer d.metrics.observeMySQL(ctx, "get_inventory", time.Now())
+	return d.next.GetInventory(ctx, itemID)
+}
+
+func (d *InstrumentedDatabase) UpdateInventory(ctx context.Context, inventory domain.Inventory) error {
+	defer d.metrics.observeMySQL(ctx, "update_inventory", time.Now())
+	return d.next.UpdateInventory(ctx, inventory)
+}
+
+func (d *InstrumentedDatabase) CreateAllocation(ctx context.Context, allocation domain.Allocation) error {
+	defer d.metrics.observeMySQL(ctx, "create_allocation", time.Now())
+	return d.next.CreateAllocation(ctx, allocation)
+}
+
+func (d *InstrumentedDatabase) GetAllocation(ctx context.Context, id string) (*domain.Allocation, error) {
+	defer d.metrics.observeMySQL(ctx, "get_allocation", time.Now())
+	return d.next.GetAllocation(ctx, id)
+}
+
+func (d *InstrumentedDatabase) FulfillAllocation(ctx context.Context, order domain.Order) error {
+	defer d.metrics.observeMySQL(ctx, "fulfill_allocation", time.Now())
+	return d.next.FulfillAllocation(ctx, order)
+}
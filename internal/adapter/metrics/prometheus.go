@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const namespace = "flashsale"
+
+// Prometheus implements port.Metrics and exposes dependency latency
+// histograms used by the instrumented repositories.
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	purchases        *prometheus.CounterVec
+	purchaseDuration *prometheus.HistogramVec
+	ordersPersisted  prometheus.Counter
+	ordersFailed     prometheus.Counter
+	stageTimeouts    *prometheus.CounterVec
+	redisDuration    *prometheus.HistogramVec
+	mysqlDuration    *prometheus.HistogramVec
+	jobDuration      *prometheus.HistogramVec
+	jobFailures      *prometheus.CounterVec
+
+	slowLog   *slog.Logger
+	slowRedis time.Duration
+	slowMySQL time.Duration
+}
+
+// Option configures Prometheus.
+type Option func(*Prometheus)
+
+// WithSlowCallLog logs a warning to logger, naming the operation, for every
+// Redis or MySQL call slower than that dependency's threshold. A threshold
+// of 0 logs none of its calls.
+func WithSlowCallLog(logger *slog.Logger, redis, mysql time.Duration) Option {
+	return func(p *Prometheus) {
+		p.slowLog = logger
+		p.slowRedis = redis
+		p.slowMySQL = mysql
+	}
+}
+
+func NewPrometheus(opts ...Option) *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		purchases: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "purchases_total",
+			Help:      "Purchase attempts by outcome.",
+		}, []string{"outcome"}),
+		purchaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "purchase_duration_seconds",
+			Help:      "Latency of purchase attempts by outcome.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"outcome"}),
+		ordersPersisted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_persisted_total",
+			Help:      "Orders saved to the database by workers.",
+		}),
+		ordersFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_failed_total",
+			Help:      "Orders that could not be saved and had their stock rolled back.",
+		}),
+		stageTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_timeouts_total",
+			Help:      "Purchase stages that missed their deadline.",
+		}, []string{"stage"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "redis_duration_seconds",
+			Help:      "Latency of Redis operations.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		mysqlDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mysql_duration_seconds",
+			Help:      "Latency of MySQL operations.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of scheduled background job runs.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+		}, []string{"job"}),
+		jobFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "job_failures_total",
+			Help:      "Scheduled background job runs that failed.",
+		}, []string{"job"}),
+	}
+
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.purchases,
+		p.purchaseDuration,
+		p.ordersPersisted,
+		p.ordersFailed,
+		p.stageTimeouts,
+		p.redisDuration,
+		p.mysqlDuration,
+		p.jobDuration,
+		p.jobFailures,
+	)
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// RegisterQueueDepth exposes the order queue depth as a gauge.
+func (p *Prometheus) RegisterQueueDepth(depth func() int) {
+	p.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "order_queue_depth",
+		Help:      "Orders waiting to be persisted.",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
+
+// RegisterConcurrencyLimit exposes the purchases allowed in flight as a
+// gauge.
+func (p *Prometheus) RegisterConcurrencyLimit(limit func() int) {
+	p.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "concurrency_limit",
+		Help:      "Purchases allowed in flight by the adaptive concurrency limit.",
+	}, func() float64 {
+		return float64(limit())
+	}))
+}
+
+// RegisterWorkerCount exposes the number of running order workers as a
+// gauge.
+func (p *Prometheus) RegisterWorkerCount(count func() int) {
+	p.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "order_workers",
+		Help:      "Workers persisting queued orders.",
+	}, func() float64 {
+		return float64(count())
+	}))
+}
+
+// Handler serves the metrics in the Prometheus exposition format. Scrapers
+// that negotiate OpenMetrics also receive trace exemplars.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{
+		Registry:          p.registry,
+		EnableOpenMetrics: true,
+	})
+}
+
+func (p *Prometheus) PurchaseCompleted(ctx context.Context, outcome string, duration time.Duration) {
+	p.purchases.WithLabelValues(outcome).Inc()
+	observe(ctx, p.purchaseDuration.WithLabelValues(outcome), duration)
+}
+
+func (p *Prometheus) OrdersPersisted(count int) {
+	p.ordersPersisted.Add(float64(count))
+}
+
+func (p *Prometheus) OrderFailed() {
+	p.ordersFailed.Inc()
+}
+
+func (p *Prometheus) StageTimedOut(stage string) {
+	p.stageTimeouts.WithLabelValues(stage).Inc()
+}
+
+func (p *Prometheus) JobCompleted(job string, duration time.Duration, failed bool) {
+	p.jobDuration.WithLabelValues(job).Observe(duration.Seconds())
+	if failed {
+		p.jobFailures.WithLabelValues(job).Inc()
+	}
+}
+
+func (p *Prometheus) observeRedis(ctx context.Context, operation string, start time.Time) {
+	d := time.Since(start)
+	observe(ctx, p.redisDuration.WithLabelValues(operation), d)
+	p.logSlowCall(ctx, "redis", operation, d, p.slowRedis)
+}
+
+func (p *Prometheus) observeMySQL(ctx context.Context, operation string, start time.Time) {
+	d := time.Since(start)
+	observe(ctx, p.mysqlDuration.WithLabelValues(operation), d)
+	p.logSlowCall(ctx, "mysql", operation, d, p.slowMySQL)
+}
+
+// logSlowCall warns of a dependency call that took longer than threshold,
+// with the trace ID when the trace is sampled.
+func (p *Prometheus) logSlowCall(ctx context.Context, dependency, operation string, d, threshold time.Duration) {
+	if p.slowLog == nil || threshold <= 0 || d <= threshold {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("dependency", dependency),
+		slog.String("operation", operation),
+		slog.Duration("duration", d),
+		slog.Duration("threshold", threshold),
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsSampled() {
+		attrs = append(attrs, slog.String("trace_id", spanCtx.TraceID().String()))
+	}
+	p.slowLog.LogAttrs(ctx, slog.LevelWarn, "slow dependency call", attrs...)
+}
+
+// observe records d, attaching the trace ID from ctx as an exemplar when the
+// trace is sampled so dashboards can link to it.
+func observe(ctx context.Context, o prometheus.Observer, d time.Duration) {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && spanCtx.IsSampled() {
+		eo.ObserveWithExemplar(d.Seconds(), prometheus.Labels{"trace_id": spanCtx.TraceID().String()})
+		return
+	}
+	o.Observe(d.Seconds())
+}
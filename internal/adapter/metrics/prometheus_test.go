@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPrometheus_PurchaseOutcomes(t *testing.T) {
+	p := NewPrometheus()
+
+	ctx := context.Background()
+	p.PurchaseCompleted(ctx, "success", time.Millisecond)
+	p.PurchaseCompleted(ctx, "success", time.Millisecond)
+	p.PurchaseCompleted(ctx, "sold_out", time.Millisecond)
+
+	if got := testutil.ToFloat64(p.purchases.WithLabelValues("success")); got != 2 {
+		t.Errorf("expected 2 successes, got %v", got)
+	}
+	if got := testutil.ToFloat64(p.purchases.WithLabelValues("sold_out")); got != 1 {
+		t.Errorf("expected 1 sold out, got %v", got)
+	}
+}
+
+func TestPrometheus_Handler(t *testing.T) {
+	p := NewPrometheus()
+	p.RegisterQueueDepth(func() int { return 7 })
+	p.RegisterWorkerCount(func() int { return 4 })
+	p.RegisterConcurrencyLimit(func() int { return 50 })
+	p.OrdersPersisted(3)
+	p.StageTimedOut("decrement")
+	p.JobCompleted("hold-sweep", time.Second, true)
+
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, want := range []string{
+		"flashsale_order_queue_depth 7",
+		"flashsale_order_workers 4",
+		"flashsale_concurrency_limit 50",
+		"flashsale_orders_persisted_total 3",
+		`flashsale_stage_timeouts_total{stage="decrement"} 1`,
+		`flashsale_job_failures_total{job="hold-sweep"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in metrics output", want)
+		}
+	}
+}
+
+func TestPrometheus_TraceExemplar(t *testing.T) {
+	p := NewPrometheus()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	p.PurchaseCompleted(ctx, "success", 3*time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+
+	if !strings.Contains(string(body), `trace_id="4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Error("expected trace exemplar in OpenMetrics output")
+	}
+}
+
+func TestPrometheus_SlowCallLog(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrometheus(WithSlowCallLog(slog.New(slog.NewJSONHandler(&buf, nil)), 50*time.Millisecond, 0))
+
+	ctx := context.Background()
+	p.observeRedis(ctx, "get_stock", time.Now())
+	p.observeRedis(ctx, "decrement_stock", time.Now().Add(-100*time.Millisecond))
+	// MySQL calls are not logged with a threshold of 0
+	p.observeMySQL(ctx, "create_orders", time.Now().Add(-time.Minute))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one slow call logged, got %q", buf.String())
+	}
+	var entry struct {
+		Level      string `json:"level"`
+		Dependency string `json:"dependency"`
+		Operation  string `json:"operation"`
+		Duration   int64  `json:"duration"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != "WARN" || entry.Dependency != "redis" || entry.Operation != "decrement_stock" ||
+		time.Duration(entry.Duration) < 100*time.Millisecond {
+		t.Errorf("unexpected log entry %+v", entry)
+	}
+	if got := testutil.CollectAndCount(p.redisDuration); got != 2 {
+		t.Errorf("expected both Redis calls observed, got %d series", got)
+	}
+}
@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"log"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// Log writes notifications to the server log instead of sending them, for
+// development and for deployments that have no channel to users yet.
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Notify(ctx context.Context, notification domain.Notification) error {
+	log.Printf("notify %s of %s for order %s: %s", notification.UserID, notification.Kind, notification.OrderID, notification.Subject)
+	return nil
+}
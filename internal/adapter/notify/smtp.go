@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// SMTPSettings configures the mail server notifications are sent through.
+type SMTPSettings struct {
+	// Addr is the server's host:port
+	Addr     string
+	Username string
+	Password string
+	From     string
+	// To is the recipient address with {user} standing for the user ID,
+	// e.g. "{user}@users.example.com", or just "{user}" when user IDs are
+	// email addresses
+	To string
+}
+
+// SMTP emails notifications to users. Servers that offer STARTTLS are
+// upgraded to it; credentials are only sent over TLS or to localhost.
+type SMTP struct {
+	settings SMTPSettings
+}
+
+func NewSMTP(settings SMTPSettings) *SMTP {
+	return &SMTP{settings: settings}
+}
+
+func (s *SMTP) Notify(ctx context.Context, notification domain.Notification) error {
+	to := strings.ReplaceAll(s.settings.To, "{user}", notification.UserID)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.settings.Addr)
+	if err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.settings.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if s.settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.settings.Username, s.settings.Password, host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(s.settings.From); err != nil {
+		return fmt.Errorf("smtp sender: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp recipient %s: %w", to, err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(message(s.settings.From, to, notification, time.Now())); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return client.Quit()
+}
+
+// message formats a notification as a plain text email.
+func message(from, to string, notification domain.Notification, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
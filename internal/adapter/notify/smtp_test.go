@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// fakeSMTP accepts one mail on a local port and returns what it received.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var envelope strings.Builder
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 fake")
+			case "MAIL", "RCPT":
+				envelope.WriteString(line + "\n")
+				text.PrintfLine("250 ok")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, _ := text.ReadDotBytes()
+				envelope.Write(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				received <- envelope.String()
+				return
+			default:
+				text.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTP_Notify(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	notifier := NewSMTP(SMTPSettings{Addr: addr, From: "sale@example.com", To: "{user}@users.example.com"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := notifier.Notify(ctx, domain.Notification{UserID: "user-1", OrderID: "order-1", Subject: "You got one!", Body: "You got 1 x iphone-15!"})
+	if err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	mail := <-received
+	for _, want := range []string{"MAIL FROM:<sale@example.com>", "RCPT TO:<user-1@users.example.com>", "Subject: You got one!", "You got 1 x iphone-15!"} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("expected %q in mail:\n%s", want, mail)
+		}
+	}
+}
+
+func TestSMTP_Unreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if err := NewSMTP(SMTPSettings{Addr: addr, From: "sale@example.com", To: "{user}"}).Notify(context.Background(), domain.Notification{UserID: "a@example.com"}); err == nil {
+		t.Error("expected an error without a mail server")
+	}
+}
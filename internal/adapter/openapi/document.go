@@ -0,0 +1,199 @@
+// Package openapi builds OpenAPI 3 documents from Go types and checks
+// requests and responses against them.
+package openapi
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version documents are written in.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Paths are relative to the first server.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	// schemas reflects Go types into Components
+	schemas *reflector
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path, by lowercase method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter. Path parameters are
+// always required.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Response is a response of an operation, keyed by status code or
+// "default" in Operation.Responses.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	In   string `json:"in,omitempty"`
+}
+
+// New returns an empty document.
+func New(info Info, servers ...Server) *Document {
+	d := &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Servers:    servers,
+		Paths:      make(map[string]*PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+	d.schemas = &reflector{components: d.Components.Schemas}
+	return d
+}
+
+// Add documents op as method on path, a template such as
+// "/orders/{id}/confirm". Path parameters are added to op unless it
+// declares them.
+func (d *Document) Add(method, path string, op *Operation) {
+	for _, segment := range strings.Split(path, "/") {
+		name, ok := pathParam(segment)
+		if ok && op.parameter("path", name) == nil {
+			op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	item := d.Paths[path]
+	if item == nil {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Schema returns the schema of values like v, adding named struct types to
+// the document's components.
+func (d *Document) Schema(v any) *Schema {
+	return d.schemas.schemaOf(v)
+}
+
+// JSON is content of the media type application/json with the schema of
+// values like v.
+func (d *Document) JSON(v any) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: d.Schema(v)}}
+}
+
+// Find returns the operation that serves method on path, an escaped path
+// as from url.URL.EscapedPath, with the values of its path parameters.
+// Literal segments are preferred over parameters. A path that is
+// documented for other methods returns a nil operation and true.
+func (d *Document) Find(method, path string) (*Operation, map[string]string, bool) {
+	segments := strings.Split(path, "/")
+	var best string
+	var bestParams map[string]string
+	bestLiterals := -1
+	for template := range d.Paths {
+		params, literals, ok := matchPath(strings.Split(template, "/"), segments)
+		if ok && (literals > bestLiterals || literals == bestLiterals && template < best) {
+			best, bestParams, bestLiterals = template, params, literals
+		}
+	}
+	if bestLiterals < 0 {
+		return nil, nil, false
+	}
+	return (*d.Paths[best])[strings.ToLower(method)], bestParams, true
+}
+
+func matchPath(template, segments []string) (map[string]string, int, bool) {
+	if len(template) != len(segments) {
+		return nil, 0, false
+	}
+	params := make(map[string]string)
+	literals := 0
+	for i, t := range template {
+		if name, ok := pathParam(t); ok {
+			value, err := url.PathUnescape(segments[i])
+			if err != nil || value == "" {
+				return nil, 0, false
+			}
+			params[name] = value
+			continue
+		}
+		if t != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return params, literals, true
+}
+
+func pathParam(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func (op *Operation) parameter(in, name string) *Parameter {
+	for _, p := range op.Parameters {
+		if p.In == in && p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Response returns the documented response for status, falling back to
+// the default response.
+func (op *Operation) Response(status int) *Response {
+	if resp, ok := op.Responses[strconv.Itoa(status)]; ok {
+		return resp
+	}
+	return op.Responses["default"]
+}
@@ -0,0 +1,214 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type LineHTTP struct {
+	ItemID   string `json:"item_id"`
+	Quantity int32  `json:"quantity"`
+}
+
+type OrderHTTPRequest struct {
+	UserID string     `json:"user_id"`
+	Note   string     `json:"note,omitempty"`
+	Lines  []LineHTTP `json:"lines,omitempty"`
+	Gift   *LineHTTP  `json:"gift"`
+	At     time.Time  `json:"at,omitempty"`
+	Hidden string     `json:"-"`
+}
+
+type Tree struct {
+	Children []Tree `json:"children"`
+}
+
+func testDocument() *Document {
+	doc := New(Info{Title: "test", Version: "1"})
+	doc.Add(http.MethodPost, "/users/{user_id}/orders", &Operation{
+		OperationID: "createOrder",
+		Parameters:  []*Parameter{{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Format: "int32"}}},
+		RequestBody: &RequestBody{Required: true, Content: doc.JSON(OrderHTTPRequest{})},
+		Responses: map[string]*Response{
+			"201":     {Description: "created", Content: doc.JSON(LineHTTP{})},
+			"204":     {Description: "nothing"},
+			"default": {Description: "error", Content: doc.JSON(map[string]string{})},
+		},
+	})
+	doc.Add(http.MethodGet, "/users/me/orders", &Operation{OperationID: "myOrders"})
+	return doc
+}
+
+func TestSchema(t *testing.T) {
+	doc := testDocument()
+
+	order := doc.Components.Schemas["OrderRequest"]
+	if order == nil {
+		t.Fatalf("expected OrderRequest component, got %v", reflect.ValueOf(doc.Components.Schemas).MapKeys())
+	}
+	if want := []string{"user_id", "gift"}; !reflect.DeepEqual(order.Required, want) {
+		t.Errorf("expected required %v, got %v", want, order.Required)
+	}
+	if _, ok := order.Properties["Hidden"]; ok {
+		t.Error("expected fields tagged - to be left out")
+	}
+	if at := order.Properties["at"]; at.Type != "string" || at.Format != "date-time" {
+		t.Errorf("expected times as date-time strings, got %+v", at)
+	}
+	if lines := order.Properties["lines"]; lines.Type != "array" || !lines.Nullable || lines.Items.Ref != refPrefix+"Line" {
+		t.Errorf("expected a nullable array of Line, got %+v", lines)
+	}
+	if gift := order.Properties["gift"]; !gift.Nullable || len(gift.AllOf) != 1 || gift.AllOf[0].Ref != refPrefix+"Line" {
+		t.Errorf("expected a nullable reference to Line, got %+v", gift)
+	}
+	if q := doc.Components.Schemas["Line"].Properties["quantity"]; q.Type != "integer" || q.Format != "int32" {
+		t.Errorf("expected an int32, got %+v", q)
+	}
+
+	tree := doc.Schema(Tree{})
+	if tree.Ref != refPrefix+"openapi.Tree" {
+		t.Fatalf("expected a package-qualified reference, got %q", tree.Ref)
+	}
+	if items := doc.Components.Schemas["openapi.Tree"].Properties["children"].Items; items.Ref != tree.Ref {
+		t.Errorf("expected a recursive reference, got %+v", items)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("marshal document: %v", err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	doc := testDocument()
+
+	tests := []struct {
+		method, path string
+		want         string
+		params       map[string]string
+		found        bool
+	}{
+		{http.MethodPost, "/users/u%2F1/orders", "createOrder", map[string]string{"user_id": "u/1"}, true},
+		{http.MethodGet, "/users/me/orders", "myOrders", map[string]string{}, true},
+		{http.MethodGet, "/users/u1/orders", "", nil, true},
+		{http.MethodPost, "/users//orders", "", nil, false},
+		{http.MethodPost, "/orders", "", nil, false},
+	}
+	for _, tt := range tests {
+		op, params, found := doc.Find(tt.method, tt.path)
+		var got string
+		if op != nil {
+			got = op.OperationID
+		}
+		if got != tt.want || found != tt.found || tt.params != nil && !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("%s %s: expected %q %v %v, got %q %v %v", tt.method, tt.path, tt.want, tt.params, tt.found, got, params, found)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	doc := testDocument()
+	least := 1.0
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{
+		"count":  {Type: "integer", Minimum: &least},
+		"color":  {Type: "string", Enum: []any{"red", "blue"}},
+		"code":   {Type: "string", Pattern: `^[a-z]+$`},
+		"order":  doc.Schema(OrderHTTPRequest{}),
+		"flags":  {Type: "object", AdditionalProperties: &Schema{Type: "boolean"}},
+		"ratio":  {Type: "number", Nullable: true},
+		"small":  {Type: "integer", Format: "int32"},
+		"anyVal": {},
+	}}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"valid", `{"count":2,"color":"red","code":"abc","flags":{"a":true},"ratio":null,"anyVal":[1],
+			"order":{"user_id":"u","gift":null,"lines":[{"item_id":"i","quantity":1}],"at":"2024-01-02T03:04:05Z"}}`, nil},
+		{"not an object", `[]`, []string{"must be an object"}},
+		{"scalars", `{"count":0,"color":"green","code":"ABC","flags":{"a":1},"small":3000000000}`, []string{
+			"code: invalid format", "color: must be one of red, blue", "count: must be at least 1", "flags.a: must be a boolean", "small: out of range",
+		}},
+		{"nested", `{"count":1.5,"order":{"gift":{"item_id":1,"quantity":"2"},"lines":[{}],"at":"today"}}`, []string{
+			"count: must be an integer", "order.at: must be an RFC 3339 time", "order.gift.item_id: must be a string",
+			"order.gift.quantity: must be a number", "order.lines[0].item_id: required", "order.lines[0].quantity: required", "order.user_id: required",
+		}},
+		{"null", `{"order":{"user_id":null,"gift":null,"lines":null}}`, []string{"order.user_id: must not be null"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := json.NewDecoder(strings.NewReader(tt.body))
+			dec.UseNumber()
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var got []string
+			for _, violation := range doc.Validate(schema, v) {
+				got = append(got, violation.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	doc := testDocument()
+	op, params, _ := doc.Find(http.MethodPost, "/users/u1/orders")
+
+	req := httptest.NewRequest(http.MethodPost, "/users/u1/orders?limit=x", strings.NewReader(`{"user_id":"u1","gift":null}`))
+	violations, err := doc.ValidateRequest(op, req, params)
+	if err != nil {
+		t.Fatalf("ValidateRequest: %v", err)
+	}
+	if len(violations) != 1 || violations[0] != (Violation{"limit", "must be a number"}) {
+		t.Errorf("expected the limit to be rejected, got %v", violations)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body["user_id"] != "u1" {
+		t.Errorf("expected the body to be put back, got %v, %v", body, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/users/u1/orders?limit=5", strings.NewReader(`{"user_id":`))
+	if _, err := doc.ValidateRequest(op, req, params); err == nil {
+		t.Error("expected an error for a body that is not JSON")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	doc := testDocument()
+	op, _, _ := doc.Find(http.MethodPost, "/users/u1/orders")
+	jsonHeader := http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		err    string
+	}{
+		{"documented", http.StatusCreated, jsonHeader, `{"item_id":"i","quantity":1}`, ""},
+		{"default", http.StatusConflict, jsonHeader, `{"code":"conflict"}`, ""},
+		{"no body", http.StatusNoContent, http.Header{}, ``, ""},
+		{"mismatch", http.StatusCreated, jsonHeader, `{"item_id":"i"}`, "status 201 body: quantity: required"},
+		{"content type", http.StatusCreated, http.Header{"Content-Type": {"text/plain"}}, `ok`, `not documented with content type "text/plain"`},
+		{"unexpected body", http.StatusNoContent, http.Header{}, `{}`, "documented without a body"},
+		{"default mismatch", http.StatusInternalServerError, jsonHeader, `{"code":1}`, "code: must be a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := doc.ValidateResponse(op, tt.status, tt.header, []byte(tt.body))
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
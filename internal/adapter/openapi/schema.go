@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of OpenAPI schemas that reflection produces and
+// validation checks.
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Nullable    bool   `json:"nullable,omitempty"`
+	Enum        []any  `json:"enum,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	Items *Schema   `json:"items,omitempty"`
+	AllOf []*Schema `json:"allOf,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+const refPrefix = "#/components/schemas/"
+
+var (
+	timeType    = reflect.TypeFor[time.Time]()
+	rawJSONType = reflect.TypeFor[json.RawMessage]()
+)
+
+// reflector turns Go types into schemas the way encoding/json encodes
+// them. Named structs become components, referenced by name; fields
+// without omitempty are always encoded, so they are required.
+type reflector struct {
+	components map[string]*Schema
+	types      map[reflect.Type]string
+}
+
+func (r *reflector) schemaOf(v any) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	return r.schema(reflect.TypeOf(v))
+}
+
+func (r *reflector) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := r.schema(t.Elem())
+		if s.Ref != "" {
+			// Siblings of $ref are ignored, so the nullable reference is
+			// wrapped
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := &Schema{Type: "integer"}
+		if t.Size() == 8 {
+			s.Format = "int64"
+		} else {
+			s.Format = "int32"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		s := &Schema{Type: "array", Items: r.schema(t.Elem())}
+		if t.Kind() == reflect.Slice {
+			// encoding/json writes nil slices as null
+			s.Nullable = true
+		}
+		return s
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.object(t)
+		}
+		return r.component(t)
+	}
+	return &Schema{}
+}
+
+// component returns a reference to the named struct type's schema, adding
+// it to the components first.
+func (r *reflector) component(t reflect.Type) *Schema {
+	if r.types == nil {
+		r.types = make(map[reflect.Type]string)
+	}
+	name, ok := r.types[t]
+	if !ok {
+		name = componentName(t)
+		if r.components[name] != nil {
+			panic("openapi: two types are named " + name)
+		}
+		r.types[t] = name
+		// Reserve the name before reflecting fields, for recursive types
+		r.components[name] = &Schema{}
+		*r.components[name] = *r.object(t)
+	}
+	return &Schema{Ref: refPrefix + name}
+}
+
+// componentName names a type's schema after the type: names like
+// PurchaseHTTPRequest drop their HTTP marker, and other names are
+// qualified by their package, as in graphql.Request.
+func componentName(t reflect.Type) string {
+	if before, after, ok := strings.Cut(t.Name(), "HTTP"); ok {
+		return before + after
+	}
+	return t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:] + "." + t.Name()
+}
+
+func (r *reflector) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	r.fields(s, t)
+	return s
+}
+
+// fields adds the fields of struct type t to s, flattening embedded structs
+// as encoding/json does.
+func (r *reflector) fields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			r.fields(s, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = r.schema(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Violation is a part of a value that does not match its schema. Field
+// names the part as in items[1].quantity, and is empty for the value as a
+// whole; messages read like the handlers' own, such as "required".
+type Violation struct {
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.Message
+	}
+	return v.Field + ": " + v.Message
+}
+
+// patterns caches compiled Schema.Pattern expressions.
+var patterns sync.Map
+
+// Validate checks v, a value decoded from JSON with json.Decoder.UseNumber,
+// against s, returning every violation.
+func (d *Document) Validate(s *Schema, v any) []Violation {
+	var out []Violation
+	d.validate(s, v, "", &out)
+	sortViolations(out)
+	return out
+}
+
+// sortViolations orders violations by field, as properties are visited in
+// map order.
+func sortViolations(out []Violation) {
+	slices.SortStableFunc(out, func(a, b Violation) int { return strings.Compare(a.Field, b.Field) })
+}
+
+func (d *Document) validate(s *Schema, v any, field string, out *[]Violation) {
+	if s == nil {
+		return
+	}
+	if s.Ref != "" {
+		d.validate(d.Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix)], v, field, out)
+		return
+	}
+	if v == nil {
+		if !s.Nullable && (s.Type != "" || len(s.AllOf) > 0) {
+			*out = append(*out, Violation{field, "must not be null"})
+		}
+		return
+	}
+	for _, sub := range s.AllOf {
+		d.validate(sub, v, field, out)
+	}
+
+	violate := func(format string, args ...any) {
+		*out = append(*out, Violation{field, fmt.Sprintf(format, args...)})
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			violate("must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*out = append(*out, Violation{join(field, name), "required"})
+			}
+		}
+		for name, value := range obj {
+			if prop, ok := s.Properties[name]; ok {
+				d.validate(prop, value, join(field, name), out)
+			} else if s.AdditionalProperties != nil {
+				d.validate(s.AdditionalProperties, value, join(field, name), out)
+			}
+		}
+		return
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			violate("must be an array")
+			return
+		}
+		for i, item := range items {
+			d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i), out)
+		}
+		return
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			violate("must be a boolean")
+		}
+		return
+	case "integer", "number":
+		n, ok := number(v)
+		if !ok {
+			violate("must be a number")
+			return
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			violate("must be an integer")
+			return
+		}
+		if s.Format == "int32" && (n < math.MinInt32 || n > math.MaxInt32) {
+			violate("out of range")
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			violate("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			violate("must be at most %v", *s.Maximum)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			violate("must be a string")
+			return
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				violate("must be an RFC 3339 time")
+			}
+		}
+		if s.Pattern != "" && !compile(s.Pattern).MatchString(str) {
+			violate("invalid format")
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		names := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			names[i] = fmt.Sprint(e)
+		}
+		violate("must be one of %s", strings.Join(names, ", "))
+	}
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(pattern string) *regexp.Regexp {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	patterns.Store(pattern, re)
+	return re
+}
+
+// ValidateRequest checks the path and query parameters and the JSON body
+// of r against op. It reads the body and puts it back for the handler; an
+// error means the body could not be read or is not JSON.
+func (d *Document) ValidateRequest(op *Operation, r *http.Request, pathParams map[string]string) ([]Violation, error) {
+	var out []Violation
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = pathParams[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			raw = query.Get(p.Name)
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				out = append(out, Violation{p.Name, "required"})
+			}
+			continue
+		}
+		d.validate(p.Schema, paramValue(p.Schema, raw), p.Name, &out)
+	}
+
+	if op.RequestBody == nil || r.Body == nil || r.Body == http.NoBody {
+		return out, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 && !op.RequestBody.Required {
+		return out, nil
+	}
+
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if media := op.RequestBody.Content["application/json"]; media != nil {
+		d.validate(media.Schema, value, "", &out)
+	}
+	sortViolations(out)
+	return out, nil
+}
+
+// paramValue converts a parameter to the type its schema expects, leaving
+// values that do not convert as strings for validation to reject.
+func paramValue(s *Schema, raw string) any {
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+// ValidateResponse checks a response of op with the status, header and
+// body against the responses op documents.
+func (d *Document) ValidateResponse(op *Operation, status int, header http.Header, body []byte) error {
+	resp := op.Response(status)
+	if resp == nil {
+		return fmt.Errorf("status %d is not documented", status)
+	}
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("status %d is documented without a body", status)
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("status %d is not documented with content type %q", status, mediaType)
+	}
+	if mediaType != "application/json" || media.Schema == nil {
+		return nil
+	}
+
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("decode status %d body: %w", status, err)
+	}
+	if violations := d.Validate(media.Schema, value); len(violations) > 0 {
+		msgs := make([]string, len(violations))
+		for i, v := range violations {
+			msgs[i] = v.String()
+		}
+		return errors.New("status " + strconv.Itoa(status) + " body: " + strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// DeclineTokenPrefix marks payment tokens the mock gateway declines, e.g.
+// "tok_decline_insufficient_funds".
+const DeclineTokenPrefix = "tok_decline"
+
+var (
+	ErrUnknownAuthorization = errors.New("unknown authorization")
+	ErrInvalidAmount        = errors.New("invalid amount")
+)
+
+type authorizationState int
+
+const (
+	stateAuthorized authorizationState = iota
+	stateCaptured
+	stateReleased
+)
+
+type authorization struct {
+	amount   int64
+	captured int64
+	refunded int64
+	state    authorizationState
+}
+
+// Mock is an in-memory PaymentGateway for development and tests. It
+// approves every request except those whose token starts with
+// DeclineTokenPrefix, and enforces the same amount rules as a real PSP.
+type Mock struct {
+	mu             sync.Mutex
+	authorizations map[string]*authorization
+	byOrder        map[string]string
+}
+
+func NewMock() *Mock {
+	return &Mock{
+		authorizations: make(map[string]*authorization),
+		byOrder:        make(map[string]string),
+	}
+}
+
+func (m *Mock) Authorize(ctx context.Context, req domain.PaymentRequest) (*domain.PaymentAuthorization, error) {
+	if req.Amount < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidAmount, req.Amount)
+	}
+	if strings.HasPrefix(req.Token, DeclineTokenPrefix) {
+		reason := strings.TrimPrefix(strings.TrimPrefix(req.Token, DeclineTokenPrefix), "_")
+		if reason == "" {
+			reason = "card_declined"
+		}
+		return &domain.PaymentAuthorization{DeclineReason: reason}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Retries for the same order get the authorization they already have
+	if id, ok := m.byOrder[req.OrderID]; ok && m.authorizations[id].state != stateReleased {
+		return &domain.PaymentAuthorization{ID: id, Approved: true}, nil
+	}
+
+	id := "auth_" + uuid.New().String()
+	m.authorizations[id] = &authorization{amount: req.Amount}
+	m.byOrder[req.OrderID] = id
+	return &domain.PaymentAuthorization{ID: id, Approved: true}, nil
+}
+
+func (m *Mock) Capture(ctx context.Context, authorizationID string, amount int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.authorizations[authorizationID]
+	if !ok || auth.state == stateReleased {
+		return ErrUnknownAuthorization
+	}
+	if auth.state == stateCaptured {
+		// Capturing again is a no-op, as with most PSPs
+		return nil
+	}
+	if amount < 0 || amount > auth.amount {
+		return fmt.Errorf("%w: capture %d of %d", ErrInvalidAmount, amount, auth.amount)
+	}
+	auth.captured = amount
+	auth.state = stateCaptured
+	return nil
+}
+
+func (m *Mock) Refund(ctx context.Context, authorizationID string, amount int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.authorizations[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	switch auth.state {
+	case stateAuthorized:
+		auth.state = stateReleased
+		return nil
+	case stateReleased:
+		return nil
+	}
+	if amount < 0 || auth.refunded+amount > auth.captured {
+		return fmt.Errorf("%w: refund %d of %d remaining", ErrInvalidAmount, amount, auth.captured-auth.refunded)
+	}
+	auth.refunded += amount
+	return nil
+}
+
+// Captured returns the amount captured and not refunded on an
+// authorization, for tests.
+func (m *Mock) Captured(authorizationID string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.authorizations[authorizationID]
+	if !ok {
+		return 0
+	}
+	return auth.captured - auth.refunded
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestMock_AuthorizeCaptureRefund(t *testing.T) {
+	m := NewMock()
+	ctx := context.Background()
+	req := domain.PaymentRequest{OrderID: "order-1", UserID: "user-1", Amount: 1000, Token: "tok_visa"}
+
+	auth, err := m.Authorize(ctx, req)
+	if err != nil || !auth.Approved {
+		t.Fatalf("expected approval, got %+v, %v", auth, err)
+	}
+	if again, _ := m.Authorize(ctx, req); again.ID != auth.ID {
+		t.Errorf("expected retry to reuse %s, got %s", auth.ID, again.ID)
+	}
+
+	if err := m.Capture(ctx, auth.ID, 2000); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected over-capture to fail, got %v", err)
+	}
+	if err := m.Capture(ctx, auth.ID, 1000); err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+	if err := m.Refund(ctx, auth.ID, 400); err != nil {
+		t.Fatalf("refund failed: %v", err)
+	}
+	if err := m.Refund(ctx, auth.ID, 700); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected over-refund to fail, got %v", err)
+	}
+	if got := m.Captured(auth.ID); got != 600 {
+		t.Errorf("expected 600 captured, got %d", got)
+	}
+}
+
+func TestMock_DeclineAndRelease(t *testing.T) {
+	m := NewMock()
+	ctx := context.Background()
+
+	auth, err := m.Authorize(ctx, domain.PaymentRequest{OrderID: "order-1", Amount: 1000, Token: "tok_decline_insufficient_funds"})
+	if err != nil || auth.Approved || auth.DeclineReason != "insufficient_funds" {
+		t.Errorf("expected decline, got %+v, %v", auth, err)
+	}
+
+	auth, _ = m.Authorize(ctx, domain.PaymentRequest{OrderID: "order-2", Amount: 1000, Token: "tok_visa"})
+	if err := m.Refund(ctx, auth.ID, 1000); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if err := m.Capture(ctx, auth.ID, 1000); !errors.Is(err, ErrUnknownAuthorization) {
+		t.Errorf("expected released authorization to be uncapturable, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package risk scores purchases with a set of built-in fraud rules.
+package risk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// maxScore is the highest score a purchase can get.
+const maxScore = 100
+
+// Default points of the built-in rules: a client buying too fast is enough
+// to flag a purchase on its own, and a new account on top of that to reject
+// it under the default thresholds of 50 and 80.
+const (
+	VelocityPoints   = 60
+	NewAccountPoints = 30
+)
+
+// Rule scores one signal of a purchase attempt, returning the points it adds
+// and, when it adds any, why.
+type Rule interface {
+	Evaluate(ctx context.Context, attempt domain.PurchaseAttempt) (points int, reason string, err error)
+}
+
+// Rules is a port.RiskScorer that adds up the points of its rules, capped at
+// 100. Purchases scoring rejectAt or more are rejected and those scoring
+// flagAt or more flagged; a threshold of 0 is off.
+type Rules struct {
+	rules    []Rule
+	flagAt   int
+	rejectAt int
+}
+
+func NewRules(flagAt, rejectAt int, rules ...Rule) *Rules {
+	return &Rules{rules: rules, flagAt: flagAt, rejectAt: rejectAt}
+}
+
+func (r *Rules) Score(ctx context.Context, attempt domain.PurchaseAttempt) (domain.RiskAssessment, error) {
+	assessment := domain.RiskAssessment{Action: domain.RiskAllow}
+	for _, rule := range r.rules {
+		points, reason, err := rule.Evaluate(ctx, attempt)
+		if err != nil {
+			return domain.RiskAssessment{}, err
+		}
+		if points > 0 {
+			assessment.Score += points
+			assessment.Reasons = append(assessment.Reasons, reason)
+		}
+	}
+	assessment.Score = min(assessment.Score, maxScore)
+
+	switch {
+	case r.rejectAt > 0 && assessment.Score >= r.rejectAt:
+		assessment.Action = domain.RiskReject
+	case r.flagAt > 0 && assessment.Score >= r.flagAt:
+		assessment.Action = domain.RiskFlag
+	}
+	return assessment, nil
+}
+
+// Velocity adds points when more than limit purchases come from the same
+// client IP or device within a window. Attempts without the key are not
+// counted.
+type Velocity struct {
+	signals port.RiskSignals
+	kind    string
+	key     func(domain.PurchaseAttempt) string
+	limit   int
+	window  time.Duration
+	points  int
+}
+
+// NewIPVelocity counts purchases per client IP.
+func NewIPVelocity(signals port.RiskSignals, limit int, window time.Duration, points int) *Velocity {
+	return &Velocity{
+		signals: signals,
+		kind:    "ip",
+		key:     func(a domain.PurchaseAttempt) string { return a.ClientIP },
+		limit:   limit,
+		window:  window,
+		points:  points,
+	}
+}
+
+// NewDeviceVelocity counts purchases per device ID.
+func NewDeviceVelocity(signals port.RiskSignals, limit int, window time.Duration, points int) *Velocity {
+	return &Velocity{
+		signals: signals,
+		kind:    "device",
+		key:     func(a domain.PurchaseAttempt) string { return a.DeviceID },
+		limit:   limit,
+		window:  window,
+		points:  points,
+	}
+}
+
+func (v *Velocity) Evaluate(ctx context.Context, attempt domain.PurchaseAttempt) (int, string, error) {
+	key := v.key(attempt)
+	if key == "" {
+		return 0, "", nil
+	}
+	n, err := v.signals.CountAttempt(ctx, v.kind+":"+key, v.window)
+	if err != nil {
+		return 0, "", fmt.Errorf("count %s attempts: %w", v.kind, err)
+	}
+	if n <= v.limit {
+		return 0, "", nil
+	}
+	return v.points, fmt.Sprintf("%d purchases from %s %s within %s", n, v.kind, key, v.window), nil
+}
+
+// AccountAge adds points for users first seen less than minAge ago. Users
+// are seen at their first purchase attempt, so without a user directory an
+// account counts as new until it has been buying for minAge.
+type AccountAge struct {
+	signals port.RiskSignals
+	minAge  time.Duration
+	points  int
+}
+
+func NewAccountAge(signals port.RiskSignals, minAge time.Duration, points int) *AccountAge {
+	return &AccountAge{signals: signals, minAge: minAge, points: points}
+}
+
+func (a *AccountAge) Evaluate(ctx context.Context, attempt domain.PurchaseAttempt) (int, string, error) {
+	seen, err := a.signals.FirstSeen(ctx, attempt.UserID, attempt.At)
+	if err != nil {
+		return 0, "", fmt.Errorf("look up first seen: %w", err)
+	}
+	if age := attempt.At.Sub(seen); age < a.minAge {
+		return a.points, fmt.Sprintf("account first seen %s ago", age.Round(time.Second)), nil
+	}
+	return 0, "", nil
+}
@@ -0,0 +1,88 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+type fixedRule struct {
+	points int
+	err    error
+}
+
+func (r fixedRule) Evaluate(ctx context.Context, attempt domain.PurchaseAttempt) (int, string, error) {
+	return r.points, "fixed", r.err
+}
+
+func TestRules_Score(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		rules  []Rule
+		score  int
+		action domain.RiskAction
+	}{
+		{"no rules", nil, 0, domain.RiskAllow},
+		{"below flag", []Rule{fixedRule{points: 30}}, 30, domain.RiskAllow},
+		{"flagged", []Rule{fixedRule{points: 30}, fixedRule{points: 30}}, 60, domain.RiskFlag},
+		{"rejected", []Rule{fixedRule{points: 60}, fixedRule{points: 30}}, 90, domain.RiskReject},
+		{"capped", []Rule{fixedRule{points: 80}, fixedRule{points: 80}}, 100, domain.RiskReject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRules(50, 80, tt.rules...).Score(ctx, domain.PurchaseAttempt{UserID: "u1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Score != tt.score || got.Action != tt.action {
+				t.Errorf("expected %d %s, got %d %s", tt.score, tt.action, got.Score, got.Action)
+			}
+		})
+	}
+
+	if _, err := NewRules(50, 80, fixedRule{err: errors.New("down")}).Score(ctx, domain.PurchaseAttempt{}); err == nil {
+		t.Error("expected a failing rule to fail the score")
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	ctx := context.Background()
+	cache := memory.NewCache()
+	ip := NewIPVelocity(cache, 2, time.Minute, 60)
+	device := NewDeviceVelocity(cache, 2, time.Minute, 60)
+	attempt := domain.PurchaseAttempt{UserID: "u1", ClientIP: "10.0.0.1", At: time.Now()}
+
+	for range 2 {
+		if points, _, _ := ip.Evaluate(ctx, attempt); points != 0 {
+			t.Fatalf("expected no points within the limit, got %d", points)
+		}
+	}
+	if points, reason, _ := ip.Evaluate(ctx, attempt); points != 60 || reason == "" {
+		t.Errorf("expected 60 points past the limit, got %d %q", points, reason)
+	}
+
+	// No device ID, nothing to count
+	for range 3 {
+		if points, _, _ := device.Evaluate(ctx, attempt); points != 0 {
+			t.Fatalf("expected no points without a device, got %d", points)
+		}
+	}
+}
+
+func TestAccountAge(t *testing.T) {
+	ctx := context.Background()
+	rule := NewAccountAge(memory.NewCache(), time.Hour, 30)
+	now := time.Now()
+
+	if points, _, _ := rule.Evaluate(ctx, domain.PurchaseAttempt{UserID: "u1", At: now}); points != 30 {
+		t.Errorf("expected a new account to score 30, got %d", points)
+	}
+	if points, _, _ := rule.Evaluate(ctx, domain.PurchaseAttempt{UserID: "u1", At: now.Add(2 * time.Hour)}); points != 0 {
+		t.Errorf("expected an old account to score 0, got %d", points)
+	}
+}
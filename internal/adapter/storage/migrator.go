@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is one version of the MySQL schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time // nil while pending
+}
+
+// migrationLock serializes servers that start at the same time and migrate.
+const migrationLock = "flashsale_schema_migrations"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// LoadMigrations reads NNNN_name.up.sql and NNNN_name.down.sql files from
+// fsys, in version order. Every version needs both.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name is not NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to MySQL and records them in the
+// schema_migrations table. MySQL commits DDL as it runs, so a migration that
+// fails part way is left half applied and has to be repaired by hand before
+// migrating again.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations in fsys, see LoadMigrations.
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := execScript(ctx, conn, migration.Up); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now(),
+			); err != nil {
+				return fmt.Errorf("record migration %d: %w", migration.Version, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range slices.Backward(m.migrations) {
+			if len(reverted) == steps {
+				break
+			}
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if err := execScript(ctx, conn, migration.Down); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+				return fmt.Errorf("record migration %d: %w", migration.Version, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int]time.Time) error {
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Migration: migration}
+			if at, ok := done[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs fn holding the migration lock, with the applied versions.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, done map[int]time.Time) error) error {
+	// GET_LOCK belongs to a connection, so everything runs on this one
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", migrationLock).Scan(&got); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	if got.Int64 != 1 {
+		return fmt.Errorf("acquire migration lock: timed out")
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", migrationLock)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`,
+	); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			rows.Close()
+			return err
+		}
+		done[version] = at
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, done)
+}
+
+// execScript runs the statements of a migration one at a time, since the
+// MySQL driver only accepts several per call with multiStatements set.
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons outside quotes and
+// comments, dropping empty statements.
+func splitStatements(script string) []string {
+	var statements []string
+	var quote rune
+	start := 0
+	lineComment := false
+	runes := []rune(script)
+	for i, c := range runes {
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			lineComment = true
+		case c == ';':
+			statements = appendStatement(statements, string(runes[start:i]))
+			start = i + 1
+		}
+	}
+	return appendStatement(statements, string(runes[start:]))
+}
+
+func appendStatement(statements []string, stmt string) []string {
+	if stmt = strings.TrimSpace(stmt); stmt == "" || isComment(stmt) {
+		return statements
+	}
+	return append(statements, stmt)
+}
+
+// isComment reports whether stmt holds only -- comments.
+func isComment(stmt string) bool {
+	for line := range strings.Lines(stmt) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rl1809/flash-sale/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	loaded, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(loaded) < 2 || loaded[0].Version != 1 || loaded[0].Name != "create_tables" {
+		t.Fatalf("unexpected migrations: %+v", loaded)
+	}
+	for i, m := range loaded {
+		if m.Version != i+1 {
+			t.Errorf("expected version %d, got %d", i+1, m.Version)
+		}
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"no down":  {"0001_init.up.sql": {Data: []byte("SELECT 1;")}},
+		"bad name": {"init.sql": {Data: []byte("SELECT 1;")}},
+		"renamed": {
+			"0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+			"0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range invalid {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- Tables; in order
+CREATE TABLE a (id INT);
+INSERT INTO a (name) VALUES ('x;y'), ("--z");
+
+-- trailing comment`
+
+	want := []string{
+		"-- Tables; in order\nCREATE TABLE a (id INT)",
+		`INSERT INTO a (name) VALUES ('x;y'), ("--z")`,
+	}
+	if got := splitStatements(script); !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("expected migration %d applied", status.Version)
+		}
+	}
+
+	// Nothing is left to apply
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("expected no migrations applied, got %v, %v", applied, err)
+	}
+}
@@ -3,76 +3,536 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
 )
 
-var ErrOptimisticLock = errors.New("optimistic lock conflict")
+var (
+	ErrOptimisticLock      = port.ErrOptimisticLock
+	ErrAllocationExhausted = port.ErrAllocationExhausted
+)
 
+// MySQLAdapter keeps to SQL that SQLite also runs, apart from the clauses
+// that skip or update a duplicate row on insert and lock selected rows, so
+// SQLiteAdapter can share it.
 type MySQLAdapter struct {
 	db *sql.DB
+	// ignoreDuplicate ends an INSERT so that a row with an existing key is
+	// left alone and counted as zero rows affected
+	ignoreDuplicate string
+	// forUpdate ends a SELECT in a transaction to lock the rows it reads
+	forUpdate string
+	// updateView ends an INSERT into order_views so that a row already there
+	// takes the order's changeable columns from the new one
+	updateView string
+	// replica takes reads off the primary if set
+	replica *replica
+	// orderChanges appends every change of an order to order_changes
+	orderChanges bool
+	// statements holds the order writes prepared once, nil to run them
+	// unprepared
+	statements *statements
 }
 
-func NewMySQLAdapter(db *sql.DB) *MySQLAdapter {
-	return &MySQLAdapter{db: db}
+func NewMySQLAdapter(db *sql.DB, opts ...MySQLOption) *MySQLAdapter {
+	m := &MySQLAdapter{
+		db: db, ignoreDuplicate: "ON DUPLICATE KEY UPDATE id = id", forUpdate: "FOR UPDATE",
+		updateView: "ON DUPLICATE KEY UPDATE status = VALUES(status), expires_at = VALUES(expires_at), updated_at = VALUES(updated_at)",
+		statements: newStatements(db),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
+// The order writes are run for every order persisted, so they are
+// prepared once; see statements.
+const (
+	insertOrderQuery = `
+		INSERT INTO orders (id, tenant_id, item_id, user_id, quantity, status, unit_price, total_price, currency, coupon_code, discount, expires_at, risk_score, risk_flagged, idempotency_key, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertOrderItemQuery = `
+		INSERT INTO order_items (order_id, line, item_id, quantity, unit_price, total_price)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	takeInventoryQuery = `
+		UPDATE inventory
+		SET stock = stock - ?, version = version + 1, updated_at = NOW()
+		WHERE item_id = ? AND stock >= ?`
+)
+
 func (m *MySQLAdapter) CreateOrder(ctx context.Context, order domain.Order) error {
+	return m.CreateOrders(ctx, []domain.Order{order})
+}
+
+func (m *MySQLAdapter) CreateOrders(ctx context.Context, orders []domain.Order) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateOrders")
+	defer endSpan(span, &err)
+
+	m.statements.prepare(ctx, m.orderWrites()...)
 	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO orders (id, item_id, user_id, quantity, status, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		order.ID, order.ItemID, order.UserID, order.Quantity, order.Status,
+	for _, order := range orders {
+		if err := m.createOrderTx(ctx, tx, order); err != nil {
+			return err
+		}
+		if err := m.recordCreatedTx(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQLAdapter) createOrderTx(ctx context.Context, tx *sql.Tx, order domain.Order) error {
+	_, err := m.execTx(ctx, tx, insertOrderQuery,
+		order.ID, order.TenantID, order.ItemID, order.UserID, order.Quantity, order.Status,
+		order.UnitPrice, order.TotalPrice, currencyOrDefault(order.Currency),
+		sql.NullString{String: order.CouponCode, Valid: order.CouponCode != ""}, order.Discount, nullTime(order.ExpiresAt),
+		order.RiskScore, order.RiskFlagged,
+		sql.NullString{String: order.IdempotencyKey, Valid: order.IdempotencyKey != ""},
 		order.CreatedAt, order.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("insert order: %w", err)
 	}
+	if err := m.insertOrderItemsTx(ctx, tx, order); err != nil {
+		return err
+	}
+
+	for _, line := range order.Lines() {
+		result, err := m.execTx(ctx, tx, takeInventoryQuery,
+			line.Quantity, line.ItemID, line.Quantity,
+		)
+		if err != nil {
+			return fmt.Errorf("update inventory: %w", err)
+		}
+
+		rows, _ := result.RowsAffected()
+		if rows == 0 {
+			return ErrOptimisticLock
+		}
+	}
+
+	return nil
+}
+
+// insertOrderItemsTx writes an order's lines; a single-item order has one.
+func (m *MySQLAdapter) insertOrderItemsTx(ctx context.Context, tx *sql.Tx, order domain.Order) error {
+	for i, line := range order.Lines() {
+		_, err := m.execTx(ctx, tx, insertOrderItemQuery,
+			order.ID, i, line.ItemID, line.Quantity, line.UnitPrice, line.TotalPrice,
+		)
+		if err != nil {
+			return fmt.Errorf("insert order item: %w", err)
+		}
+	}
+	return nil
+}
+
+// querier is a *sql.DB, or a *sql.Tx for reads inside a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// loadOrderItems sets the lines of the multi-line orders among orders,
+// reading them from db, the database or transaction the orders came from.
+func (m *MySQLAdapter) loadOrderItems(ctx context.Context, db querier, orders []domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]any, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		index[order.ID] = i
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT order_id, item_id, quantity, unit_price, total_price
+		FROM order_items
+		WHERE order_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY order_id, line`, ids...,
+	)
+	if err != nil {
+		return fmt.Errorf("query order items: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[string][]domain.OrderItem)
+	for rows.Next() {
+		var orderID string
+		var line domain.OrderItem
+		if err := rows.Scan(&orderID, &line.ItemID, &line.Quantity, &line.UnitPrice, &line.TotalPrice); err != nil {
+			return fmt.Errorf("scan order item: %w", err)
+		}
+		lines[orderID] = append(lines[orderID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, items := range lines {
+		if len(items) > 1 {
+			orders[index[id]].Items = items
+		}
+	}
+	return nil
+}
+
+func (m *MySQLAdapter) GetOrder(ctx context.Context, id string) (_ *domain.Order, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetOrder")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) (*domain.Order, error) {
+		if m.orderChanges {
+			if order, found, err := m.replayOrder(ctx, db, id); err != nil || found {
+				return order, err
+			}
+		}
+		order, err := scanOrder(db.QueryRowContext(ctx, `
+			SELECT `+orderColumns+`
+			FROM orders WHERE id = ?`, id,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query order: %w", err)
+		}
+
+		orders := []domain.Order{*order}
+		if err := m.loadOrderItems(ctx, db, orders); err != nil {
+			return nil, err
+		}
+		return &orders[0], nil
+	})
+}
+
+func (m *MySQLAdapter) ConfirmOrder(ctx context.Context, id, paymentID string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ConfirmOrder")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
 
 	result, err := tx.ExecContext(ctx, `
-		UPDATE inventory 
-		SET stock = stock - ?, version = version + 1, updated_at = NOW()
-		WHERE item_id = ? AND stock >= ?`,
-		order.Quantity, order.ItemID, order.Quantity,
+		UPDATE orders SET status = ?, payment_id = ?, updated_at = NOW()
+		WHERE id = ? AND status = ?`,
+		domain.OrderStatusConfirmed, paymentID, id, domain.OrderStatusPending,
 	)
 	if err != nil {
-		return fmt.Errorf("update inventory: %w", err)
+		return false, fmt.Errorf("confirm order: %w", err)
 	}
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return ErrOptimisticLock
+		return false, nil
+	}
+	change := domain.OrderChange{OrderID: id, Type: domain.OrderChangeConfirmed, PaymentID: paymentID}
+	if err := m.recordChangeTx(ctx, tx, change); err != nil {
+		return false, err
 	}
+	return true, tx.Commit()
+}
 
-	return tx.Commit()
+// ExpiredOrders returns up to limit pending orders whose hold lapsed at or
+// before the given time, soonest expiry first.
+func (m *MySQLAdapter) ExpiredOrders(ctx context.Context, before time.Time, limit int) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ExpiredOrders")
+	defer endSpan(span, &err)
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders
+		WHERE status = ? AND expires_at <= ?
+		ORDER BY expires_at
+		LIMIT ?`,
+		domain.OrderStatusPending, before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query expired orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []domain.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := m.loadOrderItems(ctx, m.db, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
 }
 
-func (m *MySQLAdapter) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
-	var inv domain.Inventory
-	err := m.db.QueryRowContext(ctx, `
-		SELECT item_id, stock, version, created_at, updated_at
-		FROM inventory WHERE item_id = ?`, itemID,
-	).Scan(&inv.ItemID, &inv.Quantity, &inv.Version, &inv.CreatedAt, &inv.UpdatedAt)
+// ListOrdersByUser returns a page of a user's orders, newest first. Pages
+// seek past the cursor on (created_at, id) rather than using an offset, so
+// each one is a range scan of idx_user_created.
+func (m *MySQLAdapter) ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListOrdersByUser")
+	defer endSpan(span, &err)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Order, error) {
+		query := `SELECT ` + orderColumns + ` FROM orders WHERE user_id = ?`
+		args := []any{userID}
+		query, args = scopeTenant(ctx, query, args)
+		if filter.Status != "" {
+			query += ` AND status = ?`
+			args = append(args, filter.Status)
+		}
+		if !filter.From.IsZero() {
+			query += ` AND created_at >= ?`
+			args = append(args, filter.From)
+		}
+		if !filter.To.IsZero() {
+			query += ` AND created_at < ?`
+			args = append(args, filter.To)
+		}
+		if filter.After != nil {
+			query += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+			args = append(args, filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+		}
+		query += ` ORDER BY created_at DESC, id DESC LIMIT ?`
+		args = append(args, filter.Limit)
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("query user orders: %w", err)
+		}
+		defer rows.Close()
+
+		var orders []domain.Order
+		for rows.Next() {
+			order, err := scanOrder(rows)
+			if err != nil {
+				return nil, fmt.Errorf("scan order: %w", err)
+			}
+			orders = append(orders, *order)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+
+		if err := m.loadOrderItems(ctx, db, orders); err != nil {
+			return nil, err
+		}
+		return orders, nil
+	})
+}
+
+// ListOrdersAfter pages through orders by primary key, so each page is a
+// range scan that starts where the last one ended. A multi-line order
+// matches an item through its order_items rows. Bounding the window by time
+// lets a partitioned table skip the partitions outside it.
+func (m *MySQLAdapter) ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListOrdersAfter")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Order, error) {
+		query := `SELECT ` + orderColumns + ` FROM orders WHERE id > ?`
+		args := []any{afterID}
+		query, args = scopeTenant(ctx, query, args)
+		if window.ItemID != "" {
+			query += ` AND (item_id = ? OR id IN (SELECT order_id FROM order_items WHERE item_id = ?))`
+			args = append(args, window.ItemID, window.ItemID)
+		}
+		if !window.From.IsZero() {
+			query += ` AND created_at >= ?`
+			args = append(args, window.From)
+		}
+		if !window.To.IsZero() {
+			query += ` AND created_at < ?`
+			args = append(args, window.To)
+		}
+		query += ` ORDER BY id LIMIT ?`
+		args = append(args, limit)
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("query orders: %w", err)
+		}
+		defer rows.Close()
+
+		var orders []domain.Order
+		for rows.Next() {
+			order, err := scanOrder(rows)
+			if err != nil {
+				return nil, fmt.Errorf("scan order: %w", err)
+			}
+			orders = append(orders, *order)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+
+		if err := m.loadOrderItems(ctx, db, orders); err != nil {
+			return nil, err
+		}
+		return orders, nil
+	})
+}
+
+const orderColumns = "id, tenant_id, item_id, user_id, quantity, status, allocation_id, unit_price, total_price, currency, coupon_code, discount, expires_at, payment_id, risk_score, risk_flagged, idempotency_key, created_at, updated_at"
+
+// scanOrder reads the orderColumns of an orders row.
+func scanOrder(row interface{ Scan(...any) error }) (*domain.Order, error) {
+	var order domain.Order
+	var allocationID sql.NullString
+	var expiresAt sql.NullTime
+	var couponCode, paymentID, idempotencyKey sql.NullString
+	if err := row.Scan(&order.ID, &order.TenantID, &order.ItemID, &order.UserID, &order.Quantity, &order.Status,
+		&allocationID, &order.UnitPrice, &order.TotalPrice, &order.Currency, &couponCode, &order.Discount,
+		&expiresAt, &paymentID, &order.RiskScore, &order.RiskFlagged, &idempotencyKey, &order.CreatedAt, &order.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	order.AllocationID = allocationID.String
+	order.CouponCode = couponCode.String
+	order.ExpiresAt = expiresAt.Time
+	order.PaymentID = paymentID.String
+	order.IdempotencyKey = idempotencyKey.String
+	return &order, nil
+}
+
+// scopeTenant narrows a query over orders or order_views to the context's
+// tenant. Work without one, such as the scheduled jobs, reads every tenant.
+func scopeTenant(ctx context.Context, query string, args []any) (string, []any) {
+	tenant, ok := port.TenantOf(ctx)
+	if !ok {
+		return query, args
+	}
+	return query + ` AND tenant_id = ?`, append(args, tenant)
+}
+
+// currencyOrDefault stores orders and items placed without a currency in
+// the default one, as the column defaults do.
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return domain.DefaultCurrency
+	}
+	return currency
+}
+
+// nullTime stores a zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (m *MySQLAdapter) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateOrderStatus")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE orders SET status = ?, updated_at = NOW()
+		WHERE id = ? AND status = ?`,
+		to, id, from,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update order: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return false, nil
+	}
+
+	if to.ReleasesStock() {
+		if err := releaseOrderTx(ctx, tx, id); err != nil {
+			return false, err
+		}
 	}
+	if err := m.recordChangeTx(ctx, tx, domain.OrderChange{OrderID: id, Type: domain.StatusChange(to)}); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// releaseOrderTx returns a cancelled or expired order's units to the
+// allocation it was fulfilled from, or to inventory.
+func releaseOrderTx(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE allocations
+		SET fulfilled = fulfilled - (SELECT quantity FROM orders WHERE id = ?), status = 'open', updated_at = NOW()
+		WHERE id = (SELECT allocation_id FROM orders WHERE id = ?)`, id, id,
+	)
+	if err != nil {
+		return fmt.Errorf("release allocation: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE inventory
+		SET stock = stock + (SELECT SUM(quantity) FROM order_items WHERE order_id = ? AND item_id = inventory.item_id),
+			version = version + 1, updated_at = NOW()
+		WHERE item_id IN (SELECT item_id FROM order_items WHERE order_id = ?)
+			AND EXISTS (SELECT 1 FROM orders WHERE id = ? AND allocation_id IS NULL)`, id, id, id,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("query inventory: %w", err)
+		return fmt.Errorf("release inventory: %w", err)
 	}
+	return nil
+}
 
-	inv.ID = inv.ItemID
-	return &inv, nil
+func (m *MySQLAdapter) GetInventory(ctx context.Context, itemID string) (_ *domain.Inventory, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetInventory")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) (*domain.Inventory, error) {
+		var inv domain.Inventory
+		err := db.QueryRowContext(ctx, `
+			SELECT item_id, tenant_id, stock, version, created_at, updated_at
+			FROM inventory WHERE item_id = ?`, itemID,
+		).Scan(&inv.ItemID, &inv.TenantID, &inv.Quantity, &inv.Version, &inv.CreatedAt, &inv.UpdatedAt)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query inventory: %w", err)
+		}
+
+		inv.ID = inv.ItemID
+		return &inv, nil
+	})
 }
 
-func (m *MySQLAdapter) UpdateInventory(ctx context.Context, inv domain.Inventory) error {
+func (m *MySQLAdapter) UpdateInventory(ctx context.Context, inv domain.Inventory) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateInventory")
+	defer endSpan(span, &err)
+
 	result, err := m.db.ExecContext(ctx, `
 		UPDATE inventory 
 		SET stock = ?, version = version + 1, updated_at = NOW()
@@ -90,3 +550,989 @@ func (m *MySQLAdapter) UpdateInventory(ctx context.Context, inv domain.Inventory
 
 	return nil
 }
+
+func (m *MySQLAdapter) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "RestockInventory")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE inventory 
+		SET stock = ?, version = version + 1, updated_at = NOW()
+		WHERE item_id = ? AND version = ?`,
+		inv.Quantity, inv.ItemID, inv.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("update inventory: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrOptimisticLock
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO restock_audit (item_id, quantity, stock_before, stock_after, actor, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		restock.ItemID, restock.Quantity, restock.StockBefore, restock.StockAfter,
+		restock.Actor, restock.Reason, restock.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert restock audit: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQLAdapter) CreateAllocation(ctx context.Context, alloc domain.Allocation) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateAllocation")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO allocations (id, partner_id, item_id, quantity, fulfilled, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		alloc.ID, alloc.PartnerID, alloc.ItemID, alloc.Quantity, alloc.Fulfilled, alloc.Status,
+		alloc.CreatedAt, alloc.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert allocation: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE inventory 
+		SET stock = stock - ?, version = version + 1, updated_at = NOW()
+		WHERE item_id = ? AND stock >= ?`,
+		alloc.Quantity, alloc.ItemID, alloc.Quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("update inventory: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrOptimisticLock
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQLAdapter) GetAllocation(ctx context.Context, id string) (_ *domain.Allocation, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetAllocation")
+	defer endSpan(span, &err)
+
+	var alloc domain.Allocation
+	err = m.db.QueryRowContext(ctx, `
+		SELECT id, partner_id, item_id, quantity, fulfilled, status, created_at, updated_at
+		FROM allocations WHERE id = ?`, id,
+	).Scan(&alloc.ID, &alloc.PartnerID, &alloc.ItemID, &alloc.Quantity, &alloc.Fulfilled,
+		&alloc.Status, &alloc.CreatedAt, &alloc.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query allocation: %w", err)
+	}
+
+	return &alloc, nil
+}
+
+func (m *MySQLAdapter) SaveCampaignArchive(ctx context.Context, archive domain.CampaignArchive) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "SaveCampaignArchive")
+	defer endSpan(span, &err)
+
+	stock, err := json.Marshal(archive.Stock)
+	if err != nil {
+		return err
+	}
+	frozen, err := json.Marshal(archive.FrozenItems)
+	if err != nil {
+		return err
+	}
+	closed, err := json.Marshal(archive.ClosedItems)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.db.ExecContext(ctx, `
+		INSERT INTO campaign_archives (campaign_id, final_stock, frozen_items, closed_items, idempotency_keys, archived_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		archive.CampaignID, stock, frozen, closed, archive.IdempotencyKeys, archive.ArchivedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert campaign archive: %w", err)
+	}
+	return nil
+}
+
+func (m *MySQLAdapter) FulfillAllocation(ctx context.Context, order domain.Order) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "FulfillAllocation")
+	defer endSpan(span, &err)
+
+	m.statements.prepare(ctx, m.orderWrites()...)
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// MySQL evaluates assignments left to right and SQLite against the old
+	// row, so status is assigned first for both to see the old fulfilled count
+	result, err := tx.ExecContext(ctx, `
+		UPDATE allocations
+		SET status = CASE WHEN fulfilled + ? >= quantity THEN 'fulfilled' ELSE 'open' END,
+			fulfilled = fulfilled + ?,
+			updated_at = NOW()
+		WHERE id = ? AND fulfilled + ? <= quantity`,
+		order.Quantity, order.Quantity, order.AllocationID, order.Quantity,
+	)
+	if err != nil {
+		return fmt.Errorf("update allocation: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrAllocationExhausted
+	}
+
+	// The order is the tenant's whose item was allocated
+	err = tx.QueryRowContext(ctx, `SELECT tenant_id FROM items WHERE id = ?`, order.ItemID).Scan(&order.TenantID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query item tenant: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO orders (id, tenant_id, item_id, user_id, quantity, status, allocation_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.ID, order.TenantID, order.ItemID, order.UserID, order.Quantity, order.Status, order.AllocationID,
+		order.CreatedAt, order.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert order: %w", err)
+	}
+	if err := m.insertOrderItemsTx(ctx, tx, order); err != nil {
+		return err
+	}
+	if err := m.recordCreatedTx(ctx, tx, order); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *MySQLAdapter) CreateItem(ctx context.Context, item domain.Item) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateItem")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// An existing item is left alone and affects zero rows
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO items (id, tenant_id, name, price, currency, max_per_user, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`+m.ignoreDuplicate,
+		item.ID, item.TenantID, item.Name, item.Price, currencyOrDefault(item.Currency), item.MaxPerUser, item.CreatedAt, item.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert item: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO inventory (item_id, tenant_id, stock, version, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?)`,
+		item.ID, item.TenantID, item.Stock, item.CreatedAt, item.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert inventory: %w", err)
+	}
+
+	return true, tx.Commit()
+}
+
+func (m *MySQLAdapter) GetItem(ctx context.Context, id string) (_ *domain.Item, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetItem")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) (*domain.Item, error) {
+		item, err := scanItem(db.QueryRowContext(ctx, `
+			SELECT `+itemColumns+`
+			FROM items it LEFT JOIN inventory inv ON inv.item_id = it.id
+			WHERE it.id = ?`, id,
+		))
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query item: %w", err)
+		}
+
+		return item, nil
+	})
+}
+
+const itemColumns = "it.id, it.tenant_id, it.name, COALESCE(inv.stock, 0), it.price, it.currency, it.max_per_user, it.created_at, it.updated_at"
+
+// scanItem reads the itemColumns of an items row joined with its inventory.
+func scanItem(row interface{ Scan(...any) error }) (*domain.Item, error) {
+	var item domain.Item
+	if err := row.Scan(&item.ID, &item.TenantID, &item.Name, &item.Stock, &item.Price, &item.Currency, &item.MaxPerUser,
+		&item.CreatedAt, &item.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (m *MySQLAdapter) ListItems(ctx context.Context) (_ []domain.Item, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListItems")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Item, error) {
+		rows, err := db.QueryContext(ctx, `
+			SELECT `+itemColumns+`
+			FROM items it LEFT JOIN inventory inv ON inv.item_id = it.id
+			ORDER BY it.id`,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("query items: %w", err)
+		}
+		defer rows.Close()
+
+		var items []domain.Item
+		for rows.Next() {
+			item, err := scanItem(rows)
+			if err != nil {
+				return nil, fmt.Errorf("scan item: %w", err)
+			}
+			items = append(items, *item)
+		}
+		return items, rows.Err()
+	})
+}
+
+func (m *MySQLAdapter) UpdateItem(ctx context.Context, item domain.Item) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateItem")
+	defer endSpan(span, &err)
+
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE items SET name = ?, price = ?, currency = ?, max_per_user = ?, updated_at = ?
+		WHERE id = ?`,
+		item.Name, item.Price, currencyOrDefault(item.Currency), item.MaxPerUser, item.UpdatedAt, item.ID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update item: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows > 0 {
+		return true, nil
+	}
+	return m.exists(ctx, "items", item.ID)
+}
+
+func (m *MySQLAdapter) CreateCampaign(ctx context.Context, campaign domain.Campaign) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateCampaign")
+	defer endSpan(span, &err)
+
+	itemIDs, err := json.Marshal(campaign.ItemIDs)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.db.ExecContext(ctx, `
+		INSERT INTO campaigns (id, tenant_id, name, item_ids, starts_at, ends_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`+m.ignoreDuplicate,
+		campaign.ID, campaign.TenantID, campaign.Name, itemIDs, campaign.StartsAt, campaign.EndsAt,
+		campaign.CreatedAt, campaign.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert campaign: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (m *MySQLAdapter) GetCampaign(ctx context.Context, id string) (_ *domain.Campaign, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetCampaign")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) (*domain.Campaign, error) {
+		campaign, err := scanCampaign(db.QueryRowContext(ctx, `
+			SELECT id, tenant_id, name, item_ids, starts_at, ends_at, created_at, updated_at
+			FROM campaigns WHERE id = ?`, id,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query campaign: %w", err)
+		}
+
+		return campaign, nil
+	})
+}
+
+func (m *MySQLAdapter) ListCampaigns(ctx context.Context) (_ []domain.Campaign, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListCampaigns")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Campaign, error) {
+		rows, err := db.QueryContext(ctx, `
+			SELECT id, tenant_id, name, item_ids, starts_at, ends_at, created_at, updated_at
+			FROM campaigns ORDER BY starts_at, id`,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("query campaigns: %w", err)
+		}
+		defer rows.Close()
+
+		var campaigns []domain.Campaign
+		for rows.Next() {
+			campaign, err := scanCampaign(rows)
+			if err != nil {
+				return nil, fmt.Errorf("scan campaign: %w", err)
+			}
+			campaigns = append(campaigns, *campaign)
+		}
+		return campaigns, rows.Err()
+	})
+}
+
+func (m *MySQLAdapter) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateCampaign")
+	defer endSpan(span, &err)
+
+	itemIDs, err := json.Marshal(campaign.ItemIDs)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE campaigns SET name = ?, item_ids = ?, starts_at = ?, ends_at = ?, updated_at = ?
+		WHERE id = ?`,
+		campaign.Name, itemIDs, campaign.StartsAt, campaign.EndsAt, campaign.UpdatedAt, campaign.ID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update campaign: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows > 0 {
+		return true, nil
+	}
+	return m.exists(ctx, "campaigns", campaign.ID)
+}
+
+const couponColumns = "code, percent_off, amount_off, currency, max_uses, starts_at, ends_at, created_at, updated_at"
+
+// scanCoupon reads the couponColumns of a coupons row.
+func scanCoupon(row interface{ Scan(...any) error }) (*domain.Coupon, error) {
+	var c domain.Coupon
+	if err := row.Scan(&c.Code, &c.PercentOff, &c.AmountOff, &c.Currency, &c.MaxUses,
+		&c.StartsAt, &c.EndsAt, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (m *MySQLAdapter) CreateCoupon(ctx context.Context, coupon domain.Coupon) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateCoupon")
+	defer endSpan(span, &err)
+
+	result, err := m.db.ExecContext(ctx, `
+		INSERT INTO coupons (`+couponColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+m.ignoreDuplicate,
+		coupon.Code, coupon.PercentOff, coupon.AmountOff, currencyOrDefault(coupon.Currency), coupon.MaxUses,
+		coupon.StartsAt, coupon.EndsAt, coupon.CreatedAt, coupon.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert coupon: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (m *MySQLAdapter) GetCoupon(ctx context.Context, code string) (_ *domain.Coupon, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetCoupon")
+	defer endSpan(span, &err)
+
+	coupon, err := scanCoupon(m.db.QueryRowContext(ctx, `
+		SELECT `+couponColumns+` FROM coupons WHERE code = ?`, code,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+func (m *MySQLAdapter) ListCoupons(ctx context.Context) (_ []domain.Coupon, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListCoupons")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Coupon, error) {
+		rows, err := db.QueryContext(ctx, `SELECT `+couponColumns+` FROM coupons ORDER BY code`)
+		if err != nil {
+			return nil, fmt.Errorf("query coupons: %w", err)
+		}
+		defer rows.Close()
+
+		var coupons []domain.Coupon
+		for rows.Next() {
+			coupon, err := scanCoupon(rows)
+			if err != nil {
+				return nil, fmt.Errorf("scan coupon: %w", err)
+			}
+			coupons = append(coupons, *coupon)
+		}
+		return coupons, rows.Err()
+	})
+}
+
+func (m *MySQLAdapter) UpdateCoupon(ctx context.Context, coupon domain.Coupon) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateCoupon")
+	defer endSpan(span, &err)
+
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE coupons
+		SET percent_off = ?, amount_off = ?, currency = ?, max_uses = ?, starts_at = ?, ends_at = ?, updated_at = ?
+		WHERE code = ?`,
+		coupon.PercentOff, coupon.AmountOff, currencyOrDefault(coupon.Currency), coupon.MaxUses,
+		coupon.StartsAt, coupon.EndsAt, coupon.UpdatedAt, coupon.Code,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update coupon: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows > 0 {
+		return true, nil
+	}
+	found, err := m.GetCoupon(ctx, coupon.Code)
+	return found != nil, err
+}
+
+// SetUserTier replaces the user's tier. Only tiers other than TierNormal
+// are stored.
+func (m *MySQLAdapter) SetUserTier(ctx context.Context, userID string, tier domain.UserTier) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "SetUserTier")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_tiers WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete user tier: %w", err)
+	}
+	if tier != domain.TierNormal {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO user_tiers (user_id, tier, updated_at)
+			VALUES (?, ?, ?)`,
+			userID, string(tier), time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("insert user tier: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *MySQLAdapter) ListUserTiers(ctx context.Context) (_ map[string]domain.UserTier, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListUserTiers")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) (map[string]domain.UserTier, error) {
+		rows, err := db.QueryContext(ctx, `SELECT user_id, tier FROM user_tiers`)
+		if err != nil {
+			return nil, fmt.Errorf("query user tiers: %w", err)
+		}
+		defer rows.Close()
+
+		tiers := make(map[string]domain.UserTier)
+		for rows.Next() {
+			var userID, tier string
+			if err := rows.Scan(&userID, &tier); err != nil {
+				return nil, fmt.Errorf("scan user tier: %w", err)
+			}
+			tiers[userID] = domain.UserTier(tier)
+		}
+		return tiers, rows.Err()
+	})
+}
+
+func (m *MySQLAdapter) RecordCompensation(ctx context.Context, c domain.StockCompensation) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "RecordCompensation")
+	defer endSpan(span, &err)
+
+	_, err = m.db.ExecContext(ctx, `
+		INSERT INTO stock_compensations (id, item_id, quantity, reason, attempts, last_error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.ItemID, c.Quantity, c.Reason, c.Attempts, truncate(c.LastError, 1024), c.CreatedAt, c.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert compensation: %w", err)
+	}
+	return nil
+}
+
+func (m *MySQLAdapter) PendingCompensations(ctx context.Context, limit int) (_ []domain.StockCompensation, err error) {
+	ctx, span := startSpan(ctx, "mysql", "PendingCompensations")
+	defer endSpan(span, &err)
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT id, item_id, quantity, reason, attempts, last_error, created_at, updated_at
+		FROM stock_compensations
+		WHERE resolved_at IS NULL
+		ORDER BY created_at
+		LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query compensations: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []domain.StockCompensation
+	for rows.Next() {
+		var c domain.StockCompensation
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.Quantity, &c.Reason, &c.Attempts, &c.LastError, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan compensation: %w", err)
+		}
+		pending = append(pending, c)
+	}
+	return pending, rows.Err()
+}
+
+func (m *MySQLAdapter) ResolveCompensation(ctx context.Context, id string, at time.Time) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ResolveCompensation")
+	defer endSpan(span, &err)
+
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE stock_compensations SET resolved_at = ?, updated_at = ?
+		WHERE id = ? AND resolved_at IS NULL`,
+		at, at, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("resolve compensation: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (m *MySQLAdapter) ReopenCompensation(ctx context.Context, id, lastError string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "ReopenCompensation")
+	defer endSpan(span, &err)
+
+	_, err = m.db.ExecContext(ctx, `
+		UPDATE stock_compensations
+		SET resolved_at = NULL, attempts = attempts + 1, last_error = ?, updated_at = ?
+		WHERE id = ?`,
+		truncate(lastError, 1024), at, id,
+	)
+	if err != nil {
+		return fmt.Errorf("reopen compensation: %w", err)
+	}
+	return nil
+}
+
+const refundColumns = "id, order_id, payment_id, amount, reason, step, attempts, last_error, version, created_at, updated_at"
+
+// scanRefund reads the refundColumns of a refunds row.
+func scanRefund(row interface{ Scan(...any) error }) (*domain.Refund, error) {
+	var refund domain.Refund
+	var paymentID sql.NullString
+	if err := row.Scan(&refund.ID, &refund.OrderID, &paymentID, &refund.Amount, &refund.Reason, &refund.Step,
+		&refund.Attempts, &refund.LastError, &refund.Version, &refund.CreatedAt, &refund.UpdatedAt); err != nil {
+		return nil, err
+	}
+	refund.PaymentID = paymentID.String
+	return &refund, nil
+}
+
+func (m *MySQLAdapter) CreateRefund(ctx context.Context, refund domain.Refund) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "CreateRefund")
+	defer endSpan(span, &err)
+
+	// An existing refund is left alone and affects zero rows
+	result, err := m.db.ExecContext(ctx, `
+		INSERT INTO refunds (`+refundColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`+m.ignoreDuplicate,
+		refund.ID, refund.OrderID, sql.NullString{String: refund.PaymentID, Valid: refund.PaymentID != ""},
+		refund.Amount, truncate(refund.Reason, 1024), refund.Step, refund.Attempts, truncate(refund.LastError, 1024),
+		refund.Version, refund.CreatedAt, refund.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert refund: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (m *MySQLAdapter) GetRefundByOrder(ctx context.Context, orderID string) (_ *domain.Refund, err error) {
+	ctx, span := startSpan(ctx, "mysql", "GetRefundByOrder")
+	defer endSpan(span, &err)
+
+	refund, err := scanRefund(m.db.QueryRowContext(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds WHERE order_id = ?`, orderID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query refund: %w", err)
+	}
+	return refund, nil
+}
+
+func (m *MySQLAdapter) StaleRefunds(ctx context.Context, before time.Time, limit int) (_ []domain.Refund, err error) {
+	ctx, span := startSpan(ctx, "mysql", "StaleRefunds")
+	defer endSpan(span, &err)
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+refundColumns+`
+		FROM refunds
+		WHERE step <> ? AND updated_at < ?
+		ORDER BY updated_at
+		LIMIT ?`,
+		domain.RefundStepDone, before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query refunds: %w", err)
+	}
+	defer rows.Close()
+
+	var refunds []domain.Refund
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan refund: %w", err)
+		}
+		refunds = append(refunds, *refund)
+	}
+	return refunds, rows.Err()
+}
+
+func (m *MySQLAdapter) UpdateRefund(ctx context.Context, refund domain.Refund) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "UpdateRefund")
+	defer endSpan(span, &err)
+
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE refunds
+		SET step = ?, attempts = ?, last_error = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND version = ?`,
+		refund.Step, refund.Attempts, truncate(refund.LastError, 1024), refund.UpdatedAt, refund.ID, refund.Version,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update refund: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+func (m *MySQLAdapter) RestockRefund(ctx context.Context, refund domain.Refund) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "mysql", "RestockRefund")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE refunds
+		SET step = ?, attempts = 0, last_error = '', version = version + 1, updated_at = ?
+		WHERE id = ? AND version = ? AND step = ?`,
+		domain.RefundStepStatus, refund.UpdatedAt, refund.ID, refund.Version, domain.RefundStepInventory,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update refund: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return false, nil
+	}
+
+	if err := releaseOrderTx(ctx, tx, refund.OrderID); err != nil {
+		return false, err
+	}
+
+	// Allocation orders never took from the cache
+	lines, err := tx.QueryContext(ctx, `
+		SELECT oi.item_id, oi.quantity
+		FROM order_items oi JOIN orders o ON o.id = oi.order_id
+		WHERE oi.order_id = ? AND o.allocation_id IS NULL
+		ORDER BY oi.line`, refund.OrderID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("query order items: %w", err)
+	}
+	var taken []domain.OrderItem
+	for lines.Next() {
+		var line domain.OrderItem
+		if err := lines.Scan(&line.ItemID, &line.Quantity); err != nil {
+			lines.Close()
+			return false, fmt.Errorf("scan order item: %w", err)
+		}
+		taken = append(taken, line)
+	}
+	lines.Close()
+	if err := lines.Err(); err != nil {
+		return false, err
+	}
+
+	for _, line := range taken {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO stock_compensations (id, item_id, quantity, reason, attempts, last_error, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 0, '', ?, ?)`,
+			uuid.New().String(), line.ItemID, line.Quantity, "refund "+refund.ID, refund.UpdatedAt, refund.UpdatedAt,
+		)
+		if err != nil {
+			return false, fmt.Errorf("insert compensation: %w", err)
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// exists reports whether table has a row with the given id. MySQL counts an
+// UPDATE that leaves a row unchanged as affecting zero rows, so updates fall
+// back to this to tell a no-op from a missing row.
+func (m *MySQLAdapter) exists(ctx context.Context, table, id string) (bool, error) {
+	var found int
+	err := m.db.QueryRowContext(ctx, "SELECT 1 FROM "+table+" WHERE id = ?", id).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query %s: %w", table, err)
+	}
+	return true, nil
+}
+
+// ArchiveOrders copies the oldest orders and their lines into the archive
+// tables and deletes them from the hot ones. The orders are locked while
+// they are moved, so an order refunded or confirmed meanwhile is either
+// moved after the change or waits for the next run.
+func (m *MySQLAdapter) ArchiveOrders(ctx context.Context, before time.Time, limit int) (_ int, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ArchiveOrders")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, created_at FROM orders
+		WHERE created_at < ? AND (status <> ? OR expires_at IS NULL)
+		ORDER BY created_at
+		LIMIT ? `+m.forUpdate,
+		before, string(domain.OrderStatusPending), limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("query orders to archive: %w", err)
+	}
+	var (
+		ids    []any
+		oldest time.Time
+	)
+	for rows.Next() {
+		var (
+			id        string
+			createdAt time.Time
+		)
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan order id: %w", err)
+		}
+		if len(ids) == 0 {
+			oldest = createdAt
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	// The batch was read oldest first, so its creation times bound it; on a
+	// partitioned orders table that keeps the copy to the partitions
+	// holding it
+	if _, err := tx.ExecContext(ctx, `INSERT INTO orders_archive (`+orderColumns+`, archived_at) SELECT `+orderColumns+`, ? FROM orders
+		WHERE created_at >= ? AND created_at < ? AND id IN `+in,
+		slices.Concat([]any{time.Now(), oldest, before}, ids)...); err != nil {
+		return 0, fmt.Errorf("archive orders: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO order_items_archive (order_id, line, item_id, quantity, unit_price, total_price)
+		SELECT order_id, line, item_id, quantity, unit_price, total_price FROM order_items WHERE order_id IN `+in, ids...); err != nil {
+		return 0, fmt.Errorf("archive order items: %w", err)
+	}
+	if err := m.removeOrdersTx(ctx, tx, ids, oldest, before); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(ids), nil
+}
+
+// removeOrdersTx deletes the orders with the given IDs, created between
+// oldest and before, with their lines and read model rows, and records
+// that they were archived.
+func (m *MySQLAdapter) removeOrdersTx(ctx context.Context, tx *sql.Tx, ids []any, oldest, before time.Time) error {
+	in := `(?` + strings.Repeat(", ?", len(ids)-1) + `)`
+	statements := []struct {
+		what  string
+		query string
+		args  []any
+	}{
+		{"delete order views", `DELETE FROM order_views WHERE order_id IN ` + in, ids},
+		{"delete order items", `DELETE FROM order_items WHERE order_id IN ` + in, ids},
+		{"delete orders", `DELETE FROM orders WHERE created_at >= ? AND created_at < ? AND id IN ` + in, slices.Concat([]any{oldest, before}, ids)},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return fmt.Errorf("%s: %w", stmt.what, err)
+		}
+	}
+	for _, id := range ids {
+		if err := m.recordChangeTx(ctx, tx, domain.OrderChange{OrderID: id.(string), Type: domain.OrderChangeArchived}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendAudit inserts the record. The table's triggers refuse updates and
+// deletes, so nothing written here can be changed afterwards.
+func (m *MySQLAdapter) AppendAudit(ctx context.Context, record domain.AuditRecord) (_ *domain.AuditRecord, err error) {
+	ctx, span := startSpan(ctx, "mysql", "AppendAudit")
+	defer endSpan(span, &err)
+
+	res, err := m.db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, target, before_state, after_state, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		truncate(record.Actor, 255), string(record.Action), truncate(record.Target, 255),
+		sql.NullString{String: record.Before, Valid: record.Before != ""},
+		sql.NullString{String: record.After, Valid: record.After != ""},
+		truncate(record.Reason, 1024), record.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert audit record: %w", err)
+	}
+	if record.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("read audit record id: %w", err)
+	}
+	return &record, nil
+}
+
+func (m *MySQLAdapter) ListAudit(ctx context.Context, filter domain.AuditFilter) (_ []domain.AuditRecord, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListAudit")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.AuditRecord, error) {
+		query := `SELECT id, actor, action, target, before_state, after_state, reason, created_at FROM audit_log WHERE 1 = 1`
+		var args []any
+		for _, cond := range []struct {
+			column, value string
+		}{{"actor", filter.Actor}, {"action", string(filter.Action)}, {"target", filter.Target}} {
+			if cond.value != "" {
+				query += ` AND ` + cond.column + ` = ?`
+				args = append(args, cond.value)
+			}
+		}
+		if filter.BeforeID != 0 {
+			query += ` AND id < ?`
+			args = append(args, filter.BeforeID)
+		}
+		query += ` ORDER BY id DESC LIMIT ?`
+		args = append(args, filter.Limit)
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("query audit log: %w", err)
+		}
+		defer rows.Close()
+
+		var records []domain.AuditRecord
+		for rows.Next() {
+			var record domain.AuditRecord
+			var action string
+			var before, after sql.NullString
+			if err := rows.Scan(&record.ID, &record.Actor, &action, &record.Target, &before, &after,
+				&record.Reason, &record.CreatedAt); err != nil {
+				return nil, fmt.Errorf("scan audit record: %w", err)
+			}
+			record.Action = domain.AuditAction(action)
+			record.Before, record.After = before.String, after.String
+			records = append(records, record)
+		}
+		return records, rows.Err()
+	})
+}
+
+// truncate cuts s to at most n bytes to fit a VARCHAR column, dropping any
+// rune split by the cut.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// scanCampaign reads a campaigns row from either a single-row or
+// multi-row query.
+func scanCampaign(row interface{ Scan(...any) error }) (*domain.Campaign, error) {
+	var campaign domain.Campaign
+	var itemIDs []byte
+	err := row.Scan(&campaign.ID, &campaign.TenantID, &campaign.Name, &itemIDs, &campaign.StartsAt, &campaign.EndsAt,
+		&campaign.CreatedAt, &campaign.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(itemIDs, &campaign.ItemIDs); err != nil {
+		return nil, fmt.Errorf("decode item ids: %w", err)
+	}
+	return &campaign, nil
+}
@@ -11,7 +11,7 @@ import (
 	"github.com/rl1809/flash-sale/internal/core/domain"
 )
 
-func getMySQLDB(t *testing.T) *sql.DB {
+func getMySQLDB(t testing.TB) *sql.DB {
 	dsn := os.Getenv("MYSQL_DSN")
 	if dsn == "" {
 		dsn = "root:root@tcp(localhost:3306)/flashsale?parseTime=true"
@@ -205,3 +205,213 @@ func TestUpdateInventory_OptimisticLock(t *testing.T) {
 		t.Errorf("expected ErrOptimisticLock, got: %v", err)
 	}
 }
+
+func TestAllocation_CreateAndFulfill(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	adapter := NewMySQLAdapter(db)
+
+	// Setup
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO inventory (item_id, stock, version) VALUES ('alloc-test-item', 100, 0)
+		ON DUPLICATE KEY UPDATE stock = 100, version = 0`)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	alloc := domain.Allocation{
+		ID:        "test-alloc-" + time.Now().Format("20060102150405"),
+		PartnerID: "test-partner",
+		ItemID:    "alloc-test-item",
+		Quantity:  2,
+		Status:    domain.AllocationStatusOpen,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := adapter.CreateAllocation(ctx, alloc); err != nil {
+		t.Fatalf("CreateAllocation failed: %v", err)
+	}
+
+	// Verify inventory decremented by the whole block
+	var stock int
+	db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = 'alloc-test-item'`).Scan(&stock)
+	if stock != 98 {
+		t.Errorf("expected stock 98, got %d", stock)
+	}
+
+	order := domain.Order{
+		ID:           alloc.ID + "-order",
+		UserID:       "test-user",
+		ItemID:       alloc.ItemID,
+		Quantity:     2,
+		Status:       domain.OrderStatusConfirmed,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		AllocationID: alloc.ID,
+	}
+
+	if err := adapter.FulfillAllocation(ctx, order); err != nil {
+		t.Fatalf("FulfillAllocation failed: %v", err)
+	}
+
+	got, err := adapter.GetAllocation(ctx, alloc.ID)
+	if err != nil {
+		t.Fatalf("GetAllocation failed: %v", err)
+	}
+	if got.Fulfilled != 2 || got.Status != domain.AllocationStatusFulfilled {
+		t.Errorf("expected fulfilled allocation, got %+v", got)
+	}
+
+	// Over-fulfillment is rejected
+	order.ID = alloc.ID + "-order-2"
+	order.Quantity = 1
+	if err := adapter.FulfillAllocation(ctx, order); err != ErrAllocationExhausted {
+		t.Errorf("expected ErrAllocationExhausted, got: %v", err)
+	}
+
+	// Cleanup
+	db.ExecContext(ctx, `DELETE FROM orders WHERE allocation_id = ?`, alloc.ID)
+	db.ExecContext(ctx, `DELETE FROM allocations WHERE id = ?`, alloc.ID)
+}
+
+func TestItem_CreateAndUpdate(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	adapter := NewMySQLAdapter(db)
+
+	// Cleanup previous runs
+	db.ExecContext(ctx, `DELETE FROM items WHERE id = 'crud-test-item'`)
+	db.ExecContext(ctx, `DELETE FROM inventory WHERE item_id = 'crud-test-item'`)
+
+	now := time.Now().Truncate(time.Second)
+	item := domain.Item{ID: "crud-test-item", Name: "Test", Stock: 7, CreatedAt: now, UpdatedAt: now}
+
+	created, err := adapter.CreateItem(ctx, item)
+	if err != nil || !created {
+		t.Fatalf("create failed: created=%v err=%v", created, err)
+	}
+	if created, _ := adapter.CreateItem(ctx, item); created {
+		t.Error("expected duplicate item to be rejected")
+	}
+
+	// Same values as stored: MySQL reports no changed rows
+	updated, err := adapter.UpdateItem(ctx, item)
+	if err != nil || !updated {
+		t.Errorf("expected no-op update to find the item: updated=%v err=%v", updated, err)
+	}
+
+	got, err := adapter.GetItem(ctx, item.ID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got == nil || got.Name != "Test" || got.Stock != 7 {
+		t.Errorf("unexpected item: %+v", got)
+	}
+}
+
+func TestCompensation_ResolveOnce(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	adapter := NewMySQLAdapter(db)
+
+	// Cleanup previous runs
+	db.ExecContext(ctx, `DELETE FROM stock_compensations WHERE id = 'compensation-test'`)
+
+	now := time.Now().Truncate(time.Second)
+	err := adapter.RecordCompensation(ctx, domain.StockCompensation{
+		ID: "compensation-test", ItemID: "iphone-15", Quantity: 2, Attempts: 1,
+		LastError: "redis down", CreatedAt: now, UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	resolved, err := adapter.ResolveCompensation(ctx, "compensation-test", now)
+	if err != nil || !resolved {
+		t.Fatalf("expected first resolve to win: resolved=%v err=%v", resolved, err)
+	}
+	if resolved, _ := adapter.ResolveCompensation(ctx, "compensation-test", now); resolved {
+		t.Error("expected second resolve to lose")
+	}
+
+	if err := adapter.ReopenCompensation(ctx, "compensation-test", "still down", now); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	pending, err := adapter.PendingCompensations(ctx, 1000)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var found *domain.StockCompensation
+	for i := range pending {
+		if pending[i].ID == "compensation-test" {
+			found = &pending[i]
+		}
+	}
+	if found == nil || found.Attempts != 2 || found.LastError != "still down" {
+		t.Errorf("expected reopened compensation with 2 attempts, got %+v", found)
+	}
+}
+
+func TestRefund_RestockOnce(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	adapter := NewMySQLAdapter(db)
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO inventory (item_id, stock, version) VALUES ('test-item', 100, 0)
+		ON DUPLICATE KEY UPDATE stock = 100, version = 0`)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// Cleanup previous runs
+	db.ExecContext(ctx, `DELETE FROM refunds WHERE order_id = 'test-refund-order'`)
+	db.ExecContext(ctx, `DELETE FROM orders WHERE id = 'test-refund-order'`)
+	db.ExecContext(ctx, `DELETE FROM stock_compensations WHERE reason = 'refund test-refund'`)
+
+	now := time.Now().Truncate(time.Second)
+	order := domain.Order{ID: "test-refund-order", UserID: "test-user", ItemID: "test-item", Quantity: 2,
+		Status: domain.OrderStatusConfirmed, CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("CreateOrder failed: %v", err)
+	}
+
+	refund := domain.Refund{ID: "test-refund", OrderID: order.ID, Amount: 100, Step: domain.RefundStepInventory, CreatedAt: now, UpdatedAt: now}
+	if created, err := adapter.CreateRefund(ctx, refund); err != nil || !created {
+		t.Fatalf("expected the refund created: created=%v err=%v", created, err)
+	}
+
+	if ok, err := adapter.RestockRefund(ctx, refund); err != nil || !ok {
+		t.Fatalf("expected the restock to apply: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := adapter.RestockRefund(ctx, refund); ok {
+		t.Error("expected a stale restock to lose")
+	}
+
+	var stock, compensations int
+	db.QueryRowContext(ctx, `SELECT stock FROM inventory WHERE item_id = 'test-item'`).Scan(&stock)
+	db.QueryRowContext(ctx, `SELECT COUNT(*) FROM stock_compensations WHERE reason = 'refund test-refund'`).Scan(&compensations)
+	if stock != 100 || compensations != 1 {
+		t.Errorf("expected stock 100 and 1 compensation, got %d and %d", stock, compensations)
+	}
+
+	stored, err := adapter.GetRefundByOrder(ctx, order.ID)
+	if err != nil || stored == nil || stored.Step != domain.RefundStepStatus || stored.Version != 1 {
+		t.Errorf("unexpected refund: %+v, %v", stored, err)
+	}
+
+	// Cleanup
+	db.ExecContext(ctx, `DELETE FROM refunds WHERE order_id = ?`, order.ID)
+	db.ExecContext(ctx, `DELETE FROM orders WHERE id = ?`, order.ID)
+	db.ExecContext(ctx, `DELETE FROM stock_compensations WHERE reason = 'refund test-refund'`)
+	db.ExecContext(ctx, `UPDATE inventory SET stock = 100, version = 0 WHERE item_id = 'test-item'`)
+}
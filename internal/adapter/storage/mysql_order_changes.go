@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// WithOrderChanges turns on the event-sourced order store: every write to
+// an order appends its change to order_changes in the same transaction,
+// and GetOrder derives the order from its changes rather than reading the
+// orders row, which it falls back to for orders saved before. The orders
+// table is still written, as the current state the listings, exports and
+// inventory checks read.
+func WithOrderChanges() MySQLOption {
+	return func(m *MySQLAdapter) {
+		m.orderChanges = true
+	}
+}
+
+const insertOrderChangeQuery = `
+	INSERT INTO order_changes (order_id, type, data, payment_id, occurred_at)
+	VALUES (?, ?, ?, ?, ?)`
+
+// recordCreatedTx appends the accepted and persisted changes of a new order.
+func (m *MySQLAdapter) recordCreatedTx(ctx context.Context, tx *sql.Tx, order domain.Order) error {
+	if !m.orderChanges {
+		return nil
+	}
+	// What is not stored with the order is not part of it either
+	order.Tier, order.TraceContext = "", nil
+	accepted := domain.OrderChange{OrderID: order.ID, Type: domain.OrderChangeAccepted, Order: &order, OccurredAt: order.CreatedAt}
+	if err := m.recordChangeTx(ctx, tx, accepted); err != nil {
+		return err
+	}
+	return m.recordChangeTx(ctx, tx, domain.OrderChange{OrderID: order.ID, Type: domain.OrderChangePersisted})
+}
+
+// recordChangeTx appends change, stamped now unless it has a time of its
+// own.
+func (m *MySQLAdapter) recordChangeTx(ctx context.Context, tx *sql.Tx, change domain.OrderChange) error {
+	if !m.orderChanges {
+		return nil
+	}
+	var data sql.NullString
+	if change.Order != nil {
+		encoded, err := json.Marshal(change.Order)
+		if err != nil {
+			return fmt.Errorf("encode order: %w", err)
+		}
+		data = sql.NullString{String: string(encoded), Valid: true}
+	}
+	if change.OccurredAt.IsZero() {
+		change.OccurredAt = time.Now()
+	}
+
+	_, err := m.execTx(ctx, tx, insertOrderChangeQuery,
+		change.OrderID, change.Type, data, sql.NullString{String: change.PaymentID, Valid: change.PaymentID != ""}, change.OccurredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("record order change: %w", err)
+	}
+	return nil
+}
+
+func (m *MySQLAdapter) OrderChanges(ctx context.Context, orderID string) (_ []domain.OrderChange, err error) {
+	ctx, span := startSpan(ctx, "mysql", "OrderChanges")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.OrderChange, error) {
+		return queryOrderChanges(ctx, db, `
+			SELECT `+orderChangeColumns+` FROM order_changes
+			WHERE order_id = ?
+			ORDER BY seq`, orderID,
+		)
+	})
+}
+
+func (m *MySQLAdapter) OrderChangesAfter(ctx context.Context, afterSeq int64, limit int) (_ []domain.OrderChange, err error) {
+	ctx, span := startSpan(ctx, "mysql", "OrderChangesAfter")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.OrderChange, error) {
+		return queryOrderChanges(ctx, db, `
+			SELECT `+orderChangeColumns+` FROM order_changes
+			WHERE seq > ?
+			ORDER BY seq
+			LIMIT ?`, afterSeq, limit,
+		)
+	})
+}
+
+// replayOrder derives an order from its changes, read from db. It reports
+// false for an order without changes, such as one saved before changes were
+// kept, whose orders row is its only record.
+func (m *MySQLAdapter) replayOrder(ctx context.Context, db *sql.DB, id string) (*domain.Order, bool, error) {
+	changes, err := queryOrderChanges(ctx, db, `
+		SELECT `+orderChangeColumns+` FROM order_changes
+		WHERE order_id = ?
+		ORDER BY seq`, id,
+	)
+	if err != nil || len(changes) == 0 {
+		return nil, false, err
+	}
+	order, err := domain.ReplayOrder(changes)
+	return order, true, err
+}
+
+const orderChangeColumns = "seq, order_id, type, data, payment_id, occurred_at"
+
+func queryOrderChanges(ctx context.Context, db *sql.DB, query string, args ...any) ([]domain.OrderChange, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query order changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []domain.OrderChange
+	for rows.Next() {
+		var change domain.OrderChange
+		var data, paymentID sql.NullString
+		if err := rows.Scan(&change.Seq, &change.OrderID, &change.Type, &data, &paymentID, &change.OccurredAt); err != nil {
+			return nil, fmt.Errorf("scan order change: %w", err)
+		}
+		if data.Valid {
+			change.Order = &domain.Order{}
+			if err := json.Unmarshal([]byte(data.String), change.Order); err != nil {
+				return nil, fmt.Errorf("decode order of change %d: %w", change.Seq, err)
+			}
+		}
+		change.PaymentID = paymentID.String
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OffloadOrders reads the oldest orders with their lines and deletes them
+// once keep has stored them elsewhere. The orders stay locked from the read
+// to the delete, so one refunded or confirmed meanwhile is either kept after
+// the change or waits for the next run.
+func (m *MySQLAdapter) OffloadOrders(ctx context.Context, before time.Time, limit int, keep func([]domain.Order) error) (_ int, err error) {
+	ctx, span := startSpan(ctx, "mysql", "OffloadOrders")
+	defer endSpan(span, &err)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+orderColumns+` FROM orders
+		WHERE created_at < ? AND (status <> ? OR expires_at IS NULL)
+		ORDER BY created_at
+		LIMIT ? `+m.forUpdate,
+		before, string(domain.OrderStatusPending), limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("query orders to offload: %w", err)
+	}
+	var orders []domain.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(orders) == 0 {
+		return 0, nil
+	}
+	if err := m.loadOrderItems(ctx, tx, orders); err != nil {
+		return 0, err
+	}
+
+	if err := keep(orders); err != nil {
+		return 0, err
+	}
+
+	ids := make([]any, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	if err := m.removeOrdersTx(ctx, tx, ids, orders[0].CreatedAt, before); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(orders), nil
+}
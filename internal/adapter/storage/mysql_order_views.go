@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// ProjectOrders copies the orders' lines, with their order's details, into
+// order_views. The lines of an order never change, so a row already there
+// only takes the new status, hold and update time; an upsert leaves the
+// other servers' projections free of the gap locks a delete and insert
+// would take.
+func (m *MySQLAdapter) ProjectOrders(ctx context.Context, ids []string) (err error) {
+	ctx, span := startSpan(ctx, "mysql", "ProjectOrders")
+	defer endSpan(span, &err)
+
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err = m.db.ExecContext(ctx, `
+		INSERT INTO order_views (order_id, line, line_count, tenant_id, user_id, item_id, quantity, total_price,
+			order_quantity, order_total, currency, coupon_code, discount, status, expires_at, created_at, updated_at)
+		SELECT oi.order_id, oi.line, (SELECT COUNT(*) FROM order_items c WHERE c.order_id = o.id), o.tenant_id, o.user_id,
+			oi.item_id, oi.quantity, oi.total_price, o.quantity, o.total_price, o.currency, o.coupon_code,
+			o.discount, o.status, o.expires_at, o.created_at, o.updated_at
+		FROM orders o JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		`+m.updateView, args...,
+	)
+	if err != nil {
+		return fmt.Errorf("project orders: %w", err)
+	}
+	return nil
+}
+
+// ListOrderViews pages through a user's orders like ListOrdersByUser, from
+// the first line of each order in order_views. Only orders of several lines
+// need their other lines read.
+func (m *MySQLAdapter) ListOrderViews(ctx context.Context, userID string, filter domain.OrderFilter) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ListOrderViews")
+	defer endSpan(span, &err)
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.Order, error) {
+		query := `
+			SELECT order_id, line_count, tenant_id, item_id, order_quantity, order_total, currency, coupon_code, discount,
+				status, expires_at, created_at, updated_at
+			FROM order_views WHERE user_id = ? AND line = 0`
+		args := []any{userID}
+		query, args = scopeTenant(ctx, query, args)
+		if filter.Status != "" {
+			query += ` AND status = ?`
+			args = append(args, filter.Status)
+		}
+		if !filter.From.IsZero() {
+			query += ` AND created_at >= ?`
+			args = append(args, filter.From)
+		}
+		if !filter.To.IsZero() {
+			query += ` AND created_at < ?`
+			args = append(args, filter.To)
+		}
+		if filter.After != nil {
+			query += ` AND (created_at < ? OR (created_at = ? AND order_id < ?))`
+			args = append(args, filter.After.CreatedAt, filter.After.CreatedAt, filter.After.ID)
+		}
+		query += ` ORDER BY created_at DESC, order_id DESC LIMIT ?`
+		args = append(args, filter.Limit)
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("query order views: %w", err)
+		}
+		defer rows.Close()
+
+		var orders []domain.Order
+		var carts []any
+		for rows.Next() {
+			order := domain.Order{UserID: userID}
+			var lines int
+			var couponCode sql.NullString
+			var expiresAt, createdAt, updatedAt sql.NullTime
+			if err := rows.Scan(&order.ID, &lines, &order.TenantID, &order.ItemID, &order.Quantity, &order.TotalPrice, &order.Currency,
+				&couponCode, &order.Discount, &order.Status, &expiresAt, &createdAt, &updatedAt); err != nil {
+				return nil, fmt.Errorf("scan order view: %w", err)
+			}
+			order.CouponCode = couponCode.String
+			order.ExpiresAt = expiresAt.Time
+			order.CreatedAt = createdAt.Time
+			order.UpdatedAt = updatedAt.Time
+			orders = append(orders, order)
+			if lines > 1 {
+				carts = append(carts, order.ID)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+
+		if len(carts) == 0 {
+			return orders, nil
+		}
+		return orders, loadViewLines(ctx, db, orders, carts)
+	})
+}
+
+// loadViewLines sets the lines of the orders with the given IDs from
+// order_views.
+func loadViewLines(ctx context.Context, db *sql.DB, orders []domain.Order, ids []any) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT order_id, item_id, quantity, total_price
+		FROM order_views
+		WHERE order_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY order_id, line`, ids...,
+	)
+	if err != nil {
+		return fmt.Errorf("query order view lines: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[string][]domain.OrderItem)
+	for rows.Next() {
+		var orderID string
+		var line domain.OrderItem
+		if err := rows.Scan(&orderID, &line.ItemID, &line.Quantity, &line.TotalPrice); err != nil {
+			return fmt.Errorf("scan order view line: %w", err)
+		}
+		lines[orderID] = append(lines[orderID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range orders {
+		if items, ok := lines[orders[i].ID]; ok {
+			orders[i].Items = items
+		}
+	}
+	return nil
+}
+
+// ItemOrderTotals totals the lines of the items in order_views, each a scan
+// of idx_item_status.
+func (m *MySQLAdapter) ItemOrderTotals(ctx context.Context, itemIDs []string) (_ []domain.ItemOrderTotals, err error) {
+	ctx, span := startSpan(ctx, "mysql", "ItemOrderTotals")
+	defer endSpan(span, &err)
+
+	if len(itemIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(itemIDs))
+	for i, id := range itemIDs {
+		args[i] = id
+	}
+
+	return readFrom(ctx, m, func(db *sql.DB) ([]domain.ItemOrderTotals, error) {
+		rows, err := db.QueryContext(ctx, `
+			SELECT item_id, status, COUNT(DISTINCT order_id), SUM(quantity), SUM(total_price)
+			FROM order_views
+			WHERE item_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+			GROUP BY item_id, status
+			ORDER BY item_id, status`, args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("query item order totals: %w", err)
+		}
+		defer rows.Close()
+
+		var totals []domain.ItemOrderTotals
+		for rows.Next() {
+			var t domain.ItemOrderTotals
+			if err := rows.Scan(&t.ItemID, &t.Status, &t.Orders, &t.Units, &t.Revenue); err != nil {
+				return nil, fmt.Errorf("scan item order totals: %w", err)
+			}
+			totals = append(totals, t)
+		}
+		return totals, rows.Err()
+	})
+}
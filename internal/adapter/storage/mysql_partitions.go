@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PartitionPeriod is how much of the orders' history one partition holds.
+type PartitionPeriod string
+
+const (
+	PartitionByDay   PartitionPeriod = "day"
+	PartitionByMonth PartitionPeriod = "month"
+)
+
+// maxPartition is the partition catching every order newer than the
+// others, which new partitions are split off.
+const maxPartition = "p_max"
+
+// OrderPartitions keeps the orders table partitioned by the time orders
+// were created. Maintain splits partitions for the coming periods off the
+// last one before orders arrive for them, and drops the partitions older
+// than the retention once archiving has emptied them, so that a sale day
+// writes to and reads from a small partition of its own.
+type OrderPartitions struct {
+	db        *sql.DB
+	period    PartitionPeriod
+	ahead     int
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewOrderPartitions maintains ahead partitions of period beyond the
+// current one. Partitions whose orders are all older than retention are
+// dropped once empty; a retention of 0 keeps every partition.
+func NewOrderPartitions(db *sql.DB, period PartitionPeriod, ahead int, retention time.Duration) *OrderPartitions {
+	return &OrderPartitions{db: db, period: period, ahead: ahead, retention: retention, now: time.Now}
+}
+
+// partition is a range partition of the orders table holding the orders
+// created before bound, in unix seconds; the last one has no bound.
+type partition struct {
+	name  string
+	bound int64
+}
+
+// Maintain adds and drops partitions as the period calls for, returning
+// how many it added and dropped.
+func (p *OrderPartitions) Maintain(ctx context.Context) (_ int, err error) {
+	ctx, span := startSpan(ctx, "mysql", "MaintainPartitions")
+	defer endSpan(span, &err)
+
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := p.now()
+	var cutoff time.Time
+	if p.retention > 0 {
+		cutoff = now.Add(-p.retention)
+	}
+	add, drop := planPartitions(existing, p.period, p.ahead, now, cutoff)
+
+	changed := 0
+	if len(add) > 0 {
+		defs := make([]string, 0, len(add)+1)
+		for _, part := range add {
+			defs = append(defs, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%d)", part.name, part.bound))
+		}
+		defs = append(defs, "PARTITION "+maxPartition+" VALUES LESS THAN MAXVALUE")
+		query := "ALTER TABLE orders REORGANIZE PARTITION " + maxPartition + " INTO (" + strings.Join(defs, ", ") + ")"
+		if _, err := p.db.ExecContext(ctx, query); err != nil {
+			return 0, fmt.Errorf("add order partitions: %w", err)
+		}
+		changed += len(add)
+	}
+	for _, name := range drop {
+		// Orders the archive job keeps, such as unpaid holds, would be lost
+		// with the partition, so only an empty one goes
+		var one int
+		err := p.db.QueryRowContext(ctx, "SELECT 1 FROM orders PARTITION (`"+name+"`) LIMIT 1").Scan(&one)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return changed, fmt.Errorf("check order partition %s: %w", name, err)
+		}
+		if _, err := p.db.ExecContext(ctx, "ALTER TABLE orders DROP PARTITION `"+name+"`"); err != nil {
+			return changed, fmt.Errorf("drop order partition %s: %w", name, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// partitions returns the partitions of the orders table in order.
+func (p *OrderPartitions) partitions(ctx context.Context) ([]partition, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT PARTITION_NAME, PARTITION_DESCRIPTION FROM information_schema.PARTITIONS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'orders'
+		ORDER BY PARTITION_ORDINAL_POSITION`)
+	if err != nil {
+		return nil, fmt.Errorf("query order partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var parts []partition
+	for rows.Next() {
+		var name, description sql.NullString
+		if err := rows.Scan(&name, &description); err != nil {
+			return nil, fmt.Errorf("scan order partition: %w", err)
+		}
+		if !name.Valid {
+			return nil, errors.New("orders table is not partitioned")
+		}
+		part := partition{name: name.String}
+		if description.String != "MAXVALUE" {
+			if part.bound, err = strconv.ParseInt(description.String, 10, 64); err != nil {
+				return nil, fmt.Errorf("order partition %s: bound %q", part.name, description.String)
+			}
+		}
+		parts = append(parts, part)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 || parts[len(parts)-1].name != maxPartition {
+		return nil, fmt.Errorf("orders table has no %s partition", maxPartition)
+	}
+	return parts, nil
+}
+
+// planPartitions returns the partitions to split off the last one so that
+// the current period and ahead more each have their own, and the names of
+// those holding only orders created before cutoff. Periods follow UTC. The
+// first partition added also holds every older order not yet in one.
+func planPartitions(existing []partition, period PartitionPeriod, ahead int, now, cutoff time.Time) (add []partition, drop []string) {
+	var last int64
+	for _, part := range existing {
+		if part.bound == 0 {
+			continue
+		}
+		last = max(last, part.bound)
+		if !cutoff.IsZero() && part.bound <= cutoff.Unix() {
+			drop = append(drop, part.name)
+		}
+	}
+
+	start := periodStart(now.UTC(), period)
+	for range ahead + 1 {
+		end := nextPeriod(start, period)
+		if end.Unix() > last {
+			add = append(add, partition{name: partitionName(start, period), bound: end.Unix()})
+		}
+		start = end
+	}
+	return add, drop
+}
+
+func periodStart(t time.Time, period PartitionPeriod) time.Time {
+	if period == PartitionByMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func nextPeriod(start time.Time, period PartitionPeriod) time.Time {
+	if period == PartitionByMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func partitionName(start time.Time, period PartitionPeriod) string {
+	if period == PartitionByMonth {
+		return start.Format("p200601")
+	}
+	return start.Format("p20060102")
+}
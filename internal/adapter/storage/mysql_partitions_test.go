@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlanPartitions(t *testing.T) {
+	now := time.Date(2026, 3, 30, 15, 0, 0, 0, time.UTC)
+	day := func(d int) int64 { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC).Unix() }
+
+	tests := []struct {
+		name     string
+		existing []partition
+		period   PartitionPeriod
+		cutoff   time.Time
+		add      []partition
+		drop     []string
+	}{
+		{
+			name:     "first run",
+			existing: []partition{{name: maxPartition}},
+			period:   PartitionByDay,
+			add: []partition{
+				{name: "p20260330", bound: day(31)},
+				{name: "p20260331", bound: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC).Unix()},
+			},
+		},
+		{
+			name:     "up to date",
+			existing: []partition{{name: "p20260330", bound: day(31)}, {name: "p20260331", bound: day(32)}, {name: maxPartition}},
+			period:   PartitionByDay,
+		},
+		{
+			name:     "old partitions",
+			existing: []partition{{name: "p20260301", bound: day(2)}, {name: "p20260302", bound: day(3)}, {name: "p20260330", bound: day(31)}, {name: maxPartition}},
+			period:   PartitionByDay,
+			cutoff:   time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC),
+			add:      []partition{{name: "p20260331", bound: day(32)}},
+			drop:     []string{"p20260301"},
+		},
+		{
+			name:     "months",
+			existing: []partition{{name: maxPartition}},
+			period:   PartitionByMonth,
+			add: []partition{
+				{name: "p202603", bound: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC).Unix()},
+				{name: "p202604", bound: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC).Unix()},
+			},
+		},
+	}
+	for _, tt := range tests {
+		add, drop := planPartitions(tt.existing, tt.period, 1, now, tt.cutoff)
+		if !slices.Equal(add, tt.add) {
+			t.Errorf("%s: expected to add %v, got %v", tt.name, tt.add, add)
+		}
+		if !slices.Equal(drop, tt.drop) {
+			t.Errorf("%s: expected to drop %v, got %v", tt.name, tt.drop, drop)
+		}
+	}
+}
+
+func TestOrderPartitions_Maintain(t *testing.T) {
+	db := getMySQLDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	partitions := NewOrderPartitions(db, PartitionByDay, 2, 0)
+	if _, err := partitions.Maintain(ctx); err != nil {
+		t.Fatalf("maintain: %v", err)
+	}
+	parts, err := partitions.partitions(ctx)
+	if err != nil {
+		t.Fatalf("list partitions: %v", err)
+	}
+	if len(parts) < 4 {
+		t.Fatalf("expected today, 2 days ahead and %s, got %v", maxPartition, parts)
+	}
+	if added, err := partitions.Maintain(ctx); err != nil || added != 0 {
+		t.Errorf("expected nothing to do the second time, got %d, %v", added, err)
+	}
+}
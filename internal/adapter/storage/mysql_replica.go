@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// MySQLOption configures a MySQLAdapter.
+type MySQLOption func(*MySQLAdapter)
+
+// WithReplica sends reads that may lag behind writes to a read-only
+// replica: orders, inventory, items, campaigns, coupons, tiers and the
+// audit log. Writes, the reads of work queues and reads marked with
+// port.ReadPrimary stay on the primary.
+func WithReplica(db *sql.DB) MySQLOption {
+	return func(m *MySQLAdapter) {
+		m.replica = &replica{db: db}
+		m.replica.healthy.Store(true)
+	}
+}
+
+// replica is a read-only copy of the database that takes reads while it
+// answers them.
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// readFrom runs read against the replica when it may serve it, and against
+// the primary when there is no replica, it is down or it fails the read. A
+// failed read marks the replica down until CheckReplica sees it answer.
+func readFrom[T any](ctx context.Context, m *MySQLAdapter, read func(db *sql.DB) (T, error)) (T, error) {
+	r := m.replica
+	if r == nil || !r.healthy.Load() || port.ReadsPrimary(ctx) {
+		return read(m.db)
+	}
+
+	result, err := read(r.db)
+	if err == nil || ctx.Err() != nil {
+		return result, err
+	}
+	if r.healthy.CompareAndSwap(true, false) {
+		log.Printf("mysql replica failed a read, reading from the primary: %v", err)
+	}
+	return read(m.db)
+}
+
+// CheckReplica pings the replica every interval until ctx is done, taking
+// it out of rotation while it does not answer and back once it does. It
+// returns at once if there is no replica.
+func (m *MySQLAdapter) CheckReplica(ctx context.Context, interval time.Duration) {
+	r := m.replica
+	if r == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+		switch {
+		case err != nil && r.healthy.CompareAndSwap(true, false):
+			log.Printf("mysql replica is down, reading from the primary: %v", err)
+		case err == nil && r.healthy.CompareAndSwap(false, true):
+			log.Printf("mysql replica is back, reading from it again")
+		}
+	}
+}
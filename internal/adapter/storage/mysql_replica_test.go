@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestReplica_RoutesReads(t *testing.T) {
+	ctx := context.Background()
+	primary := newSQLiteAdapter(t)
+	replicaAdapter := newSQLiteAdapter(t)
+	WithReplica(replicaAdapter.db)(primary.MySQLAdapter)
+	now := time.Now()
+
+	// The replica lags: it has the item at its old stock.
+	if _, err := primary.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 5, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("create item on primary: %v", err)
+	}
+	if _, err := replicaAdapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 9, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("create item on replica: %v", err)
+	}
+
+	inv, err := primary.GetInventory(ctx, "item-1")
+	if err != nil || inv.Quantity != 9 {
+		t.Fatalf("GetInventory = %+v, %v, want the replica's stock 9", inv, err)
+	}
+	inv, err = primary.GetInventory(port.ReadPrimary(ctx), "item-1")
+	if err != nil || inv.Quantity != 5 {
+		t.Fatalf("GetInventory(ReadPrimary) = %+v, %v, want the primary's stock 5", inv, err)
+	}
+
+	// A replica that fails a read is skipped until it answers again.
+	replicaAdapter.db.Close()
+	inv, err = primary.GetInventory(ctx, "item-1")
+	if err != nil || inv.Quantity != 5 {
+		t.Fatalf("GetInventory with replica down = %+v, %v, want the primary's stock 5", inv, err)
+	}
+	if primary.replica.healthy.Load() {
+		t.Fatal("replica still healthy after a failed read")
+	}
+}
+
+func TestReplica_CheckReplica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary := newSQLiteAdapter(t)
+	replicaAdapter := newSQLiteAdapter(t)
+	WithReplica(replicaAdapter.db)(primary.MySQLAdapter)
+	primary.replica.healthy.Store(false)
+
+	done := make(chan struct{})
+	go func() {
+		primary.CheckReplica(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !primary.replica.healthy.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("replica not back in rotation after answering pings")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,545 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	// ErrShardDown is returned for work on a shard that stopped answering
+	// pings, without waiting on its connections.
+	ErrShardDown = port.ErrShardDown
+	// ErrCrossShard is returned for orders, or batches of them, with items
+	// on different shards, which no one transaction can write.
+	ErrCrossShard = port.ErrCrossShard
+)
+
+// ShardedDatabase spreads the orders and inventory of a large catalog over
+// several MySQL databases, each with its own connection pool, so that many
+// sales at once do not all queue on the same server. Every item lives on
+// the shard its ID hashes to, along with its inventory, allocations,
+// orders, refunds and stock compensations; an order is kept on the shard of
+// its items. Campaigns, coupons, user tiers and the audit log stay on the
+// first shard, the home shard.
+//
+// Work on one item goes to its shard; reads across items, such as a user's
+// orders or an export, ask every shard at once and merge the answers. The
+// number of shards decides where each item lives, so it cannot change once
+// orders are written.
+type ShardedDatabase struct {
+	// The home shard answers everything not routed by item
+	*MySQLAdapter
+	shards []*shard
+}
+
+// shard is one database of a ShardedDatabase, taking work while it answers.
+type shard struct {
+	index   int
+	adapter *MySQLAdapter
+	healthy atomic.Bool
+}
+
+// NewShardedDatabase routes over shards, the first of them the home shard.
+// The adapters should not record order changes, as each shard would number
+// its own.
+func NewShardedDatabase(shards ...*MySQLAdapter) *ShardedDatabase {
+	s := &ShardedDatabase{MySQLAdapter: shards[0]}
+	for i, adapter := range shards {
+		sh := &shard{index: i, adapter: adapter}
+		sh.healthy.Store(true)
+		s.shards = append(s.shards, sh)
+	}
+	return s
+}
+
+// shardOf returns the shard holding the item.
+func (s *ShardedDatabase) shardOf(itemID string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(itemID))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// ShardOf returns the index of the shard holding the item.
+func (s *ShardedDatabase) ShardOf(itemID string) int {
+	return s.shardOf(itemID).index
+}
+
+// Shards returns the number of shards.
+func (s *ShardedDatabase) Shards() int {
+	return len(s.shards)
+}
+
+// route returns the adapter of the item's shard, unless the shard is down.
+func (s *ShardedDatabase) route(itemID string) (*MySQLAdapter, error) {
+	return s.shardOf(itemID).use()
+}
+
+func (sh *shard) use() (*MySQLAdapter, error) {
+	if !sh.healthy.Load() {
+		return nil, fmt.Errorf("%w: shard %d", ErrShardDown, sh.index)
+	}
+	return sh.adapter, nil
+}
+
+// orderShard returns the shard holding every line of the order.
+func (s *ShardedDatabase) orderShard(order domain.Order) (*shard, error) {
+	lines := order.Lines()
+	sh := s.shardOf(lines[0].ItemID)
+	for _, line := range lines[1:] {
+		if s.shardOf(line.ItemID) != sh {
+			return nil, fmt.Errorf("%w: order %s", ErrCrossShard, order.ID)
+		}
+	}
+	return sh, nil
+}
+
+// gather runs read on every shard at once and returns the answers in shard
+// order. A shard that is down or fails the read fails the whole of it, as
+// a partial answer would silently miss orders.
+func gather[T any](ctx context.Context, s *ShardedDatabase, read func(ctx context.Context, m *MySQLAdapter) (T, error)) ([]T, error) {
+	results := make([]T, len(s.shards))
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, sh := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := sh.use()
+			if err == nil {
+				results[i], err = read(ctx, m)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", sh.index, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
+
+// merge sorts the shards' answers together and keeps the first limit.
+func merge[T any](parts [][]T, compare func(a, b T) int, limit int) []T {
+	merged := slices.Concat(parts...)
+	slices.SortStableFunc(merged, compare)
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
+
+// first returns the first answer found on any shard.
+func first[T any](parts []*T) *T {
+	for _, part := range parts {
+		if part != nil {
+			return part
+		}
+	}
+	return nil
+}
+
+// locateOrder returns the adapter of the shard holding the order, or nil if
+// no shard has it.
+func (s *ShardedDatabase) locateOrder(ctx context.Context, id string) (*MySQLAdapter, error) {
+	found, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (*MySQLAdapter, error) {
+		order, err := m.GetOrder(ctx, id)
+		if order == nil || err != nil {
+			return nil, err
+		}
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range found {
+		if m != nil {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// newestFirst orders a user's orders as ListOrdersByUser does.
+func newestFirst(a, b domain.Order) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.ID, a.ID)
+}
+
+func (s *ShardedDatabase) CreateOrder(ctx context.Context, order domain.Order) error {
+	return s.CreateOrders(ctx, []domain.Order{order})
+}
+
+// CreateOrders writes the batch on its shard. A batch with orders on
+// different shards is refused whole, so the caller writes the orders one
+// by one instead of some being saved and others not.
+func (s *ShardedDatabase) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	var target *shard
+	for _, order := range orders {
+		sh, err := s.orderShard(order)
+		if err != nil {
+			return err
+		}
+		if target != nil && sh != target {
+			return fmt.Errorf("%w: batch of %d orders", ErrCrossShard, len(orders))
+		}
+		target = sh
+	}
+	m, err := target.use()
+	if err != nil {
+		return err
+	}
+	return m.CreateOrders(ctx, orders)
+}
+
+func (s *ShardedDatabase) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	orders, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (*domain.Order, error) {
+		return m.GetOrder(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return first(orders), nil
+}
+
+func (s *ShardedDatabase) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	m, err := s.locateOrder(ctx, id)
+	if m == nil || err != nil {
+		return false, err
+	}
+	return m.UpdateOrderStatus(ctx, id, from, to)
+}
+
+func (s *ShardedDatabase) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	m, err := s.locateOrder(ctx, id)
+	if m == nil || err != nil {
+		return false, err
+	}
+	return m.ConfirmOrder(ctx, id, paymentID)
+}
+
+func (s *ShardedDatabase) ExpiredOrders(ctx context.Context, before time.Time, limit int) ([]domain.Order, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Order, error) {
+		return m.ExpiredOrders(ctx, before, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, func(a, b domain.Order) int { return a.ExpiresAt.Compare(b.ExpiresAt) }, limit), nil
+}
+
+func (s *ShardedDatabase) ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Order, error) {
+		return m.ListOrdersByUser(ctx, userID, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, newestFirst, filter.Limit), nil
+}
+
+func (s *ShardedDatabase) ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) ([]domain.Order, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Order, error) {
+		return m.ListOrdersAfter(ctx, window, afterID, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, func(a, b domain.Order) int { return cmp.Compare(a.ID, b.ID) }, limit), nil
+}
+
+func (s *ShardedDatabase) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
+	m, err := s.route(itemID)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetInventory(ctx, itemID)
+}
+
+func (s *ShardedDatabase) UpdateInventory(ctx context.Context, inventory domain.Inventory) error {
+	m, err := s.route(inventory.ItemID)
+	if err != nil {
+		return err
+	}
+	return m.UpdateInventory(ctx, inventory)
+}
+
+func (s *ShardedDatabase) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error {
+	m, err := s.route(inv.ItemID)
+	if err != nil {
+		return err
+	}
+	return m.RestockInventory(ctx, inv, restock)
+}
+
+func (s *ShardedDatabase) CreateAllocation(ctx context.Context, allocation domain.Allocation) error {
+	m, err := s.route(allocation.ItemID)
+	if err != nil {
+		return err
+	}
+	return m.CreateAllocation(ctx, allocation)
+}
+
+func (s *ShardedDatabase) GetAllocation(ctx context.Context, id string) (*domain.Allocation, error) {
+	allocations, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (*domain.Allocation, error) {
+		return m.GetAllocation(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return first(allocations), nil
+}
+
+func (s *ShardedDatabase) FulfillAllocation(ctx context.Context, order domain.Order) error {
+	sh, err := s.orderShard(order)
+	if err != nil {
+		return err
+	}
+	m, err := sh.use()
+	if err != nil {
+		return err
+	}
+	return m.FulfillAllocation(ctx, order)
+}
+
+func (s *ShardedDatabase) CreateItem(ctx context.Context, item domain.Item) (bool, error) {
+	m, err := s.route(item.ID)
+	if err != nil {
+		return false, err
+	}
+	return m.CreateItem(ctx, item)
+}
+
+func (s *ShardedDatabase) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	m, err := s.route(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetItem(ctx, id)
+}
+
+func (s *ShardedDatabase) ListItems(ctx context.Context) ([]domain.Item, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Item, error) {
+		return m.ListItems(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := slices.Concat(parts...)
+	slices.SortFunc(items, func(a, b domain.Item) int { return cmp.Compare(a.ID, b.ID) })
+	return items, nil
+}
+
+func (s *ShardedDatabase) UpdateItem(ctx context.Context, item domain.Item) (bool, error) {
+	m, err := s.route(item.ID)
+	if err != nil {
+		return false, err
+	}
+	return m.UpdateItem(ctx, item)
+}
+
+// ProjectOrders asks every shard to project the orders, each skipping those
+// it does not hold.
+func (s *ShardedDatabase) ProjectOrders(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (struct{}, error) {
+		return struct{}{}, m.ProjectOrders(ctx, ids)
+	})
+	return err
+}
+
+func (s *ShardedDatabase) ListOrderViews(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Order, error) {
+		return m.ListOrderViews(ctx, userID, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, newestFirst, filter.Limit), nil
+}
+
+// ItemOrderTotals asks each shard for the totals of its own items.
+func (s *ShardedDatabase) ItemOrderTotals(ctx context.Context, itemIDs []string) ([]domain.ItemOrderTotals, error) {
+	byShard := make(map[*MySQLAdapter][]string)
+	for _, itemID := range itemIDs {
+		m := s.shardOf(itemID).adapter
+		byShard[m] = append(byShard[m], itemID)
+	}
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.ItemOrderTotals, error) {
+		return m.ItemOrderTotals(ctx, byShard[m])
+	})
+	if err != nil {
+		return nil, err
+	}
+	totals := slices.Concat(parts...)
+	slices.SortFunc(totals, func(a, b domain.ItemOrderTotals) int {
+		return cmp.Or(cmp.Compare(a.ItemID, b.ItemID), cmp.Compare(a.Status, b.Status))
+	})
+	return totals, nil
+}
+
+// ArchiveOrders archives up to limit orders on each shard, so a run may move
+// up to limit times the number of shards.
+func (s *ShardedDatabase) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int, error) {
+	moved, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (int, error) {
+		return m.ArchiveOrders(ctx, before, limit)
+	})
+	total := 0
+	for _, n := range moved {
+		total += n
+	}
+	return total, err
+}
+
+// OffloadOrders offloads up to limit orders on each shard. The shards call
+// keep concurrently.
+func (s *ShardedDatabase) OffloadOrders(ctx context.Context, before time.Time, limit int, keep func([]domain.Order) error) (int, error) {
+	moved, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (int, error) {
+		return m.OffloadOrders(ctx, before, limit, keep)
+	})
+	total := 0
+	for _, n := range moved {
+		total += n
+	}
+	return total, err
+}
+
+// CreateRefund saves the refund on the shard of its order, which it returns
+// the order's units to.
+func (s *ShardedDatabase) CreateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	m, err := s.locateOrder(ctx, refund.OrderID)
+	if err != nil {
+		return false, err
+	}
+	if m == nil {
+		return false, fmt.Errorf("order %s not found", refund.OrderID)
+	}
+	return m.CreateRefund(ctx, refund)
+}
+
+func (s *ShardedDatabase) GetRefundByOrder(ctx context.Context, orderID string) (*domain.Refund, error) {
+	refunds, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (*domain.Refund, error) {
+		return m.GetRefundByOrder(ctx, orderID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return first(refunds), nil
+}
+
+func (s *ShardedDatabase) StaleRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Refund, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.Refund, error) {
+		return m.StaleRefunds(ctx, before, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, func(a, b domain.Refund) int { return a.UpdatedAt.Compare(b.UpdatedAt) }, limit), nil
+}
+
+func (s *ShardedDatabase) UpdateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	m, err := s.locateOrder(ctx, refund.OrderID)
+	if m == nil || err != nil {
+		return false, err
+	}
+	return m.UpdateRefund(ctx, refund)
+}
+
+func (s *ShardedDatabase) RestockRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	m, err := s.locateOrder(ctx, refund.OrderID)
+	if m == nil || err != nil {
+		return false, err
+	}
+	return m.RestockRefund(ctx, refund)
+}
+
+// RecordCompensation logs the compensation on the shard of its item, where
+// refunds log theirs.
+func (s *ShardedDatabase) RecordCompensation(ctx context.Context, compensation domain.StockCompensation) error {
+	m, err := s.route(compensation.ItemID)
+	if err != nil {
+		return err
+	}
+	return m.RecordCompensation(ctx, compensation)
+}
+
+func (s *ShardedDatabase) PendingCompensations(ctx context.Context, limit int) ([]domain.StockCompensation, error) {
+	parts, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) ([]domain.StockCompensation, error) {
+		return m.PendingCompensations(ctx, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge(parts, func(a, b domain.StockCompensation) int { return a.CreatedAt.Compare(b.CreatedAt) }, limit), nil
+}
+
+// ResolveCompensation resolves the compensation on whichever shard holds it.
+func (s *ShardedDatabase) ResolveCompensation(ctx context.Context, id string, at time.Time) (bool, error) {
+	resolved, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (bool, error) {
+		return m.ResolveCompensation(ctx, id, at)
+	})
+	return slices.Contains(resolved, true), err
+}
+
+// ReopenCompensation reopens the compensation on whichever shard holds it.
+func (s *ShardedDatabase) ReopenCompensation(ctx context.Context, id, lastError string, at time.Time) error {
+	_, err := gather(ctx, s, func(ctx context.Context, m *MySQLAdapter) (struct{}, error) {
+		return struct{}{}, m.ReopenCompensation(ctx, id, lastError, at)
+	})
+	return err
+}
+
+// CheckShards pings every shard each interval until ctx is done, failing
+// the work routed to a shard at once while it does not answer, rather than
+// holding purchases on its connection pool, and taking it back once it
+// does.
+func (s *ShardedDatabase) CheckShards(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		for _, sh := range s.shards {
+			pingCtx, cancel := context.WithTimeout(ctx, interval)
+			err := sh.adapter.db.PingContext(pingCtx)
+			cancel()
+			switch {
+			case err != nil && sh.healthy.CompareAndSwap(true, false):
+				log.Printf("mysql shard %d is down, failing its work: %v", sh.index, err)
+			case err == nil && sh.healthy.CompareAndSwap(false, true):
+				log.Printf("mysql shard %d is back", sh.index)
+			}
+		}
+	}
+}
+
+// Close releases the statements every shard prepared. The databases are
+// left open for their owner to close.
+func (s *ShardedDatabase) Close() error {
+	var errs []error
+	for _, sh := range s.shards {
+		errs = append(errs, sh.adapter.Close())
+	}
+	return errors.Join(errs...)
+}
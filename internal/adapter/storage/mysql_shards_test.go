@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// newShardedSQLite shards over n in-memory SQLite databases.
+func newShardedSQLite(t *testing.T, n int) *ShardedDatabase {
+	t.Helper()
+	var shards []*MySQLAdapter
+	for range n {
+		shards = append(shards, newSQLiteAdapter(t).MySQLAdapter)
+	}
+	return NewShardedDatabase(shards...)
+}
+
+// itemsOnShards returns an item ID on each of two different shards.
+func itemsOnShards(s *ShardedDatabase) (string, string) {
+	a := "item-0"
+	for i := 1; ; i++ {
+		b := fmt.Sprintf("item-%d", i)
+		if s.shardOf(b) != s.shardOf(a) {
+			return a, b
+		}
+	}
+}
+
+func TestShardedDatabase_RoutesByItem(t *testing.T) {
+	ctx := context.Background()
+	s := newShardedSQLite(t, 3)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i := range 12 {
+		itemID := fmt.Sprintf("item-%d", i)
+		if _, err := s.CreateItem(ctx, domain.Item{ID: itemID, Name: itemID, Stock: 10, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("create %s: %v", itemID, err)
+		}
+		for _, sh := range s.shards {
+			item, _ := sh.adapter.GetItem(ctx, itemID)
+			if (item != nil) != (sh == s.shardOf(itemID)) {
+				t.Errorf("%s: expected only on shard %d, found on shard %d", itemID, s.shardOf(itemID).index, sh.index)
+			}
+		}
+	}
+	items, err := s.ListItems(ctx)
+	if err != nil || len(items) != 12 || items[0].ID != "item-0" || items[11].ID != "item-9" {
+		t.Fatalf("expected all 12 items in ID order, got %d, %v", len(items), err)
+	}
+
+	for i := range 12 {
+		order := domain.Order{
+			ID: fmt.Sprintf("order-%02d", i), ItemID: fmt.Sprintf("item-%d", i), UserID: "user-1", Quantity: 1,
+			Status: domain.OrderStatusPending, CreatedAt: now.Add(time.Duration(i) * time.Second), UpdatedAt: now,
+		}
+		if err := s.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+	inv, err := s.GetInventory(ctx, "item-7")
+	if err != nil || inv == nil || inv.Quantity != 9 {
+		t.Fatalf("expected the order to take from its item's inventory, got %+v, %v", inv, err)
+	}
+
+	page, err := s.ListOrdersAfter(ctx, domain.OrderWindow{}, "order-03", 4)
+	if err != nil || len(page) != 4 || page[0].ID != "order-04" || page[3].ID != "order-07" {
+		t.Errorf("expected orders 04 to 07 across shards, got %v, %v", page, err)
+	}
+	history, err := s.ListOrdersByUser(ctx, "user-1", domain.OrderFilter{Limit: 3})
+	if err != nil || len(history) != 3 || history[0].ID != "order-11" || history[2].ID != "order-09" {
+		t.Errorf("expected the newest 3 orders, got %v, %v", history, err)
+	}
+
+	ok, err := s.ConfirmOrder(ctx, "order-05", "pay-1")
+	if !ok || err != nil {
+		t.Fatalf("expected the order confirmed on its shard, got %v, %v", ok, err)
+	}
+	if order, err := s.GetOrder(ctx, "order-05"); err != nil || order == nil || order.Status != domain.OrderStatusConfirmed {
+		t.Errorf("expected the confirmed order back, got %+v, %v", order, err)
+	}
+	if ok, err := s.UpdateOrderStatus(ctx, "missing", domain.OrderStatusPending, domain.OrderStatusCancelled); ok || err != nil {
+		t.Errorf("expected no change for a missing order, got %v, %v", ok, err)
+	}
+}
+
+func TestShardedDatabase_RefusesCrossShardWrites(t *testing.T) {
+	ctx := context.Background()
+	s := newShardedSQLite(t, 2)
+	a, b := itemsOnShards(s)
+	now := time.Now().UTC()
+	for _, itemID := range []string{a, b} {
+		s.CreateItem(ctx, domain.Item{ID: itemID, Name: itemID, Stock: 10, CreatedAt: now, UpdatedAt: now})
+	}
+
+	cart := domain.Order{ID: "cart", ItemID: a, UserID: "user-1", Quantity: 2, Status: domain.OrderStatusConfirmed,
+		Items: []domain.OrderItem{{ItemID: a, Quantity: 1}, {ItemID: b, Quantity: 1}}, CreatedAt: now, UpdatedAt: now}
+	if err := s.CreateOrder(ctx, cart); !errors.Is(err, ErrCrossShard) {
+		t.Errorf("expected ErrCrossShard for a cart across shards, got %v", err)
+	}
+
+	batch := []domain.Order{
+		{ID: "order-1", ItemID: a, UserID: "user-1", Quantity: 1, Status: domain.OrderStatusConfirmed, CreatedAt: now, UpdatedAt: now},
+		{ID: "order-2", ItemID: b, UserID: "user-1", Quantity: 1, Status: domain.OrderStatusConfirmed, CreatedAt: now, UpdatedAt: now},
+	}
+	if err := s.CreateOrders(ctx, batch); !errors.Is(err, ErrCrossShard) {
+		t.Fatalf("expected ErrCrossShard for a batch across shards, got %v", err)
+	}
+	if order, _ := s.GetOrder(ctx, "order-1"); order != nil {
+		t.Error("expected nothing of a refused batch saved")
+	}
+}
+
+func TestShardedDatabase_ShardDown(t *testing.T) {
+	ctx := context.Background()
+	s := newShardedSQLite(t, 2)
+	a, b := itemsOnShards(s)
+	s.shardOf(b).healthy.Store(false)
+
+	if _, err := s.GetInventory(ctx, b); !errors.Is(err, ErrShardDown) {
+		t.Errorf("expected ErrShardDown for an item on the down shard, got %v", err)
+	}
+	if _, err := s.GetInventory(ctx, a); err != nil {
+		t.Errorf("expected the other shard to keep working, got %v", err)
+	}
+	if _, err := s.GetOrder(ctx, "order-1"); !errors.Is(err, ErrShardDown) {
+		t.Errorf("expected a read across shards to fail while one is down, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// WithoutPreparedStatements runs every query as it comes instead of
+// preparing the order writes once, for proxies that do not support
+// prepared statements.
+func WithoutPreparedStatements() MySQLOption {
+	return func(m *MySQLAdapter) {
+		m.statements = nil
+	}
+}
+
+// statements prepares the queries run on every order write once and
+// reuses them. database/sql prepares a statement again on each connection
+// it is first used on and keeps it there, so the server parses each query
+// once per connection rather than once per call, and the MySQL driver
+// sends one round trip per call instead of a prepare, an execute and a
+// close.
+type statements struct {
+	db *sql.DB
+
+	mu       sync.Mutex
+	prepared map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{db: db, prepared: make(map[string]*sql.Stmt)}
+}
+
+// prepare prepares those of queries not prepared yet. Preparing takes a
+// connection of its own, which a transaction holding the last one would
+// wait for forever, so it is done before the transaction begins. A query
+// that fails to prepare runs unprepared and is tried again next time.
+func (s *statements) prepare(ctx context.Context, queries ...string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, query := range queries {
+		if _, ok := s.prepared[query]; ok {
+			continue
+		}
+		if stmt, err := s.db.PrepareContext(ctx, query); err == nil {
+			s.prepared[query] = stmt
+		}
+	}
+}
+
+// lookup returns the statement of query, nil if it is not prepared.
+func (s *statements) lookup(query string) *sql.Stmt {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prepared[query]
+}
+
+// close releases the prepared statements.
+func (s *statements) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var first error
+	for query, stmt := range s.prepared {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(s.prepared, query)
+	}
+	return first
+}
+
+// orderWrites returns the queries writing a new order.
+func (m *MySQLAdapter) orderWrites() []string {
+	queries := []string{insertOrderQuery, insertOrderItemQuery, takeInventoryQuery}
+	if m.orderChanges {
+		queries = append(queries, insertOrderChangeQuery)
+	}
+	return queries
+}
+
+// execTx runs query in tx, as its prepared statement if there is one.
+func (m *MySQLAdapter) execTx(ctx context.Context, tx *sql.Tx, query string, args ...any) (sql.Result, error) {
+	if stmt := m.statements.lookup(query); stmt != nil {
+		return tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	}
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// Close releases the statements the adapter prepared. The database is left
+// open for its owner to close.
+func (m *MySQLAdapter) Close() error {
+	if m.statements == nil {
+		return nil
+	}
+	return m.statements.close()
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestSQLite_PreparedOrderWrites(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name     string
+		opts     []MySQLOption
+		prepared int
+	}{
+		{"prepared", nil, 3},
+		{"with order changes", []MySQLOption{WithOrderChanges()}, 4},
+		{"unprepared", []MySQLOption{WithoutPreparedStatements()}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := newSQLiteAdapter(t, tt.opts...)
+			adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+
+			for i := range 3 {
+				order := domain.Order{ID: fmt.Sprintf("order-%d", i), ItemID: "item-1", UserID: "user-1", Quantity: 1,
+					Status: domain.OrderStatusPending, CreatedAt: now, UpdatedAt: now}
+				if err := adapter.CreateOrder(ctx, order); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if inv, _ := adapter.GetInventory(ctx, "item-1"); inv == nil || inv.Quantity != 7 {
+				t.Errorf("expected 7 units left, got %+v", inv)
+			}
+
+			var prepared int
+			if adapter.statements != nil {
+				prepared = len(adapter.statements.prepared)
+			}
+			if prepared != tt.prepared {
+				t.Errorf("expected %d statements prepared, got %d", tt.prepared, prepared)
+			}
+			if err := adapter.Close(); err != nil {
+				t.Errorf("unexpected error closing: %v", err)
+			}
+		})
+	}
+}
+
+// benchmarkCreateOrders persists single-item orders of an item stocked in
+// db, as the workers do.
+func benchmarkCreateOrders(b *testing.B, adapter *MySQLAdapter, itemID string) {
+	ctx := context.Background()
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		order := domain.Order{ID: "bench-" + uuid.NewString(), ItemID: itemID, UserID: "bench-user", Quantity: 1,
+			Status: domain.OrderStatusPending, CreatedAt: now, UpdatedAt: now}
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateOrders_SQLite(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []MySQLOption
+	}{
+		{"prepared", nil},
+		{"unprepared", []MySQLOption{WithoutPreparedStatements()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			db, err := OpenSQLite(context.Background(), SQLiteMemory)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			adapter := NewSQLiteAdapter(db, bench.opts...)
+			adapter.CreateItem(context.Background(), domain.Item{ID: "bench-item", Name: "Bench", Stock: 1 << 30})
+			benchmarkCreateOrders(b, adapter.MySQLAdapter, "bench-item")
+		})
+	}
+}
+
+// BenchmarkCreateOrders_MySQL needs MYSQL_DSN or a local server. The MySQL
+// driver prepares, runs and closes an unprepared query with arguments, so
+// the prepared statements save two round trips per query.
+func BenchmarkCreateOrders_MySQL(b *testing.B) {
+	db := getMySQLDB(b)
+	defer db.Close()
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO inventory (item_id, stock, version) VALUES ('bench-item', 1000000000, 0)
+		ON DUPLICATE KEY UPDATE stock = 1000000000`); err != nil {
+		b.Fatalf("setup failed: %v", err)
+	}
+	b.Cleanup(func() { cleanUpBenchOrders(db) })
+
+	for _, bench := range []struct {
+		name string
+		opts []MySQLOption
+	}{
+		{"prepared", nil},
+		{"unprepared", []MySQLOption{WithoutPreparedStatements()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			adapter := NewMySQLAdapter(db, bench.opts...)
+			defer adapter.Close()
+			benchmarkCreateOrders(b, adapter, "bench-item")
+		})
+	}
+}
+
+func cleanUpBenchOrders(db *sql.DB) {
+	ctx := context.Background()
+	db.ExecContext(ctx, `DELETE FROM order_items WHERE order_id LIKE 'bench-%'`)
+	db.ExecContext(ctx, `DELETE FROM orders WHERE id LIKE 'bench-%'`)
+	db.ExecContext(ctx, `DELETE FROM inventory WHERE item_id = 'bench-item'`)
+}
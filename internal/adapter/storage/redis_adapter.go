@@ -2,68 +2,1321 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const (
+	stockKeyPrefix       = "stock:"
+	frozenKeyPrefix      = "frozen:"
+	closedKeyPrefix      = "closed:"
+	idempotencyPrefix    = "idempotency:"
+	purchaseRecordPrefix = "purchase-record:"
+	campaignKeyPrefix    = "campaign:"
+	tenantKeyPrefix      = "tenant:"
+	stockChannelPrefix   = "stock-updates:"
+	resultChannelPrefix  = "order-results:"
+	lockKeyPrefix        = "lock:"
+	leasesKeyPrefix      = "leases:"
+	leaseExpiryPrefix    = "lease-expiry:"
+	quotaKeyPrefix       = "quota:"
+	couponKeyPrefix      = "coupon-uses:"
+	lotteryKeyPrefix     = "lottery:"
+	entrantsKeyPrefix    = "lottery-entrants:"
+	lotteryItemsKey      = "lottery-items"
+	orderSpoolKey        = "order-spool"
+	bannedUsersKey       = "blacklist:users"
+	bannedIPsKey         = "blacklist:ips"
+	riskCountPrefix      = "risk:"
+	firstSeenKey         = "risk:first-seen"
+	idempotencyPending   = "pending"
+	decrementOpPrefix    = "decrement-op:"
+	shardSeparator       = "#"
+
+	scanBatchSize = 500
+
+	// decrementOpTTL is how long a decrement's token is kept for retries
+	// of it to find
+	decrementOpTTL = time.Minute
 )
 
+// Script results, mapped to domain.StockDecrement
 const (
-	stockKeyPrefix      = "stock:"
-	idempotencyKeyTTL   = 24 * time.Hour
+	decrementOK           = 1
+	decrementInsufficient = 0
+	decrementNoSuchItem   = -1
+	decrementFrozen       = -2
+	decrementSaleClosed   = -3
 )
 
+// decrementStockScript publishes the stock left including units leased to
+// servers, which are still for sale. The optional ARGV[3] is a floor the
+// stock must not drop below. The optional KEYS[5] is set, for ARGV[4]
+// milliseconds, once the stock is taken, so a retry of a decrement whose
+// reply was lost reports it made rather than taking the stock again.
 var decrementStockScript = redis.NewScript(`
 local key = KEYS[1]
 local quantity = tonumber(ARGV[1])
+local floor = tonumber(ARGV[3] or '0')
+
+if KEYS[5] and redis.call('EXISTS', KEYS[5]) == 1 then
+	return 1
+end
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return -3
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return -2
+end
 
 local current = redis.call('GET', key)
 if not current then
-	return 0
+	return -1
 end
 
 current = tonumber(current)
-if current >= quantity then
+if current - quantity >= floor then
 	redis.call('DECRBY', key, quantity)
+	if KEYS[5] then
+		redis.call('SET', KEYS[5], 1, 'PX', ARGV[4])
+	end
+	local leased = 0
+	for _, held in ipairs(redis.call('HVALS', KEYS[4])) do
+		leased = leased + tonumber(held)
+	end
+	redis.call('PUBLISH', ARGV[2], current - quantity + leased)
 	return 1
 end
 
 return 0
 `)
 
+// decrementStocksScript checks every line of a cart, four keys each as for
+// decrementStockScript, before taking any stock, so a cart is taken whole or
+// not at all. ARGV holds each line's quantity and stock channel. It returns
+// a decrementStockScript result code and the 1-based line that stopped it.
+// The key and milliseconds after the lines' mark the cart taken, as KEYS[5]
+// and ARGV[4] of decrementStockScript.
+var decrementStocksScript = redis.NewScript(`
+local lines = math.floor(#ARGV / 2)
+local op = KEYS[lines * 4 + 1]
+if redis.call('EXISTS', op) == 1 then
+	return {1, 0}
+end
+for i = 1, lines do
+	local k = (i - 1) * 4
+	if redis.call('EXISTS', KEYS[k + 3]) == 1 then
+		return {-3, i}
+	end
+	if redis.call('EXISTS', KEYS[k + 2]) == 1 then
+		return {-2, i}
+	end
+	local current = redis.call('GET', KEYS[k + 1])
+	if not current then
+		return {-1, i}
+	end
+	if tonumber(current) < tonumber(ARGV[i * 2 - 1]) then
+		return {0, i}
+	end
+end
+
+for i = 1, lines do
+	local k = (i - 1) * 4
+	local left = redis.call('DECRBY', KEYS[k + 1], ARGV[i * 2 - 1])
+	local leased = 0
+	for _, held in ipairs(redis.call('HVALS', KEYS[k + 4])) do
+		leased = leased + tonumber(held)
+	end
+	redis.call('PUBLISH', ARGV[i * 2], left + leased)
+end
+redis.call('SET', op, 1, 'PX', ARGV[lines * 2 + 1])
+return {1, 0}
+`)
+
+var incrementStockScript = redis.NewScript(`
+local stock = redis.call('INCRBY', KEYS[1], ARGV[1])
+local leased = 0
+for _, held in ipairs(redis.call('HVALS', KEYS[2])) do
+	leased = leased + tonumber(held)
+end
+redis.call('PUBLISH', ARGV[2], stock + leased)
+return stock
+`)
+
+// reserveQuotaScript adds to a user's count in the item's quota hash unless
+// it would pass the limit.
+var reserveQuotaScript = redis.NewScript(`
+local bought = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if bought + tonumber(ARGV[2]) > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// redeemCouponScript counts a coupon use unless the coupon is used up. A
+// limit of 0 means unlimited.
+var redeemCouponScript = redis.NewScript(`
+local uses = tonumber(redis.call('GET', KEYS[1]) or '0')
+local limit = tonumber(ARGV[1])
+if limit > 0 and uses >= limit then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+return 1
+`)
+
+// countAttemptScript counts an attempt, starting the key's window of ARGV[1]
+// ms with its first attempt.
+var countAttemptScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// firstSeenScript records ARGV[2] as the user's first-seen time in
+// milliseconds unless one is recorded, and returns the recorded time.
+var firstSeenScript = redis.NewScript(`
+redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2])
+return tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+`)
+
+// addLotteryEntryScript stores an entry in the item's hash of entries by
+// user unless the user has one, and adds the user to the set draws pop from.
+var addLotteryEntryScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+// drawLotteryEntriesScript pops up to ARGV[1] random users and removes and
+// returns their entries.
+var drawLotteryEntriesScript = redis.NewScript(`
+local users = redis.call('SPOP', KEYS[2], ARGV[1])
+if #users == 0 then
+	return {}
+end
+local entries = redis.call('HMGET', KEYS[1], unpack(users))
+redis.call('HDEL', KEYS[1], unpack(users))
+return entries
+`)
+
+// claimIdempotencyScript sets KEYS[1] to the claim ARGV[1], for ARGV[2]
+// milliseconds if that is positive, unless it is already set. A retry of
+// the same claim finds its own value and succeeds again, so a claim whose
+// reply was lost is not taken for a duplicate.
+var claimIdempotencyScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current == ARGV[1] then
+	return 1
+end
+if current then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// releaseLockScript deletes a lock only if it still holds the caller's token,
+// so a holder whose lock expired cannot release the next holder's.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisAdapter works against a single server, a Sentinel-managed master or
+// Redis Cluster. An item's keys carry its ID as a hash tag, e.g.
+// "stock:{iphone-15}", so in a cluster they share a slot and the stock
+// scripts may use them together.
 type RedisAdapter struct {
-	client *redis.Client
+	client redis.UniversalClient
+	prefix string
+	shards int
+
+	itemTenant func(ctx context.Context, itemID string) string
+
+	retryAttempts int
+	retryBackoff  time.Duration
+}
+
+type RedisOption func(*RedisAdapter)
+
+// WithCampaignKeys scopes every key under the campaign's prefix so the
+// campaign can later be archived and deleted as a unit.
+func WithCampaignKeys(campaignID string) RedisOption {
+	return func(r *RedisAdapter) {
+		r.prefix = campaignKeyPrefix + campaignID + ":"
+	}
+}
+
+// WithItemTenants names the tenant owning an item, for work on the item's
+// keys done without a tenant in its context, such as stock lease renewals
+// and scheduled jobs. Without it such work uses the default tenant's keys.
+func WithItemTenants(tenantOf func(ctx context.Context, itemID string) string) RedisOption {
+	return func(r *RedisAdapter) {
+		r.itemTenant = tenantOf
+	}
+}
+
+// WithStockShards splits each item's stock over n counters so no single key
+// takes every purchase. Each shard is its own hash tag, e.g.
+// "stock:{iphone-15#2}", which spreads the shards over a cluster's slots; the
+// pause and close flags are copied into every shard so the stock script stays
+// atomic. A purchase is served by one shard, so while stock is low a
+// multi-unit purchase can fail even though the shards hold enough together.
+func WithStockShards(n int) RedisOption {
+	return func(r *RedisAdapter) {
+		r.shards = n
+	}
+}
+
+func NewRedisAdapter(client redis.UniversalClient, opts ...RedisOption) *RedisAdapter {
+	r := &RedisAdapter{client: client, retryAttempts: defaultRedisRetryAttempts, retryBackoff: defaultRedisRetryBackoff}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Keys are put under the prefix of the tenant they belong to, e.g.
+// "tenant:acme:campaign:summer:stock:{iphone-15}", so merchants sharing a
+// Redis never touch each other's stock. The default tenant "" keeps the
+// unprefixed keys. A request's keys belong to the tenant of its context,
+// see port.WithTenant; an item's to the tenant owning it. Locks, the order
+// spool, the lottery item list and the broadcast channels are the
+// deployment's, as are coupon uses, the blacklist and first-seen times,
+// like the tables they mirror.
+func tenantPrefix(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return tenantKeyPrefix + tenant + ":"
+}
+
+// keys is the prefix of the keys of ctx's tenant.
+func (r *RedisAdapter) keys(ctx context.Context) string {
+	tenant, _ := port.TenantOf(ctx)
+	return tenantPrefix(tenant) + r.prefix
+}
+
+// itemPrefix is the prefix of an item's keys: those of ctx's tenant, or of
+// the item's owner for work without one.
+func (r *RedisAdapter) itemPrefix(ctx context.Context, itemID string) string {
+	tenant, ok := port.TenantOf(ctx)
+	if !ok && r.itemTenant != nil {
+		tenant = r.itemTenant(ctx, itemID)
+	}
+	return tenantPrefix(tenant) + r.prefix
+}
+
+// campaignPrefix is the prefix of a campaign's keys within ctx's tenant.
+func (r *RedisAdapter) campaignPrefix(ctx context.Context, campaignID string) string {
+	tenant, _ := port.TenantOf(ctx)
+	return tenantPrefix(tenant) + campaignKeyPrefix + campaignID + ":"
+}
+
+// itemKey names one of an item's keys, with the item ID as the hash tag.
+func (r *RedisAdapter) itemKey(ctx context.Context, kind, itemID string) string {
+	return r.itemPrefix(ctx, itemID) + kind + "{" + itemID + "}"
 }
 
-func NewRedisAdapter(client *redis.Client) *RedisAdapter {
-	return &RedisAdapter{client: client}
+// itemFromKey returns the item ID from a key name of the given kind, with
+// the campaign prefix already removed. Shard numbers are dropped.
+func itemFromKey(name, kind string) string {
+	item := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(name, kind), "{"), "}")
+	if i := strings.LastIndex(item, shardSeparator); i >= 0 {
+		if _, err := strconv.Atoi(item[i+len(shardSeparator):]); err == nil {
+			return item[:i]
+		}
+	}
+	return item
+}
+
+func (r *RedisAdapter) sharded() bool {
+	return r.shards > 1
+}
+
+// shardCount is how many stock counters each item has.
+func (r *RedisAdapter) shardCount() int {
+	return max(r.shards, 1)
+}
+
+// shardKey names one of an item's keys in a shard. Without sharding the item
+// has a single shard named by itemKey.
+func (r *RedisAdapter) shardKey(ctx context.Context, kind, itemID string, shard int) string {
+	if !r.sharded() {
+		return r.itemKey(ctx, kind, itemID)
+	}
+	return r.itemPrefix(ctx, itemID) + kind + "{" + itemID + shardSeparator + strconv.Itoa(shard) + "}"
+}
+
+// DecrementStock takes quantity units from one of the item's shards. It
+// starts at a random shard so purchases spread evenly, and tries the others
+// before reporting the item sold out.
+func (r *RedisAdapter) DecrementStock(ctx context.Context, itemID string, quantity int) (_ domain.StockDecrement, err error) {
+	ctx, span := startSpan(ctx, "redis", "DecrementStock")
+	defer endSpan(span, &err)
+
+	return r.decrementStock(ctx, itemID, quantity, 0)
+}
+
+// DecrementStockAbove takes quantity units like DecrementStock, but only
+// while at least floor units remain afterwards. With stock shards each shard
+// keeps its share of the floor.
+func (r *RedisAdapter) DecrementStockAbove(ctx context.Context, itemID string, quantity, floor int) (_ domain.StockDecrement, err error) {
+	ctx, span := startSpan(ctx, "redis", "DecrementStockAbove")
+	defer endSpan(span, &err)
+
+	shards := r.shardCount()
+	return r.decrementStock(ctx, itemID, quantity, (floor+shards-1)/shards)
+}
+
+// decrementStock takes quantity units from the first shard, starting at a
+// random one, that keeps floor units afterwards.
+func (r *RedisAdapter) decrementStock(ctx context.Context, itemID string, quantity, floor int) (domain.StockDecrement, error) {
+	shards := r.shardCount()
+	start := rand.IntN(shards)
+	missing := 0
+	token := uuid.NewString()
+	for i := range shards {
+		shard := (start + i) % shards
+		keys := []string{
+			r.shardKey(ctx, stockKeyPrefix, itemID, shard),
+			r.shardKey(ctx, frozenKeyPrefix, itemID, shard),
+			r.shardKey(ctx, closedKeyPrefix, itemID, shard),
+			r.shardKey(ctx, leasesKeyPrefix, itemID, shard),
+			r.shardKey(ctx, decrementOpPrefix, itemID, shard) + ":" + token,
+		}
+
+		var result int
+		err := r.retry(ctx, true, func() (err error) {
+			result, err = decrementStockScript.Run(ctx, r.client, keys, quantity, r.stockChannel(ctx, itemID), floor, decrementOpTTL.Milliseconds()).Int()
+			return err
+		})
+		if err != nil {
+			return domain.StockInsufficient, err
+		}
+
+		switch result {
+		case decrementOK:
+			return domain.StockDecremented, nil
+		case decrementFrozen:
+			return domain.StockFrozen, nil
+		case decrementSaleClosed:
+			return domain.StockSaleClosed, nil
+		case decrementNoSuchItem:
+			missing++
+		}
+	}
+	if missing == shards {
+		return domain.StockNoSuchItem, nil
+	}
+	return domain.StockInsufficient, nil
 }
 
-func (r *RedisAdapter) DecrementStock(ctx context.Context, itemID string, quantity int) (bool, error) {
-	key := stockKeyPrefix + itemID
+// DecrementStocks takes the stock of every line in one script. An item's
+// keys share a slot only with each other, so in a Redis Cluster, or with
+// stock shards, the lines are taken one at a time instead.
+func (r *RedisAdapter) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (_ domain.StockDecrement, _ string, err error) {
+	if _, cluster := r.client.(*redis.ClusterClient); cluster || r.sharded() {
+		return decrementEach(ctx, r, lines)
+	}
+
+	ctx, span := startSpan(ctx, "redis", "DecrementStocks")
+	defer endSpan(span, &err)
 
-	result, err := decrementStockScript.Run(ctx, r.client, []string{key}, quantity).Int()
+	keys := make([]string, 0, len(lines)*4)
+	args := make([]any, 0, len(lines)*2)
+	for _, line := range lines {
+		keys = append(keys,
+			r.itemKey(ctx, stockKeyPrefix, line.ItemID),
+			r.itemKey(ctx, frozenKeyPrefix, line.ItemID),
+			r.itemKey(ctx, closedKeyPrefix, line.ItemID),
+			r.itemKey(ctx, leasesKeyPrefix, line.ItemID),
+		)
+		args = append(args, line.Quantity, r.stockChannel(ctx, line.ItemID))
+	}
+	keys = append(keys, r.keys(ctx)+decrementOpPrefix+uuid.NewString())
+	args = append(args, decrementOpTTL.Milliseconds())
+
+	var reply []int64
+	err = r.retry(ctx, true, func() (err error) {
+		reply, err = decrementStocksScript.Run(ctx, r.client, keys, args...).Int64Slice()
+		return err
+	})
+	if err != nil {
+		return domain.StockInsufficient, "", err
+	}
+
+	var result domain.StockDecrement
+	switch reply[0] {
+	case decrementOK:
+		return domain.StockDecremented, "", nil
+	case decrementFrozen:
+		result = domain.StockFrozen
+	case decrementSaleClosed:
+		result = domain.StockSaleClosed
+	case decrementNoSuchItem:
+		result = domain.StockNoSuchItem
+	default:
+		result = domain.StockInsufficient
+	}
+	return result, lines[reply[1]-1].ItemID, nil
+}
+
+// stockCounter is a cache whose stock can be taken and given back one item
+// at a time.
+type stockCounter interface {
+	DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error)
+	IncrementStock(ctx context.Context, itemID string, quantity int) error
+}
+
+// decrementEach takes each line's stock in turn, giving back the lines
+// already taken if one fails. Purchases running alongside may see a cart
+// half taken and be turned away by it, so it is only for keys that cannot be
+// updated together.
+func decrementEach(ctx context.Context, stock stockCounter, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	for i, line := range lines {
+		result, err := stock.DecrementStock(ctx, line.ItemID, line.Quantity)
+		if err == nil && result == domain.StockDecremented {
+			continue
+		}
+
+		for _, taken := range lines[:i] {
+			if rollbackErr := stock.IncrementStock(context.WithoutCancel(ctx), taken.ItemID, taken.Quantity); rollbackErr != nil {
+				return domain.StockInsufficient, line.ItemID, fmt.Errorf("give back %d x %s: %w", taken.Quantity, taken.ItemID, rollbackErr)
+			}
+		}
+		return result, line.ItemID, err
+	}
+	return domain.StockDecremented, "", nil
+}
+
+// GetStock returns the item's stock summed over its shards, including units
+// leased to servers and not yet reported sold.
+func (r *RedisAdapter) GetStock(ctx context.Context, itemID string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "redis", "GetStock")
+	defer endSpan(span, &err)
+
+	if !r.sharded() {
+		var get *redis.StringCmd
+		var leases *redis.StringSliceCmd
+		if err := r.retry(ctx, true, func() error {
+			_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				get = pipe.Get(ctx, r.itemKey(ctx, stockKeyPrefix, itemID))
+				leases = pipe.HVals(ctx, r.itemKey(ctx, leasesKeyPrefix, itemID))
+				return nil
+			})
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			return err
+		}); err != nil {
+			return 0, err
+		}
+		stock, err := get.Int()
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, held := range leases.Val() {
+			n, err := strconv.Atoi(held)
+			if err != nil {
+				return 0, fmt.Errorf("parse lease: %w", err)
+			}
+			stock += n
+		}
+		return stock, nil
+	}
+
+	gets := make([]*redis.StringCmd, r.shards)
+	if err := r.retry(ctx, true, func() error {
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for shard := range r.shards {
+				gets[shard] = pipe.Get(ctx, r.shardKey(ctx, stockKeyPrefix, itemID, shard))
+			}
+			return nil
+		})
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, get := range gets {
+		stock, err := get.Int()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += stock
+	}
+	return total, nil
+}
+
+// IncrementStock adds quantity units to a random shard of the item. Adding
+// them twice would oversell, so it is only retried when Redis never ran it.
+func (r *RedisAdapter) IncrementStock(ctx context.Context, itemID string, quantity int) (err error) {
+	ctx, span := startSpan(ctx, "redis", "IncrementStock")
+	defer endSpan(span, &err)
+
+	shard := rand.IntN(r.shardCount())
+	keys := []string{r.shardKey(ctx, stockKeyPrefix, itemID, shard), r.shardKey(ctx, leasesKeyPrefix, itemID, shard)}
+	return r.retry(ctx, false, func() error {
+		return incrementStockScript.Run(ctx, r.client, keys, quantity, r.stockChannel(ctx, itemID)).Err()
+	})
+}
+
+// SetIdempotency claims the key with a value of its own, e.g.
+// "pending:<uuid>", so retrying a claim whose reply was lost finds it made.
+func (r *RedisAdapter) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "SetIdempotency")
+	defer endSpan(span, &err)
+
+	claim := idempotencyPending + ":" + uuid.NewString()
+	var claimed int
+	err = r.retry(ctx, true, func() (err error) {
+		claimed, err = claimIdempotencyScript.Run(ctx, r.client, []string{r.keys(ctx) + key}, claim, ttl.Milliseconds()).Int()
+		return err
+	})
 	if err != nil {
 		return false, err
 	}
+	return claimed == 1, nil
+}
+
+type idempotencyRecord struct {
+	OrderID string                `json:"order_id,omitempty"`
+	Status  domain.PurchaseStatus `json:"status"`
+}
 
-	return result == 1, nil
+func (r *RedisAdapter) ReleaseIdempotency(ctx context.Context, key string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "ReleaseIdempotency")
+	defer endSpan(span, &err)
+
+	return r.retry(ctx, true, func() error {
+		return r.client.Del(ctx, r.keys(ctx)+key).Err()
+	})
 }
 
-func (r *RedisAdapter) IncrementStock(ctx context.Context, itemID string, quantity int) error {
-	key := stockKeyPrefix + itemID
-	return r.client.IncrBy(ctx, key, int64(quantity)).Err()
+func (r *RedisAdapter) SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) (err error) {
+	ctx, span := startSpan(ctx, "redis", "SetIdempotencyResult")
+	defer endSpan(span, &err)
+
+	data, err := json.Marshal(idempotencyRecord{OrderID: result.OrderID, Status: result.Status})
+	if err != nil {
+		return err
+	}
+
+	// XX keeps an expired key from being resurrected without a TTL
+	return r.retry(ctx, true, func() error {
+		return r.client.SetArgs(ctx, r.keys(ctx)+key, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	})
 }
 
-func (r *RedisAdapter) SetIdempotency(ctx context.Context, key string) (bool, error) {
-	ok, err := r.client.SetNX(ctx, key, 1, idempotencyKeyTTL).Result()
+func (r *RedisAdapter) GetIdempotencyResult(ctx context.Context, key string) (_ *domain.PurchaseResult, err error) {
+	ctx, span := startSpan(ctx, "redis", "GetIdempotencyResult")
+	defer endSpan(span, &err)
+
+	var value string
+	err = r.retry(ctx, true, func() (err error) {
+		value, err = r.client.Get(ctx, r.keys(ctx)+key).Result()
+		return err
+	})
+	// A claim without a result is "pending", with or without its own value
+	if errors.Is(err, redis.Nil) || strings.HasPrefix(value, idempotencyPending) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, err
+	}
+
+	return &domain.PurchaseResult{OrderID: record.OrderID, Status: record.Status}, nil
+}
+
+// SavePurchaseRecord keeps each record as JSON under its request ID, e.g.
+// "purchase-record:req-1", in the campaign keyspace beside the idempotency
+// keys.
+func (r *RedisAdapter) SavePurchaseRecord(ctx context.Context, record domain.PurchaseRecord, ttl time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "redis", "SavePurchaseRecord")
+	defer endSpan(span, &err)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.retry(ctx, true, func() error {
+		return r.client.Set(ctx, r.keys(ctx)+purchaseRecordPrefix+record.RequestID, data, ttl).Err()
+	})
+}
+
+func (r *RedisAdapter) GetPurchaseRecord(ctx context.Context, requestID string) (_ *domain.PurchaseRecord, err error) {
+	ctx, span := startSpan(ctx, "redis", "GetPurchaseRecord")
+	defer endSpan(span, &err)
+
+	var data []byte
+	err = r.retry(ctx, true, func() (err error) {
+		data, err = r.client.Get(ctx, r.keys(ctx)+purchaseRecordPrefix+requestID).Bytes()
+		return err
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record domain.PurchaseRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ReserveQuota keeps the item's per-user counts in one hash, e.g.
+// "quota:{iphone-15}", which goes with the campaign's other keys.
+func (r *RedisAdapter) ReserveQuota(ctx context.Context, itemID, userID string, quantity, limit int) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "ReserveQuota")
+	defer endSpan(span, &err)
+
+	reserved, err := reserveQuotaScript.Run(ctx, r.client, []string{r.itemKey(ctx, quotaKeyPrefix, itemID)}, userID, quantity, limit).Int()
 	if err != nil {
 		return false, err
 	}
+	return reserved == 1, nil
+}
 
-	return ok, nil
+func (r *RedisAdapter) ReleaseQuota(ctx context.Context, itemID, userID string, quantity int) (err error) {
+	ctx, span := startSpan(ctx, "redis", "ReleaseQuota")
+	defer endSpan(span, &err)
+
+	return r.client.HIncrBy(ctx, r.itemKey(ctx, quotaKeyPrefix, itemID), userID, -int64(quantity)).Err()
+}
+
+// couponKey is outside the campaign keyspace: coupons are not tied to a
+// campaign, so their uses count across campaigns and survive teardown.
+func couponKey(code string) string {
+	return couponKeyPrefix + "{" + code + "}"
+}
+
+func (r *RedisAdapter) RedeemCoupon(ctx context.Context, code string, maxUses int) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "RedeemCoupon")
+	defer endSpan(span, &err)
+
+	redeemed, err := redeemCouponScript.Run(ctx, r.client, []string{couponKey(code)}, maxUses).Int()
+	if err != nil {
+		return false, err
+	}
+	return redeemed == 1, nil
+}
+
+func (r *RedisAdapter) ReleaseCoupon(ctx context.Context, code string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "ReleaseCoupon")
+	defer endSpan(span, &err)
+
+	return r.client.Decr(ctx, couponKey(code)).Err()
+}
+
+func (r *RedisAdapter) CouponUses(ctx context.Context, code string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "redis", "CouponUses")
+	defer endSpan(span, &err)
+
+	uses, err := r.client.Get(ctx, couponKey(code)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return uses, err
+}
+
+// The blacklist sets are outside the campaign keyspace like coupon uses, so
+// a ban outlives the campaign it was made in.
+
+func (r *RedisAdapter) BanUser(ctx context.Context, userID string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "BanUser")
+	defer endSpan(span, &err)
+
+	return r.client.SAdd(ctx, bannedUsersKey, userID).Err()
 }
 
+func (r *RedisAdapter) UnbanUser(ctx context.Context, userID string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "UnbanUser")
+	defer endSpan(span, &err)
+
+	return r.client.SRem(ctx, bannedUsersKey, userID).Err()
+}
+
+func (r *RedisAdapter) IsUserBanned(ctx context.Context, userID string) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "IsUserBanned")
+	defer endSpan(span, &err)
+
+	return r.client.SIsMember(ctx, bannedUsersKey, userID).Result()
+}
+
+func (r *RedisAdapter) BannedUsers(ctx context.Context) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "redis", "BannedUsers")
+	defer endSpan(span, &err)
+
+	users, err := r.client.SMembers(ctx, bannedUsersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(users)
+	return users, nil
+}
+
+func (r *RedisAdapter) BanIPRange(ctx context.Context, prefix netip.Prefix) (err error) {
+	ctx, span := startSpan(ctx, "redis", "BanIPRange")
+	defer endSpan(span, &err)
+
+	return r.client.SAdd(ctx, bannedIPsKey, prefix.Masked().String()).Err()
+}
+
+func (r *RedisAdapter) UnbanIPRange(ctx context.Context, prefix netip.Prefix) (err error) {
+	ctx, span := startSpan(ctx, "redis", "UnbanIPRange")
+	defer endSpan(span, &err)
+
+	return r.client.SRem(ctx, bannedIPsKey, prefix.Masked().String()).Err()
+}
+
+// BannedIPRanges skips members that do not parse as a range.
+func (r *RedisAdapter) BannedIPRanges(ctx context.Context) (_ []netip.Prefix, err error) {
+	ctx, span := startSpan(ctx, "redis", "BannedIPRanges")
+	defer endSpan(span, &err)
+
+	members, err := r.client.SMembers(ctx, bannedIPsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]netip.Prefix, 0, len(members))
+	for _, member := range members {
+		if prefix, err := netip.ParsePrefix(member); err == nil {
+			ranges = append(ranges, prefix)
+		}
+	}
+	return ranges, nil
+}
+
+// CountAttempt keeps each counter in its own key, e.g. "risk:ip:203.0.113.7",
+// inside the campaign keyspace: velocity only matters while a sale runs.
+func (r *RedisAdapter) CountAttempt(ctx context.Context, key string, window time.Duration) (_ int, err error) {
+	ctx, span := startSpan(ctx, "redis", "CountAttempt")
+	defer endSpan(span, &err)
+
+	return countAttemptScript.Run(ctx, r.client, []string{r.keys(ctx) + riskCountPrefix + key}, window.Milliseconds()).Int()
+}
+
+// FirstSeen keeps first-seen times in one hash outside the campaign
+// keyspace, so an account is only new at its first campaign.
+func (r *RedisAdapter) FirstSeen(ctx context.Context, userID string, at time.Time) (_ time.Time, err error) {
+	ctx, span := startSpan(ctx, "redis", "FirstSeen")
+	defer endSpan(span, &err)
+
+	ms, err := firstSeenScript.Run(ctx, r.client, []string{firstSeenKey}, userID, at.UnixMilli()).Int64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// AddEntry keeps the item's entries in a hash by user, e.g.
+// "lottery:{iphone-15}", beside the set of users still to be drawn. Items
+// with entries are listed in a set of their own, which in a cluster lives
+// in another slot.
+func (r *RedisAdapter) AddEntry(ctx context.Context, entry domain.LotteryEntry) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "AddEntry")
+	defer endSpan(span, &err)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{r.itemKey(ctx, lotteryKeyPrefix, entry.ItemID), r.itemKey(ctx, entrantsKeyPrefix, entry.ItemID)}
+	added, err := addLotteryEntryScript.Run(ctx, r.client, keys, entry.UserID, data).Int()
+	if err != nil || added == 0 {
+		return false, err
+	}
+	return true, r.client.SAdd(ctx, r.prefix+lotteryItemsKey, entry.ItemID).Err()
+}
+
+func (r *RedisAdapter) DrawEntries(ctx context.Context, itemID string, n int) (_ []domain.LotteryEntry, err error) {
+	ctx, span := startSpan(ctx, "redis", "DrawEntries")
+	defer endSpan(span, &err)
+
+	keys := []string{r.itemKey(ctx, lotteryKeyPrefix, itemID), r.itemKey(ctx, entrantsKeyPrefix, itemID)}
+	values, err := drawLotteryEntriesScript.Run(ctx, r.client, keys, n).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) < n {
+		// Every entry has been drawn
+		if err := r.client.SRem(ctx, r.prefix+lotteryItemsKey, itemID).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Entries that cannot be decoded are reported in the error alongside
+	// the entries that can, which have already been removed
+	entries := make([]domain.LotteryEntry, 0, len(values))
+	var corrupt int
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // the hash and set disagreed
+		}
+		var entry domain.LotteryEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			corrupt++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if corrupt > 0 {
+		return entries, fmt.Errorf("%d lottery entries could not be decoded", corrupt)
+	}
+	return entries, nil
+}
+
+func (r *RedisAdapter) LotteryItems(ctx context.Context) (_ []string, err error) {
+	ctx, span := startSpan(ctx, "redis", "LotteryItems")
+	defer endSpan(span, &err)
+
+	items, err := r.client.SMembers(ctx, r.prefix+lotteryItemsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(items)
+	return items, nil
+}
+
+// SetStock sets the item's stock, dividing it evenly over its shards.
 func (r *RedisAdapter) SetStock(ctx context.Context, itemID string, quantity int) error {
-	key := stockKeyPrefix + itemID
-	return r.client.Set(ctx, key, quantity, 0).Err()
+	if r.sharded() {
+		// Shards live in different slots, so they cannot share a MULTI
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for shard := range r.shards {
+				share := quantity / r.shards
+				if shard < quantity%r.shards {
+					share++
+				}
+				pipe.Set(ctx, r.shardKey(ctx, stockKeyPrefix, itemID, shard), share, 0)
+			}
+			pipe.Publish(ctx, r.stockChannel(ctx, itemID), quantity)
+			return nil
+		})
+		return err
+	}
+
+	key := r.itemKey(ctx, stockKeyPrefix, itemID)
+	// The channel is tagged like the key, so a cluster runs both in one MULTI
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, quantity, 0)
+		pipe.Publish(ctx, r.stockChannel(ctx, itemID), quantity)
+		return nil
+	})
+	return err
+}
+
+// WatchStock subscribes to the item's stock channel, which the stock scripts
+// publish to after every change. Sharded scripts publish their shard's level,
+// so the total is re-read instead.
+func (r *RedisAdapter) WatchStock(ctx context.Context, itemID string) (<-chan int, error) {
+	sub := r.client.Subscribe(ctx, r.stockChannel(ctx, itemID))
+	// Wait for the subscription so no change after this call is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	levels := make(chan int, 1)
+	go func() {
+		defer close(levels)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				level, err := strconv.Atoi(msg.Payload)
+				if r.sharded() {
+					level, err = r.GetStock(ctx, itemID)
+				}
+				if err != nil {
+					continue
+				}
+				select {
+				case <-levels:
+				default:
+				}
+				levels <- level
+			}
+		}
+	}()
+
+	return levels, nil
+}
+
+func (r *RedisAdapter) PublishOrderResult(ctx context.Context, result domain.OrderResult) (err error) {
+	ctx, span := startSpan(ctx, "redis", "PublishOrderResult")
+	defer endSpan(span, &err)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.keys(ctx)+resultChannelPrefix+result.RequestID, data).Err()
+}
+
+// WatchOrderResult subscribes to the request's result channel. Results are
+// only delivered to subscribers present when they are published.
+func (r *RedisAdapter) WatchOrderResult(ctx context.Context, requestID string) (<-chan domain.OrderResult, error) {
+	sub := r.client.Subscribe(ctx, r.keys(ctx)+resultChannelPrefix+requestID)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	results := make(chan domain.OrderResult, 1)
+	go func() {
+		defer close(results)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var result domain.OrderResult
+				if err := json.Unmarshal([]byte(msg.Payload), &result); err != nil {
+					continue
+				}
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+func (r *RedisAdapter) TryLock(ctx context.Context, name string, ttl time.Duration) (_ func(context.Context) error, _ bool, err error) {
+	ctx, span := startSpan(ctx, "redis", "TryLock")
+	defer endSpan(span, &err)
+
+	key := r.prefix + lockKeyPrefix + name
+	token := uuid.New().String()
+
+	ok, err := r.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	release := func(ctx context.Context) error {
+		return releaseLockScript.Run(ctx, r.client, []string{key}, token).Err()
+	}
+	return release, true, nil
+}
+
+// SpoolOrders appends orders to a list as JSON.
+func (r *RedisAdapter) SpoolOrders(ctx context.Context, orders []domain.Order) (err error) {
+	ctx, span := startSpan(ctx, "redis", "SpoolOrders")
+	defer endSpan(span, &err)
+
+	if len(orders) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(orders))
+	for i, order := range orders {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return err
+		}
+		values[i] = data
+	}
+	return r.client.RPush(ctx, r.prefix+orderSpoolKey, values...).Err()
+}
+
+// RecoverOrders reads and deletes the spool in one transaction. Entries that
+// cannot be decoded are reported in the error alongside the orders that can.
+func (r *RedisAdapter) RecoverOrders(ctx context.Context) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "redis", "RecoverOrders")
+	defer endSpan(span, &err)
+
+	key := r.prefix + orderSpoolKey
+	var entries *redis.StringSliceCmd
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return decodeSpooled(entries.Val())
+}
+
+// SpooledOrders returns the spooled orders, leaving them for RecoverOrders.
+func (r *RedisAdapter) SpooledOrders(ctx context.Context) (_ []domain.Order, err error) {
+	ctx, span := startSpan(ctx, "redis", "SpooledOrders")
+	defer endSpan(span, &err)
+
+	entries, err := r.client.LRange(ctx, r.prefix+orderSpoolKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeSpooled(entries)
+}
+
+// decodeSpooled decodes spooled orders, returning those it could decode
+// along with an error if any could not be.
+func decodeSpooled(entries []string) ([]domain.Order, error) {
+	orders := make([]domain.Order, 0, len(entries))
+	var corrupt int
+	for _, entry := range entries {
+		var order domain.Order
+		if err := json.Unmarshal([]byte(entry), &order); err != nil {
+			corrupt++
+			continue
+		}
+		orders = append(orders, order)
+	}
+	if corrupt > 0 {
+		return orders, fmt.Errorf("%d spooled orders could not be decoded", corrupt)
+	}
+	return orders, nil
+}
+
+func (r *RedisAdapter) stockChannel(ctx context.Context, itemID string) string {
+	return r.itemKey(ctx, stockChannelPrefix, itemID)
+}
+
+// SetFrozen pauses or resumes sales of an item without touching its stock.
+func (r *RedisAdapter) SetFrozen(ctx context.Context, itemID string, frozen bool) error {
+	return r.setItemFlag(ctx, frozenKeyPrefix, itemID, frozen)
+}
+
+// SetSaleClosed ends or reopens the sale of an item.
+func (r *RedisAdapter) SetSaleClosed(ctx context.Context, itemID string, closed bool) error {
+	return r.setItemFlag(ctx, closedKeyPrefix, itemID, closed)
+}
+
+// setItemFlag sets or clears the flag in every shard of the item.
+func (r *RedisAdapter) setItemFlag(ctx context.Context, kind, itemID string, set bool) error {
+	if !r.sharded() {
+		return setFlag(ctx, r.client, r.itemKey(ctx, kind, itemID), set)
+	}
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for shard := range r.shards {
+			setFlag(ctx, pipe, r.shardKey(ctx, kind, itemID, shard), set)
+		}
+		return nil
+	})
+	return err
+}
+
+func setFlag(ctx context.Context, client redis.Cmdable, key string, set bool) error {
+	if set {
+		return client.Set(ctx, key, 1, 0).Err()
+	}
+	return client.Del(ctx, key).Err()
+}
+
+// SnapshotCampaign reads the final values of every key under the campaign's
+// prefix without modifying them.
+func (r *RedisAdapter) SnapshotCampaign(ctx context.Context, campaignID string) (_ *domain.CampaignArchive, err error) {
+	ctx, span := startSpan(ctx, "redis", "SnapshotCampaign")
+	defer endSpan(span, &err)
+
+	prefix := r.campaignPrefix(ctx, campaignID)
+	archive := &domain.CampaignArchive{
+		CampaignID: campaignID,
+		Stock:      make(map[string]int),
+		ArchivedAt: time.Now(),
+	}
+
+	err = r.scanCampaign(ctx, campaignID, func(keys []string) error {
+		var stockKeys []string
+		for _, key := range keys {
+			name := strings.TrimPrefix(key, prefix)
+			switch {
+			case strings.HasPrefix(name, stockKeyPrefix):
+				stockKeys = append(stockKeys, key)
+			case strings.HasPrefix(name, frozenKeyPrefix):
+				archive.FrozenItems = appendItem(archive.FrozenItems, itemFromKey(name, frozenKeyPrefix))
+			case strings.HasPrefix(name, closedKeyPrefix):
+				archive.ClosedItems = appendItem(archive.ClosedItems, itemFromKey(name, closedKeyPrefix))
+			case strings.HasPrefix(name, idempotencyPrefix):
+				archive.IdempotencyKeys++
+			}
+		}
+		if len(stockKeys) == 0 {
+			return nil
+		}
+
+		// One GET per key rather than MGET, which a cluster rejects for keys
+		// in different slots
+		gets := make([]*redis.StringCmd, len(stockKeys))
+		if _, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range stockKeys {
+				gets[i] = pipe.Get(ctx, key)
+			}
+			return nil
+		}); err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		for i, get := range gets {
+			stock, err := get.Int()
+			if errors.Is(err, redis.Nil) {
+				continue // expired between SCAN and GET
+			}
+			if err != nil {
+				return fmt.Errorf("read %s: %w", stockKeys[i], err)
+			}
+			item := itemFromKey(strings.TrimPrefix(stockKeys[i], prefix), stockKeyPrefix)
+			archive.Stock[item] += stock
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// appendItem adds an item once, however many shards it was flagged in.
+func appendItem(items []string, item string) []string {
+	if slices.Contains(items, item) {
+		return items
+	}
+	return append(items, item)
+}
+
+// DeleteCampaign removes every key under the campaign's prefix and returns
+// how many were deleted.
+func (r *RedisAdapter) DeleteCampaign(ctx context.Context, campaignID string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "redis", "DeleteCampaign")
+	defer endSpan(span, &err)
+
+	deleted := 0
+	err = r.scanCampaign(ctx, campaignID, func(keys []string) error {
+		unlinks := make([]*redis.IntCmd, len(keys))
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				unlinks[i] = pipe.Unlink(ctx, key)
+			}
+			return nil
+		})
+		for _, unlink := range unlinks {
+			deleted += int(unlink.Val())
+		}
+		return err
+	})
+	return deleted, err
+}
+
+// SetCampaignStock sets an item's stock under the campaign's prefix, split
+// over the adapter's stock shards, whichever campaign the adapter sells.
+func (r *RedisAdapter) SetCampaignStock(ctx context.Context, campaignID, itemID string, quantity int) error {
+	scoped := *r
+	scoped.prefix = campaignKeyPrefix + campaignID + ":"
+	return scoped.SetStock(ctx, itemID, quantity)
+}
+
+// scanCampaign walks the campaign's keys in batches with SCAN, which unlike
+// KEYS does not block Redis while it iterates. A cluster is scanned on every
+// master; fn is never called concurrently.
+func (r *RedisAdapter) scanCampaign(ctx context.Context, campaignID string, fn func(keys []string) error) error {
+	match := escapeGlob(r.campaignPrefix(ctx, campaignID)) + "*"
+
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNode(ctx, r.client, match, fn)
+	}
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return scanNode(ctx, node, match, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, match string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, scanBatchSize).Result()
+		if err != nil {
+			return fmt.Errorf("scan campaign keys: %w", err)
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob quotes the characters SCAN MATCH treats as patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
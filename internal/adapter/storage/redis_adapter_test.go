@@ -2,12 +2,19 @@ package storage
 
 import (
 	"context"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
 )
 
 func getRedisClient(t *testing.T) *redis.Client {
@@ -31,20 +38,20 @@ func TestDecrementStock_Success(t *testing.T) {
 	adapter := NewRedisAdapter(client)
 
 	// Setup
-	client.Del(ctx, "stock:test-item")
+	client.Del(ctx, "stock:{test-item}")
 	adapter.SetStock(ctx, "test-item", 10)
 
 	// Test
-	ok, err := adapter.DecrementStock(ctx, "test-item", 3)
+	res, err := adapter.DecrementStock(ctx, "test-item", 3)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if !ok {
-		t.Error("expected success")
+	if res != domain.StockDecremented {
+		t.Errorf("expected success, got %v", res)
 	}
 
 	// Verify
-	stock, _ := client.Get(ctx, "stock:test-item").Int()
+	stock, _ := adapter.GetStock(ctx, "test-item")
 	if stock != 7 {
 		t.Errorf("expected stock 7, got %d", stock)
 	}
@@ -58,20 +65,20 @@ func TestDecrementStock_InsufficientStock(t *testing.T) {
 	adapter := NewRedisAdapter(client)
 
 	// Setup
-	client.Del(ctx, "stock:test-item")
+	client.Del(ctx, "stock:{test-item}")
 	adapter.SetStock(ctx, "test-item", 5)
 
 	// Test - try to decrement more than available
-	ok, err := adapter.DecrementStock(ctx, "test-item", 10)
+	res, err := adapter.DecrementStock(ctx, "test-item", 10)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if ok {
-		t.Error("expected failure due to insufficient stock")
+	if res != domain.StockInsufficient {
+		t.Errorf("expected insufficient stock, got %v", res)
 	}
 
 	// Verify stock unchanged
-	stock, _ := client.Get(ctx, "stock:test-item").Int()
+	stock, _ := client.Get(ctx, "stock:{test-item}").Int()
 	if stock != 5 {
 		t.Errorf("expected stock 5, got %d", stock)
 	}
@@ -85,15 +92,111 @@ func TestDecrementStock_KeyNotExists(t *testing.T) {
 	adapter := NewRedisAdapter(client)
 
 	// Setup - ensure key doesn't exist
-	client.Del(ctx, "stock:nonexistent")
+	client.Del(ctx, "stock:{nonexistent}")
 
 	// Test
-	ok, err := adapter.DecrementStock(ctx, "nonexistent", 1)
+	res, err := adapter.DecrementStock(ctx, "nonexistent", 1)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if ok {
-		t.Error("expected failure for nonexistent key")
+	if res != domain.StockNoSuchItem {
+		t.Errorf("expected no such item, got %v", res)
+	}
+}
+
+func TestDecrementStock_FrozenAndClosed(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client)
+
+	// Setup
+	client.Del(ctx, "stock:{flag-item}", "frozen:{flag-item}", "closed:{flag-item}")
+	adapter.SetStock(ctx, "flag-item", 5)
+	defer client.Del(ctx, "frozen:{flag-item}", "closed:{flag-item}")
+
+	adapter.SetFrozen(ctx, "flag-item", true)
+	res, err := adapter.DecrementStock(ctx, "flag-item", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != domain.StockFrozen {
+		t.Errorf("expected frozen, got %v", res)
+	}
+
+	adapter.SetSaleClosed(ctx, "flag-item", true)
+	res, _ = adapter.DecrementStock(ctx, "flag-item", 1)
+	if res != domain.StockSaleClosed {
+		t.Errorf("closed should take precedence over frozen, got %v", res)
+	}
+
+	// Verify stock unchanged
+	stock, _ := client.Get(ctx, "stock:{flag-item}").Int()
+	if stock != 5 {
+		t.Errorf("expected stock 5, got %d", stock)
+	}
+}
+
+func TestDecrementStockAbove(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client)
+
+	client.Del(ctx, "stock:{reserve-item}")
+	adapter.SetStock(ctx, "reserve-item", 5)
+
+	// Only the 2 units above the floor of 3 can be taken
+	if res, err := adapter.DecrementStockAbove(ctx, "reserve-item", 2, 3); err != nil || res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v, %v", res, err)
+	}
+	if res, _ := adapter.DecrementStockAbove(ctx, "reserve-item", 1, 3); res != domain.StockInsufficient {
+		t.Errorf("expected insufficient stock above the floor, got %v", res)
+	}
+	if res, _ := adapter.DecrementStock(ctx, "reserve-item", 3); res != domain.StockDecremented {
+		t.Errorf("expected the floor to be sold without one, got %v", res)
+	}
+}
+
+func TestDecrementStocks(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client)
+
+	// Setup
+	client.Del(ctx, "stock:{cart-a}", "stock:{cart-b}", "closed:{cart-b}")
+	adapter.SetStock(ctx, "cart-a", 5)
+	adapter.SetStock(ctx, "cart-b", 2)
+	defer client.Del(ctx, "closed:{cart-b}")
+
+	res, itemID, err := adapter.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "cart-a", Quantity: 2}, {ItemID: "cart-b", Quantity: 3}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res != domain.StockInsufficient || itemID != "cart-b" {
+		t.Errorf("expected cart-b insufficient, got %v on %q", res, itemID)
+	}
+	if stock, _ := adapter.GetStock(ctx, "cart-a"); stock != 5 {
+		t.Errorf("expected cart-a untouched at 5, got %d", stock)
+	}
+
+	res, _, err = adapter.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "cart-a", Quantity: 2}, {ItemID: "cart-b", Quantity: 2}})
+	if err != nil || res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v err=%v", res, err)
+	}
+	a, _ := adapter.GetStock(ctx, "cart-a")
+	b, _ := adapter.GetStock(ctx, "cart-b")
+	if a != 3 || b != 0 {
+		t.Errorf("expected stocks 3 and 0, got %d and %d", a, b)
+	}
+
+	adapter.SetSaleClosed(ctx, "cart-b", true)
+	if res, itemID, _ := adapter.DecrementStocks(ctx, []domain.OrderItem{{ItemID: "cart-a", Quantity: 1}, {ItemID: "cart-b", Quantity: 1}}); res != domain.StockSaleClosed || itemID != "cart-b" {
+		t.Errorf("expected cart-b closed, got %v on %q", res, itemID)
 	}
 }
 
@@ -108,7 +211,7 @@ func TestDecrementStock_Concurrent(t *testing.T) {
 	totalRequests := 50
 
 	// Setup
-	client.Del(ctx, "stock:concurrent-test")
+	client.Del(ctx, "stock:{concurrent-test}")
 	adapter.SetStock(ctx, "concurrent-test", initialStock)
 
 	var successCount atomic.Int32
@@ -118,12 +221,12 @@ func TestDecrementStock_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			ok, err := adapter.DecrementStock(ctx, "concurrent-test", 1)
+			res, err := adapter.DecrementStock(ctx, "concurrent-test", 1)
 			if err != nil {
 				t.Errorf("unexpected error: %v", err)
 				return
 			}
-			if ok {
+			if res == domain.StockDecremented {
 				successCount.Add(1)
 			}
 		}()
@@ -135,7 +238,7 @@ func TestDecrementStock_Concurrent(t *testing.T) {
 		t.Errorf("expected %d successes, got %d", initialStock, successCount.Load())
 	}
 
-	stock, _ := client.Get(ctx, "stock:concurrent-test").Int()
+	stock, _ := client.Get(ctx, "stock:{concurrent-test}").Int()
 	if stock != 0 {
 		t.Errorf("expected stock 0, got %d", stock)
 	}
@@ -149,7 +252,7 @@ func TestIncrementStock(t *testing.T) {
 	adapter := NewRedisAdapter(client)
 
 	// Setup
-	client.Del(ctx, "stock:test-item")
+	client.Del(ctx, "stock:{test-item}")
 	adapter.SetStock(ctx, "test-item", 5)
 
 	// Test
@@ -159,7 +262,7 @@ func TestIncrementStock(t *testing.T) {
 	}
 
 	// Verify
-	stock, _ := client.Get(ctx, "stock:test-item").Int()
+	stock, _ := client.Get(ctx, "stock:{test-item}").Int()
 	if stock != 8 {
 		t.Errorf("expected stock 8, got %d", stock)
 	}
@@ -176,7 +279,7 @@ func TestSetIdempotency_Success(t *testing.T) {
 	client.Del(ctx, "test-idem-key")
 
 	// First call should succeed
-	ok, err := adapter.SetIdempotency(ctx, "test-idem-key")
+	ok, err := adapter.SetIdempotency(ctx, "test-idem-key", time.Hour)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -185,7 +288,7 @@ func TestSetIdempotency_Success(t *testing.T) {
 	}
 
 	// Second call should fail (key exists)
-	ok, err = adapter.SetIdempotency(ctx, "test-idem-key")
+	ok, err = adapter.SetIdempotency(ctx, "test-idem-key", time.Hour)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -212,7 +315,7 @@ func TestSetIdempotency_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			ok, err := adapter.SetIdempotency(ctx, "concurrent-idem-key")
+			ok, err := adapter.SetIdempotency(ctx, "concurrent-idem-key", time.Hour)
 			if err != nil {
 				t.Errorf("unexpected error: %v", err)
 				return
@@ -230,3 +333,550 @@ func TestSetIdempotency_Concurrent(t *testing.T) {
 		t.Errorf("expected exactly 1 success, got %d", successCount.Load())
 	}
 }
+
+func TestIdempotencyResult(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client)
+
+	// Setup
+	client.Del(ctx, "test-result-key")
+
+	// Missing key has no result
+	result, err := adapter.GetIdempotencyResult(ctx, "test-result-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Error("expected nil result for missing key")
+	}
+
+	// Claimed key has no result until the owner stores one
+	adapter.SetIdempotency(ctx, "test-result-key", time.Hour)
+	result, err = adapter.GetIdempotencyResult(ctx, "test-result-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != nil {
+		t.Error("expected nil result for pending key")
+	}
+
+	err = adapter.SetIdempotencyResult(ctx, "test-result-key", domain.PurchaseResult{
+		OrderID: "order-1",
+		Status:  domain.PurchaseStatusSucceeded,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err = adapter.GetIdempotencyResult(ctx, "test-result-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result == nil || result.OrderID != "order-1" || result.Status != domain.PurchaseStatusSucceeded {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// TTL is preserved
+	if ttl := client.TTL(ctx, "test-result-key").Val(); ttl <= 0 {
+		t.Errorf("expected positive TTL, got %v", ttl)
+	}
+}
+
+func TestPurchaseQuota(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client)
+	client.Del(ctx, "quota:{test-item}")
+
+	if ok, err := adapter.ReserveQuota(ctx, "test-item", "user-1", 2, 3); err != nil || !ok {
+		t.Fatalf("expected reservation, got %v, %v", ok, err)
+	}
+	if ok, _ := adapter.ReserveQuota(ctx, "test-item", "user-1", 2, 3); ok {
+		t.Error("expected reservation past the limit to fail")
+	}
+	if ok, _ := adapter.ReserveQuota(ctx, "test-item", "user-2", 3, 3); !ok {
+		t.Error("expected other users to have their own quota")
+	}
+
+	adapter.ReleaseQuota(ctx, "test-item", "user-1", 2)
+	if ok, _ := adapter.ReserveQuota(ctx, "test-item", "user-1", 3, 3); !ok {
+		t.Error("expected released units to be available again")
+	}
+}
+
+func TestCouponRedemptions(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-coupons"))
+	client.Del(ctx, "coupon-uses:{TEST}")
+	defer client.Del(ctx, "coupon-uses:{TEST}")
+
+	for range 2 {
+		if ok, err := adapter.RedeemCoupon(ctx, "TEST", 2); err != nil || !ok {
+			t.Fatalf("expected redemption, got %v, %v", ok, err)
+		}
+	}
+	if ok, _ := adapter.RedeemCoupon(ctx, "TEST", 2); ok {
+		t.Error("expected redemption past the limit to fail")
+	}
+
+	adapter.ReleaseCoupon(ctx, "TEST")
+	if uses, err := adapter.CouponUses(ctx, "TEST"); err != nil || uses != 1 {
+		t.Errorf("expected 1 use, got %d, %v", uses, err)
+	}
+
+	// Uses are not part of the campaign keyspace
+	if exists, _ := client.Exists(ctx, "campaign:test-coupons:coupon-uses:{TEST}").Result(); exists != 0 {
+		t.Error("expected coupon uses outside the campaign keyspace")
+	}
+}
+
+func TestBlacklist(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-blacklist"))
+	client.Del(ctx, "blacklist:users", "blacklist:ips")
+	defer client.Del(ctx, "blacklist:users", "blacklist:ips")
+
+	adapter.BanUser(ctx, "user-1")
+	adapter.BanIPRange(ctx, netip.MustParsePrefix("10.1.2.3/8"))
+	if banned, err := adapter.IsUserBanned(ctx, "user-1"); err != nil || !banned {
+		t.Errorf("expected user-1 to be banned, got %v, %v", banned, err)
+	}
+	if ranges, err := adapter.BannedIPRanges(ctx); err != nil || len(ranges) != 1 || ranges[0].String() != "10.0.0.0/8" {
+		t.Errorf("expected the masked range, got %v, %v", ranges, err)
+	}
+
+	// Bans are not part of the campaign keyspace
+	if exists, _ := client.Exists(ctx, "campaign:test-blacklist:blacklist:users").Result(); exists != 0 {
+		t.Error("expected bans outside the campaign keyspace")
+	}
+
+	adapter.UnbanUser(ctx, "user-1")
+	adapter.UnbanIPRange(ctx, netip.MustParsePrefix("10.0.0.0/8"))
+	if users, _ := adapter.BannedUsers(ctx); len(users) != 0 {
+		t.Errorf("expected no banned users, got %v", users)
+	}
+	if ranges, _ := adapter.BannedIPRanges(ctx); len(ranges) != 0 {
+		t.Errorf("expected no banned ranges, got %v", ranges)
+	}
+}
+
+func TestPurchaseRecords(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-records"))
+	adapter.DeleteCampaign(ctx, "test-records")
+	defer adapter.DeleteCampaign(ctx, "test-records")
+
+	record := domain.PurchaseRecord{RequestID: "req-1", UserID: "user-1", Status: domain.PurchaseStatusSoldOut,
+		Reason: "insufficient stock", UpdatedAt: time.UnixMilli(time.Now().UnixMilli()).UTC()}
+	if err := adapter.SavePurchaseRecord(ctx, record, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err := adapter.GetPurchaseRecord(ctx, "req-1"); err != nil || got == nil || *got != record {
+		t.Errorf("expected %+v, got %+v, %v", record, got, err)
+	}
+	if ttl, _ := client.TTL(ctx, "campaign:test-records:purchase-record:req-1").Result(); ttl <= 0 {
+		t.Errorf("expected the record to expire, got TTL %v", ttl)
+	}
+	if got, err := adapter.GetPurchaseRecord(ctx, "req-unknown"); err != nil || got != nil {
+		t.Errorf("expected no record, got %+v, %v", got, err)
+	}
+}
+
+func TestSaleCounters(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-stats"))
+	adapter.DeleteCampaign(ctx, "test-stats")
+	defer adapter.DeleteCampaign(ctx, "test-stats")
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	adapter.AddQueued(ctx, 2)
+	adapter.RecordOrders(ctx, 2, 3, now.Add(-2*time.Second))
+	adapter.RecordOrders(ctx, 4, 4, now.Add(-time.Minute))
+	adapter.AddQueued(ctx, -2)
+	adapter.RecordFailure(ctx, "sold_out")
+	adapter.RecordSoldOut(ctx, "item-1", now)
+	adapter.RecordSoldOut(ctx, "item-1", now.Add(time.Second))
+
+	got, err := adapter.SaleCounters(ctx, "test-stats", now, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Orders != 6 || got.SoldUnits != 7 || got.RecentOrders != 2 || got.QueueDepth != 0 {
+		t.Errorf("unexpected counters: %+v", got)
+	}
+	if !got.StartedAt.Equal(now.Add(-2*time.Second)) || got.Failures["sold_out"] != 1 || !got.SoldOutAt["item-1"].Equal(now) {
+		t.Errorf("unexpected counters: %+v", got)
+	}
+	if ttl, _ := client.TTL(ctx, "campaign:test-stats:stats:rate:"+strconv.FormatInt(now.Add(-2*time.Second).Unix(), 10)).Result(); ttl <= 0 {
+		t.Errorf("expected the rate key to expire, got TTL %v", ttl)
+	}
+}
+
+func TestRiskSignals(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-risk"))
+	adapter.DeleteCampaign(ctx, "test-risk")
+	defer adapter.DeleteCampaign(ctx, "test-risk")
+	client.HDel(ctx, "risk:first-seen", "user-1")
+	defer client.HDel(ctx, "risk:first-seen", "user-1")
+
+	for want := 1; want <= 3; want++ {
+		if n, err := adapter.CountAttempt(ctx, "ip:10.0.0.1", time.Minute); err != nil || n != want {
+			t.Fatalf("expected count %d, got %d, %v", want, n, err)
+		}
+	}
+	if ttl, _ := client.PTTL(ctx, "campaign:test-risk:risk:ip:10.0.0.1").Result(); ttl <= 0 {
+		t.Errorf("expected the counter to expire, got TTL %v", ttl)
+	}
+
+	first := time.UnixMilli(time.Now().UnixMilli())
+	if seen, err := adapter.FirstSeen(ctx, "user-1", first); err != nil || !seen.Equal(first) {
+		t.Fatalf("expected %v, got %v, %v", first, seen, err)
+	}
+	if seen, _ := adapter.FirstSeen(ctx, "user-1", first.Add(time.Hour)); !seen.Equal(first) {
+		t.Errorf("expected the first sighting to stick, got %v", seen)
+	}
+}
+
+func TestLotteryEntries(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-lottery"))
+	adapter.DeleteCampaign(ctx, "test-lottery")
+	defer adapter.DeleteCampaign(ctx, "test-lottery")
+
+	for _, user := range []string{"u1", "u2", "u3"} {
+		entry := domain.LotteryEntry{RequestID: "req-" + user, UserID: user, ItemID: "item", Quantity: 1, IdempotencyKey: "idempotency:req-" + user}
+		if ok, err := adapter.AddEntry(ctx, entry); err != nil || !ok {
+			t.Fatalf("expected entry for %s, got %v, %v", user, ok, err)
+		}
+	}
+	if ok, _ := adapter.AddEntry(ctx, domain.LotteryEntry{RequestID: "req-again", UserID: "u1", ItemID: "item"}); ok {
+		t.Error("expected a second entry by the same user to be refused")
+	}
+	if items, err := adapter.LotteryItems(ctx); err != nil || len(items) != 1 || items[0] != "item" {
+		t.Errorf("expected item to have entries, got %v, %v", items, err)
+	}
+
+	drawn, err := adapter.DrawEntries(ctx, "item", 2)
+	if err != nil || len(drawn) != 2 {
+		t.Fatalf("expected 2 entries, got %d, %v", len(drawn), err)
+	}
+	if drawn[0].IdempotencyKey != "idempotency:"+drawn[0].RequestID {
+		t.Errorf("expected the entry to round-trip, got %+v", drawn[0])
+	}
+	rest, _ := adapter.DrawEntries(ctx, "item", 2)
+	if len(rest) != 1 {
+		t.Fatalf("expected 1 entry left, got %d", len(rest))
+	}
+	if items, _ := adapter.LotteryItems(ctx); len(items) != 0 {
+		t.Errorf("expected no items left to draw, got %v", items)
+	}
+}
+
+func TestOrderSpool(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("test-spool"))
+	client.Del(ctx, "campaign:test-spool:order-spool")
+
+	orders := []domain.Order{
+		{ID: "order-1", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending, TraceContext: map[string]string{"traceparent": "00-abc"}},
+		{ID: "order-2", UserID: "user-2", ItemID: "item-1", Quantity: 2, Status: domain.OrderStatusPending},
+	}
+	if err := adapter.SpoolOrders(ctx, orders); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Reading the spool leaves the orders in it
+	spooled, err := adapter.SpooledOrders(ctx)
+	if err != nil || len(spooled) != 2 {
+		t.Fatalf("expected 2 spooled orders, got %d, %v", len(spooled), err)
+	}
+
+	recovered, err := adapter.RecoverOrders(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recovered) != 2 || recovered[0].ID != "order-1" || recovered[1].Quantity != 2 {
+		t.Errorf("unexpected orders: %+v", recovered)
+	}
+	if recovered[0].TraceContext["traceparent"] != "00-abc" {
+		t.Errorf("expected trace context to survive, got %v", recovered[0].TraceContext)
+	}
+
+	// Recovered orders are gone from the spool
+	recovered, err = adapter.RecoverOrders(ctx)
+	if err != nil || len(recovered) != 0 {
+		t.Errorf("expected empty spool, got %d orders, %v", len(recovered), err)
+	}
+}
+
+func TestCampaignTeardown(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("teardown-test"))
+	other := NewRedisAdapter(client, WithCampaignKeys("teardown-other"))
+
+	// Setup
+	adapter.DeleteCampaign(ctx, "teardown-test")
+	adapter.SetStock(ctx, "item-a", 7)
+	adapter.SetStock(ctx, "item-b", 0)
+	adapter.SetFrozen(ctx, "item-a", true)
+	adapter.SetIdempotency(ctx, "idempotency:req-1", time.Hour)
+	other.SetStock(ctx, "item-a", 3)
+	defer other.DeleteCampaign(ctx, "teardown-other")
+
+	// Keys are scoped under the campaign
+	if stock, _ := client.Get(ctx, "campaign:teardown-test:stock:{item-a}").Int(); stock != 7 {
+		t.Errorf("expected prefixed stock 7, got %d", stock)
+	}
+
+	archive, err := adapter.SnapshotCampaign(ctx, "teardown-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if archive.Stock["item-a"] != 7 || archive.Stock["item-b"] != 0 || len(archive.Stock) != 2 {
+		t.Errorf("unexpected stock: %v", archive.Stock)
+	}
+	if len(archive.FrozenItems) != 1 || archive.FrozenItems[0] != "item-a" {
+		t.Errorf("unexpected frozen items: %v", archive.FrozenItems)
+	}
+	if archive.IdempotencyKeys != 1 {
+		t.Errorf("expected 1 idempotency key, got %d", archive.IdempotencyKeys)
+	}
+
+	deleted, err := adapter.DeleteCampaign(ctx, "teardown-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 4 {
+		t.Errorf("expected 4 keys deleted, got %d", deleted)
+	}
+
+	// Other campaigns are untouched
+	if stock, _ := client.Get(ctx, "campaign:teardown-other:stock:{item-a}").Int(); stock != 3 {
+		t.Errorf("expected other campaign stock 3, got %d", stock)
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	if got := escapeGlob("campaign:a*b?[c]:"); got != `campaign:a\*b\?\[c\]:` {
+		t.Errorf("unexpected escape: %s", got)
+	}
+}
+
+func TestWatchStock(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	adapter := NewRedisAdapter(client)
+	adapter.SetStock(ctx, "watch-item", 5)
+
+	levels, err := adapter.WatchStock(ctx, "watch-item")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	adapter.DecrementStock(ctx, "watch-item", 2)
+	select {
+	case level := <-levels:
+		if level != 3 {
+			t.Errorf("expected level 3, got %d", level)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stock update received")
+	}
+}
+
+func TestRedisRateLimiter_SlidingWindow(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	client.Del(ctx, "ratelimit:test:user-1", "ratelimit:test:user-2")
+	limiter := NewRedisRateLimiter(client, "test", 2, 200*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if ok, _, err := limiter.Allow(ctx, "user-1"); err != nil || !ok {
+			t.Fatalf("request %d should be allowed: %v", i, err)
+		}
+	}
+
+	ok, retryAfter, err := limiter.Allow(ctx, "user-1")
+	if err != nil || ok {
+		t.Fatalf("expected third request to be limited, got ok=%v err=%v", ok, err)
+	}
+	if retryAfter <= 0 || retryAfter > 200*time.Millisecond {
+		t.Errorf("unexpected retry after %v", retryAfter)
+	}
+	if ok, _, _ := limiter.Allow(ctx, "user-2"); !ok {
+		t.Error("other keys should have their own window")
+	}
+
+	time.Sleep(retryAfter + 10*time.Millisecond)
+	if ok, _, _ := limiter.Allow(ctx, "user-1"); !ok {
+		t.Error("expected a slot once the oldest request left the window")
+	}
+}
+
+func TestItemFromKey(t *testing.T) {
+	ctx := context.Background()
+	adapter := NewRedisAdapter(nil, WithCampaignKeys("summer"))
+	key := strings.TrimPrefix(adapter.itemKey(ctx, stockKeyPrefix, "iphone-15"), adapter.campaignPrefix(ctx, "summer"))
+	if got := itemFromKey(key, stockKeyPrefix); got != "iphone-15" {
+		t.Errorf("expected iphone-15, got %s", got)
+	}
+
+	sharded := NewRedisAdapter(nil, WithStockShards(4))
+	if got := itemFromKey(sharded.shardKey(ctx, frozenKeyPrefix, "item#a", 3), frozenKeyPrefix); got != "item#a" {
+		t.Errorf("expected item#a, got %s", got)
+	}
+}
+
+func TestTenantKeys(t *testing.T) {
+	owners := map[string]string{"anvil": "globex"}
+	adapter := NewRedisAdapter(nil, WithCampaignKeys("summer"), WithItemTenants(func(ctx context.Context, itemID string) string {
+		return owners[itemID]
+	}))
+
+	acme := port.WithTenant(context.Background(), "acme")
+	if got := adapter.itemKey(acme, stockKeyPrefix, "iphone-15"); got != "tenant:acme:campaign:summer:stock:{iphone-15}" {
+		t.Errorf("stock key = %s", got)
+	}
+	if got := adapter.campaignPrefix(acme, "winter"); got != "tenant:acme:campaign:winter:" {
+		t.Errorf("campaign prefix = %s", got)
+	}
+	if got := adapter.keys(acme) + purchaseRecordPrefix + "req-1"; got != "tenant:acme:campaign:summer:purchase-record:req-1" {
+		t.Errorf("purchase record key = %s", got)
+	}
+
+	// Work without a tenant uses the item's owner
+	if got := adapter.itemKey(context.Background(), stockKeyPrefix, "anvil"); got != "tenant:globex:campaign:summer:stock:{anvil}" {
+		t.Errorf("stock key of an item outside a request = %s", got)
+	}
+	if got := adapter.itemKey(port.WithTenant(context.Background(), ""), stockKeyPrefix, "iphone-15"); got != "campaign:summer:stock:{iphone-15}" {
+		t.Errorf("stock key of the default tenant = %s", got)
+	}
+}
+
+func TestStockShards(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("shard-test"), WithStockShards(4))
+	adapter.DeleteCampaign(ctx, "shard-test")
+	defer adapter.DeleteCampaign(ctx, "shard-test")
+
+	// 10 units over 4 shards: 3, 3, 2, 2
+	adapter.SetStock(ctx, "item-a", 10)
+	if stock, _ := client.Get(ctx, "campaign:shard-test:stock:{item-a#3}").Int(); stock != 2 {
+		t.Errorf("expected shard 3 to hold 2, got %d", stock)
+	}
+
+	// Purchases fall through empty shards until the total runs out
+	for i := range 10 {
+		res, err := adapter.DecrementStock(ctx, "item-a", 1)
+		if err != nil || res != domain.StockDecremented {
+			t.Fatalf("purchase %d: expected decrement, got %v, %v", i, res, err)
+		}
+	}
+	if res, _ := adapter.DecrementStock(ctx, "item-a", 1); res != domain.StockInsufficient {
+		t.Errorf("expected sold out, got %v", res)
+	}
+
+	adapter.IncrementStock(ctx, "item-a", 3)
+	if stock, _ := adapter.GetStock(ctx, "item-a"); stock != 3 {
+		t.Errorf("expected stock 3, got %d", stock)
+	}
+
+	// Flags apply to every shard
+	adapter.SetFrozen(ctx, "item-a", true)
+	for range 4 {
+		if res, _ := adapter.DecrementStock(ctx, "item-a", 1); res != domain.StockFrozen {
+			t.Fatalf("expected frozen, got %v", res)
+		}
+	}
+
+	archive, err := adapter.SnapshotCampaign(ctx, "shard-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if archive.Stock["item-a"] != 3 || len(archive.FrozenItems) != 1 {
+		t.Errorf("unexpected archive: %+v", archive)
+	}
+	if res, _ := adapter.DecrementStock(ctx, "item-b", 1); res != domain.StockNoSuchItem {
+		t.Errorf("expected no such item, got %v", res)
+	}
+}
+
+// TestRedisCluster runs against the cluster in REDIS_CLUSTER_ADDRS, checking
+// the multi-key stock script and the campaign scan across masters.
+func TestRedisCluster(t *testing.T) {
+	addrs := os.Getenv("REDIS_CLUSTER_ADDRS")
+	if addrs == "" {
+		t.Skip("REDIS_CLUSTER_ADDRS not set")
+	}
+	client := NewRedisClient(RedisSettings{ClusterAddrs: strings.Split(addrs, ",")})
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("Redis Cluster not available: %v", err)
+	}
+	adapter := NewRedisAdapter(client, WithCampaignKeys("cluster-test"))
+	adapter.DeleteCampaign(ctx, "cluster-test")
+	defer adapter.DeleteCampaign(ctx, "cluster-test")
+
+	// Enough items to land on every master
+	for i := range 20 {
+		item := "item-" + strconv.Itoa(i)
+		if err := adapter.SetStock(ctx, item, 5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res, err := adapter.DecrementStock(ctx, item, 2)
+		if err != nil || res != domain.StockDecremented {
+			t.Fatalf("expected decrement for %s, got %v, %v", item, res, err)
+		}
+	}
+
+	archive, err := adapter.SnapshotCampaign(ctx, "cluster-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(archive.Stock) != 20 || archive.Stock["item-7"] != 3 {
+		t.Errorf("unexpected stock: %v", archive.Stock)
+	}
+	if deleted, err := adapter.DeleteCampaign(ctx, "cluster-test"); err != nil || deleted != 20 {
+		t.Errorf("expected 20 keys deleted, got %d, %v", deleted, err)
+	}
+}
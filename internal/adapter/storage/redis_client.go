@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisPoolSize        = 100
+	redisMinRetryBackoff = 50 * time.Millisecond
+	redisMaxRetryBackoff = 500 * time.Millisecond
+)
+
+// RedisSettings select a standalone Redis server, a Sentinel-monitored
+// master when SentinelMaster is set, or Redis Cluster when ClusterAddrs is.
+type RedisSettings struct {
+	Addr             string
+	ClusterAddrs     []string
+	SentinelMaster   string
+	SentinelAddrs    []string
+	SentinelPassword string
+	// FailoverTimeout is how long commands keep retrying while Sentinel
+	// promotes a replica, before the error reaches the caller.
+	FailoverTimeout time.Duration
+}
+
+// NewRedisClient connects to the Redis server in settings. With Sentinel the
+// client follows the master across failovers: it asks the sentinels for the
+// current master, drops its connections when a switch is announced, and
+// treats READONLY replies from a demoted master as retryable, closing the
+// connection that received them. Scripts rejected with READONLY made no
+// writes, so retrying them cannot take stock twice. A cluster client follows
+// MOVED and ASK redirects and refreshes its slot map after a failover.
+func NewRedisClient(settings RedisSettings) redis.UniversalClient {
+	retries := failoverRetries(settings.FailoverTimeout)
+	if len(settings.ClusterAddrs) > 0 {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           settings.ClusterAddrs,
+			PoolSize:        redisPoolSize,
+			MaxRetries:      retries,
+			MinRetryBackoff: redisMinRetryBackoff,
+			MaxRetryBackoff: redisMaxRetryBackoff,
+		})
+	}
+	if settings.SentinelMaster == "" {
+		return redis.NewClient(&redis.Options{
+			Addr:            settings.Addr,
+			PoolSize:        redisPoolSize,
+			MaxRetries:      retries,
+			MinRetryBackoff: redisMinRetryBackoff,
+			MaxRetryBackoff: redisMaxRetryBackoff,
+		})
+	}
+	return redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:       settings.SentinelMaster,
+		SentinelAddrs:    settings.SentinelAddrs,
+		SentinelPassword: settings.SentinelPassword,
+		PoolSize:         redisPoolSize,
+		MaxRetries:       retries,
+		MinRetryBackoff:  redisMinRetryBackoff,
+		MaxRetryBackoff:  redisMaxRetryBackoff,
+	})
+}
+
+// failoverRetries is how many retries, at the capped backoff, span timeout.
+func failoverRetries(timeout time.Duration) int {
+	retries := int(timeout / redisMaxRetryBackoff)
+	if retries < 3 {
+		// go-redis' default
+		return 3
+	}
+	return retries
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRedisClient_RetriesSpanFailover(t *testing.T) {
+	client := NewRedisClient(RedisSettings{
+		SentinelMaster:  "mymaster",
+		SentinelAddrs:   []string{"localhost:26379"},
+		FailoverTimeout: 10 * time.Second,
+	})
+	defer client.Close()
+
+	if got := client.(*redis.Client).Options().MaxRetries; got != 20 {
+		t.Errorf("expected 20 retries, got %d", got)
+	}
+	if got := failoverRetries(0); got != 3 {
+		t.Errorf("expected the default 3 retries, got %d", got)
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// orderEventChannel carries the campaign's order events as JSON.
+const orderEventChannel = "order-events"
+
+func (r *RedisAdapter) PublishOrderEvent(ctx context.Context, event domain.OrderEvent) (err error) {
+	ctx, span := startSpan(ctx, "redis", "PublishOrderEvent")
+	defer endSpan(span, &err)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.prefix+orderEventChannel, data).Err()
+}
+
+// WatchOrderEvents subscribes to the campaign's order event channel. Events
+// are only delivered to subscribers present when they are published.
+func (r *RedisAdapter) WatchOrderEvents(ctx context.Context) (<-chan domain.OrderEvent, error) {
+	sub := r.client.Subscribe(ctx, r.prefix+orderEventChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	events := make(chan domain.OrderEvent, 16)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event domain.OrderEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitKeyPrefix = "ratelimit:"
+
+// slidingWindowScript keeps one sorted-set member per admitted request,
+// scored by its time in milliseconds. It admits a request if fewer than
+// ARGV[2] remain inside the window of ARGV[1] ms and otherwise returns the
+// milliseconds until the oldest one leaves it. The Redis clock is used so
+// servers with skewed clocks share one window.
+var slidingWindowScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return math.max(tonumber(oldest[2]) + window - now, 1)
+`)
+
+// RedisRateLimiter is a sliding-window limiter shared by every server
+// instance using the same Redis.
+type RedisRateLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+// NewRedisRateLimiter admits up to limit requests per key in any window.
+// Keys are stored under "ratelimit:<scope>:", so limiters with different
+// scopes, such as users and IPs, do not share counters.
+func NewRedisRateLimiter(client redis.UniversalClient, scope string, limit int, window time.Duration) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client: client,
+		prefix: rateLimitKeyPrefix + scope + ":",
+		limit:  limit,
+		window: window,
+	}
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (_ bool, _ time.Duration, err error) {
+	ctx, span := startSpan(ctx, "redis", "RateLimit")
+	defer endSpan(span, &err)
+
+	wait, err := slidingWindowScript.Run(ctx, l.client, []string{l.prefix + key},
+		l.window.Milliseconds(), l.limit, uuid.New().String(),
+	).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisRetryAttempts = 3
+	defaultRedisRetryBackoff  = 10 * time.Millisecond
+	// redisRetryBackoffCap caps the retry delay at this many times the
+	// first one
+	redisRetryBackoffCap = 8
+)
+
+// redisErrorClass says whether a failed Redis call may be retried.
+type redisErrorClass int
+
+const (
+	// redisFatal errors would only repeat, or the caller has given up:
+	// script and type errors, redis.Nil, a closed client, context errors.
+	redisFatal redisErrorClass = iota
+	// redisNotRun errors show that Redis never ran the command: it could
+	// not be reached, or refused the command for now while loading,
+	// failing over or running a slow script. Any command may be retried.
+	redisNotRun
+	// redisUncertain errors leave it unknown whether the command ran, as
+	// when the connection drops or times out before the reply arrives.
+	// Only commands that are safe to run twice may be retried.
+	redisUncertain
+)
+
+// redisBusyPrefixes start the replies of a server that did not run the
+// command but may shortly.
+var redisBusyPrefixes = []string{"LOADING ", "BUSY ", "TRYAGAIN ", "CLUSTERDOWN ", "MASTERDOWN ", "READONLY ", "max number of clients"}
+
+func classifyRedisError(err error) redisErrorClass {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, redis.Nil), errors.Is(err, redis.ErrClosed):
+		return redisFatal
+	case errors.Is(err, redis.ErrPoolTimeout), errors.Is(err, redis.ErrPoolExhausted):
+		return redisNotRun
+	}
+
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		for _, prefix := range redisBusyPrefixes {
+			if redis.HasErrorPrefix(err, prefix) {
+				return redisNotRun
+			}
+		}
+		return redisFatal
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return redisNotRun
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return redisUncertain
+	}
+	return redisFatal
+}
+
+// WithRetries retries calls that fail with a transient error up to
+// attempts times in all, waiting a random delay of up to backoff before the
+// first retry, doubling for each one after. A call is only retried when
+// running it twice is safe: commands whose reply was lost are retried only
+// if they are idempotent, which the stock scripts are made by tokens. The
+// default is 3 attempts with 10ms backoff; 1 attempt disables retries.
+func WithRetries(attempts int, backoff time.Duration) RedisOption {
+	return func(r *RedisAdapter) {
+		r.retryAttempts = attempts
+		r.retryBackoff = backoff
+	}
+}
+
+// retry runs call until it succeeds or fails with an error retrying cannot
+// fix, for at most the adapter's attempts. Unless idempotent, call is only
+// retried after errors that show Redis never ran it.
+func (r *RedisAdapter) retry(ctx context.Context, idempotent bool, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= r.retryAttempts {
+			return err
+		}
+		switch classifyRedisError(err) {
+		case redisFatal:
+			return err
+		case redisUncertain:
+			if !idempotent {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(r.retryDelay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// retryDelay is a random delay of up to the backoff of the given retry
+// (1-based), so callers failing together do not retry together.
+func (r *RedisAdapter) retryDelay(retry int) time.Duration {
+	ceiling := r.retryBackoff
+	for i := 1; i < retry && ceiling < r.retryBackoff*redisRetryBackoffCap; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, r.retryBackoff*redisRetryBackoffCap)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
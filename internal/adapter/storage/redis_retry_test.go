@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+func TestClassifyRedisError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want redisErrorClass
+	}{
+		{replyError("LOADING Redis is loading the dataset in memory"), redisNotRun},
+		{replyError("BUSY Redis is busy running a script"), redisNotRun},
+		{replyError("READONLY You can't write against a read only replica."), redisNotRun},
+		{replyError("ERR max number of clients reached"), redisNotRun},
+		{fmt.Errorf("wrapped: %w", replyError("CLUSTERDOWN The cluster is down")), redisNotRun},
+		{redis.ErrPoolTimeout, redisNotRun},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, redisNotRun},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, redisUncertain},
+		{io.EOF, redisUncertain},
+		{replyError("WRONGTYPE Operation against a key holding the wrong kind of value"), redisFatal},
+		{replyError("ERR Error running script"), redisFatal},
+		{redis.Nil, redisFatal},
+		{redis.ErrClosed, redisFatal},
+		{context.DeadlineExceeded, redisFatal},
+		{errors.New("parse lease"), redisFatal},
+	}
+	for _, tt := range tests {
+		if got := classifyRedisError(tt.err); got != tt.want {
+			t.Errorf("%v: expected class %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
+
+// faultyRedis answers commands without a server, failing them with its
+// faults in turn before replying with reply.
+type faultyRedis struct {
+	mu     sync.Mutex
+	faults []error
+	calls  [][]any
+	reply  func(cmd redis.Cmder)
+}
+
+func (f *faultyRedis) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (f *faultyRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func (f *faultyRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls = append(f.calls, cmd.Args())
+		if len(f.faults) > 0 {
+			err := f.faults[0]
+			f.faults = f.faults[1:]
+			cmd.SetErr(err)
+			return err
+		}
+		f.reply(cmd)
+		return nil
+	}
+}
+
+func newFaultyAdapter(t *testing.T, reply func(cmd redis.Cmder), faults ...error) (*RedisAdapter, *faultyRedis) {
+	t.Helper()
+	fake := &faultyRedis{faults: faults, reply: reply}
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0", MaxRetries: -1})
+	client.AddHook(fake)
+	t.Cleanup(func() { client.Close() })
+	return NewRedisAdapter(client, WithRetries(3, time.Millisecond)), fake
+}
+
+func scriptReply(v any) func(cmd redis.Cmder) {
+	return func(cmd redis.Cmder) {
+		cmd.(*redis.Cmd).SetVal(v)
+	}
+}
+
+var (
+	lostReply = &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	refused   = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+)
+
+func TestRedisAdapter_RetriesDecrementWithItsToken(t *testing.T) {
+	adapter, fake := newFaultyAdapter(t, scriptReply(int64(decrementOK)), lostReply, replyError("LOADING Redis is loading"))
+
+	result, err := adapter.DecrementStock(context.Background(), "item-1", 1)
+	if err != nil || result != domain.StockDecremented {
+		t.Fatalf("expected the decrement to go through, got %v, %v", result, err)
+	}
+	if len(fake.calls) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(fake.calls))
+	}
+	for _, call := range fake.calls[1:] {
+		if !slices.Equal(call, fake.calls[0]) {
+			t.Errorf("expected every attempt to carry the same token, got %v and %v", fake.calls[0], call)
+		}
+	}
+}
+
+func TestRedisAdapter_RetriesOnlyWhenSafe(t *testing.T) {
+	ctx := context.Background()
+
+	// Giving stock back twice would oversell, so a lost reply is final
+	adapter, fake := newFaultyAdapter(t, scriptReply(int64(1)), lostReply)
+	if err := adapter.IncrementStock(ctx, "item-1", 1); !errors.Is(err, os.ErrDeadlineExceeded) || len(fake.calls) != 1 {
+		t.Errorf("expected one attempt and its error, got %d and %v", len(fake.calls), err)
+	}
+	adapter, fake = newFaultyAdapter(t, scriptReply(int64(1)), refused)
+	if err := adapter.IncrementStock(ctx, "item-1", 1); err != nil || len(fake.calls) != 2 {
+		t.Errorf("expected a retry after a refused connection, got %d attempts and %v", len(fake.calls), err)
+	}
+
+	adapter, fake = newFaultyAdapter(t, scriptReply(int64(1)), replyError("ERR Error running script"))
+	if _, err := adapter.DecrementStock(ctx, "item-1", 1); err == nil || len(fake.calls) != 1 {
+		t.Errorf("expected a script error to fail at once, got %d attempts and %v", len(fake.calls), err)
+	}
+
+	adapter, fake = newFaultyAdapter(t, scriptReply(int64(1)), refused, refused, refused, refused)
+	if _, err := adapter.SetIdempotency(ctx, "idempotency:req-1", time.Minute); !errors.Is(err, refused) || len(fake.calls) != 3 {
+		t.Errorf("expected 3 attempts, got %d and %v", len(fake.calls), err)
+	}
+}
+
+func TestRedisAdapter_RetryStopsWithContext(t *testing.T) {
+	fake := &faultyRedis{faults: []error{refused, refused}, reply: scriptReply(int64(1))}
+	client := redis.NewClient(&redis.Options{Addr: "localhost:0", MaxRetries: -1})
+	client.AddHook(fake)
+	defer client.Close()
+	adapter := NewRedisAdapter(client, WithRetries(3, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// The first retry waits up to an hour, so the context ends it unless
+	// the delay drawn is tiny
+	_, err := adapter.SetIdempotency(ctx, "idempotency:req-1", time.Minute)
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected the retry to stop with the context")
+	}
+	if err != nil && !errors.Is(err, refused) {
+		t.Errorf("expected the last Redis error, got %v", err)
+	}
+}
+
+func TestRedisAdapter_RetryDelay(t *testing.T) {
+	adapter := NewRedisAdapter(nil, WithRetries(10, 10*time.Millisecond))
+	for retry := 1; retry <= 10; retry++ {
+		ceiling := min(10*time.Millisecond<<(retry-1), 80*time.Millisecond)
+		for range 20 {
+			if d := adapter.retryDelay(retry); d < 0 || d > ceiling {
+				t.Fatalf("retry %d: delay %v outside [0, %v]", retry, d, ceiling)
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// The counters of a sale live in one hash in the campaign keyspace, e.g.
+// "campaign:spring:stats", with orders saved per second in keys of their
+// own that expire after saleRateTTL, so a rate window must be shorter.
+const (
+	statsKey        = "stats"
+	statsRatePrefix = "stats:rate:"
+	saleRateTTL     = 10 * time.Minute
+
+	statsOrders        = "orders"
+	statsSoldUnits     = "sold_units"
+	statsQueued        = "queued"
+	statsStartedAt     = "started_at"
+	statsFailurePrefix = "failed:"
+	statsSoldOutPrefix = "sold_out:"
+)
+
+func (r *RedisAdapter) RecordOrders(ctx context.Context, orders, units int, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "redis", "RecordOrders")
+	defer endSpan(span, &err)
+
+	key := r.keys(ctx) + statsKey
+	rateKey := r.keys(ctx) + statsRatePrefix + strconv.FormatInt(at.Unix(), 10)
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, statsOrders, int64(orders))
+		pipe.HIncrBy(ctx, key, statsSoldUnits, int64(units))
+		pipe.HSetNX(ctx, key, statsStartedAt, at.UnixMilli())
+		pipe.IncrBy(ctx, rateKey, int64(orders))
+		pipe.Expire(ctx, rateKey, saleRateTTL)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisAdapter) RecordFailure(ctx context.Context, outcome string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "RecordFailure")
+	defer endSpan(span, &err)
+
+	return r.client.HIncrBy(ctx, r.keys(ctx)+statsKey, statsFailurePrefix+outcome, 1).Err()
+}
+
+func (r *RedisAdapter) RecordSoldOut(ctx context.Context, itemID string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "redis", "RecordSoldOut")
+	defer endSpan(span, &err)
+
+	return r.client.HSetNX(ctx, r.itemPrefix(ctx, itemID)+statsKey, statsSoldOutPrefix+itemID, at.UnixMilli()).Err()
+}
+
+func (r *RedisAdapter) AddQueued(ctx context.Context, delta int) (err error) {
+	ctx, span := startSpan(ctx, "redis", "AddQueued")
+	defer endSpan(span, &err)
+
+	return r.client.HIncrBy(ctx, r.keys(ctx)+statsKey, statsQueued, int64(delta)).Err()
+}
+
+// SaleCounters reads the hash and the per-second keys of the window in one
+// pipeline. The queue depth is never reported below zero, which it can
+// drift to if a server dies holding queued orders.
+func (r *RedisAdapter) SaleCounters(ctx context.Context, campaignID string, now time.Time, window time.Duration) (_ *domain.SaleCounters, err error) {
+	ctx, span := startSpan(ctx, "redis", "SaleCounters")
+	defer endSpan(span, &err)
+
+	prefix := r.campaignPrefix(ctx, campaignID)
+	var fields *redis.MapStringStringCmd
+	var rates []*redis.StringCmd
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, prefix+statsKey)
+		end := now.Unix()
+		for sec := end - int64(window/time.Second); sec < end; sec++ {
+			rates = append(rates, pipe.Get(ctx, prefix+statsRatePrefix+strconv.FormatInt(sec, 10)))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	counters := &domain.SaleCounters{
+		Failures:  make(map[string]int64),
+		SoldOutAt: make(map[string]time.Time),
+	}
+	for field, value := range fields.Val() {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case field == statsOrders:
+			counters.Orders = n
+		case field == statsSoldUnits:
+			counters.SoldUnits = n
+		case field == statsQueued:
+			counters.QueueDepth = max(n, 0)
+		case field == statsStartedAt:
+			counters.StartedAt = time.UnixMilli(n)
+		case strings.HasPrefix(field, statsFailurePrefix):
+			counters.Failures[strings.TrimPrefix(field, statsFailurePrefix)] = n
+		case strings.HasPrefix(field, statsSoldOutPrefix):
+			counters.SoldOutAt[strings.TrimPrefix(field, statsSoldOutPrefix)] = time.UnixMilli(n)
+		}
+	}
+	for _, rate := range rates {
+		n, _ := rate.Int64()
+		counters.RecentOrders += n
+	}
+	return counters, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+)
+
+// soldOutChannel carries the IDs of items that sold out, one channel for
+// the whole campaign so servers need not subscribe per item.
+const soldOutChannel = "sold-out"
+
+func (r *RedisAdapter) PublishSoldOut(ctx context.Context, itemID string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "PublishSoldOut")
+	defer endSpan(span, &err)
+
+	return r.client.Publish(ctx, r.prefix+soldOutChannel, itemID).Err()
+}
+
+// WatchSoldOut subscribes to the campaign's sold out channel. Items are only
+// delivered to subscribers present when they are published.
+func (r *RedisAdapter) WatchSoldOut(ctx context.Context) (<-chan string, error) {
+	sub := r.client.Subscribe(ctx, r.prefix+soldOutChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	items := make(chan string, 1)
+	go func() {
+		defer close(items)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case items <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return items, nil
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// leasePrelude starts every lease script. It returns the units of expired
+// leases to the stock counter, so tokens held by a server that died are put
+// back on sale, and defines available(), the stock including units still
+// leased. Scripts using it take the item's stock, frozen, closed, leases and
+// lease expiry keys, in that order.
+const leasePrelude = `
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+for _, owner in ipairs(redis.call('ZRANGEBYSCORE', KEYS[5], '-inf', now)) do
+	local held = tonumber(redis.call('HGET', KEYS[4], owner) or '0')
+	if held > 0 then
+		redis.call('INCRBY', KEYS[1], held)
+	end
+	redis.call('HDEL', KEYS[4], owner)
+	redis.call('ZREM', KEYS[5], owner)
+end
+
+local function available()
+	local total = tonumber(redis.call('GET', KEYS[1]) or '0')
+	for _, held in ipairs(redis.call('HVALS', KEYS[4])) do
+		total = total + tonumber(held)
+	end
+	return total
+end
+`
+
+// leaseStockScript moves up to ARGV[2] units from the stock counter into the
+// lease of ARGV[1], valid for ARGV[3] ms. It returns the decrement result
+// codes of decrementStockScript and the units granted.
+var leaseStockScript = redis.NewScript(leasePrelude + `
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	return {-3, 0}
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return {-2, 0}
+end
+
+local current = redis.call('GET', KEYS[1])
+if not current then
+	return {-1, 0}
+end
+
+local granted = math.min(tonumber(current), tonumber(ARGV[2]))
+if granted <= 0 then
+	return {0, 0}
+end
+redis.call('DECRBY', KEYS[1], granted)
+redis.call('HINCRBY', KEYS[4], ARGV[1], granted)
+redis.call('ZADD', KEYS[5], now + tonumber(ARGV[3]), ARGV[1])
+return {1, granted}
+`)
+
+// Lease renewal results
+const (
+	leaseRenewed  = 1
+	leaseReleased = 0
+	leaseLost     = -1
+)
+
+// renewLeaseScript records that ARGV[1] still holds ARGV[2] units and extends
+// its lease by ARGV[3] ms. An empty lease, or one on an item that has been
+// paused or closed, is given back instead. Stock changes are published on
+// ARGV[4].
+var renewLeaseScript = redis.NewScript(leasePrelude + `
+local held = redis.call('HGET', KEYS[4], ARGV[1])
+if not held then
+	return -1
+end
+
+local remaining = tonumber(ARGV[2])
+local result = 1
+if remaining == 0 or redis.call('EXISTS', KEYS[2]) == 1 or redis.call('EXISTS', KEYS[3]) == 1 then
+	if remaining > 0 then
+		redis.call('INCRBY', KEYS[1], remaining)
+	end
+	redis.call('HDEL', KEYS[4], ARGV[1])
+	redis.call('ZREM', KEYS[5], ARGV[1])
+	result = 0
+else
+	redis.call('HSET', KEYS[4], ARGV[1], remaining)
+	redis.call('ZADD', KEYS[5], now + tonumber(ARGV[3]), ARGV[1])
+end
+
+if tonumber(held) ~= remaining then
+	redis.call('PUBLISH', ARGV[4], available())
+end
+return result
+`)
+
+// returnLeaseScript gives the ARGV[2] units ARGV[1] still holds back to the
+// stock counter and ends its lease.
+var returnLeaseScript = redis.NewScript(leasePrelude + `
+local held = redis.call('HGET', KEYS[4], ARGV[1])
+if not held then
+	return 0
+end
+
+local remaining = tonumber(ARGV[2])
+if remaining > 0 then
+	redis.call('INCRBY', KEYS[1], remaining)
+end
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[5], ARGV[1])
+if tonumber(held) ~= remaining then
+	redis.call('PUBLISH', ARGV[3], available())
+end
+return 1
+`)
+
+// LeasedStock sells stock from batches of tokens leased from Redis, so most
+// purchases of a hot item never leave the server. A lease is renewed in the
+// background with the tokens still unsold and expires if the server stops
+// renewing it, after which the next lease of the item returns its tokens to
+// the stock counter. Tokens sold after the last renewal of a server that dies
+// are returned too; the inventory check in MySQL turns those orders away.
+//
+// Pausing or closing an item takes effect on other servers at their next
+// renewal, when they give their tokens back. While stock is low, tokens
+// leased to one server cannot be bought through another.
+type LeasedStock struct {
+	*RedisAdapter
+	owner string
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]*stockLease
+}
+
+type stockLease struct {
+	mu      sync.Mutex
+	tokens  int
+	held    bool
+	expires time.Time
+}
+
+// NewLeasedStock leases up to size units of an item at a time, for ttl.
+func NewLeasedStock(adapter *RedisAdapter, size int, ttl time.Duration) *LeasedStock {
+	host, _ := os.Hostname()
+	return &LeasedStock{
+		RedisAdapter: adapter,
+		owner:        host + "-" + uuid.New().String()[:8],
+		size:         size,
+		ttl:          ttl,
+		now:          time.Now,
+		leases:       make(map[string]*stockLease),
+	}
+}
+
+func (l *LeasedStock) lease(itemID string) *stockLease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lease, ok := l.leases[itemID]
+	if !ok {
+		lease = &stockLease{}
+		l.leases[itemID] = lease
+	}
+	return lease
+}
+
+func (l *LeasedStock) leaseKeys(ctx context.Context, itemID string) []string {
+	return []string{
+		l.itemKey(ctx, stockKeyPrefix, itemID),
+		l.itemKey(ctx, frozenKeyPrefix, itemID),
+		l.itemKey(ctx, closedKeyPrefix, itemID),
+		l.itemKey(ctx, leasesKeyPrefix, itemID),
+		l.itemKey(ctx, leaseExpiryPrefix, itemID),
+	}
+}
+
+// DecrementStock sells from the server's tokens for the item, leasing more
+// from Redis when they run short.
+func (l *LeasedStock) DecrementStock(ctx context.Context, itemID string, quantity int) (_ domain.StockDecrement, err error) {
+	lease := l.lease(itemID)
+	lease.mu.Lock()
+	defer lease.mu.Unlock()
+
+	if lease.held && !l.now().Before(lease.expires) {
+		// Another server may already have reclaimed these tokens
+		lease.tokens = 0
+	}
+	if lease.tokens >= quantity {
+		lease.tokens -= quantity
+		return domain.StockDecremented, nil
+	}
+
+	ctx, span := startSpan(ctx, "redis", "LeaseStock")
+	defer endSpan(span, &err)
+
+	start := l.now()
+	reply, err := leaseStockScript.Run(ctx, l.client, l.leaseKeys(ctx, itemID), l.owner, max(l.size, quantity-lease.tokens), l.ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return domain.StockInsufficient, err
+	}
+
+	switch reply[0] {
+	case decrementFrozen:
+		return domain.StockFrozen, nil
+	case decrementSaleClosed:
+		return domain.StockSaleClosed, nil
+	case decrementNoSuchItem:
+		return domain.StockNoSuchItem, nil
+	case decrementOK:
+		lease.tokens += int(reply[1])
+		lease.held = true
+		lease.expires = start.Add(l.ttl)
+	}
+
+	if lease.tokens < quantity {
+		return domain.StockInsufficient, nil
+	}
+	lease.tokens -= quantity
+	return domain.StockDecremented, nil
+}
+
+// DecrementStocks sells a cart's lines from the server's tokens one at a
+// time, as they are held per item.
+func (l *LeasedStock) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	return decrementEach(ctx, l, lines)
+}
+
+// SetFrozen gives the server's tokens back before pausing the item.
+func (l *LeasedStock) SetFrozen(ctx context.Context, itemID string, frozen bool) error {
+	if frozen {
+		if err := l.returnLease(ctx, itemID); err != nil {
+			return err
+		}
+	}
+	return l.RedisAdapter.SetFrozen(ctx, itemID, frozen)
+}
+
+// SetSaleClosed gives the server's tokens back before closing the sale.
+func (l *LeasedStock) SetSaleClosed(ctx context.Context, itemID string, closed bool) error {
+	if closed {
+		if err := l.returnLease(ctx, itemID); err != nil {
+			return err
+		}
+	}
+	return l.RedisAdapter.SetSaleClosed(ctx, itemID, closed)
+}
+
+// Run renews the server's leases until ctx is cancelled, three times per
+// lease TTL so one missed renewal does not lose them.
+func (l *LeasedStock) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.renewAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *LeasedStock) renewAll(ctx context.Context) {
+	l.mu.Lock()
+	items := make(map[string]*stockLease, len(l.leases))
+	for itemID, lease := range l.leases {
+		items[itemID] = lease
+	}
+	l.mu.Unlock()
+
+	for itemID, lease := range items {
+		if err := l.renew(ctx, itemID, lease); err != nil {
+			log.Printf("renewing stock lease for %s failed: %v", itemID, err)
+		}
+	}
+}
+
+func (l *LeasedStock) renew(ctx context.Context, itemID string, lease *stockLease) error {
+	lease.mu.Lock()
+	defer lease.mu.Unlock()
+
+	if !lease.held {
+		return nil
+	}
+
+	start := l.now()
+	result, err := renewLeaseScript.Run(ctx, l.client, l.leaseKeys(ctx, itemID), l.owner, lease.tokens, l.ttl.Milliseconds(), l.stockChannel(ctx, itemID)).Int()
+	if err != nil {
+		// The tokens stay usable until the lease expires
+		return err
+	}
+
+	switch result {
+	case leaseRenewed:
+		lease.expires = start.Add(l.ttl)
+		return nil
+	case leaseLost:
+		log.Printf("stock lease for %s expired, dropping %d tokens", itemID, lease.tokens)
+	}
+	lease.tokens = 0
+	lease.held = false
+	return nil
+}
+
+// Close gives every unsold token back to the stock counter. Purchases made
+// after Close lease again.
+func (l *LeasedStock) Close(ctx context.Context) error {
+	l.mu.Lock()
+	items := make([]string, 0, len(l.leases))
+	for itemID := range l.leases {
+		items = append(items, itemID)
+	}
+	l.mu.Unlock()
+
+	for _, itemID := range items {
+		if err := l.returnLease(ctx, itemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LeasedStock) returnLease(ctx context.Context, itemID string) (err error) {
+	ctx, span := startSpan(ctx, "redis", "ReturnLease")
+	defer endSpan(span, &err)
+
+	lease := l.lease(itemID)
+	lease.mu.Lock()
+	defer lease.mu.Unlock()
+
+	if !lease.held {
+		return nil
+	}
+	if err := returnLeaseScript.Run(ctx, l.client, l.leaseKeys(ctx, itemID), l.owner, lease.tokens, l.stockChannel(ctx, itemID)).Err(); err != nil {
+		return err
+	}
+	lease.tokens = 0
+	lease.held = false
+	return nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestLeasedStock(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("lease-test"))
+	adapter.DeleteCampaign(ctx, "lease-test")
+	defer adapter.DeleteCampaign(ctx, "lease-test")
+	adapter.SetStock(ctx, "item-a", 10)
+
+	a := NewLeasedStock(adapter, 4, time.Minute)
+	b := NewLeasedStock(adapter, 4, time.Minute)
+
+	// The first purchase leases a batch; the rest are served locally
+	for range 3 {
+		if res, err := a.DecrementStock(ctx, "item-a", 1); err != nil || res != domain.StockDecremented {
+			t.Fatalf("expected decrement, got %v, %v", res, err)
+		}
+	}
+	if stock, _ := client.Get(ctx, "campaign:lease-test:stock:{item-a}").Int(); stock != 6 {
+		t.Errorf("expected 6 units left in redis, got %d", stock)
+	}
+
+	// Renewal reports the sold tokens
+	if stock, _ := adapter.GetStock(ctx, "item-a"); stock != 10 {
+		t.Errorf("expected 10 before renewal, got %d", stock)
+	}
+	a.renewAll(ctx)
+	if stock, _ := adapter.GetStock(ctx, "item-a"); stock != 7 {
+		t.Errorf("expected 7 after renewal, got %d", stock)
+	}
+
+	// A purchase larger than the batch leases what it needs
+	if res, _ := b.DecrementStock(ctx, "item-a", 5); res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v", res)
+	}
+	if res, _ := b.DecrementStock(ctx, "item-a", 2); res != domain.StockInsufficient {
+		t.Errorf("expected insufficient while a holds the rest, got %v", res)
+	}
+
+	// Returned tokens go back on sale
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res, _ := b.DecrementStock(ctx, "item-a", 2); res != domain.StockDecremented {
+		t.Errorf("expected decrement after return, got %v", res)
+	}
+
+	// Pausing the item gives tokens back at the next renewal
+	if res, _ := a.DecrementStock(ctx, "item-a", 1); res != domain.StockInsufficient {
+		t.Fatalf("expected insufficient, got %v", res)
+	}
+	adapter.SetFrozen(ctx, "item-a", true)
+	b.renewAll(ctx)
+	if res, _ := b.DecrementStock(ctx, "item-a", 1); res != domain.StockFrozen {
+		t.Errorf("expected frozen, got %v", res)
+	}
+	if stock, _ := client.Get(ctx, "campaign:lease-test:stock:{item-a}").Int(); stock != 0 {
+		t.Errorf("expected no units left, got %d", stock)
+	}
+}
+
+func TestLeasedStock_ExpiredLeaseReclaimed(t *testing.T) {
+	client := getRedisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	adapter := NewRedisAdapter(client, WithCampaignKeys("lease-expiry-test"))
+	adapter.DeleteCampaign(ctx, "lease-expiry-test")
+	defer adapter.DeleteCampaign(ctx, "lease-expiry-test")
+	adapter.SetStock(ctx, "item-a", 5)
+
+	crashed := NewLeasedStock(adapter, 5, 50*time.Millisecond)
+	if res, _ := crashed.DecrementStock(ctx, "item-a", 1); res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v", res)
+	}
+
+	// The lease is never renewed, so its 5 tokens return when it expires.
+	// That includes the unit sold since the last renewal, which the MySQL
+	// inventory check turns away.
+	time.Sleep(100 * time.Millisecond)
+	other := NewLeasedStock(adapter, 5, time.Minute)
+	if res, _ := other.DecrementStock(ctx, "item-a", 5); res != domain.StockDecremented {
+		t.Fatalf("expected decrement, got %v", res)
+	}
+
+	// The expired server no longer sells its tokens
+	if res, _ := crashed.DecrementStock(ctx, "item-a", 1); res != domain.StockInsufficient {
+		t.Errorf("expected insufficient, got %v", res)
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLiteMemory opens a private in-memory database.
+const SQLiteMemory = ":memory:"
+
+// sqliteSchema mirrors the MySQL migrations. Times are stored as unix
+// nanoseconds so they compare as numbers; the DATETIME column type makes the
+// driver scan them back into time.Time.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS items (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    price INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    max_per_user INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+
+CREATE TABLE IF NOT EXISTS inventory (
+    item_id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    stock INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_tenant_id ON inventory (tenant_id);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    item_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'pending',
+    allocation_id TEXT NULL,
+    unit_price INTEGER NOT NULL DEFAULT 0,
+    total_price INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    coupon_code TEXT NULL,
+    discount INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NULL,
+    payment_id TEXT NULL,
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    risk_flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    idempotency_key TEXT NULL,
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+CREATE INDEX IF NOT EXISTS idx_orders_item_id ON orders (item_id);
+CREATE INDEX IF NOT EXISTS idx_orders_user_created ON orders (user_id, created_at, id, status);
+CREATE INDEX IF NOT EXISTS idx_orders_tenant_user_created ON orders (tenant_id, user_id, created_at, id, status);
+CREATE INDEX IF NOT EXISTS idx_orders_allocation_id ON orders (allocation_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status_expires_at ON orders (status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders (created_at);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    unit_price INTEGER NOT NULL DEFAULT 0,
+    total_price INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, line)
+);
+CREATE INDEX IF NOT EXISTS idx_order_items_item_id ON order_items (item_id);
+
+CREATE TABLE IF NOT EXISTS orders_archive (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    item_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL,
+    allocation_id TEXT NULL,
+    unit_price INTEGER NOT NULL DEFAULT 0,
+    total_price INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    coupon_code TEXT NULL,
+    discount INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NULL,
+    payment_id TEXT NULL,
+    risk_score INTEGER NOT NULL DEFAULT 0,
+    risk_flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    idempotency_key TEXT NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    archived_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_user_created ON orders_archive (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_tenant_user_created ON orders_archive (tenant_id, user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_item_id ON orders_archive (item_id);
+
+CREATE TABLE IF NOT EXISTS order_items_archive (
+    order_id TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    unit_price INTEGER NOT NULL DEFAULT 0,
+    total_price INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, line)
+);
+
+CREATE TABLE IF NOT EXISTS order_views (
+    order_id TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    line_count INTEGER NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    total_price INTEGER NOT NULL DEFAULT 0,
+    order_quantity INTEGER NOT NULL,
+    order_total INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    coupon_code TEXT NULL,
+    discount INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    expires_at DATETIME NULL,
+    created_at DATETIME NULL,
+    updated_at DATETIME NULL,
+    PRIMARY KEY (order_id, line)
+);
+CREATE INDEX IF NOT EXISTS idx_order_views_user_line_created ON order_views (user_id, line, created_at, order_id, status);
+CREATE INDEX IF NOT EXISTS idx_order_views_tenant_user_line_created ON order_views (tenant_id, user_id, line, created_at, order_id, status);
+CREATE INDEX IF NOT EXISTS idx_order_views_item_status ON order_views (item_id, status);
+
+CREATE TABLE IF NOT EXISTS order_changes (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    data TEXT NULL,
+    payment_id TEXT NULL,
+    occurred_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_order_changes_order_seq ON order_changes (order_id, seq);
+
+CREATE TABLE IF NOT EXISTS coupons (
+    code TEXT PRIMARY KEY,
+    percent_off INTEGER NOT NULL DEFAULT 0,
+    amount_off INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+
+CREATE TABLE IF NOT EXISTS user_tiers (
+    user_id TEXT PRIMARY KEY,
+    tier TEXT NOT NULL,
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+
+CREATE TABLE IF NOT EXISTS allocations (
+    id TEXT PRIMARY KEY,
+    partner_id TEXT NOT NULL,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    fulfilled INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'open',
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+CREATE INDEX IF NOT EXISTS idx_allocations_partner_id ON allocations (partner_id);
+
+CREATE TABLE IF NOT EXISTS campaigns (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    item_ids BLOB NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT (NOW()),
+    updated_at DATETIME NOT NULL DEFAULT (NOW())
+);
+CREATE INDEX IF NOT EXISTS idx_campaigns_starts_at ON campaigns (starts_at);
+CREATE INDEX IF NOT EXISTS idx_campaigns_tenant_starts_at ON campaigns (tenant_id, starts_at);
+
+CREATE TABLE IF NOT EXISTS campaign_archives (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id TEXT NOT NULL,
+    final_stock BLOB NOT NULL,
+    frozen_items BLOB NOT NULL,
+    closed_items BLOB NOT NULL,
+    idempotency_keys INTEGER NOT NULL DEFAULT 0,
+    archived_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_campaign_archives_campaign_id ON campaign_archives (campaign_id);
+
+CREATE TABLE IF NOT EXISTS restock_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    stock_before INTEGER NOT NULL,
+    stock_after INTEGER NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_restock_audit_item_id ON restock_audit (item_id);
+
+CREATE TABLE IF NOT EXISTS stock_compensations (
+    id TEXT PRIMARY KEY,
+    item_id TEXT NOT NULL,
+    quantity INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    resolved_at DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS idx_stock_compensations_resolved_created ON stock_compensations (resolved_at, created_at);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id TEXT PRIMARY KEY,
+    order_id TEXT NOT NULL UNIQUE,
+    payment_id TEXT NULL,
+    amount INTEGER NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL DEFAULT '',
+    step TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_step_updated ON refunds (step, updated_at);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    before_state TEXT NULL,
+    after_state TEXT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action, id);
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+`
+
+var registerNow sync.Once
+
+// OpenSQLite opens the SQLite database at path, or SQLiteMemory, and creates
+// the schema. SQLite allows one writer at a time, so the pool holds a single
+// connection and transactions queue for it instead of failing as busy.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	var err error
+	registerNow.Do(func() {
+		// The MySQL adapter's queries stamp rows with NOW()
+		err = sqlite.RegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+			return time.Now().UnixNano(), nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("register now: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("_time_integer_format", "unix_nano")
+	params.Set("_inttotime", "true")
+	params.Add("_pragma", "busy_timeout(5000)")
+	if path != SQLiteMemory {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// An in-memory database lives as long as its connection
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	return db, nil
+}
+
+// SQLiteAdapter stores orders in SQLite, for local development and CI
+// without a MySQL server. It runs the MySQL adapter's queries, so both
+// behave the same.
+type SQLiteAdapter struct {
+	*MySQLAdapter
+}
+
+// NewSQLiteAdapter uses a database opened with OpenSQLite.
+func NewSQLiteAdapter(db *sql.DB, opts ...MySQLOption) *SQLiteAdapter {
+	m := &MySQLAdapter{
+		db: db, ignoreDuplicate: "ON CONFLICT DO NOTHING",
+		updateView: "ON CONFLICT (order_id, line) DO UPDATE SET status = excluded.status, expires_at = excluded.expires_at, updated_at = excluded.updated_at",
+		statements: newStatements(db),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return &SQLiteAdapter{MySQLAdapter: m}
+}
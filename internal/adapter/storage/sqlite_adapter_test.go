@@ -0,0 +1,642 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func newSQLiteAdapter(t *testing.T, opts ...MySQLOption) *SQLiteAdapter {
+	t.Helper()
+	db, err := OpenSQLite(context.Background(), SQLiteMemory)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSQLiteAdapter(db, opts...)
+}
+
+func TestSQLite_OrdersAndInventory(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now()
+
+	created, err := adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 5, CreatedAt: now, UpdatedAt: now})
+	if err != nil || !created {
+		t.Fatalf("expected item created, got %v, %v", created, err)
+	}
+	if created, _ := adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Again", CreatedAt: now, UpdatedAt: now}); created {
+		t.Error("expected duplicate item to be rejected")
+	}
+
+	order := domain.Order{ID: "order-1", ItemID: "item-1", UserID: "user-1", Quantity: 3, Status: domain.OrderStatusPending,
+		ExpiresAt: now.Add(time.Minute), CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tooMany := order
+	tooMany.ID = "order-2"
+	if err := adapter.CreateOrder(ctx, tooMany); !errors.Is(err, ErrOptimisticLock) {
+		t.Errorf("expected optimistic lock error, got %v", err)
+	}
+
+	got, err := adapter.GetOrder(ctx, "order-1")
+	if err != nil || got == nil {
+		t.Fatalf("expected order, got %v, %v", got, err)
+	}
+	if !got.ExpiresAt.Equal(order.ExpiresAt) {
+		t.Errorf("expected expiry %v, got %v", order.ExpiresAt, got.ExpiresAt)
+	}
+
+	// Expiry is compared as a time, not as text
+	expired, err := adapter.ExpiredOrders(ctx, now.Add(2*time.Minute).In(time.FixedZone("east", 9*3600)), 10)
+	if err != nil || len(expired) != 1 {
+		t.Fatalf("expected 1 expired order, got %v, %v", expired, err)
+	}
+	if expired, _ := adapter.ExpiredOrders(ctx, now, 10); len(expired) != 0 {
+		t.Errorf("expected no expired orders, got %d", len(expired))
+	}
+
+	// Cancelling returns the units
+	if ok, err := adapter.UpdateOrderStatus(ctx, "order-1", domain.OrderStatusPending, domain.OrderStatusCancelled); err != nil || !ok {
+		t.Fatalf("expected cancel, got %v, %v", ok, err)
+	}
+	inv, err := adapter.GetInventory(ctx, "item-1")
+	if err != nil || inv.Quantity != 5 || inv.Version != 2 {
+		t.Errorf("unexpected inventory: %+v, %v", inv, err)
+	}
+}
+
+func TestSQLite_ItemCatalog(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now()
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", TenantID: "acme", Name: "Item", Stock: 5, Price: 1999, Currency: "EUR", MaxPerUser: 2, CreatedAt: now, UpdatedAt: now})
+	item, err := adapter.GetItem(ctx, "item-1")
+	if err != nil || item == nil {
+		t.Fatalf("expected item, got %v, %v", item, err)
+	}
+	if item.TenantID != "acme" || item.Price != 1999 || item.Currency != "EUR" || item.MaxPerUser != 2 || item.Stock != 5 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	item.Price = 2499
+	if ok, err := adapter.UpdateItem(ctx, *item); err != nil || !ok {
+		t.Fatalf("expected update, got %v, %v", ok, err)
+	}
+
+	// The order keeps the price it was placed at
+	order := domain.Order{ID: "order-1", ItemID: "item-1", UserID: "user-1", Quantity: 2, Status: domain.OrderStatusPending,
+		UnitPrice: 1999, TotalPrice: 3998, Currency: "EUR", CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items, _ := adapter.ListItems(ctx)
+	got, _ := adapter.GetOrder(ctx, "order-1")
+	if len(items) != 1 || items[0].Price != 2499 || items[0].TenantID != "acme" {
+		t.Errorf("expected the updated price, got %+v", items)
+	}
+	if got.UnitPrice != 1999 || got.TotalPrice != 3998 || got.Currency != "EUR" {
+		t.Errorf("unexpected order price: %d/%d %s", got.UnitPrice, got.TotalPrice, got.Currency)
+	}
+}
+
+func TestSQLite_Coupons(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().Truncate(time.Second)
+
+	coupon := domain.Coupon{Code: "TEN", PercentOff: 10, MaxUses: 5, StartsAt: now, EndsAt: now.Add(time.Hour), CreatedAt: now, UpdatedAt: now}
+	if created, err := adapter.CreateCoupon(ctx, coupon); err != nil || !created {
+		t.Fatalf("expected coupon created, got %v, %v", created, err)
+	}
+	if created, _ := adapter.CreateCoupon(ctx, coupon); created {
+		t.Error("expected duplicate coupon to be rejected")
+	}
+
+	coupon.MaxUses = 10
+	if ok, err := adapter.UpdateCoupon(ctx, coupon); err != nil || !ok {
+		t.Fatalf("expected update, got %v, %v", ok, err)
+	}
+	if ok, _ := adapter.UpdateCoupon(ctx, domain.Coupon{Code: "NOPE"}); ok {
+		t.Error("expected update of a missing coupon to report false")
+	}
+	got, err := adapter.GetCoupon(ctx, "TEN")
+	if err != nil || got == nil || got.MaxUses != 10 || got.PercentOff != 10 || !got.EndsAt.Equal(coupon.EndsAt) {
+		t.Fatalf("unexpected coupon: %+v, %v", got, err)
+	}
+	if coupons, _ := adapter.ListCoupons(ctx); len(coupons) != 1 {
+		t.Errorf("expected 1 coupon, got %d", len(coupons))
+	}
+
+	// Orders record the coupon and its discount
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 5, CreatedAt: now, UpdatedAt: now})
+	order := domain.Order{ID: "order-1", ItemID: "item-1", UserID: "user-1", Quantity: 1, Status: domain.OrderStatusPending,
+		UnitPrice: 1000, TotalPrice: 900, CouponCode: "TEN", Discount: 100, CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := adapter.GetOrder(ctx, "order-1"); got.CouponCode != "TEN" || got.Discount != 100 || got.TotalPrice != 900 {
+		t.Errorf("unexpected order: %+v", got)
+	}
+}
+
+func TestSQLite_OrderRisk(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 5, CreatedAt: now, UpdatedAt: now})
+	order := domain.Order{ID: "order-1", ItemID: "item-1", UserID: "user-1", Quantity: 1, Status: domain.OrderStatusPending,
+		RiskScore: 60, RiskFlagged: true, CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := adapter.GetOrder(ctx, "order-1"); got.RiskScore != 60 || !got.RiskFlagged {
+		t.Errorf("expected the risk score to be recorded, got %+v", got)
+	}
+}
+
+func TestSQLite_ListOrdersByUser(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	base := time.Now().UTC().Truncate(time.Second)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: base, UpdatedAt: base})
+	orders := []domain.Order{
+		{ID: "a", UserID: "user-1", Status: domain.OrderStatusConfirmed, CreatedAt: base},
+		{ID: "b", UserID: "user-1", Status: domain.OrderStatusPending, CreatedAt: base.Add(time.Minute)},
+		{ID: "c", UserID: "user-1", Status: domain.OrderStatusConfirmed, CreatedAt: base.Add(time.Minute)},
+		{ID: "d", UserID: "user-1", Status: domain.OrderStatusCancelled, CreatedAt: base.Add(2 * time.Minute)},
+		{ID: "e", UserID: "user-2", Status: domain.OrderStatusConfirmed, CreatedAt: base.Add(time.Minute)},
+	}
+	for _, order := range orders {
+		order.ItemID, order.Quantity, order.UpdatedAt = "item-1", 1, order.CreatedAt
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+
+	ids := func(filter domain.OrderFilter) string {
+		t.Helper()
+		got, err := adapter.ListOrdersByUser(ctx, "user-1", filter)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var ids string
+		for _, order := range got {
+			ids += order.ID
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.OrderFilter
+		want   string
+	}{
+		{"all", domain.OrderFilter{Limit: 10}, "dcba"},
+		{"limit", domain.OrderFilter{Limit: 2}, "dc"},
+		{"after cursor", domain.OrderFilter{Limit: 2, After: &domain.OrderCursor{CreatedAt: base.Add(time.Minute), ID: "c"}}, "ba"},
+		{"status", domain.OrderFilter{Status: domain.OrderStatusConfirmed, Limit: 10}, "ca"},
+		{"range", domain.OrderFilter{From: base.Add(time.Minute), To: base.Add(2 * time.Minute), Limit: 10}, "cb"},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.filter); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSQLite_ListOrdersAfter(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	adapter.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	orders := []domain.Order{
+		{ID: "a", ItemID: "item-1", Quantity: 1},
+		{ID: "b", ItemID: "item-2", Quantity: 1},
+		{ID: "c", ItemID: "item-2", Quantity: 2, Items: []domain.OrderItem{{ItemID: "item-2", Quantity: 1}, {ItemID: "item-1", Quantity: 1}}},
+		{ID: "d", ItemID: "item-1", Quantity: 1, CreatedAt: now.Add(time.Hour)},
+	}
+	for _, order := range orders {
+		if order.CreatedAt.IsZero() {
+			order.CreatedAt = now
+		}
+		order.UserID, order.Status, order.UpdatedAt = "user-1", domain.OrderStatusConfirmed, now
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		window domain.OrderWindow
+		after  string
+		limit  int
+		want   string
+	}{
+		{"all", domain.OrderWindow{}, "", 10, "abcd"},
+		{"page", domain.OrderWindow{}, "a", 2, "bc"},
+		{"item", domain.OrderWindow{ItemID: "item-1"}, "", 10, "acd"},
+		{"item after", domain.OrderWindow{ItemID: "item-1"}, "c", 10, "d"},
+		{"from", domain.OrderWindow{From: now.Add(time.Minute)}, "", 10, "d"},
+		{"to", domain.OrderWindow{ItemID: "item-1", To: now.Add(time.Minute)}, "", 10, "ac"},
+	}
+	for _, tt := range tests {
+		got, err := adapter.ListOrdersAfter(ctx, tt.window, tt.after, tt.limit)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		var ids string
+		for _, order := range got {
+			ids += order.ID
+		}
+		if ids != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, ids)
+		}
+	}
+}
+
+func TestSQLite_MultiLineOrder(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now()
+
+	for _, id := range []string{"item-1", "item-2"} {
+		if _, err := adapter.CreateItem(ctx, domain.Item{ID: id, Name: id, Stock: 5, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+
+	lines := []domain.OrderItem{
+		{ItemID: "item-1", Quantity: 2, UnitPrice: 100, TotalPrice: 200},
+		{ItemID: "item-2", Quantity: 3, UnitPrice: 50, TotalPrice: 150},
+	}
+	order := domain.Order{ID: "order-1", ItemID: "item-1", UserID: "user-1", Quantity: 5, TotalPrice: 350, Items: lines,
+		Status: domain.OrderStatusPending, CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A line that cannot be filled rolls back the whole order
+	tooMany := order
+	tooMany.ID = "order-2"
+	tooMany.Items = []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 3}}
+	if err := adapter.CreateOrder(ctx, tooMany); !errors.Is(err, ErrOptimisticLock) {
+		t.Errorf("expected optimistic lock error, got %v", err)
+	}
+	if inv, _ := adapter.GetInventory(ctx, "item-1"); inv.Quantity != 3 {
+		t.Errorf("expected item-1 at 3 after rollback, got %d", inv.Quantity)
+	}
+
+	got, err := adapter.GetOrder(ctx, "order-1")
+	if err != nil || got == nil {
+		t.Fatalf("expected order, got %v, %v", got, err)
+	}
+	if len(got.Items) != 2 || got.Items[1] != lines[1] {
+		t.Errorf("expected lines %v, got %v", lines, got.Items)
+	}
+
+	// Cancelling returns the units of every line
+	if ok, err := adapter.UpdateOrderStatus(ctx, "order-1", domain.OrderStatusPending, domain.OrderStatusCancelled); err != nil || !ok {
+		t.Fatalf("expected cancel, got %v, %v", ok, err)
+	}
+	for _, id := range []string{"item-1", "item-2"} {
+		if inv, _ := adapter.GetInventory(ctx, id); inv.Quantity != 5 {
+			t.Errorf("expected %s back at 5, got %d", id, inv.Quantity)
+		}
+	}
+}
+
+func TestSQLite_AllocationFulfilled(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now()
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	alloc := domain.Allocation{ID: "alloc-1", PartnerID: "p", ItemID: "item-1", Quantity: 2, Status: domain.AllocationStatusOpen, CreatedAt: now, UpdatedAt: now}
+	if err := adapter.CreateAllocation(ctx, alloc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, id := range []string{"a", "b"} {
+		order := domain.Order{ID: id, ItemID: "item-1", UserID: "u", Quantity: 1, Status: domain.OrderStatusPending, AllocationID: "alloc-1", CreatedAt: now, UpdatedAt: now}
+		if err := adapter.FulfillAllocation(ctx, order); err != nil {
+			t.Fatalf("fulfill %d: %v", i, err)
+		}
+		got, _ := adapter.GetAllocation(ctx, "alloc-1")
+		want := domain.AllocationStatusOpen
+		if i == 1 {
+			want = domain.AllocationStatusFulfilled
+		}
+		if got.Fulfilled != i+1 || got.Status != want {
+			t.Errorf("after %d orders: unexpected allocation %+v", i+1, got)
+		}
+	}
+
+	// Cancelling an allocation order frees its unit without touching inventory
+	adapter.UpdateOrderStatus(ctx, "a", domain.OrderStatusPending, domain.OrderStatusCancelled)
+	got, _ := adapter.GetAllocation(ctx, "alloc-1")
+	inv, _ := adapter.GetInventory(ctx, "item-1")
+	if got.Fulfilled != 1 || got.Status != domain.AllocationStatusOpen || inv.Quantity != 8 {
+		t.Errorf("unexpected allocation %+v and stock %d", got, inv.Quantity)
+	}
+}
+
+func TestSQLite_RefundCreatedOnce(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now()
+
+	refund := domain.Refund{ID: "r1", OrderID: "order-1", Step: domain.RefundStepPayment, CreatedAt: now, UpdatedAt: now}
+	if created, err := adapter.CreateRefund(ctx, refund); err != nil || !created {
+		t.Fatalf("expected refund created, got %v, %v", created, err)
+	}
+	refund.ID = "r2"
+	if created, err := adapter.CreateRefund(ctx, refund); err != nil || created {
+		t.Errorf("expected second refund for the order to be rejected, got %v, %v", created, err)
+	}
+}
+
+func TestSQLite_AuditLog(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	records := []domain.AuditRecord{
+		{Actor: "ops", Action: domain.AuditRestock, Target: "item-1", Before: `{"stock":0}`, After: `{"stock":5}`, Reason: "restock"},
+		{Actor: "ops", Action: domain.AuditUserBan, Target: "user-1", After: `{"user_id":"user-1","banned":true}`},
+		{Actor: "lead", Action: domain.AuditRestock, Target: "item-1", Before: `{"stock":5}`, After: `{"stock":9}`},
+	}
+	for i, record := range records {
+		record.CreatedAt = now
+		saved, err := adapter.AppendAudit(ctx, record)
+		if err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+		if saved.ID != int64(i+1) {
+			t.Errorf("expected ID %d, got %d", i+1, saved.ID)
+		}
+	}
+
+	got, err := adapter.ListAudit(ctx, domain.AuditFilter{Target: "item-1", Limit: 10})
+	if err != nil || len(got) != 2 || got[0].Actor != "lead" || got[1].Before != `{"stock":0}` || got[1].Reason != "restock" || !got[1].CreatedAt.Equal(now) {
+		t.Fatalf("unexpected records for item-1: %+v, %v", got, err)
+	}
+	got, _ = adapter.ListAudit(ctx, domain.AuditFilter{Actor: "ops", BeforeID: 2, Limit: 10})
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("expected ops' first record, got %+v", got)
+	}
+	got, _ = adapter.ListAudit(ctx, domain.AuditFilter{Action: domain.AuditUserBan, Limit: 10})
+	if len(got) != 1 || got[0].Before != "" {
+		t.Errorf("expected the ban with no before state, got %+v", got)
+	}
+
+	if _, err := adapter.db.ExecContext(ctx, `UPDATE audit_log SET actor = 'someone else'`); err == nil {
+		t.Error("expected audit records to refuse updates")
+	}
+	if _, err := adapter.db.ExecContext(ctx, `DELETE FROM audit_log`); err == nil {
+		t.Error("expected audit records to refuse deletes")
+	}
+}
+
+func TestSQLite_ArchiveOrders(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	old := now.Add(-48 * time.Hour)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	adapter.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	orders := []domain.Order{
+		{ID: "old-1", Status: domain.OrderStatusConfirmed, CreatedAt: old, ItemID: "item-1", Quantity: 2,
+			Items: []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 1}}},
+		{ID: "old-2", Status: domain.OrderStatusPending, CreatedAt: old.Add(time.Second)},
+		{ID: "old-held", Status: domain.OrderStatusPending, CreatedAt: old, ExpiresAt: now.Add(time.Minute)},
+		{ID: "old-3", Status: domain.OrderStatusCancelled, CreatedAt: old.Add(2 * time.Second)},
+		{ID: "new", Status: domain.OrderStatusConfirmed, CreatedAt: now},
+	}
+	for _, order := range orders {
+		order.UserID, order.UpdatedAt = "user-1", order.CreatedAt
+		if order.ItemID == "" {
+			order.ItemID, order.Quantity = "item-1", 1
+		}
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+	adapter.ProjectOrders(ctx, []string{"old-1", "old-2", "old-held", "old-3", "new"})
+
+	cutoff := now.Add(-24 * time.Hour)
+	if n, err := adapter.ArchiveOrders(ctx, cutoff, 2); err != nil || n != 2 {
+		t.Fatalf("expected the 2 oldest orders archived, got %d, %v", n, err)
+	}
+	if n, err := adapter.ArchiveOrders(ctx, cutoff, 2); err != nil || n != 1 {
+		t.Fatalf("expected the last old order archived, got %d, %v", n, err)
+	}
+	if n, _ := adapter.ArchiveOrders(ctx, cutoff, 2); n != 0 {
+		t.Errorf("expected nothing left to archive, got %d", n)
+	}
+
+	for _, id := range []string{"old-1", "old-2", "old-3"} {
+		if order, _ := adapter.GetOrder(ctx, id); order != nil {
+			t.Errorf("expected %s gone from orders", id)
+		}
+	}
+	for _, id := range []string{"old-held", "new"} {
+		if order, _ := adapter.GetOrder(ctx, id); order == nil {
+			t.Errorf("expected %s kept in orders", id)
+		}
+	}
+
+	var archived, lines, hotLines, views int
+	adapter.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders_archive`).Scan(&archived)
+	adapter.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items_archive WHERE order_id = 'old-1'`).Scan(&lines)
+	adapter.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE order_id LIKE 'old-%' AND order_id <> 'old-held'`).Scan(&hotLines)
+	adapter.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_views`).Scan(&views)
+	if archived != 3 || lines != 2 || hotLines != 0 {
+		t.Errorf("expected 3 archived orders with old-1's 2 lines moved, got %d orders, %d lines, %d left", archived, lines, hotLines)
+	}
+	if views != 2 {
+		t.Errorf("expected only the views of the kept orders left, got %d", views)
+	}
+}
+
+func TestSQLite_OffloadOrders(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	old := now.Add(-48 * time.Hour)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	adapter.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	orders := []domain.Order{
+		{ID: "old-1", ItemID: "item-1", Quantity: 2, CreatedAt: old,
+			Items: []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 1}}},
+		{ID: "old-2", ItemID: "item-1", Quantity: 1, CreatedAt: old.Add(time.Second)},
+		{ID: "new", ItemID: "item-1", Quantity: 1, CreatedAt: now},
+	}
+	for _, order := range orders {
+		order.UserID, order.Status, order.UpdatedAt = "user-1", domain.OrderStatusConfirmed, order.CreatedAt
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+	cutoff := now.Add(-24 * time.Hour)
+
+	errKeep := errors.New("bucket unavailable")
+	if _, err := adapter.OffloadOrders(ctx, cutoff, 10, func([]domain.Order) error { return errKeep }); !errors.Is(err, errKeep) {
+		t.Fatalf("expected the keep error, got %v", err)
+	}
+	if order, _ := adapter.GetOrder(ctx, "old-1"); order == nil {
+		t.Fatal("expected orders kept when they could not be stored")
+	}
+
+	var kept []domain.Order
+	n, err := adapter.OffloadOrders(ctx, cutoff, 10, func(batch []domain.Order) error {
+		kept = append(kept, batch...)
+		return nil
+	})
+	if err != nil || n != 2 || len(kept) != 2 {
+		t.Fatalf("expected the 2 old orders offloaded, got %d kept of %d, %v", len(kept), n, err)
+	}
+	if kept[0].ID != "old-1" || len(kept[0].Items) != 2 {
+		t.Errorf("expected old-1 first with its 2 lines, got %+v", kept[0])
+	}
+	for _, id := range []string{"old-1", "old-2"} {
+		if order, _ := adapter.GetOrder(ctx, id); order != nil {
+			t.Errorf("expected %s deleted", id)
+		}
+	}
+	var lines int
+	adapter.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE order_id = 'old-1'`).Scan(&lines)
+	if lines != 0 {
+		t.Errorf("expected old-1's lines deleted, got %d", lines)
+	}
+}
+
+func TestSQLite_OrderViews(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	adapter.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	lines := []domain.OrderItem{{ItemID: "item-1", Quantity: 2, TotalPrice: 200}, {ItemID: "item-2", Quantity: 1, TotalPrice: 50}}
+	orders := []domain.Order{
+		{ID: "cart", ItemID: "item-1", Quantity: 3, TotalPrice: 250, Items: lines, CreatedAt: now},
+		{ID: "single", ItemID: "item-1", Quantity: 1, TotalPrice: 100, ExpiresAt: now.Add(time.Minute), CreatedAt: now.Add(time.Second)},
+	}
+	for _, order := range orders {
+		order.UserID, order.Status, order.UpdatedAt = "user-1", domain.OrderStatusPending, order.CreatedAt
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", order.ID, err)
+		}
+	}
+
+	if got, _ := adapter.ListOrderViews(ctx, "user-1", domain.OrderFilter{Limit: 10}); len(got) != 0 {
+		t.Errorf("expected no views before projecting, got %d", len(got))
+	}
+	if err := adapter.ProjectOrders(ctx, []string{"cart", "single", "missing"}); err != nil {
+		t.Fatalf("project: %v", err)
+	}
+	// Projecting again takes the order's new status
+	adapter.ConfirmOrder(ctx, "cart", "payment-1")
+	if err := adapter.ProjectOrders(ctx, []string{"cart"}); err != nil {
+		t.Fatalf("project again: %v", err)
+	}
+
+	got, err := adapter.ListOrderViews(ctx, "user-1", domain.OrderFilter{Limit: 10})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("expected 2 orders, got %v, %v", got, err)
+	}
+	if got[0].ID != "single" || got[0].Items != nil || !got[0].ExpiresAt.Equal(orders[1].ExpiresAt) {
+		t.Errorf("unexpected single order view %+v", got[0])
+	}
+	if got[1].ID != "cart" || got[1].Status != domain.OrderStatusConfirmed || got[1].Quantity != 3 || got[1].TotalPrice != 250 ||
+		len(got[1].Items) != 2 || got[1].Items[1].ItemID != "item-2" {
+		t.Errorf("unexpected cart view %+v", got[1])
+	}
+	if got, _ := adapter.ListOrderViews(ctx, "user-1", domain.OrderFilter{Status: domain.OrderStatusPending, Limit: 10}); len(got) != 1 {
+		t.Errorf("expected 1 pending order, got %d", len(got))
+	}
+
+	totals, err := adapter.ItemOrderTotals(ctx, []string{"item-1", "item-3"})
+	want := []domain.ItemOrderTotals{
+		{ItemID: "item-1", Status: domain.OrderStatusConfirmed, Orders: 1, Units: 2, Revenue: 200},
+		{ItemID: "item-1", Status: domain.OrderStatusPending, Orders: 1, Units: 1, Revenue: 100},
+	}
+	if err != nil || len(totals) != 2 || totals[0] != want[0] || totals[1] != want[1] {
+		t.Errorf("expected totals %v, got %v, %v", want, totals, err)
+	}
+}
+
+func TestSQLite_OrderChanges(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t, WithOrderChanges())
+	now := time.Now().UTC().Truncate(time.Second)
+
+	adapter.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Item", Stock: 10, CreatedAt: now, UpdatedAt: now})
+	for _, id := range []string{"order-1", "order-2"} {
+		order := domain.Order{ID: id, ItemID: "item-1", UserID: "user-1", Quantity: 1, Status: domain.OrderStatusPending,
+			TotalPrice: 100, Currency: "USD", ExpiresAt: now.Add(time.Minute), CreatedAt: now, UpdatedAt: now}
+		if err := adapter.CreateOrder(ctx, order); err != nil {
+			t.Fatalf("create %s: %v", id, err)
+		}
+	}
+	if ok, err := adapter.ConfirmOrder(ctx, "order-1", "pay-1"); err != nil || !ok {
+		t.Fatalf("expected order-1 confirmed, got %v, %v", ok, err)
+	}
+	if ok, err := adapter.UpdateOrderStatus(ctx, "order-2", domain.OrderStatusPending, domain.OrderStatusCancelled); err != nil || !ok {
+		t.Fatalf("expected order-2 cancelled, got %v, %v", ok, err)
+	}
+	// A change that is refused is not recorded
+	if ok, _ := adapter.ConfirmOrder(ctx, "order-2", "pay-2"); ok {
+		t.Fatal("expected the cancelled order-2 not to be confirmed")
+	}
+
+	changes, err := adapter.OrderChanges(ctx, "order-1")
+	if err != nil || len(changes) != 3 {
+		t.Fatalf("expected 3 changes of order-1, got %+v, %v", changes, err)
+	}
+	if changes[0].Type != domain.OrderChangeAccepted || changes[0].Order == nil || changes[0].Order.TotalPrice != 100 ||
+		changes[1].Type != domain.OrderChangePersisted || changes[2].Type != domain.OrderChangeConfirmed || changes[2].PaymentID != "pay-1" {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	order, err := adapter.GetOrder(ctx, "order-1")
+	if err != nil || order == nil || order.Status != domain.OrderStatusConfirmed || order.PaymentID != "pay-1" || !order.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expected order-1 derived as confirmed, got %+v, %v", order, err)
+	}
+	if order, _ := adapter.GetOrder(ctx, "order-2"); order == nil || order.Status != domain.OrderStatusCancelled {
+		t.Errorf("expected order-2 derived as cancelled, got %+v", order)
+	}
+
+	page, err := adapter.OrderChangesAfter(ctx, 2, 3)
+	if err != nil || len(page) != 3 || page[0].Seq != 3 || page[0].OrderID != "order-2" {
+		t.Errorf("expected the 3 changes after the second, got %+v, %v", page, err)
+	}
+
+	// An order saved before changes were kept is read from its row
+	adapter.db.ExecContext(ctx, `DELETE FROM order_changes WHERE order_id = 'order-2'`)
+	if order, _ := adapter.GetOrder(ctx, "order-2"); order == nil || order.Status != domain.OrderStatusCancelled {
+		t.Errorf("expected order-2 read from its row, got %+v", order)
+	}
+
+	if n, err := adapter.ArchiveOrders(ctx, now.Add(time.Hour), 10); err != nil || n != 2 {
+		t.Fatalf("expected both orders archived, got %d, %v", n, err)
+	}
+	if order, _ := adapter.GetOrder(ctx, "order-1"); order != nil {
+		t.Errorf("expected the archived order-1 gone, got %+v", order)
+	}
+	if changes, _ := adapter.OrderChanges(ctx, "order-1"); len(changes) != 4 || changes[3].Type != domain.OrderChangeArchived {
+		t.Errorf("expected the archive recorded, got %+v", changes)
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/rl1809/flash-sale/internal/adapter/storage")
+
+func startSpan(ctx context.Context, system, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, system+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", system),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// endSpan records *err, if any, and ends the span. Use with named results:
+// defer endSpan(span, &err).
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
@@ -0,0 +1,1333 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// Rate limit stores
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// Database drivers
+const (
+	DatabaseDriverMySQL  = "mysql"
+	DatabaseDriverSQLite = "sqlite"
+)
+
+// OpenAPI validation modes
+const (
+	OpenAPIValidationOff       = "off"
+	OpenAPIValidationRequests  = "requests"
+	OpenAPIValidationResponses = "responses"
+)
+
+// Order stores
+const (
+	OrderStoreCRUD   = "crud"
+	OrderStoreEvents = "events"
+)
+
+// Sale modes
+const (
+	SaleModeFirstCome = "fcfs"
+	SaleModeLottery   = "lottery"
+)
+
+// What to do when the startup stock check finds the cache holding more
+// than the database allows
+const (
+	StockCheckOff     = "off"
+	StockCheckWarn    = "warn"
+	StockCheckCorrect = "correct"
+	StockCheckRefuse  = "refuse"
+)
+
+// Order archive targets
+const (
+	OrderArchiveTables = "tables"
+	OrderArchiveBlob   = "blob"
+)
+
+// Order partitioning
+const (
+	OrderPartitionsOff   = "off"
+	OrderPartitionsDay   = "day"
+	OrderPartitionsMonth = "month"
+)
+
+// Payment gateways
+const (
+	PaymentGatewayNone = "none"
+	PaymentGatewayMock = "mock"
+)
+
+// Notifiers
+const (
+	NotifierNone = "none"
+	NotifierLog  = "log"
+	NotifierSMTP = "smtp"
+)
+
+// Analytics sinks
+const (
+	AnalyticsSinkNone       = "none"
+	AnalyticsSinkLog        = "log"
+	AnalyticsSinkClickHouse = "clickhouse"
+)
+
+type Config struct {
+	HTTPPort string
+	GRPCPort string
+	// HTTP server limits that stop slow or idle clients from holding
+	// connections open. HTTPMaxConnections caps concurrent connections,
+	// 0 for no cap.
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+	HTTPMaxConnections    int
+
+	MySQLDSN string
+	// MySQLReplicaDSN, if set, sends reads that may lag behind writes to
+	// this read-only replica, checked every MySQLReplicaCheckInterval and
+	// skipped for the primary while it does not answer.
+	MySQLReplicaDSN           string
+	MySQLReplicaCheckInterval time.Duration
+	// MySQLShardDSNs, if set, spreads items with their inventory and orders
+	// over these databases and MySQLDSN's by hash of the item ID. Each
+	// shard is pinged every MySQLShardCheckInterval and its work fails fast
+	// while it does not answer.
+	MySQLShardDSNs          []string
+	MySQLShardCheckInterval time.Duration
+	// PreparedStatements prepares the order writes once per connection;
+	// turn it off behind proxies that do not support prepared statements.
+	PreparedStatements bool
+	// DatabaseDriver selects where orders are stored: "mysql", or "sqlite"
+	// for local development and CI, using the database file at SQLitePath.
+	DatabaseDriver string
+	SQLitePath     string
+	// OrderStore is "crud" to keep each order as a row updated in place, or
+	// "events" to also append every change to an order to a change log the
+	// order's state is derived from, for auditing and replaying a sale.
+	OrderStore string
+	// MigrateOnStart applies pending MySQL migrations before serving.
+	MigrateOnStart bool
+	RedisAddr      string
+	WorkerCount    int
+	// RedisClusterAddrs connects to Redis Cluster through these seed nodes
+	// instead of RedisAddr.
+	RedisClusterAddrs []string
+	// RedisSentinelMaster connects through the sentinels in
+	// RedisSentinelAddrs to the master of that name instead of RedisAddr.
+	RedisSentinelMaster   string
+	RedisSentinelAddrs    []string
+	RedisSentinelPassword string
+	// RedisFailoverTimeout is how long Redis commands keep retrying through
+	// a failover before failing.
+	RedisFailoverTimeout time.Duration
+	// RedisRetryAttempts is how many times the purchase path's Redis calls
+	// are tried when they fail with a transient error, backing off by up to
+	// RedisRetryBackoff with jitter before the first retry.
+	RedisRetryAttempts int
+	RedisRetryBackoff  time.Duration
+	// StockShards splits each item's Redis stock counter into this many
+	// keys, spreading a hot item over several cluster slots.
+	StockShards int
+	// StockLeaseSize makes each server lease stock from Redis in batches of
+	// this many units and sell them from memory; 0 disables leasing. Leases
+	// not renewed within StockLeaseTTL are returned to the stock counter.
+	StockLeaseSize int
+	StockLeaseTTL  time.Duration
+	// Region is the region this server sells in. With RegionStockShares
+	// set, each item's stock is split between the regions by their shares,
+	// e.g. us:60,eu:40, and each region sells from its own Redis.
+	// RegionRedisAddrs has the Redis of every other region, which admin
+	// calls write to when they create, restock or rebalance items.
+	Region            string
+	RegionStockShares map[string]int
+	RegionRedisAddrs  map[string]string
+	QueueSize         int
+	// PartitionByItem gives each worker its own queue partition and routes
+	// an item's orders to one of them, serializing its inventory writes.
+	PartitionByItem bool
+
+	// PurchaseWorkers bounds concurrent purchases; 0 runs them on the
+	// request goroutine. PurchaseBacklog is how many may wait for a worker.
+	PurchaseWorkers int
+	PurchaseBacklog int
+	// LoadShedThreshold is the fraction of the order queue at which
+	// purchases are turned away with 503; 0 disables shedding.
+	LoadShedThreshold float64
+	// ConcurrencyLimits bounds the purchases in flight by a limit that
+	// follows their latency; purchases are unlimited when Initial is 0.
+	ConcurrencyLimits service.ConcurrencyLimits
+	// EnqueueTimeout is how long a purchase waits for room in a full order
+	// queue before failing with 503 and giving its stock back.
+	EnqueueTimeout time.Duration
+	// StageTimeouts bounds the idempotency and stock decrement calls of a
+	// purchase and the workers' order writes.
+	StageTimeouts service.StageTimeouts
+
+	// HoldTTL makes purchases two-phase: orders hold their stock for this
+	// long and are cancelled unless confirmed. 0 keeps orders pending until
+	// the payment outcome arrives. HoldSweepInterval is how often expired
+	// holds are released.
+	HoldTTL           time.Duration
+	HoldSweepInterval time.Duration
+	// PaymentGateway charges orders when they are confirmed: "none" trusts
+	// the client to have paid, "mock" uses an in-memory gateway.
+	PaymentGateway string
+	// RebuyAfterCancel lets users purchase an item again after cancelling
+	// their order for it, by releasing the purchase's idempotency key and
+	// per-user limit units.
+	RebuyAfterCancel bool
+
+	// CompensationInterval is how often failed stock returns are retried.
+	CompensationInterval time.Duration
+	// RefundRetryInterval is how long a refund may stall before another
+	// attempt resumes it.
+	RefundRetryInterval time.Duration
+
+	// ExportBatchSize is how many orders an export reads from the database
+	// at a time, and ExportRowsPerSecond how fast each export may send them;
+	// 0 does not limit the rate.
+	ExportBatchSize     int
+	ExportRowsPerSecond int
+
+	// OrderRetentionDays is how long orders stay in the orders table before
+	// they are moved to the archive tables; 0 keeps them there. The archive
+	// job runs every OrderArchiveInterval and moves OrderArchiveBatchSize
+	// orders per transaction.
+	OrderRetentionDays    int
+	OrderArchiveInterval  time.Duration
+	OrderArchiveBatchSize int
+
+	// OrderArchiveTarget is where archived orders go: the archive "tables"
+	// or, with "blob", gzipped NDJSON batches in the S3 bucket
+	// ArchiveS3Bucket at ArchiveS3Endpoint, under ArchiveS3Prefix.
+	OrderArchiveTarget string
+	ArchiveS3Endpoint  string
+	ArchiveS3Region    string
+	ArchiveS3Bucket    string
+	ArchiveS3Prefix    string
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+	ArchiveS3Timeout   time.Duration
+
+	// OrderPartitions keeps the orders table partitioned by "day" or
+	// "month" of creation, or leaves it to the operator with "off". Every
+	// OrderPartitionInterval a job adds partitions for OrderPartitionsAhead
+	// periods past the current one and drops those emptied by archiving.
+	OrderPartitions        string
+	OrderPartitionsAhead   int
+	OrderPartitionInterval time.Duration
+
+	// JobJitter delays each run of the background jobs by up to this
+	// fraction of the job's interval, so servers spread their runs.
+	JobJitter float64
+
+	// Notifier tells buyers their order was saved, and when their hold
+	// expires: "none", "log" to the server log, or "smtp" by email. Up to
+	// NotifyQueueSize notifications wait to be sent, each tried
+	// NotifyAttempts times with a delay doubling from NotifyRetryBackoff.
+	Notifier           string
+	NotifyQueueSize    int
+	NotifyAttempts     int
+	NotifyRetryBackoff time.Duration
+	// SMTP server the smtp notifier sends through. SMTPTo is the recipient
+	// address with {user} standing for the user ID.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       string
+
+	// AnalyticsSink receives every purchase attempt and its outcome for
+	// analysis after the sale: "none", "log" to the server log, or
+	// "clickhouse" into ClickHouseTable at ClickHouseURL. Up to
+	// AnalyticsQueueSize outcomes wait to be written, AnalyticsBatchSize at
+	// a time or whatever has queued every AnalyticsFlushInterval.
+	AnalyticsSink          string
+	AnalyticsQueueSize     int
+	AnalyticsBatchSize     int
+	AnalyticsFlushInterval time.Duration
+	ClickHouseURL          string
+	ClickHouseTable        string
+	ClickHouseUser         string
+	ClickHousePassword     string
+	ClickHouseTimeout      time.Duration
+
+	// AsyncPurchases answers purchases with 202 Accepted and lets clients
+	// poll for the outcome.
+	AsyncPurchases bool
+
+	// SoldOutBroadcast tells every server when an item sells out, so they
+	// turn away purchases of it without asking Redis.
+	SoldOutBroadcast bool
+
+	// DegradedPurchases writes purchases straight to the database, at most
+	// DegradedPurchaseRate per second per server, while Redis is down.
+	// CacheBreakerThreshold consecutive Redis failures count it as down for
+	// CacheBreakerCooldown, after which one purchase probes it again.
+	DegradedPurchases     bool
+	DegradedPurchaseRate  int
+	CacheBreakerThreshold int
+	CacheBreakerCooldown  time.Duration
+
+	// StockHintCacheTTL and CampaignCacheTTL are how long each server keeps
+	// stock hints and campaigns it has read. Concurrent reads of the same
+	// key share one call even when the TTL is zero.
+	StockHintCacheTTL time.Duration
+	CampaignCacheTTL  time.Duration
+
+	// SaleMode is "fcfs" to sell first come, first served, or "lottery" to
+	// collect purchases as entries until LotteryClosesAt and then draw them.
+	SaleMode        string
+	LotteryClosesAt time.Time
+
+	// VIPPriority has workers persist the orders of VIP users before others.
+	// VIPReservedStock keeps units of an item that only VIP users may buy.
+	VIPPriority      bool
+	VIPReservedStock map[string]int
+
+	InitialStock int
+	ItemID       string
+
+	// StartupStockCheck compares the cache stock of the campaign's items
+	// with the database on startup and, if the cache holds more, logs it
+	// ("warn"), takes the excess off ("correct") or exits ("refuse").
+	StartupStockCheck string
+	CampaignID        string
+
+	// UserRateLimit is the sustained purchases per second allowed per user,
+	// with bursts up to UserRateBurst; 0 disables limiting. IPRateLimit and
+	// IPRateBurst do the same per client IP.
+	UserRateLimit float64
+	UserRateBurst int
+	IPRateLimit   float64
+	IPRateBurst   int
+	// RateLimitStore is where limits are counted: "memory" limits each server
+	// on its own, "redis" shares a sliding window across servers.
+	RateLimitStore string
+	// TrustForwardedFor takes client IPs from the X-Forwarded-For header set
+	// by a proxy in front of the server.
+	TrustForwardedFor bool
+
+	// BotCheckVerifyURL is the siteverify endpoint that purchases' CAPTCHA
+	// tokens are checked against with BotCheckSecret; empty disables the
+	// check. Clients in BotCheckTrusted skip it.
+	BotCheckVerifyURL string
+	BotCheckSecret    string
+	BotCheckTimeout   time.Duration
+	BotCheckTrusted   []netip.Prefix
+
+	// PurchaseTokenSecret signs the tokens purchases must present; empty
+	// disables them. Tokens are valid for PurchaseTokenTTL.
+	PurchaseTokenSecret string
+	PurchaseTokenTTL    time.Duration
+
+	// RiskIPVelocity and RiskDeviceVelocity are how many purchases a client
+	// IP or device may make per RiskVelocityWindow before they score as
+	// suspicious, and RiskNewAccountAge how long a user counts as new after
+	// their first purchase attempt; 0 turns a rule off. Purchases scoring
+	// RiskRejectScore or more are rejected and those scoring RiskFlagScore
+	// or more flagged.
+	RiskIPVelocity     int
+	RiskDeviceVelocity int
+	RiskVelocityWindow time.Duration
+	RiskNewAccountAge  time.Duration
+	RiskFlagScore      int
+	RiskRejectScore    int
+
+	// Pricing holds price tiers per item, in minor currency units. Items
+	// without tiers sell at their catalog price.
+	Pricing map[string]domain.PriceSchedule
+	// CatalogRefreshInterval is how often item prices and limits are
+	// reloaded from the database.
+	CatalogRefreshInterval time.Duration
+
+	// ItemFilter turns away purchases of item IDs not in a bloom filter of
+	// the database's items, rebuilt every CatalogRefreshInterval, without a
+	// call to Redis. ItemFilterFalsePositiveRate is the share of unknown IDs
+	// the filter lets through.
+	ItemFilter                  bool
+	ItemFilterFalsePositiveRate float64
+
+	// MaxQuantity caps the units one purchase may buy, 0 for no cap;
+	// ItemQuantityLimits overrides it per item.
+	MaxQuantity        int
+	ItemQuantityLimits map[string]int
+	// RequireUUIDRequestIDs rejects purchases whose request ID is not a UUID.
+	RequireUUIDRequestIDs bool
+	// MaxBodyBytes bounds HTTP request bodies.
+	MaxBodyBytes int
+	// OpenAPIValidation checks requests to the public API against its
+	// OpenAPI spec: "off", "requests" to reject those that do not match it,
+	// or "responses" to also log responses that do not.
+	OpenAPIValidation string
+
+	// CORSAllowedOrigins lists the browser origins that may call the HTTP
+	// API, "*" for any; CORS is off when empty.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// AccessLogSampleRate is the fraction of requests given an access log
+	// line; server errors are always logged. AccessLogMaxPerSecond caps the
+	// lines per second, 0 for no cap.
+	AccessLogSampleRate   float64
+	AccessLogMaxPerSecond int
+
+	// RedisSlowThreshold and MySQLSlowThreshold are how long a call to
+	// each may take before it is logged as slow, 0 to log none.
+	RedisSlowThreshold time.Duration
+	MySQLSlowThreshold time.Duration
+
+	// CompressionEncodings lists the response encodings offered, "gzip" and
+	// "zstd", in order of preference; responses are not compressed when it
+	// is empty. Only responses of at least CompressionMinBytes are.
+	CompressionEncodings []string
+	CompressionMinBytes  int
+
+	// PartnerAPIKeys maps partner API keys to partner IDs.
+	PartnerAPIKeys map[string]string
+	// AdminAPIKey grants the admin role on the /admin endpoints. Together with
+	// AdminAPIKeys and AdminJWTSecret it is how operators authenticate; the
+	// endpoints are disabled when none is set.
+	AdminAPIKey string
+	// AdminAPIKeys maps further API keys to the principal they authenticate.
+	AdminAPIKeys map[string]domain.Principal
+	// AdminJWTSecret enables HS256 bearer tokens carrying a roles claim,
+	// optionally restricted to tokens issued by AdminJWTIssuer.
+	AdminJWTSecret string
+	AdminJWTIssuer string
+
+	IdempotencyMode service.IdempotencyMode
+	IdempotencyTTL  time.Duration
+	// PurchaseRecordTTL is how long the outcome of each request is kept by
+	// request ID for status lookups and support.
+	PurchaseRecordTTL time.Duration
+
+	// KafkaBrokers enables the payment events consumer when set.
+	KafkaBrokers       []string
+	PaymentEventsTopic string
+	KafkaGroupID       string
+	// SaleEventsTopic is where order and stock events are published for
+	// consumers outside the server; they stay in process when empty.
+	SaleEventsTopic string
+
+	// DebugAddr is the address of the pprof/expvar listener; it is off when
+	// empty and should never be reachable from outside the cluster.
+	DebugAddr string
+
+	// OTLPEndpoint is the OTLP/gRPC collector address; tracing is off when empty.
+	OTLPEndpoint string
+
+	// Worker holds the initial worker settings; they can be changed at
+	// runtime through the admin API.
+	Worker service.WorkerSettings
+	// WorkerPool scales the workers between WORKER_COUNT and WORKER_MAX.
+	WorkerPool service.WorkerPoolSettings
+	// DBBreakerThreshold consecutive failed order writes stop the workers
+	// taking orders for DBBreakerCooldown, after which one write probes the
+	// database. 0 disables the breaker.
+	DBBreakerThreshold int
+	DBBreakerCooldown  time.Duration
+}
+
+// Load reads the configuration from environment variables, falling back to
+// defaults suitable for the local docker-compose setup.
+func Load() (*Config, error) {
+	cfg := &Config{
+		HTTPPort:              getString("HTTP_PORT", ":8080"),
+		GRPCPort:              getString("GRPC_PORT", ":50051"),
+		MySQLDSN:              getString("MYSQL_DSN", "root:root@tcp(localhost:3306)/flashsale?parseTime=true"),
+		MySQLReplicaDSN:       os.Getenv("MYSQL_REPLICA_DSN"),
+		MySQLShardDSNs:        parseList(os.Getenv("MYSQL_SHARD_DSNS")),
+		DatabaseDriver:        getString("DATABASE_DRIVER", DatabaseDriverMySQL),
+		SQLitePath:            getString("SQLITE_PATH", "flashsale.db"),
+		OrderStore:            getString("ORDER_STORE", OrderStoreCRUD),
+		OpenAPIValidation:     getString("OPENAPI_VALIDATION", OpenAPIValidationRequests),
+		RedisAddr:             getString("REDIS_ADDR", "localhost:6379"),
+		ItemID:                getString("ITEM_ID", "iphone-15"),
+		CampaignID:            getString("CAMPAIGN_ID", "default"),
+		Region:                os.Getenv("REGION"),
+		RegionRedisAddrs:      parsePairs(os.Getenv("REGION_REDIS_ADDRS")),
+		PartnerAPIKeys:        parsePairs(os.Getenv("PARTNER_API_KEYS")),
+		AdminAPIKey:           os.Getenv("ADMIN_API_KEY"),
+		AdminJWTSecret:        os.Getenv("ADMIN_JWT_SECRET"),
+		AdminJWTIssuer:        os.Getenv("ADMIN_JWT_ISSUER"),
+		DebugAddr:             os.Getenv("DEBUG_ADDR"),
+		RedisClusterAddrs:     parseList(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		RedisSentinelMaster:   os.Getenv("REDIS_SENTINEL_MASTER"),
+		RedisSentinelAddrs:    parseList(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		RedisSentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		KafkaBrokers:          parseList(os.Getenv("KAFKA_BROKERS")),
+		CORSAllowedOrigins:    parseList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		CompressionEncodings:  parseList(getString("COMPRESSION_ENCODINGS", "gzip")),
+		CORSAllowedMethods:    parseList(getString("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE")),
+		CORSAllowedHeaders:    parseList(getString("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,Idempotency-Key,X-Request-ID")),
+		PaymentEventsTopic:    getString("PAYMENT_EVENTS_TOPIC", "payment-events"),
+		KafkaGroupID:          getString("KAFKA_GROUP_ID", "flash-sale"),
+		SaleEventsTopic:       os.Getenv("SALE_EVENTS_TOPIC"),
+		OTLPEndpoint:          os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		RateLimitStore:        getString("RATE_LIMIT_STORE", RateLimitStoreMemory),
+		BotCheckVerifyURL:     os.Getenv("BOT_CHECK_VERIFY_URL"),
+		BotCheckSecret:        os.Getenv("BOT_CHECK_SECRET"),
+		PurchaseTokenSecret:   os.Getenv("PURCHASE_TOKEN_SECRET"),
+		PaymentGateway:        getString("PAYMENT_GATEWAY", PaymentGatewayNone),
+		Notifier:              getString("NOTIFIER", NotifierNone),
+		SMTPAddr:              os.Getenv("SMTP_ADDR"),
+		SMTPUsername:          os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:          os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:              os.Getenv("SMTP_FROM"),
+		SMTPTo:                getString("SMTP_TO", "{user}"),
+		SaleMode:              getString("SALE_MODE", SaleModeFirstCome),
+		StartupStockCheck:     getString("STARTUP_STOCK_CHECK", StockCheckWarn),
+		IdempotencyMode:       service.IdempotencyMode(getString("IDEMPOTENCY_MODE", string(service.IdempotencyPerRequest))),
+	}
+
+	var err error
+	if cfg.WorkerCount, err = getInt("WORKER_COUNT", 10); err != nil {
+		return nil, err
+	}
+	if cfg.StockShards, err = getInt("STOCK_SHARDS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.StockLeaseSize, err = getInt("STOCK_LEASE_SIZE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.StockLeaseTTL, err = getDuration("STOCK_LEASE_TTL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RegionStockShares, err = parseQuantityLimits("REGION_STOCK_SHARES", os.Getenv("REGION_STOCK_SHARES")); err != nil {
+		return nil, err
+	}
+	if cfg.QueueSize, err = getInt("QUEUE_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.PurchaseWorkers, err = getInt("PURCHASE_WORKERS", 256); err != nil {
+		return nil, err
+	}
+	if cfg.PurchaseBacklog, err = getInt("PURCHASE_BACKLOG", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.LoadShedThreshold, err = getFloat("LOAD_SHED_THRESHOLD", 0.9); err != nil {
+		return nil, err
+	}
+	if cfg.ConcurrencyLimits.Initial, err = getInt("CONCURRENCY_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ConcurrencyLimits.Min, err = getInt("CONCURRENCY_LIMIT_MIN", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ConcurrencyLimits.Max, err = getInt("CONCURRENCY_LIMIT_MAX", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.EnqueueTimeout, err = getDuration("ENQUEUE_TIMEOUT", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	timeouts := service.DefaultStageTimeouts()
+	if timeouts.Idempotency, err = getDuration("IDEMPOTENCY_TIMEOUT", timeouts.Idempotency); err != nil {
+		return nil, err
+	}
+	if timeouts.Decrement, err = getDuration("DECREMENT_TIMEOUT", timeouts.Decrement); err != nil {
+		return nil, err
+	}
+	if timeouts.Persist, err = getDuration("PERSIST_TIMEOUT", timeouts.Persist); err != nil {
+		return nil, err
+	}
+	cfg.StageTimeouts = timeouts
+	if cfg.HoldTTL, err = getDuration("HOLD_TTL", 0); err != nil {
+		return nil, err
+	}
+	if cfg.HoldSweepInterval, err = getDuration("HOLD_SWEEP_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RedisFailoverTimeout, err = getDuration("REDIS_FAILOVER_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RedisRetryAttempts, err = getInt("REDIS_RETRY_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.RedisRetryBackoff, err = getDuration("REDIS_RETRY_BACKOFF", 10*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.CompensationInterval, err = getDuration("COMPENSATION_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RefundRetryInterval, err = getDuration("REFUND_RETRY_INTERVAL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ExportBatchSize, err = getInt("EXPORT_BATCH_SIZE", 500); err != nil {
+		return nil, err
+	}
+	if cfg.ExportRowsPerSecond, err = getInt("EXPORT_ROWS_PER_SECOND", 5000); err != nil {
+		return nil, err
+	}
+	if cfg.OrderRetentionDays, err = getInt("ORDER_RETENTION_DAYS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.OrderArchiveInterval, err = getDuration("ORDER_ARCHIVE_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.MySQLReplicaCheckInterval, err = getDuration("MYSQL_REPLICA_CHECK_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MySQLShardCheckInterval, err = getDuration("MYSQL_SHARD_CHECK_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.PreparedStatements, err = getBool("PREPARED_STATEMENTS", true); err != nil {
+		return nil, err
+	}
+	if cfg.OrderArchiveBatchSize, err = getInt("ORDER_ARCHIVE_BATCH_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	cfg.OrderArchiveTarget = getString("ORDER_ARCHIVE_TARGET", OrderArchiveTables)
+	cfg.ArchiveS3Endpoint = getString("ARCHIVE_S3_ENDPOINT", "")
+	cfg.ArchiveS3Region = getString("ARCHIVE_S3_REGION", "us-east-1")
+	cfg.ArchiveS3Bucket = getString("ARCHIVE_S3_BUCKET", "")
+	cfg.ArchiveS3Prefix = getString("ARCHIVE_S3_PREFIX", "orders/")
+	cfg.ArchiveS3AccessKey = getString("ARCHIVE_S3_ACCESS_KEY", "")
+	cfg.ArchiveS3SecretKey = getString("ARCHIVE_S3_SECRET_KEY", "")
+	if cfg.ArchiveS3Timeout, err = getDuration("ARCHIVE_S3_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.OrderPartitions = getString("ORDER_PARTITIONS", OrderPartitionsOff)
+	if cfg.OrderPartitionsAhead, err = getInt("ORDER_PARTITIONS_AHEAD", 3); err != nil {
+		return nil, err
+	}
+	if cfg.OrderPartitionInterval, err = getDuration("ORDER_PARTITION_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.JobJitter, err = getFloat("JOB_JITTER", 0.1); err != nil {
+		return nil, err
+	}
+	if cfg.NotifyQueueSize, err = getInt("NOTIFY_QUEUE_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.NotifyAttempts, err = getInt("NOTIFY_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.NotifyRetryBackoff, err = getDuration("NOTIFY_RETRY_BACKOFF", time.Second); err != nil {
+		return nil, err
+	}
+	cfg.AnalyticsSink = getString("ANALYTICS_SINK", AnalyticsSinkNone)
+	if cfg.AnalyticsQueueSize, err = getInt("ANALYTICS_QUEUE_SIZE", 10000); err != nil {
+		return nil, err
+	}
+	if cfg.AnalyticsBatchSize, err = getInt("ANALYTICS_BATCH_SIZE", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.AnalyticsFlushInterval, err = getDuration("ANALYTICS_FLUSH_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.ClickHouseURL = getString("CLICKHOUSE_URL", "")
+	cfg.ClickHouseTable = getString("CLICKHOUSE_TABLE", "purchase_outcomes")
+	cfg.ClickHouseUser = getString("CLICKHOUSE_USER", "")
+	cfg.ClickHousePassword = getString("CLICKHOUSE_PASSWORD", "")
+	if cfg.ClickHouseTimeout, err = getDuration("CLICKHOUSE_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RebuyAfterCancel, err = getBool("REBUY_AFTER_CANCEL", true); err != nil {
+		return nil, err
+	}
+	if cfg.MigrateOnStart, err = getBool("MIGRATE_ON_START", false); err != nil {
+		return nil, err
+	}
+	if cfg.AsyncPurchases, err = getBool("ASYNC_PURCHASES", false); err != nil {
+		return nil, err
+	}
+	if cfg.SoldOutBroadcast, err = getBool("SOLD_OUT_BROADCAST", true); err != nil {
+		return nil, err
+	}
+	if cfg.DegradedPurchases, err = getBool("DEGRADED_PURCHASES", false); err != nil {
+		return nil, err
+	}
+	if cfg.DegradedPurchaseRate, err = getInt("DEGRADED_PURCHASE_RATE", 50); err != nil {
+		return nil, err
+	}
+	if cfg.CacheBreakerThreshold, err = getInt("CACHE_BREAKER_THRESHOLD", 5); err != nil {
+		return nil, err
+	}
+	if cfg.CacheBreakerCooldown, err = getDuration("CACHE_BREAKER_COOLDOWN", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.StockHintCacheTTL, err = getDuration("STOCK_HINT_CACHE_TTL", 250*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.CampaignCacheTTL, err = getDuration("CAMPAIGN_CACHE_TTL", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.LotteryClosesAt, err = getTime("LOTTERY_CLOSES_AT"); err != nil {
+		return nil, err
+	}
+	if cfg.VIPPriority, err = getBool("VIP_PRIORITY", false); err != nil {
+		return nil, err
+	}
+	if cfg.VIPReservedStock, err = parseQuantityLimits("VIP_RESERVED_STOCK", os.Getenv("VIP_RESERVED_STOCK")); err != nil {
+		return nil, err
+	}
+	if cfg.PartitionByItem, err = getBool("QUEUE_PARTITION_BY_ITEM", false); err != nil {
+		return nil, err
+	}
+	if cfg.InitialStock, err = getInt("INITIAL_STOCK", 100); err != nil {
+		return nil, err
+	}
+	if cfg.IdempotencyTTL, err = getDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.PurchaseRecordTTL, err = getDuration("PURCHASE_RECORD_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+
+	if cfg.UserRateLimit, err = getFloat("USER_RATE_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.UserRateBurst, err = getInt("USER_RATE_BURST", 5); err != nil {
+		return nil, err
+	}
+	if cfg.IPRateLimit, err = getFloat("IP_RATE_LIMIT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.IPRateBurst, err = getInt("IP_RATE_BURST", 20); err != nil {
+		return nil, err
+	}
+	if cfg.TrustForwardedFor, err = getBool("TRUST_FORWARDED_FOR", false); err != nil {
+		return nil, err
+	}
+	if cfg.BotCheckTimeout, err = getDuration("BOT_CHECK_TIMEOUT", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.PurchaseTokenTTL, err = getDuration("PURCHASE_TOKEN_TTL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RiskIPVelocity, err = getInt("RISK_IP_VELOCITY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RiskDeviceVelocity, err = getInt("RISK_DEVICE_VELOCITY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RiskVelocityWindow, err = getDuration("RISK_VELOCITY_WINDOW", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.RiskNewAccountAge, err = getDuration("RISK_NEW_ACCOUNT_AGE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RiskFlagScore, err = getInt("RISK_FLAG_SCORE", 50); err != nil {
+		return nil, err
+	}
+	if cfg.RiskRejectScore, err = getInt("RISK_REJECT_SCORE", 80); err != nil {
+		return nil, err
+	}
+	if cfg.BotCheckTrusted, err = parsePrefixes("BOT_CHECK_TRUSTED_CIDRS", os.Getenv("BOT_CHECK_TRUSTED_CIDRS")); err != nil {
+		return nil, err
+	}
+	if cfg.Pricing, err = parsePricing(os.Getenv("PRICING_TIERS")); err != nil {
+		return nil, err
+	}
+	if cfg.CatalogRefreshInterval, err = getDuration("CATALOG_REFRESH_INTERVAL", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ItemFilter, err = getBool("ITEM_FILTER", false); err != nil {
+		return nil, err
+	}
+	if cfg.ItemFilterFalsePositiveRate, err = getFloat("ITEM_FILTER_FALSE_POSITIVE_RATE", 0.01); err != nil {
+		return nil, err
+	}
+	if cfg.AdminAPIKeys, err = parseAdminKeys(os.Getenv("ADMIN_API_KEYS")); err != nil {
+		return nil, err
+	}
+	if cfg.CORSAllowCredentials, err = getBool("CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return nil, err
+	}
+	if cfg.CORSMaxAge, err = getDuration("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogSampleRate, err = getFloat("ACCESS_LOG_SAMPLE_RATE", 1); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxPerSecond, err = getInt("ACCESS_LOG_MAX_PER_SECOND", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.RedisSlowThreshold, err = getDuration("REDIS_SLOW_THRESHOLD", 50*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.MySQLSlowThreshold, err = getDuration("MYSQL_SLOW_THRESHOLD", 500*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionMinBytes, err = getInt("COMPRESSION_MIN_BYTES", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPReadHeaderTimeout, err = getDuration("HTTP_READ_HEADER_TIMEOUT", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPReadTimeout, err = getDuration("HTTP_READ_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPWriteTimeout, err = getDuration("HTTP_WRITE_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPIdleTimeout, err = getDuration("HTTP_IDLE_TIMEOUT", 60*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPMaxHeaderBytes, err = getInt("HTTP_MAX_HEADER_BYTES", 1<<20); err != nil {
+		return nil, err
+	}
+	if cfg.HTTPMaxConnections, err = getInt("HTTP_MAX_CONNECTIONS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxQuantity, err = getInt("MAX_QUANTITY", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ItemQuantityLimits, err = parseQuantityLimits("ITEM_QUANTITY_LIMITS", os.Getenv("ITEM_QUANTITY_LIMITS")); err != nil {
+		return nil, err
+	}
+	if cfg.RequireUUIDRequestIDs, err = getBool("REQUIRE_UUID_REQUEST_IDS", false); err != nil {
+		return nil, err
+	}
+	if cfg.MaxBodyBytes, err = getInt("MAX_BODY_BYTES", 64<<10); err != nil {
+		return nil, err
+	}
+
+	worker := service.DefaultWorkerSettings()
+	if worker.BatchSize, err = getInt("WORKER_BATCH_SIZE", worker.BatchSize); err != nil {
+		return nil, err
+	}
+	if worker.FlushInterval, err = getDuration("WORKER_FLUSH_INTERVAL", worker.FlushInterval); err != nil {
+		return nil, err
+	}
+	if worker.RetryAttempts, err = getInt("WORKER_RETRY_ATTEMPTS", worker.RetryAttempts); err != nil {
+		return nil, err
+	}
+	if worker.RetryBackoff, err = getDuration("WORKER_RETRY_BACKOFF", worker.RetryBackoff); err != nil {
+		return nil, err
+	}
+	if worker.MaxBackoff, err = getDuration("WORKER_MAX_BACKOFF", worker.MaxBackoff); err != nil {
+		return nil, err
+	}
+	cfg.Worker = worker
+
+	pool := service.WorkerPoolSettings{Min: cfg.WorkerCount}
+	if pool.Max, err = getInt("WORKER_MAX", cfg.WorkerCount); err != nil {
+		return nil, err
+	}
+	if pool.Interval, err = getDuration("WORKER_SCALE_INTERVAL", time.Second); err != nil {
+		return nil, err
+	}
+	if pool.ScaleUpLatency, err = getDuration("WORKER_SCALE_UP_LATENCY", 500*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if pool.IdleTimeout, err = getDuration("WORKER_IDLE_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	cfg.WorkerPool = pool
+
+	if cfg.DBBreakerThreshold, err = getInt("DB_BREAKER_THRESHOLD", 5); err != nil {
+		return nil, err
+	}
+	if cfg.DBBreakerCooldown, err = getDuration("DB_BREAKER_COOLDOWN", 5*time.Second); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	switch c.IdempotencyMode {
+	case service.IdempotencyPerRequest, service.IdempotencyPerUserItem:
+	default:
+		return fmt.Errorf("invalid IDEMPOTENCY_MODE %q", c.IdempotencyMode)
+	}
+	if c.AsyncPurchases && c.IdempotencyMode != service.IdempotencyPerRequest {
+		return fmt.Errorf("ASYNC_PURCHASES requires IDEMPOTENCY_MODE=%s", service.IdempotencyPerRequest)
+	}
+	switch c.SaleMode {
+	case SaleModeFirstCome:
+	case SaleModeLottery:
+		if c.LotteryClosesAt.IsZero() {
+			return fmt.Errorf("SALE_MODE=%s requires LOTTERY_CLOSES_AT", SaleModeLottery)
+		}
+		if c.IdempotencyMode != service.IdempotencyPerRequest {
+			return fmt.Errorf("SALE_MODE=%s requires IDEMPOTENCY_MODE=%s", SaleModeLottery, service.IdempotencyPerRequest)
+		}
+	default:
+		return fmt.Errorf("invalid SALE_MODE %q", c.SaleMode)
+	}
+	if c.IdempotencyTTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCY_TTL must be positive")
+	}
+	if c.PurchaseRecordTTL <= 0 {
+		return fmt.Errorf("PURCHASE_RECORD_TTL must be positive")
+	}
+	if c.WorkerCount <= 0 {
+		return fmt.Errorf("WORKER_COUNT must be positive")
+	}
+	if c.StockShards < 1 {
+		return fmt.Errorf("STOCK_SHARDS must be at least 1")
+	}
+	if c.StockLeaseSize < 0 || c.StockLeaseTTL <= 0 {
+		return fmt.Errorf("STOCK_LEASE_SIZE must not be negative and STOCK_LEASE_TTL must be positive")
+	}
+	if c.StockLeaseSize > 0 && c.StockShards > 1 {
+		return fmt.Errorf("STOCK_LEASE_SIZE and STOCK_SHARDS cannot be combined")
+	}
+	if len(c.RegionStockShares) > 0 {
+		if _, ok := c.RegionStockShares[c.Region]; !ok {
+			return fmt.Errorf("REGION %q has no share in REGION_STOCK_SHARES", c.Region)
+		}
+		for region := range c.RegionStockShares {
+			if _, ok := c.RegionRedisAddrs[region]; !ok && region != c.Region {
+				return fmt.Errorf("REGION_REDIS_ADDRS has no address for region %s", region)
+			}
+		}
+	}
+	if c.StockLeaseSize > 0 && len(c.VIPReservedStock) > 0 {
+		return fmt.Errorf("STOCK_LEASE_SIZE and VIP_RESERVED_STOCK cannot be combined")
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("QUEUE_SIZE must be positive")
+	}
+	if c.HTTPReadHeaderTimeout <= 0 || c.HTTPReadTimeout <= 0 || c.HTTPWriteTimeout <= 0 || c.HTTPIdleTimeout <= 0 {
+		return fmt.Errorf("HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT must be positive")
+	}
+	if c.HTTPMaxHeaderBytes <= 0 || c.HTTPMaxConnections < 0 {
+		return fmt.Errorf("HTTP_MAX_HEADER_BYTES must be positive and HTTP_MAX_CONNECTIONS must not be negative")
+	}
+	if c.CORSAllowCredentials && slices.Contains(c.CORSAllowedOrigins, "*") {
+		return fmt.Errorf("CORS_ALLOW_CREDENTIALS cannot be combined with CORS_ALLOWED_ORIGINS=*")
+	}
+	if c.CORSMaxAge < 0 {
+		return fmt.Errorf("CORS_MAX_AGE must not be negative")
+	}
+	if c.AccessLogSampleRate < 0 || c.AccessLogSampleRate > 1 {
+		return fmt.Errorf("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1")
+	}
+	if c.AccessLogMaxPerSecond < 0 {
+		return fmt.Errorf("ACCESS_LOG_MAX_PER_SECOND must not be negative")
+	}
+	if c.RedisSlowThreshold < 0 || c.MySQLSlowThreshold < 0 {
+		return fmt.Errorf("REDIS_SLOW_THRESHOLD and MYSQL_SLOW_THRESHOLD must not be negative")
+	}
+	for _, encoding := range c.CompressionEncodings {
+		if encoding != "gzip" && encoding != "zstd" {
+			return fmt.Errorf("invalid COMPRESSION_ENCODINGS entry %q", encoding)
+		}
+	}
+	if c.CompressionMinBytes < 0 {
+		return fmt.Errorf("COMPRESSION_MIN_BYTES must not be negative")
+	}
+	if c.MaxQuantity < 0 {
+		return fmt.Errorf("MAX_QUANTITY must not be negative")
+	}
+	if c.MaxBodyBytes <= 0 {
+		return fmt.Errorf("MAX_BODY_BYTES must be positive")
+	}
+	if c.PurchaseWorkers < 0 || c.PurchaseBacklog < 0 {
+		return fmt.Errorf("PURCHASE_WORKERS and PURCHASE_BACKLOG must not be negative")
+	}
+	if c.LoadShedThreshold < 0 || c.LoadShedThreshold > 1 {
+		return fmt.Errorf("LOAD_SHED_THRESHOLD must be between 0 and 1")
+	}
+	if c.EnqueueTimeout < 0 {
+		return fmt.Errorf("ENQUEUE_TIMEOUT must not be negative")
+	}
+	if c.ConcurrencyLimits.Initial < 0 {
+		return fmt.Errorf("CONCURRENCY_LIMIT must not be negative")
+	}
+	if err := c.ConcurrencyLimits.Validate(); err != nil {
+		return fmt.Errorf("invalid CONCURRENCY_LIMIT: %w", err)
+	}
+	if err := c.StageTimeouts.Validate(); err != nil {
+		return fmt.Errorf("invalid stage timeouts: %w", err)
+	}
+	if c.HoldTTL < 0 || c.HoldSweepInterval <= 0 {
+		return fmt.Errorf("HOLD_TTL must not be negative and HOLD_SWEEP_INTERVAL must be positive")
+	}
+	if len(c.RedisClusterAddrs) > 0 && c.RedisSentinelMaster != "" {
+		return fmt.Errorf("REDIS_CLUSTER_ADDRS and REDIS_SENTINEL_MASTER cannot both be set")
+	}
+	if c.RedisSentinelMaster != "" && len(c.RedisSentinelAddrs) == 0 {
+		return fmt.Errorf("REDIS_SENTINEL_ADDRS is required with REDIS_SENTINEL_MASTER")
+	}
+	if c.RedisFailoverTimeout < 0 {
+		return fmt.Errorf("REDIS_FAILOVER_TIMEOUT must not be negative")
+	}
+	if c.RedisRetryAttempts < 1 || c.RedisRetryBackoff < 0 {
+		return fmt.Errorf("REDIS_RETRY_ATTEMPTS must be at least 1 and REDIS_RETRY_BACKOFF must not be negative")
+	}
+	if c.CompensationInterval <= 0 {
+		return fmt.Errorf("COMPENSATION_INTERVAL must be positive")
+	}
+	if c.CatalogRefreshInterval <= 0 {
+		return fmt.Errorf("CATALOG_REFRESH_INTERVAL must be positive")
+	}
+	if c.ItemFilterFalsePositiveRate <= 0 || c.ItemFilterFalsePositiveRate >= 1 {
+		return fmt.Errorf("ITEM_FILTER_FALSE_POSITIVE_RATE must be between 0 and 1")
+	}
+	if c.RefundRetryInterval <= 0 {
+		return fmt.Errorf("REFUND_RETRY_INTERVAL must be positive")
+	}
+	if c.ExportBatchSize < 1 || c.ExportRowsPerSecond < 0 {
+		return fmt.Errorf("EXPORT_BATCH_SIZE must be at least 1 and EXPORT_ROWS_PER_SECOND must not be negative")
+	}
+	if c.OrderRetentionDays < 0 || c.OrderArchiveInterval <= 0 || c.OrderArchiveBatchSize < 1 {
+		return fmt.Errorf("ORDER_RETENTION_DAYS must not be negative, ORDER_ARCHIVE_INTERVAL must be positive and ORDER_ARCHIVE_BATCH_SIZE must be at least 1")
+	}
+	switch c.OrderArchiveTarget {
+	case OrderArchiveTables:
+	case OrderArchiveBlob:
+		if c.ArchiveS3Endpoint == "" || c.ArchiveS3Bucket == "" || c.ArchiveS3AccessKey == "" || c.ArchiveS3SecretKey == "" {
+			return fmt.Errorf("ORDER_ARCHIVE_TARGET=%s requires ARCHIVE_S3_ENDPOINT, ARCHIVE_S3_BUCKET, ARCHIVE_S3_ACCESS_KEY and ARCHIVE_S3_SECRET_KEY", OrderArchiveBlob)
+		}
+	default:
+		return fmt.Errorf("invalid ORDER_ARCHIVE_TARGET %q", c.OrderArchiveTarget)
+	}
+	if c.ArchiveS3Timeout <= 0 {
+		return fmt.Errorf("ARCHIVE_S3_TIMEOUT must be positive")
+	}
+	switch c.OrderPartitions {
+	case OrderPartitionsOff:
+	case OrderPartitionsDay, OrderPartitionsMonth:
+		if c.DatabaseDriver != DatabaseDriverMySQL {
+			return fmt.Errorf("ORDER_PARTITIONS requires DATABASE_DRIVER=%s", DatabaseDriverMySQL)
+		}
+	default:
+		return fmt.Errorf("invalid ORDER_PARTITIONS %q", c.OrderPartitions)
+	}
+	if c.OrderPartitionsAhead < 0 || c.OrderPartitionInterval <= 0 {
+		return fmt.Errorf("ORDER_PARTITIONS_AHEAD must not be negative and ORDER_PARTITION_INTERVAL must be positive")
+	}
+	if c.JobJitter < 0 || c.JobJitter > 1 {
+		return fmt.Errorf("JOB_JITTER must be between 0 and 1")
+	}
+	switch c.Notifier {
+	case NotifierNone, NotifierLog:
+	case NotifierSMTP:
+		if c.SMTPAddr == "" || c.SMTPFrom == "" {
+			return fmt.Errorf("SMTP_ADDR and SMTP_FROM are required with NOTIFIER=smtp")
+		}
+	default:
+		return fmt.Errorf("invalid NOTIFIER %q", c.Notifier)
+	}
+	if c.NotifyQueueSize < 1 || c.NotifyAttempts < 1 || c.NotifyRetryBackoff < 0 {
+		return fmt.Errorf("NOTIFY_QUEUE_SIZE and NOTIFY_ATTEMPTS must be at least 1 and NOTIFY_RETRY_BACKOFF must not be negative")
+	}
+	switch c.AnalyticsSink {
+	case AnalyticsSinkNone, AnalyticsSinkLog:
+	case AnalyticsSinkClickHouse:
+		if c.ClickHouseURL == "" || c.ClickHouseTable == "" {
+			return fmt.Errorf("CLICKHOUSE_URL and CLICKHOUSE_TABLE are required with ANALYTICS_SINK=clickhouse")
+		}
+	default:
+		return fmt.Errorf("invalid ANALYTICS_SINK %q", c.AnalyticsSink)
+	}
+	if c.AnalyticsQueueSize < 1 || c.AnalyticsBatchSize < 1 || c.AnalyticsFlushInterval <= 0 || c.ClickHouseTimeout <= 0 {
+		return fmt.Errorf("ANALYTICS_QUEUE_SIZE and ANALYTICS_BATCH_SIZE must be at least 1 and ANALYTICS_FLUSH_INTERVAL and CLICKHOUSE_TIMEOUT must be positive")
+	}
+	if c.SaleEventsTopic != "" && len(c.KafkaBrokers) == 0 {
+		return fmt.Errorf("SALE_EVENTS_TOPIC requires KAFKA_BROKERS")
+	}
+	if c.UserRateLimit < 0 || (c.UserRateLimit > 0 && c.UserRateBurst < 1) {
+		return fmt.Errorf("USER_RATE_LIMIT must not be negative and USER_RATE_BURST must be at least 1")
+	}
+	if c.IPRateLimit < 0 || (c.IPRateLimit > 0 && c.IPRateBurst < 1) {
+		return fmt.Errorf("IP_RATE_LIMIT must not be negative and IP_RATE_BURST must be at least 1")
+	}
+	switch c.RateLimitStore {
+	case RateLimitStoreMemory, RateLimitStoreRedis:
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE %q", c.RateLimitStore)
+	}
+	switch c.StartupStockCheck {
+	case StockCheckOff, StockCheckWarn, StockCheckCorrect, StockCheckRefuse:
+	default:
+		return fmt.Errorf("invalid STARTUP_STOCK_CHECK %q", c.StartupStockCheck)
+	}
+	if c.BotCheckVerifyURL != "" && c.BotCheckSecret == "" {
+		return fmt.Errorf("BOT_CHECK_VERIFY_URL requires BOT_CHECK_SECRET")
+	}
+	if c.BotCheckTimeout <= 0 {
+		return fmt.Errorf("BOT_CHECK_TIMEOUT must be positive")
+	}
+	if c.PurchaseTokenSecret != "" && len(c.PurchaseTokenSecret) < 32 {
+		return fmt.Errorf("PURCHASE_TOKEN_SECRET must be at least 32 bytes")
+	}
+	if c.PurchaseTokenTTL <= 0 {
+		return fmt.Errorf("PURCHASE_TOKEN_TTL must be positive")
+	}
+	if c.RiskIPVelocity < 0 || c.RiskDeviceVelocity < 0 || c.RiskNewAccountAge < 0 {
+		return fmt.Errorf("RISK_IP_VELOCITY, RISK_DEVICE_VELOCITY and RISK_NEW_ACCOUNT_AGE must not be negative")
+	}
+	if c.RiskVelocityWindow <= 0 {
+		return fmt.Errorf("RISK_VELOCITY_WINDOW must be positive")
+	}
+	if c.RiskFlagScore < 0 || c.RiskFlagScore > 100 || c.RiskRejectScore < 0 || c.RiskRejectScore > 100 {
+		return fmt.Errorf("RISK_FLAG_SCORE and RISK_REJECT_SCORE must be between 0 and 100")
+	}
+	if c.MySQLReplicaCheckInterval <= 0 {
+		return fmt.Errorf("MYSQL_REPLICA_CHECK_INTERVAL must be positive")
+	}
+	if c.MySQLShardCheckInterval <= 0 {
+		return fmt.Errorf("MYSQL_SHARD_CHECK_INTERVAL must be positive")
+	}
+	if len(c.MySQLShardDSNs) > 0 {
+		switch {
+		case c.DatabaseDriver != DatabaseDriverMySQL:
+			return fmt.Errorf("MYSQL_SHARD_DSNS requires DATABASE_DRIVER=%s", DatabaseDriverMySQL)
+		case c.MySQLReplicaDSN != "":
+			return fmt.Errorf("MYSQL_SHARD_DSNS cannot be combined with MYSQL_REPLICA_DSN")
+		case c.OrderStore != OrderStoreCRUD:
+			// Each shard would number its order changes on its own
+			return fmt.Errorf("MYSQL_SHARD_DSNS requires ORDER_STORE=%s", OrderStoreCRUD)
+		}
+	}
+	switch c.DatabaseDriver {
+	case DatabaseDriverMySQL, DatabaseDriverSQLite:
+	default:
+		return fmt.Errorf("invalid DATABASE_DRIVER %q", c.DatabaseDriver)
+	}
+	switch c.OpenAPIValidation {
+	case OpenAPIValidationOff, OpenAPIValidationRequests, OpenAPIValidationResponses:
+	default:
+		return fmt.Errorf("invalid OPENAPI_VALIDATION %q", c.OpenAPIValidation)
+	}
+	switch c.OrderStore {
+	case OrderStoreCRUD, OrderStoreEvents:
+	default:
+		return fmt.Errorf("invalid ORDER_STORE %q", c.OrderStore)
+	}
+	switch c.PaymentGateway {
+	case PaymentGatewayNone, PaymentGatewayMock:
+	default:
+		return fmt.Errorf("invalid PAYMENT_GATEWAY %q", c.PaymentGateway)
+	}
+	if err := c.Worker.Validate(); err != nil {
+		return fmt.Errorf("invalid worker settings: %w", err)
+	}
+	if err := c.WorkerPool.Validate(); err != nil {
+		return fmt.Errorf("invalid worker pool settings: %w", err)
+	}
+	if c.DegradedPurchaseRate < 1 || c.CacheBreakerThreshold < 1 || c.CacheBreakerCooldown <= 0 {
+		return fmt.Errorf("DEGRADED_PURCHASE_RATE and CACHE_BREAKER_THRESHOLD must be at least 1 and CACHE_BREAKER_COOLDOWN must be positive")
+	}
+	if c.StockHintCacheTTL < 0 || c.CampaignCacheTTL < 0 {
+		return fmt.Errorf("STOCK_HINT_CACHE_TTL and CAMPAIGN_CACHE_TTL must not be negative")
+	}
+	if c.DBBreakerThreshold < 0 || c.DBBreakerCooldown <= 0 {
+		return fmt.Errorf("DB_BREAKER_THRESHOLD must not be negative and DB_BREAKER_COOLDOWN must be positive")
+	}
+	if c.PartitionByItem && c.WorkerPool.Max != c.WorkerCount {
+		return fmt.Errorf("QUEUE_PARTITION_BY_ITEM needs a fixed number of workers: WORKER_MAX must equal WORKER_COUNT")
+	}
+	return nil
+}
+
+func getString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func getBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+func getFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return f, nil
+}
+
+func getDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// getTime parses an RFC 3339 time, returning the zero time if key is unset.
+func getTime(key string) (time.Time, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return t, nil
+}
+
+// parseList parses a comma-separated list, dropping empty entries.
+func parseList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePricing parses semicolon-separated item schedules such as
+// "iphone-15=1:99900,2:94900;ipad=1:49900", where each tier is
+// min_quantity:unit_price.
+func parsePricing(raw string) (map[string]domain.PriceSchedule, error) {
+	pricing := make(map[string]domain.PriceSchedule)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		itemID, tiers, ok := strings.Cut(entry, "=")
+		if !ok || itemID == "" {
+			return nil, fmt.Errorf("invalid PRICING_TIERS entry %q", entry)
+		}
+
+		var schedule domain.PriceSchedule
+		for _, tier := range strings.Split(tiers, ",") {
+			qty, price, ok := strings.Cut(strings.TrimSpace(tier), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid PRICING_TIERS tier %q for %s", tier, itemID)
+			}
+			minQuantity, err := strconv.Atoi(qty)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PRICING_TIERS quantity for %s: %w", itemID, err)
+			}
+			unitPrice, err := strconv.ParseInt(price, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PRICING_TIERS price for %s: %w", itemID, err)
+			}
+			schedule = append(schedule, domain.PriceTier{MinQuantity: minQuantity, UnitPrice: unitPrice})
+		}
+		if err := schedule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid PRICING_TIERS for %s: %w", itemID, err)
+		}
+		pricing[itemID] = schedule
+	}
+	return pricing, nil
+}
+
+// parsePairs parses a comma-separated list of key:value pairs.
+func parsePairs(raw string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || key == "" || value == "" {
+			continue
+		}
+		pairs[key] = value
+	}
+	return pairs
+}
+
+// parseQuantityLimits parses the comma-separated list of item:limit pairs
+// in the variable name, such as "iphone-15:2,ipad:5".
+func parseQuantityLimits(name, raw string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for itemID, value := range parsePairs(raw) {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid %s limit %q for %s", name, value, itemID)
+		}
+		limits[itemID] = limit
+	}
+	return limits, nil
+}
+
+// parsePrefixes parses the comma-separated list of CIDR prefixes in the
+// variable name, such as "10.0.0.0/8,192.0.2.7"; a bare IP is its own
+// prefix.
+func parsePrefixes(name, raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range parseList(raw) {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid %s entry %q", name, entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseAdminKeys parses a comma-separated list of key:subject:role entries,
+// such as "k1:alice:admin,k2:grafana:viewer". An entry may end with the
+// tenant its principal is limited to, as in "k3:bob:admin:acme".
+func parseAdminKeys(raw string) (map[string]domain.Principal, error) {
+	keys := make(map[string]domain.Principal)
+	for _, entry := range parseList(raw) {
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] == "" || parts[1] == "" {
+			// Don't echo the entry, it contains the key
+			return nil, fmt.Errorf("invalid ADMIN_API_KEYS entry, want key:subject:role[:tenant]")
+		}
+		role := domain.Role(parts[2])
+		if role != domain.RoleAdmin && role != domain.RoleViewer {
+			return nil, fmt.Errorf("invalid ADMIN_API_KEYS role %q for %s", role, parts[1])
+		}
+		principal := domain.Principal{Subject: parts[1], Roles: []domain.Role{role}}
+		if len(parts) == 4 {
+			if !domain.ValidTenantID(parts[3]) {
+				return nil, fmt.Errorf("invalid ADMIN_API_KEYS tenant %q for %s", parts[3], parts[1])
+			}
+			principal.Tenant = parts[3]
+		}
+		keys[parts[0]] = principal
+	}
+	return keys, nil
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.IdempotencyMode != service.IdempotencyPerRequest {
+		t.Errorf("expected mode %s, got %s", service.IdempotencyPerRequest, cfg.IdempotencyMode)
+	}
+	if cfg.IdempotencyTTL != 24*time.Hour {
+		t.Errorf("expected TTL 24h, got %v", cfg.IdempotencyTTL)
+	}
+	if cfg.WorkerCount != 10 {
+		t.Errorf("expected 10 workers, got %d", cfg.WorkerCount)
+	}
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_MODE", "user_item")
+	t.Setenv("IDEMPOTENCY_TTL", "2h")
+	t.Setenv("CAMPAIGN_ID", "summer")
+	t.Setenv("PARTNER_API_KEYS", "k1:partner-a, k2:partner-b,bogus")
+	t.Setenv("KAFKA_BROKERS", "kafka-1:9092, kafka-2:9092,")
+	t.Setenv("PRICING_TIERS", "iphone-15=1:99900,2:94900; ipad=1:49900")
+	t.Setenv("ITEM_QUANTITY_LIMITS", "iphone-15:2, ipad:5")
+	t.Setenv("BOT_CHECK_TRUSTED_CIDRS", "10.1.2.3/8, 192.0.2.7")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.IdempotencyMode != service.IdempotencyPerUserItem {
+		t.Errorf("expected mode %s, got %s", service.IdempotencyPerUserItem, cfg.IdempotencyMode)
+	}
+	if cfg.IdempotencyTTL != 2*time.Hour {
+		t.Errorf("expected TTL 2h, got %v", cfg.IdempotencyTTL)
+	}
+	if cfg.CampaignID != "summer" {
+		t.Errorf("expected campaign summer, got %s", cfg.CampaignID)
+	}
+	if len(cfg.PartnerAPIKeys) != 2 || cfg.PartnerAPIKeys["k2"] != "partner-b" {
+		t.Errorf("unexpected partner keys: %v", cfg.PartnerAPIKeys)
+	}
+	if len(cfg.KafkaBrokers) != 2 || cfg.KafkaBrokers[1] != "kafka-2:9092" {
+		t.Errorf("unexpected kafka brokers: %v", cfg.KafkaBrokers)
+	}
+	if len(cfg.Pricing) != 2 || cfg.Pricing["iphone-15"].UnitPrice(3) != 94900 {
+		t.Errorf("unexpected pricing: %v", cfg.Pricing)
+	}
+	if len(cfg.ItemQuantityLimits) != 2 || cfg.ItemQuantityLimits["ipad"] != 5 {
+		t.Errorf("unexpected quantity limits: %v", cfg.ItemQuantityLimits)
+	}
+	if len(cfg.BotCheckTrusted) != 2 || cfg.BotCheckTrusted[0].String() != "10.0.0.0/8" || cfg.BotCheckTrusted[1].String() != "192.0.2.7/32" {
+		t.Errorf("unexpected trusted clients: %v", cfg.BotCheckTrusted)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"IDEMPOTENCY_MODE":                "per-moon",
+		"REGION_STOCK_SHARES":             "us:sixty",
+		"IDEMPOTENCY_TTL":                 "0s",
+		"PURCHASE_RECORD_TTL":             "0s",
+		"WORKER_COUNT":                    "ten",
+		"WORKER_BATCH_SIZE":               "0",
+		"PRICING_TIERS":                   "iphone-15=2:94900",
+		"USER_RATE_LIMIT":                 "-1",
+		"ASYNC_PURCHASES":                 "maybe",
+		"SOLD_OUT_BROADCAST":              "maybe",
+		"DEGRADED_PURCHASES":              "maybe",
+		"DEGRADED_PURCHASE_RATE":          "0",
+		"CACHE_BREAKER_THRESHOLD":         "0",
+		"CACHE_BREAKER_COOLDOWN":          "0s",
+		"STOCK_HINT_CACHE_TTL":            "-1s",
+		"CAMPAIGN_CACHE_TTL":              "-1s",
+		"ITEM_FILTER":                     "maybe",
+		"ITEM_FILTER_FALSE_POSITIVE_RATE": "1",
+		"IP_RATE_LIMIT":                   "-1",
+		"RATE_LIMIT_STORE":                "disk",
+		"LOAD_SHED_THRESHOLD":             "1.5",
+		"PREPARED_STATEMENTS":             "sometimes",
+		"CONCURRENCY_LIMIT":               "-1",
+		"CONCURRENCY_LIMIT_MIN":           "many",
+		"ENQUEUE_TIMEOUT":                 "-1s",
+		"DECREMENT_TIMEOUT":               "-1s",
+		"PERSIST_TIMEOUT":                 "soon",
+		"COMPENSATION_INTERVAL":           "0s",
+		"CATALOG_REFRESH_INTERVAL":        "0s",
+		"REFUND_RETRY_INTERVAL":           "-1s",
+		"EXPORT_BATCH_SIZE":               "0",
+		"EXPORT_ROWS_PER_SECOND":          "-5",
+		"ORDER_RETENTION_DAYS":            "-1",
+		"ORDER_STORE":                     "ledger",
+		"OPENAPI_VALIDATION":              "strict",
+		"ORDER_ARCHIVE_INTERVAL":          "0s",
+		"ORDER_ARCHIVE_BATCH_SIZE":        "0",
+		"ORDER_ARCHIVE_TARGET":            "blob",
+		"ARCHIVE_S3_TIMEOUT":              "0s",
+		"ORDER_PARTITIONS":                "week",
+		"ORDER_PARTITIONS_AHEAD":          "-1",
+		"ORDER_PARTITION_INTERVAL":        "0s",
+		"JOB_JITTER":                      "1.5",
+		"NOTIFIER":                        "smtp",
+		"NOTIFY_QUEUE_SIZE":               "0",
+		"ANALYTICS_SINK":                  "clickhouse",
+		"ANALYTICS_QUEUE_SIZE":            "0",
+		"ANALYTICS_BATCH_SIZE":            "0",
+		"ANALYTICS_FLUSH_INTERVAL":        "0s",
+		"CLICKHOUSE_TIMEOUT":              "-1s",
+		"NOTIFY_ATTEMPTS":                 "0",
+		"SALE_EVENTS_TOPIC":               "sale-events",
+		"HOLD_TTL":                        "-1m",
+		"PAYMENT_GATEWAY":                 "stripe",
+		"REBUY_AFTER_CANCEL":              "maybe",
+		"QUEUE_PARTITION_BY_ITEM":         "sometimes",
+		"WORKER_MAX":                      "5",
+		"WORKER_IDLE_TIMEOUT":             "0s",
+		"DB_BREAKER_THRESHOLD":            "-1",
+		"DB_BREAKER_COOLDOWN":             "0s",
+		"REDIS_SENTINEL_MASTER":           "mymaster",
+		"REDIS_FAILOVER_TIMEOUT":          "-1s",
+		"REDIS_RETRY_ATTEMPTS":            "0",
+		"REDIS_RETRY_BACKOFF":             "fast",
+		"STOCK_SHARDS":                    "0",
+		"DATABASE_DRIVER":                 "postgres",
+		"MYSQL_REPLICA_CHECK_INTERVAL":    "0s",
+		"MYSQL_SHARD_CHECK_INTERVAL":      "0s",
+		"STOCK_LEASE_SIZE":                "-1",
+		"STOCK_LEASE_TTL":                 "0s",
+		"MAX_QUANTITY":                    "-1",
+		"HTTP_WRITE_TIMEOUT":              "0s",
+		"HTTP_MAX_CONNECTIONS":            "-1",
+		"CORS_MAX_AGE":                    "-1m",
+		"COMPRESSION_ENCODINGS":           "gzip,br",
+		"ACCESS_LOG_SAMPLE_RATE":          "2",
+		"REDIS_SLOW_THRESHOLD":            "-1ms",
+		"MYSQL_SLOW_THRESHOLD":            "slow",
+		"ITEM_QUANTITY_LIMITS":            "iphone-15:0",
+		"MAX_BODY_BYTES":                  "0",
+		"SALE_MODE":                       "auction",
+		"LOTTERY_CLOSES_AT":               "tomorrow",
+		"VIP_PRIORITY":                    "always",
+		"VIP_RESERVED_STOCK":              "iphone-15:none",
+		"BOT_CHECK_VERIFY_URL":            "https://challenges.example.com/siteverify",
+		"BOT_CHECK_TIMEOUT":               "0s",
+		"BOT_CHECK_TRUSTED_CIDRS":         "10.0.0.0/33",
+		"PURCHASE_TOKEN_SECRET":           "short",
+		"PURCHASE_TOKEN_TTL":              "0s",
+		"RISK_IP_VELOCITY":                "-1",
+		"RISK_VELOCITY_WINDOW":            "0s",
+		"RISK_NEW_ACCOUNT_AGE":            "-1m",
+		"RISK_REJECT_SCORE":               "101",
+	}
+
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Errorf("expected error for %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestLoad_RegionStock(t *testing.T) {
+	t.Setenv("REGION", "us")
+	t.Setenv("REGION_STOCK_SHARES", "us:60,eu:40")
+	t.Setenv("REGION_REDIS_ADDRS", "eu:redis-eu:6379")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RegionStockShares["eu"] != 40 || cfg.RegionRedisAddrs["eu"] != "redis-eu:6379" {
+		t.Errorf("unexpected regions: %v %v", cfg.RegionStockShares, cfg.RegionRedisAddrs)
+	}
+
+	t.Setenv("REGION", "ap")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a region without a share")
+	}
+
+	t.Setenv("REGION", "us")
+	t.Setenv("REGION_REDIS_ADDRS", "")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a region without a Redis address")
+	}
+}
+
+func TestLoad_AdminKeys(t *testing.T) {
+	t.Setenv("ADMIN_API_KEYS", "k1:alice:admin, k2:grafana:viewer, k3:bob:admin:acme")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.AdminAPIKeys) != 3 || cfg.AdminAPIKeys["k2"].Subject != "grafana" || cfg.AdminAPIKeys["k2"].HasRole(domain.RoleAdmin) {
+		t.Errorf("unexpected admin keys: %+v", cfg.AdminAPIKeys)
+	}
+	if cfg.AdminAPIKeys["k1"].Tenant != "" || cfg.AdminAPIKeys["k3"].Tenant != "acme" {
+		t.Errorf("unexpected admin key tenants: %+v", cfg.AdminAPIKeys)
+	}
+
+	t.Setenv("ADMIN_API_KEYS", "k1:alice:root")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for unknown role")
+	}
+
+	t.Setenv("ADMIN_API_KEYS", "k1:alice:admin:{acme}")
+	if _, err := Load(); err == nil {
+		t.Error("expected error for invalid tenant")
+	}
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+type AllocationStatus string
+
+const (
+	AllocationStatusOpen      AllocationStatus = "open"
+	AllocationStatusFulfilled AllocationStatus = "fulfilled"
+)
+
+// Allocation is a block of stock claimed by a partner up front and
+// fulfilled later as individual orders.
+type Allocation struct {
+	ID        string
+	PartnerID string
+	ItemID    string
+	Quantity  int
+	Fulfilled int
+	Status    AllocationStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Remaining returns the number of units not yet fulfilled.
+func (a Allocation) Remaining() int {
+	return a.Quantity - a.Fulfilled
+}
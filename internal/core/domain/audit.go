@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// AuditAction names a kind of operator change.
+type AuditAction string
+
+const (
+	AuditItemCreate       AuditAction = "item.create"
+	AuditItemUpdate       AuditAction = "item.update"
+	AuditRestock          AuditAction = "item.restock"
+	AuditStockRebalance   AuditAction = "item.rebalance"
+	AuditCampaignCreate   AuditAction = "campaign.create"
+	AuditCampaignUpdate   AuditAction = "campaign.update"
+	AuditCampaignTeardown AuditAction = "campaign.teardown"
+	AuditCampaignWarmup   AuditAction = "campaign.warmup"
+	AuditCouponCreate     AuditAction = "coupon.create"
+	AuditCouponUpdate     AuditAction = "coupon.update"
+	AuditTierSet          AuditAction = "tier.set"
+	AuditUserBan          AuditAction = "blacklist.ban_user"
+	AuditUserUnban        AuditAction = "blacklist.unban_user"
+	AuditIPRangeBan       AuditAction = "blacklist.ban_ip_range"
+	AuditIPRangeUnban     AuditAction = "blacklist.unban_ip_range"
+	AuditWorkerSettings   AuditAction = "worker_settings.update"
+)
+
+// AuditRecord is one operator change, written once and never altered.
+// Target identifies what was changed, such as an item ID, and Before and
+// After are JSON documents of it around the change, empty when it did not
+// exist before or after.
+type AuditRecord struct {
+	ID        int64
+	Actor     string
+	Action    AuditAction
+	Target    string
+	Before    string
+	After     string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// AuditFilter selects audit records, newest first. Empty fields match
+// everything; BeforeID continues a listing below a record ID.
+type AuditFilter struct {
+	Actor    string
+	Action   AuditAction
+	Target   string
+	BeforeID int64
+	Limit    int
+}
+
+// Matches reports whether the record is selected by the filter, ignoring
+// the limit.
+func (f AuditFilter) Matches(record AuditRecord) bool {
+	return (f.Actor == "" || record.Actor == f.Actor) &&
+		(f.Action == "" || record.Action == f.Action) &&
+		(f.Target == "" || record.Target == f.Target) &&
+		(f.BeforeID == 0 || record.ID < f.BeforeID)
+}
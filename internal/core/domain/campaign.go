@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Campaign is a scheduled flash sale of a set of items.
+type Campaign struct {
+	ID        string
+	TenantID  string // merchant running the sale, empty for the default tenant
+	Name      string
+	ItemIDs   []string
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (c Campaign) Validate() error {
+	if c.ID == "" {
+		return errors.New("campaign id is required")
+	}
+	if len(c.ItemIDs) == 0 {
+		return errors.New("campaign must include at least one item")
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		return errors.New("campaign must end after it starts")
+	}
+	return nil
+}
+
+// CampaignArchive records the final cache state of a campaign before its
+// keys are deleted.
+type CampaignArchive struct {
+	CampaignID      string
+	Stock           map[string]int // remaining stock per item
+	FrozenItems     []string
+	ClosedItems     []string
+	IdempotencyKeys int
+	ArchivedAt      time.Time
+}
+
+// CampaignWarmup reports how a campaign's cache keys were prepared before
+// its sale. A campaign is Ready when every item has stock in the database
+// and the cache holds the same.
+type CampaignWarmup struct {
+	CampaignID  string
+	StartsAt    time.Time
+	Items       []WarmupItem
+	KeysCleared int // keys left over from an earlier run, such as a rehearsal
+	Ready       bool
+	WarmedAt    time.Time
+}
+
+// WarmupItem is the state of one campaign item after a warmup.
+type WarmupItem struct {
+	ItemID    string
+	Inventory int    // units in the database
+	Share     int    // units allotted to this region's cache, all of Inventory unless stock is split
+	Stock     int    // units in the cache
+	Problem   string // why the item is not ready, empty if it is
+}
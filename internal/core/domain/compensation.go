@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// StockCompensation records units whose return to the cache stock counter
+// failed, so they can be returned later instead of being lost.
+type StockCompensation struct {
+	ID       string
+	ItemID   string
+	Quantity int
+	// Reason says what the units were being returned for, e.g. the order
+	Reason string
+	// Attempts counts failed returns; LastError is the most recent failure
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// couponCodePattern keeps codes safe to embed in cache keys, like item IDs.
+var couponCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidCouponCode reports whether code is a well-formed coupon code.
+func ValidCouponCode(code string) bool {
+	return couponCodePattern.MatchString(code)
+}
+
+// Coupon is a discount code applied to a whole order. It takes either a
+// percentage or a fixed amount off the order total.
+type Coupon struct {
+	Code string
+
+	// PercentOff takes 1 to 100 percent off; AmountOff takes a fixed amount
+	// in minor units of Currency off. Exactly one of them is set
+	PercentOff int
+	AmountOff  int64
+	Currency   string
+
+	// MaxUses caps the orders that may use the coupon; 0 for no cap
+	MaxUses int
+
+	// The coupon can be redeemed from StartsAt until EndsAt
+	StartsAt time.Time
+	EndsAt   time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (c Coupon) Validate() error {
+	if !ValidCouponCode(c.Code) {
+		return errors.New("coupon code may only contain letters, digits, '_' and '-', up to 32 characters")
+	}
+	switch {
+	case c.PercentOff != 0 && c.AmountOff != 0:
+		return errors.New("coupon must have either a percent or an amount off, not both")
+	case c.PercentOff == 0 && c.AmountOff == 0:
+		return errors.New("coupon must have a percent or an amount off")
+	case c.PercentOff < 0 || c.PercentOff > 100:
+		return errors.New("percent off must be between 1 and 100")
+	case c.AmountOff < 0:
+		return errors.New("amount off must not be negative")
+	case c.AmountOff > 0 && !currencyPattern.MatchString(c.Currency):
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	if c.MaxUses < 0 {
+		return errors.New("max uses must not be negative")
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		return errors.New("coupon must end after it starts")
+	}
+	return nil
+}
+
+// Active reports whether the coupon can be redeemed at t.
+func (c Coupon) Active(t time.Time) bool {
+	return !t.Before(c.StartsAt) && t.Before(c.EndsAt)
+}
+
+// Discount returns the amount taken off an order total. It never exceeds
+// the total, and percentages round down.
+func (c Coupon) Discount(total int64) int64 {
+	if c.PercentOff > 0 {
+		return total * int64(c.PercentOff) / 100
+	}
+	return min(c.AmountOff, total)
+}
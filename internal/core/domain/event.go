@@ -0,0 +1,97 @@
+package domain
+
+import "time"
+
+type EventType string
+
+const (
+	EventOrderAccepted  EventType = "order.accepted"
+	EventOrderPersisted EventType = "order.persisted"
+	EventOrderFailed    EventType = "order.failed"
+	EventRollbackFailed EventType = "order.rollback_failed"
+	EventStockDepleted  EventType = "stock.depleted"
+)
+
+// Event is something that happened during the sale, published on the event
+// bus to the subscribers of its type.
+type Event interface {
+	EventType() EventType
+	// EventKey names what the event is about, an order or an item; brokers
+	// keep the events with one key in order
+	EventKey() string
+}
+
+// OrderSummary is what the order events tell about their order.
+type OrderSummary struct {
+	OrderID    string    `json:"order_id"`
+	RequestID  string    `json:"request_id,omitempty"`
+	UserID     string    `json:"user_id"`
+	ItemID     string    `json:"item_id"`
+	Quantity   int       `json:"quantity"`
+	TotalPrice int64     `json:"total_price"`
+	Currency   string    `json:"currency,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+}
+
+func SummarizeOrder(order Order) OrderSummary {
+	return OrderSummary{
+		OrderID:    order.ID,
+		RequestID:  order.RequestID,
+		UserID:     order.UserID,
+		ItemID:     order.ItemID,
+		Quantity:   order.Quantity,
+		TotalPrice: order.TotalPrice,
+		Currency:   order.Currency,
+		ExpiresAt:  order.ExpiresAt,
+	}
+}
+
+func (o OrderSummary) EventKey() string { return o.OrderID }
+
+// OrderAccepted is published when a purchase took its stock and its order
+// was queued for the workers.
+type OrderAccepted struct {
+	OrderSummary
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+func (OrderAccepted) EventType() EventType { return EventOrderAccepted }
+
+// OrderPersisted is published when a worker saved an order.
+type OrderPersisted struct {
+	OrderSummary
+	PersistedAt time.Time `json:"persisted_at"`
+}
+
+func (OrderPersisted) EventType() EventType { return EventOrderPersisted }
+
+// OrderFailed is published when a worker gave up saving an order and rolled
+// its stock back.
+type OrderFailed struct {
+	OrderSummary
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func (OrderFailed) EventType() EventType { return EventOrderFailed }
+
+// RollbackFailed is published when the stock of an order that was never
+// saved could not be given back, even to the compensation log, so those
+// units are lost until someone corrects the stock.
+type RollbackFailed struct {
+	OrderSummary
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func (RollbackFailed) EventType() EventType { return EventRollbackFailed }
+
+// StockDepleted is published the first time a server turns a purchase away
+// from an item with no stock left.
+type StockDepleted struct {
+	ItemID     string    `json:"item_id"`
+	DepletedAt time.Time `json:"depleted_at"`
+}
+
+func (StockDepleted) EventType() EventType { return EventStockDepleted }
+func (e StockDepleted) EventKey() string   { return e.ItemID }
@@ -5,8 +5,52 @@ import "time"
 type Inventory struct {
 	ID        string
 	ItemID    string
+	TenantID  string // merchant owning the item, empty for the default tenant
 	Quantity  int
 	Version   int // optimistic locking
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// StockDrift compares an item's cache stock with the stock expected from
+// the database: its inventory less the units of orders not yet saved to it
+// and of compensations not yet applied to the cache.
+type StockDrift struct {
+	ItemID   string
+	Cache    int
+	Expected int
+}
+
+// Excess is how many more units the cache holds than expected. Units in
+// excess may be sold twice.
+func (d StockDrift) Excess() int {
+	return d.Cache - d.Expected
+}
+
+// StockDecrement is the result of an attempt to take stock from the cache.
+type StockDecrement int
+
+const (
+	StockDecremented StockDecrement = iota
+	StockNoSuchItem
+	StockInsufficient
+	StockFrozen
+	StockSaleClosed
+)
+
+func (d StockDecrement) String() string {
+	switch d {
+	case StockDecremented:
+		return "decremented"
+	case StockNoSuchItem:
+		return "no_such_item"
+	case StockInsufficient:
+		return "insufficient"
+	case StockFrozen:
+		return "frozen"
+	case StockSaleClosed:
+		return "sale_closed"
+	default:
+		return "unknown"
+	}
+}
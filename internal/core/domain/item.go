@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// itemIDPattern keeps item IDs safe to embed in cache keys: braces would
+// break their hash tags and colons their key segments.
+var itemIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// DefaultCurrency is the currency of items created without one.
+const DefaultCurrency = "USD"
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidItemID reports whether id is a well-formed item ID.
+func ValidItemID(id string) bool {
+	return itemIDPattern.MatchString(id)
+}
+
+// ValidTenantID reports whether id is a well-formed tenant ID. Tenant IDs
+// are embedded in cache keys too, so they follow the rules of item IDs.
+func ValidTenantID(id string) bool {
+	return itemIDPattern.MatchString(id)
+}
+
+// Item is a product that can be put on sale. Its stock is kept in the
+// inventory table and mirrored to the cache.
+type Item struct {
+	ID       string
+	TenantID string // merchant the item belongs to, empty for the default tenant
+	Name     string
+	Stock    int // current inventory level; the initial stock when creating
+
+	// Price is the unit price in minor units of Currency, an ISO 4217 code.
+	// Price tiers configured for the item take precedence.
+	Price    int64
+	Currency string
+	// MaxPerUser caps the units one user may buy across purchases; 0 for
+	// no cap.
+	MaxPerUser int
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (i Item) Validate() error {
+	if i.ID == "" {
+		return errors.New("item id is required")
+	}
+	if !ValidItemID(i.ID) {
+		return errors.New("item id may only contain letters, digits, '_', '.' and '-', up to 64 characters")
+	}
+	if i.Name == "" {
+		return errors.New("item name is required")
+	}
+	if i.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+	if i.Price < 0 {
+		return errors.New("price must not be negative")
+	}
+	if !currencyPattern.MatchString(i.Currency) {
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	if i.MaxPerUser < 0 {
+		return errors.New("max per user must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// LotteryEntry is a purchase request entered into an item's lottery. Each
+// user enters an item once; the request is purchased only if the entry is
+// drawn.
+type LotteryEntry struct {
+	RequestID      string    `json:"request_id"`
+	UserID         string    `json:"user_id"`
+	ItemID         string    `json:"item_id"`
+	Quantity       int       `json:"quantity"`
+	CouponCode     string    `json:"coupon_code,omitempty"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	EnteredAt      time.Time `json:"entered_at"`
+}
+
+// LotteryDraw is the outcome of drawing an item's lottery.
+type LotteryDraw struct {
+	ItemID  string
+	Entries int // entries drawn, winning or not
+	Winners int // entries that became orders
+	DrawnAt time.Time
+}
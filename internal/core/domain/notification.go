@@ -0,0 +1,24 @@
+package domain
+
+type NotificationKind string
+
+const (
+	// NotificationOrderPlaced tells a buyer their purchase was saved: they
+	// got one
+	NotificationOrderPlaced NotificationKind = "order_placed"
+	// NotificationHoldExpired tells a buyer their order was not confirmed in
+	// time and its stock went back on sale
+	NotificationHoldExpired NotificationKind = "hold_expired"
+)
+
+// Notification is a message to a user about one of their orders. How it
+// reaches them, by email, SMS or push, is up to the notifier.
+type Notification struct {
+	Kind     NotificationKind
+	UserID   string
+	OrderID  string
+	ItemID   string
+	Quantity int
+	Subject  string
+	Body     string
+}
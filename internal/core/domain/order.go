@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type OrderStatus string
 
@@ -8,14 +11,151 @@ const (
 	OrderStatusPending   OrderStatus = "pending"
 	OrderStatusConfirmed OrderStatus = "confirmed"
 	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+	// OrderStatusExpired is a pending order cancelled because its stock hold
+	// lapsed before it was confirmed
+	OrderStatusExpired OrderStatus = "expired"
 )
 
+// ReleasesStock reports whether moving an order to the status gives its
+// units back.
+func (s OrderStatus) ReleasesStock() bool {
+	return s == OrderStatusCancelled || s == OrderStatusExpired
+}
+
+// Order is a purchase of one item, or of several when Items is set. A
+// multi-line order's ItemID is its first line's item, its Quantity the units
+// of all lines and its TotalPrice their sum; it has no single UnitPrice.
 type Order struct {
 	ID        string
+	TenantID  string // merchant whose sale the order is from, empty for the default tenant
 	UserID    string
 	ItemID    string
 	Quantity  int
 	Status    OrderStatus
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// UnitPrice and TotalPrice are in minor units of Currency, captured
+	// from the item's price tiers or catalog price at purchase time so later
+	// price changes leave the order as it was sold
+	UnitPrice  int64
+	TotalPrice int64
+	Currency   string
+
+	// CouponCode is the coupon applied to the order and Discount the amount
+	// it took off; TotalPrice is what remains after the discount
+	CouponCode string
+	Discount   int64
+
+	// Items holds the lines of a multi-line order
+	Items []OrderItem
+
+	// AllocationID is set for orders fulfilled from a partner allocation
+	AllocationID string
+
+	// ExpiresAt is when a pending order's stock hold lapses unless the order
+	// is confirmed; zero means it never does
+	ExpiresAt time.Time
+
+	// PaymentID is the gateway authorization that paid for a confirmed order
+	PaymentID string
+
+	// Tier is the buyer's tier when the order was placed. VIP orders skip
+	// ahead of others on their way to the database; it is not stored
+	Tier UserTier
+
+	// RiskScore is the fraud risk score given to the purchase, from 0 to
+	// 100, and RiskFlagged marks an order the scorer wants reviewed
+	RiskScore   int
+	RiskFlagged bool
+
+	// RequestID and IdempotencyKey identify the purchase that placed the
+	// order, so its final result can be reported back to the client
+	RequestID      string
+	IdempotencyKey string
+
+	// TraceContext carries the purchase's trace across the async queue so
+	// persistence spans join the original trace
+	TraceContext map[string]string
+}
+
+// OrderItem is one line of an order.
+type OrderItem struct {
+	ItemID     string
+	Quantity   int
+	UnitPrice  int64
+	TotalPrice int64
+}
+
+// Lines returns the order's lines. A single-item order has one, made from
+// its ItemID, Quantity and prices.
+func (o Order) Lines() []OrderItem {
+	if len(o.Items) > 0 {
+		return o.Items
+	}
+	return []OrderItem{{ItemID: o.ItemID, Quantity: o.Quantity, UnitPrice: o.UnitPrice, TotalPrice: o.TotalPrice}}
+}
+
+// OrderFilter selects a page of one user's orders, newest first. Zero
+// fields do not filter; From is inclusive and To exclusive.
+type OrderFilter struct {
+	Status OrderStatus
+	From   time.Time
+	To     time.Time
+
+	// After resumes the listing past the last order of the previous page
+	After *OrderCursor
+
+	Limit int
+}
+
+// OrderWindow selects the orders of a bulk read: those with a line of
+// ItemID, and created in [From, To). Zero fields do not filter. Bounding
+// the creation time lets a database partitioned by it read only the
+// partitions the window covers.
+type OrderWindow struct {
+	ItemID string
+	From   time.Time
+	To     time.Time
+}
+
+// Matches reports whether order is in the window.
+func (w OrderWindow) Matches(order Order) bool {
+	if !w.From.IsZero() && order.CreatedAt.Before(w.From) {
+		return false
+	}
+	if !w.To.IsZero() && !order.CreatedAt.Before(w.To) {
+		return false
+	}
+	return w.ItemID == "" || slices.ContainsFunc(order.Lines(), func(line OrderItem) bool { return line.ItemID == w.ItemID })
+}
+
+// OrderCursor is the position of an order in a user's order history.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Matches reports whether order passes the filter's status, time range and
+// cursor. It does not check the limit.
+func (f OrderFilter) Matches(order Order) bool {
+	if f.Status != "" && order.Status != f.Status {
+		return false
+	}
+	if !f.From.IsZero() && order.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !order.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.After != nil {
+		if order.CreatedAt.After(f.After.CreatedAt) {
+			return false
+		}
+		if order.CreatedAt.Equal(f.After.CreatedAt) && order.ID >= f.After.ID {
+			return false
+		}
+	}
+	return true
 }
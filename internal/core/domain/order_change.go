@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrderChangeType is what happened to an order. The types that move an
+// order to a status are named after the status.
+type OrderChangeType string
+
+const (
+	// OrderChangeAccepted records the order as the purchase placed it
+	OrderChangeAccepted OrderChangeType = "accepted"
+	// OrderChangePersisted records that the order was saved, after
+	// waiting in the queue since it was accepted
+	OrderChangePersisted OrderChangeType = "persisted"
+	OrderChangeConfirmed OrderChangeType = "confirmed"
+	OrderChangeCancelled OrderChangeType = "cancelled"
+	OrderChangeExpired   OrderChangeType = "expired"
+	OrderChangeRefunded  OrderChangeType = "refunded"
+	// OrderChangeArchived records that the order was moved out of reach of
+	// the API by the archive job
+	OrderChangeArchived OrderChangeType = "archived"
+)
+
+var ErrInvalidOrderChanges = errors.New("invalid order changes")
+
+// StatusChange returns the type of the change that moves an order to
+// status.
+func StatusChange(status OrderStatus) OrderChangeType {
+	return OrderChangeType(status)
+}
+
+// OrderChange is one entry of an order's change log, kept by the
+// event-sourced order store. Seq orders the changes of every order in the
+// sale.
+type OrderChange struct {
+	Seq     int64
+	OrderID string
+	Type    OrderChangeType
+	// Order is the order as accepted, set on accepted changes only
+	Order *Order
+	// PaymentID is the payment that confirmed the order, on confirmed
+	// changes
+	PaymentID  string
+	OccurredAt time.Time
+}
+
+// ReplayOrder derives an order's state from its changes, oldest first. It
+// returns nil for an order without changes or one that was archived.
+func ReplayOrder(changes []OrderChange) (*Order, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	first := changes[0]
+	if first.Type != OrderChangeAccepted || first.Order == nil {
+		return nil, fmt.Errorf("%w: order %s starts with %s", ErrInvalidOrderChanges, first.OrderID, first.Type)
+	}
+
+	order := *first.Order
+	for _, change := range changes[1:] {
+		if change.OrderID != order.ID {
+			return nil, fmt.Errorf("%w: change %d is of order %s, not %s", ErrInvalidOrderChanges, change.Seq, change.OrderID, order.ID)
+		}
+		switch change.Type {
+		case OrderChangePersisted:
+		case OrderChangeConfirmed:
+			order.Status = OrderStatusConfirmed
+			order.PaymentID = change.PaymentID
+			order.UpdatedAt = change.OccurredAt
+		case OrderChangeCancelled, OrderChangeExpired, OrderChangeRefunded:
+			order.Status = OrderStatus(change.Type)
+			order.UpdatedAt = change.OccurredAt
+		case OrderChangeArchived:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%w: change %d has unknown type %s", ErrInvalidOrderChanges, change.Seq, change.Type)
+		}
+	}
+	return &order, nil
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+type OrderEventType string
+
+const (
+	// OrderEventExpired is published when a hold lapses and the order's
+	// stock is released
+	OrderEventExpired OrderEventType = "order.expired"
+)
+
+// OrderEvent tells other parts of the system, such as a notifier messaging
+// the buyer, that something happened to an order.
+type OrderEvent struct {
+	Type       OrderEventType `json:"type"`
+	OrderID    string         `json:"order_id"`
+	UserID     string         `json:"user_id"`
+	ItemID     string         `json:"item_id"`
+	Quantity   int            `json:"quantity"`
+	OccurredAt time.Time      `json:"occurred_at"`
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+type PaymentStatus string
+
+const (
+	PaymentStatusSucceeded PaymentStatus = "succeeded"
+	PaymentStatusFailed    PaymentStatus = "failed"
+)
+
+// PaymentEvent is published by the payment system once a payment for an
+// order has settled.
+type PaymentEvent struct {
+	OrderID    string        `json:"order_id"`
+	Status     PaymentStatus `json:"status"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// PaymentRequest asks the payment gateway to authorize an order's total.
+type PaymentRequest struct {
+	OrderID string
+	UserID  string
+	// Amount is in minor currency units
+	Amount int64
+	// Token is the client's tokenized payment method
+	Token string
+}
+
+// PaymentAuthorization is the gateway's answer to a PaymentRequest. A
+// declined request is not an error; DeclineReason says why.
+type PaymentAuthorization struct {
+	ID            string
+	Approved      bool
+	DeclineReason string
+}
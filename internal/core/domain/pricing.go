@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PriceTier sets the unit price, in minor currency units, for purchases of
+// at least MinQuantity units.
+type PriceTier struct {
+	MinQuantity int
+	UnitPrice   int64
+}
+
+// PriceSchedule holds an item's tiers in ascending MinQuantity order. The
+// first tier must start at one unit so every quantity has a price.
+type PriceSchedule []PriceTier
+
+func (p PriceSchedule) Validate() error {
+	if len(p) == 0 || p[0].MinQuantity != 1 {
+		return errors.New("first tier must start at quantity 1")
+	}
+	for i, tier := range p {
+		if tier.UnitPrice < 0 {
+			return fmt.Errorf("tier %d has a negative price", tier.MinQuantity)
+		}
+		if i > 0 && tier.MinQuantity <= p[i-1].MinQuantity {
+			return fmt.Errorf("tier %d is out of order", tier.MinQuantity)
+		}
+	}
+	return nil
+}
+
+// UnitPrice returns the price per unit for the highest tier quantity reaches.
+func (p PriceSchedule) UnitPrice(quantity int) int64 {
+	var price int64
+	for _, tier := range p {
+		if quantity < tier.MinQuantity {
+			break
+		}
+		price = tier.UnitPrice
+	}
+	return price
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "slices"
+
+// Role grants access to a group of operator actions.
+type Role string
+
+const (
+	// RoleAdmin may read and change anything.
+	RoleAdmin Role = "admin"
+	// RoleViewer may only read.
+	RoleViewer Role = "viewer"
+)
+
+// Principal is an authenticated caller. A principal with a Tenant only
+// acts on that merchant's sale; one without is an operator of the whole
+// deployment.
+type Principal struct {
+	Subject string
+	Roles   []Role
+	Tenant  string
+}
+
+// HasRole reports whether p was granted role. Admins hold every role.
+func (p Principal) HasRole(role Role) bool {
+	return slices.Contains(p.Roles, role) || slices.Contains(p.Roles, RoleAdmin)
+}
+
+// Credentials are what a caller presented to prove who it is. At most one
+// field is usually set.
+type Credentials struct {
+	APIKey      string
+	BearerToken string
+}
@@ -0,0 +1,78 @@
+package domain
+
+import "time"
+
+type PurchaseStatus string
+
+const (
+	// PurchaseStatusQueued marks an accepted asynchronous purchase that has
+	// not been processed yet.
+	PurchaseStatusQueued       PurchaseStatus = "queued"
+	PurchaseStatusSucceeded    PurchaseStatus = "succeeded"
+	PurchaseStatusSoldOut      PurchaseStatus = "sold_out"
+	PurchaseStatusItemNotFound PurchaseStatus = "item_not_found"
+	PurchaseStatusSaleClosed   PurchaseStatus = "sale_closed"
+	// PurchaseStatusLimitExceeded rejects a purchase that would take the
+	// user past the item's per-user limit.
+	PurchaseStatusLimitExceeded PurchaseStatus = "limit_exceeded"
+	// PurchaseStatusCouponRejected and PurchaseStatusCouponExhausted reject
+	// a purchase whose coupon does not apply or has been used up.
+	PurchaseStatusCouponRejected  PurchaseStatus = "coupon_rejected"
+	PurchaseStatusCouponExhausted PurchaseStatus = "coupon_exhausted"
+	// PurchaseStatusEntered marks a lottery entry waiting for the draw, and
+	// PurchaseStatusNotDrawn one the draw passed over.
+	PurchaseStatusEntered  PurchaseStatus = "entered"
+	PurchaseStatusNotDrawn PurchaseStatus = "not_drawn"
+	// PurchaseStatusRiskRejected rejects a purchase scored as fraudulent.
+	PurchaseStatusRiskRejected PurchaseStatus = "risk_rejected"
+	// PurchaseStatusDuplicate marks a request turned away because another
+	// request with the same idempotency key was in flight or done.
+	PurchaseStatusDuplicate PurchaseStatus = "duplicate"
+	PurchaseStatusFailed    PurchaseStatus = "failed"
+)
+
+// OrderResult is the final outcome of a purchase request: succeeded once
+// its order is persisted, or a rejection or failure, including orders the
+// workers rolled back.
+type OrderResult struct {
+	RequestID string         `json:"request_id"`
+	OrderID   string         `json:"order_id,omitempty"`
+	Status    PurchaseStatus `json:"status"`
+}
+
+// PurchaseResult is the outcome of a purchase request, stored under its
+// idempotency key so that retries receive the original response.
+type PurchaseResult struct {
+	OrderID string
+	Status  PurchaseStatus
+}
+
+// PurchaseRecord is the latest known outcome of a purchase request, kept by
+// request ID whatever the idempotency mode. Reason is the error that
+// stopped a request that did not succeed.
+type PurchaseRecord struct {
+	RequestID string         `json:"request_id"`
+	UserID    string         `json:"user_id"`
+	OrderID   string         `json:"order_id,omitempty"`
+	Status    PurchaseStatus `json:"status"`
+	Reason    string         `json:"reason,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// PurchaseOutcome is one purchase request and how it ended, streamed to
+// analytics whether it succeeded or was turned away. Outcome is the outcome
+// reported to the metrics, such as "success" or "sold_out", and Reason the
+// error of an attempt that did not succeed.
+type PurchaseOutcome struct {
+	RequestID  string
+	UserID     string
+	Items      []OrderItem
+	Outcome    string
+	Reason     string
+	OrderID    string
+	ClientIP   string
+	DeviceID   string
+	Coupon     string
+	Duration   time.Duration
+	OccurredAt time.Time
+}
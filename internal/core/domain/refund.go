@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// RefundStep is how far a refund has progressed. Steps run in declaration
+// order, each one only after the previous one succeeded.
+type RefundStep string
+
+const (
+	RefundStepPayment   RefundStep = "refund_payment"
+	RefundStepInventory RefundStep = "restore_inventory"
+	RefundStepStatus    RefundStep = "update_status"
+	RefundStepDone      RefundStep = "done"
+)
+
+// Refund is the persisted state of refunding a confirmed order, so a refund
+// interrupted by a failure resumes at the step it stopped at.
+type Refund struct {
+	ID        string
+	OrderID   string
+	PaymentID string
+	// Amount is in minor currency units
+	Amount int64
+	Reason string
+	Step   RefundStep
+	// Attempts counts failed runs of the current step; LastError is the most
+	// recent failure
+	Attempts  int
+	LastError string
+	// Version guards against two servers advancing the same refund
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// RegionStock is the unsold stock of an item held by one region's cache.
+type RegionStock struct {
+	Region string
+	Stock  int
+}
+
+// StockRebalance moves unsold units of an item from one region to another,
+// with the stock of every region once they were moved.
+type StockRebalance struct {
+	ItemID       string
+	From         string
+	To           string
+	Quantity     int
+	Regions      []RegionStock
+	RebalancedAt time.Time
+}
+
+// SplitStock divides total units between regions in proportion to their
+// shares, e.g. 60 and 40. Units left over from rounding down go to the
+// regions with the largest remainders, ties to the first region by name, so
+// the parts always add up to total.
+func SplitStock(total int, shares map[string]int) map[string]int {
+	var sum int
+	for _, share := range shares {
+		sum += share
+	}
+	parts := make(map[string]int, len(shares))
+	if sum <= 0 {
+		return parts
+	}
+
+	type remainder struct {
+		region string
+		rest   int
+	}
+	var remainders []remainder
+	left := total
+	for region, share := range shares {
+		parts[region] = total * share / sum
+		left -= parts[region]
+		remainders = append(remainders, remainder{region, total * share % sum})
+	}
+	slices.SortFunc(remainders, func(a, b remainder) int {
+		if c := cmp.Compare(b.rest, a.rest); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.region, b.region)
+	})
+	for i := 0; i < left; i++ {
+		parts[remainders[i%len(remainders)].region]++
+	}
+	return parts
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Restock is an audited addition of units to an item's inventory.
+type Restock struct {
+	ItemID   string
+	Quantity int
+	// Actor and Reason are free text supplied by the operator
+	Actor       string
+	Reason      string
+	StockBefore int
+	StockAfter  int
+	CreatedAt   time.Time
+}
@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// RiskAction is what a risk assessment decides to do with a purchase.
+type RiskAction string
+
+const (
+	RiskAllow RiskAction = "allow"
+	// RiskFlag lets the purchase through but marks its order for review.
+	RiskFlag RiskAction = "flag"
+	// RiskReject refuses the purchase before any stock is taken.
+	RiskReject RiskAction = "reject"
+)
+
+// PurchaseAttempt is what a risk scorer knows about a purchase. ClientIP and
+// DeviceID are empty when the client did not supply them.
+type PurchaseAttempt struct {
+	UserID   string
+	ClientIP string
+	DeviceID string
+	Items    []OrderItem
+	At       time.Time
+}
+
+// RiskAssessment is the score given to a purchase, from 0 to 100, the
+// action taken on it and the reasons behind the score.
+type RiskAssessment struct {
+	Score   int
+	Action  RiskAction
+	Reasons []string
+}
@@ -0,0 +1,58 @@
+package domain
+
+import "time"
+
+// SaleCounters are the live counters of one campaign's sale, kept by every
+// server selling it.
+type SaleCounters struct {
+	// Orders and SoldUnits count the orders saved by the workers and the
+	// units they sold; RecentOrders is the part of Orders saved in the rate
+	// window asked for
+	Orders       int64
+	SoldUnits    int64
+	RecentOrders int64
+
+	// Failures counts purchases turned away or orders that could not be
+	// saved, by outcome
+	Failures map[string]int64
+
+	// QueueDepth is the number of orders reserved but not yet taken by a
+	// worker, over every server
+	QueueDepth int64
+
+	// StartedAt is when the first order was saved, zero before then
+	StartedAt time.Time
+
+	// SoldOutAt is when each sold out item first turned a purchase away
+	SoldOutAt map[string]time.Time
+}
+
+// SaleStats summarizes a campaign's sale as it runs.
+type SaleStats struct {
+	CampaignID string
+	SaleCounters
+
+	// OrdersPerSecond is the rate orders were saved at over the last few
+	// seconds
+	OrdersPerSecond float64
+
+	// SoldOut is set once every item of the campaign has sold out;
+	// TimeToSellout is then how long after the start the last one did
+	SoldOut       bool
+	TimeToSellout time.Duration
+
+	// Items totals the saved orders of each of the campaign's items by
+	// status, from the order read model
+	Items []ItemOrderTotals
+}
+
+// ItemOrderTotals counts the orders with a line of one item in one status,
+// the units of the item they hold and what those lines cost, in minor units
+// of the item's currency.
+type ItemOrderTotals struct {
+	ItemID  string
+	Status  OrderStatus
+	Orders  int64
+	Units   int64
+	Revenue int64
+}
@@ -0,0 +1,16 @@
+package domain
+
+// UserTier is a user's service level. Users without a recorded tier are
+// TierNormal.
+type UserTier string
+
+const (
+	TierNormal UserTier = "normal"
+	// TierVIP users have their orders persisted ahead of others and may buy
+	// the stock reserved for them.
+	TierVIP UserTier = "vip"
+)
+
+func (t UserTier) Valid() bool {
+	return t == TierNormal || t == TierVIP
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrAllocationNotFound  = errors.New("allocation not found")
+	ErrAllocationExhausted = port.ErrAllocationExhausted
+)
+
+// AllocationService handles partner pre-allocations. Unlike consumer
+// purchases, allocations are persisted synchronously since partners need
+// the allocation ID before they can fulfill against it.
+type AllocationService struct {
+	cache       port.CacheRepository
+	db          port.DatabaseRepository
+	compensator *StockCompensator
+}
+
+type AllocationServiceOption func(*AllocationService)
+
+// WithAllocationCompensator returns the stock of allocations that cannot be
+// saved through c, so failed returns are retried rather than lost.
+func WithAllocationCompensator(c *StockCompensator) AllocationServiceOption {
+	return func(s *AllocationService) {
+		s.compensator = c
+	}
+}
+
+func NewAllocationService(cache port.CacheRepository, db port.DatabaseRepository, opts ...AllocationServiceOption) *AllocationService {
+	s := &AllocationService{cache: cache, db: db, compensator: NewStockCompensator(cache, nil)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Allocate claims a block of units for a partner from the same Redis stock
+// counter consumers buy from.
+func (s *AllocationService) Allocate(ctx context.Context, partnerID, itemID string, quantity int) (*domain.Allocation, error) {
+	decrement, err := s.cache.DecrementStock(ctx, itemID, quantity)
+	if err != nil {
+		return nil, fmt.Errorf("stock decrement failed: %w", err)
+	}
+	if err := stockError(decrement); err != nil {
+		return nil, err
+	}
+
+	alloc := domain.Allocation{
+		ID:        uuid.New().String(),
+		PartnerID: partnerID,
+		ItemID:    itemID,
+		Quantity:  quantity,
+		Status:    domain.AllocationStatusOpen,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := s.db.CreateAllocation(ctx, alloc); err != nil {
+		if rollbackErr := s.compensator.Restore(ctx, itemID, quantity, "allocation "+alloc.ID); rollbackErr != nil {
+			return nil, fmt.Errorf("create allocation: %w (rollback failed: %v)", err, rollbackErr)
+		}
+		// The cache had the units but the database does not, as when stock
+		// was sold outside the cache
+		if errors.Is(err, port.ErrOptimisticLock) {
+			return nil, ErrInsufficientStock
+		}
+		return nil, fmt.Errorf("create allocation: %w", err)
+	}
+
+	return &alloc, nil
+}
+
+// Fulfill records an itemized order for one of the partner's end customers
+// against a previously claimed allocation.
+func (s *AllocationService) Fulfill(ctx context.Context, partnerID, allocationID, userID string, quantity int) (string, error) {
+	alloc, err := s.db.GetAllocation(ctx, allocationID)
+	if err != nil {
+		return "", fmt.Errorf("get allocation: %w", err)
+	}
+	if alloc == nil || alloc.PartnerID != partnerID {
+		return "", ErrAllocationNotFound
+	}
+	// Checked again by the database, for fulfillments racing this one
+	if alloc.Remaining() < quantity {
+		return "", ErrAllocationExhausted
+	}
+
+	order := domain.Order{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		ItemID:       alloc.ItemID,
+		Quantity:     quantity,
+		Status:       domain.OrderStatusConfirmed,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		AllocationID: alloc.ID,
+	}
+
+	if err := s.db.FulfillAllocation(ctx, order); err != nil {
+		return "", fmt.Errorf("fulfill allocation: %w", err)
+	}
+
+	return order.ID, nil
+}
@@ -0,0 +1,549 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Mock DatabaseRepository
+type mockDatabaseRepo struct {
+	orders      map[string]domain.Order
+	allocations map[string]domain.Allocation
+	archives    []domain.CampaignArchive
+	inventory   map[string]domain.Inventory
+	restocks    []domain.Restock
+	items       map[string]domain.Item
+	campaigns   map[string]domain.Campaign
+	conflicts   int // number of RestockInventory calls to fail with a version conflict
+	failCreate  bool
+	noStock     bool // fail CreateAllocation as the database's inventory is short
+	failBatch   bool
+	failOrders  int   // number of CreateOrder calls to fail
+	lostReplies int   // number of CreateOrder calls to save but time out
+	orderErr    error // returned by every order write when set
+	writes      int   // order writes made
+	batches     int
+	projected   []string // IDs passed to ProjectOrders
+	mu          sync.Mutex
+}
+
+func newMockDatabaseRepo() *mockDatabaseRepo {
+	return &mockDatabaseRepo{
+		orders:      make(map[string]domain.Order),
+		allocations: make(map[string]domain.Allocation),
+		inventory:   make(map[string]domain.Inventory),
+		items:       make(map[string]domain.Item),
+		campaigns:   make(map[string]domain.Campaign),
+	}
+}
+
+func (m *mockDatabaseRepo) CreateOrder(ctx context.Context, order domain.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writes++
+	if m.orderErr != nil {
+		return m.orderErr
+	}
+	if m.failOrders > 0 {
+		m.failOrders--
+		return errors.New("db down")
+	}
+	m.orders[order.ID] = order
+	if m.lostReplies > 0 {
+		m.lostReplies--
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func (m *mockDatabaseRepo) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.writes++
+	if m.orderErr != nil {
+		return m.orderErr
+	}
+	if m.failBatch {
+		return errors.New("batch failed")
+	}
+	m.batches++
+	for _, order := range orders {
+		m.orders[order.ID] = order
+	}
+	return nil
+}
+
+func (m *mockDatabaseRepo) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, nil
+	}
+	return &order, nil
+}
+
+func (m *mockDatabaseRepo) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok || order.Status != from {
+		return false, nil
+	}
+	order.Status = to
+	m.orders[id] = order
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[id]
+	if !ok || order.Status != domain.OrderStatusPending {
+		return false, nil
+	}
+	order.Status = domain.OrderStatusConfirmed
+	order.PaymentID = paymentID
+	m.orders[id] = order
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) ExpiredOrders(ctx context.Context, before time.Time, limit int) ([]domain.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []domain.Order
+	for _, order := range m.orders {
+		if order.Status == domain.OrderStatusPending && !order.ExpiresAt.IsZero() && !order.ExpiresAt.After(before) && len(expired) < limit {
+			expired = append(expired, order)
+		}
+	}
+	return expired, nil
+}
+
+func (m *mockDatabaseRepo) ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []domain.Order
+	for _, order := range m.orders {
+		if order.UserID == userID && filter.Matches(order) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(a, b domain.Order) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	if len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+	}
+	return orders, nil
+}
+
+func (m *mockDatabaseRepo) ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) ([]domain.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders []domain.Order
+	for _, order := range m.orders {
+		if order.ID > afterID && window.Matches(order) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(a, b domain.Order) int { return strings.Compare(a.ID, b.ID) })
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+// The mock is its own read model, always up to date with the orders.
+func (m *mockDatabaseRepo) ProjectOrders(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.projected = append(m.projected, ids...)
+	return nil
+}
+
+func (m *mockDatabaseRepo) ListOrderViews(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error) {
+	return m.ListOrdersByUser(ctx, userID, filter)
+}
+
+func (m *mockDatabaseRepo) ItemOrderTotals(ctx context.Context, itemIDs []string) ([]domain.ItemOrderTotals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var totals []domain.ItemOrderTotals
+	for _, order := range m.orders {
+		if !slices.Contains(itemIDs, order.ItemID) {
+			continue
+		}
+		i := slices.IndexFunc(totals, func(t domain.ItemOrderTotals) bool { return t.ItemID == order.ItemID && t.Status == order.Status })
+		if i < 0 {
+			totals = append(totals, domain.ItemOrderTotals{ItemID: order.ItemID, Status: order.Status})
+			i = len(totals) - 1
+		}
+		totals[i].Orders++
+		totals[i].Units += int64(order.Quantity)
+		totals[i].Revenue += order.TotalPrice
+	}
+	return totals, nil
+}
+
+func (m *mockDatabaseRepo) SaveCampaignArchive(ctx context.Context, archive domain.CampaignArchive) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failCreate {
+		return errors.New("db down")
+	}
+	m.archives = append(m.archives, archive)
+	return nil
+}
+
+func (m *mockDatabaseRepo) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inv, ok := m.inventory[itemID]
+	if !ok {
+		return nil, nil
+	}
+	return &inv, nil
+}
+
+func (m *mockDatabaseRepo) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conflicts > 0 {
+		m.conflicts--
+		current := m.inventory[inv.ItemID]
+		current.Quantity--
+		current.Version++
+		m.inventory[inv.ItemID] = current
+		return errors.New("optimistic lock conflict")
+	}
+	if m.inventory[inv.ItemID].Version != inv.Version {
+		return errors.New("optimistic lock conflict")
+	}
+	inv.Version++
+	m.inventory[inv.ItemID] = inv
+	m.restocks = append(m.restocks, restock)
+	return nil
+}
+
+func (m *mockDatabaseRepo) UpdateInventory(ctx context.Context, inventory domain.Inventory) error {
+	return nil
+}
+
+func (m *mockDatabaseRepo) CreateItem(ctx context.Context, item domain.Item) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failCreate {
+		return false, errors.New("db down")
+	}
+	if _, exists := m.items[item.ID]; exists {
+		return false, nil
+	}
+	m.items[item.ID] = item
+	m.inventory[item.ID] = domain.Inventory{ItemID: item.ID, TenantID: item.TenantID, Quantity: item.Stock}
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.items[id]
+	if !ok {
+		return nil, nil
+	}
+	item.Stock = m.inventory[id].Quantity
+	return &item, nil
+}
+
+func (m *mockDatabaseRepo) ListItems(ctx context.Context) ([]domain.Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []domain.Item
+	for _, item := range m.items {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (m *mockDatabaseRepo) UpdateItem(ctx context.Context, item domain.Item) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.items[item.ID]; !exists {
+		return false, nil
+	}
+	m.items[item.ID] = item
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.campaigns[campaign.ID]; exists {
+		return false, nil
+	}
+	m.campaigns[campaign.ID] = campaign
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	campaign, ok := m.campaigns[id]
+	if !ok {
+		return nil, nil
+	}
+	return &campaign, nil
+}
+
+func (m *mockDatabaseRepo) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var campaigns []domain.Campaign
+	for _, campaign := range m.campaigns {
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, nil
+}
+
+func (m *mockDatabaseRepo) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.campaigns[campaign.ID]; !exists {
+		return false, nil
+	}
+	m.campaigns[campaign.ID] = campaign
+	return true, nil
+}
+
+func (m *mockDatabaseRepo) CreateAllocation(ctx context.Context, alloc domain.Allocation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failCreate {
+		return errors.New("db down")
+	}
+	if m.noStock {
+		return port.ErrOptimisticLock
+	}
+	m.allocations[alloc.ID] = alloc
+	return nil
+}
+
+func (m *mockDatabaseRepo) GetAllocation(ctx context.Context, id string) (*domain.Allocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alloc, ok := m.allocations[id]
+	if !ok {
+		return nil, nil
+	}
+	return &alloc, nil
+}
+
+func (m *mockDatabaseRepo) FulfillAllocation(ctx context.Context, order domain.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alloc := m.allocations[order.AllocationID]
+	if alloc.Fulfilled+order.Quantity > alloc.Quantity {
+		return port.ErrAllocationExhausted
+	}
+	alloc.Fulfilled += order.Quantity
+	m.allocations[alloc.ID] = alloc
+	m.orders[order.ID] = order
+	return nil
+}
+
+func TestAllocate_Success(t *testing.T) {
+	cache := newMockCacheRepo(100)
+	db := newMockDatabaseRepo()
+	svc := NewAllocationService(cache, db)
+
+	alloc, err := svc.Allocate(context.Background(), "partner-1", "item-1", 40)
+	if err != nil {
+		t.Fatalf("allocate failed: %v", err)
+	}
+
+	if cache.stock != 60 {
+		t.Errorf("expected stock 60, got %d", cache.stock)
+	}
+	if _, ok := db.allocations[alloc.ID]; !ok {
+		t.Error("expected allocation to be persisted")
+	}
+	if alloc.Status != domain.AllocationStatusOpen {
+		t.Errorf("expected open status, got %s", alloc.Status)
+	}
+}
+
+func TestAllocate_InsufficientStock(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewAllocationService(cache, newMockDatabaseRepo())
+
+	_, err := svc.Allocate(context.Background(), "partner-1", "item-1", 11)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("expected ErrInsufficientStock, got: %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock 10, got %d", cache.stock)
+	}
+}
+
+func TestAllocate_RollbackOnPersistFailure(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	db := newMockDatabaseRepo()
+	db.failCreate = true
+	svc := NewAllocationService(cache, db)
+
+	_, err := svc.Allocate(context.Background(), "partner-1", "item-1", 5)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock restored to 10, got %d", cache.stock)
+	}
+}
+
+func TestAllocate_DatabaseShortOfStock(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	db := newMockDatabaseRepo()
+	db.noStock = true
+	svc := NewAllocationService(cache, db)
+
+	_, err := svc.Allocate(context.Background(), "partner-1", "item-1", 5)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("expected ErrInsufficientStock, got: %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock restored to 10, got %d", cache.stock)
+	}
+}
+
+// staleAllocations holds every GetAllocation until readers have read, so
+// they all pass the service's check and race in the database.
+type staleAllocations struct {
+	*mockDatabaseRepo
+	read sync.WaitGroup
+}
+
+func (s *staleAllocations) GetAllocation(ctx context.Context, id string) (*domain.Allocation, error) {
+	alloc, err := s.mockDatabaseRepo.GetAllocation(ctx, id)
+	s.read.Done()
+	s.read.Wait()
+	return alloc, err
+}
+
+func TestFulfill_ConcurrentExhaustion(t *testing.T) {
+	ctx := context.Background()
+	db := &staleAllocations{mockDatabaseRepo: newMockDatabaseRepo()}
+	alloc, err := NewAllocationService(newMockCacheRepo(100), db.mockDatabaseRepo).Allocate(ctx, "partner-1", "item-1", 3)
+	if err != nil {
+		t.Fatalf("allocate failed: %v", err)
+	}
+	svc := NewAllocationService(newMockCacheRepo(100), db)
+
+	const buyers = 8
+	db.read.Add(buyers)
+	errs := make(chan error, buyers)
+	for i := range buyers {
+		go func() {
+			_, err := svc.Fulfill(ctx, "partner-1", alloc.ID, fmt.Sprintf("user-%d", i), 1)
+			errs <- err
+		}()
+	}
+	fulfilled := 0
+	for range buyers {
+		err := <-errs
+		switch {
+		case err == nil:
+			fulfilled++
+		case !errors.Is(err, ErrAllocationExhausted):
+			t.Errorf("expected ErrAllocationExhausted past the allocation, got: %v", err)
+		}
+	}
+	if fulfilled != 3 {
+		t.Errorf("expected 3 fulfilled, got %d", fulfilled)
+	}
+}
+
+func TestFulfill(t *testing.T) {
+	cache := newMockCacheRepo(100)
+	db := newMockDatabaseRepo()
+	svc := NewAllocationService(cache, db)
+	ctx := context.Background()
+
+	alloc, err := svc.Allocate(ctx, "partner-1", "item-1", 3)
+	if err != nil {
+		t.Fatalf("allocate failed: %v", err)
+	}
+
+	orderID, err := svc.Fulfill(ctx, "partner-1", alloc.ID, "user-1", 2)
+	if err != nil {
+		t.Fatalf("fulfill failed: %v", err)
+	}
+
+	order := db.orders[orderID]
+	if order.AllocationID != alloc.ID {
+		t.Errorf("expected allocation %s, got %s", alloc.ID, order.AllocationID)
+	}
+	if order.ItemID != "item-1" {
+		t.Errorf("expected item-1, got %s", order.ItemID)
+	}
+
+	// Fulfillment never touches the shared stock counter
+	if cache.stock != 97 {
+		t.Errorf("expected stock 97, got %d", cache.stock)
+	}
+
+	_, err = svc.Fulfill(ctx, "partner-1", alloc.ID, "user-2", 2)
+	if !errors.Is(err, ErrAllocationExhausted) {
+		t.Errorf("expected ErrAllocationExhausted, got: %v", err)
+	}
+}
+
+func TestFulfill_OtherPartner(t *testing.T) {
+	cache := newMockCacheRepo(100)
+	svc := NewAllocationService(cache, newMockDatabaseRepo())
+	ctx := context.Background()
+
+	alloc, err := svc.Allocate(ctx, "partner-1", "item-1", 3)
+	if err != nil {
+		t.Fatalf("allocate failed: %v", err)
+	}
+
+	_, err = svc.Fulfill(ctx, "partner-2", alloc.ID, "user-1", 1)
+	if !errors.Is(err, ErrAllocationNotFound) {
+		t.Errorf("expected ErrAllocationNotFound, got: %v", err)
+	}
+}
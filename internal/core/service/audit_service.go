@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Audit log page sizes
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 500
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+// AuditService keeps the record of operator changes.
+type AuditService struct {
+	log port.AuditLog
+	now func() time.Time
+}
+
+// AuditPage is one page of audit records, newest first. NextBefore
+// continues the listing as the filter's BeforeID and is 0 on the last page.
+type AuditPage struct {
+	Records    []domain.AuditRecord
+	NextBefore int64
+}
+
+func NewAuditService(log port.AuditLog) *AuditService {
+	return &AuditService{log: log, now: time.Now}
+}
+
+// Record writes that actor made a change to target. before and after are
+// stored as JSON; nil leaves them empty. The change has already happened by
+// the time it is recorded, so the write is not cut short when ctx is.
+func (s *AuditService) Record(ctx context.Context, actor string, action domain.AuditAction, target string, before, after any, reason string) error {
+	record := domain.AuditRecord{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		Reason:    reason,
+		CreatedAt: s.now(),
+	}
+	var err error
+	if record.Before, err = auditJSON(before); err != nil {
+		return err
+	}
+	if record.After, err = auditJSON(after); err != nil {
+		return err
+	}
+
+	if _, err := s.log.AppendAudit(context.WithoutCancel(ctx), record); err != nil {
+		return fmt.Errorf("append audit record: %w", err)
+	}
+	return nil
+}
+
+// List returns the page of records selected by filter. A zero limit uses
+// DefaultAuditPageSize.
+func (s *AuditService) List(ctx context.Context, filter domain.AuditFilter) (*AuditPage, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	if filter.Limit < 1 || filter.Limit > MaxAuditPageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidAuditFilter, MaxAuditPageSize)
+	}
+	if filter.BeforeID < 0 {
+		return nil, fmt.Errorf("%w: before must be a record ID", ErrInvalidAuditFilter)
+	}
+
+	// One extra record tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	records, err := s.log.ListAudit(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list audit log: %w", err)
+	}
+
+	page := &AuditPage{Records: records}
+	if len(records) > limit {
+		page.Records = records[:limit]
+		page.NextBefore = page.Records[limit-1].ID
+	}
+	return page, nil
+}
+
+func auditJSON(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode audit state: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+type mockAuditLog struct {
+	mu      sync.Mutex
+	records []domain.AuditRecord
+}
+
+func (m *mockAuditLog) AppendAudit(ctx context.Context, record domain.AuditRecord) (*domain.AuditRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record.ID = int64(len(m.records) + 1)
+	m.records = append(m.records, record)
+	return &record, nil
+}
+
+func (m *mockAuditLog) ListAudit(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []domain.AuditRecord
+	for i := len(m.records) - 1; i >= 0 && len(records) < filter.Limit; i-- {
+		if filter.Matches(m.records[i]) {
+			records = append(records, m.records[i])
+		}
+	}
+	return records, nil
+}
+
+func TestAuditService(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	log := &mockAuditLog{}
+	audit := NewAuditService(log)
+
+	// A change is recorded even when its request has gone away
+	cancel()
+	before := map[string]int{"stock": 0}
+	after := map[string]int{"stock": 100}
+	if err := audit.Record(ctx, "ops", domain.AuditRestock, "item-1", before, after, "second batch"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	audit.Record(ctx, "ops", domain.AuditUserBan, "user-bad", nil, map[string]bool{"banned": true}, "")
+	audit.Record(ctx, "lead", domain.AuditRestock, "item-2", before, after, "")
+
+	record := log.records[0]
+	if record.Before != `{"stock":0}` || record.After != `{"stock":100}` || record.Reason != "second batch" || record.CreatedAt.IsZero() {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if log.records[1].Before != "" {
+		t.Errorf("expected no before state for a new ban, got %q", log.records[1].Before)
+	}
+
+	page, err := audit.List(context.Background(), domain.AuditFilter{Action: domain.AuditRestock, Limit: 1})
+	if err != nil || len(page.Records) != 1 || page.Records[0].Target != "item-2" || page.NextBefore != 3 {
+		t.Fatalf("unexpected first page: %+v, %v", page, err)
+	}
+	page, err = audit.List(context.Background(), domain.AuditFilter{Action: domain.AuditRestock, Limit: 1, BeforeID: page.NextBefore})
+	if err != nil || len(page.Records) != 1 || page.Records[0].Target != "item-1" || page.NextBefore != 0 {
+		t.Errorf("unexpected last page: %+v, %v", page, err)
+	}
+
+	for _, filter := range []domain.AuditFilter{{Limit: -1}, {Limit: MaxAuditPageSize + 1}, {BeforeID: -1}} {
+		if _, err := audit.List(context.Background(), filter); !errors.Is(err, ErrInvalidAuditFilter) {
+			t.Errorf("%+v: expected ErrInvalidAuditFilter, got %v", filter, err)
+		}
+	}
+}
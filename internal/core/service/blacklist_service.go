@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrBlacklisted    = errors.New("blacklisted")
+	ErrInvalidIPRange = errors.New("invalid IP range")
+)
+
+// BlacklistService bans users and client IP ranges from purchasing. Users
+// are looked up in the store on every purchase, so a ban applies on every
+// server at once. IP ranges cannot be looked up by address, so like tiers
+// they are read from a snapshot reloaded every interval.
+type BlacklistService struct {
+	store    port.Blacklist
+	interval time.Duration
+	ranges   atomic.Pointer[[]netip.Prefix]
+}
+
+func NewBlacklistService(store port.Blacklist, interval time.Duration) *BlacklistService {
+	s := &BlacklistService{store: store, interval: interval}
+	s.ranges.Store(&[]netip.Prefix{})
+	return s
+}
+
+// Run refreshes the IP range snapshot every interval until ctx is done,
+// keeping the last snapshot when a refresh fails.
+func (s *BlacklistService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("blacklist refresh failed: %v", err)
+		}
+	}
+}
+
+// Refresh replaces the snapshot with the IP ranges currently banned.
+func (s *BlacklistService) Refresh(ctx context.Context) error {
+	ranges, err := s.store.BannedIPRanges(ctx)
+	if err != nil {
+		return fmt.Errorf("list banned IP ranges: %w", err)
+	}
+	slices.SortFunc(ranges, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	s.ranges.Store(&ranges)
+	return nil
+}
+
+// Check returns ErrBlacklisted if the user or clientIP is banned. An empty
+// clientIP is not checked. When the store cannot be read the purchase is let
+// through, as it will fail on the stock anyway if Redis is down.
+func (s *BlacklistService) Check(ctx context.Context, userID, clientIP string) error {
+	if addr, err := netip.ParseAddr(clientIP); err == nil {
+		addr = addr.Unmap()
+		for _, prefix := range *s.ranges.Load() {
+			if prefix.Contains(addr) {
+				return fmt.Errorf("%w: client IP %s", ErrBlacklisted, addr)
+			}
+		}
+	}
+
+	banned, err := s.store.IsUserBanned(ctx, userID)
+	if err != nil {
+		log.Printf("blacklist check error: %v", err)
+		return nil
+	}
+	if banned {
+		return fmt.Errorf("%w: user %s", ErrBlacklisted, userID)
+	}
+	return nil
+}
+
+// BanUser bans the user from purchasing.
+func (s *BlacklistService) BanUser(ctx context.Context, userID string) error {
+	if err := s.store.BanUser(ctx, userID); err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+	return nil
+}
+
+// UnbanUser lets the user purchase again.
+func (s *BlacklistService) UnbanUser(ctx context.Context, userID string) error {
+	if err := s.store.UnbanUser(ctx, userID); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+	return nil
+}
+
+// BannedUsers returns the banned users by user ID.
+func (s *BlacklistService) BannedUsers(ctx context.Context) ([]string, error) {
+	return s.store.BannedUsers(ctx)
+}
+
+// BanIPRange bans purchases from a CIDR range or a single address. It
+// applies on this server right away and on others after their next refresh.
+func (s *BlacklistService) BanIPRange(ctx context.Context, cidr string) (netip.Prefix, error) {
+	prefix, err := ParseIPRange(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if err := s.store.BanIPRange(ctx, prefix); err != nil {
+		return netip.Prefix{}, fmt.Errorf("ban IP range: %w", err)
+	}
+	return prefix, s.Refresh(ctx)
+}
+
+// UnbanIPRange lifts the ban on a range banned with BanIPRange.
+func (s *BlacklistService) UnbanIPRange(ctx context.Context, cidr string) (netip.Prefix, error) {
+	prefix, err := ParseIPRange(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if err := s.store.UnbanIPRange(ctx, prefix); err != nil {
+		return netip.Prefix{}, fmt.Errorf("unban IP range: %w", err)
+	}
+	return prefix, s.Refresh(ctx)
+}
+
+// BannedIPRanges returns the IP ranges in the snapshot.
+func (s *BlacklistService) BannedIPRanges() []netip.Prefix {
+	return *s.ranges.Load()
+}
+
+// ParseIPRange parses a CIDR range, or an address as a range of one.
+func ParseIPRange(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, cidr)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %q", ErrInvalidIPRange, cidr)
+	}
+	return prefix.Masked(), nil
+}
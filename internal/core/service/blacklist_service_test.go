@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+type mockBlacklist struct {
+	users  map[string]bool
+	ranges map[netip.Prefix]bool
+	err    error
+}
+
+func newMockBlacklist() *mockBlacklist {
+	return &mockBlacklist{users: make(map[string]bool), ranges: make(map[netip.Prefix]bool)}
+}
+
+func (m *mockBlacklist) BanUser(ctx context.Context, userID string) error {
+	m.users[userID] = true
+	return nil
+}
+
+func (m *mockBlacklist) UnbanUser(ctx context.Context, userID string) error {
+	delete(m.users, userID)
+	return nil
+}
+
+func (m *mockBlacklist) IsUserBanned(ctx context.Context, userID string) (bool, error) {
+	return m.users[userID], m.err
+}
+
+func (m *mockBlacklist) BannedUsers(ctx context.Context) ([]string, error) {
+	var users []string
+	for user := range m.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (m *mockBlacklist) BanIPRange(ctx context.Context, prefix netip.Prefix) error {
+	m.ranges[prefix] = true
+	return nil
+}
+
+func (m *mockBlacklist) UnbanIPRange(ctx context.Context, prefix netip.Prefix) error {
+	delete(m.ranges, prefix)
+	return nil
+}
+
+func (m *mockBlacklist) BannedIPRanges(ctx context.Context) ([]netip.Prefix, error) {
+	var ranges []netip.Prefix
+	for prefix := range m.ranges {
+		ranges = append(ranges, prefix)
+	}
+	return ranges, nil
+}
+
+func TestBlacklistService_Check(t *testing.T) {
+	ctx := context.Background()
+	store := newMockBlacklist()
+	blacklist := NewBlacklistService(store, 0)
+
+	blacklist.BanUser(ctx, "user-bad")
+	if _, err := blacklist.BanIPRange(ctx, "203.0.113.7/24"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := blacklist.BanIPRange(ctx, "2001:db8::1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := blacklist.BanIPRange(ctx, "not-an-ip"); !errors.Is(err, ErrInvalidIPRange) {
+		t.Errorf("expected ErrInvalidIPRange, got %v", err)
+	}
+	if ranges := blacklist.BannedIPRanges(); len(ranges) != 2 || ranges[0].String() != "203.0.113.0/24" || ranges[1].String() != "2001:db8::1/128" {
+		t.Errorf("unexpected ranges: %v", ranges)
+	}
+
+	tests := []struct {
+		userID, clientIP string
+		banned           bool
+	}{
+		{"user-1", "198.51.100.1", false},
+		{"user-1", "", false},
+		{"user-bad", "198.51.100.1", true},
+		{"user-1", "203.0.113.200", true},
+		{"user-1", "::ffff:203.0.113.200", true},
+		{"user-1", "2001:db8::1", true},
+		{"user-1", "2001:db8::2", false},
+	}
+	for _, tt := range tests {
+		if err := blacklist.Check(ctx, tt.userID, tt.clientIP); errors.Is(err, ErrBlacklisted) != tt.banned {
+			t.Errorf("Check(%s, %s): expected banned %v, got %v", tt.userID, tt.clientIP, tt.banned, err)
+		}
+	}
+
+	blacklist.UnbanUser(ctx, "user-bad")
+	blacklist.UnbanIPRange(ctx, "203.0.113.0/24")
+	if err := blacklist.Check(ctx, "user-bad", "203.0.113.200"); err != nil {
+		t.Errorf("expected unbanned user and range to pass, got %v", err)
+	}
+
+	// An outage of the store lets purchases through
+	store.users["user-bad"] = true
+	store.err = errors.New("redis down")
+	if err := blacklist.Check(ctx, "user-bad", ""); err != nil {
+		t.Errorf("expected the purchase to pass when the store fails, got %v", err)
+	}
+}
+
+func TestOrderService_Blacklist(t *testing.T) {
+	ctx := context.Background()
+	store := newMockBlacklist()
+	blacklist := NewBlacklistService(store, 0)
+	blacklist.BanUser(ctx, "user-bad")
+	blacklist.BanIPRange(ctx, "10.0.0.0/8")
+
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 10, WithBlacklist(blacklist))
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-bad", "item-1", 1); !errors.Is(err, ErrBlacklisted) {
+		t.Fatalf("expected ErrBlacklisted, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "user-1", "item-1", 1, FromClientIP("10.1.2.3")); !errors.Is(err, ErrBlacklisted) {
+		t.Fatalf("expected ErrBlacklisted for a banned IP, got %v", err)
+	}
+	if err := svc.SubmitPurchase(ctx, "req-3", "user-bad", "item-1", 1); !errors.Is(err, ErrBlacklisted) {
+		t.Fatalf("expected ErrBlacklisted for a submitted purchase, got %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock untouched, got %d", cache.stock)
+	}
+	if OutcomeOf(ErrBlacklisted) != OutcomeBanned {
+		t.Errorf("expected outcome %q, got %q", OutcomeBanned, OutcomeOf(ErrBlacklisted))
+	}
+
+	// The rejected request did not claim its key, so it goes through once
+	// the ban is lifted
+	blacklist.UnbanUser(ctx, "user-bad")
+	if _, err := svc.Purchase(ctx, "req-1", "user-bad", "item-1", 1); err != nil {
+		t.Fatalf("expected purchase after unban, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// mockBotCheck accepts one token, or fails every call when err is set
+type mockBotCheck struct {
+	valid string
+	err   error
+	calls int
+}
+
+func (m *mockBotCheck) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	m.calls++
+	return token == m.valid, m.err
+}
+
+func TestBotGuard_Verify(t *testing.T) {
+	ctx := context.Background()
+	check := &mockBotCheck{valid: "solved"}
+	guard := NewBotGuard(check, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	if err := guard.Verify(ctx, "solved", "203.0.113.7"); err != nil {
+		t.Errorf("expected a solved token to pass, got %v", err)
+	}
+	if err := guard.Verify(ctx, "forged", "203.0.113.7"); !errors.Is(err, ErrBotCheckFailed) {
+		t.Errorf("expected ErrBotCheckFailed, got %v", err)
+	}
+	if err := guard.Verify(ctx, "", "203.0.113.7"); !errors.Is(err, ErrBotCheckFailed) {
+		t.Errorf("expected ErrBotCheckFailed without a token, got %v", err)
+	}
+
+	calls := check.calls
+	if err := guard.Verify(ctx, "", "10.1.2.3"); err != nil {
+		t.Errorf("expected a trusted client to pass without a token, got %v", err)
+	}
+	if err := guard.Verify(ctx, "", "::ffff:10.1.2.3"); err != nil {
+		t.Errorf("expected a mapped trusted address to pass, got %v", err)
+	}
+	if check.calls != calls {
+		t.Errorf("expected trusted clients not to be checked, got %d calls", check.calls-calls)
+	}
+
+	// An outage of the provider lets purchases through
+	check.err = errors.New("provider down")
+	if err := guard.Verify(ctx, "forged", "203.0.113.7"); err != nil {
+		t.Errorf("expected the purchase to pass when the check fails, got %v", err)
+	}
+}
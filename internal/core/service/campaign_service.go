@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrCampaignActive   = errors.New("campaign is active")
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrCampaignExists   = errors.New("campaign already exists")
+	ErrInvalidCampaign  = errors.New("invalid campaign")
+	ErrCampaignStarted  = errors.New("campaign has started")
+)
+
+// CampaignService manages campaign schedules and retires finished campaigns
+// from the cache.
+type CampaignService struct {
+	keyspace port.CampaignKeyspace
+	db       port.DatabaseRepository
+	active   string
+	regions  *RegionalStock
+}
+
+type CampaignServiceOption func(*CampaignService)
+
+// WithWarmupRegions has warmups write only this region's share of each
+// item's stock, as other regions warm up their own caches.
+func WithWarmupRegions(regions *RegionalStock) CampaignServiceOption {
+	return func(s *CampaignService) {
+		s.regions = regions
+	}
+}
+
+// NewCampaignService returns a service that refuses to tear down the
+// campaign this server is selling.
+func NewCampaignService(keyspace port.CampaignKeyspace, db port.DatabaseRepository, activeCampaign string, opts ...CampaignServiceOption) *CampaignService {
+	s := &CampaignService{keyspace: keyspace, db: db, active: activeCampaign}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Teardown archives the final cache values of a campaign to the database and
+// then deletes its keys. Keys are only deleted once the archive is saved.
+// The keys are those of the campaign's tenant, or of ctx's when the
+// campaign is no longer in the database.
+func (s *CampaignService) Teardown(ctx context.Context, campaignID string) (*domain.CampaignArchive, error) {
+	if campaignID == s.active {
+		return nil, ErrCampaignActive
+	}
+	campaign, err := s.db.GetCampaign(port.ReadPrimary(ctx), campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("get campaign: %w", err)
+	}
+	if campaign != nil {
+		ctx = port.WithTenant(ctx, campaign.TenantID)
+	}
+
+	archive, err := s.keyspace.SnapshotCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot campaign: %w", err)
+	}
+	if err := s.db.SaveCampaignArchive(ctx, *archive); err != nil {
+		return nil, fmt.Errorf("save campaign archive: %w", err)
+	}
+
+	deleted, err := s.keyspace.DeleteCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("delete campaign keys: %w", err)
+	}
+	log.Printf("campaign %s: archived and deleted %d keys", campaignID, deleted)
+
+	return archive, nil
+}
+
+// Warmup prepares a campaign's cache keys before its sale opens. It checks
+// that every item has stock in the database and, only if all do, clears keys
+// left in the campaign's keyspace by an earlier run, so idempotency keys and
+// purchase limits start empty, then writes each item's stock to the cache
+// and reads it back. Campaigns whose sale has started are refused with
+// ErrCampaignStarted, since clearing their keys would lose live state.
+func (s *CampaignService) Warmup(ctx context.Context, campaignID string) (*domain.CampaignWarmup, error) {
+	ctx = port.ReadPrimary(ctx)
+	campaign, err := s.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !now.Before(campaign.StartsAt) {
+		return nil, ErrCampaignStarted
+	}
+	ctx = port.WithTenant(ctx, campaign.TenantID)
+
+	warmup := &domain.CampaignWarmup{CampaignID: campaign.ID, StartsAt: campaign.StartsAt, WarmedAt: now}
+	for _, itemID := range campaign.ItemIDs {
+		item, err := s.checkInventory(ctx, itemID)
+		if err != nil {
+			return nil, err
+		}
+		warmup.Items = append(warmup.Items, item)
+	}
+	if !warmupReady(warmup.Items) {
+		log.Printf("campaign %s: warmup stopped, not every item has stock", campaign.ID)
+		return warmup, nil
+	}
+
+	if warmup.KeysCleared, err = s.keyspace.DeleteCampaign(ctx, campaign.ID); err != nil {
+		return nil, fmt.Errorf("clear campaign keys: %w", err)
+	}
+	for _, item := range warmup.Items {
+		if err := s.keyspace.SetCampaignStock(ctx, campaign.ID, item.ItemID, item.Share); err != nil {
+			return nil, fmt.Errorf("set stock of %s: %w", item.ItemID, err)
+		}
+	}
+
+	snapshot, err := s.keyspace.SnapshotCampaign(ctx, campaign.ID)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot campaign: %w", err)
+	}
+	for i := range warmup.Items {
+		item := &warmup.Items[i]
+		item.Stock = snapshot.Stock[item.ItemID]
+		if item.Stock != item.Share {
+			item.Problem = fmt.Sprintf("cache holds %d units", item.Stock)
+		}
+	}
+	warmup.Ready = warmupReady(warmup.Items)
+
+	log.Printf("campaign %s: warmed up %d items, cleared %d keys, ready %t", campaign.ID, len(warmup.Items), warmup.KeysCleared, warmup.Ready)
+	return warmup, nil
+}
+
+// checkInventory reports the database stock of a campaign item, with the
+// problem that keeps it from being sold if there is one.
+func (s *CampaignService) checkInventory(ctx context.Context, itemID string) (domain.WarmupItem, error) {
+	warmup := domain.WarmupItem{ItemID: itemID}
+	item, err := s.db.GetItem(ctx, itemID)
+	if err != nil {
+		return warmup, fmt.Errorf("get item: %w", err)
+	}
+	if item == nil {
+		warmup.Problem = "item not found"
+		return warmup, nil
+	}
+
+	inv, err := s.db.GetInventory(ctx, itemID)
+	if err != nil {
+		return warmup, fmt.Errorf("get inventory: %w", err)
+	}
+	switch {
+	case inv == nil:
+		warmup.Problem = "no inventory"
+	case inv.Quantity <= 0:
+		warmup.Problem = "out of stock"
+	default:
+		warmup.Inventory, warmup.Share = inv.Quantity, inv.Quantity
+		if s.regions != nil {
+			warmup.Share = s.regions.LocalShare(inv.Quantity)
+		}
+	}
+	return warmup, nil
+}
+
+func warmupReady(items []domain.WarmupItem) bool {
+	for _, item := range items {
+		if item.Problem != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateCampaign schedules a new campaign. Every item it lists must exist.
+func (s *CampaignService) CreateCampaign(ctx context.Context, campaign domain.Campaign) (*domain.Campaign, error) {
+	if err := s.validate(ctx, campaign); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	campaign.CreatedAt, campaign.UpdatedAt = now, now
+
+	created, err := s.db.CreateCampaign(ctx, campaign)
+	if err != nil {
+		return nil, fmt.Errorf("create campaign: %w", err)
+	}
+	if !created {
+		return nil, ErrCampaignExists
+	}
+
+	log.Printf("campaign %s: scheduled %s to %s", campaign.ID, campaign.StartsAt.Format(time.RFC3339), campaign.EndsAt.Format(time.RFC3339))
+	return &campaign, nil
+}
+
+func (s *CampaignService) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	campaign, err := s.db.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get campaign: %w", err)
+	}
+	if campaign == nil {
+		return nil, ErrCampaignNotFound
+	}
+	return campaign, nil
+}
+
+func (s *CampaignService) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	campaigns, err := s.db.ListCampaigns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// UpdateCampaign replaces a campaign's name, items and schedule.
+func (s *CampaignService) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (*domain.Campaign, error) {
+	if err := s.validate(ctx, campaign); err != nil {
+		return nil, err
+	}
+
+	campaign.UpdatedAt = time.Now()
+	updated, err := s.db.UpdateCampaign(ctx, campaign)
+	if err != nil {
+		return nil, fmt.Errorf("update campaign: %w", err)
+	}
+	if !updated {
+		return nil, ErrCampaignNotFound
+	}
+	return s.GetCampaign(port.ReadPrimary(ctx), campaign.ID)
+}
+
+func (s *CampaignService) validate(ctx context.Context, campaign domain.Campaign) error {
+	if err := campaign.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCampaign, err)
+	}
+	for _, itemID := range campaign.ItemIDs {
+		item, err := s.db.GetItem(ctx, itemID)
+		if err != nil {
+			return fmt.Errorf("get item: %w", err)
+		}
+		if item == nil {
+			return fmt.Errorf("%w: unknown item %s", ErrInvalidCampaign, itemID)
+		}
+	}
+	return nil
+}
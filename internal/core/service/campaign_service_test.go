@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// Mock CampaignKeyspace
+type mockKeyspace struct {
+	stock   map[string]int
+	deleted bool
+}
+
+func (m *mockKeyspace) SnapshotCampaign(ctx context.Context, campaignID string) (*domain.CampaignArchive, error) {
+	return &domain.CampaignArchive{CampaignID: campaignID, Stock: maps.Clone(m.stock)}, nil
+}
+
+func (m *mockKeyspace) DeleteCampaign(ctx context.Context, campaignID string) (int, error) {
+	m.deleted = true
+	deleted := len(m.stock)
+	clear(m.stock)
+	return deleted, nil
+}
+
+func (m *mockKeyspace) SetCampaignStock(ctx context.Context, campaignID, itemID string, quantity int) error {
+	if m.stock == nil {
+		m.stock = make(map[string]int)
+	}
+	m.stock[itemID] = quantity
+	return nil
+}
+
+func TestTeardown_ArchivesThenDeletes(t *testing.T) {
+	keyspace := &mockKeyspace{stock: map[string]int{"item-1": 3}}
+	db := newMockDatabaseRepo()
+	svc := NewCampaignService(keyspace, db, "current")
+
+	archive, err := svc.Teardown(context.Background(), "spring")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if archive.Stock["item-1"] != 3 {
+		t.Errorf("unexpected archive: %+v", archive)
+	}
+	if len(db.archives) != 1 || db.archives[0].CampaignID != "spring" {
+		t.Errorf("expected archive to be saved, got %+v", db.archives)
+	}
+	if !keyspace.deleted {
+		t.Error("expected keys to be deleted")
+	}
+}
+
+func TestTeardown_KeepsKeysWhenArchiveFails(t *testing.T) {
+	keyspace := &mockKeyspace{stock: map[string]int{"item-1": 3}}
+	db := newMockDatabaseRepo()
+	db.failCreate = true
+	svc := NewCampaignService(keyspace, db, "current")
+
+	if _, err := svc.Teardown(context.Background(), "spring"); err == nil {
+		t.Fatal("expected error")
+	}
+	if keyspace.deleted {
+		t.Error("keys must not be deleted without an archive")
+	}
+}
+
+func TestTeardown_RejectsActiveCampaign(t *testing.T) {
+	keyspace := &mockKeyspace{}
+	svc := NewCampaignService(keyspace, newMockDatabaseRepo(), "current")
+
+	if _, err := svc.Teardown(context.Background(), "current"); !errors.Is(err, ErrCampaignActive) {
+		t.Fatalf("expected ErrCampaignActive, got %v", err)
+	}
+	if keyspace.deleted {
+		t.Error("active campaign must not be deleted")
+	}
+}
+
+func TestCreateCampaign(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.items["item-1"] = domain.Item{ID: "item-1", Name: "Phone"}
+	svc := NewCampaignService(&mockKeyspace{}, db, "current")
+	ctx := context.Background()
+	start := time.Date(2026, 11, 11, 0, 0, 0, 0, time.UTC)
+
+	campaign := domain.Campaign{ID: "singles-day", ItemIDs: []string{"item-1"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	if _, err := svc.CreateCampaign(ctx, campaign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.CreateCampaign(ctx, campaign); !errors.Is(err, ErrCampaignExists) {
+		t.Errorf("expected ErrCampaignExists, got %v", err)
+	}
+
+	unknown := campaign
+	unknown.ID, unknown.ItemIDs = "other", []string{"missing"}
+	if _, err := svc.CreateCampaign(ctx, unknown); !errors.Is(err, ErrInvalidCampaign) {
+		t.Errorf("expected ErrInvalidCampaign for unknown item, got %v", err)
+	}
+
+	backwards := campaign
+	backwards.ID, backwards.EndsAt = "backwards", start.Add(-time.Hour)
+	if _, err := svc.CreateCampaign(ctx, backwards); !errors.Is(err, ErrInvalidCampaign) {
+		t.Errorf("expected ErrInvalidCampaign for reversed schedule, got %v", err)
+	}
+}
+
+func TestUpdateCampaign(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.items["item-1"] = domain.Item{ID: "item-1", Name: "Phone"}
+	svc := NewCampaignService(&mockKeyspace{}, db, "current")
+	ctx := context.Background()
+	start := time.Date(2026, 11, 11, 0, 0, 0, 0, time.UTC)
+
+	campaign := domain.Campaign{ID: "singles-day", ItemIDs: []string{"item-1"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	if _, err := svc.UpdateCampaign(ctx, campaign); !errors.Is(err, ErrCampaignNotFound) {
+		t.Errorf("expected ErrCampaignNotFound, got %v", err)
+	}
+
+	if _, err := svc.CreateCampaign(ctx, campaign); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	campaign.EndsAt = start.Add(2 * time.Hour)
+	updated, err := svc.UpdateCampaign(ctx, campaign)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !updated.EndsAt.Equal(campaign.EndsAt) {
+		t.Errorf("expected end %v, got %v", campaign.EndsAt, updated.EndsAt)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	ctx := context.Background()
+	keyspace := &mockKeyspace{stock: map[string]int{"leftover": 1}}
+	db := newMockDatabaseRepo()
+	db.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 5})
+	db.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Case", Stock: 20})
+	start := time.Now().Add(time.Hour)
+	db.campaigns["spring"] = domain.Campaign{ID: "spring", ItemIDs: []string{"item-1", "item-2"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	svc := NewCampaignService(keyspace, db, "current")
+
+	warmup, err := svc.Warmup(ctx, "spring")
+	if err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	if !warmup.Ready || warmup.KeysCleared != 1 {
+		t.Errorf("warmup = %+v, want ready with 1 key cleared", warmup)
+	}
+	want := map[string]int{"item-1": 5, "item-2": 20}
+	if !maps.Equal(keyspace.stock, want) {
+		t.Errorf("cache stock = %v, want %v", keyspace.stock, want)
+	}
+	for _, item := range warmup.Items {
+		if item.Stock != want[item.ItemID] {
+			t.Errorf("item %s reported with %d units, want %d", item.ItemID, item.Stock, want[item.ItemID])
+		}
+	}
+}
+
+func TestWarmup_StopsOnMissingStock(t *testing.T) {
+	ctx := context.Background()
+	keyspace := &mockKeyspace{stock: map[string]int{"leftover": 1}}
+	db := newMockDatabaseRepo()
+	db.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 0})
+	start := time.Now().Add(time.Hour)
+	db.campaigns["spring"] = domain.Campaign{ID: "spring", ItemIDs: []string{"item-1", "item-2"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	svc := NewCampaignService(keyspace, db, "current")
+
+	warmup, err := svc.Warmup(ctx, "spring")
+	if err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	if warmup.Ready {
+		t.Error("campaign with items lacking stock reported ready")
+	}
+	if warmup.Items[0].Problem != "out of stock" || warmup.Items[1].Problem != "item not found" {
+		t.Errorf("items = %+v, want out of stock and not found", warmup.Items)
+	}
+	if keyspace.deleted {
+		t.Error("keys cleared although the campaign was not ready")
+	}
+}
+
+func TestWarmup_RejectsStartedCampaign(t *testing.T) {
+	keyspace := &mockKeyspace{}
+	db := newMockDatabaseRepo()
+	start := time.Now().Add(-time.Minute)
+	db.campaigns["spring"] = domain.Campaign{ID: "spring", ItemIDs: []string{"item-1"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	svc := NewCampaignService(keyspace, db, "current")
+
+	if _, err := svc.Warmup(context.Background(), "spring"); !errors.Is(err, ErrCampaignStarted) {
+		t.Fatalf("warmup of started campaign: %v, want ErrCampaignStarted", err)
+	}
+	if keyspace.deleted {
+		t.Error("keys of a started campaign cleared")
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Catalog serves item details such as price and purchase limit to the
+// purchase path from memory. Items are reloaded from the database every
+// interval, so an edit reaches purchases within one interval; orders already
+// placed keep the price they were sold at. The stock in the snapshot is as
+// stale as the snapshot and only meant for display.
+type Catalog struct {
+	db       port.DatabaseRepository
+	interval time.Duration
+	items    atomic.Pointer[map[string]domain.Item]
+}
+
+func NewCatalog(db port.DatabaseRepository, interval time.Duration) *Catalog {
+	c := &Catalog{db: db, interval: interval}
+	c.items.Store(&map[string]domain.Item{})
+	return c
+}
+
+// Run refreshes the catalog every interval until ctx is done, keeping the
+// last snapshot when a refresh fails.
+func (c *Catalog) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := c.Refresh(ctx); err != nil {
+			log.Printf("catalog refresh failed: %v", err)
+		}
+	}
+}
+
+// Refresh replaces the snapshot with the items currently in the database.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	items, err := c.db.ListItems(ctx)
+	if err != nil {
+		return fmt.Errorf("list items: %w", err)
+	}
+
+	snapshot := make(map[string]domain.Item, len(items))
+	for _, item := range items {
+		snapshot[item.ID] = item
+	}
+	c.items.Store(&snapshot)
+	return nil
+}
+
+// Item returns an item from the snapshot.
+func (c *Catalog) Item(id string) (domain.Item, bool) {
+	item, ok := (*c.items.Load())[id]
+	return item, ok
+}
+
+// Items returns every item in the snapshot ordered by ID.
+func (c *Catalog) Items() []domain.Item {
+	snapshot := *c.items.Load()
+	items := make([]domain.Item, 0, len(snapshot))
+	for _, item := range snapshot {
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b domain.Item) int { return strings.Compare(a.ID, b.ID) })
+	return items
+}
+
+// ItemIn returns an item from the snapshot if it belongs to ctx's tenant, as
+// TenantScope would.
+func (c *Catalog) ItemIn(ctx context.Context, id string) (domain.Item, bool) {
+	item, ok := c.Item(id)
+	if !ok || !visible(ctx, item.TenantID) {
+		return domain.Item{}, false
+	}
+	return item, true
+}
+
+// ItemsIn returns the items in the snapshot that belong to ctx's tenant,
+// ordered by ID.
+func (c *Catalog) ItemsIn(ctx context.Context) []domain.Item {
+	return ownedBy(ctx, c.Items(), func(item domain.Item) string { return item.TenantID })
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestCatalog_Refresh(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.items["item-b"] = domain.Item{ID: "item-b", Name: "B", Price: 500, Currency: "EUR"}
+	db.items["item-a"] = domain.Item{ID: "item-a", Name: "A", Price: 1000, Currency: "USD"}
+	catalog := NewCatalog(db, time.Minute)
+
+	if _, ok := catalog.Item("item-a"); ok {
+		t.Fatal("expected an empty catalog before the first refresh")
+	}
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	items := catalog.Items()
+	if len(items) != 2 || items[0].ID != "item-a" || items[1].ID != "item-b" {
+		t.Fatalf("expected items ordered by ID, got %v", items)
+	}
+
+	// Edits are only seen after the next refresh
+	db.items["item-a"] = domain.Item{ID: "item-a", Name: "A", Price: 1200, Currency: "USD"}
+	if item, _ := catalog.Item("item-a"); item.Price != 1000 {
+		t.Errorf("expected the snapshot price 1000, got %d", item.Price)
+	}
+	catalog.Refresh(context.Background())
+	if item, _ := catalog.Item("item-a"); item.Price != 1200 {
+		t.Errorf("expected the refreshed price 1200, got %d", item.Price)
+	}
+}
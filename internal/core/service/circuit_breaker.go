@@ -0,0 +1,161 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker stops calls to a failing dependency. After threshold
+// consecutive failures it opens and refuses calls for cooldown, then lets
+// one probe through: the breaker closes if the probe succeeds and opens for
+// another cooldown if it fails.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// changed is closed and replaced whenever the breaker changes state or
+	// a probe ends, waking callers waiting on it
+	changed chan struct{}
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Wait blocks until a call may go ahead, or stop is closed, and reports
+// whether it may. A call let through while the breaker is half open is the
+// probe, and its result must be passed to Record.
+func (b *CircuitBreaker) Wait(stop <-chan struct{}) bool {
+	return b.wait(stop, true)
+}
+
+// Ready blocks until a call could go ahead, or stop is closed, without
+// taking the probe. It lets callers hold off taking work they cannot do.
+func (b *CircuitBreaker) Ready(stop <-chan struct{}) bool {
+	return b.wait(stop, false)
+}
+
+// Allow reports whether a call may go ahead now, as Wait without waiting.
+func (b *CircuitBreaker) Allow() bool {
+	ok, _, _ := b.check(true)
+	return ok
+}
+
+func (b *CircuitBreaker) wait(stop <-chan struct{}, take bool) bool {
+	for {
+		ok, retry, changed := b.check(take)
+		if ok {
+			return true
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-changed:
+		case <-stop:
+			timer.Stop()
+			return false
+		}
+		timer.Stop()
+	}
+}
+
+// check reports whether a call may go ahead, taking the probe if take is
+// set. If not, it returns how long until the cooldown ends and a channel
+// closed on the next change.
+func (b *CircuitBreaker) check(take bool) (bool, time.Duration, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		remaining := b.cooldown - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return false, remaining, b.changed
+		}
+		b.state = breakerHalfOpen
+	}
+	if b.state == breakerHalfOpen {
+		if b.probing {
+			return false, b.cooldown, b.changed
+		}
+		b.probing = take
+	}
+	return true, 0, nil
+}
+
+// Record reports the result of a call let through by Wait.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if b.state != breakerClosed {
+			log.Printf("circuit breaker %s: probe succeeded, closed", b.name)
+			b.state = breakerClosed
+			b.probing = false
+			b.notify()
+		}
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	switch {
+	case b.state == breakerHalfOpen && b.probing:
+		log.Printf("circuit breaker %s: probe failed, open for another %v: %v", b.name, b.cooldown, err)
+	case b.state == breakerClosed && b.failures >= b.threshold:
+		log.Printf("circuit breaker %s: open for %v after %d consecutive failures: %v", b.name, b.cooldown, b.failures, err)
+	default:
+		return
+	}
+	b.state = breakerOpen
+	b.openedAt = b.now()
+	b.probing = false
+	b.notify()
+}
+
+// Release ends a call let through by Wait without a result, as when it
+// failed before reaching the dependency. A probe is handed to the next call.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen && b.probing {
+		b.probing = false
+		b.notify()
+	}
+}
+
+// Open reports whether calls are being refused.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
+
+func (b *CircuitBreaker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker("db", 2, time.Minute)
+	breaker.now = func() time.Time { return now }
+	failure := errors.New("db down")
+
+	breaker.Record(failure)
+	if breaker.Open() {
+		t.Fatal("breaker open after one failure, want closed until two")
+	}
+	breaker.Record(nil)
+	breaker.Record(failure)
+	if breaker.Open() {
+		t.Fatal("breaker open after a success reset the failures")
+	}
+	breaker.Record(failure)
+	if !breaker.Open() {
+		t.Fatal("breaker closed after two consecutive failures")
+	}
+	if ok, _, _ := breaker.check(true); ok {
+		t.Fatal("call let through during the cooldown")
+	}
+
+	// After the cooldown one probe goes through; a failed probe reopens it
+	now = now.Add(time.Minute)
+	if ok, _, _ := breaker.check(false); !ok {
+		t.Fatal("Ready refused after the cooldown")
+	}
+	if ok, _, _ := breaker.check(true); !ok {
+		t.Fatal("probe refused after the cooldown")
+	}
+	if ok, _, _ := breaker.check(true); ok {
+		t.Fatal("second probe let through")
+	}
+	breaker.Record(failure)
+	if ok, _, _ := breaker.check(true); ok {
+		t.Fatal("call let through after a failed probe")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Wait(nil) {
+		t.Fatal("Wait refused the probe")
+	}
+	breaker.Record(nil)
+	if breaker.Open() {
+		t.Fatal("breaker still open after a successful probe")
+	}
+	if ok, _, _ := breaker.check(true); !ok {
+		t.Fatal("call refused after the breaker closed")
+	}
+}
+
+func TestCircuitBreaker_WaitStops(t *testing.T) {
+	breaker := NewCircuitBreaker("db", 1, time.Minute)
+	breaker.Record(errors.New("db down"))
+
+	stop := make(chan struct{})
+	close(stop)
+	if breaker.Wait(stop) || breaker.Ready(stop) {
+		t.Fatal("open breaker let a call through once stopped")
+	}
+}
+
+func TestCircuitBreaker_ReleaseHandsOnProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker("db", 1, time.Minute)
+	breaker.now = func() time.Time { return now }
+	breaker.Record(errors.New("db down"))
+
+	now = now.Add(time.Minute)
+	if ok, _, _ := breaker.check(true); !ok {
+		t.Fatal("probe refused after the cooldown")
+	}
+	breaker.Release()
+	if !breaker.Open() {
+		t.Fatal("breaker closed by a call that never reached the database")
+	}
+	if ok, _, _ := breaker.check(true); !ok {
+		t.Fatal("probe not handed on after a release")
+	}
+}
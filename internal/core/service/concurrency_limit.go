@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrConcurrencyLimited is an ErrOverloaded returned before any work is done
+// because as many purchases are in flight as the latency allows.
+var ErrConcurrencyLimited = fmt.Errorf("%w: concurrency limit reached", ErrOverloaded)
+
+const (
+	// concurrencyTolerance is how much slower than usual purchases may get
+	// before the limit shrinks
+	concurrencyTolerance = 1.5
+	// concurrencySmoothing is the weight of each new limit against the
+	// current one
+	concurrencySmoothing = 0.2
+	// concurrencyBackoff multiplies the limit after a window in which a
+	// purchase overloaded a dependency
+	concurrencyBackoff = 0.9
+	// baselineWindows is roughly how many windows the usual latency is
+	// averaged over
+	baselineWindows = 600
+)
+
+// ConcurrencyLimits bounds the purchases allowed in flight at once. The
+// limit starts at Initial and moves between Min and Max with latency; an
+// Initial of 0 leaves purchases unlimited.
+type ConcurrencyLimits struct {
+	Initial int
+	Min     int
+	Max     int
+}
+
+// Validate reports limits that cannot be used.
+func (l ConcurrencyLimits) Validate() error {
+	if l.Initial == 0 {
+		return nil
+	}
+	if l.Min < 1 || l.Initial < l.Min || l.Max < l.Initial {
+		return errors.New("concurrency limits must satisfy 1 <= min <= initial <= max")
+	}
+	return nil
+}
+
+// concurrencyLimiter caps the purchases in flight at a limit found from
+// their latency, in the manner of a gradient limiter. Purchases are measured
+// in windows of as many as the limit. While a window's purchases take about
+// as long as usual, the limit grows by its square root, leaving room for a
+// small queue; once they take longer it shrinks in proportion, and it backs
+// off sharply after a window in which a purchase overloaded a dependency.
+// Excess purchases fail at once instead of waiting in the runtime's queues
+// behind the slow ones, which keeps the latency of those admitted flat.
+type concurrencyLimiter struct {
+	min, max float64
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// baseline is the usual latency, in seconds, averaged over many windows
+	baseline float64
+	window   latencyWindow
+}
+
+// latencyWindow accumulates the purchases finished since the limit last
+// moved.
+type latencyWindow struct {
+	count      int
+	total      time.Duration
+	peak       int
+	overloaded bool
+}
+
+func newConcurrencyLimiter(limits ConcurrencyLimits) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		min:   float64(limits.Min),
+		max:   float64(limits.Max),
+		limit: float64(limits.Initial),
+	}
+}
+
+// acquire admits a purchase unless the limit is reached. A nil limiter
+// admits every purchase.
+func (l *concurrencyLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// release ends an admitted purchase that took latency and returned err, and
+// moves the limit at the end of a window.
+func (l *concurrencyLimiter) release(latency time.Duration, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := &l.window
+	w.peak = max(w.peak, l.inflight)
+	l.inflight--
+
+	switch {
+	case errors.Is(err, ErrOverloaded):
+		// A dependency or the order queue could not keep up
+		w.overloaded = true
+	case err == nil, errors.Is(err, ErrInsufficientStock):
+		w.count++
+		w.total += latency
+	default:
+		// Other failures are too quick or too slow to say anything about
+		// the load
+	}
+	if w.count < int(l.limit) && !w.overloaded {
+		return
+	}
+
+	l.limit = min(max(l.next(), l.min), l.max)
+	l.window = latencyWindow{}
+}
+
+// next returns the limit the finished window calls for.
+func (l *concurrencyLimiter) next() float64 {
+	w := l.window
+	if w.overloaded {
+		return l.limit * concurrencyBackoff
+	}
+	sample := w.total.Seconds() / float64(w.count)
+	if l.baseline == 0 {
+		l.baseline = sample
+	} else {
+		l.baseline += (sample - l.baseline) / baselineWindows
+	}
+	if sample <= 0 {
+		return l.limit
+	}
+	// A burst leaves the usual latency high, which would hide the next
+	// rise in latency; let it come down faster once purchases are quick
+	if l.baseline/sample > 2 {
+		l.baseline *= 0.95
+	}
+
+	gradient := max(0.5, min(1, concurrencyTolerance*l.baseline/sample))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	if next > l.limit && float64(w.peak) < l.limit/2 {
+		// The limit is not what holds purchases back, so their latency
+		// says nothing about a higher one
+		return l.limit
+	}
+	return l.limit*(1-concurrencySmoothing) + next*concurrencySmoothing
+}
+
+// current returns the limit, or 0 for a nil limiter.
+func (l *concurrencyLimiter) current() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestConcurrencyLimits_Validate(t *testing.T) {
+	for _, limits := range []ConcurrencyLimits{{}, {Initial: 10, Min: 1, Max: 10}, {Initial: 20, Min: 10, Max: 100}} {
+		if err := limits.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", limits, err)
+		}
+	}
+	for _, limits := range []ConcurrencyLimits{{Initial: 10, Min: 0, Max: 10}, {Initial: 5, Min: 10, Max: 100}, {Initial: 20, Min: 1, Max: 10}} {
+		if err := limits.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", limits)
+		}
+	}
+}
+
+func TestConcurrencyLimiter_AdmitsUpToLimit(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimits{Initial: 2, Min: 1, Max: 10})
+	if !l.acquire() || !l.acquire() {
+		t.Fatal("expected two purchases admitted")
+	}
+	if l.acquire() {
+		t.Fatal("expected the third purchase rejected")
+	}
+	l.release(0, errors.New("boom"))
+	if !l.acquire() {
+		t.Error("expected a purchase admitted once one finished")
+	}
+
+	var unlimited *concurrencyLimiter
+	if !unlimited.acquire() || unlimited.current() != 0 {
+		t.Error("expected a nil limiter to admit every purchase")
+	}
+}
+
+// saturate runs rounds of purchases filling the limit, each taking latency.
+func saturate(l *concurrencyLimiter, rounds int, latency time.Duration, err error) {
+	for range rounds {
+		admitted := 0
+		for l.acquire() {
+			admitted++
+		}
+		for range admitted {
+			l.release(latency, err)
+		}
+	}
+}
+
+func TestConcurrencyLimiter_FollowsLatency(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimits{Initial: 20, Min: 5, Max: 200})
+
+	saturate(l, 20, 10*time.Millisecond, nil)
+	grown := l.current()
+	if grown <= 20 {
+		t.Fatalf("expected the limit to grow while latency holds, got %d", grown)
+	}
+	if saturate(l, 300, 10*time.Millisecond, nil); l.current() != 200 {
+		t.Fatalf("expected the limit to stop at the max, got %d", l.current())
+	}
+
+	saturate(l, 5, 100*time.Millisecond, nil)
+	if l.current() >= 200 {
+		t.Fatalf("expected the limit to shrink as latency rises, got %d", l.current())
+	}
+	if saturate(l, 50, 100*time.Millisecond, ErrStageTimeout); l.current() != 5 {
+		t.Errorf("expected overload to back the limit off to the min, got %d", l.current())
+	}
+}
+
+func TestConcurrencyLimiter_GrowsOnlyWhenUsed(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimits{Initial: 20, Min: 5, Max: 200})
+	for range 100 {
+		l.acquire()
+		l.release(10*time.Millisecond, nil)
+	}
+	if l.current() != 20 {
+		t.Errorf("expected the limit unchanged while barely used, got %d", l.current())
+	}
+}
+
+// blockingCache holds stock decrements until released.
+type blockingCache struct {
+	*mockCacheRepo
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCache) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	c.entered <- struct{}{}
+	<-c.release
+	return c.mockCacheRepo.DecrementStock(ctx, itemID, quantity)
+}
+
+func TestPurchase_ConcurrencyLimit(t *testing.T) {
+	cache := &blockingCache{mockCacheRepo: newMockCacheRepo(5), entered: make(chan struct{}, 1), release: make(chan struct{})}
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+	svc := NewOrderService(cache, 10, WithConcurrencyLimit(ConcurrencyLimits{Initial: 1, Min: 1, Max: 4}), WithMetrics(m))
+	defer svc.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+		done <- err
+	}()
+	<-cache.entered
+
+	_, err := svc.Purchase(context.Background(), "req-2", "user-2", "item-1", 1)
+	if !errors.Is(err, ErrConcurrencyLimited) || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrConcurrencyLimited, got %v", err)
+	}
+	if m.outcomes[OutcomeShed] != 1 {
+		t.Errorf("expected the purchase counted as shed, got %v", m.outcomes)
+	}
+
+	close(cache.release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected the admitted purchase to succeed, got %v", err)
+	}
+	if _, err := svc.Purchase(context.Background(), "req-2", "user-2", "item-1", 1); err != nil {
+		t.Errorf("expected a purchase admitted once the first finished, got %v", err)
+	}
+	if svc.ConcurrencyLimit() < 1 {
+		t.Errorf("expected a limit of at least the min, got %d", svc.ConcurrencyLimit())
+	}
+}
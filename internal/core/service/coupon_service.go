@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrCouponNotFound  = errors.New("coupon not found")
+	ErrCouponExists    = errors.New("coupon already exists")
+	ErrInvalidCoupon   = errors.New("invalid coupon")
+	ErrCouponRejected  = errors.New("coupon does not apply")
+	ErrCouponExhausted = errors.New("coupon has been used up")
+)
+
+// CouponService manages coupons and redeems them for purchases. Like the
+// Catalog, purchases read coupons from a snapshot reloaded every interval,
+// so an edit made on another server reaches purchases within one interval.
+// Uses are counted by the redemptions store, which enforces MaxUses.
+type CouponService struct {
+	db          port.CouponRepository
+	redemptions port.CouponRedemptions
+	interval    time.Duration
+	coupons     atomic.Pointer[map[string]domain.Coupon]
+}
+
+func NewCouponService(db port.CouponRepository, redemptions port.CouponRedemptions, interval time.Duration) *CouponService {
+	s := &CouponService{db: db, redemptions: redemptions, interval: interval}
+	s.coupons.Store(&map[string]domain.Coupon{})
+	return s
+}
+
+// Run refreshes the snapshot every interval until ctx is done, keeping the
+// last snapshot when a refresh fails.
+func (s *CouponService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("coupon refresh failed: %v", err)
+		}
+	}
+}
+
+// Refresh replaces the snapshot with the coupons currently in the database.
+func (s *CouponService) Refresh(ctx context.Context) error {
+	coupons, err := s.db.ListCoupons(ctx)
+	if err != nil {
+		return fmt.Errorf("list coupons: %w", err)
+	}
+
+	snapshot := make(map[string]domain.Coupon, len(coupons))
+	for _, coupon := range coupons {
+		snapshot[coupon.Code] = coupon
+	}
+	s.coupons.Store(&snapshot)
+	return nil
+}
+
+// CreateCoupon saves a new coupon. It can be redeemed on this server right
+// away and on others after their next refresh.
+func (s *CouponService) CreateCoupon(ctx context.Context, coupon domain.Coupon) (*domain.Coupon, error) {
+	if err := coupon.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCoupon, err)
+	}
+
+	now := time.Now()
+	coupon.CreatedAt, coupon.UpdatedAt = now, now
+
+	created, err := s.db.CreateCoupon(ctx, coupon)
+	if err != nil {
+		return nil, fmt.Errorf("create coupon: %w", err)
+	}
+	if !created {
+		return nil, ErrCouponExists
+	}
+	s.store(coupon)
+
+	log.Printf("coupon %s: valid %s to %s", coupon.Code, coupon.StartsAt.Format(time.RFC3339), coupon.EndsAt.Format(time.RFC3339))
+	return &coupon, nil
+}
+
+// GetCoupon returns a coupon and how often it has been used.
+func (s *CouponService) GetCoupon(ctx context.Context, code string) (*domain.Coupon, int, error) {
+	coupon, err := s.db.GetCoupon(ctx, code)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get coupon: %w", err)
+	}
+	if coupon == nil {
+		return nil, 0, ErrCouponNotFound
+	}
+
+	uses, err := s.redemptions.CouponUses(ctx, code)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get coupon uses: %w", err)
+	}
+	return coupon, uses, nil
+}
+
+func (s *CouponService) ListCoupons(ctx context.Context) ([]domain.Coupon, error) {
+	coupons, err := s.db.ListCoupons(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list coupons: %w", err)
+	}
+	return coupons, nil
+}
+
+// UpdateCoupon replaces a coupon's discount, usage limit and validity
+// window. Uses already counted are kept.
+func (s *CouponService) UpdateCoupon(ctx context.Context, coupon domain.Coupon) (*domain.Coupon, error) {
+	if err := coupon.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCoupon, err)
+	}
+
+	coupon.UpdatedAt = time.Now()
+	updated, err := s.db.UpdateCoupon(ctx, coupon)
+	if err != nil {
+		return nil, fmt.Errorf("update coupon: %w", err)
+	}
+	if !updated {
+		return nil, ErrCouponNotFound
+	}
+
+	current, err := s.db.GetCoupon(ctx, coupon.Code)
+	if err != nil {
+		return nil, fmt.Errorf("get coupon: %w", err)
+	}
+	if current == nil {
+		return nil, ErrCouponNotFound
+	}
+	s.store(*current)
+	return current, nil
+}
+
+// store puts a coupon in the snapshot without waiting for a refresh.
+func (s *CouponService) store(coupon domain.Coupon) {
+	for {
+		old := s.coupons.Load()
+		snapshot := make(map[string]domain.Coupon, len(*old)+1)
+		for code, c := range *old {
+			snapshot[code] = c
+		}
+		snapshot[coupon.Code] = coupon
+		if s.coupons.CompareAndSwap(old, &snapshot) {
+			return
+		}
+	}
+}
+
+// Coupons returns every coupon in the snapshot ordered by code.
+func (s *CouponService) Coupons() []domain.Coupon {
+	snapshot := *s.coupons.Load()
+	coupons := make([]domain.Coupon, 0, len(snapshot))
+	for _, coupon := range snapshot {
+		coupons = append(coupons, coupon)
+	}
+	slices.SortFunc(coupons, func(a, b domain.Coupon) int { return strings.Compare(a.Code, b.Code) })
+	return coupons
+}
+
+// Applicable returns the coupon if it can be used now on an order in the
+// given currency, or ErrCouponRejected.
+func (s *CouponService) Applicable(code, currency string) (domain.Coupon, error) {
+	coupon, ok := (*s.coupons.Load())[code]
+	switch {
+	case !ok:
+		return coupon, fmt.Errorf("%w: unknown coupon %s", ErrCouponRejected, code)
+	case !coupon.Active(time.Now()):
+		return coupon, fmt.Errorf("%w: coupon %s is not valid now", ErrCouponRejected, code)
+	case coupon.AmountOff > 0 && coupon.Currency != currency:
+		return coupon, fmt.Errorf("%w: coupon %s is for %s orders", ErrCouponRejected, code, coupon.Currency)
+	}
+	return coupon, nil
+}
+
+// Redeem counts one use of the coupon, returning a func that gives it back
+// if the purchase does not go through.
+func (s *CouponService) Redeem(ctx context.Context, coupon domain.Coupon) (release func(), err error) {
+	redeemed, err := s.redemptions.RedeemCoupon(ctx, coupon.Code, coupon.MaxUses)
+	if err != nil {
+		return nil, fmt.Errorf("redeem coupon: %w", err)
+	}
+	if !redeemed {
+		return nil, fmt.Errorf("%w: %s", ErrCouponExhausted, coupon.Code)
+	}
+	return func() {
+		if err := s.redemptions.ReleaseCoupon(context.WithoutCancel(ctx), coupon.Code); err != nil {
+			log.Printf("release coupon %s: %v", coupon.Code, err)
+		}
+	}, nil
+}
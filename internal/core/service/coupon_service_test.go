@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockCoupons stores coupons and counts their uses
+type mockCoupons struct {
+	coupons map[string]domain.Coupon
+	uses    map[string]int
+	mu      sync.Mutex
+}
+
+func newMockCoupons() *mockCoupons {
+	return &mockCoupons{coupons: make(map[string]domain.Coupon), uses: make(map[string]int)}
+}
+
+func (m *mockCoupons) CreateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.coupons[coupon.Code]; ok {
+		return false, nil
+	}
+	m.coupons[coupon.Code] = coupon
+	return true, nil
+}
+
+func (m *mockCoupons) GetCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	coupon, ok := m.coupons[code]
+	if !ok {
+		return nil, nil
+	}
+	return &coupon, nil
+}
+
+func (m *mockCoupons) ListCoupons(ctx context.Context) ([]domain.Coupon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var coupons []domain.Coupon
+	for _, coupon := range m.coupons {
+		coupons = append(coupons, coupon)
+	}
+	return coupons, nil
+}
+
+func (m *mockCoupons) UpdateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.coupons[coupon.Code]; !ok {
+		return false, nil
+	}
+	m.coupons[coupon.Code] = coupon
+	return true, nil
+}
+
+func (m *mockCoupons) RedeemCoupon(ctx context.Context, code string, maxUses int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if maxUses > 0 && m.uses[code] >= maxUses {
+		return false, nil
+	}
+	m.uses[code]++
+	return true, nil
+}
+
+func (m *mockCoupons) ReleaseCoupon(ctx context.Context, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uses[code]--
+	return nil
+}
+
+func (m *mockCoupons) CouponUses(ctx context.Context, code string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.uses[code], nil
+}
+
+func TestCouponService_CreateAndApply(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCouponService(newMockCoupons(), newMockCoupons(), time.Minute)
+	now := time.Now()
+
+	_, err := svc.CreateCoupon(ctx, domain.Coupon{Code: "BOTH", PercentOff: 10, AmountOff: 100, Currency: "USD", EndsAt: now.Add(time.Hour)})
+	if !errors.Is(err, ErrInvalidCoupon) {
+		t.Errorf("expected ErrInvalidCoupon for two discounts, got %v", err)
+	}
+
+	coupon := domain.Coupon{Code: "FIVE", AmountOff: 500, Currency: "EUR", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}
+	if _, err := svc.CreateCoupon(ctx, coupon); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.CreateCoupon(ctx, coupon); !errors.Is(err, ErrCouponExists) {
+		t.Errorf("expected ErrCouponExists, got %v", err)
+	}
+
+	// Created coupons apply without waiting for a refresh
+	if _, err := svc.Applicable("FIVE", "EUR"); err != nil {
+		t.Errorf("expected coupon to apply: %v", err)
+	}
+	if _, err := svc.Applicable("FIVE", "USD"); !errors.Is(err, ErrCouponRejected) {
+		t.Errorf("expected ErrCouponRejected in another currency, got %v", err)
+	}
+	if _, err := svc.Applicable("NOPE", "EUR"); !errors.Is(err, ErrCouponRejected) {
+		t.Errorf("expected ErrCouponRejected for an unknown code, got %v", err)
+	}
+
+	// Ending the coupon takes effect at once
+	coupon.EndsAt = now.Add(-time.Second)
+	coupon.StartsAt = now.Add(-time.Hour)
+	if _, err := svc.UpdateCoupon(ctx, coupon); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Applicable("FIVE", "EUR"); !errors.Is(err, ErrCouponRejected) {
+		t.Errorf("expected ErrCouponRejected after it ended, got %v", err)
+	}
+}
+
+func TestCouponService_Redeem(t *testing.T) {
+	ctx := context.Background()
+	redemptions := newMockCoupons()
+	svc := NewCouponService(newMockCoupons(), redemptions, time.Minute)
+	coupon := domain.Coupon{Code: "ONCE", PercentOff: 10, MaxUses: 1}
+
+	release, err := svc.Redeem(ctx, coupon)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Redeem(ctx, coupon); !errors.Is(err, ErrCouponExhausted) {
+		t.Fatalf("expected ErrCouponExhausted, got %v", err)
+	}
+
+	release()
+	if _, err := svc.Redeem(ctx, coupon); err != nil {
+		t.Errorf("expected the released use to be available, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// degradedLimitKey is the single key degraded purchases are rate limited
+// under, since the limit protects the database rather than any one buyer.
+const degradedLimitKey = "degraded-purchase"
+
+// purchaseFromDB buys lines while the cache is down by writing the order
+// straight to the database, whose conditional stock update keeps the sale
+// from overselling. The order ID is derived from the idempotency key, so a
+// retried request finds its order rather than buying again.
+//
+// Purchases that need the cache are turned away with ErrDegradedUnavailable:
+// coupons, items with a per-user limit and stock held back for VIP buyers.
+// Risk scoring is skipped, as it is when the scorer fails, and frozen items
+// cannot be told apart from open ones. The units sold are taken off the
+// cache stock counter by the compensation retrier once the cache is back.
+func (s *OrderService) purchaseFromDB(ctx context.Context, requestID, idempotencyKey, userID string, lines []domain.OrderItem, po purchaseOptions) (string, error) {
+	tier := s.tier(userID)
+	if po.coupon != "" || s.floors(lines, tier) != nil || s.limited(lines) {
+		return "", ErrDegradedUnavailable
+	}
+	if allowed, _, err := s.degradedLimit.Allow(ctx, degradedLimitKey); err != nil || !allowed {
+		return "", ErrDegradedBusy
+	}
+	currency, err := s.cartCurrency(lines)
+	if err == nil {
+		err = s.checkShards(lines)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	orderID := uuid.NewSHA1(uuid.NameSpaceOID, []byte(s.campaignID+"/"+idempotencyKey)).String()
+	if existing, err := s.degradedDB.GetOrder(port.ReadPrimary(ctx), orderID); err != nil {
+		return "", fmt.Errorf("look up order: %w", err)
+	} else if existing != nil {
+		return existing.ID, nil
+	}
+	if err := s.checkStock(ctx, lines); err != nil {
+		return "", err
+	}
+
+	order := s.newOrder(ctx, orderID, requestID, idempotencyKey, userID, currency, tier, lines, nil, domain.RiskAssessment{Action: domain.RiskAllow})
+	if err := s.degradedDB.CreateOrder(ctx, order); err != nil {
+		// A retry of the request may have saved the order first, or the
+		// last units may have been sold in the meantime
+		if existing, getErr := s.degradedDB.GetOrder(port.ReadPrimary(ctx), orderID); getErr == nil && existing != nil {
+			return existing.ID, nil
+		}
+		if stockErr := s.checkStock(ctx, lines); stockErr != nil {
+			return "", stockErr
+		}
+		return "", fmt.Errorf("create order: %w", err)
+	}
+
+	for _, line := range order.Lines() {
+		if err := s.compensator.Schedule(context.WithoutCancel(ctx), line.ItemID, -line.Quantity, "degraded order "+order.ID); err != nil {
+			log.Printf("CRITICAL: cache stock of %s not reduced by %d for degraded order %s: %v", line.ItemID, line.Quantity, order.ID, err)
+		}
+	}
+	log.Printf("degraded purchase: order %s saved straight to the database", order.ID)
+	return order.ID, nil
+}
+
+// limited reports whether any line is of an item with a per-user limit,
+// which is enforced by the purchase quota.
+func (s *OrderService) limited(lines []domain.OrderItem) bool {
+	if s.catalog == nil || s.quota == nil {
+		return false
+	}
+	for _, line := range lines {
+		if item, ok := s.catalog.Item(line.ItemID); ok && item.MaxPerUser > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStock returns ErrItemNotFound or ErrInsufficientStock if the
+// database's inventory cannot cover every line, and ErrSaleClosed outside
+// the campaign's sale window.
+func (s *OrderService) checkStock(ctx context.Context, lines []domain.OrderItem) error {
+	campaign, err := s.degradedDB.GetCampaign(ctx, s.campaignID)
+	if err != nil {
+		return fmt.Errorf("get campaign: %w", err)
+	}
+	if now := time.Now(); campaign != nil && (now.Before(campaign.StartsAt) || !now.Before(campaign.EndsAt)) {
+		return ErrSaleClosed
+	}
+
+	for _, line := range lines {
+		inv, err := s.degradedDB.GetInventory(port.ReadPrimary(ctx), line.ItemID)
+		if err != nil {
+			return fmt.Errorf("get inventory: %w", err)
+		}
+		if inv == nil {
+			return ErrItemNotFound
+		}
+		if inv.Quantity < line.Quantity {
+			return ErrInsufficientStock
+		}
+	}
+	return nil
+}
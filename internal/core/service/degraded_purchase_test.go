@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// downCache fails the idempotency check while down is set
+type downCache struct {
+	*mockCacheRepo
+	down bool
+}
+
+func (d *downCache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if d.down {
+		return false, errors.New("connection refused")
+	}
+	return d.mockCacheRepo.SetIdempotency(ctx, key, ttl)
+}
+
+// countingLimiter allows the first n requests
+type countingLimiter struct {
+	n int
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if l.n == 0 {
+		return false, time.Second, nil
+	}
+	l.n--
+	return true, 0, nil
+}
+
+func TestOrderService_DegradedPurchases(t *testing.T) {
+	ctx := context.Background()
+	cache := &downCache{mockCacheRepo: newMockCacheRepo(10), down: true}
+	db := newMockDatabaseRepo()
+	db.inventory["item"] = domain.Inventory{ItemID: "item", Quantity: 2}
+	compensations := newMockCompensationLog()
+	breaker := NewCircuitBreaker("redis", 1, time.Minute)
+	svc := NewOrderService(cache, 10,
+		WithCompensator(NewStockCompensator(cache, compensations)),
+		WithDegradedPurchases(db, breaker, &countingLimiter{n: 3}),
+	)
+
+	// The failed idempotency check opens the breaker
+	if _, err := svc.Purchase(ctx, "req-0", "user", "item", 1); err == nil {
+		t.Fatal("purchase succeeded with the cache down and the breaker closed")
+	}
+	if !breaker.Open() {
+		t.Fatal("breaker closed after the cache failed")
+	}
+
+	orderID, err := svc.Purchase(ctx, "req-1", "user", "item", 2)
+	if err != nil {
+		t.Fatalf("degraded purchase: %v", err)
+	}
+	if _, ok := db.orders[orderID]; !ok {
+		t.Fatalf("order %s not saved to the database", orderID)
+	}
+	if len(svc.GetOrderQueue()) != 0 {
+		t.Error("degraded order queued for the workers")
+	}
+	if len(compensations.entries) != 1 || compensations.entries[0].Quantity != -2 {
+		t.Errorf("compensations = %+v, want one taking 2 units off the cache", compensations.entries)
+	}
+
+	// A retry finds the order instead of buying again
+	db.inventory["item"] = domain.Inventory{ItemID: "item", Quantity: 0}
+	if retried, err := svc.Purchase(ctx, "req-1", "user", "item", 2); err != nil || retried != orderID {
+		t.Errorf("retried purchase = %q, %v, want %q", retried, err, orderID)
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "user", "item", 1); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("purchase past the database stock: %v, want ErrInsufficientStock", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-3", "user", "item", 1, UsingCoupon("SAVE")); !errors.Is(err, ErrDegradedUnavailable) {
+		t.Errorf("coupon purchase: %v, want ErrDegradedUnavailable", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-4", "user", "item", 1); !errors.Is(err, ErrDegradedBusy) {
+		t.Errorf("purchase over the rate limit: %v, want ErrDegradedBusy", err)
+	}
+}
+
+func TestOrderService_DegradedPurchasesRecover(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := &downCache{mockCacheRepo: newMockCacheRepo(10)}
+	breaker := NewCircuitBreaker("redis", 1, time.Minute)
+	breaker.now = func() time.Time { return now }
+	svc := NewOrderService(cache, 10, WithDegradedPurchases(newMockDatabaseRepo(), breaker, &countingLimiter{}))
+	breaker.Record(errors.New("connection refused"))
+
+	// Once the cooldown is over a purchase probes the cache and closes the
+	// breaker, going back to the queued path
+	now = now.Add(time.Minute)
+	if _, err := svc.Purchase(ctx, "req-1", "user", "item", 1); err != nil {
+		t.Fatalf("probe purchase: %v", err)
+	}
+	if breaker.Open() {
+		t.Error("breaker still open after the cache answered")
+	}
+	if len(svc.GetOrderQueue()) != 1 {
+		t.Error("probe purchase not queued for the workers")
+	}
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// noEvents drops every event, for services built without an event bus.
+type noEvents struct{}
+
+func (noEvents) Publish(context.Context, domain.Event)                           {}
+func (noEvents) Subscribe(domain.EventType, func(context.Context, domain.Event)) {}
+
+// SubscribeOrderMetrics counts the orders the workers save and fail to save
+// in metrics.
+func SubscribeOrderMetrics(bus port.EventBus, metrics port.Metrics) {
+	bus.Subscribe(domain.EventOrderPersisted, func(context.Context, domain.Event) {
+		metrics.OrdersPersisted(1)
+	})
+	bus.Subscribe(domain.EventOrderFailed, func(context.Context, domain.Event) {
+		metrics.OrderFailed()
+	})
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockEventBus records the published events and calls the subscribed
+// handlers like the in-memory bus.
+type mockEventBus struct {
+	mu        sync.Mutex
+	published []domain.Event
+	handlers  map[domain.EventType][]func(context.Context, domain.Event)
+}
+
+func newMockEventBus() *mockEventBus {
+	return &mockEventBus{handlers: make(map[domain.EventType][]func(context.Context, domain.Event))}
+}
+
+func (b *mockEventBus) Publish(ctx context.Context, event domain.Event) {
+	b.mu.Lock()
+	b.published = append(b.published, event)
+	handlers := b.handlers[event.EventType()]
+	b.mu.Unlock()
+
+	for _, handle := range handlers {
+		handle(ctx, event)
+	}
+}
+
+func (b *mockEventBus) Subscribe(eventType domain.EventType, handle func(context.Context, domain.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handle)
+}
+
+// types returns the types of the published events in order.
+func (b *mockEventBus) types() []domain.EventType {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	types := make([]domain.EventType, len(b.published))
+	for i, event := range b.published {
+		types[i] = event.EventType()
+	}
+	return types
+}
+
+type countingMetrics struct {
+	noopMetrics
+	persisted, failed int
+}
+
+func (m *countingMetrics) OrdersPersisted(count int) { m.persisted += count }
+func (m *countingMetrics) OrderFailed()              { m.failed++ }
+
+func TestOrderWorker_Events(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failOrders = 3
+	bus := newMockEventBus()
+	metrics := &countingMetrics{}
+	SubscribeOrderMetrics(bus, metrics)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	// The first order runs out of retries, the second is saved
+	for _, id := range []string{"order-1", "order-2"} {
+		queue := make(chan domain.Order, 1)
+		queue <- newTestOrder(id)
+		close(queue)
+		NewOrderWorker(0, queue, db, newMockCacheRepo(0), tuning, WithWorkerEvents(bus)).Run()
+	}
+
+	if metrics.failed != 1 || metrics.persisted != 1 {
+		t.Errorf("expected 1 persisted and 1 failed, got %d and %d", metrics.persisted, metrics.failed)
+	}
+	types := bus.types()
+	if len(types) != 2 || types[0] != domain.EventOrderFailed || types[1] != domain.EventOrderPersisted {
+		t.Errorf("unexpected events %v", types)
+	}
+}
+
+func TestPurchase_Events(t *testing.T) {
+	ctx := context.Background()
+	bus := newMockEventBus()
+	svc := NewOrderService(newMockCacheRepo(1), 10, WithEvents(bus))
+	defer svc.Close()
+
+	orderID, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	if err != nil {
+		t.Fatalf("purchase: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Purchase(ctx, "req-late", "user-2", "item-1", 1); err == nil {
+			t.Fatal("expected the item to be sold out")
+		}
+	}
+
+	if len(bus.published) != 2 {
+		t.Fatalf("expected an accepted order and one depletion, got %v", bus.types())
+	}
+	if accepted, ok := bus.published[0].(domain.OrderAccepted); !ok || accepted.OrderID != orderID || accepted.UserID != "user-1" {
+		t.Errorf("unexpected first event %+v", bus.published[0])
+	}
+	if depleted, ok := bus.published[1].(domain.StockDepleted); !ok || depleted.ItemID != "item-1" || time.Since(depleted.DepletedAt) > time.Minute {
+		t.Errorf("unexpected second event %+v", bus.published[1])
+	}
+}
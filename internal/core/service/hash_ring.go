@@ -0,0 +1,51 @@
+package service
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// hashRingReplicas is how many points each partition gets on the ring;
+// more points spread keys more evenly.
+const hashRingReplicas = 64
+
+// hashRing assigns keys to partitions by consistent hashing, so changing the
+// number of partitions only moves about 1/n of the keys.
+type hashRing struct {
+	points []uint32
+	owners map[uint32]int
+}
+
+func newHashRing(partitions int) *hashRing {
+	r := &hashRing{owners: make(map[uint32]int, partitions*hashRingReplicas)}
+	for p := range partitions {
+		for replica := range hashRingReplicas {
+			point := hashKey(strconv.Itoa(p) + "#" + strconv.Itoa(replica))
+			// On a collision the first partition keeps the point
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = p
+			r.points = append(r.points, point)
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// partition returns the partition owning key: the first point at or after
+// the key's hash, wrapping around the ring.
+func (r *hashRing) partition(key string) int {
+	i, _ := slices.BinarySearch(r.points, hashKey(key))
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
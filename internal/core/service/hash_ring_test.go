@@ -0,0 +1,32 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashRing_MovesFewKeys(t *testing.T) {
+	before := newHashRing(8)
+	after := newHashRing(9)
+
+	const keys = 10000
+	moved := 0
+	counts := make([]int, 9)
+	for i := range keys {
+		key := fmt.Sprintf("item-%d", i)
+		if before.partition(key) != after.partition(key) {
+			moved++
+		}
+		counts[after.partition(key)]++
+	}
+
+	// Ideally 1/9 of the keys move to the new partition
+	if moved > keys/4 {
+		t.Errorf("expected about %d keys to move, %d did", keys/9, moved)
+	}
+	for p, n := range counts {
+		if n < keys/9/3 {
+			t.Errorf("partition %d got only %d keys", p, n)
+		}
+	}
+}
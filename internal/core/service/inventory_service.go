@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const (
+	// restockLockTTL bounds how long a crashed restock can block the next one.
+	restockLockTTL = 30 * time.Second
+	// restockAttempts is how often the inventory update is retried when
+	// persisted orders change the row under it.
+	restockAttempts = 5
+)
+
+var (
+	ErrRestockInProgress = errors.New("restock in progress")
+	ErrInvalidQuantity   = errors.New("quantity must be positive")
+	ErrInvalidItem       = errors.New("invalid item")
+	ErrItemExists        = errors.New("item already exists")
+)
+
+// InventoryService manages items and changes their stock in MySQL and Redis
+// together.
+type InventoryService struct {
+	cache   port.CacheRepository
+	db      port.DatabaseRepository
+	locker  port.Locker
+	regions *RegionalStock
+}
+
+type InventoryServiceOption func(*InventoryService)
+
+// WithRegionalStock splits the stock of created and restocked items between
+// regions instead of putting all of it in the local cache.
+func WithRegionalStock(regions *RegionalStock) InventoryServiceOption {
+	return func(s *InventoryService) {
+		s.regions = regions
+	}
+}
+
+func NewInventoryService(cache port.CacheRepository, db port.DatabaseRepository, locker port.Locker, opts ...InventoryServiceOption) *InventoryService {
+	s := &InventoryService{cache: cache, db: db, locker: locker}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Restock adds units to an item. Only one restock per item runs at a time;
+// others fail with ErrRestockInProgress. The inventory row and its audit
+// entry are written together, then the units are added to the cache.
+// Items the database does not return, such as another tenant's behind a
+// TenantScope, are ErrItemNotFound.
+func (s *InventoryService) Restock(ctx context.Context, itemID string, quantity int, actor, reason string) (*domain.Restock, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	if _, err := s.GetItem(port.ReadPrimary(ctx), itemID); err != nil {
+		return nil, err
+	}
+
+	release, ok, err := s.locker.TryLock(ctx, "restock:"+itemID, restockLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("acquire restock lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrRestockInProgress
+	}
+	defer func() {
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("restock %s: failed to release lock: %v", itemID, err)
+		}
+	}()
+
+	restock, err := s.updateInventory(ctx, itemID, quantity, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addStock(ctx, itemID, quantity); err != nil {
+		log.Printf("CRITICAL restock %s: inventory updated but cache stock was not: %v", itemID, err)
+		return nil, fmt.Errorf("increment cache stock: %w", err)
+	}
+
+	log.Printf("restocked %s: %d -> %d by %q", itemID, restock.StockBefore, restock.StockAfter, actor)
+	return restock, nil
+}
+
+// updateInventory applies the restock with optimistic locking, re-reading
+// the row when a persisted order bumped its version in between.
+func (s *InventoryService) updateInventory(ctx context.Context, itemID string, quantity int, actor, reason string) (*domain.Restock, error) {
+	var err error
+	for attempt := 0; attempt < restockAttempts; attempt++ {
+		// The version must be current for the update to apply
+		var inv *domain.Inventory
+		inv, err = s.db.GetInventory(port.ReadPrimary(ctx), itemID)
+		if err != nil {
+			return nil, fmt.Errorf("get inventory: %w", err)
+		}
+		if inv == nil {
+			return nil, ErrItemNotFound
+		}
+
+		restock := domain.Restock{
+			ItemID:      itemID,
+			Quantity:    quantity,
+			Actor:       actor,
+			Reason:      reason,
+			StockBefore: inv.Quantity,
+			StockAfter:  inv.Quantity + quantity,
+			CreatedAt:   time.Now(),
+		}
+		updated := *inv
+		updated.Quantity = restock.StockAfter
+
+		if err = s.db.RestockInventory(ctx, updated, restock); err == nil {
+			return &restock, nil
+		}
+	}
+	return nil, fmt.Errorf("update inventory: %w", err)
+}
+
+// CreateItem adds a new item with its initial stock and makes it available
+// for purchase by setting its stock in the cache. Items without a currency
+// are priced in domain.DefaultCurrency.
+func (s *InventoryService) CreateItem(ctx context.Context, item domain.Item) (*domain.Item, error) {
+	if item.Currency == "" {
+		item.Currency = domain.DefaultCurrency
+	}
+	if err := item.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+
+	now := time.Now()
+	item.CreatedAt, item.UpdatedAt = now, now
+
+	created, err := s.db.CreateItem(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("create item: %w", err)
+	}
+	if !created {
+		return nil, ErrItemExists
+	}
+
+	if err := s.setStock(ctx, item.ID, item.Stock); err != nil {
+		log.Printf("CRITICAL item %s: created in inventory but cache stock was not set: %v", item.ID, err)
+		return nil, fmt.Errorf("set cache stock: %w", err)
+	}
+
+	log.Printf("created item %s with %d units", item.ID, item.Stock)
+	return &item, nil
+}
+
+func (s *InventoryService) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	item, err := s.db.GetItem(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get item: %w", err)
+	}
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+	return item, nil
+}
+
+func (s *InventoryService) ListItems(ctx context.Context) ([]domain.Item, error) {
+	items, err := s.db.ListItems(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list items: %w", err)
+	}
+	return items, nil
+}
+
+// UpdateItem saves changes to an item's details. Stock is only changed
+// through Restock, so item.Stock is ignored.
+func (s *InventoryService) UpdateItem(ctx context.Context, item domain.Item) (*domain.Item, error) {
+	if item.Currency == "" {
+		item.Currency = domain.DefaultCurrency
+	}
+	if err := item.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidItem, err)
+	}
+
+	item.UpdatedAt = time.Now()
+	updated, err := s.db.UpdateItem(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("update item: %w", err)
+	}
+	if !updated {
+		return nil, ErrItemNotFound
+	}
+	return s.GetItem(port.ReadPrimary(ctx), item.ID)
+}
+
+// setStock sets a new item's stock in the cache, or its share in every
+// region's.
+func (s *InventoryService) setStock(ctx context.Context, itemID string, quantity int) error {
+	if s.regions != nil {
+		return s.regions.Allocate(ctx, itemID, quantity)
+	}
+	return s.cache.SetStock(ctx, itemID, quantity)
+}
+
+// addStock adds restocked units to the cache, or their share to every
+// region's.
+func (s *InventoryService) addStock(ctx context.Context, itemID string, quantity int) error {
+	if s.regions != nil {
+		return s.regions.Add(ctx, itemID, quantity)
+	}
+	return s.cache.IncrementStock(ctx, itemID, quantity)
+}
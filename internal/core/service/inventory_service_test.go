@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockLocker holds named locks until released
+type mockLocker struct {
+	held map[string]bool
+	mu   sync.Mutex
+}
+
+func newMockLocker() *mockLocker {
+	return &mockLocker{held: make(map[string]bool)}
+}
+
+func (l *mockLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(context.Context) error, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+		return nil
+	}, true, nil
+}
+
+func TestRestock_Success(t *testing.T) {
+	cache := newMockCacheRepo(5)
+	db := newMockDatabaseRepo()
+	db.items["item-1"] = domain.Item{ID: "item-1", Name: "Item 1"}
+	db.inventory["item-1"] = domain.Inventory{ItemID: "item-1", Quantity: 20, Version: 3}
+	db.conflicts = 2 // orders persisted while restocking
+	locker := newMockLocker()
+	svc := NewInventoryService(cache, db, locker)
+
+	restock, err := svc.Restock(context.Background(), "item-1", 10, "ops", "truck arrived")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if restock.StockBefore != 18 || restock.StockAfter != 28 {
+		t.Errorf("expected 18 -> 28 after re-reading, got %d -> %d", restock.StockBefore, restock.StockAfter)
+	}
+	if db.inventory["item-1"].Quantity != 28 {
+		t.Errorf("expected inventory 28, got %d", db.inventory["item-1"].Quantity)
+	}
+	if cache.stock != 15 {
+		t.Errorf("expected cache stock 15, got %d", cache.stock)
+	}
+	if len(db.restocks) != 1 || db.restocks[0].Actor != "ops" || db.restocks[0].Reason != "truck arrived" {
+		t.Errorf("unexpected audit entries: %+v", db.restocks)
+	}
+	if len(locker.held) != 0 {
+		t.Error("expected lock to be released")
+	}
+}
+
+func TestRestock_Rejections(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.items["item-1"] = domain.Item{ID: "item-1", Name: "Item 1"}
+	db.inventory["item-1"] = domain.Inventory{ItemID: "item-1", Quantity: 20}
+	locker := newMockLocker()
+	svc := NewInventoryService(newMockCacheRepo(0), db, locker)
+	ctx := context.Background()
+
+	if _, err := svc.Restock(ctx, "item-1", 0, "", ""); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("expected ErrInvalidQuantity, got %v", err)
+	}
+	if _, err := svc.Restock(ctx, "missing", 1, "", ""); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound, got %v", err)
+	}
+
+	locker.held["restock:item-1"] = true
+	if _, err := svc.Restock(ctx, "item-1", 1, "", ""); !errors.Is(err, ErrRestockInProgress) {
+		t.Errorf("expected ErrRestockInProgress, got %v", err)
+	}
+	if len(db.restocks) != 0 {
+		t.Errorf("rejected restocks must not be recorded, got %d", len(db.restocks))
+	}
+}
+
+func TestCreateItem_SetsCacheStock(t *testing.T) {
+	cache := newMockCacheRepo(0)
+	db := newMockDatabaseRepo()
+	svc := NewInventoryService(cache, db, newMockLocker())
+	ctx := context.Background()
+
+	item, err := svc.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 25})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.CreatedAt.IsZero() {
+		t.Error("expected creation time to be set")
+	}
+	if db.inventory["item-1"].Quantity != 25 {
+		t.Errorf("expected inventory 25, got %d", db.inventory["item-1"].Quantity)
+	}
+	if cache.stock != 25 {
+		t.Errorf("expected cache stock 25, got %d", cache.stock)
+	}
+
+	if _, err := svc.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone"}); !errors.Is(err, ErrItemExists) {
+		t.Errorf("expected ErrItemExists, got %v", err)
+	}
+	if _, err := svc.CreateItem(ctx, domain.Item{ID: "item-2", Name: "Phone", Stock: -1}); !errors.Is(err, ErrInvalidItem) {
+		t.Errorf("expected ErrInvalidItem, got %v", err)
+	}
+}
+
+func TestUpdateItem_KeepsStock(t *testing.T) {
+	db := newMockDatabaseRepo()
+	svc := NewInventoryService(newMockCacheRepo(0), db, newMockLocker())
+	ctx := context.Background()
+
+	if _, err := svc.CreateItem(ctx, domain.Item{ID: "item-1", Name: "Phone", Stock: 25}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item, err := svc.UpdateItem(ctx, domain.Item{ID: "item-1", Name: "Phone 2", Stock: 99})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Name != "Phone 2" || item.Stock != 25 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	if _, err := svc.UpdateItem(ctx, domain.Item{ID: "missing", Name: "x"}); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("expected ErrItemNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// ItemFilter holds a bloom filter of the IDs of every item in the database,
+// so purchases of items that do not exist, from enumeration or typos, are
+// turned away before any call to Redis. A bloom filter never misses an item
+// it was built with, and lets through about falsePositiveRate of unknown IDs,
+// which the cache then rejects as usual.
+//
+// The filter is rebuilt every interval, so an item created after the last
+// rebuild is turned away until the next one. Until the first build every
+// purchase is let through.
+type ItemFilter struct {
+	db                port.DatabaseRepository
+	interval          time.Duration
+	falsePositiveRate float64
+	filter            atomic.Pointer[bloomFilter]
+}
+
+func NewItemFilter(db port.DatabaseRepository, interval time.Duration, falsePositiveRate float64) *ItemFilter {
+	return &ItemFilter{db: db, interval: interval, falsePositiveRate: falsePositiveRate}
+}
+
+// Run rebuilds the filter every interval until ctx is done, keeping the
+// last filter when a rebuild fails.
+func (f *ItemFilter) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := f.Refresh(ctx); err != nil {
+			log.Printf("item filter refresh failed: %v", err)
+		}
+	}
+}
+
+// Refresh rebuilds the filter from the items currently in the database.
+func (f *ItemFilter) Refresh(ctx context.Context) error {
+	items, err := f.db.ListItems(ctx)
+	if err != nil {
+		return fmt.Errorf("list items: %w", err)
+	}
+
+	filter := newBloomFilter(len(items), f.falsePositiveRate)
+	for _, item := range items {
+		filter.add(item.ID)
+	}
+	f.filter.Store(filter)
+	return nil
+}
+
+// Known reports whether every line may be of an existing item. It is false
+// only if some line certainly is not.
+func (f *ItemFilter) Known(lines []domain.OrderItem) bool {
+	filter := f.filter.Load()
+	if filter == nil {
+		return true
+	}
+	for _, line := range lines {
+		if !filter.mayContain(line.ItemID) {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFilter is a fixed size bloom filter of strings. It is not safe for
+// concurrent adds, so it is built in full before it is shared.
+type bloomFilter struct {
+	bits   []uint64
+	hashes uint64
+}
+
+// newBloomFilter sizes a filter for n keys at the given false positive rate.
+func newBloomFilter(n int, falsePositiveRate float64) *bloomFilter {
+	n = max(n, 1)
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	return &bloomFilter{
+		bits:   make([]uint64, (uint64(m)+63)/64),
+		hashes: uint64(max(k, 1)),
+	}
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := bloomHashes(key)
+	size := uint64(len(b.bits)) * 64
+	for i := range b.hashes {
+		bit := (h1 + i*h2) % size
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHashes(key)
+	size := uint64(len(b.bits)) * 64
+	for i := range b.hashes {
+		bit := (h1 + i*h2) % size
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes derives the two hashes the filter's positions are combined
+// from, splitting one 64-bit FNV-1a hash.
+func bloomHashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	// The second hash is kept non-zero so the positions differ
+	return sum & math.MaxUint32, sum>>32 | 1
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := newBloomFilter(10000, 0.01)
+	for i := range 10000 {
+		filter.add(fmt.Sprintf("item-%d", i))
+	}
+	for i := range 10000 {
+		if !filter.mayContain(fmt.Sprintf("item-%d", i)) {
+			t.Fatalf("item-%d missing from the filter", i)
+		}
+	}
+
+	var falsePositives int
+	for i := range 10000 {
+		if filter.mayContain(fmt.Sprintf("junk-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("%d of 10000 unknown IDs let through, want about 100", falsePositives)
+	}
+}
+
+func TestItemFilter(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	filter := NewItemFilter(db, time.Minute, 0.01)
+	line := []domain.OrderItem{{ItemID: "item", Quantity: 1}}
+
+	if !filter.Known(line) {
+		t.Error("purchase turned away before the filter was loaded")
+	}
+
+	db.CreateItem(ctx, domain.Item{ID: "other", Name: "Other", Stock: 1})
+	if err := filter.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if filter.Known(line) {
+		t.Error("unknown item let through")
+	}
+	if !filter.Known([]domain.OrderItem{{ItemID: "other", Quantity: 1}}) {
+		t.Error("known item turned away")
+	}
+
+	db.CreateItem(ctx, domain.Item{ID: "item", Name: "Item", Stock: 1})
+	filter.Refresh(ctx)
+	if !filter.Known(line) {
+		t.Error("item created since the last refresh still turned away")
+	}
+}
+
+func TestOrderService_ItemFilter(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	db.CreateItem(ctx, domain.Item{ID: "item", Name: "Item", Stock: 10})
+	filter := NewItemFilter(db, time.Minute, 0.01)
+	filter.Refresh(ctx)
+	cache := &countingCache{mockCacheRepo: newMockCacheRepo(10)}
+	svc := NewOrderService(cache, 10, WithItemFilter(filter))
+
+	if _, err := svc.Purchase(ctx, "req-1", "user", "no-such-item", 1); !errors.Is(err, ErrItemNotFound) {
+		t.Fatalf("purchase of unknown item: %v, want ErrItemNotFound", err)
+	}
+	if cache.checks != 0 {
+		t.Error("purchase of unknown item reached the cache")
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "user", "item", 1); err != nil {
+		t.Errorf("purchase of known item: %v", err)
+	}
+}
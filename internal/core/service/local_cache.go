@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// localCachePruneSize is how many entries a local cache holds before it
+// starts dropping expired ones as it grows.
+const localCachePruneSize = 1024
+
+// LocalCache keeps values read from Redis or MySQL in process for a short
+// TTL. Concurrent reads of a key that is not cached share one load, so a
+// burst of identical reads costs a single call. Failed loads are not
+// cached, and with a TTL of zero reads are only shared while a load is in
+// flight.
+type LocalCache[V any] struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]localCacheEntry[V]
+	pruneSize int
+	// gen changes on every invalidation, so a load that started before one
+	// does not cache the value it read
+	gen   uint64
+	loads singleflight.Group
+}
+
+type localCacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func NewLocalCache[V any](ttl time.Duration) *LocalCache[V] {
+	return &LocalCache[V]{
+		ttl:       ttl,
+		now:       time.Now,
+		entries:   make(map[string]localCacheEntry[V]),
+		pruneSize: localCachePruneSize,
+	}
+}
+
+// Get returns the cached value of key, calling load if there is none. The
+// load is shared with other callers, so it is not cancelled with ctx; a
+// caller whose ctx is done stops waiting for it.
+func (c *LocalCache[V]) Get(ctx context.Context, key string, load func(ctx context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	loadCtx := context.WithoutCancel(ctx)
+	results := c.loads.DoChan(key, func() (any, error) {
+		c.mu.Lock()
+		gen := c.gen
+		c.mu.Unlock()
+
+		value, err := load(loadCtx)
+		if err == nil && c.ttl > 0 {
+			c.store(key, value, gen)
+		}
+		return value, err
+	})
+
+	select {
+	case res := <-results:
+		if res.Err != nil {
+			var zero V
+			return zero, res.Err
+		}
+		return res.Val.(V), nil
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached value of key, so the next Get loads it again.
+// A load already in flight is forgotten rather than waited for.
+func (c *LocalCache[V]) Invalidate(key string) {
+	c.loads.Forget(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.entries, key)
+}
+
+func (c *LocalCache[V]) store(key string, value V, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= c.pruneSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.pruneSize {
+			c.pruneSize *= 2
+		}
+	}
+	c.entries[key] = localCacheEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// CachedCampaigns serves campaign reads from a LocalCache in front of the
+// database, since every stats request and degraded purchase reads the
+// campaign. Campaigns created or updated through it are dropped from its
+// cache; other servers see the change once their cached copy expires.
+// Reads marked with port.ReadPrimary skip the cache.
+//
+// Campaigns returned are shared between callers and must not be modified.
+type CachedCampaigns struct {
+	port.DatabaseRepository
+	campaigns *LocalCache[*domain.Campaign]
+}
+
+func NewCachedCampaigns(db port.DatabaseRepository, ttl time.Duration) *CachedCampaigns {
+	return &CachedCampaigns{DatabaseRepository: db, campaigns: NewLocalCache[*domain.Campaign](ttl)}
+}
+
+func (c *CachedCampaigns) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	if port.ReadsPrimary(ctx) {
+		return c.DatabaseRepository.GetCampaign(ctx, id)
+	}
+	return c.campaigns.Get(ctx, id, func(ctx context.Context) (*domain.Campaign, error) {
+		return c.DatabaseRepository.GetCampaign(ctx, id)
+	})
+}
+
+func (c *CachedCampaigns) CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	defer c.campaigns.Invalidate(campaign.ID)
+	return c.DatabaseRepository.CreateCampaign(ctx, campaign)
+}
+
+func (c *CachedCampaigns) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	defer c.campaigns.Invalidate(campaign.ID)
+	return c.DatabaseRepository.UpdateCampaign(ctx, campaign)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestLocalCache_CollapsesConcurrentReads(t *testing.T) {
+	cache := NewLocalCache[int](time.Minute)
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 7, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan int, 100)
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Get(context.Background(), "item", load)
+			if err != nil {
+				t.Errorf("get: %v", err)
+			}
+			results <- v
+		}()
+	}
+	waitFor(t, "first load", func() bool { return loads.Load() == 1 })
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for v := range results {
+		if v != 7 {
+			t.Fatalf("get = %d, want 7", v)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestLocalCache_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewLocalCache[int](time.Second)
+	cache.now = func() time.Time { return now }
+	stock := 5
+	load := func(ctx context.Context) (int, error) { return stock, nil }
+
+	cache.Get(ctx, "item", load)
+	stock = 4
+	if v, _ := cache.Get(ctx, "item", load); v != 5 {
+		t.Errorf("get within TTL = %d, want cached 5", v)
+	}
+	now = now.Add(time.Second)
+	if v, _ := cache.Get(ctx, "item", load); v != 4 {
+		t.Errorf("get after TTL = %d, want 4", v)
+	}
+	stock = 3
+	cache.Invalidate("item")
+	if v, _ := cache.Get(ctx, "item", load); v != 3 {
+		t.Errorf("get after invalidation = %d, want 3", v)
+	}
+}
+
+func TestLocalCache_ErrorsNotCached(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLocalCache[int](time.Minute)
+	fail := true
+	load := func(ctx context.Context) (int, error) {
+		if fail {
+			return 0, errors.New("connection refused")
+		}
+		return 1, nil
+	}
+
+	if _, err := cache.Get(ctx, "item", load); err == nil {
+		t.Fatal("get succeeded with the load failing")
+	}
+	fail = false
+	if v, err := cache.Get(ctx, "item", load); err != nil || v != 1 {
+		t.Errorf("get after failure = %d, %v, want 1", v, err)
+	}
+}
+
+func TestLocalCache_CallerCancelled(t *testing.T) {
+	cache := NewLocalCache[int](time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cache.Get(ctx, "item", func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("get with cancelled ctx: %v, want context.Canceled", err)
+	}
+}
+
+// countingCampaignDB counts campaign reads
+type countingCampaignDB struct {
+	*mockDatabaseRepo
+	reads int
+}
+
+func (d *countingCampaignDB) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	d.reads++
+	return d.mockDatabaseRepo.GetCampaign(ctx, id)
+}
+
+func TestCachedCampaigns(t *testing.T) {
+	ctx := context.Background()
+	db := &countingCampaignDB{mockDatabaseRepo: newMockDatabaseRepo()}
+	db.campaigns["spring"] = domain.Campaign{ID: "spring", Name: "Spring"}
+	campaigns := NewCachedCampaigns(db, time.Minute)
+
+	campaigns.GetCampaign(ctx, "spring")
+	campaigns.GetCampaign(ctx, "spring")
+	if db.reads != 1 {
+		t.Errorf("reads = %d, want 1", db.reads)
+	}
+
+	campaigns.GetCampaign(port.ReadPrimary(ctx), "spring")
+	if db.reads != 2 {
+		t.Errorf("primary read served from the cache")
+	}
+
+	if _, err := campaigns.UpdateCampaign(ctx, domain.Campaign{ID: "spring", Name: "Spring Sale"}); err != nil {
+		t.Fatalf("update campaign: %v", err)
+	}
+	campaign, err := campaigns.GetCampaign(ctx, "spring")
+	if err != nil || campaign.Name != "Spring Sale" {
+		t.Errorf("campaign after update = %+v, %v, want the new name", campaign, err)
+	}
+}
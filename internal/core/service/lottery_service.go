@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrAlreadyEntered = errors.New("already entered the lottery")
+	ErrNotDrawn       = errors.New("not drawn in the lottery")
+	ErrLotteryCart    = errors.New("lottery entries are for a single item")
+	ErrLotteryOpen    = errors.New("lottery entries are still open")
+	ErrDrawInProgress = errors.New("lottery draw already in progress")
+)
+
+const (
+	// lotteryDrawLockTTL bounds how long a crashed server blocks the draw
+	lotteryDrawLockTTL = 10 * time.Minute
+	// lotteryDrawBatch is how many entries are taken from the store at once
+	lotteryDrawBatch = 100
+	// lotteryRetryDelay is how long the draw waits for room in a full
+	// order queue
+	lotteryRetryDelay = 100 * time.Millisecond
+)
+
+// LotteryService runs lottery sales: instead of selling first come, first
+// served, purchase requests are collected as entries until entries close,
+// and then drawn in random order. Drawn entries are purchased as usual until
+// the item sells out; the rest are not drawn. Entries claim their request's
+// idempotency key, so their state is read with OrderService.PurchaseState
+// and the key must outlive the draw.
+type LotteryService struct {
+	orders   *OrderService
+	entries  port.LotteryEntries
+	locker   port.Locker
+	closesAt time.Time
+}
+
+func NewLotteryService(orders *OrderService, entries port.LotteryEntries, locker port.Locker, closesAt time.Time) *LotteryService {
+	return &LotteryService{orders: orders, entries: entries, locker: locker, closesAt: closesAt}
+}
+
+// ClosesAt is when entries close and the draw starts.
+func (s *LotteryService) ClosesAt() time.Time {
+	return s.closesAt
+}
+
+// Enter enters a purchase request into the item's lottery. Entering a
+// request that is already known is a no-op, but a user may only enter each
+// item once.
+func (s *LotteryService) Enter(ctx context.Context, requestID, userID, itemID string, quantity int, opts ...PurchaseOption) (err error) {
+	defer func() {
+		if err != nil {
+			s.orders.record(ctx, requestID, userID, "", err)
+		}
+	}()
+
+	if !time.Now().Before(s.closesAt) {
+		return fmt.Errorf("%w: lottery entries closed at %s", ErrSaleClosed, s.closesAt.Format(time.RFC3339))
+	}
+	po := newPurchaseOptions(opts)
+	if err := s.orders.checkBlacklist(ctx, userID, po); err != nil {
+		return err
+	}
+
+	idempotencyKey := s.orders.idempotencyKey(requestID, userID, itemID)
+	ok, err := s.orders.claimKey(ctx, idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("idempotency check failed: %w", err)
+	}
+	if !ok {
+		s.orders.record(ctx, requestID, userID, "", ErrDuplicateRequest)
+		return nil
+	}
+
+	entry := domain.LotteryEntry{
+		RequestID:      requestID,
+		UserID:         userID,
+		ItemID:         itemID,
+		Quantity:       quantity,
+		CouponCode:     po.coupon,
+		IdempotencyKey: idempotencyKey,
+		EnteredAt:      time.Now(),
+	}
+	added, err := s.entries.AddEntry(ctx, entry)
+	if err != nil || !added {
+		_ = s.orders.cache.ReleaseIdempotency(ctx, idempotencyKey)
+		if err != nil {
+			return fmt.Errorf("add lottery entry: %w", err)
+		}
+		return ErrAlreadyEntered
+	}
+
+	s.orders.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusEntered})
+	s.orders.saveRecord(ctx, domain.PurchaseRecord{RequestID: requestID, UserID: userID, Status: domain.PurchaseStatusEntered}, false)
+	return nil
+}
+
+// Run waits for entries to close, then draws every item that has entries.
+// Servers race for each item's draw and only one of them runs it.
+func (s *LotteryService) Run(ctx context.Context) {
+	timer := time.NewTimer(time.Until(s.closesAt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return
+	}
+
+	items, err := s.entries.LotteryItems(ctx)
+	if err != nil {
+		log.Printf("list lottery items: %v", err)
+		return
+	}
+	for _, itemID := range items {
+		if _, err := s.Draw(ctx, itemID); err != nil && !errors.Is(err, ErrDrawInProgress) {
+			log.Printf("lottery draw %s failed: %v", itemID, err)
+		}
+	}
+}
+
+// Draw draws the item's entries once entries have closed. Entries whose
+// purchase cannot be placed while the sale is paused are put back, so the
+// draw can be run again once it resumes.
+func (s *LotteryService) Draw(ctx context.Context, itemID string) (*domain.LotteryDraw, error) {
+	if time.Now().Before(s.closesAt) {
+		return nil, ErrLotteryOpen
+	}
+
+	release, ok, err := s.locker.TryLock(ctx, "lottery:"+itemID, lotteryDrawLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("lock lottery draw: %w", err)
+	}
+	if !ok {
+		return nil, ErrDrawInProgress
+	}
+	defer func() {
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("release lottery lock %s: %v", itemID, err)
+		}
+	}()
+
+	draw := &domain.LotteryDraw{ItemID: itemID, DrawnAt: time.Now()}
+	soldOut := false
+	for {
+		entries, err := s.entries.DrawEntries(ctx, itemID, lotteryDrawBatch)
+		if err != nil && len(entries) == 0 {
+			return draw, fmt.Errorf("draw lottery entries: %w", err)
+		}
+		if err != nil {
+			// The entries returned are already out of the store, so decide them
+			log.Printf("lottery draw %s: %v", itemID, err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		for i, entry := range entries {
+			if soldOut {
+				s.lose(ctx, entry)
+				draw.Entries++
+				continue
+			}
+
+			err := s.purchase(ctx, entry)
+			if err != nil && (errors.Is(err, ErrSaleFrozen) || ctx.Err() != nil) {
+				s.putBack(ctx, entries[i:])
+				return draw, fmt.Errorf("lottery draw %s stopped: %w", itemID, err)
+			}
+			draw.Entries++
+			if err == nil {
+				draw.Winners++
+			}
+			if err == nil || errors.Is(err, ErrInsufficientStock) {
+				// Once the item sells out the remaining entries lose, but a
+				// larger entry may miss while smaller ones still fit
+				stock, err := s.orders.RemainingStock(ctx, itemID)
+				soldOut = err == nil && stock <= 0
+			}
+		}
+	}
+
+	log.Printf("lottery %s: %d winners of %d entries", itemID, draw.Winners, draw.Entries)
+	return draw, nil
+}
+
+// purchase buys a drawn entry, waiting for room while the order queue is full.
+func (s *LotteryService) purchase(ctx context.Context, entry domain.LotteryEntry) error {
+	lines := []domain.OrderItem{{ItemID: entry.ItemID, Quantity: entry.Quantity}}
+	po := purchaseOptions{coupon: entry.CouponCode}
+
+	for {
+		start := time.Now()
+		orderID, err := s.orders.process(ctx, entry.RequestID, entry.IdempotencyKey, entry.UserID, lines, po)
+		if errors.Is(err, ErrQueueFull) {
+			select {
+			case <-time.After(lotteryRetryDelay):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		s.orders.completed(ctx, OutcomeOf(err), time.Since(start))
+		if err != nil && !errors.Is(err, ErrSaleFrozen) {
+			s.publish(ctx, entry, resultStatus(err))
+		}
+		if !errors.Is(err, ErrSaleFrozen) {
+			s.orders.record(ctx, entry.RequestID, entry.UserID, orderID, err)
+		}
+		return err
+	}
+}
+
+// lose records that the entry was not drawn.
+func (s *LotteryService) lose(ctx context.Context, entry domain.LotteryEntry) {
+	s.orders.saveResult(ctx, entry.IdempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusNotDrawn})
+	s.orders.saveRecord(ctx, domain.PurchaseRecord{RequestID: entry.RequestID, UserID: entry.UserID, Status: domain.PurchaseStatusNotDrawn}, false)
+	s.publish(ctx, entry, domain.PurchaseStatusNotDrawn)
+}
+
+func (s *LotteryService) publish(ctx context.Context, entry domain.LotteryEntry, status domain.PurchaseStatus) {
+	if s.orders.results == nil {
+		return
+	}
+	_ = s.orders.results.PublishOrderResult(ctx, domain.OrderResult{RequestID: entry.RequestID, Status: status})
+}
+
+// putBack returns entries that were taken but not decided to the lottery.
+func (s *LotteryService) putBack(ctx context.Context, entries []domain.LotteryEntry) {
+	ctx = context.WithoutCancel(ctx)
+	for _, entry := range entries {
+		if _, err := s.entries.AddEntry(ctx, entry); err != nil {
+			log.Printf("CRITICAL: could not return lottery entry %s: %v", entry.RequestID, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockLottery keeps entries by item and user; draws take them in map order
+type mockLottery struct {
+	entries map[string]map[string]domain.LotteryEntry
+	mu      sync.Mutex
+}
+
+func newMockLottery() *mockLottery {
+	return &mockLottery{entries: make(map[string]map[string]domain.LotteryEntry)}
+}
+
+func (m *mockLottery) AddEntry(ctx context.Context, entry domain.LotteryEntry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries[entry.ItemID] == nil {
+		m.entries[entry.ItemID] = make(map[string]domain.LotteryEntry)
+	}
+	if _, ok := m.entries[entry.ItemID][entry.UserID]; ok {
+		return false, nil
+	}
+	m.entries[entry.ItemID][entry.UserID] = entry
+	return true, nil
+}
+
+func (m *mockLottery) DrawEntries(ctx context.Context, itemID string, n int) ([]domain.LotteryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var drawn []domain.LotteryEntry
+	for user, entry := range m.entries[itemID] {
+		if len(drawn) == n {
+			break
+		}
+		drawn = append(drawn, entry)
+		delete(m.entries[itemID], user)
+	}
+	return drawn, nil
+}
+
+func (m *mockLottery) LotteryItems(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []string
+	for item, entries := range m.entries {
+		if len(entries) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockLottery) count(itemID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries[itemID])
+}
+
+func TestLotteryService_EnterAndDraw(t *testing.T) {
+	ctx := context.Background()
+	svc := NewOrderService(newMockCacheRepo(2), 10)
+	lottery := NewLotteryService(svc, newMockLottery(), newMockLocker(), time.Now().Add(time.Hour))
+
+	for i := range 5 {
+		if err := lottery.Enter(ctx, fmt.Sprintf("req-%d", i), fmt.Sprintf("user-%d", i), "item-1", 1); err != nil {
+			t.Fatalf("entry %d: unexpected error: %v", i, err)
+		}
+	}
+	if err := lottery.Enter(ctx, "req-0", "user-0", "item-1", 1); err != nil {
+		t.Errorf("expected a retried entry to be accepted, got %v", err)
+	}
+	if err := lottery.Enter(ctx, "req-again", "user-0", "item-1", 1); !errors.Is(err, ErrAlreadyEntered) {
+		t.Errorf("expected ErrAlreadyEntered, got %v", err)
+	}
+	if result, _ := svc.PurchaseState(ctx, "req-0"); result == nil || result.Status != domain.PurchaseStatusEntered {
+		t.Errorf("expected req-0 to be entered, got %+v", result)
+	}
+	if _, err := lottery.Draw(ctx, "item-1"); !errors.Is(err, ErrLotteryOpen) {
+		t.Fatalf("expected ErrLotteryOpen before entries close, got %v", err)
+	}
+
+	lottery.closesAt = time.Now().Add(-time.Second)
+	if err := lottery.Enter(ctx, "req-late", "user-late", "item-1", 1); !errors.Is(err, ErrSaleClosed) {
+		t.Errorf("expected ErrSaleClosed after entries close, got %v", err)
+	}
+
+	draw, err := lottery.Draw(ctx, "item-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if draw.Entries != 5 || draw.Winners != 2 {
+		t.Errorf("expected 2 winners of 5 entries, got %+v", draw)
+	}
+
+	statuses := make(map[domain.PurchaseStatus]int)
+	for i := range 5 {
+		result, err := svc.PurchaseState(ctx, fmt.Sprintf("req-%d", i))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		statuses[result.Status]++
+	}
+	if statuses[domain.PurchaseStatusSucceeded] != 2 || statuses[domain.PurchaseStatusNotDrawn] != 3 {
+		t.Errorf("expected 2 winners and 3 not drawn, got %v", statuses)
+	}
+	if len(svc.GetOrderQueue()) != 2 {
+		t.Errorf("expected 2 queued orders, got %d", len(svc.GetOrderQueue()))
+	}
+}
+
+func TestLotteryService_DrawPutsBackWhenPaused(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(10)
+	entries := newMockLottery()
+	svc := NewOrderService(cache, 10)
+	lottery := NewLotteryService(svc, entries, newMockLocker(), time.Now().Add(time.Hour))
+
+	for i := range 3 {
+		if err := lottery.Enter(ctx, fmt.Sprintf("req-%d", i), fmt.Sprintf("user-%d", i), "item-1", 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	lottery.closesAt = time.Now().Add(-time.Second)
+
+	cache.reject = domain.StockFrozen
+	if _, err := lottery.Draw(ctx, "item-1"); !errors.Is(err, ErrSaleFrozen) {
+		t.Fatalf("expected ErrSaleFrozen, got %v", err)
+	}
+	if entries.count("item-1") != 3 {
+		t.Fatalf("expected every entry to be put back, got %d", entries.count("item-1"))
+	}
+
+	cache.reject = domain.StockDecremented
+	draw, err := lottery.Draw(ctx, "item-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if draw.Winners != 3 {
+		t.Errorf("expected all 3 entries to win once resumed, got %+v", draw)
+	}
+}
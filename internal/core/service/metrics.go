@@ -0,0 +1,13 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+type noopMetrics struct{}
+
+func (noopMetrics) PurchaseCompleted(context.Context, string, time.Duration) {}
+func (noopMetrics) OrdersPersisted(int)                                      {}
+func (noopMetrics) OrderFailed()                                             {}
+func (noopMetrics) StageTimedOut(string)                                     {}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const (
+	notifyTimeout = 10 * time.Second
+	// notifiedLockTTL is how long a server claims an expired hold's
+	// notification, so the other servers seeing the same event skip it
+	notifiedLockTTL = time.Hour
+)
+
+// NotificationService tells buyers about their orders through a notifier.
+// Notifications are queued and sent by a background worker, so a slow or
+// failing notifier never holds up saving orders; each is retried with a
+// doubling delay and given up on once its attempts run out. Notifications
+// that find the queue full are dropped.
+type NotificationService struct {
+	notifier port.Notifier
+	queue    chan domain.Notification
+	attempts int
+	backoff  time.Duration
+}
+
+// NewNotificationService queues up to queueSize notifications and makes up
+// to attempts tries at each, the first retry after backoff.
+func NewNotificationService(notifier port.Notifier, queueSize, attempts int, backoff time.Duration) *NotificationService {
+	return &NotificationService{
+		notifier: notifier,
+		queue:    make(chan domain.Notification, queueSize),
+		attempts: max(attempts, 1),
+		backoff:  backoff,
+	}
+}
+
+// Subscribe queues the notification of every order saved on bus.
+func (s *NotificationService) Subscribe(bus port.EventBus) {
+	bus.Subscribe(domain.EventOrderPersisted, func(ctx context.Context, event domain.Event) {
+		s.OrderPlaced(event.(domain.OrderPersisted).OrderSummary)
+	})
+}
+
+// OrderPlaced queues the notification that a saved order is the buyer's.
+func (s *NotificationService) OrderPlaced(order domain.OrderSummary) {
+	body := fmt.Sprintf("You got %d x %s! Your order %s is saved.", order.Quantity, order.ItemID, order.OrderID)
+	if !order.ExpiresAt.IsZero() {
+		body += fmt.Sprintf(" Confirm it by %s or it will be released.", order.ExpiresAt.UTC().Format(time.RFC1123))
+	}
+	s.enqueue(domain.Notification{
+		Kind:     domain.NotificationOrderPlaced,
+		UserID:   order.UserID,
+		OrderID:  order.OrderID,
+		ItemID:   order.ItemID,
+		Quantity: order.Quantity,
+		Subject:  "You got one!",
+		Body:     body,
+	})
+}
+
+// HoldExpired queues the notification that the buyer's order expired.
+func (s *NotificationService) HoldExpired(event domain.OrderEvent) {
+	s.enqueue(domain.Notification{
+		Kind:     domain.NotificationHoldExpired,
+		UserID:   event.UserID,
+		OrderID:  event.OrderID,
+		ItemID:   event.ItemID,
+		Quantity: event.Quantity,
+		Subject:  "Your order expired",
+		Body:     fmt.Sprintf("Your order %s for %d x %s was not confirmed in time and has been released.", event.OrderID, event.Quantity, event.ItemID),
+	})
+}
+
+func (s *NotificationService) enqueue(notification domain.Notification) {
+	select {
+	case s.queue <- notification:
+	default:
+		log.Printf("notification %s for order %s dropped: queue full", notification.Kind, notification.OrderID)
+	}
+}
+
+// Run sends queued notifications until ctx is cancelled. Notifications
+// still queued then are not sent.
+func (s *NotificationService) Run(ctx context.Context) {
+	for {
+		select {
+		case notification := <-s.queue:
+			if err := s.send(ctx, notification); err != nil {
+				log.Printf("notification %s for order %s not sent: %v", notification.Kind, notification.OrderID, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WatchExpiries queues a notification for every expired hold published on
+// events until ctx is done. Every server sees each event, so the first to
+// claim it through locker notifies and the others skip it.
+func (s *NotificationService) WatchExpiries(ctx context.Context, events port.OrderEventFeed, locker port.Locker) error {
+	watch, err := events.WatchOrderEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("watch order events: %w", err)
+	}
+
+	go func() {
+		for event := range watch {
+			if event.Type != domain.OrderEventExpired {
+				continue
+			}
+			_, ok, err := locker.TryLock(ctx, "notify-expired:"+event.OrderID, notifiedLockTTL)
+			if err != nil {
+				log.Printf("notification for expired order %s: claim failed: %v", event.OrderID, err)
+				continue
+			}
+			if ok {
+				s.HoldExpired(event)
+			}
+		}
+	}()
+	return nil
+}
+
+// send delivers a notification, retrying failures until its attempts run
+// out or ctx is cancelled.
+func (s *NotificationService) send(ctx context.Context, notification domain.Notification) error {
+	var err error
+	for attempt := 0; attempt < s.attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		err = s.notifier.Notify(notifyCtx, notification)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%d attempts failed, last: %w", s.attempts, err)
+}
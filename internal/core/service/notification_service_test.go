@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockNotifier fails the first failures notifications it is given and
+// records the ones it delivers.
+type mockNotifier struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  int
+	delivered []domain.Notification
+}
+
+func (m *mockNotifier) Notify(ctx context.Context, notification domain.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("mail server down")
+	}
+	m.delivered = append(m.delivered, notification)
+	return nil
+}
+
+func TestNotificationService_Retries(t *testing.T) {
+	ctx := context.Background()
+	notifier := &mockNotifier{failures: 2}
+	svc := NewNotificationService(notifier, 10, 3, time.Millisecond)
+
+	if err := svc.send(ctx, domain.Notification{OrderID: "order-1"}); err != nil || len(notifier.delivered) != 1 {
+		t.Fatalf("expected delivery on the third attempt, got %d delivered, %v", len(notifier.delivered), err)
+	}
+
+	notifier.failures = 3
+	if err := svc.send(ctx, domain.Notification{OrderID: "order-2"}); err == nil || notifier.attempts != 6 {
+		t.Errorf("expected to give up after 3 attempts, got %d attempts, %v", notifier.attempts, err)
+	}
+}
+
+func TestOrderWorker_Notifications(t *testing.T) {
+	notifier := &mockNotifier{}
+	notifications := NewNotificationService(notifier, 1, 1, 0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	queue := make(chan domain.Order, 2)
+	queue <- newTestOrder("order-1")
+	queue <- newTestOrder("order-2")
+	close(queue)
+	bus := newMockEventBus()
+	notifications.Subscribe(bus)
+	NewOrderWorker(0, queue, newMockDatabaseRepo(), newMockCacheRepo(0), tuning, WithWorkerEvents(bus)).Run()
+
+	// The second order found the queue full
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		notifications.Run(ctx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		notifier.mu.Lock()
+		delivered := len(notifier.delivered)
+		notifier.mu.Unlock()
+		if delivered > 0 {
+			break
+		}
+	}
+	cancel()
+	<-done
+
+	if len(notifier.delivered) != 1 || notifier.delivered[0].Kind != domain.NotificationOrderPlaced || notifier.delivered[0].UserID != "user" {
+		t.Errorf("expected one order placed notification, got %+v", notifier.delivered)
+	}
+}
+
+func TestNotificationService_WatchExpiries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := &mockOrderEventFeed{events: make(chan domain.OrderEvent, 2)}
+	locker := newMockLocker()
+	svc := NewNotificationService(&mockNotifier{}, 10, 1, 0)
+
+	if err := svc.WatchExpiries(ctx, events, locker); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	// Another server already claimed order-1
+	locker.TryLock(ctx, "notify-expired:order-1", time.Hour)
+	events.events <- domain.OrderEvent{Type: domain.OrderEventExpired, OrderID: "order-1", UserID: "user-1"}
+	events.events <- domain.OrderEvent{Type: domain.OrderEventExpired, OrderID: "order-2", UserID: "user-2"}
+
+	select {
+	case notification := <-svc.queue:
+		if notification.Kind != domain.NotificationHoldExpired || notification.OrderID != "order-2" {
+			t.Errorf("expected the expiry of order-2, got %+v", notification)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification queued")
+	}
+}
+
+// mockOrderEventFeed delivers the events sent on events to one watcher.
+type mockOrderEventFeed struct {
+	mockOrderEvents
+	events chan domain.OrderEvent
+}
+
+func (f *mockOrderEventFeed) WatchOrderEvents(ctx context.Context) (<-chan domain.OrderEvent, error) {
+	return f.events, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// archiveLockTTL bounds how long a crashed archive run keeps other servers
+// from archiving. A run stops moving batches at half of it so the lock never
+// lapses under a live one.
+const archiveLockTTL = 10 * time.Minute
+
+// OrderArchiver moves orders past their retention out of the orders table,
+// so the table every purchase writes to stays small. One server archives at
+// a time.
+type OrderArchiver struct {
+	archive   port.OrderArchive
+	locker    port.Locker
+	retention time.Duration
+	batchSize int
+	blob      *blobArchive
+	now       func() time.Time
+}
+
+type OrderArchiverOption func(*OrderArchiver)
+
+// NewOrderArchiver archives orders older than retention, batchSize orders
+// per transaction.
+func NewOrderArchiver(archive port.OrderArchive, locker port.Locker, retention time.Duration, batchSize int, opts ...OrderArchiverOption) *OrderArchiver {
+	a := &OrderArchiver{
+		archive:   archive,
+		locker:    locker,
+		retention: retention,
+		batchSize: max(batchSize, 1),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Archive moves the orders past retention a batch at a time, reporting how
+// many it moved. It returns at once with none moved if another server holds
+// the archive lock, and leaves what remains after archiveLockTTL/2 to the
+// next run.
+func (a *OrderArchiver) Archive(ctx context.Context) (int, error) {
+	release, ok, err := a.locker.TryLock(ctx, "archive-orders", archiveLockTTL)
+	if err != nil {
+		return 0, fmt.Errorf("acquire archive lock: %w", err)
+	}
+	if !ok {
+		return 0, nil
+	}
+	defer func() {
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("order archive: failed to release lock: %v", err)
+		}
+	}()
+
+	start := a.now()
+	cutoff := start.Add(-a.retention)
+	var run *blobRun
+	if a.blob != nil {
+		run = a.blob.newRun(start, cutoff)
+	}
+	archived := 0
+	for a.now().Sub(start) < archiveLockTTL/2 {
+		var n int
+		if run != nil {
+			n, err = a.blob.offload.OffloadOrders(ctx, cutoff, a.batchSize, run.keep(ctx))
+		} else {
+			n, err = a.archive.ArchiveOrders(ctx, cutoff, a.batchSize)
+		}
+		archived += n
+		if err != nil {
+			return archived, fmt.Errorf("archive orders: %w", err)
+		}
+		if n < a.batchSize {
+			break
+		}
+	}
+	if archived > 0 && run != nil {
+		log.Printf("archived %d orders created before %s to %s", archived, cutoff.Format(time.RFC3339), run.manifestKey())
+	} else if archived > 0 {
+		log.Printf("archived %d orders created before %s", archived, cutoff.Format(time.RFC3339))
+	}
+	return archived, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockOrderArchive has a number of orders past retention and moves them
+// limit at a time.
+type mockOrderArchive struct {
+	old     int
+	batches int
+	before  time.Time
+}
+
+func (m *mockOrderArchive) ArchiveOrders(ctx context.Context, before time.Time, limit int) (int, error) {
+	n := min(m.old, limit)
+	m.old -= n
+	m.batches++
+	m.before = before
+	return n, nil
+}
+
+func TestOrderArchiver_Archive(t *testing.T) {
+	ctx := context.Background()
+	archive := &mockOrderArchive{old: 7}
+	locker := newMockLocker()
+	archiver := NewOrderArchiver(archive, locker, 30*24*time.Hour, 3)
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	archiver.now = func() time.Time { return now }
+
+	archived, err := archiver.Archive(ctx)
+	if err != nil || archived != 7 || archive.batches != 3 {
+		t.Fatalf("expected 7 orders in 3 batches, got %d in %d, %v", archived, archive.batches, err)
+	}
+	if want := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC); !archive.before.Equal(want) {
+		t.Errorf("expected cutoff %s, got %s", want, archive.before)
+	}
+
+	// Another server is archiving
+	archive.old = 5
+	release, _, _ := locker.TryLock(ctx, "archive-orders", time.Minute)
+	if archived, err := archiver.Archive(ctx); err != nil || archived != 0 || archive.old != 5 {
+		t.Errorf("expected nothing archived without the lock, got %d, %v", archived, err)
+	}
+	release(ctx)
+
+	// A run that reaches half the lock TTL leaves the rest for the next
+	archive.batches = 0
+	archiver.now = func() time.Time {
+		now = now.Add(archiveLockTTL / 4)
+		return now
+	}
+	if archived, _ := archiver.Archive(ctx); archived != 3 || archive.batches != 1 {
+		t.Errorf("expected one batch before the time limit, got %d in %d", archived, archive.batches)
+	}
+}
+
+// mockBlobStore keeps objects in a map and fails puts of keys containing
+// failKey.
+type mockBlobStore struct {
+	objects map[string][]byte
+	failKey string
+}
+
+func (m *mockBlobStore) PutBlob(ctx context.Context, key string, data []byte, contentType string) error {
+	if m.failKey != "" && strings.Contains(key, m.failKey) {
+		return errors.New("bucket unavailable")
+	}
+	m.objects[key] = slices.Clone(data)
+	return nil
+}
+
+func (m *mockBlobStore) GetBlob(ctx context.Context, key string) ([]byte, error) {
+	return m.objects[key], nil
+}
+
+// mockOrderOffload hands its orders to keep limit at a time and drops them
+// when keep succeeds.
+type mockOrderOffload struct {
+	orders []domain.Order
+}
+
+func (m *mockOrderOffload) OffloadOrders(ctx context.Context, before time.Time, limit int, keep func([]domain.Order) error) (int, error) {
+	batch := m.orders[:min(limit, len(m.orders))]
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := keep(batch); err != nil {
+		return 0, err
+	}
+	m.orders = m.orders[len(batch):]
+	return len(batch), nil
+}
+
+func TestOrderArchiver_BlobArchive(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	var orders []domain.Order
+	for i := range 5 {
+		orders = append(orders, domain.Order{
+			ID: fmt.Sprintf("order-%d", i), ItemID: "item-1", UserID: "user-1", Quantity: 1,
+			Status: domain.OrderStatusConfirmed, CreatedAt: now.AddDate(0, -2, i),
+			Items: []domain.OrderItem{{ItemID: "item-1", Quantity: 1}},
+		})
+	}
+	offload := &mockOrderOffload{orders: slices.Clone(orders)}
+	blobs := &mockBlobStore{objects: make(map[string][]byte)}
+	archiver := NewOrderArchiver(nil, newMockLocker(), 30*24*time.Hour, 2, WithBlobArchive(blobs, offload, "orders/"))
+	archiver.now = func() time.Time { return now }
+
+	archived, err := archiver.Archive(ctx)
+	if err != nil || archived != 5 || len(offload.orders) != 0 {
+		t.Fatalf("expected 5 orders offloaded, got %d, %v", archived, err)
+	}
+	if len(blobs.objects) != 4 {
+		t.Fatalf("expected 3 batches and a manifest, got %d objects", len(blobs.objects))
+	}
+
+	var restored []domain.Order
+	err = LoadArchive(ctx, blobs, "orders/20260331T000000Z/manifest.json", func(batch []domain.Order) error {
+		restored = append(restored, batch...)
+		return nil
+	})
+	if err != nil || len(restored) != 5 {
+		t.Fatalf("expected the 5 orders back, got %d, %v", len(restored), err)
+	}
+	for i, order := range restored {
+		if order.ID != orders[i].ID || !order.CreatedAt.Equal(orders[i].CreatedAt) || len(order.Items) != 1 {
+			t.Errorf("expected %+v back, got %+v", orders[i], order)
+		}
+	}
+
+	// A tampered batch fails the load
+	key := "orders/20260331T000000Z/batch-00002.ndjson.gz"
+	blobs.objects[key] = blobs.objects["orders/20260331T000000Z/batch-00001.ndjson.gz"]
+	if err := LoadArchive(ctx, blobs, "orders/20260331T000000Z/manifest.json", func([]domain.Order) error { return nil }); err == nil {
+		t.Error("expected a checksum error for a changed batch")
+	}
+}
+
+func TestOrderArchiver_BlobArchiveKeepsOrdersOnFailure(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	offload := &mockOrderOffload{orders: []domain.Order{{ID: "order-1", CreatedAt: now.AddDate(0, -2, 0)}}}
+	blobs := &mockBlobStore{objects: make(map[string][]byte), failKey: "manifest"}
+	archiver := NewOrderArchiver(nil, newMockLocker(), 30*24*time.Hour, 2, WithBlobArchive(blobs, offload, "orders/"))
+	archiver.now = func() time.Time { return now }
+
+	if archived, err := archiver.Archive(ctx); err == nil || archived != 0 {
+		t.Fatalf("expected the run to fail without a manifest, got %d, %v", archived, err)
+	}
+	if len(offload.orders) != 1 {
+		t.Error("expected the order kept when its batch is not in a manifest")
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// ArchiveManifest lists the batches one archive run wrote to object
+// storage. It is rewritten after every batch, so it only ever names batches
+// whose orders were deleted from the database or are about to be.
+type ArchiveManifest struct {
+	Run     time.Time      `json:"run"`
+	Before  time.Time      `json:"before"`
+	Batches []ArchiveBatch `json:"batches"`
+}
+
+// ArchiveBatch is one gzipped NDJSON object of archived orders, one order
+// per line.
+type ArchiveBatch struct {
+	Key            string    `json:"key"`
+	Orders         int       `json:"orders"`
+	FirstCreatedAt time.Time `json:"first_created_at"`
+	LastCreatedAt  time.Time `json:"last_created_at"`
+	SHA256         string    `json:"sha256"`
+	Bytes          int       `json:"bytes"`
+}
+
+// WithBlobArchive moves old orders to object storage instead of the archive
+// tables. Each run writes its batches and a manifest.json under
+// prefix/<run time>/, and a batch is deleted from the database only once it
+// and the manifest naming it are stored. LoadArchive reads a run back.
+func WithBlobArchive(blobs port.BlobStore, offload port.OrderOffload, prefix string) OrderArchiverOption {
+	return func(a *OrderArchiver) {
+		a.blob = &blobArchive{blobs: blobs, offload: offload, prefix: prefix}
+	}
+}
+
+type blobArchive struct {
+	blobs   port.BlobStore
+	offload port.OrderOffload
+	prefix  string
+}
+
+func (b *blobArchive) newRun(start, cutoff time.Time) *blobRun {
+	start = start.UTC()
+	return &blobRun{
+		blobs:    b.blobs,
+		dir:      b.prefix + start.Format("20060102T150405Z") + "/",
+		manifest: ArchiveManifest{Run: start, Before: cutoff.UTC()},
+	}
+}
+
+// blobRun writes the batches of one archive run. A sharded database offloads
+// its shards concurrently, so keep serializes them.
+type blobRun struct {
+	blobs port.BlobStore
+	dir   string
+
+	mu       sync.Mutex
+	written  int
+	manifest ArchiveManifest
+}
+
+func (r *blobRun) manifestKey() string {
+	return r.dir + "manifest.json"
+}
+
+func (r *blobRun) keep(ctx context.Context) func([]domain.Order) error {
+	return func(orders []domain.Order) error {
+		data, err := encodeOrders(orders)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		// A failed batch keeps its number, so its object never ends up
+		// overwritten by one the manifest names
+		r.written++
+		batch := ArchiveBatch{
+			Key:            fmt.Sprintf("%sbatch-%05d.ndjson.gz", r.dir, r.written),
+			Orders:         len(orders),
+			FirstCreatedAt: orders[0].CreatedAt,
+			LastCreatedAt:  orders[len(orders)-1].CreatedAt,
+			SHA256:         hex.EncodeToString(sum[:]),
+			Bytes:          len(data),
+		}
+		if err := r.blobs.PutBlob(ctx, batch.Key, data, "application/gzip"); err != nil {
+			return fmt.Errorf("store %s: %w", batch.Key, err)
+		}
+
+		manifest := r.manifest
+		manifest.Batches = append(slices.Clone(manifest.Batches), batch)
+		body, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := r.blobs.PutBlob(ctx, r.manifestKey(), body, "application/json"); err != nil {
+			return fmt.Errorf("store %s: %w", r.manifestKey(), err)
+		}
+		r.manifest = manifest
+		return nil
+	}
+}
+
+// encodeOrders gzips the orders as NDJSON.
+func encodeOrders(orders []domain.Order) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, order := range orders {
+		if err := enc.Encode(order); err != nil {
+			return nil, fmt.Errorf("encode order %s: %w", order.ID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadArchive reads back the run whose manifest is stored under
+// manifestKey, passing the orders of each batch to fn in the order they
+// were archived. A batch that is missing or does not match its checksum
+// stops the load with an error.
+func LoadArchive(ctx context.Context, blobs port.BlobStore, manifestKey string, fn func([]domain.Order) error) error {
+	body, err := blobs.GetBlob(ctx, manifestKey)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", manifestKey, err)
+	}
+	if body == nil {
+		return fmt.Errorf("archive manifest %s not found", manifestKey)
+	}
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return fmt.Errorf("decode %s: %w", manifestKey, err)
+	}
+
+	for _, batch := range manifest.Batches {
+		data, err := blobs.GetBlob(ctx, batch.Key)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", batch.Key, err)
+		}
+		if data == nil {
+			return fmt.Errorf("archive batch %s not found", batch.Key)
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != batch.SHA256 {
+			return fmt.Errorf("archive batch %s does not match its checksum", batch.Key)
+		}
+		orders, err := decodeOrders(data)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", batch.Key, err)
+		}
+		if len(orders) != batch.Orders {
+			return fmt.Errorf("archive batch %s has %d orders, expected %d", batch.Key, len(orders), batch.Orders)
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOrders(data []byte) ([]domain.Order, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var orders []domain.Order
+	dec := json.NewDecoder(zr)
+	for {
+		var order domain.Order
+		err := dec.Decode(&order)
+		if errors.Is(err, io.EOF) {
+			return orders, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Order change log page sizes
+const (
+	DefaultOrderChangePageSize = 100
+	MaxOrderChangePageSize     = 1000
+)
+
+var ErrInvalidOrderChangeFilter = errors.New("invalid order change filter")
+
+// OrderChangeService reads the change log of the event-sourced order store,
+// to audit an order or replay a sale.
+type OrderChangeService struct {
+	log port.OrderChangeLog
+}
+
+// OrderChangeHistory is every change of an order, oldest first, and the
+// order they derive. Order is nil once the order was archived.
+type OrderChangeHistory struct {
+	Changes []domain.OrderChange
+	Order   *domain.Order
+}
+
+// OrderChangePage is one page of the change log in Seq order. NextAfter
+// continues the listing and is 0 on the last page.
+type OrderChangePage struct {
+	Changes   []domain.OrderChange
+	NextAfter int64
+}
+
+func NewOrderChangeService(log port.OrderChangeLog) *OrderChangeService {
+	return &OrderChangeService{log: log}
+}
+
+// History returns the changes of an order and the state they derive. An
+// order without changes, including one saved before changes were kept, is
+// ErrOrderNotFound.
+func (s *OrderChangeService) History(ctx context.Context, orderID string) (*OrderChangeHistory, error) {
+	changes, err := s.log.OrderChanges(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("read changes of order %s: %w", orderID, err)
+	}
+	if len(changes) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	order, err := domain.ReplayOrder(changes)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderChangeHistory{Changes: changes, Order: order}, nil
+}
+
+// Page returns up to limit changes of any order after the one numbered
+// after. A zero limit uses DefaultOrderChangePageSize.
+func (s *OrderChangeService) Page(ctx context.Context, after int64, limit int) (*OrderChangePage, error) {
+	if limit == 0 {
+		limit = DefaultOrderChangePageSize
+	}
+	if limit < 1 || limit > MaxOrderChangePageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidOrderChangeFilter, MaxOrderChangePageSize)
+	}
+	if after < 0 {
+		return nil, fmt.Errorf("%w: after must not be negative", ErrInvalidOrderChangeFilter)
+	}
+
+	changes, err := s.log.OrderChangesAfter(ctx, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("read order changes: %w", err)
+	}
+	page := &OrderChangePage{Changes: changes}
+	if len(changes) == limit {
+		page.NextAfter = changes[len(changes)-1].Seq
+	}
+	return page, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockOrderChangeLog serves a fixed change log; a change's Seq is its
+// position plus one.
+type mockOrderChangeLog struct {
+	changes []domain.OrderChange
+}
+
+func (l *mockOrderChangeLog) OrderChanges(ctx context.Context, orderID string) ([]domain.OrderChange, error) {
+	var changes []domain.OrderChange
+	for _, change := range l.changes {
+		if change.OrderID == orderID {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (l *mockOrderChangeLog) OrderChangesAfter(ctx context.Context, afterSeq int64, limit int) ([]domain.OrderChange, error) {
+	start := min(int(afterSeq), len(l.changes))
+	return l.changes[start:min(start+limit, len(l.changes))], nil
+}
+
+func TestOrderChangeService(t *testing.T) {
+	ctx := context.Background()
+	order := newTestOrder("order-1")
+	log := &mockOrderChangeLog{changes: []domain.OrderChange{
+		{Seq: 1, OrderID: "order-1", Type: domain.OrderChangeAccepted, Order: &order},
+		{Seq: 2, OrderID: "order-1", Type: domain.OrderChangePersisted},
+		{Seq: 3, OrderID: "order-1", Type: domain.OrderChangeConfirmed, PaymentID: "pay-1"},
+		{Seq: 4, OrderID: "order-2", Type: domain.OrderChangeConfirmed},
+	}}
+	svc := NewOrderChangeService(log)
+
+	history, err := svc.History(ctx, "order-1")
+	if err != nil || len(history.Changes) != 3 || history.Order.Status != domain.OrderStatusConfirmed || history.Order.PaymentID != "pay-1" {
+		t.Fatalf("expected order-1 derived as confirmed, got %+v, %v", history, err)
+	}
+	if _, err := svc.History(ctx, "order-3"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected an order without changes not found, got %v", err)
+	}
+	if _, err := svc.History(ctx, "order-2"); !errors.Is(err, domain.ErrInvalidOrderChanges) {
+		t.Errorf("expected changes not starting with accepted refused, got %v", err)
+	}
+
+	page, err := svc.Page(ctx, 0, 3)
+	if err != nil || len(page.Changes) != 3 || page.NextAfter != 3 {
+		t.Fatalf("expected a full first page, got %+v, %v", page, err)
+	}
+	if page, _ := svc.Page(ctx, page.NextAfter, 3); len(page.Changes) != 1 || page.NextAfter != 0 {
+		t.Errorf("expected a last page of 1, got %+v", page)
+	}
+	if _, err := svc.Page(ctx, 0, MaxOrderChangePageSize+1); !errors.Is(err, ErrInvalidOrderChangeFilter) {
+		t.Errorf("expected an oversized page refused, got %v", err)
+	}
+}
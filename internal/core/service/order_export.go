@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// OrderExporter reads every order, or those of an item or time window, a
+// batch at a time for bulk exports. Reads are paced so an export of millions of orders
+// neither holds them all in memory nor starves the database.
+type OrderExporter struct {
+	db            port.DatabaseRepository
+	batchSize     int
+	rowsPerSecond int
+}
+
+// NewOrderExporter reads batchSize orders per query and at most
+// rowsPerSecond orders a second; zero leaves the rate unlimited.
+func NewOrderExporter(db port.DatabaseRepository, batchSize, rowsPerSecond int) *OrderExporter {
+	return &OrderExporter{db: db, batchSize: max(batchSize, 1), rowsPerSecond: rowsPerSecond}
+}
+
+// Export calls fn with each batch of orders in window, in ID order, until
+// every one has been read, fn fails or ctx is done. An empty window exports
+// all orders.
+func (e *OrderExporter) Export(ctx context.Context, window domain.OrderWindow, fn func([]domain.Order) error) error {
+	start := time.Now()
+	var after string
+	var rows int
+	for {
+		orders, err := e.db.ListOrdersAfter(ctx, window, after, e.batchSize)
+		if err != nil {
+			return fmt.Errorf("list orders: %w", err)
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+		if len(orders) < e.batchSize {
+			return nil
+		}
+		after = orders[len(orders)-1].ID
+		rows += len(orders)
+
+		if err := e.pace(ctx, start, rows); err != nil {
+			return err
+		}
+	}
+}
+
+// pace waits until rows orders since start are within the rate limit.
+func (e *OrderExporter) pace(ctx context.Context, start time.Time, rows int) error {
+	if e.rowsPerSecond <= 0 {
+		return ctx.Err()
+	}
+	due := start.Add(time.Duration(rows) * time.Second / time.Duration(e.rowsPerSecond))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
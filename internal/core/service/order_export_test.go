@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestOrderExporter_Export(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	for i := range 7 {
+		id := fmt.Sprintf("order-%d", i)
+		db.orders[id] = domain.Order{ID: id, ItemID: "item-1"}
+	}
+	db.orders["other"] = domain.Order{ID: "other", ItemID: "item-2"}
+
+	var batches, rows int
+	err := NewOrderExporter(db, 3, 0).Export(ctx, domain.OrderWindow{ItemID: "item-1"}, func(orders []domain.Order) error {
+		batches++
+		rows += len(orders)
+		return nil
+	})
+	if err != nil || batches != 3 || rows != 7 {
+		t.Errorf("expected 7 orders in 3 batches, got %d in %d, %v", rows, batches, err)
+	}
+
+	// 7 rows at 100 a second cannot finish within 40ms
+	start := time.Now()
+	NewOrderExporter(db, 3, 100).Export(ctx, domain.OrderWindow{ItemID: "item-1"}, func([]domain.Order) error { return nil })
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the export to be paced, took %v", elapsed)
+	}
+
+	errStop := errors.New("stop")
+	err = NewOrderExporter(db, 3, 0).Export(ctx, domain.OrderWindow{}, func([]domain.Order) error { return errStop })
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected the callback's error, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Order history page sizes
+const (
+	DefaultOrderPageSize = 20
+	MaxOrderPageSize     = 100
+)
+
+var ErrInvalidOrderFilter = errors.New("invalid order filter")
+
+// OrderHistoryService lists a user's orders a page at a time from the order
+// read model, so a just saved order or status change may take a moment to
+// show.
+type OrderHistoryService struct {
+	orders port.OrderReadModel
+}
+
+// OrderPage is one page of a user's orders, newest first. Next resumes the
+// listing after the page and is nil on the last one.
+type OrderPage struct {
+	Orders []domain.Order
+	Next   *domain.OrderCursor
+}
+
+func NewOrderHistoryService(orders port.OrderReadModel) *OrderHistoryService {
+	return &OrderHistoryService{orders: orders}
+}
+
+// List returns the page of userID's orders selected by filter. A zero limit
+// uses DefaultOrderPageSize.
+func (s *OrderHistoryService) List(ctx context.Context, userID string, filter domain.OrderFilter) (*OrderPage, error) {
+	if filter.Limit == 0 {
+		filter.Limit = DefaultOrderPageSize
+	}
+	if err := validateOrderFilter(filter); err != nil {
+		return nil, err
+	}
+
+	// One extra order tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	orders, err := s.orders.ListOrderViews(ctx, userID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list orders: %w", err)
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.Next = &domain.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	return page, nil
+}
+
+func validateOrderFilter(filter domain.OrderFilter) error {
+	switch filter.Status {
+	case "", domain.OrderStatusPending, domain.OrderStatusConfirmed, domain.OrderStatusCancelled, domain.OrderStatusExpired, domain.OrderStatusRefunded:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidOrderFilter, filter.Status)
+	}
+	if filter.Limit < 1 || filter.Limit > MaxOrderPageSize {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidOrderFilter, MaxOrderPageSize)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidOrderFilter)
+	}
+	return nil
+}
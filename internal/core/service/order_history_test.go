@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestOrderHistory_List(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	base := time.Now()
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		db.orders[id] = domain.Order{ID: id, UserID: "user-1", Status: domain.OrderStatusConfirmed, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+	}
+	history := NewOrderHistoryService(db)
+
+	var got []string
+	filter := domain.OrderFilter{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("expected the listing to end")
+		}
+		page, err := history.List(ctx, "user-1", filter)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, order := range page.Orders {
+			got = append(got, order.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		filter.After = page.Next
+	}
+	if ids := strings.Join(got, " "); ids != "e d c b a" {
+		t.Errorf("expected every order newest first, got %s", ids)
+	}
+
+	page, err := history.List(ctx, "user-1", domain.OrderFilter{})
+	if err != nil || len(page.Orders) != 5 || page.Next != nil {
+		t.Errorf("expected one page with the default size, got %+v, %v", page, err)
+	}
+
+	for _, filter := range []domain.OrderFilter{
+		{Status: "shipped"},
+		{Limit: MaxOrderPageSize + 1},
+		{Limit: -1},
+		{From: base, To: base},
+	} {
+		if _, err := history.List(ctx, "user-1", filter); !errors.Is(err, ErrInvalidOrderFilter) {
+			t.Errorf("%+v: expected ErrInvalidOrderFilter, got %v", filter, err)
+		}
+	}
+}
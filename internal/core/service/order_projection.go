@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// OrderProjection keeps the order read model up to date with the orders
+// written through it. Each order is projected by whoever wrote it, most
+// often an order worker, once the write has committed, so the write's
+// transaction and the inventory rows it locks are no busier than before.
+//
+// A projection copies the order as it stands, so projections racing each
+// other still leave the latest state. One that fails is logged, and the
+// order's copy stays as it was until the order is written again.
+type OrderProjection struct {
+	port.DatabaseRepository
+	model port.OrderReadModel
+}
+
+func NewOrderProjection(db port.DatabaseRepository, model port.OrderReadModel) *OrderProjection {
+	return &OrderProjection{DatabaseRepository: db, model: model}
+}
+
+func (p *OrderProjection) CreateOrder(ctx context.Context, order domain.Order) error {
+	if err := p.DatabaseRepository.CreateOrder(ctx, order); err != nil {
+		return err
+	}
+	p.project(ctx, order.ID)
+	return nil
+}
+
+func (p *OrderProjection) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	if err := p.DatabaseRepository.CreateOrders(ctx, orders); err != nil {
+		return err
+	}
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	p.project(ctx, ids...)
+	return nil
+}
+
+func (p *OrderProjection) FulfillAllocation(ctx context.Context, order domain.Order) error {
+	if err := p.DatabaseRepository.FulfillAllocation(ctx, order); err != nil {
+		return err
+	}
+	p.project(ctx, order.ID)
+	return nil
+}
+
+func (p *OrderProjection) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	updated, err := p.DatabaseRepository.UpdateOrderStatus(ctx, id, from, to)
+	if updated {
+		p.project(ctx, id)
+	}
+	return updated, err
+}
+
+func (p *OrderProjection) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	confirmed, err := p.DatabaseRepository.ConfirmOrder(ctx, id, paymentID)
+	if confirmed {
+		p.project(ctx, id)
+	}
+	return confirmed, err
+}
+
+func (p *OrderProjection) project(ctx context.Context, ids ...string) {
+	// The write has been made, so a caller giving up now must not stop
+	// its projection
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), followUpTimeout)
+	defer cancel()
+
+	if err := p.model.ProjectOrders(ctx, ids); err != nil {
+		log.Printf("read model: failed to project %d orders starting with %s: %v", len(ids), ids[0], err)
+	}
+}
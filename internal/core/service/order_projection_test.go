@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestOrderProjection(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	projection := NewOrderProjection(db, db)
+
+	if err := projection.CreateOrders(ctx, []domain.Order{newTestOrder("order-1"), newTestOrder("order-2")}); err != nil {
+		t.Fatalf("create orders: %v", err)
+	}
+	projection.ConfirmOrder(ctx, "order-1", "payment-1")
+	// Writes that change nothing leave the read model alone
+	projection.ConfirmOrder(ctx, "order-1", "payment-1")
+	projection.UpdateOrderStatus(ctx, "order-2", domain.OrderStatusConfirmed, domain.OrderStatusRefunded)
+
+	db.failOrders = 1
+	if err := projection.CreateOrder(ctx, newTestOrder("order-3")); err == nil {
+		t.Fatal("expected the create to fail")
+	}
+
+	if want := []string{"order-1", "order-2", "order-1"}; !slices.Equal(db.projected, want) {
+		t.Errorf("expected projections %v, got %v", want, db.projected)
+	}
+}
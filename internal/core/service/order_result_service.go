@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// OrderResultService waits for the final result of purchase requests.
+type OrderResultService struct {
+	orders  *OrderService
+	db      port.DatabaseRepository
+	results port.OrderResultFeed
+}
+
+func NewOrderResultService(orders *OrderService, db port.DatabaseRepository, results port.OrderResultFeed) *OrderResultService {
+	return &OrderResultService{orders: orders, db: db, results: results}
+}
+
+// Await returns the final result of a request: succeeded once its order is
+// persisted, or the reason it was rejected or rolled back. It blocks until
+// the result is known or ctx is done.
+func (s *OrderResultService) Await(ctx context.Context, requestID string) (domain.OrderResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Subscribe before reading the stored state so a result published in
+	// between is not missed
+	results, err := s.results.WatchOrderResult(ctx, requestID)
+	if err != nil {
+		return domain.OrderResult{}, fmt.Errorf("watch order result: %w", err)
+	}
+
+	state, err := s.orders.PurchaseState(ctx, requestID)
+	if err != nil {
+		return domain.OrderResult{}, err
+	}
+
+	switch state.Status {
+	case domain.PurchaseStatusQueued:
+	case domain.PurchaseStatusSucceeded:
+		order, err := s.db.GetOrder(ctx, state.OrderID)
+		if err != nil {
+			return domain.OrderResult{}, fmt.Errorf("get order: %w", err)
+		}
+		if order != nil {
+			return domain.OrderResult{RequestID: requestID, OrderID: order.ID, Status: domain.PurchaseStatusSucceeded}, nil
+		}
+	default:
+		return domain.OrderResult{RequestID: requestID, OrderID: state.OrderID, Status: state.Status}, nil
+	}
+
+	select {
+	case result, ok := <-results:
+		if !ok {
+			return domain.OrderResult{}, errors.New("order result feed closed")
+		}
+		return result, nil
+	case <-ctx.Done():
+		return domain.OrderResult{}, ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockResultFeed records published results and delivers them to watchers
+type mockResultFeed struct {
+	published []domain.OrderResult
+	watchers  map[string]chan domain.OrderResult
+	watching  chan string
+	mu        sync.Mutex
+}
+
+func newMockResultFeed() *mockResultFeed {
+	return &mockResultFeed{
+		watchers: make(map[string]chan domain.OrderResult),
+		watching: make(chan string, 10),
+	}
+}
+
+func (f *mockResultFeed) PublishOrderResult(ctx context.Context, result domain.OrderResult) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, result)
+	if ch, ok := f.watchers[result.RequestID]; ok {
+		ch <- result
+	}
+	return nil
+}
+
+func (f *mockResultFeed) WatchOrderResult(ctx context.Context, requestID string) (<-chan domain.OrderResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan domain.OrderResult, 1)
+	f.watchers[requestID] = ch
+	f.watching <- requestID
+	return ch, nil
+}
+
+func TestOrderResultService_Await(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	db := newMockDatabaseRepo()
+	feed := newMockResultFeed()
+	orders := NewOrderService(cache, 100)
+	results := NewOrderResultService(orders, db, feed)
+	ctx := context.Background()
+
+	if _, err := results.Await(ctx, "req-unknown"); !errors.Is(err, ErrPurchaseNotFound) {
+		t.Errorf("expected ErrPurchaseNotFound, got %v", err)
+	}
+
+	// Already persisted
+	orderID, _ := orders.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	order := <-orders.GetOrderQueue()
+	db.CreateOrder(ctx, order)
+	result, err := results.Await(ctx, "req-1")
+	if err != nil || result.Status != domain.PurchaseStatusSucceeded || result.OrderID != orderID {
+		t.Errorf("expected persisted order %s, got %+v, %v", orderID, result, err)
+	}
+
+	// Rejected
+	cache.reject = domain.StockInsufficient
+	orders.Purchase(ctx, "req-2", "user-2", "item-1", 1)
+	if result, _ := results.Await(ctx, "req-2"); result.Status != domain.PurchaseStatusSoldOut {
+		t.Errorf("expected sold_out, got %+v", result)
+	}
+	cache.reject = domain.StockDecremented
+
+	// Still queued: waits for the worker's result
+	orderID, _ = orders.Purchase(ctx, "req-3", "user-3", "item-1", 1)
+	done := make(chan domain.OrderResult)
+	go func() {
+		result, _ := results.Await(ctx, "req-3")
+		done <- result
+	}()
+	for <-feed.watching != "req-3" {
+	}
+	feed.PublishOrderResult(ctx, domain.OrderResult{RequestID: "req-3", OrderID: orderID, Status: domain.PurchaseStatusFailed})
+
+	select {
+	case result := <-done:
+		if result.Status != domain.PurchaseStatusFailed || result.OrderID != orderID {
+			t.Errorf("expected published failure, got %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return the published result")
+	}
+}
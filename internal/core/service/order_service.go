@@ -4,68 +4,1694 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/rl1809/flash-sale/internal/core/domain"
 	"github.com/rl1809/flash-sale/internal/port"
 )
 
+var tracer = otel.Tracer("github.com/rl1809/flash-sale/internal/core/service")
+
 var (
 	ErrDuplicateRequest  = errors.New("duplicate request")
 	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrItemNotFound      = errors.New("item not found")
+	ErrSaleFrozen        = errors.New("sale frozen")
+	ErrSaleClosed        = errors.New("sale closed")
+	ErrPreviousFailure   = errors.New("previous attempt failed")
+	ErrOverloaded        = errors.New("server overloaded")
+	ErrPriceMismatch     = errors.New("price mismatch")
+	ErrPurchaseNotFound  = errors.New("purchase not found")
+	ErrPurchaseLimit     = errors.New("purchase limit exceeded")
+	ErrMixedCurrency     = errors.New("items are priced in different currencies")
+	ErrRiskRejected      = errors.New("purchase rejected as suspicious")
+	// ErrCartUnsupported rejects multi-item purchases under per-user item
+	// idempotency, whose keys name a single item.
+	ErrCartUnsupported = errors.New("multi-item purchases need request idempotency")
+	// ErrCrossShardCart rejects carts whose items are kept on different
+	// database shards, as no one transaction could save their order.
+	ErrCrossShardCart = errors.New("cart items are stored on different shards")
+)
+
+var (
+	// ErrLoadShed is an ErrOverloaded returned before any work is done
+	// because the order queue is nearly full.
+	ErrLoadShed = fmt.Errorf("%w: order queue near capacity", ErrOverloaded)
+	// ErrQueueFull is an ErrOverloaded returned when a reserved order could
+	// not be queued in time. Its stock has been given back.
+	ErrQueueFull = fmt.Errorf("%w: order queue full", ErrOverloaded)
+	// ErrDegradedUnavailable is an ErrOverloaded returned while the cache
+	// is down for purchases that cannot be made without it.
+	ErrDegradedUnavailable = fmt.Errorf("%w: purchase unavailable while the cache is down", ErrOverloaded)
+	// ErrDegradedBusy is an ErrOverloaded returned while the cache is down
+	// once purchases reach the rate the database is trusted with.
+	ErrDegradedBusy = fmt.Errorf("%w: degraded purchase rate exceeded", ErrOverloaded)
+)
+
+// IdempotencyMode selects how idempotency keys are scoped.
+type IdempotencyMode string
+
+const (
+	// IdempotencyPerRequest deduplicates on the client supplied request ID.
+	IdempotencyPerRequest IdempotencyMode = "request"
+	// IdempotencyPerUserItem allows one purchase per user, item and campaign
+	// regardless of request ID.
+	IdempotencyPerUserItem IdempotencyMode = "user_item"
+)
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// Purchase outcomes reported to port.Metrics.
+const (
+	OutcomeSuccess    = "success"
+	OutcomeSoldOut    = "sold_out"
+	OutcomeNotFound   = "not_found"
+	OutcomeFrozen     = "frozen"
+	OutcomeClosed     = "closed"
+	OutcomeDuplicate  = "duplicate"
+	OutcomeOverloaded = "overloaded"
+	OutcomeShed       = "shed"
+	OutcomeQueueFull  = "queue_full"
+	OutcomeTimeout    = "timeout"
+	OutcomeLimited    = "limit_exceeded"
+	OutcomeRejected   = "rejected"
+	OutcomeBanned     = "blacklisted"
+	OutcomeError      = "error"
 )
 
+// OutcomePersistFailed is the failure counted in the sale statistics for an
+// order the workers could not save after its purchase succeeded.
+const OutcomePersistFailed = "persist_failed"
+
 type OrderService struct {
-	cache      port.CacheRepository
-	orderQueue chan domain.Order
+	cache port.CacheRepository
+
+	// queues holds one order queue, or one per partition when orders are
+	// partitioned by item; ring picks an item's partition
+	queues []chan domain.Order
+	ring   *hashRing
+
+	// priority holds a queue for VIP orders beside each partition when
+	// vipPriority is set; workers take from it first
+	priority    []chan domain.Order
+	vipPriority bool
+
+	idempotencyMode IdempotencyMode
+	idempotencyTTL  time.Duration
+	campaignID      string
+
+	poolWorkers int
+	poolBacklog int
+	pool        *purchasePool
+
+	// shedThreshold is the fraction of the order queue at which purchases
+	// are shed; shedAt is the resulting depth, 0 when shedding is off
+	shedThreshold float64
+	shedAt        int
+
+	// limiter caps the purchases in flight, nil for no cap
+	limiter *concurrencyLimiter
+
+	// holdTTL is how long a new order holds its stock before it must be
+	// confirmed; 0 holds it until the payment outcome arrives
+	holdTTL time.Duration
+
+	// enqueueTimeout is how long a purchase waits for room in a full order
+	// queue before failing with ErrQueueFull
+	enqueueTimeout time.Duration
+	timeouts       StageTimeouts
+
+	metrics port.Metrics
+	events  port.EventBus
+	pricing map[string]domain.PriceSchedule
+	catalog *Catalog
+	quota   port.PurchaseQuota
+	coupons *CouponService
+	tiers   *TierService
+	banned  *BlacklistService
+	risk    port.RiskScorer
+	results port.OrderResultFeed
+	spool   port.OrderSpool
+	shards  port.ShardRouter
+
+	// records, if set, keeps the outcome of every request by request ID
+	// for recordTTL
+	records   port.PurchaseRecords
+	recordTTL time.Duration
+
+	// stats, if set, counts failures, queued orders and sold out items for
+	// the live sale statistics; soldOut holds the items this server has
+	// already reported sold out to them and the event bus
+	stats   port.SaleCounters
+	soldOut sync.Map
+
+	// board, if set, turns away purchases of items sold out on any server
+	// before they reach the cache
+	board *SoldOutBoard
+
+	// reserved is the stock of each item kept for VIP purchases; reserve
+	// takes the stock of everyone else's without touching it
+	reserve  port.StockReserve
+	reserved map[string]int
+
+	compensator *StockCompensator
+
+	// cacheBreaker, if set, sends purchases to degradedDB while the cache
+	// is failing, at the rate degradedLimit allows
+	cacheBreaker  *CircuitBreaker
+	degradedDB    port.DatabaseRepository
+	degradedLimit port.RateLimiter
+
+	// stockHints, if set, caches the stock returned by StockHint
+	stockHints *LocalCache[int]
+
+	// items, if set, turns away purchases of items that do not exist
+	// before they reach the cache
+	items *ItemFilter
+
+	// analytics, if set, receives every purchase attempt and its outcome
+	analytics *PurchaseAnalytics
+}
+
+type OrderServiceOption func(*OrderService)
+
+// WithItemPartitions splits the order queue into partitions and routes each
+// item's orders to the same one by consistent hashing. With one worker per
+// partition, an item's inventory writes never race each other. The queue
+// size is divided between the partitions, so a single hot item can only use
+// its partition's share.
+func WithItemPartitions(partitions int) OrderServiceOption {
+	return func(s *OrderService) {
+		if partitions > 1 {
+			s.ring = newHashRing(partitions)
+			s.queues = make([]chan domain.Order, partitions)
+		}
+	}
+}
+
+// WithIdempotency sets the idempotency key scope and how long keys are kept.
+func WithIdempotency(mode IdempotencyMode, ttl time.Duration) OrderServiceOption {
+	return func(s *OrderService) {
+		s.idempotencyMode = mode
+		s.idempotencyTTL = ttl
+	}
+}
+
+// WithCampaign sets the campaign that per-user idempotency keys are scoped to.
+func WithCampaign(campaignID string) OrderServiceOption {
+	return func(s *OrderService) {
+		s.campaignID = campaignID
+	}
+}
+
+// WithPurchasePool runs purchases on a fixed number of goroutines with a
+// bounded backlog. Purchases beyond the backlog fail with ErrOverloaded.
+func WithPurchasePool(workers, backlog int) OrderServiceOption {
+	return func(s *OrderService) {
+		s.poolWorkers = workers
+		s.poolBacklog = backlog
+	}
+}
+
+// WithHoldTTL places each order as a stock hold that lapses after ttl unless
+// it is confirmed through ReservationService.Confirm.
+func WithHoldTTL(ttl time.Duration) OrderServiceOption {
+	return func(s *OrderService) {
+		s.holdTTL = ttl
+	}
+}
+
+// WithEnqueueTimeout lets purchases wait up to timeout for room in a full
+// order queue. By default they fail with ErrQueueFull straight away.
+func WithEnqueueTimeout(timeout time.Duration) OrderServiceOption {
+	return func(s *OrderService) {
+		s.enqueueTimeout = timeout
+	}
+}
+
+// WithStageTimeouts bounds the idempotency and stock decrement calls of
+// every purchase by t. The default is DefaultStageTimeouts.
+func WithStageTimeouts(t StageTimeouts) OrderServiceOption {
+	return func(s *OrderService) {
+		s.timeouts = t
+	}
+}
+
+// WithCompensator returns the stock of orders that cannot be queued through
+// c, so failed returns are retried rather than lost.
+func WithCompensator(c *StockCompensator) OrderServiceOption {
+	return func(s *OrderService) {
+		s.compensator = c
+	}
+}
+
+// WithOrderSpool lets SpoolQueued save orders still queued at shutdown to
+// spool, and RecoverSpooled queue them again on the next start.
+func WithOrderSpool(spool port.OrderSpool) OrderServiceOption {
+	return func(s *OrderService) {
+		s.spool = spool
+	}
+}
+
+// WithShardRouter rejects carts with ErrCrossShardCart unless shards keeps
+// all of their items on one shard, before any of their stock is taken.
+func WithShardRouter(shards port.ShardRouter) OrderServiceOption {
+	return func(s *OrderService) {
+		s.shards = shards
+	}
+}
+
+// WithLoadShedding rejects purchases with ErrLoadShed while the order queue
+// is at least threshold (0 < threshold <= 1) full. Workers drain a nearly
+// full queue slowly, so turning purchases away early keeps latency flat
+// instead of letting them pile up behind it.
+func WithLoadShedding(threshold float64) OrderServiceOption {
+	return func(s *OrderService) {
+		s.shedThreshold = threshold
+	}
+}
+
+// WithConcurrencyLimit rejects purchases with ErrConcurrencyLimited while
+// as many are in flight as an adaptive limit allows, which rises and falls
+// with their latency between limits.Min and limits.Max. Purchases queued by
+// SubmitPurchase are not counted; their admission is bounded by the pool.
+func WithConcurrencyLimit(limits ConcurrencyLimits) OrderServiceOption {
+	return func(s *OrderService) {
+		s.limiter = nil
+		if limits.Initial > 0 {
+			s.limiter = newConcurrencyLimiter(limits)
+		}
+	}
+}
+
+// WithPricing sets the price tiers per item. Items without a schedule are
+// sold at their catalog price, or at no charge without a catalog.
+func WithPricing(pricing map[string]domain.PriceSchedule) OrderServiceOption {
+	return func(s *OrderService) {
+		s.pricing = pricing
+	}
+}
+
+// WithCatalog prices orders and applies per-user purchase limits from the
+// items in c.
+func WithCatalog(c *Catalog) OrderServiceOption {
+	return func(s *OrderService) {
+		s.catalog = c
+	}
+}
+
+// WithPurchaseQuota counts each user's purchases of items with a per-user
+// limit, so the limit holds across purchases. Without it, the limit only
+// caps the quantity of a single purchase. Units of orders later cancelled
+// still count against the limit, unless given back by AllowRebuy.
+func WithPurchaseQuota(q port.PurchaseQuota) OrderServiceOption {
+	return func(s *OrderService) {
+		s.quota = q
+	}
+}
+
+// WithCoupons lets purchases apply the coupons of c.
+func WithCoupons(c *CouponService) OrderServiceOption {
+	return func(s *OrderService) {
+		s.coupons = c
+	}
+}
+
+// WithUserTiers looks up each buyer's tier in t. Without it every buyer is
+// TierNormal.
+func WithUserTiers(t *TierService) OrderServiceOption {
+	return func(s *OrderService) {
+		s.tiers = t
+	}
+}
+
+// WithBlacklist rejects purchases of users and from client IPs banned in b
+// with ErrBlacklisted before any stock is touched.
+func WithBlacklist(b *BlacklistService) OrderServiceOption {
+	return func(s *OrderService) {
+		s.banned = b
+	}
+}
+
+// WithRiskScorer scores every purchase with r before any stock is taken.
+// Purchases it rejects fail with ErrRiskRejected; the score of the rest is
+// recorded on their order.
+func WithRiskScorer(r port.RiskScorer) OrderServiceOption {
+	return func(s *OrderService) {
+		s.risk = r
+	}
 }
 
-func NewOrderService(cache port.CacheRepository, queueSize int) *OrderService {
-	return &OrderService{
-		cache:      cache,
-		orderQueue: make(chan domain.Order, queueSize),
+// WithVIPPriority gives every queue partition a second queue for the orders
+// of VIP buyers, which workers given PriorityQueues drain first.
+func WithVIPPriority() OrderServiceOption {
+	return func(s *OrderService) {
+		s.vipPriority = true
 	}
 }
 
-func (s *OrderService) Purchase(ctx context.Context, requestID, userID, itemID string, quantity int) error {
-	idempotencyKey := fmt.Sprintf("idempotency:%s", requestID)
+// WithVIPReserve keeps units of each item in reserved for VIP buyers: other
+// purchases are taken through reserve and sell out once only the reserve is
+// left. Carts of other buyers take their lines one at a time.
+func WithVIPReserve(reserve port.StockReserve, reserved map[string]int) OrderServiceOption {
+	return func(s *OrderService) {
+		s.reserve = reserve
+		s.reserved = reserved
+	}
+}
+
+// WithOrderResults publishes the outcome of asynchronous purchases that are
+// rejected before reaching the order queue; workers publish the rest.
+func WithOrderResults(results port.OrderResultFeed) OrderServiceOption {
+	return func(s *OrderService) {
+		s.results = results
+	}
+}
+
+// WithPurchaseRecords keeps the outcome of every request in records for
+// ttl, so PurchaseState can answer by request ID in any idempotency mode.
+func WithPurchaseRecords(records port.PurchaseRecords, ttl time.Duration) OrderServiceOption {
+	return func(s *OrderService) {
+		s.records = records
+		s.recordTTL = ttl
+	}
+}
+
+// WithSaleCounters keeps the live statistics of the sale in stats, which
+// the workers add the orders they save to.
+func WithSaleCounters(stats port.SaleCounters) OrderServiceOption {
+	return func(s *OrderService) {
+		s.stats = stats
+	}
+}
+
+// WithDegradedPurchases keeps the sale going while the cache is down.
+// Failures of the cache's idempotency check are recorded in breaker, and
+// while it is open purchases are written straight to db, as many as limit
+// allows. See purchaseFromDB for what is given up.
+func WithDegradedPurchases(db port.DatabaseRepository, breaker *CircuitBreaker, limit port.RateLimiter) OrderServiceOption {
+	return func(s *OrderService) {
+		s.degradedDB = db
+		s.cacheBreaker = breaker
+		s.degradedLimit = limit
+	}
+}
+
+// WithSoldOutBoard rejects purchases of items on board without touching the
+// cache, and publishes items this server sees sell out to it. Rejections
+// made by the board are reported to the metrics but not counted in the sale
+// statistics, which live in the cache.
+func WithSoldOutBoard(board *SoldOutBoard) OrderServiceOption {
+	return func(s *OrderService) {
+		s.board = board
+	}
+}
+
+// WithItemFilter rejects purchases of items not in filter with
+// ErrItemNotFound without touching the cache. Like rejections made by the
+// sold out board, they are reported to the metrics and analytics only.
+func WithItemFilter(filter *ItemFilter) OrderServiceOption {
+	return func(s *OrderService) {
+		s.items = filter
+	}
+}
 
-	ok, err := s.cache.SetIdempotency(ctx, idempotencyKey)
+// WithPurchaseAnalytics streams every purchase attempt to analytics with
+// its outcome, rejections included.
+func WithPurchaseAnalytics(analytics *PurchaseAnalytics) OrderServiceOption {
+	return func(s *OrderService) {
+		s.analytics = analytics
+	}
+}
+
+// WithStockHintCache serves StockHint from a local cache holding each
+// item's stock for ttl.
+func WithStockHintCache(ttl time.Duration) OrderServiceOption {
+	return func(s *OrderService) {
+		s.stockHints = NewLocalCache[int](ttl)
+	}
+}
+
+// WithMetrics reports purchase outcomes to m.
+func WithMetrics(m port.Metrics) OrderServiceOption {
+	return func(s *OrderService) {
+		s.metrics = m
+	}
+}
+
+// WithEvents publishes an event for every order accepted, for every item
+// first found sold out and for every rollback that fails, on events.
+func WithEvents(events port.EventBus) OrderServiceOption {
+	return func(s *OrderService) {
+		s.events = events
+	}
+}
+
+func NewOrderService(cache port.CacheRepository, queueSize int, opts ...OrderServiceOption) *OrderService {
+	s := &OrderService{
+		cache:           cache,
+		queues:          make([]chan domain.Order, 1),
+		idempotencyMode: IdempotencyPerRequest,
+		idempotencyTTL:  defaultIdempotencyTTL,
+		campaignID:      "default",
+		timeouts:        DefaultStageTimeouts(),
+		metrics:         noopMetrics{},
+		events:          noEvents{},
+		compensator:     NewStockCompensator(cache, nil),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan domain.Order, max(queueSize/len(s.queues), 1))
+	}
+	if s.vipPriority {
+		s.priority = make([]chan domain.Order, len(s.queues))
+		for i := range s.priority {
+			s.priority[i] = make(chan domain.Order, max(queueSize/len(s.queues), 1))
+		}
+	}
+	if s.poolWorkers > 0 {
+		s.pool = newPurchasePool(s.poolWorkers, s.poolBacklog)
+	}
+	if s.shedThreshold > 0 {
+		s.shedAt = max(int(math.Ceil(s.shedThreshold*float64(s.QueueCapacity()))), 1)
+	}
+	return s
+}
+
+// PurchaseOption adds optional details to one purchase.
+type PurchaseOption func(*purchaseOptions)
+
+type purchaseOptions struct {
+	coupon   string
+	clientIP string
+	deviceID string
+}
+
+// UsingCoupon applies a coupon code to the purchase. The order total is
+// reduced by its discount, and a code that does not apply rejects the
+// purchase rather than being ignored.
+func UsingCoupon(code string) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.coupon = code
+	}
+}
+
+// FromClientIP records the IP the purchase came from, which is checked
+// against the blacklist and scored for risk.
+func FromClientIP(ip string) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.clientIP = ip
+	}
+}
+
+// FromDevice records the client's device ID, which is scored for risk.
+func FromDevice(deviceID string) PurchaseOption {
+	return func(o *purchaseOptions) {
+		o.deviceID = deviceID
+	}
+}
+
+func newPurchaseOptions(opts []PurchaseOption) purchaseOptions {
+	var o purchaseOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Purchase reserves stock and queues the order, returning its ID. A retried
+// request receives the outcome of the original attempt.
+func (s *OrderService) Purchase(ctx context.Context, requestID, userID, itemID string, quantity int, opts ...PurchaseOption) (string, error) {
+	ctx, span := tracer.Start(ctx, "OrderService.Purchase", trace.WithAttributes(
+		attribute.String("purchase.request_id", requestID),
+		attribute.String("purchase.item_id", itemID),
+		attribute.Int("purchase.quantity", quantity),
+	))
+	defer span.End()
+
+	return s.run(ctx, span, requestID, userID, []domain.OrderItem{{ItemID: itemID, Quantity: quantity}}, newPurchaseOptions(opts))
+}
+
+// PurchaseCart buys several items in one order. The stock of every line is
+// reserved together or not at all, and lines for the same item are merged.
+// A cart of one item is an ordinary Purchase.
+func (s *OrderService) PurchaseCart(ctx context.Context, requestID, userID string, lines []domain.OrderItem, opts ...PurchaseOption) (string, error) {
+	lines = mergeLines(lines)
+	if len(lines) == 1 {
+		return s.Purchase(ctx, requestID, userID, lines[0].ItemID, lines[0].Quantity, opts...)
+	}
+
+	ctx, span := tracer.Start(ctx, "OrderService.PurchaseCart", trace.WithAttributes(
+		attribute.String("purchase.request_id", requestID),
+		attribute.Int("purchase.lines", len(lines)),
+	))
+	defer span.End()
+
+	return s.run(ctx, span, requestID, userID, lines, newPurchaseOptions(opts))
+}
+
+// run purchases lines within the concurrency limit and on the purchase pool,
+// if any, and reports the outcome.
+func (s *OrderService) run(ctx context.Context, span trace.Span, requestID, userID string, lines []domain.OrderItem, po purchaseOptions) (string, error) {
+	start := time.Now()
+	if !s.known(ctx, lines) {
+		s.metrics.PurchaseCompleted(ctx, OutcomeNotFound, time.Since(start))
+		s.analyze(requestID, userID, lines, po, "", ErrItemNotFound, time.Since(start))
+		span.SetAttributes(attribute.String("purchase.outcome", OutcomeNotFound))
+		return "", ErrItemNotFound
+	}
+	if s.board != nil && s.board.SoldOut(lines) {
+		s.metrics.PurchaseCompleted(ctx, OutcomeSoldOut, time.Since(start))
+		s.analyze(requestID, userID, lines, po, "", ErrInsufficientStock, time.Since(start))
+		span.SetAttributes(attribute.String("purchase.outcome", OutcomeSoldOut))
+		return "", ErrInsufficientStock
+	}
+
+	var orderID string
+	var err error
+	switch {
+	case s.shedding():
+		err = ErrLoadShed
+	case !s.limiter.acquire():
+		err = ErrConcurrencyLimited
+	default:
+		began := time.Now()
+		orderID, err = s.admitted(ctx, requestID, userID, lines, po)
+		s.limiter.release(time.Since(began), err)
+	}
+
+	outcome := OutcomeOf(err)
+	s.completed(ctx, outcome, time.Since(start))
+	s.analyze(requestID, userID, lines, po, orderID, err, time.Since(start))
+
+	span.SetAttributes(attribute.String("purchase.outcome", outcome))
+	if outcome == OutcomeError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	s.record(context.WithoutCancel(ctx), requestID, userID, orderID, err)
+
+	return orderID, err
+}
+
+// admitted purchases lines on the purchase pool, if any.
+func (s *OrderService) admitted(ctx context.Context, requestID, userID string, lines []domain.OrderItem, po purchaseOptions) (string, error) {
+	if s.pool != nil {
+		return s.pool.submit(ctx, func(ctx context.Context) (string, error) {
+			return s.purchase(ctx, requestID, userID, lines, po)
+		})
+	}
+	return s.purchase(ctx, requestID, userID, lines, po)
+}
+
+// completed reports the outcome of a purchase to the metrics, and a failed
+// one to the sale statistics.
+func (s *OrderService) completed(ctx context.Context, outcome string, duration time.Duration) {
+	s.metrics.PurchaseCompleted(ctx, outcome, duration)
+	if s.stats != nil && outcome != OutcomeSuccess {
+		// Statistics are best effort, like the metrics
+		_ = s.stats.RecordFailure(context.WithoutCancel(ctx), outcome)
+	}
+}
+
+// analyze streams an attempt that returned err to analytics, if set.
+func (s *OrderService) analyze(requestID, userID string, lines []domain.OrderItem, po purchaseOptions, orderID string, err error, duration time.Duration) {
+	if s.analytics == nil {
+		return
+	}
+	attempt := domain.PurchaseOutcome{
+		RequestID:  requestID,
+		UserID:     userID,
+		Items:      lines,
+		Outcome:    OutcomeOf(err),
+		OrderID:    orderID,
+		ClientIP:   po.clientIP,
+		DeviceID:   po.deviceID,
+		Coupon:     po.coupon,
+		Duration:   duration,
+		OccurredAt: time.Now(),
+	}
 	if err != nil {
-		return fmt.Errorf("idempotency check failed: %w", err)
+		attempt.Reason = err.Error()
+	}
+	s.analytics.Record(attempt)
+}
+
+// OutcomeOf returns the outcome reported for a purchase that returned err.
+func OutcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, ErrInsufficientStock):
+		return OutcomeSoldOut
+	case errors.Is(err, ErrItemNotFound):
+		return OutcomeNotFound
+	case errors.Is(err, ErrSaleFrozen):
+		return OutcomeFrozen
+	case errors.Is(err, ErrSaleClosed):
+		return OutcomeClosed
+	case errors.Is(err, ErrDuplicateRequest), errors.Is(err, ErrAlreadyEntered), errors.Is(err, ErrPreviousFailure):
+		return OutcomeDuplicate
+	case errors.Is(err, ErrPurchaseLimit):
+		return OutcomeLimited
+	case errors.Is(err, ErrMixedCurrency), errors.Is(err, ErrCartUnsupported), errors.Is(err, ErrCrossShardCart),
+		errors.Is(err, ErrCouponRejected), errors.Is(err, ErrCouponExhausted),
+		errors.Is(err, ErrLotteryCart), errors.Is(err, ErrNotDrawn),
+		errors.Is(err, ErrBotCheckFailed), errors.Is(err, ErrInvalidPurchaseToken),
+		errors.Is(err, ErrPurchaseTokenUsed), errors.Is(err, ErrRiskRejected):
+		return OutcomeRejected
+	case errors.Is(err, ErrBlacklisted):
+		return OutcomeBanned
+	case errors.Is(err, ErrLoadShed), errors.Is(err, ErrConcurrencyLimited):
+		return OutcomeShed
+	case errors.Is(err, ErrQueueFull):
+		return OutcomeQueueFull
+	case errors.Is(err, ErrStageTimeout):
+		return OutcomeTimeout
+	case errors.Is(err, ErrOverloaded):
+		return OutcomeOverloaded
+	default:
+		return OutcomeError
+	}
+}
+
+func (s *OrderService) purchase(ctx context.Context, requestID, userID string, lines []domain.OrderItem, po purchaseOptions) (string, error) {
+	if err := s.checkBlacklist(ctx, userID, po); err != nil {
+		return "", err
+	}
+	idempotencyKey, err := s.purchaseKey(requestID, userID, lines)
+	if err != nil {
+		return "", err
+	}
+
+	if s.cacheBreaker != nil && !s.cacheBreaker.Allow() {
+		return s.purchaseFromDB(ctx, requestID, idempotencyKey, userID, lines, po)
+	}
+	ok, err := s.claimKey(ctx, idempotencyKey)
+	if s.cacheBreaker != nil {
+		s.cacheBreaker.Record(err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("idempotency check failed: %w", err)
 	}
 	if !ok {
-		return ErrDuplicateRequest
+		return s.replay(ctx, idempotencyKey)
 	}
 
-	ok, err = s.cache.DecrementStock(ctx, itemID, quantity)
+	orderID, err := s.process(ctx, requestID, idempotencyKey, userID, lines, po)
+	if errors.Is(err, ErrSaleFrozen) || errors.Is(err, ErrQueueFull) || errors.Is(err, ErrStageTimeout) {
+		// All are temporary, so don't pin the rejection to the key
+		_ = s.cache.ReleaseIdempotency(ctx, idempotencyKey)
+	}
+	return orderID, err
+}
+
+// SubmitPurchase claims the request and queues the purchase to run in the
+// background, returning as soon as it is queued. Submitting a request that
+// is already known is a no-op; its state can be read with PurchaseState.
+func (s *OrderService) SubmitPurchase(ctx context.Context, requestID, userID, itemID string, quantity int, opts ...PurchaseOption) error {
+	return s.submit(ctx, requestID, userID, []domain.OrderItem{{ItemID: itemID, Quantity: quantity}}, newPurchaseOptions(opts))
+}
+
+// SubmitCart is SubmitPurchase for a cart, as PurchaseCart.
+func (s *OrderService) SubmitCart(ctx context.Context, requestID, userID string, lines []domain.OrderItem, opts ...PurchaseOption) error {
+	return s.submit(ctx, requestID, userID, mergeLines(lines), newPurchaseOptions(opts))
+}
+
+func (s *OrderService) submit(ctx context.Context, requestID, userID string, lines []domain.OrderItem, po purchaseOptions) (err error) {
+	if !s.known(ctx, lines) {
+		s.metrics.PurchaseCompleted(ctx, OutcomeNotFound, 0)
+		s.analyze(requestID, userID, lines, po, "", ErrItemNotFound, 0)
+		return ErrItemNotFound
+	}
+	defer func() {
+		if err != nil {
+			s.record(ctx, requestID, userID, "", err)
+			s.analyze(requestID, userID, lines, po, "", err, 0)
+		}
+	}()
+
+	// Shed before claiming the key so the client can retry the same request
+	if s.shedding() {
+		s.completed(ctx, OutcomeShed, 0)
+		return ErrLoadShed
+	}
+	if err := s.checkBlacklist(ctx, userID, po); err != nil {
+		s.completed(ctx, OutcomeBanned, 0)
+		return err
+	}
+
+	idempotencyKey, err := s.purchaseKey(requestID, userID, lines)
 	if err != nil {
-		return fmt.Errorf("stock decrement failed: %w", err)
+		return err
+	}
+
+	ok, err := s.claimKey(ctx, idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("idempotency check failed: %w", err)
 	}
 	if !ok {
-		return ErrInsufficientStock
+		s.record(ctx, requestID, userID, "", ErrDuplicateRequest)
+		s.analyze(requestID, userID, lines, po, "", ErrDuplicateRequest, 0)
+		return nil
+	}
+	s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusQueued})
+	s.saveRecord(ctx, domain.PurchaseRecord{RequestID: requestID, UserID: userID, Status: domain.PurchaseStatusQueued}, false)
+
+	run := func(ctx context.Context) (string, error) {
+		start := time.Now()
+		orderID, err := s.process(ctx, requestID, idempotencyKey, userID, lines, po)
+		if errors.Is(err, ErrSaleFrozen) || errors.Is(err, ErrQueueFull) || errors.Is(err, ErrStageTimeout) {
+			// Nobody is waiting to be told to retry, so record the rejection
+			s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusFailed})
+		}
+		if err != nil && s.results != nil {
+			result := domain.OrderResult{RequestID: requestID, Status: resultStatus(err)}
+			_ = s.results.PublishOrderResult(ctx, result)
+		}
+		s.completed(ctx, OutcomeOf(err), time.Since(start))
+		s.record(ctx, requestID, userID, orderID, err)
+		s.analyze(requestID, userID, lines, po, orderID, err, time.Since(start))
+		return orderID, err
 	}
 
+	// The purchase outlives the request that submitted it
+	ctx = context.WithoutCancel(ctx)
+	if s.pool == nil {
+		go run(ctx)
+		return nil
+	}
+	if _, err := s.pool.enqueue(ctx, run); err != nil {
+		_ = s.cache.ReleaseIdempotency(ctx, idempotencyKey)
+		return err
+	}
+	return nil
+}
+
+// claimKey claims a purchase's idempotency key within the idempotency
+// stage's deadline. A claim that times out may still have been made.
+func (s *OrderService) claimKey(ctx context.Context, idempotencyKey string) (bool, error) {
+	stageCtx, cancel := stageContext(ctx, s.timeouts.Idempotency)
+	defer cancel()
+	ok, err := s.cache.SetIdempotency(stageCtx, idempotencyKey, s.idempotencyTTL)
+	return ok, stageError(ctx, stageCtx, s.metrics, StageIdempotency, err)
+}
+
+// checkBlacklist rejects banned buyers without claiming the idempotency key,
+// so a request retried after the ban is lifted goes through.
+func (s *OrderService) checkBlacklist(ctx context.Context, userID string, po purchaseOptions) error {
+	if s.banned == nil {
+		return nil
+	}
+	return s.banned.Check(ctx, userID, po.clientIP)
+}
+
+// PurchaseState returns the stored state of a request. Without purchase
+// records it is read from the request's idempotency key, which is only
+// named by request ID under IdempotencyPerRequest.
+func (s *OrderService) PurchaseState(ctx context.Context, requestID string) (*domain.PurchaseResult, error) {
+	if s.records != nil {
+		record, err := s.records.GetPurchaseRecord(ctx, requestID)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			return &domain.PurchaseResult{OrderID: record.OrderID, Status: record.Status}, nil
+		}
+	}
+	if s.idempotencyMode != IdempotencyPerRequest {
+		if s.records != nil {
+			return nil, ErrPurchaseNotFound
+		}
+		return nil, fmt.Errorf("purchase state lookup needs %q idempotency", IdempotencyPerRequest)
+	}
+	result, err := s.cache.GetIdempotencyResult(ctx, s.idempotencyKey(requestID, "", ""))
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ErrPurchaseNotFound
+	}
+	return result, nil
+}
+
+// PurchaseRecord returns what is known about a request: its user, state,
+// order and, if it failed, why. It needs WithPurchaseRecords.
+func (s *OrderService) PurchaseRecord(ctx context.Context, requestID string) (*domain.PurchaseRecord, error) {
+	if s.records == nil {
+		return nil, ErrPurchaseNotFound
+	}
+	record, err := s.records.GetPurchaseRecord(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrPurchaseNotFound
+	}
+	return record, nil
+}
+
+// record stores the outcome of a request that returned orderID and err.
+func (s *OrderService) record(ctx context.Context, requestID, userID, orderID string, err error) {
+	record := domain.PurchaseRecord{RequestID: requestID, UserID: userID, OrderID: orderID, Status: recordStatus(err)}
+	if err != nil {
+		record.Reason = err.Error()
+	}
+	// A duplicate or replayed failure says nothing new about a request that
+	// already has a record, and may race the attempt that ran
+	replayed := errors.Is(err, ErrDuplicateRequest) || errors.Is(err, ErrAlreadyEntered) || errors.Is(err, ErrPreviousFailure)
+	s.saveRecord(ctx, record, replayed)
+}
+
+// saveRecord is best effort like saveResult. With ifAbsent it leaves an
+// existing record alone.
+func (s *OrderService) saveRecord(ctx context.Context, record domain.PurchaseRecord, ifAbsent bool) {
+	if s.records == nil || record.RequestID == "" {
+		return
+	}
+	if ifAbsent {
+		if existing, err := s.records.GetPurchaseRecord(ctx, record.RequestID); err != nil || existing != nil {
+			return
+		}
+	}
+	record.UpdatedAt = time.Now()
+	_ = s.records.SavePurchaseRecord(ctx, record, s.recordTTL)
+}
+
+// process reserves stock and queues the order for a request whose
+// idempotency key is already claimed, recording the outcome under the key.
+func (s *OrderService) process(ctx context.Context, requestID, idempotencyKey, userID string, lines []domain.OrderItem, po purchaseOptions) (string, error) {
+	currency, err := s.cartCurrency(lines)
+	if err == nil {
+		err = s.checkShards(lines)
+	}
+	if err != nil {
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusFailed})
+		return "", err
+	}
+	coupon, err := s.coupon(po.coupon, currency)
+	if err != nil {
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: resultStatus(err)})
+		return "", err
+	}
+
+	assessment, err := s.assessRisk(ctx, userID, lines, po)
+	if err != nil {
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: resultStatus(err)})
+		return "", err
+	}
+
+	releaseQuota, err := s.reserveQuotas(ctx, userID, lines)
+	if err != nil {
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: resultStatus(err)})
+		return "", err
+	}
+	if coupon != nil {
+		releaseCoupon, err := s.coupons.Redeem(ctx, *coupon)
+		if err != nil {
+			releaseQuota()
+			s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: resultStatus(err)})
+			return "", err
+		}
+		releaseQuotas := releaseQuota
+		releaseQuota = func() {
+			releaseQuotas()
+			releaseCoupon()
+		}
+	}
+
+	tier := s.tier(userID)
+	decrement, err := s.decrementStock(ctx, lines, tier)
+	if err != nil {
+		releaseQuota()
+		if errors.Is(err, ErrStageTimeout) {
+			// The decrement may have been made, so its stock is left taken
+			// rather than risk selling it twice, but the purchase can be
+			// retried
+			return "", fmt.Errorf("stock decrement failed: %w", err)
+		}
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusFailed})
+		return "", fmt.Errorf("stock decrement failed: %w", err)
+	}
+	switch decrement {
+	case domain.StockDecremented:
+	case domain.StockFrozen:
+		releaseQuota()
+		return "", ErrSaleFrozen
+	default:
+		releaseQuota()
+		if decrement == domain.StockInsufficient {
+			s.noteSoldOut(ctx, lines)
+		}
+		err := stockError(decrement)
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: rejectedStatus(decrement)})
+		return "", err
+	}
+
+	order := s.newOrder(ctx, uuid.New().String(), requestID, idempotencyKey, userID, currency, tier, lines, coupon, assessment)
+	if err := s.enqueue(ctx, order); err != nil {
+		// The order will never be persisted, so give its stock back
+		releaseQuota()
+		if rollbackErr := s.compensator.RestoreOrder(context.WithoutCancel(ctx), order, "unqueued order "+order.ID); rollbackErr != nil {
+			log.Printf("CRITICAL: rollback of unqueued order %s failed: %v", order.ID, rollbackErr)
+			s.events.Publish(ctx, domain.RollbackFailed{OrderSummary: domain.SummarizeOrder(order), Reason: rollbackErr.Error(), FailedAt: time.Now()})
+		}
+		if errors.Is(err, ErrQueueFull) {
+			return "", err
+		}
+		s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{Status: domain.PurchaseStatusFailed})
+		return "", fmt.Errorf("enqueue order: %w", err)
+	}
+
+	s.saveResult(ctx, idempotencyKey, domain.PurchaseResult{
+		OrderID: order.ID,
+		Status:  domain.PurchaseStatusSucceeded,
+	})
+	s.events.Publish(ctx, domain.OrderAccepted{OrderSummary: domain.SummarizeOrder(order), AcceptedAt: time.Now()})
+
+	return order.ID, nil
+}
+
+// newOrder builds the pending order of a purchase of lines, priced from the
+// current schedule and carrying the purchase's trace context.
+func (s *OrderService) newOrder(ctx context.Context, id, requestID, idempotencyKey, userID, currency string, tier domain.UserTier, lines []domain.OrderItem, coupon *domain.Coupon, assessment domain.RiskAssessment) domain.Order {
+	now := time.Now()
+	tenant, _ := port.TenantOf(ctx)
 	order := domain.Order{
-		ID:        uuid.New().String(),
+		ID:        id,
+		TenantID:  tenant,
 		UserID:    userID,
-		ItemID:    itemID,
-		Quantity:  quantity,
+		ItemID:    lines[0].ItemID,
 		Status:    domain.OrderStatusPending,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Currency:  currency,
+		Tier:      tier,
+
+		RiskScore:   assessment.Score,
+		RiskFlagged: assessment.Action == domain.RiskFlag,
+
+		RequestID:      requestID,
+		IdempotencyKey: idempotencyKey,
+	}
+	for _, line := range lines {
+		line.UnitPrice, line.TotalPrice = s.Quote(line.ItemID, line.Quantity)
+		order.Quantity += line.Quantity
+		order.TotalPrice += line.TotalPrice
+		order.UnitPrice = line.UnitPrice
+		if len(lines) > 1 {
+			order.Items = append(order.Items, line)
+		}
+	}
+	if len(lines) > 1 {
+		order.UnitPrice = 0
+	}
+	if coupon != nil {
+		order.CouponCode = coupon.Code
+		order.Discount = coupon.Discount(order.TotalPrice)
+		order.TotalPrice -= order.Discount
+	}
+	if s.holdTTL > 0 {
+		order.ExpiresAt = now.Add(s.holdTTL)
+	}
+	order.TraceContext = make(map[string]string)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(order.TraceContext))
+	return order
+}
+
+// assessRisk scores the purchase, returning ErrRiskRejected if the scorer
+// rejects it. When the scorer fails the purchase goes through unscored.
+func (s *OrderService) assessRisk(ctx context.Context, userID string, lines []domain.OrderItem, po purchaseOptions) (domain.RiskAssessment, error) {
+	if s.risk == nil {
+		return domain.RiskAssessment{Action: domain.RiskAllow}, nil
+	}
+	attempt := domain.PurchaseAttempt{
+		UserID:   userID,
+		ClientIP: po.clientIP,
+		DeviceID: po.deviceID,
+		Items:    lines,
+		At:       time.Now(),
+	}
+	assessment, err := s.risk.Score(ctx, attempt)
+	if err != nil {
+		log.Printf("risk scoring error: %v", err)
+		return domain.RiskAssessment{Action: domain.RiskAllow}, nil
+	}
+	switch assessment.Action {
+	case domain.RiskReject:
+		log.Printf("purchase by user %s rejected with risk score %d: %s", userID, assessment.Score, strings.Join(assessment.Reasons, "; "))
+		return assessment, fmt.Errorf("%w: risk score %d", ErrRiskRejected, assessment.Score)
+	case domain.RiskFlag:
+		log.Printf("purchase by user %s flagged with risk score %d: %s", userID, assessment.Score, strings.Join(assessment.Reasons, "; "))
+	}
+	return assessment, nil
+}
+
+// decrementStock takes the stock of the lines within the decrement stage's
+// deadline, logging the item that stopped a rejected cart.
+func (s *OrderService) decrementStock(ctx context.Context, lines []domain.OrderItem, tier domain.UserTier) (domain.StockDecrement, error) {
+	stageCtx, cancel := stageContext(ctx, s.timeouts.Decrement)
+	defer cancel()
+	decrement, err := s.takeStock(stageCtx, lines, tier)
+	return decrement, stageError(ctx, stageCtx, s.metrics, StageDecrement, err)
+}
+
+func (s *OrderService) takeStock(ctx context.Context, lines []domain.OrderItem, tier domain.UserTier) (domain.StockDecrement, error) {
+	if floors := s.floors(lines, tier); floors != nil {
+		return s.decrementAbove(ctx, lines, floors)
+	}
+	if len(lines) == 1 {
+		return s.cache.DecrementStock(ctx, lines[0].ItemID, lines[0].Quantity)
+	}
+	decrement, itemID, err := s.cache.DecrementStocks(ctx, lines)
+	if err == nil && decrement != domain.StockDecremented {
+		log.Printf("cart rejected by %s: %s", itemID, decrement)
+	}
+	return decrement, err
+}
+
+// floors returns the stock each line must leave for VIP buyers, or nil if
+// the buyer may take reserved stock or none of the items has a reserve.
+func (s *OrderService) floors(lines []domain.OrderItem, tier domain.UserTier) map[string]int {
+	if s.reserve == nil || tier == domain.TierVIP {
+		return nil
+	}
+	var floors map[string]int
+	for _, line := range lines {
+		if reserved := s.reserved[line.ItemID]; reserved > 0 {
+			if floors == nil {
+				floors = make(map[string]int)
+			}
+			floors[line.ItemID] = reserved
+		}
+	}
+	return floors
+}
+
+// decrementAbove takes the stock of the lines without touching their
+// floors. Lines are taken one at a time, and those already taken are given
+// back if a later one is rejected.
+func (s *OrderService) decrementAbove(ctx context.Context, lines []domain.OrderItem, floors map[string]int) (domain.StockDecrement, error) {
+	for i, line := range lines {
+		decrement, err := s.reserve.DecrementStockAbove(ctx, line.ItemID, line.Quantity, floors[line.ItemID])
+		if err == nil && decrement == domain.StockDecremented {
+			continue
+		}
+
+		if i > 0 {
+			taken := domain.Order{ItemID: lines[0].ItemID, Items: lines[:i]}
+			if rollbackErr := s.compensator.RestoreOrder(context.WithoutCancel(ctx), taken, "rejected cart"); rollbackErr != nil {
+				log.Printf("CRITICAL: rollback of rejected cart failed: %v", rollbackErr)
+			}
+		}
+		if err == nil && len(lines) > 1 {
+			log.Printf("cart rejected by %s: %s", line.ItemID, decrement)
+		}
+		return decrement, err
+	}
+	return domain.StockDecremented, nil
+}
+
+// noteSoldOut records the items of a purchase turned away for lack of stock
+// that have none left as sold out now, and publishes them to the sold out
+// board. Each server reports an item to the statistics and the event bus
+// once.
+func (s *OrderService) noteSoldOut(ctx context.Context, lines []domain.OrderItem) {
+	for _, line := range lines {
+		_, reported := s.soldOut.Load(line.ItemID)
+		if reported && s.board == nil {
+			continue
+		}
+		if stock, err := s.cache.GetStock(ctx, line.ItemID); err != nil || stock > 0 {
+			continue
+		}
+		if !reported {
+			s.reportSoldOut(ctx, line.ItemID)
+		}
+		if s.board != nil {
+			if err := s.board.Publish(ctx, line.ItemID); err != nil {
+				log.Printf("publish %s sold out: %v", line.ItemID, err)
+			}
+		}
+	}
+}
+
+// reportSoldOut records the item sold out in the statistics and publishes
+// it as depleted. A failure to record leaves it to the next purchase.
+func (s *OrderService) reportSoldOut(ctx context.Context, itemID string) {
+	now := time.Now()
+	if s.stats != nil {
+		if err := s.stats.RecordSoldOut(ctx, itemID, now); err != nil {
+			return
+		}
+	}
+	s.soldOut.Store(itemID, true)
+	s.events.Publish(ctx, domain.StockDepleted{ItemID: itemID, DepletedAt: now})
+}
+
+// tier returns the buyer's tier.
+func (s *OrderService) tier(userID string) domain.UserTier {
+	if s.tiers == nil {
+		return domain.TierNormal
+	}
+	return s.tiers.Tier(userID)
+}
+
+// reserveQuotas reserves the per-user limit of every line, returning a func
+// that gives them all back. If one line is over its limit none are kept.
+func (s *OrderService) reserveQuotas(ctx context.Context, userID string, lines []domain.OrderItem) (release func(), err error) {
+	var releases []func()
+	release = func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+	for _, line := range lines {
+		r, err := s.reserveQuota(ctx, userID, line.ItemID, line.Quantity)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
+
+// reserveQuota enforces the item's per-user limit, if it has one, returning
+// a func that gives the reserved units back if the purchase fails later.
+func (s *OrderService) reserveQuota(ctx context.Context, userID, itemID string, quantity int) (release func(), err error) {
+	release = func() {}
+	if s.catalog == nil {
+		return release, nil
+	}
+	item, ok := s.catalog.Item(itemID)
+	if !ok || item.MaxPerUser == 0 {
+		return release, nil
+	}
+	if quantity > item.MaxPerUser {
+		return nil, fmt.Errorf("%w: at most %d per user", ErrPurchaseLimit, item.MaxPerUser)
+	}
+	if s.quota == nil {
+		return release, nil
+	}
+
+	reserved, err := s.quota.ReserveQuota(ctx, itemID, userID, quantity, item.MaxPerUser)
+	if err != nil {
+		return nil, fmt.Errorf("reserve purchase quota: %w", err)
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: at most %d per user", ErrPurchaseLimit, item.MaxPerUser)
+	}
+	return func() {
+		if err := s.quota.ReleaseQuota(context.WithoutCancel(ctx), itemID, userID, quantity); err != nil {
+			log.Printf("release purchase quota of %s for user %s: %v", itemID, userID, err)
+		}
+	}, nil
+}
+
+// AllowRebuy lets the user of a cancelled order purchase its items again. It
+// releases the order's idempotency key and gives its units back to the
+// user's per-user limits. Both are best effort.
+func (s *OrderService) AllowRebuy(ctx context.Context, order domain.Order) {
+	ctx = context.WithoutCancel(ctx)
+	if order.IdempotencyKey != "" {
+		if err := s.cache.ReleaseIdempotency(ctx, order.IdempotencyKey); err != nil {
+			log.Printf("order %s: releasing idempotency key failed: %v", order.ID, err)
+		}
+	}
+	if s.quota == nil || s.catalog == nil {
+		return
+	}
+	for _, line := range order.Lines() {
+		// Only items with a limit were counted when the order was placed
+		if item, ok := s.catalog.Item(line.ItemID); !ok || item.MaxPerUser == 0 {
+			continue
+		}
+		if err := s.quota.ReleaseQuota(ctx, line.ItemID, order.UserID, line.Quantity); err != nil {
+			log.Printf("order %s: release purchase quota of %s: %v", order.ID, line.ItemID, err)
+		}
+	}
+}
+
+// coupon returns the coupon to apply to an order in currency, or nil if
+// the purchase has none.
+func (s *OrderService) coupon(code, currency string) (*domain.Coupon, error) {
+	if code == "" {
+		return nil, nil
+	}
+	if s.coupons == nil {
+		return nil, fmt.Errorf("%w: coupons are not enabled", ErrCouponRejected)
+	}
+	coupon, err := s.coupons.Applicable(code, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// cartCurrency returns the currency the lines are sold in, which must be
+// the same for all of them.
+func (s *OrderService) cartCurrency(lines []domain.OrderItem) (string, error) {
+	currency := s.currency(lines[0].ItemID)
+	for _, line := range lines[1:] {
+		if other := s.currency(line.ItemID); other != currency {
+			return "", fmt.Errorf("%w: %s is in %s, %s in %s", ErrMixedCurrency, lines[0].ItemID, currency, line.ItemID, other)
+		}
+	}
+	return currency, nil
+}
+
+// checkShards returns ErrCrossShardCart for lines kept on different shards.
+func (s *OrderService) checkShards(lines []domain.OrderItem) error {
+	if s.shards == nil {
+		return nil
+	}
+	shard := s.shards.ShardOf(lines[0].ItemID)
+	for _, line := range lines[1:] {
+		if s.shards.ShardOf(line.ItemID) != shard {
+			return fmt.Errorf("%w: %s and %s", ErrCrossShardCart, lines[0].ItemID, line.ItemID)
+		}
+	}
+	return nil
+}
+
+// mergeLines combines lines for the same item, keeping the order in which
+// items first appear.
+func mergeLines(lines []domain.OrderItem) []domain.OrderItem {
+	merged := make([]domain.OrderItem, 0, len(lines))
+	index := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if i, ok := index[line.ItemID]; ok {
+			merged[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.ItemID] = len(merged)
+		merged = append(merged, domain.OrderItem{ItemID: line.ItemID, Quantity: line.Quantity})
+	}
+	return merged
+}
+
+// enqueue hands an order to the workers without blocking past the enqueue
+// timeout or the context.
+func (s *OrderService) enqueue(ctx context.Context, order domain.Order) error {
+	queue := s.queueOf(order)
+	select {
+	case queue <- order:
+		s.addQueued(ctx, 1)
+		return nil
+	default:
+	}
+	if s.enqueueTimeout <= 0 {
+		return ErrQueueFull
+	}
+
+	timer := time.NewTimer(s.enqueueTimeout)
+	defer timer.Stop()
+	select {
+	case queue <- order:
+		s.addQueued(ctx, 1)
+		return nil
+	case <-timer.C:
+		s.metrics.StageTimedOut(StageEnqueue)
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// purchaseKey returns the idempotency key of a purchase of lines.
+func (s *OrderService) purchaseKey(requestID, userID string, lines []domain.OrderItem) (string, error) {
+	if len(lines) > 1 && s.idempotencyMode != IdempotencyPerRequest {
+		return "", ErrCartUnsupported
+	}
+	return s.idempotencyKey(requestID, userID, lines[0].ItemID), nil
+}
+
+func (s *OrderService) idempotencyKey(requestID, userID, itemID string) string {
+	if s.idempotencyMode == IdempotencyPerUserItem {
+		// The item ID is a hash tag, keeping a user's purchase limit in the
+		// same Redis Cluster slot as the item's stock
+		return fmt.Sprintf("idempotency:%s:%s:{%s}", s.campaignID, userID, itemID)
+	}
+	return fmt.Sprintf("idempotency:%s", requestID)
+}
+
+// replay returns the stored outcome of an earlier request with the same key.
+// Requests that are still in flight are reported as duplicates.
+func (s *OrderService) replay(ctx context.Context, idempotencyKey string) (string, error) {
+	result, err := s.cache.GetIdempotencyResult(ctx, idempotencyKey)
+	if err != nil || result == nil {
+		return "", ErrDuplicateRequest
+	}
+
+	switch result.Status {
+	case domain.PurchaseStatusSucceeded:
+		return result.OrderID, nil
+	case domain.PurchaseStatusSoldOut:
+		return "", ErrInsufficientStock
+	case domain.PurchaseStatusItemNotFound:
+		return "", ErrItemNotFound
+	case domain.PurchaseStatusSaleClosed:
+		return "", ErrSaleClosed
+	case domain.PurchaseStatusLimitExceeded:
+		return "", ErrPurchaseLimit
+	case domain.PurchaseStatusCouponRejected:
+		return "", ErrCouponRejected
+	case domain.PurchaseStatusCouponExhausted:
+		return "", ErrCouponExhausted
+	case domain.PurchaseStatusNotDrawn:
+		return "", ErrNotDrawn
+	case domain.PurchaseStatusRiskRejected:
+		return "", ErrRiskRejected
+	case domain.PurchaseStatusFailed:
+		return "", ErrPreviousFailure
+	default:
+		return "", ErrDuplicateRequest
+	}
+}
+
+// resultStatus maps a purchase error to the status stored for it.
+func resultStatus(err error) domain.PurchaseStatus {
+	switch {
+	case errors.Is(err, ErrInsufficientStock):
+		return domain.PurchaseStatusSoldOut
+	case errors.Is(err, ErrItemNotFound):
+		return domain.PurchaseStatusItemNotFound
+	case errors.Is(err, ErrSaleClosed):
+		return domain.PurchaseStatusSaleClosed
+	case errors.Is(err, ErrPurchaseLimit):
+		return domain.PurchaseStatusLimitExceeded
+	case errors.Is(err, ErrCouponRejected):
+		return domain.PurchaseStatusCouponRejected
+	case errors.Is(err, ErrCouponExhausted):
+		return domain.PurchaseStatusCouponExhausted
+	case errors.Is(err, ErrRiskRejected):
+		return domain.PurchaseStatusRiskRejected
+	default:
+		return domain.PurchaseStatusFailed
+	}
+}
+
+// recordStatus maps the outcome of a request to the status recorded for it.
+func recordStatus(err error) domain.PurchaseStatus {
+	switch {
+	case err == nil:
+		return domain.PurchaseStatusSucceeded
+	case errors.Is(err, ErrDuplicateRequest), errors.Is(err, ErrAlreadyEntered):
+		return domain.PurchaseStatusDuplicate
+	default:
+		return resultStatus(err)
+	}
+}
+
+// stockError maps a failed stock decrement to the service error.
+func stockError(d domain.StockDecrement) error {
+	switch d {
+	case domain.StockDecremented:
+		return nil
+	case domain.StockNoSuchItem:
+		return ErrItemNotFound
+	case domain.StockFrozen:
+		return ErrSaleFrozen
+	case domain.StockSaleClosed:
+		return ErrSaleClosed
+	default:
+		return ErrInsufficientStock
+	}
+}
+
+func rejectedStatus(d domain.StockDecrement) domain.PurchaseStatus {
+	switch d {
+	case domain.StockNoSuchItem:
+		return domain.PurchaseStatusItemNotFound
+	case domain.StockSaleClosed:
+		return domain.PurchaseStatusSaleClosed
+	default:
+		return domain.PurchaseStatusSoldOut
 	}
+}
 
-	s.orderQueue <- order
+// saveResult is best effort: if it fails, retries see a plain duplicate.
+func (s *OrderService) saveResult(ctx context.Context, idempotencyKey string, result domain.PurchaseResult) {
+	_ = s.cache.SetIdempotencyResult(ctx, idempotencyKey, result)
+}
+
+// Quote returns the unit and total price for buying quantity units of an
+// item: its price tiers if it has any, otherwise its catalog price.
+func (s *OrderService) Quote(itemID string, quantity int) (unitPrice, total int64) {
+	if schedule, ok := s.pricing[itemID]; ok {
+		unitPrice = schedule.UnitPrice(quantity)
+	} else if item, ok := s.catalogItem(itemID); ok {
+		unitPrice = item.Price
+	}
+	return unitPrice, unitPrice * int64(quantity)
+}
 
+// currency returns the currency an item's orders are placed in.
+func (s *OrderService) currency(itemID string) string {
+	if item, ok := s.catalogItem(itemID); ok && item.Currency != "" {
+		return item.Currency
+	}
+	return domain.DefaultCurrency
+}
+
+// known reports whether every line's item passes the item filter, if any,
+// and, as far as the catalog knows, belongs to the purchase's tenant.
+// Another tenant's items are not found, as they are behind a TenantScope.
+func (s *OrderService) known(ctx context.Context, lines []domain.OrderItem) bool {
+	if s.items != nil && !s.items.Known(lines) {
+		return false
+	}
+	for _, line := range lines {
+		if item, ok := s.catalogItem(line.ItemID); ok && !visible(ctx, item.TenantID) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *OrderService) catalogItem(itemID string) (domain.Item, bool) {
+	if s.catalog == nil {
+		return domain.Item{}, false
+	}
+	return s.catalog.Item(itemID)
+}
+
+// CheckPrice verifies that the total a client displayed matches the price the
+// order will be placed at.
+func (s *OrderService) CheckPrice(itemID string, quantity int, expectedTotal int64, opts ...PurchaseOption) error {
+	return s.CheckCartPrice([]domain.OrderItem{{ItemID: itemID, Quantity: quantity}}, expectedTotal, opts...)
+}
+
+// CheckCartPrice is CheckPrice for the total of a cart.
+func (s *OrderService) CheckCartPrice(lines []domain.OrderItem, expectedTotal int64, opts ...PurchaseOption) error {
+	var total int64
+	for _, line := range mergeLines(lines) {
+		_, lineTotal := s.Quote(line.ItemID, line.Quantity)
+		total += lineTotal
+	}
+
+	// A coupon that does not apply is reported by the purchase itself
+	if po := newPurchaseOptions(opts); po.coupon != "" {
+		if currency, err := s.cartCurrency(lines); err == nil {
+			if coupon, err := s.coupon(po.coupon, currency); err == nil {
+				total -= coupon.Discount(total)
+			}
+		}
+	}
+
+	if total != expectedTotal {
+		return fmt.Errorf("%w: expected %d, got %d", ErrPriceMismatch, total, expectedTotal)
+	}
 	return nil
 }
 
+// RemainingStock returns the item's current stock counter. It is only a hint:
+// concurrent purchases may change it before the caller acts on it.
+func (s *OrderService) RemainingStock(ctx context.Context, itemID string) (int, error) {
+	return s.cache.GetStock(ctx, itemID)
+}
+
+// StockHint returns the item's stock for display alongside a purchase. With
+// WithStockHintCache it may be as old as the cache's TTL, and concurrent
+// calls for an item share one read of the cache.
+func (s *OrderService) StockHint(ctx context.Context, itemID string) (int, error) {
+	if s.stockHints == nil {
+		return s.RemainingStock(ctx, itemID)
+	}
+	return s.stockHints.Get(ctx, itemID, func(ctx context.Context) (int, error) {
+		return s.cache.GetStock(ctx, itemID)
+	})
+}
+
+// SpoolQueued moves the orders still waiting in the queue to the spool and
+// returns how many it moved. Call it once purchases have stopped and before
+// Close; workers still persist the orders they already hold. If the spool
+// fails the orders are put back for the workers.
+func (s *OrderService) SpoolQueued(ctx context.Context) (int, error) {
+	if s.spool == nil {
+		return 0, nil
+	}
+
+	var orders []domain.Order
+	for _, queue := range append(s.priority, s.queues...) {
+	drain:
+		for {
+			select {
+			case order := <-queue:
+				orders = append(orders, order)
+			default:
+				break drain
+			}
+		}
+	}
+	if len(orders) == 0 {
+		return 0, nil
+	}
+
+	if err := s.spool.SpoolOrders(ctx, orders); err != nil {
+		for _, order := range orders {
+			s.queueOf(order) <- order
+		}
+		return 0, fmt.Errorf("spool orders: %w", err)
+	}
+	for tenant, spooled := range byTenant(orders) {
+		s.addQueued(port.WithTenant(ctx, tenant), -len(spooled))
+	}
+	return len(orders), nil
+}
+
+// RecoverSpooled queues the orders spooled by an earlier shutdown and returns
+// how many it queued. Their stock is already reserved, so they go straight
+// to the workers, which must be running: there may be more than fit in the
+// queue. Orders not queued before ctx is done are spooled again.
+func (s *OrderService) RecoverSpooled(ctx context.Context) (int, error) {
+	if s.spool == nil {
+		return 0, nil
+	}
+
+	// A decoding error still returns the orders that could be read
+	orders, err := s.spool.RecoverOrders(ctx)
+	for i, order := range orders {
+		select {
+		case s.queueOf(order) <- order:
+			s.addQueued(port.WithTenant(ctx, order.TenantID), 1)
+		case <-ctx.Done():
+			if err := s.spool.SpoolOrders(context.WithoutCancel(ctx), orders[i:]); err != nil {
+				log.Printf("CRITICAL: %d recovered orders lost: %v", len(orders)-i, err)
+			}
+			return i, ctx.Err()
+		}
+	}
+	if err != nil {
+		return len(orders), fmt.Errorf("recover orders: %w", err)
+	}
+	return len(orders), nil
+}
+
+// addQueued counts orders put in or taken out of the queue other than by
+// the workers in the sale statistics.
+func (s *OrderService) addQueued(ctx context.Context, delta int) {
+	if s.stats != nil {
+		_ = s.stats.AddQueued(context.WithoutCancel(ctx), delta)
+	}
+}
+
+// shedding reports whether the order queue is too full to take purchases.
+func (s *OrderService) shedding() bool {
+	return s.shedAt > 0 && s.QueueDepth() >= s.shedAt
+}
+
+// partition returns the queue partition of an item's orders.
+func (s *OrderService) partition(itemID string) int {
+	if s.ring == nil {
+		return 0
+	}
+	return s.ring.partition(itemID)
+}
+
+// queueOf returns the queue an order goes to: its partition's priority
+// queue for a VIP order if there is one, otherwise the partition's queue.
+func (s *OrderService) queueOf(order domain.Order) chan domain.Order {
+	if order.Tier == domain.TierVIP && s.priority != nil {
+		return s.priority[s.partition(order.ItemID)]
+	}
+	return s.queues[s.partition(order.ItemID)]
+}
+
+// ConcurrencyLimit returns the purchases currently allowed in flight, 0
+// when they are not limited.
+func (s *OrderService) ConcurrencyLimit() int {
+	return s.limiter.current()
+}
+
+// QueueDepth returns the number of orders waiting for a worker.
+func (s *OrderService) QueueDepth() int {
+	depth := 0
+	for _, queue := range append(s.priority, s.queues...) {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// QueueCapacity returns how many orders the queue can hold.
+func (s *OrderService) QueueCapacity() int {
+	capacity := 0
+	for _, queue := range append(s.priority, s.queues...) {
+		capacity += cap(queue)
+	}
+	return capacity
+}
+
+// GetOrderQueue returns the order queue, or the first partition when orders
+// are partitioned by item.
 func (s *OrderService) GetOrderQueue() <-chan domain.Order {
-	return s.orderQueue
+	return s.queues[0]
+}
+
+// OrderQueues returns every partition of the order queue, in partition
+// order; there is one unless WithItemPartitions was used.
+func (s *OrderService) OrderQueues() []<-chan domain.Order {
+	queues := make([]<-chan domain.Order, len(s.queues))
+	for i, queue := range s.queues {
+		queues[i] = queue
+	}
+	return queues
 }
 
+// PriorityQueues returns the VIP queue of every partition, in partition
+// order, or nil without WithVIPPriority.
+func (s *OrderService) PriorityQueues() []<-chan domain.Order {
+	if s.priority == nil {
+		return nil
+	}
+	queues := make([]<-chan domain.Order, len(s.priority))
+	for i, queue := range s.priority {
+		queues[i] = queue
+	}
+	return queues
+}
+
+// Close stops the purchase pool, if any, and closes the order queue so
+// workers can drain it.
 func (s *OrderService) Close() {
-	close(s.orderQueue)
+	if s.pool != nil {
+		s.pool.close()
+	}
+	for _, queue := range append(s.priority, s.queues...) {
+		close(queue)
+	}
 }
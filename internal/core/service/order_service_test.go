@@ -3,9 +3,12 @@ package service
 import (
 	"context"
 	"errors"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rl1809/flash-sale/internal/core/domain"
 )
@@ -14,6 +17,8 @@ import (
 type mockCacheRepo struct {
 	stock          int
 	idempotencySet map[string]bool
+	results        map[string]domain.PurchaseResult
+	reject         domain.StockDecrement // returned instead of decrementing when set
 	mu             sync.Mutex
 }
 
@@ -21,18 +26,69 @@ func newMockCacheRepo(initialStock int) *mockCacheRepo {
 	return &mockCacheRepo{
 		stock:          initialStock,
 		idempotencySet: make(map[string]bool),
+		results:        make(map[string]domain.PurchaseResult),
 	}
 }
 
-func (m *mockCacheRepo) DecrementStock(ctx context.Context, itemID string, quantity int) (bool, error) {
+func (m *mockCacheRepo) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.reject != domain.StockDecremented {
+		return m.reject, nil
+	}
 	if m.stock >= quantity {
 		m.stock -= quantity
-		return true, nil
+		return domain.StockDecremented, nil
 	}
-	return false, nil
+	return domain.StockInsufficient, nil
+}
+
+// DecrementStocks takes every line from the one stock counter
+func (m *mockCacheRepo) DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reject != domain.StockDecremented {
+		return m.reject, lines[0].ItemID, nil
+	}
+	total := 0
+	for _, line := range lines {
+		total += line.Quantity
+	}
+	if m.stock < total {
+		return domain.StockInsufficient, lines[len(lines)-1].ItemID, nil
+	}
+	m.stock -= total
+	return domain.StockDecremented, "", nil
+}
+
+// DecrementStockAbove takes from the one stock counter, keeping floor units
+func (m *mockCacheRepo) DecrementStockAbove(ctx context.Context, itemID string, quantity, floor int) (domain.StockDecrement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reject != domain.StockDecremented {
+		return m.reject, nil
+	}
+	if m.stock-quantity >= floor {
+		m.stock -= quantity
+		return domain.StockDecremented, nil
+	}
+	return domain.StockInsufficient, nil
+}
+
+func (m *mockCacheRepo) GetStock(ctx context.Context, itemID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stock, nil
+}
+
+func (m *mockCacheRepo) SetStock(ctx context.Context, itemID string, quantity int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stock = quantity
+	return nil
 }
 
 func (m *mockCacheRepo) IncrementStock(ctx context.Context, itemID string, quantity int) error {
@@ -42,7 +98,7 @@ func (m *mockCacheRepo) IncrementStock(ctx context.Context, itemID string, quant
 	return nil
 }
 
-func (m *mockCacheRepo) SetIdempotency(ctx context.Context, key string) (bool, error) {
+func (m *mockCacheRepo) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -53,6 +109,31 @@ func (m *mockCacheRepo) SetIdempotency(ctx context.Context, key string) (bool, e
 	return true, nil
 }
 
+func (m *mockCacheRepo) ReleaseIdempotency(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotencySet, key)
+	return nil
+}
+
+func (m *mockCacheRepo) SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[key] = result
+	return nil
+}
+
+func (m *mockCacheRepo) GetIdempotencyResult(ctx context.Context, key string) (*domain.PurchaseResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, ok := m.results[key]
+	if !ok {
+		return nil, nil
+	}
+	return &result, nil
+}
+
 func TestPurchase_Success(t *testing.T) {
 	cache := newMockCacheRepo(10)
 	svc := NewOrderService(cache, 100)
@@ -64,7 +145,7 @@ func TestPurchase_Success(t *testing.T) {
 		}
 	}()
 
-	err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
 	if err != nil {
 		t.Errorf("expected success, got error: %v", err)
 	}
@@ -84,7 +165,7 @@ func TestPurchase_InsufficientStock(t *testing.T) {
 		}
 	}()
 
-	err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
 	if !errors.Is(err, ErrInsufficientStock) {
 		t.Errorf("expected ErrInsufficientStock, got: %v", err)
 	}
@@ -101,15 +182,18 @@ func TestPurchase_DuplicateRequest(t *testing.T) {
 	}()
 
 	// First request
-	err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	orderID, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
 	if err != nil {
 		t.Fatalf("first purchase failed: %v", err)
 	}
 
-	// Duplicate request with same requestID
-	err = svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
-	if !errors.Is(err, ErrDuplicateRequest) {
-		t.Errorf("expected ErrDuplicateRequest, got: %v", err)
+	// Duplicate request with same requestID replays the original result
+	replayedID, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if err != nil {
+		t.Errorf("expected replayed success, got: %v", err)
+	}
+	if replayedID != orderID {
+		t.Errorf("expected order ID %s, got %s", orderID, replayedID)
 	}
 
 	// Stock should only be decremented once
@@ -118,6 +202,43 @@ func TestPurchase_DuplicateRequest(t *testing.T) {
 	}
 }
 
+func TestPurchase_DuplicateInFlight(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100)
+	defer svc.Close()
+
+	// Key claimed by a request that has not stored its result yet
+	cache.SetIdempotency(context.Background(), "idempotency:req-1", time.Hour)
+
+	_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if !errors.Is(err, ErrDuplicateRequest) {
+		t.Errorf("expected ErrDuplicateRequest, got: %v", err)
+	}
+
+	if cache.stock != 10 {
+		t.Errorf("expected stock 10, got %d", cache.stock)
+	}
+}
+
+func TestPurchase_DuplicateReplaysSoldOut(t *testing.T) {
+	cache := newMockCacheRepo(0)
+	svc := NewOrderService(cache, 100)
+	defer svc.Close()
+
+	_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got: %v", err)
+	}
+
+	// Restocking must not change the answer for the same request
+	cache.IncrementStock(context.Background(), "item-1", 5)
+
+	_, err = svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("expected replayed ErrInsufficientStock, got: %v", err)
+	}
+}
+
 func TestPurchase_Concurrent(t *testing.T) {
 	initialStock := 20
 	totalRequests := 50
@@ -140,7 +261,7 @@ func TestPurchase_Concurrent(t *testing.T) {
 		go func(id int) {
 			defer wg.Done()
 			requestID := "req-" + string(rune(id+'0')) + "-" + string(rune(i+'0'))
-			err := svc.Purchase(context.Background(), requestID, "user", "item", 1)
+			_, err := svc.Purchase(context.Background(), requestID, "user", "item", 1)
 			if err == nil {
 				successCount.Add(1)
 			} else {
@@ -164,7 +285,7 @@ func TestPurchase_OrderQueued(t *testing.T) {
 	cache := newMockCacheRepo(10)
 	svc := NewOrderService(cache, 100)
 
-	err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 2)
+	orderID, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 2)
 	if err != nil {
 		t.Fatalf("purchase failed: %v", err)
 	}
@@ -172,6 +293,9 @@ func TestPurchase_OrderQueued(t *testing.T) {
 	// Read from queue
 	order := <-svc.GetOrderQueue()
 
+	if order.ID != orderID {
+		t.Errorf("expected order ID %s, got %s", orderID, order.ID)
+	}
 	if order.UserID != "user-1" {
 		t.Errorf("expected user-1, got %s", order.UserID)
 	}
@@ -190,3 +314,924 @@ func TestPurchase_OrderQueued(t *testing.T) {
 
 	svc.Close()
 }
+
+func TestPurchase_PerUserItemIdempotency(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100,
+		WithIdempotency(IdempotencyPerUserItem, time.Hour),
+		WithCampaign("summer"),
+	)
+	defer svc.Close()
+
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+
+	orderID, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if err != nil {
+		t.Fatalf("first purchase failed: %v", err)
+	}
+
+	// A new request ID from the same user for the same item replays the first order
+	replayedID, err := svc.Purchase(context.Background(), "req-2", "user-1", "item-1", 1)
+	if err != nil {
+		t.Fatalf("expected replayed success, got: %v", err)
+	}
+	if replayedID != orderID {
+		t.Errorf("expected order ID %s, got %s", orderID, replayedID)
+	}
+
+	// Other users and other items are unaffected
+	if _, err := svc.Purchase(context.Background(), "req-3", "user-2", "item-1", 1); err != nil {
+		t.Errorf("expected success for other user, got: %v", err)
+	}
+	if _, err := svc.Purchase(context.Background(), "req-4", "user-1", "item-2", 1); err != nil {
+		t.Errorf("expected success for other item, got: %v", err)
+	}
+
+	if !cache.idempotencySet["idempotency:summer:user-1:{item-1}"] {
+		t.Error("expected campaign scoped idempotency key")
+	}
+	if cache.stock != 7 {
+		t.Errorf("expected stock 7, got %d", cache.stock)
+	}
+}
+
+// blockingCacheRepo holds DecrementStock until release is closed
+type blockingCacheRepo struct {
+	*mockCacheRepo
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingCacheRepo) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.mockCacheRepo.DecrementStock(ctx, itemID, quantity)
+}
+
+func TestPurchase_PoolOverloaded(t *testing.T) {
+	cache := &blockingCacheRepo{
+		mockCacheRepo: newMockCacheRepo(10),
+		entered:       make(chan struct{}, 10),
+		release:       make(chan struct{}),
+	}
+	svc := NewOrderService(cache, 100, WithPurchasePool(1, 1))
+
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+
+	results := make(chan error, 2)
+
+	// First purchase occupies the only worker
+	go func() {
+		_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+		results <- err
+	}()
+	<-cache.entered
+
+	// Second purchase waits in the backlog
+	go func() {
+		_, err := svc.Purchase(context.Background(), "req-2", "user-2", "item-1", 1)
+		results <- err
+	}()
+	for len(svc.pool.jobs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Third purchase is rejected immediately
+	_, err := svc.Purchase(context.Background(), "req-3", "user-3", "item-1", 1)
+	if !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected ErrOverloaded, got: %v", err)
+	}
+
+	close(cache.release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("expected success, got: %v", err)
+		}
+	}
+
+	svc.Close()
+
+	if cache.stock != 8 {
+		t.Errorf("expected stock 8, got %d", cache.stock)
+	}
+}
+
+func TestPurchase_PoolSkipsCancelled(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100, WithPurchasePool(1, 10))
+	defer svc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock 10, got %d", cache.stock)
+	}
+}
+
+type recordingMetrics struct {
+	outcomes map[string]int
+	timeouts map[string]int
+	mu       sync.Mutex
+}
+
+func (r *recordingMetrics) PurchaseCompleted(ctx context.Context, outcome string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outcomes[outcome]++
+}
+
+func (r *recordingMetrics) OrdersPersisted(count int) {}
+func (r *recordingMetrics) OrderFailed()              {}
+
+func (r *recordingMetrics) StageTimedOut(stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timeouts == nil {
+		r.timeouts = make(map[string]int)
+	}
+	r.timeouts[stage]++
+}
+
+func TestPurchase_RecordsOutcomes(t *testing.T) {
+	cache := newMockCacheRepo(1)
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+	svc := NewOrderService(cache, 100, WithMetrics(m))
+	defer svc.Close()
+
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+
+	svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	svc.Purchase(context.Background(), "req-2", "user-2", "item-1", 1)
+
+	if m.outcomes[OutcomeSuccess] != 1 || m.outcomes[OutcomeSoldOut] != 1 {
+		t.Errorf("unexpected outcomes: %v", m.outcomes)
+	}
+}
+
+func TestPurchase_LoadShedding(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+	svc := NewOrderService(cache, 4, WithLoadShedding(0.5), WithMetrics(m))
+	ctx := context.Background()
+
+	// Nobody drains the queue, so it fills up to the threshold of 2
+	for _, user := range []string{"user-1", "user-2"} {
+		if _, err := svc.Purchase(ctx, "req-"+user, user, "item-1", 1); err != nil {
+			t.Fatalf("expected success, got: %v", err)
+		}
+	}
+
+	_, err := svc.Purchase(ctx, "req-3", "user-3", "item-1", 1)
+	if !errors.Is(err, ErrLoadShed) || !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected ErrLoadShed, got: %v", err)
+	}
+	if err := svc.SubmitPurchase(ctx, "req-4", "user-4", "item-1", 1); !errors.Is(err, ErrLoadShed) {
+		t.Errorf("expected ErrLoadShed, got: %v", err)
+	}
+
+	if cache.stock != 8 {
+		t.Errorf("shed purchases must not take stock, got %d", cache.stock)
+	}
+	if len(cache.idempotencySet) != 2 {
+		t.Error("shed purchases must not claim idempotency keys")
+	}
+	if m.outcomes[OutcomeShed] != 2 {
+		t.Errorf("expected 2 shed outcomes, got %v", m.outcomes)
+	}
+
+	// Draining the queue lets purchases through again
+	<-svc.GetOrderQueue()
+	if _, err := svc.Purchase(ctx, "req-5", "user-5", "item-1", 1); err != nil {
+		t.Errorf("expected success after draining, got: %v", err)
+	}
+}
+
+func TestPurchase_QueueFull(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 1, WithEnqueueTimeout(10*time.Millisecond))
+	ctx := context.Background()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("expected success, got: %v", err)
+	}
+
+	// Nobody drains the queue, so the second order times out
+	_, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1)
+	if !errors.Is(err, ErrQueueFull) || !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrQueueFull, got: %v", err)
+	}
+	if cache.stock != 9 {
+		t.Errorf("expected stock rolled back to 9, got %d", cache.stock)
+	}
+
+	// The key was released, so the same request succeeds once there is room
+	<-svc.GetOrderQueue()
+	if _, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1); err != nil {
+		t.Errorf("expected retry to succeed, got: %v", err)
+	}
+	if cache.stock != 8 {
+		t.Errorf("expected stock 8, got %d", cache.stock)
+	}
+}
+
+func TestPurchase_EnqueueWaitsForRoom(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 1, WithEnqueueTimeout(time.Second))
+	ctx := context.Background()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("expected success, got: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-svc.GetOrderQueue()
+	}()
+	if _, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1); err != nil {
+		t.Errorf("expected purchase to wait for room, got: %v", err)
+	}
+}
+
+// mockSpool keeps spooled orders in memory
+type mockSpool struct {
+	orders []domain.Order
+	err    error
+}
+
+func (m *mockSpool) SpoolOrders(ctx context.Context, orders []domain.Order) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.orders = append(m.orders, orders...)
+	return nil
+}
+
+func (m *mockSpool) RecoverOrders(ctx context.Context) ([]domain.Order, error) {
+	orders := m.orders
+	m.orders = nil
+	return orders, nil
+}
+
+func (m *mockSpool) SpooledOrders(ctx context.Context) ([]domain.Order, error) {
+	return m.orders, nil
+}
+
+func TestSpoolQueued_RecoveredOnRestart(t *testing.T) {
+	spool := &mockSpool{}
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 10, WithOrderSpool(spool))
+	ctx := context.Background()
+
+	var orderIDs []string
+	for _, user := range []string{"user-1", "user-2", "user-3"} {
+		orderID, err := svc.Purchase(ctx, "req-"+user, user, "item-1", 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		orderIDs = append(orderIDs, orderID)
+	}
+
+	n, err := svc.SpoolQueued(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 spooled orders, got %d, %v", n, err)
+	}
+	if svc.QueueDepth() != 0 {
+		t.Errorf("expected empty queue, got %d", svc.QueueDepth())
+	}
+	svc.Close()
+
+	// A size-1 queue forces recovery to wait on the worker
+	restarted := NewOrderService(cache, 1, WithOrderSpool(spool))
+	recovered := make(chan string, 3)
+	go func() {
+		for order := range restarted.GetOrderQueue() {
+			recovered <- order.ID
+		}
+	}()
+
+	n, err = restarted.RecoverSpooled(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 recovered orders, got %d, %v", n, err)
+	}
+	for _, want := range orderIDs {
+		if got := <-recovered; got != want {
+			t.Errorf("expected order %s, got %s", want, got)
+		}
+	}
+	restarted.Close()
+
+	if len(spool.orders) != 0 {
+		t.Errorf("expected empty spool, got %d orders", len(spool.orders))
+	}
+	if cache.stock != 7 {
+		t.Errorf("recovery must not reserve stock again, got %d", cache.stock)
+	}
+}
+
+func TestSpoolQueued_FailureKeepsOrders(t *testing.T) {
+	spool := &mockSpool{err: errors.New("redis down")}
+	svc := NewOrderService(newMockCacheRepo(10), 10, WithOrderSpool(spool))
+	defer svc.Close()
+
+	if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := svc.SpoolQueued(context.Background()); err == nil {
+		t.Error("expected spool error")
+	}
+	if svc.QueueDepth() != 1 {
+		t.Errorf("expected order back in the queue, got depth %d", svc.QueueDepth())
+	}
+}
+
+func TestPurchase_StockRejections(t *testing.T) {
+	tests := []struct {
+		reject  domain.StockDecrement
+		wantErr error
+	}{
+		{domain.StockNoSuchItem, ErrItemNotFound},
+		{domain.StockSaleClosed, ErrSaleClosed},
+		{domain.StockFrozen, ErrSaleFrozen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reject.String(), func(t *testing.T) {
+			cache := newMockCacheRepo(10)
+			cache.reject = tt.reject
+			svc := NewOrderService(cache, 100)
+
+			_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if cache.stock != 10 {
+				t.Errorf("stock should be untouched, got %d", cache.stock)
+			}
+		})
+	}
+}
+
+func TestPurchase_RetryAfterUnfreeze(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	cache.reject = domain.StockFrozen
+	svc := NewOrderService(cache, 100)
+	ctx := context.Background()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); !errors.Is(err, ErrSaleFrozen) {
+		t.Fatalf("expected ErrSaleFrozen, got %v", err)
+	}
+
+	cache.reject = domain.StockDecremented
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("retry after unfreeze should succeed, got %v", err)
+	}
+}
+
+func TestPurchase_ReplaysSaleClosed(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	cache.reject = domain.StockSaleClosed
+	svc := NewOrderService(cache, 100)
+	ctx := context.Background()
+
+	svc.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+
+	cache.reject = domain.StockDecremented
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); !errors.Is(err, ErrSaleClosed) {
+		t.Fatalf("expected replayed ErrSaleClosed, got %v", err)
+	}
+}
+
+func TestPurchase_TieredPricing(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100, WithPricing(map[string]domain.PriceSchedule{
+		"item-1": {{MinQuantity: 1, UnitPrice: 1000}, {MinQuantity: 3, UnitPrice: 800}},
+	}))
+
+	tests := []struct {
+		quantity  int
+		unitPrice int64
+	}{
+		{1, 1000},
+		{2, 1000},
+		{3, 800},
+		{5, 800},
+	}
+	for _, tt := range tests {
+		unit, total := svc.Quote("item-1", tt.quantity)
+		if unit != tt.unitPrice || total != tt.unitPrice*int64(tt.quantity) {
+			t.Errorf("quantity %d: got unit %d total %d", tt.quantity, unit, total)
+		}
+	}
+
+	if err := svc.CheckPrice("item-1", 3, 3000); !errors.Is(err, ErrPriceMismatch) {
+		t.Errorf("expected ErrPriceMismatch, got %v", err)
+	}
+	if err := svc.CheckPrice("item-1", 3, 2400); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-svc.GetOrderQueue()
+	if order.UnitPrice != 800 || order.TotalPrice != 2400 {
+		t.Errorf("expected price 800/2400 on order, got %d/%d", order.UnitPrice, order.TotalPrice)
+	}
+}
+
+// mockQuota counts units per item and user
+type mockQuota struct {
+	bought map[string]int
+	mu     sync.Mutex
+}
+
+func (q *mockQuota) ReserveQuota(ctx context.Context, itemID, userID string, quantity, limit int) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.bought[itemID+"/"+userID]+quantity > limit {
+		return false, nil
+	}
+	q.bought[itemID+"/"+userID] += quantity
+	return true, nil
+}
+
+func (q *mockQuota) ReleaseQuota(ctx context.Context, itemID, userID string, quantity int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.bought[itemID+"/"+userID] -= quantity
+	return nil
+}
+
+func newTestCatalog(t *testing.T, items ...domain.Item) *Catalog {
+	t.Helper()
+	db := newMockDatabaseRepo()
+	for _, item := range items {
+		db.items[item.ID] = item
+	}
+	catalog := NewCatalog(db, time.Minute)
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh catalog: %v", err)
+	}
+	return catalog
+}
+
+func TestPurchase_CatalogPrice(t *testing.T) {
+	catalog := newTestCatalog(t,
+		domain.Item{ID: "item-1", Price: 1500, Currency: "EUR"},
+		domain.Item{ID: "item-2", Price: 1500, Currency: "EUR"},
+	)
+	svc := NewOrderService(newMockCacheRepo(10), 100, WithCatalog(catalog), WithPricing(map[string]domain.PriceSchedule{
+		"item-2": {{MinQuantity: 1, UnitPrice: 900}},
+	}))
+
+	if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-svc.GetOrderQueue()
+	if order.UnitPrice != 1500 || order.TotalPrice != 3000 || order.Currency != "EUR" {
+		t.Errorf("expected 1500/3000 EUR on order, got %d/%d %s", order.UnitPrice, order.TotalPrice, order.Currency)
+	}
+
+	// Price tiers take precedence over the catalog price
+	if unit, _ := svc.Quote("item-2", 1); unit != 900 {
+		t.Errorf("expected tier price 900, got %d", unit)
+	}
+}
+
+func TestPurchase_PerUserLimit(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	quota := &mockQuota{bought: make(map[string]int)}
+	catalog := newTestCatalog(t, domain.Item{ID: "item-1", Currency: "USD", MaxPerUser: 2})
+	svc := NewOrderService(cache, 100, WithCatalog(catalog), WithPurchaseQuota(quota))
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	defer svc.Close()
+	ctx := context.Background()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 3); !errors.Is(err, ErrPurchaseLimit) {
+		t.Fatalf("expected ErrPurchaseLimit for 3 units, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "user-1", "item-1", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-3", "user-1", "item-1", 1); !errors.Is(err, ErrPurchaseLimit) {
+		t.Fatalf("expected ErrPurchaseLimit past the limit, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-3", "user-1", "item-1", 1); !errors.Is(err, ErrPurchaseLimit) {
+		t.Errorf("expected replayed ErrPurchaseLimit, got %v", err)
+	}
+	if cache.stock != 8 {
+		t.Errorf("expected stock 8, got %d", cache.stock)
+	}
+
+	// Units of a purchase that fails are given back
+	cache.reject = domain.StockSaleClosed
+	if _, err := svc.Purchase(ctx, "req-4", "user-2", "item-1", 2); !errors.Is(err, ErrSaleClosed) {
+		t.Fatalf("expected ErrSaleClosed, got %v", err)
+	}
+	if quota.bought["item-1/user-2"] != 0 {
+		t.Errorf("expected user-2's quota released, got %d", quota.bought["item-1/user-2"])
+	}
+}
+
+func TestPurchaseCart(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	catalog := newTestCatalog(t,
+		domain.Item{ID: "item-1", Price: 1000, Currency: "EUR"},
+		domain.Item{ID: "item-2", Price: 250, Currency: "EUR"},
+		domain.Item{ID: "item-3", Price: 100, Currency: "USD"},
+	)
+	svc := NewOrderService(cache, 100, WithCatalog(catalog))
+	ctx := context.Background()
+
+	// Lines for the same item are merged
+	lines := []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 2}, {ItemID: "item-1", Quantity: 1}}
+	orderID, err := svc.PurchaseCart(ctx, "req-1", "user-1", lines)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-svc.GetOrderQueue()
+	if order.ID != orderID || order.ItemID != "item-1" || order.Quantity != 4 || order.TotalPrice != 2500 || order.Currency != "EUR" {
+		t.Errorf("unexpected order: %+v", order)
+	}
+	want := []domain.OrderItem{
+		{ItemID: "item-1", Quantity: 2, UnitPrice: 1000, TotalPrice: 2000},
+		{ItemID: "item-2", Quantity: 2, UnitPrice: 250, TotalPrice: 500},
+	}
+	if !slices.Equal(order.Items, want) {
+		t.Errorf("expected lines %v, got %v", want, order.Items)
+	}
+	if cache.stock != 6 {
+		t.Errorf("expected stock 6, got %d", cache.stock)
+	}
+	if err := svc.CheckCartPrice(lines, 2500); err != nil {
+		t.Errorf("expected cart total 2500: %v", err)
+	}
+
+	// Nothing is taken when one line cannot be filled
+	_, err = svc.PurchaseCart(ctx, "req-2", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 6}})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+	if cache.stock != 6 {
+		t.Errorf("expected stock still 6, got %d", cache.stock)
+	}
+
+	_, err = svc.PurchaseCart(ctx, "req-3", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-3", Quantity: 1}})
+	if !errors.Is(err, ErrMixedCurrency) {
+		t.Errorf("expected ErrMixedCurrency, got %v", err)
+	}
+}
+
+func TestPurchaseCart_CrossShard(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100, WithShardRouter(shardsByItem{"item-1": 0, "item-2": 1, "item-3": 0}))
+	defer svc.Close()
+	ctx := context.Background()
+
+	_, err := svc.PurchaseCart(ctx, "req-1", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 1}})
+	if !errors.Is(err, ErrCrossShardCart) {
+		t.Fatalf("expected ErrCrossShardCart, got %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected no stock taken, got %d", cache.stock)
+	}
+
+	if _, err := svc.PurchaseCart(ctx, "req-2", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-3", Quantity: 1}}); err != nil {
+		t.Errorf("expected a cart on one shard to be accepted, got %v", err)
+	}
+}
+
+func TestPurchaseCart_PerUserLimitReleasesAllLines(t *testing.T) {
+	quota := &mockQuota{bought: make(map[string]int)}
+	catalog := newTestCatalog(t,
+		domain.Item{ID: "item-1", Currency: "USD", MaxPerUser: 5},
+		domain.Item{ID: "item-2", Currency: "USD", MaxPerUser: 1},
+	)
+	svc := NewOrderService(newMockCacheRepo(10), 100, WithCatalog(catalog), WithPurchaseQuota(quota))
+	defer svc.Close()
+
+	_, err := svc.PurchaseCart(context.Background(), "req-1", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 2}, {ItemID: "item-2", Quantity: 2}})
+	if !errors.Is(err, ErrPurchaseLimit) {
+		t.Fatalf("expected ErrPurchaseLimit, got %v", err)
+	}
+	if quota.bought["item-1/user-1"] != 0 {
+		t.Errorf("expected item-1 quota released, got %d", quota.bought["item-1/user-1"])
+	}
+}
+
+func TestPurchaseCart_PerUserItemIdempotency(t *testing.T) {
+	svc := NewOrderService(newMockCacheRepo(10), 100, WithIdempotency(IdempotencyPerUserItem, time.Hour))
+	defer svc.Close()
+
+	_, err := svc.PurchaseCart(context.Background(), "req-1", "user-1", []domain.OrderItem{{ItemID: "item-1", Quantity: 1}, {ItemID: "item-2", Quantity: 1}})
+	if !errors.Is(err, ErrCartUnsupported) {
+		t.Errorf("expected ErrCartUnsupported, got %v", err)
+	}
+}
+
+func TestPurchase_Coupon(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(10)
+	redemptions := newMockCoupons()
+	coupons := NewCouponService(newMockCoupons(), redemptions, time.Minute)
+	now := time.Now()
+	for _, c := range []domain.Coupon{
+		{Code: "TEN", PercentOff: 10, MaxUses: 1, EndsAt: now.Add(time.Hour)},
+		{Code: "BIG", AmountOff: 5000, Currency: "USD", EndsAt: now.Add(time.Hour)},
+	} {
+		if _, err := coupons.CreateCoupon(ctx, c); err != nil {
+			t.Fatalf("create %s: %v", c.Code, err)
+		}
+	}
+	svc := NewOrderService(cache, 100, WithCoupons(coupons), WithPricing(map[string]domain.PriceSchedule{
+		"item-1": {{MinQuantity: 1, UnitPrice: 1000}},
+	}))
+
+	if err := svc.CheckPrice("item-1", 2, 1800, UsingCoupon("TEN")); err != nil {
+		t.Errorf("expected discounted total 1800: %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 2, UsingCoupon("TEN")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-svc.GetOrderQueue()
+	if order.CouponCode != "TEN" || order.Discount != 200 || order.TotalPrice != 1800 || order.UnitPrice != 1000 {
+		t.Errorf("unexpected order: %+v", order)
+	}
+
+	// The coupon was used up, and the rejection is replayed
+	if _, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1, UsingCoupon("TEN")); !errors.Is(err, ErrCouponExhausted) {
+		t.Fatalf("expected ErrCouponExhausted, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1, UsingCoupon("TEN")); !errors.Is(err, ErrCouponExhausted) {
+		t.Errorf("expected replayed ErrCouponExhausted, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-3", "user-2", "item-1", 1, UsingCoupon("NOPE")); !errors.Is(err, ErrCouponRejected) {
+		t.Errorf("expected ErrCouponRejected, got %v", err)
+	}
+	if cache.stock != 8 {
+		t.Errorf("rejected purchases should not take stock, got %d", cache.stock)
+	}
+
+	// Discounts never take the total below zero
+	if _, err := svc.Purchase(ctx, "req-4", "user-2", "item-1", 1, UsingCoupon("BIG")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order := <-svc.GetOrderQueue(); order.TotalPrice != 0 || order.Discount != 1000 {
+		t.Errorf("expected a free order, got %d off to %d", order.Discount, order.TotalPrice)
+	}
+
+	// A purchase that fails gives its use back
+	cache.reject = domain.StockSaleClosed
+	if _, err := svc.Purchase(ctx, "req-5", "user-3", "item-1", 1, UsingCoupon("BIG")); !errors.Is(err, ErrSaleClosed) {
+		t.Fatalf("expected ErrSaleClosed, got %v", err)
+	}
+	if redemptions.uses["BIG"] != 1 {
+		t.Errorf("expected 1 use of BIG, got %d", redemptions.uses["BIG"])
+	}
+}
+
+func TestSubmitPurchase_StateTransitions(t *testing.T) {
+	cache := &blockingCacheRepo{
+		mockCacheRepo: newMockCacheRepo(10),
+		entered:       make(chan struct{}, 10),
+		release:       make(chan struct{}),
+	}
+	svc := NewOrderService(cache, 100, WithPurchasePool(1, 10))
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	defer svc.Close()
+	ctx := context.Background()
+
+	if err := svc.SubmitPurchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-cache.entered
+
+	result, err := svc.PurchaseState(ctx, "req-1")
+	if err != nil || result.Status != domain.PurchaseStatusQueued {
+		t.Fatalf("expected queued, got %v, %v", result, err)
+	}
+	// A resubmission is accepted without running the purchase again
+	if err := svc.SubmitPurchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("resubmit: unexpected error: %v", err)
+	}
+
+	close(cache.release)
+	deadline := time.Now().Add(time.Second)
+	for result.Status == domain.PurchaseStatusQueued && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		result, _ = svc.PurchaseState(ctx, "req-1")
+	}
+	if result.Status != domain.PurchaseStatusSucceeded || result.OrderID == "" {
+		t.Errorf("expected succeeded with order ID, got %+v", result)
+	}
+	if cache.stock != 9 {
+		t.Errorf("expected stock 9, got %d", cache.stock)
+	}
+
+	if _, err := svc.PurchaseState(ctx, "req-unknown"); !errors.Is(err, ErrPurchaseNotFound) {
+		t.Errorf("expected ErrPurchaseNotFound, got %v", err)
+	}
+}
+
+func TestSubmitPurchase_FrozenRecordsFailure(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	cache.reject = domain.StockFrozen
+	svc := NewOrderService(cache, 100, WithPurchasePool(1, 10))
+	ctx := context.Background()
+
+	if err := svc.SubmitPurchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.Close()
+
+	result, err := svc.PurchaseState(ctx, "req-1")
+	if err != nil || result.Status != domain.PurchaseStatusFailed {
+		t.Errorf("expected failed, got %v, %v", result, err)
+	}
+
+	// Retries of the request get ErrPreviousFailure, counted as replays
+	// rather than errors
+	if OutcomeOf(ErrPreviousFailure) != OutcomeDuplicate {
+		t.Errorf("expected outcome %q, got %q", OutcomeDuplicate, OutcomeOf(ErrPreviousFailure))
+	}
+}
+
+func TestPurchase_ItemPartitions(t *testing.T) {
+	svc := NewOrderService(newMockCacheRepo(100), 400, WithItemPartitions(4))
+	defer svc.Close()
+
+	if got := svc.QueueCapacity(); got != 400 {
+		t.Errorf("expected the queue size split across partitions, got capacity %d", got)
+	}
+
+	items := []string{"item-a", "item-b", "item-c", "item-d", "item-e"}
+	for i := 0; i < 20; i++ {
+		item := items[i%len(items)]
+		if _, err := svc.Purchase(context.Background(), "req-"+strconv.Itoa(i), "user-1", item, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	queues := svc.OrderQueues()
+	if len(queues) != 4 {
+		t.Fatalf("expected 4 partitions, got %d", len(queues))
+	}
+	partitionOf := make(map[string]int)
+	for p, queue := range queues {
+		for len(queue) > 0 {
+			order := <-queue
+			if prev, seen := partitionOf[order.ItemID]; seen && prev != p {
+				t.Errorf("%s routed to partitions %d and %d", order.ItemID, prev, p)
+			}
+			partitionOf[order.ItemID] = p
+		}
+	}
+	if len(partitionOf) != len(items) {
+		t.Errorf("expected every item's orders queued, got %v", partitionOf)
+	}
+}
+
+// riskByDevice scores purchases by their device ID.
+type riskByDevice map[string]domain.RiskAssessment
+
+func (r riskByDevice) Score(ctx context.Context, attempt domain.PurchaseAttempt) (domain.RiskAssessment, error) {
+	if attempt.DeviceID == "broken" {
+		return domain.RiskAssessment{}, errors.New("scorer down")
+	}
+	return r[attempt.DeviceID], nil
+}
+
+func TestPurchase_RiskScorer(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(10)
+	svc := NewOrderService(cache, 100, WithRiskScorer(riskByDevice{
+		"bot":    {Score: 90, Action: domain.RiskReject},
+		"shared": {Score: 60, Action: domain.RiskFlag},
+	}))
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1, FromDevice("bot")); !errors.Is(err, ErrRiskRejected) {
+		t.Fatalf("expected ErrRiskRejected, got %v", err)
+	}
+	if cache.stock != 10 {
+		t.Errorf("expected stock untouched, got %d", cache.stock)
+	}
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1, FromDevice("bot")); !errors.Is(err, ErrRiskRejected) {
+		t.Errorf("expected a retry to replay the rejection, got %v", err)
+	}
+	if OutcomeOf(ErrRiskRejected) != OutcomeRejected {
+		t.Errorf("expected outcome %q, got %q", OutcomeRejected, OutcomeOf(ErrRiskRejected))
+	}
+
+	if _, err := svc.Purchase(ctx, "req-2", "user-1", "item-1", 1, FromDevice("shared")); err != nil {
+		t.Fatalf("expected a flagged purchase to go through, got %v", err)
+	}
+	if order := <-svc.GetOrderQueue(); order.RiskScore != 60 || !order.RiskFlagged {
+		t.Errorf("expected a flagged order with score 60, got %d, %v", order.RiskScore, order.RiskFlagged)
+	}
+
+	// A failing scorer lets purchases through unscored
+	if _, err := svc.Purchase(ctx, "req-3", "user-1", "item-1", 1, FromDevice("broken")); err != nil {
+		t.Fatalf("expected purchase despite scorer error, got %v", err)
+	}
+	if order := <-svc.GetOrderQueue(); order.RiskScore != 0 || order.RiskFlagged {
+		t.Errorf("expected an unscored order, got %d, %v", order.RiskScore, order.RiskFlagged)
+	}
+}
+
+type mockPurchaseRecords struct {
+	mu      sync.Mutex
+	records map[string]domain.PurchaseRecord
+}
+
+func newMockPurchaseRecords() *mockPurchaseRecords {
+	return &mockPurchaseRecords{records: make(map[string]domain.PurchaseRecord)}
+}
+
+func (m *mockPurchaseRecords) SavePurchaseRecord(ctx context.Context, record domain.PurchaseRecord, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[record.RequestID] = record
+	return nil
+}
+
+func (m *mockPurchaseRecords) GetPurchaseRecord(ctx context.Context, requestID string) (*domain.PurchaseRecord, error) {
+	return m.get(requestID), nil
+}
+
+func (m *mockPurchaseRecords) get(requestID string) *domain.PurchaseRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[requestID]
+	if !ok {
+		return nil
+	}
+	return &record
+}
+
+func TestPurchase_Records(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(1)
+	records := newMockPurchaseRecords()
+	svc := NewOrderService(cache, 100, WithIdempotency(IdempotencyPerUserItem, time.Hour), WithPurchaseRecords(records, time.Hour))
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+	defer svc.Close()
+
+	orderID, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	if err != nil {
+		t.Fatalf("purchase failed: %v", err)
+	}
+	// Per-user item keys are not named by request ID, but the record is
+	result, err := svc.PurchaseState(ctx, "req-1")
+	if err != nil || result.Status != domain.PurchaseStatusSucceeded || result.OrderID != orderID {
+		t.Fatalf("expected succeeded with order %s, got %+v, %v", orderID, result, err)
+	}
+
+	if _, err := svc.Purchase(ctx, "req-2", "user-2", "item-1", 1); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected sold out, got %v", err)
+	}
+	record, err := svc.PurchaseRecord(ctx, "req-2")
+	if err != nil || record.Status != domain.PurchaseStatusSoldOut || record.UserID != "user-2" || record.Reason == "" {
+		t.Errorf("expected a sold out record for user-2 with a reason, got %+v, %v", record, err)
+	}
+
+	// A duplicate does not hide the outcome of the request that ran
+	svc.record(ctx, "req-1", "user-1", "", ErrDuplicateRequest)
+	if record := records.get("req-1"); record.Status != domain.PurchaseStatusSucceeded {
+		t.Errorf("expected the success to stand, got %+v", record)
+	}
+	svc.record(ctx, "req-3", "user-1", "", ErrDuplicateRequest)
+	if record := records.get("req-3"); record == nil || record.Status != domain.PurchaseStatusDuplicate {
+		t.Errorf("expected a duplicate record, got %+v", record)
+	}
+
+	if _, err := svc.PurchaseState(ctx, "req-unknown"); !errors.Is(err, ErrPurchaseNotFound) {
+		t.Errorf("expected ErrPurchaseNotFound, got %v", err)
+	}
+}
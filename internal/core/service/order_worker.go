@@ -0,0 +1,703 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// followUpTimeout bounds the writes that follow an order's, such as its
+// rollback, result and statistics.
+const followUpTimeout = 5 * time.Second
+
+// WorkerSettings controls how workers persist queued orders.
+type WorkerSettings struct {
+	// BatchSize is the maximum number of orders written in one transaction.
+	BatchSize int
+	// FlushInterval is how long a worker waits to fill a batch.
+	FlushInterval time.Duration
+	// RetryAttempts is how many times a failed order is retried before its
+	// stock is rolled back.
+	RetryAttempts int
+	// RetryBackoff is the delay before the first retry; it doubles per attempt.
+	RetryBackoff time.Duration
+	// MaxBackoff caps the retry delay.
+	MaxBackoff time.Duration
+}
+
+func DefaultWorkerSettings() WorkerSettings {
+	return WorkerSettings{
+		BatchSize:     50,
+		FlushInterval: 50 * time.Millisecond,
+		RetryAttempts: 3,
+		RetryBackoff:  100 * time.Millisecond,
+		MaxBackoff:    2 * time.Second,
+	}
+}
+
+func (s WorkerSettings) Validate() error {
+	if s.BatchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+	if s.FlushInterval <= 0 {
+		return errors.New("flush interval must be positive")
+	}
+	if s.RetryAttempts < 0 {
+		return errors.New("retry attempts must not be negative")
+	}
+	if s.RetryBackoff < 0 || s.MaxBackoff < s.RetryBackoff {
+		return errors.New("backoff must be non-negative and not exceed max backoff")
+	}
+	return nil
+}
+
+// backoff returns the delay before the given retry attempt (0-based).
+func (s WorkerSettings) backoff(attempt int) time.Duration {
+	d := s.RetryBackoff
+	for i := 0; i < attempt && d < s.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.MaxBackoff)
+}
+
+// WorkerTuning holds worker settings that can be changed while workers are
+// running. Workers pick up new values at the start of their next batch.
+type WorkerTuning struct {
+	settings atomic.Pointer[WorkerSettings]
+}
+
+func NewWorkerTuning(initial WorkerSettings) (*WorkerTuning, error) {
+	t := &WorkerTuning{}
+	if err := t.Update(initial); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *WorkerTuning) Settings() WorkerSettings {
+	return *t.settings.Load()
+}
+
+func (t *WorkerTuning) Update(settings WorkerSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	t.settings.Store(&settings)
+	return nil
+}
+
+// OrderWorker persists queued orders to the database, restoring cache stock
+// for orders that cannot be saved.
+type OrderWorker struct {
+	id      int
+	queue   <-chan domain.Order
+	db      port.DatabaseRepository
+	cache   port.CacheRepository
+	tuning  *WorkerTuning
+	events  port.EventBus
+	results port.OrderResultFeed
+
+	records   port.PurchaseRecords
+	recordTTL time.Duration
+
+	stats port.SaleCounters
+
+	timeouts StageTimeouts
+	metrics  port.Metrics
+
+	// priority, if set, holds VIP orders that are taken before queue's
+	priority <-chan domain.Order
+
+	compensator *StockCompensator
+
+	// breakers, if set, gate every database write: one for the database,
+	// or one per shard of shards
+	breakers []*CircuitBreaker
+	shards   port.ShardRouter
+
+	// stop, when closed, makes the worker exit after its current batch;
+	// observeWait is told how long each batch's first order was queued
+	stop        <-chan struct{}
+	observeWait func(time.Duration)
+
+	// shutdown, when closed, ends waits on the breaker; the orders held
+	// then go to spool
+	shutdown <-chan struct{}
+	spool    port.OrderSpool
+}
+
+// errWorkerShutdown is returned for writes the breaker held until shutdown.
+var errWorkerShutdown = errors.New("worker shut down while the database was unavailable")
+
+type OrderWorkerOption func(*OrderWorker)
+
+// WithWorkerEvents publishes an event for every order the worker saves or
+// gives up on, and for every rollback that fails, on events.
+func WithWorkerEvents(events port.EventBus) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.events = events
+	}
+}
+
+// WithWorkerCompensator returns the stock of orders that cannot be saved
+// through c, so failed returns are retried rather than lost.
+func WithWorkerCompensator(c *StockCompensator) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.compensator = c
+	}
+}
+
+// WithWorkerBreaker sends the worker's writes through breaker, which the
+// workers of a server share. While it is open the worker takes no new orders
+// and retries the ones it holds only when the breaker lets a probe through,
+// so queued orders wait rather than being rolled back.
+func WithWorkerBreaker(breaker *CircuitBreaker) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.breakers = []*CircuitBreaker{breaker}
+		w.shards = nil
+	}
+}
+
+// WithShardBreakers sends each write through the breaker of the shard it
+// goes to, breakers[shards.ShardOf(item)], so a shard that fails pauses
+// only the writes to it. The worker keeps taking orders while one is open,
+// holding those for its shard until it lets a probe through.
+func WithShardBreakers(shards port.ShardRouter, breakers []*CircuitBreaker) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.breakers = breakers
+		w.shards = shards
+	}
+}
+
+// WithWorkerShutdown stops the worker waiting on its breaker once shutdown
+// is closed. The orders it holds then go to spool, for the next run to
+// persist, or are rolled back if spool is nil or fails.
+func WithWorkerShutdown(shutdown <-chan struct{}, spool port.OrderSpool) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.shutdown = shutdown
+		w.spool = spool
+	}
+}
+
+// WithPriorityQueue has the worker take orders from priority before those
+// of its own queue, so they are persisted first.
+func WithPriorityQueue(priority <-chan domain.Order) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.priority = priority
+	}
+}
+
+// WithWorkerResults publishes the final result of every order to results.
+func WithWorkerResults(results port.OrderResultFeed) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.results = results
+	}
+}
+
+// WithWorkerRecords records the final outcome of every order's request in
+// records for ttl, as WithPurchaseRecords does for the purchase itself.
+func WithWorkerRecords(records port.PurchaseRecords, ttl time.Duration) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.records = records
+		w.recordTTL = ttl
+	}
+}
+
+// WithWorkerSaleCounters adds the orders the worker saves, and those it
+// fails to, to the live sale statistics in stats.
+func WithWorkerSaleCounters(stats port.SaleCounters) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.stats = stats
+	}
+}
+
+// WithWorkerTimeouts bounds each of the worker's order writes by the
+// persist timeout of t. The default is DefaultStageTimeouts.
+func WithWorkerTimeouts(t StageTimeouts) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.timeouts = t
+	}
+}
+
+// WithWorkerMetrics reports writes that miss their deadline to m.
+func WithWorkerMetrics(m port.Metrics) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.metrics = m
+	}
+}
+
+func NewOrderWorker(id int, queue <-chan domain.Order, db port.DatabaseRepository, cache port.CacheRepository, tuning *WorkerTuning, opts ...OrderWorkerOption) *OrderWorker {
+	w := &OrderWorker{
+		id: id, queue: queue, db: db, cache: cache, tuning: tuning,
+		events:      noEvents{},
+		compensator: NewStockCompensator(cache, nil),
+		timeouts:    DefaultStageTimeouts(),
+		metrics:     noopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// withWorkerStop lets a WorkerPool retire the worker.
+func withWorkerStop(stop <-chan struct{}, observeWait func(time.Duration)) OrderWorkerOption {
+	return func(w *OrderWorker) {
+		w.stop = stop
+		w.observeWait = observeWait
+	}
+}
+
+// Run processes orders until the queue is closed and drained, or the worker
+// is stopped.
+func (w *OrderWorker) Run() {
+	var batch []domain.Order
+
+	for {
+		if !w.ready() {
+			return
+		}
+		order, received, _ := w.receive(nil, w.stop)
+		if !received {
+			return
+		}
+		if w.observeWait != nil {
+			w.observeWait(time.Since(order.CreatedAt))
+		}
+
+		settings := w.tuning.Settings()
+		batch = append(batch[:0], order)
+
+		open := w.fill(&batch, settings)
+		w.flush(batch, settings)
+
+		if !open {
+			return
+		}
+	}
+}
+
+// ready waits until the database's breaker, if any, would let a write
+// through. It reports false if the worker is stopped or shut down first.
+func (w *OrderWorker) ready() bool {
+	if len(w.breakers) != 1 || w.shards != nil || !w.breakers[0].Open() {
+		return true
+	}
+	breaker := w.breakers[0]
+	switch {
+	case w.stop == nil:
+		return breaker.Ready(w.shutdown)
+	case w.shutdown == nil:
+		return breaker.Ready(w.stop)
+	}
+
+	either := make(chan struct{})
+	waited := make(chan struct{})
+	defer close(waited)
+	go func() {
+		select {
+		case <-w.stop:
+		case <-w.shutdown:
+		case <-waited:
+			return
+		}
+		close(either)
+	}()
+	return breaker.Ready(either)
+}
+
+// fill adds queued orders to the batch until it is full or the flush
+// interval passes. It reports whether the queue is still open.
+func (w *OrderWorker) fill(batch *[]domain.Order, settings WorkerSettings) bool {
+	if len(*batch) >= settings.BatchSize {
+		return true
+	}
+
+	timer := time.NewTimer(settings.FlushInterval)
+	defer timer.Stop()
+
+	for len(*batch) < settings.BatchSize {
+		order, received, open := w.receive(timer.C, nil)
+		if !received {
+			return open
+		}
+		*batch = append(*batch, order)
+	}
+	return true
+}
+
+// receive waits for the next order, taking one from the priority queue
+// whenever it has any. It returns nothing once wait fires, stop is closed or
+// both queues are closed and drained, and reports whether any queue is still
+// open.
+func (w *OrderWorker) receive(wait <-chan time.Time, stop <-chan struct{}) (order domain.Order, received, open bool) {
+	for w.queue != nil || w.priority != nil {
+		select {
+		case order, ok := <-w.priority:
+			if ok {
+				return order, true, true
+			}
+			w.priority = nil
+			continue
+		default:
+		}
+
+		select {
+		case order, ok := <-w.priority:
+			if ok {
+				return order, true, true
+			}
+			w.priority = nil
+		case order, ok := <-w.queue:
+			if ok {
+				return order, true, true
+			}
+			w.queue = nil
+		case <-wait:
+			return domain.Order{}, false, true
+		case <-stop:
+			return domain.Order{}, false, true
+		}
+	}
+	return domain.Order{}, false, false
+}
+
+func (w *OrderWorker) flush(batch []domain.Order, settings WorkerSettings) {
+	unsure := false
+	if len(batch) > 1 {
+		// A batch spans many purchase traces, so it gets its own trace
+		// linked to each of them
+		links := make([]trace.Link, 0, len(batch))
+		for _, order := range batch {
+			links = append(links, trace.LinkFromContext(orderContext(order)))
+		}
+		ctx, span := tracer.Start(context.Background(), "OrderWorker.flush",
+			trace.WithLinks(links...),
+			trace.WithAttributes(attribute.Int("worker.batch_size", len(batch))),
+		)
+
+		err := w.write(batch[0], func() error {
+			writeCtx, cancel := stageContext(ctx, w.timeouts.Persist)
+			defer cancel()
+			return stageError(ctx, writeCtx, w.metrics, StagePersist, w.db.CreateOrders(writeCtx, batch))
+		})
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if err == nil {
+			log.Printf("worker %d: saved batch of %d orders", w.id, len(batch))
+			w.count(batch, nil)
+			for _, order := range batch {
+				w.publish(order, domain.PurchaseStatusSucceeded)
+				w.record(order, nil)
+				w.events.Publish(ctx, domain.OrderPersisted{OrderSummary: domain.SummarizeOrder(order), PersistedAt: time.Now()})
+			}
+			return
+		}
+		if errors.Is(err, errWorkerShutdown) {
+			w.release(ctx, batch)
+			return
+		}
+		// One bad order fails the whole transaction, so fall back to
+		// persisting orders one by one
+		log.Printf("worker %d: batch of %d failed, retrying individually: %v", w.id, len(batch), err)
+		unsure = writeUnsure(err)
+	}
+
+	for _, order := range batch {
+		w.persist(order, settings, unsure)
+	}
+}
+
+// persist saves an order, retrying failed writes, and rolls its stock back
+// once it cannot be saved. unsure is set when an earlier write of the order,
+// such as its batch's, may have committed without the worker hearing so.
+func (w *OrderWorker) persist(order domain.Order, settings WorkerSettings, unsure bool) {
+	spanCtx, span := tracer.Start(orderContext(order), "OrderWorker.persist", trace.WithAttributes(
+		attribute.String("order.id", order.ID),
+		attribute.Int("worker.id", w.id),
+	))
+	defer span.End()
+
+	var err error
+	for attempt := 0; attempt <= settings.RetryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(settings.backoff(attempt - 1))
+		}
+
+		// Rewriting an order that did commit only fails on its duplicate
+		if unsure {
+			if found, _ := w.stored(spanCtx, order); found {
+				w.saved(spanCtx, order)
+				return
+			}
+		}
+
+		err = w.write(order, func() error {
+			ctx, cancel := stageContext(spanCtx, w.timeouts.Persist)
+			defer cancel()
+			return stageError(spanCtx, ctx, w.metrics, StagePersist, w.db.CreateOrder(ctx, order))
+		})
+
+		if err == nil {
+			w.saved(spanCtx, order)
+			return
+		}
+		if errors.Is(err, errWorkerShutdown) {
+			if unsure {
+				if found, _ := w.stored(spanCtx, order); found {
+					w.saved(spanCtx, order)
+					return
+				}
+			}
+			w.release(spanCtx, []domain.Order{order})
+			return
+		}
+		unsure = unsure || writeUnsure(err)
+		if errors.Is(err, port.ErrCrossShard) {
+			// Retrying cannot put the items on one shard
+			break
+		}
+	}
+
+	// Restoring the stock of an order that was saved after all would sell
+	// its units twice
+	if unsure {
+		found, lookupErr := w.stored(spanCtx, order)
+		if found {
+			w.saved(spanCtx, order)
+			return
+		}
+		if lookupErr != nil {
+			log.Printf("worker %d: CRITICAL order %s may not be saved, its stock is left taken: %v (lookup: %v)", w.id, order.ID, err, lookupErr)
+			w.count([]domain.Order{order}, err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "order outcome unknown")
+			return
+		}
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "order rolled back")
+	w.fail(spanCtx, order, err)
+}
+
+// fail gives up on an order that cannot be saved, restoring its stock.
+func (w *OrderWorker) fail(ctx context.Context, order domain.Order, err error) {
+	log.Printf("worker %d: failed to save order %s: %v", w.id, order.ID, err)
+	w.events.Publish(ctx, domain.OrderFailed{OrderSummary: domain.SummarizeOrder(order), Reason: err.Error(), FailedAt: time.Now()})
+	w.count([]domain.Order{order}, err)
+
+	// Rollback: restore stock in cache
+	ctx, cancel := context.WithTimeout(ctx, followUpTimeout)
+	defer cancel()
+
+	if rollbackErr := w.compensator.RestoreOrder(ctx, order, "order "+order.ID); rollbackErr != nil {
+		log.Printf("worker %d: CRITICAL rollback failed for order %s: %v", w.id, order.ID, rollbackErr)
+		w.events.Publish(ctx, domain.RollbackFailed{OrderSummary: domain.SummarizeOrder(order), Reason: rollbackErr.Error(), FailedAt: time.Now()})
+	} else {
+		log.Printf("worker %d: rolled back stock for order %s", w.id, order.ID)
+	}
+
+	// Retries of the purchase must not replay an order that no longer exists
+	if order.IdempotencyKey != "" {
+		result := domain.PurchaseResult{OrderID: order.ID, Status: domain.PurchaseStatusFailed}
+		if err := w.cache.SetIdempotencyResult(ctx, order.IdempotencyKey, result); err != nil {
+			log.Printf("worker %d: failed to record rollback of order %s: %v", w.id, order.ID, err)
+		}
+	}
+	w.publish(order, domain.PurchaseStatusFailed)
+	w.record(order, err)
+}
+
+// release hands orders the worker could not write before shutdown to the
+// spool, which keeps their stock taken for the next run to persist them.
+// Orders that cannot be spooled are rolled back.
+func (w *OrderWorker) release(ctx context.Context, orders []domain.Order) {
+	if w.spool != nil {
+		spoolCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), followUpTimeout)
+		err := w.spool.SpoolOrders(spoolCtx, orders)
+		cancel()
+		if err == nil {
+			log.Printf("worker %d: spooled %d orders held at shutdown", w.id, len(orders))
+			if w.stats != nil {
+				statsCtx, cancel := context.WithTimeout(context.Background(), followUpTimeout)
+				defer cancel()
+				for tenant, spooled := range byTenant(orders) {
+					if err := w.stats.AddQueued(port.WithTenant(statsCtx, tenant), -len(spooled)); err != nil {
+						log.Printf("worker %d: failed to update sale statistics: %v", w.id, err)
+					}
+				}
+			}
+			return
+		}
+		log.Printf("worker %d: failed to spool %d orders held at shutdown, rolling them back: %v", w.id, len(orders), err)
+	}
+	for _, order := range orders {
+		w.fail(orderContext(order), order, errWorkerShutdown)
+	}
+}
+
+// saved reports an order the database holds.
+func (w *OrderWorker) saved(ctx context.Context, order domain.Order) {
+	log.Printf("worker %d: saved order %s", w.id, order.ID)
+	w.count([]domain.Order{order}, nil)
+	w.publish(order, domain.PurchaseStatusSucceeded)
+	w.record(order, nil)
+	w.events.Publish(ctx, domain.OrderPersisted{OrderSummary: domain.SummarizeOrder(order), PersistedAt: time.Now()})
+}
+
+// stored reports whether the database holds the order.
+func (w *OrderWorker) stored(ctx context.Context, order domain.Order) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, followUpTimeout)
+	defer cancel()
+
+	found, err := w.db.GetOrder(ctx, order.ID)
+	if err != nil {
+		return false, err
+	}
+	return found != nil, nil
+}
+
+// writeUnsure reports whether a failed write may still have committed: it
+// timed out or lost its connection after the statement could have reached
+// the database.
+func writeUnsure(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrStageTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// write runs a database write of order, or of a batch starting with it,
+// through the breaker of its database if the worker has breakers.
+func (w *OrderWorker) write(order domain.Order, fn func() error) error {
+	breaker := w.breakerOf(order)
+	if breaker == nil {
+		return fn()
+	}
+	if !breaker.Wait(w.shutdown) {
+		return errWorkerShutdown
+	}
+	err := fn()
+	switch {
+	case errors.Is(err, port.ErrCrossShard):
+		// The write was refused before reaching any database
+		breaker.Release()
+	case errors.Is(err, port.ErrOptimisticLock):
+		// The database answered, turning down the write itself
+		breaker.Record(nil)
+	default:
+		breaker.Record(err)
+	}
+	return err
+}
+
+// breakerOf returns the breaker of the database holding order, if any.
+func (w *OrderWorker) breakerOf(order domain.Order) *CircuitBreaker {
+	switch {
+	case len(w.breakers) == 0:
+		return nil
+	case w.shards == nil:
+		return w.breakers[0]
+	}
+	return w.breakers[w.shards.ShardOf(order.Lines()[0].ItemID)]
+}
+
+// count takes orders off the queue depth in the sale statistics and adds
+// them to the orders saved, or to the failures if err is set.
+func (w *OrderWorker) count(orders []domain.Order, err error) {
+	if w.stats == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), followUpTimeout)
+	defer cancel()
+
+	// Each tenant's sale has its own counters
+	for tenant, orders := range byTenant(orders) {
+		ctx := port.WithTenant(ctx, tenant)
+		var statsErr error
+		if err != nil {
+			statsErr = w.stats.RecordFailure(ctx, OutcomePersistFailed)
+		} else {
+			units := 0
+			for _, order := range orders {
+				units += order.Quantity
+			}
+			statsErr = w.stats.RecordOrders(ctx, len(orders), units, time.Now())
+		}
+		if statsErr == nil {
+			statsErr = w.stats.AddQueued(ctx, -len(orders))
+		}
+		if statsErr != nil {
+			log.Printf("worker %d: failed to update sale statistics: %v", w.id, statsErr)
+		}
+	}
+}
+
+// publish reports the final result of an order to clients waiting on it.
+func (w *OrderWorker) publish(order domain.Order, status domain.PurchaseStatus) {
+	if w.results == nil || order.RequestID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(orderContext(order), followUpTimeout)
+	defer cancel()
+
+	result := domain.OrderResult{RequestID: order.RequestID, OrderID: order.ID, Status: status}
+	if err := w.results.PublishOrderResult(ctx, result); err != nil {
+		log.Printf("worker %d: failed to publish result of order %s: %v", w.id, order.ID, err)
+	}
+}
+
+// record stores the final outcome of an order's request: succeeded, or
+// failed with the error that stopped the order being saved.
+func (w *OrderWorker) record(order domain.Order, err error) {
+	if w.records == nil || order.RequestID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(orderContext(order), followUpTimeout)
+	defer cancel()
+
+	record := domain.PurchaseRecord{
+		RequestID: order.RequestID,
+		UserID:    order.UserID,
+		OrderID:   order.ID,
+		Status:    domain.PurchaseStatusSucceeded,
+		UpdatedAt: time.Now(),
+	}
+	if err != nil {
+		record.Status = domain.PurchaseStatusFailed
+		record.Reason = "order could not be saved: " + err.Error()
+	}
+	if err := w.records.SavePurchaseRecord(ctx, record, w.recordTTL); err != nil {
+		log.Printf("worker %d: failed to record result of order %s: %v", w.id, order.ID, err)
+	}
+}
+
+// orderContext restores the trace context of the purchase that queued order,
+// marked with the order's tenant.
+func orderContext(order domain.Order) context.Context {
+	ctx := port.WithTenant(context.Background(), order.TenantID)
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(order.TraceContext))
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func testWorkerSettings() WorkerSettings {
+	return WorkerSettings{
+		BatchSize:     10,
+		FlushInterval: 10 * time.Millisecond,
+		RetryAttempts: 2,
+		RetryBackoff:  time.Millisecond,
+		MaxBackoff:    time.Millisecond,
+	}
+}
+
+func newTestOrder(id string) domain.Order {
+	return domain.Order{ID: id, UserID: "user", ItemID: "item", Quantity: 1, Status: domain.OrderStatusPending}
+}
+
+func TestOrderWorker_Batches(t *testing.T) {
+	db := newMockDatabaseRepo()
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	queue := make(chan domain.Order, 20)
+	for i := 0; i < 20; i++ {
+		queue <- newTestOrder(fmt.Sprintf("order-%d", i))
+	}
+	close(queue)
+
+	NewOrderWorker(0, queue, db, cache, tuning).Run()
+
+	if len(db.orders) != 20 {
+		t.Errorf("expected 20 orders, got %d", len(db.orders))
+	}
+	if db.batches != 2 {
+		t.Errorf("expected 2 batches, got %d", db.batches)
+	}
+}
+
+func TestOrderWorker_PriorityFirst(t *testing.T) {
+	db := newMockDatabaseRepo()
+	feed := newMockResultFeed()
+	settings := testWorkerSettings()
+	settings.BatchSize = 1
+	tuning, _ := NewWorkerTuning(settings)
+
+	queue := make(chan domain.Order, 3)
+	priority := make(chan domain.Order, 3)
+	for i := 0; i < 3; i++ {
+		order := newTestOrder(fmt.Sprintf("order-%d", i))
+		order.RequestID = order.ID
+		queue <- order
+		vip := newTestOrder(fmt.Sprintf("vip-%d", i))
+		vip.RequestID = vip.ID
+		priority <- vip
+	}
+	close(queue)
+	close(priority)
+
+	NewOrderWorker(0, queue, db, newMockCacheRepo(0), tuning, WithWorkerResults(feed), WithPriorityQueue(priority)).Run()
+
+	if len(feed.published) != 6 {
+		t.Fatalf("expected 6 orders, got %d", len(feed.published))
+	}
+	for i, result := range feed.published {
+		want := fmt.Sprintf("vip-%d", i)
+		if i >= 3 {
+			want = fmt.Sprintf("order-%d", i-3)
+		}
+		if result.OrderID != want {
+			t.Errorf("expected %s saved at %d, got %s", want, i, result.OrderID)
+		}
+	}
+}
+
+func TestOrderWorker_BatchFailureFallsBack(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failBatch = true
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	queue := make(chan domain.Order, 5)
+	for i := 0; i < 5; i++ {
+		queue <- newTestOrder(fmt.Sprintf("order-%d", i))
+	}
+	close(queue)
+
+	NewOrderWorker(0, queue, db, cache, tuning).Run()
+
+	if len(db.orders) != 5 {
+		t.Errorf("expected 5 orders, got %d", len(db.orders))
+	}
+	if cache.stock != 0 {
+		t.Errorf("expected no rollbacks, got stock %d", cache.stock)
+	}
+}
+
+func TestOrderWorker_RetriesBeforeRollback(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failOrders = 2 // succeeds on the last allowed attempt
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	queue := make(chan domain.Order, 1)
+	queue <- newTestOrder("order-1")
+	close(queue)
+
+	NewOrderWorker(0, queue, db, cache, tuning).Run()
+
+	if _, ok := db.orders["order-1"]; !ok {
+		t.Error("expected order to be saved after retries")
+	}
+	if cache.stock != 0 {
+		t.Errorf("expected no rollback, got stock %d", cache.stock)
+	}
+}
+
+func TestOrderWorker_RollbackAfterRetries(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failOrders = 3
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	queue := make(chan domain.Order, 1)
+	queue <- newTestOrder("order-1")
+	close(queue)
+
+	NewOrderWorker(0, queue, db, cache, tuning).Run()
+
+	if len(db.orders) != 0 {
+		t.Errorf("expected no saved orders, got %d", len(db.orders))
+	}
+	if cache.stock != 1 {
+		t.Errorf("expected stock restored to 1, got %d", cache.stock)
+	}
+}
+
+func TestOrderWorker_LostReplyNotRolledBack(t *testing.T) {
+	for _, retries := range []int{0, 2} {
+		db := newMockDatabaseRepo()
+		db.lostReplies = 1 // the write commits but its reply times out
+		cache := newMockCacheRepo(0)
+		feed := newMockResultFeed()
+		settings := testWorkerSettings()
+		settings.RetryAttempts = retries
+		tuning, _ := NewWorkerTuning(settings)
+
+		order := newTestOrder("order-1")
+		order.RequestID = order.ID
+		queue := make(chan domain.Order, 1)
+		queue <- order
+		close(queue)
+
+		NewOrderWorker(0, queue, db, cache, tuning, WithWorkerResults(feed)).Run()
+
+		if cache.stock != 0 {
+			t.Errorf("retries %d: expected no rollback of a saved order, got stock %d", retries, cache.stock)
+		}
+		if len(feed.published) != 1 || feed.published[0].Status != domain.PurchaseStatusSucceeded {
+			t.Errorf("retries %d: expected the order reported saved, got %+v", retries, feed.published)
+		}
+	}
+}
+
+func TestWorkerTuning_Update(t *testing.T) {
+	tuning, err := NewWorkerTuning(DefaultWorkerSettings())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	settings := tuning.Settings()
+	settings.BatchSize = 200
+	if err := tuning.Update(settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tuning.Settings().BatchSize != 200 {
+		t.Errorf("expected batch size 200, got %d", tuning.Settings().BatchSize)
+	}
+
+	settings.MaxBackoff = settings.RetryBackoff - 1
+	if err := tuning.Update(settings); err == nil {
+		t.Error("expected error for max backoff below base backoff")
+	}
+	if tuning.Settings().MaxBackoff != DefaultWorkerSettings().MaxBackoff {
+		t.Error("invalid update must not be applied")
+	}
+}
+
+func TestWorkerSettings_Backoff(t *testing.T) {
+	s := WorkerSettings{RetryBackoff: 100 * time.Millisecond, MaxBackoff: 350 * time.Millisecond}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 350 * time.Millisecond, 350 * time.Millisecond}
+	for attempt, want := range expected {
+		if got := s.backoff(attempt); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
+
+func TestOrderWorker_PublishesResults(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failOrders = 3
+	cache := newMockCacheRepo(0)
+	cache.idempotencySet["idempotency:req-1"] = true
+	feed := newMockResultFeed()
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+
+	failed := newTestOrder("order-1")
+	failed.RequestID, failed.IdempotencyKey = "req-1", "idempotency:req-1"
+	saved := newTestOrder("order-2")
+	saved.RequestID = "req-2"
+
+	queue := make(chan domain.Order, 2)
+	queue <- failed
+	close(queue)
+	records := newMockPurchaseRecords()
+	NewOrderWorker(0, queue, db, cache, tuning, WithWorkerResults(feed), WithWorkerRecords(records, time.Hour)).Run()
+
+	queue = make(chan domain.Order, 1)
+	queue <- saved
+	close(queue)
+	NewOrderWorker(0, queue, db, cache, tuning, WithWorkerResults(feed), WithWorkerRecords(records, time.Hour)).Run()
+
+	if len(feed.published) != 2 ||
+		feed.published[0] != (domain.OrderResult{RequestID: "req-1", OrderID: "order-1", Status: domain.PurchaseStatusFailed}) ||
+		feed.published[1] != (domain.OrderResult{RequestID: "req-2", OrderID: "order-2", Status: domain.PurchaseStatusSucceeded}) {
+		t.Errorf("unexpected published results: %+v", feed.published)
+	}
+	if result := cache.results["idempotency:req-1"]; result.Status != domain.PurchaseStatusFailed {
+		t.Errorf("expected rollback recorded under the idempotency key, got %+v", result)
+	}
+	if record := records.get("req-1"); record == nil || record.Status != domain.PurchaseStatusFailed || record.Reason == "" {
+		t.Errorf("expected a failed record with a reason, got %+v", record)
+	}
+	if record := records.get("req-2"); record == nil || record.Status != domain.PurchaseStatusSucceeded || record.OrderID != "order-2" {
+		t.Errorf("expected a succeeded record, got %+v", record)
+	}
+}
+
+func TestOrderWorker_BreakerPausesWrites(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.failOrders = 2
+	cache := newMockCacheRepo(0)
+	settings := testWorkerSettings()
+	settings.BatchSize = 1
+	tuning, _ := NewWorkerTuning(settings)
+	cooldown := 50 * time.Millisecond
+	breaker := NewCircuitBreaker("db", 2, cooldown)
+
+	queue := make(chan domain.Order, 2)
+	queue <- newTestOrder("order-0")
+	queue <- newTestOrder("order-1")
+	close(queue)
+
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		NewOrderWorker(0, queue, db, cache, tuning, WithWorkerBreaker(breaker)).Run()
+		close(done)
+	}()
+
+	// The first order fails twice, opening the breaker, so the second stays
+	// queued until the first is saved by the probe
+	time.Sleep(cooldown / 2)
+	if len(queue) != 1 {
+		t.Errorf("worker took an order while the breaker was open, %d queued", len(queue))
+	}
+
+	<-done
+	if elapsed := time.Since(start); elapsed < cooldown {
+		t.Errorf("worker retried after %v, before the %v cooldown", elapsed, cooldown)
+	}
+	if len(db.orders) != 2 {
+		t.Errorf("expected 2 orders saved, got %d", len(db.orders))
+	}
+	if breaker.Open() {
+		t.Error("breaker still open after the probe succeeded")
+	}
+}
+
+func TestOrderWorker_ShutdownWhileBreakerOpen(t *testing.T) {
+	for _, spool := range []*mockSpool{{}, {err: errors.New("spool down")}} {
+		db := newMockDatabaseRepo()
+		db.failBatch = true
+		cache := newMockCacheRepo(0)
+		settings := testWorkerSettings()
+		settings.BatchSize = 2
+		tuning, _ := NewWorkerTuning(settings)
+		breaker := NewCircuitBreaker("db", 1, time.Hour)
+
+		queue := make(chan domain.Order, 2)
+		queue <- newTestOrder("order-0")
+		queue <- newTestOrder("order-1")
+
+		shutdown := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			NewOrderWorker(0, queue, db, cache, tuning, WithWorkerBreaker(breaker), WithWorkerShutdown(shutdown, spool)).Run()
+			close(done)
+		}()
+
+		// The failed batch opens the breaker, holding both orders
+		time.Sleep(20 * time.Millisecond)
+		close(shutdown)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("worker still waiting on the breaker after shutdown")
+		}
+
+		if spool.err == nil {
+			if len(spool.orders) != 2 || cache.stock != 0 {
+				t.Errorf("expected both orders spooled with their stock taken, got %d spooled and stock %d", len(spool.orders), cache.stock)
+			}
+		} else if cache.stock != 2 {
+			t.Errorf("expected orders that cannot be spooled rolled back, got stock %d", cache.stock)
+		}
+	}
+}
+
+// shardsByItem places each item on the shard it maps to
+type shardsByItem map[string]int
+
+func (s shardsByItem) ShardOf(itemID string) int { return s[itemID] }
+func (s shardsByItem) Shards() int               { return 2 }
+
+func TestOrderWorker_CrossShardNotRetried(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.orderErr = fmt.Errorf("%w: order order-1", port.ErrCrossShard)
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	breaker := NewCircuitBreaker("db", 1, time.Hour)
+
+	queue := make(chan domain.Order, 1)
+	queue <- newTestOrder("order-1")
+	close(queue)
+
+	NewOrderWorker(0, queue, db, cache, tuning, WithWorkerBreaker(breaker)).Run()
+
+	if db.writes != 1 {
+		t.Errorf("expected one write of a cross-shard order, got %d", db.writes)
+	}
+	if cache.stock != 1 {
+		t.Errorf("expected stock restored to 1, got %d", cache.stock)
+	}
+	if breaker.Open() {
+		t.Error("breaker opened by an order no database was asked to write")
+	}
+}
+
+func TestOrderWorker_ShardBreakers(t *testing.T) {
+	db := newMockDatabaseRepo()
+	cache := newMockCacheRepo(0)
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	shards := shardsByItem{"item": 0, "other": 1}
+	breakers := []*CircuitBreaker{NewCircuitBreaker("shard 0", 1, time.Hour), NewCircuitBreaker("shard 1", 1, time.Hour)}
+	breakers[1].Record(errors.New("shard down"))
+
+	queue := make(chan domain.Order, 1)
+	queue <- newTestOrder("order-1")
+	close(queue)
+
+	done := make(chan struct{})
+	go func() {
+		NewOrderWorker(0, queue, db, cache, tuning, WithShardBreakers(shards, breakers)).Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("order for a healthy shard held by another shard's breaker")
+	}
+	if _, ok := db.orders["order-1"]; !ok {
+		t.Error("expected order saved on its shard")
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// ErrOrderNotFound is returned for payment events that arrive before the
+// worker has persisted the order; the caller is expected to retry.
+var ErrOrderNotFound = errors.New("order not found")
+
+// PaymentService settles pending orders from payment outcomes published by
+// the payment system.
+type PaymentService struct {
+	cache       port.CacheRepository
+	db          port.DatabaseRepository
+	compensator *StockCompensator
+}
+
+type PaymentServiceOption func(*PaymentService)
+
+// WithPaymentCompensator returns the stock of cancelled orders through c, so
+// failed returns are retried rather than lost.
+func WithPaymentCompensator(c *StockCompensator) PaymentServiceOption {
+	return func(s *PaymentService) {
+		s.compensator = c
+	}
+}
+
+func NewPaymentService(cache port.CacheRepository, db port.DatabaseRepository, opts ...PaymentServiceOption) *PaymentService {
+	s := &PaymentService{cache: cache, db: db, compensator: NewStockCompensator(cache, nil)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// HandlePaymentEvent confirms the order on a successful payment and cancels
+// it on a failed one, returning its units for sale. Events for orders that
+// are already settled are ignored so redeliveries are harmless.
+func (s *PaymentService) HandlePaymentEvent(ctx context.Context, event domain.PaymentEvent) (err error) {
+	ctx, span := tracer.Start(ctx, "PaymentService.HandlePaymentEvent")
+	span.SetAttributes(
+		attribute.String("order.id", event.OrderID),
+		attribute.String("payment.status", string(event.Status)),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var to domain.OrderStatus
+	switch event.Status {
+	case domain.PaymentStatusSucceeded:
+		to = domain.OrderStatusConfirmed
+	case domain.PaymentStatusFailed:
+		to = domain.OrderStatusCancelled
+	default:
+		log.Printf("payment event for order %s has unknown status %q, ignoring", event.OrderID, event.Status)
+		return nil
+	}
+
+	order, err := s.db.GetOrder(ctx, event.OrderID)
+	if err != nil {
+		return fmt.Errorf("get order: %w", err)
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+	if order.Status != domain.OrderStatusPending {
+		if order.Status.ReleasesStock() && to == domain.OrderStatusConfirmed {
+			// Typically a hold that expired before the payment went through
+			log.Printf("payment succeeded for %s order %s, refund required", order.Status, order.ID)
+		}
+		return nil
+	}
+
+	updated, err := s.db.UpdateOrderStatus(ctx, order.ID, domain.OrderStatusPending, to)
+	if err != nil {
+		return fmt.Errorf("update order status: %w", err)
+	}
+	if !updated {
+		// Settled by a concurrent delivery of the same event
+		return nil
+	}
+
+	// Allocation orders never took from the cache; their units go back to
+	// the partner's allocation instead
+	if to == domain.OrderStatusCancelled && order.AllocationID == "" {
+		if err := s.compensator.RestoreOrder(ctx, *order, "cancelled order "+order.ID); err != nil {
+			log.Printf("CRITICAL restoring stock failed for cancelled order %s: %v", order.ID, err)
+		}
+	}
+	return nil
+}
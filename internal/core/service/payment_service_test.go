@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func newPendingOrder(db *mockDatabaseRepo, id string) {
+	db.orders[id] = domain.Order{
+		ID:       id,
+		ItemID:   "item-1",
+		UserID:   "user-1",
+		Quantity: 2,
+		Status:   domain.OrderStatusPending,
+	}
+}
+
+func TestHandlePaymentEvent_Succeeded(t *testing.T) {
+	cache := newMockCacheRepo(0)
+	db := newMockDatabaseRepo()
+	newPendingOrder(db, "order-1")
+	svc := NewPaymentService(cache, db)
+
+	err := svc.HandlePaymentEvent(context.Background(), domain.PaymentEvent{OrderID: "order-1", Status: domain.PaymentStatusSucceeded})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.orders["order-1"].Status != domain.OrderStatusConfirmed {
+		t.Errorf("expected confirmed, got %s", db.orders["order-1"].Status)
+	}
+	if cache.stock != 0 {
+		t.Errorf("confirming should not touch stock, got %d", cache.stock)
+	}
+}
+
+func TestHandlePaymentEvent_FailedRestoresStock(t *testing.T) {
+	cache := newMockCacheRepo(0)
+	db := newMockDatabaseRepo()
+	newPendingOrder(db, "order-1")
+	svc := NewPaymentService(cache, db)
+	ctx := context.Background()
+	event := domain.PaymentEvent{OrderID: "order-1", Status: domain.PaymentStatusFailed}
+
+	if err := svc.HandlePaymentEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.orders["order-1"].Status != domain.OrderStatusCancelled {
+		t.Errorf("expected cancelled, got %s", db.orders["order-1"].Status)
+	}
+	if cache.stock != 2 {
+		t.Errorf("expected stock 2, got %d", cache.stock)
+	}
+
+	// Redelivery must not restore the stock twice
+	if err := svc.HandlePaymentEvent(ctx, event); err != nil {
+		t.Fatalf("unexpected error on redelivery: %v", err)
+	}
+	if cache.stock != 2 {
+		t.Errorf("expected stock 2 after redelivery, got %d", cache.stock)
+	}
+}
+
+func TestHandlePaymentEvent_AllocationOrderKeepsCacheStock(t *testing.T) {
+	cache := newMockCacheRepo(0)
+	db := newMockDatabaseRepo()
+	newPendingOrder(db, "order-1")
+	order := db.orders["order-1"]
+	order.AllocationID = "alloc-1"
+	db.orders["order-1"] = order
+	svc := NewPaymentService(cache, db)
+
+	err := svc.HandlePaymentEvent(context.Background(), domain.PaymentEvent{OrderID: "order-1", Status: domain.PaymentStatusFailed})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cache.stock != 0 {
+		t.Errorf("allocation orders should not return cache stock, got %d", cache.stock)
+	}
+}
+
+func TestHandlePaymentEvent_OrderNotPersistedYet(t *testing.T) {
+	svc := NewPaymentService(newMockCacheRepo(0), newMockDatabaseRepo())
+
+	err := svc.HandlePaymentEvent(context.Background(), domain.PaymentEvent{OrderID: "missing", Status: domain.PaymentStatusSucceeded})
+	if !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+}
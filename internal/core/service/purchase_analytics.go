@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// PurchaseAnalytics streams purchase attempts to an analytics sink in
+// batches. Attempts are queued and written by a background worker, so a
+// slow sink never holds up a purchase; attempts that find the queue full
+// and batches the sink fails to store are dropped, like metrics.
+type PurchaseAnalytics struct {
+	sink      port.AnalyticsSink
+	queue     chan domain.PurchaseOutcome
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Int64
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewPurchaseAnalytics queues up to queueSize attempts and writes them
+// batchSize at a time, or whatever has queued every interval.
+func NewPurchaseAnalytics(sink port.AnalyticsSink, queueSize, batchSize int, interval time.Duration) *PurchaseAnalytics {
+	return &PurchaseAnalytics{
+		sink:      sink,
+		queue:     make(chan domain.PurchaseOutcome, queueSize),
+		batchSize: max(batchSize, 1),
+		interval:  interval,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Record queues an attempt to be written.
+func (a *PurchaseAnalytics) Record(attempt domain.PurchaseOutcome) {
+	select {
+	case a.queue <- attempt:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Run writes queued attempts until Close is called, writing those still
+// queued then, or until ctx is cancelled.
+func (a *PurchaseAnalytics) Run(ctx context.Context) {
+	defer close(a.stopped)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	batch := make([]domain.PurchaseOutcome, 0, a.batchSize)
+	for {
+		select {
+		case attempt := <-a.queue:
+			batch = append(batch, attempt)
+			if len(batch) == a.batchSize {
+				batch = a.write(ctx, batch)
+			}
+		case <-ticker.C:
+			batch = a.write(ctx, batch)
+		case <-a.stop:
+			for {
+				select {
+				case attempt := <-a.queue:
+					batch = append(batch, attempt)
+					if len(batch) == a.batchSize {
+						batch = a.write(ctx, batch)
+					}
+				default:
+					a.write(ctx, batch)
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops Run once it has written the queued attempts, waiting for it
+// until ctx is done.
+func (a *PurchaseAnalytics) Close(ctx context.Context) error {
+	close(a.stop)
+	select {
+	case <-a.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write stores batch, returning a new one to fill. The sink may keep the
+// one it was given.
+func (a *PurchaseAnalytics) write(ctx context.Context, batch []domain.PurchaseOutcome) []domain.PurchaseOutcome {
+	if n := a.dropped.Swap(0); n > 0 {
+		log.Printf("purchase analytics: dropped %d attempts: queue full", n)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := a.sink.WritePurchaseOutcomes(ctx, batch); err != nil {
+		log.Printf("purchase analytics: dropped %d attempts: %v", len(batch), err)
+	}
+	return make([]domain.PurchaseOutcome, 0, a.batchSize)
+}
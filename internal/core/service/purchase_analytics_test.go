@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockAnalyticsSink keeps the batches it is given and fails the first
+// failures of them.
+type mockAnalyticsSink struct {
+	mu       sync.Mutex
+	batches  [][]domain.PurchaseOutcome
+	failures int
+}
+
+func (m *mockAnalyticsSink) WritePurchaseOutcomes(ctx context.Context, outcomes []domain.PurchaseOutcome) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("sink unavailable")
+	}
+	m.batches = append(m.batches, outcomes)
+	return nil
+}
+
+func (m *mockAnalyticsSink) written() []domain.PurchaseOutcome {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var outcomes []domain.PurchaseOutcome
+	for _, batch := range m.batches {
+		outcomes = append(outcomes, batch...)
+	}
+	return outcomes
+}
+
+func TestPurchaseAnalytics_Batches(t *testing.T) {
+	sink := &mockAnalyticsSink{}
+	analytics := NewPurchaseAnalytics(sink, 10, 3, time.Hour)
+	for _, id := range []string{"req-1", "req-2", "req-3", "req-4"} {
+		analytics.Record(domain.PurchaseOutcome{RequestID: id})
+	}
+	go analytics.Run(context.Background())
+
+	// The last outcome is written at Close, well before the interval
+	if err := analytics.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if len(sink.batches) != 2 || len(sink.batches[0]) != 3 || len(sink.batches[1]) != 1 {
+		t.Fatalf("expected a batch of 3 and one of 1, got %v", sink.batches)
+	}
+	if outcomes := sink.written(); outcomes[0].RequestID != "req-1" || outcomes[3].RequestID != "req-4" {
+		t.Errorf("expected outcomes in the order recorded, got %v", outcomes)
+	}
+}
+
+func TestPurchaseAnalytics_FlushesOnInterval(t *testing.T) {
+	sink := &mockAnalyticsSink{failures: 1}
+	analytics := NewPurchaseAnalytics(sink, 10, 100, 10*time.Millisecond)
+	go analytics.Run(context.Background())
+	defer analytics.Close(context.Background())
+
+	// The first batch is dropped when the sink fails
+	analytics.Record(domain.PurchaseOutcome{RequestID: "req-1"})
+	deadline := time.Now().Add(time.Second)
+	for {
+		sink.mu.Lock()
+		failures := sink.failures
+		sink.mu.Unlock()
+		if failures == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	analytics.Record(domain.PurchaseOutcome{RequestID: "req-2"})
+	for len(sink.written()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if outcomes := sink.written(); len(outcomes) != 1 || outcomes[0].RequestID != "req-2" {
+		t.Errorf("expected req-2 written on the interval, got %v", outcomes)
+	}
+}
+
+func TestPurchase_Analytics(t *testing.T) {
+	sink := &mockAnalyticsSink{}
+	analytics := NewPurchaseAnalytics(sink, 10, 10, time.Hour)
+	cache := newMockCacheRepo(1)
+	svc := NewOrderService(cache, 100, WithPurchaseAnalytics(analytics))
+	defer svc.Close()
+
+	go func() {
+		for range svc.GetOrderQueue() {
+		}
+	}()
+
+	ctx := context.Background()
+	orderID, _ := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1, FromClientIP("203.0.113.7"))
+	svc.Purchase(ctx, "req-2", "user-2", "item-1", 1)
+	go analytics.Run(ctx)
+	analytics.Close(ctx)
+
+	outcomes := sink.written()
+	if len(outcomes) != 2 {
+		t.Fatalf("expected both attempts, got %v", outcomes)
+	}
+	if got := outcomes[0]; got.Outcome != OutcomeSuccess || got.OrderID != orderID || got.ClientIP != "203.0.113.7" || got.Items[0].ItemID != "item-1" {
+		t.Errorf("expected the successful purchase, got %+v", got)
+	}
+	if got := outcomes[1]; got.Outcome != OutcomeSoldOut || got.UserID != "user-2" || got.Reason == "" {
+		t.Errorf("expected the sold out rejection with its reason, got %+v", got)
+	}
+}
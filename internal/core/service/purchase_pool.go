@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+type purchaseJob struct {
+	ctx    context.Context
+	run    func(ctx context.Context) (string, error)
+	result chan purchaseOutcome
+}
+
+type purchaseOutcome struct {
+	orderID string
+	err     error
+}
+
+// purchasePool runs purchases on a fixed set of goroutines with a bounded
+// backlog, so the number of purchases in flight does not grow with the
+// number of open connections.
+type purchasePool struct {
+	jobs chan purchaseJob
+	wg   sync.WaitGroup
+}
+
+func newPurchasePool(workers, backlog int) *purchasePool {
+	p := &purchasePool{jobs: make(chan purchaseJob, backlog)}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				// The caller has given up; don't take stock for nobody
+				if err := job.ctx.Err(); err != nil {
+					job.result <- purchaseOutcome{err: err}
+					continue
+				}
+				orderID, err := job.run(job.ctx)
+				job.result <- purchaseOutcome{orderID: orderID, err: err}
+			}
+		}()
+	}
+
+	return p
+}
+
+// submit queues a purchase and waits for its outcome. It fails fast with
+// ErrOverloaded when the backlog is full.
+func (p *purchasePool) submit(ctx context.Context, run func(ctx context.Context) (string, error)) (string, error) {
+	job, err := p.enqueue(ctx, run)
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case out := <-job.result:
+		return out.orderID, out.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// enqueue queues a purchase without waiting for it to run.
+func (p *purchasePool) enqueue(ctx context.Context, run func(ctx context.Context) (string, error)) (purchaseJob, error) {
+	job := purchaseJob{ctx: ctx, run: run, result: make(chan purchaseOutcome, 1)}
+
+	select {
+	case p.jobs <- job:
+		return job, nil
+	default:
+		return purchaseJob{}, ErrOverloaded
+	}
+}
+
+// close stops accepting purchases and waits for in-flight ones to finish.
+func (p *purchasePool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrInvalidPurchaseToken = errors.New("invalid purchase token")
+	ErrPurchaseTokenUsed    = errors.New("purchase token already used")
+	ErrSaleNotOpen          = errors.New("sale has not opened")
+)
+
+const (
+	// purchaseTokenSkew is how far ahead of this server's clock another
+	// server may have issued a token
+	purchaseTokenSkew = 5 * time.Second
+	// purchaseTokenNoncePrefix keys the nonces of redeemed tokens
+	purchaseTokenNoncePrefix = "purchase-token:"
+)
+
+// purchaseToken is what a token is signed over.
+type purchaseToken struct {
+	UserID   string `json:"u"`
+	ItemID   string `json:"i"`
+	IssuedAt int64  `json:"t"`
+	Nonce    string `json:"n"`
+}
+
+// PurchaseTokens issues short-lived tokens that a purchase must present, so
+// the purchase API cannot be called without first asking for a token, and
+// a captured request cannot be replayed. A token is signed with HMAC-SHA256
+// and names the user and item it was issued for; its nonce is claimed in
+// the cache when it is redeemed, so every token buys once.
+type PurchaseTokens struct {
+	secret  []byte
+	ttl     time.Duration
+	nonces  port.CacheRepository
+	opensAt time.Time
+	now     func() time.Time
+}
+
+// NewPurchaseTokens returns tokens that are valid for ttl and only issued
+// from opensAt on; a zero opensAt issues them at any time.
+func NewPurchaseTokens(secret []byte, ttl time.Duration, nonces port.CacheRepository, opensAt time.Time) *PurchaseTokens {
+	return &PurchaseTokens{secret: secret, ttl: ttl, nonces: nonces, opensAt: opensAt, now: time.Now}
+}
+
+// Issue returns a token for the user to buy the item and when it expires.
+func (t *PurchaseTokens) Issue(userID, itemID string) (string, time.Time, error) {
+	now := t.now()
+	if now.Before(t.opensAt) {
+		return "", time.Time{}, fmt.Errorf("%w: opens at %s", ErrSaleNotOpen, t.opensAt.Format(time.RFC3339))
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", time.Time{}, fmt.Errorf("generate nonce: %w", err)
+	}
+	payload, err := json.Marshal(purchaseToken{
+		UserID:   userID,
+		ItemID:   itemID,
+		IssuedAt: now.Unix(),
+		Nonce:    base64.RawURLEncoding.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("encode token: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.sign(encoded), time.Unix(now.Unix(), 0).Add(t.ttl), nil
+}
+
+// Redeem checks that token was issued to the user for one of the items and
+// has not expired or been redeemed before, and then uses it up.
+func (t *PurchaseTokens) Redeem(ctx context.Context, token, userID string, itemIDs ...string) error {
+	claims, err := t.verify(token)
+	if err != nil {
+		return err
+	}
+	if claims.UserID != userID || !slices.Contains(itemIDs, claims.ItemID) {
+		return fmt.Errorf("%w: issued for another purchase", ErrInvalidPurchaseToken)
+	}
+
+	now := t.now()
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	expiresAt := issuedAt.Add(t.ttl)
+	if !now.Before(expiresAt) || issuedAt.After(now.Add(purchaseTokenSkew)) {
+		return fmt.Errorf("%w: expired", ErrInvalidPurchaseToken)
+	}
+
+	// The nonce only has to be remembered for as long as the token is valid
+	ok, err := t.nonces.SetIdempotency(ctx, purchaseTokenNoncePrefix+claims.Nonce, expiresAt.Sub(now)+purchaseTokenSkew)
+	if err != nil {
+		return fmt.Errorf("claim token nonce: %w", err)
+	}
+	if !ok {
+		return ErrPurchaseTokenUsed
+	}
+	return nil
+}
+
+// verify checks the signature of token and returns what it was signed over.
+func (t *PurchaseTokens) verify(token string) (*purchaseToken, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(t.sign(encoded))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidPurchaseToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidPurchaseToken)
+	}
+	var claims purchaseToken
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Nonce == "" {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidPurchaseToken)
+	}
+	return &claims, nil
+}
+
+func (t *PurchaseTokens) sign(encoded string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
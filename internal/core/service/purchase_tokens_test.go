@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPurchaseTokens_Redeem(t *testing.T) {
+	ctx := context.Background()
+	tokens := NewPurchaseTokens([]byte("secret"), time.Minute, newMockCacheRepo(0), time.Time{})
+
+	token, expiresAt, err := tokens.Issue("user-1", "item-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if until := time.Until(expiresAt); until <= 0 || until > time.Minute {
+		t.Errorf("expected the token to expire within a minute, got %v", until)
+	}
+
+	if err := tokens.Redeem(ctx, token, "user-2", "item-1"); !errors.Is(err, ErrInvalidPurchaseToken) {
+		t.Errorf("expected ErrInvalidPurchaseToken for another user, got %v", err)
+	}
+	if err := tokens.Redeem(ctx, token, "user-1", "item-2"); !errors.Is(err, ErrInvalidPurchaseToken) {
+		t.Errorf("expected ErrInvalidPurchaseToken for another item, got %v", err)
+	}
+
+	// Tampering with the payload breaks the signature
+	payload, signature, _ := strings.Cut(token, ".")
+	if err := tokens.Redeem(ctx, payload+"x."+signature, "user-1", "item-1"); !errors.Is(err, ErrInvalidPurchaseToken) {
+		t.Errorf("expected ErrInvalidPurchaseToken for a tampered token, got %v", err)
+	}
+	other := NewPurchaseTokens([]byte("other"), time.Minute, newMockCacheRepo(0), time.Time{})
+	if err := other.Redeem(ctx, token, "user-1", "item-1"); !errors.Is(err, ErrInvalidPurchaseToken) {
+		t.Errorf("expected ErrInvalidPurchaseToken under another secret, got %v", err)
+	}
+
+	// A cart may use a token for any of its items, but only once
+	if err := tokens.Redeem(ctx, token, "user-1", "item-3", "item-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tokens.Redeem(ctx, token, "user-1", "item-1"); !errors.Is(err, ErrPurchaseTokenUsed) {
+		t.Errorf("expected ErrPurchaseTokenUsed on replay, got %v", err)
+	}
+}
+
+func TestPurchaseTokens_Expiry(t *testing.T) {
+	ctx := context.Background()
+	opensAt := time.Now().Add(time.Hour)
+	tokens := NewPurchaseTokens([]byte("secret"), time.Minute, newMockCacheRepo(0), opensAt)
+
+	if _, _, err := tokens.Issue("user-1", "item-1"); !errors.Is(err, ErrSaleNotOpen) {
+		t.Fatalf("expected ErrSaleNotOpen, got %v", err)
+	}
+
+	tokens.now = func() time.Time { return opensAt }
+	token, _, err := tokens.Issue("user-1", "item-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tokens.now = func() time.Time { return opensAt.Add(time.Minute) }
+	if err := tokens.Redeem(ctx, token, "user-1", "item-1"); !errors.Is(err, ErrInvalidPurchaseToken) {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const refundBatchSize = 100
+
+var ErrOrderNotConfirmed = errors.New("order not confirmed")
+
+// RefundService refunds confirmed orders as a saga: the payment is refunded,
+// then the units are returned to stock, then the order is marked refunded.
+// Each completed step is persisted, so a refund interrupted by a failure or a
+// restart resumes where it stopped instead of leaving the order half
+// refunded. Steps may run more than once if a server dies between doing one
+// and saving it, so the gateway must reject refunds beyond what was captured.
+type RefundService struct {
+	db       port.DatabaseRepository
+	refunds  port.RefundRepository
+	payments port.PaymentGateway
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewRefundService retries refunds that stalled for longer than interval.
+// Without a payment gateway, only orders paid outside one can be refunded,
+// and their payment must be returned by hand.
+func NewRefundService(db port.DatabaseRepository, refunds port.RefundRepository, payments port.PaymentGateway, interval time.Duration) *RefundService {
+	return &RefundService{db: db, refunds: refunds, payments: payments, interval: interval, now: time.Now}
+}
+
+// Refund starts refunding a confirmed order and runs it as far as it gets.
+// Refunding an order again returns its existing refund. A step that fails is
+// recorded on the returned refund and retried in the background.
+func (s *RefundService) Refund(ctx context.Context, orderID, reason string) (*domain.Refund, error) {
+	order, err := s.db.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	existing, err := s.refunds.GetRefundByOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("get refund: %w", err)
+	}
+	if existing != nil {
+		return existing, nil
+	}
+	if order.Status != domain.OrderStatusConfirmed {
+		return nil, ErrOrderNotConfirmed
+	}
+
+	now := s.now()
+	refund := domain.Refund{
+		ID:        uuid.New().String(),
+		OrderID:   order.ID,
+		PaymentID: order.PaymentID,
+		Amount:    order.TotalPrice,
+		Reason:    reason,
+		Step:      domain.RefundStepPayment,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	created, err := s.refunds.CreateRefund(ctx, refund)
+	if err != nil {
+		return nil, fmt.Errorf("create refund: %w", err)
+	}
+	if !created {
+		// Started concurrently
+		existing, err := s.refunds.GetRefundByOrder(ctx, orderID)
+		if err != nil {
+			return nil, fmt.Errorf("get refund: %w", err)
+		}
+		return existing, nil
+	}
+
+	s.run(ctx, &refund)
+	return &refund, nil
+}
+
+// ResumeStalled picks up unfinished refunds that have not progressed for an
+// interval and reports how many it finished. Each is claimed first, so a
+// refund is only resumed by one server at a time.
+func (s *RefundService) ResumeStalled(ctx context.Context) (int, error) {
+	stalled, err := s.refunds.StaleRefunds(ctx, s.now().Add(-s.interval), refundBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list stalled refunds: %w", err)
+	}
+
+	finished := 0
+	for _, refund := range stalled {
+		refund.UpdatedAt = s.now()
+		claimed, err := s.refunds.UpdateRefund(ctx, refund)
+		if err != nil {
+			return finished, fmt.Errorf("claim refund %s: %w", refund.ID, err)
+		}
+		if !claimed {
+			continue
+		}
+		refund.Version++
+
+		s.run(ctx, &refund)
+		if refund.Step == domain.RefundStepDone {
+			finished++
+		}
+	}
+	return finished, nil
+}
+
+// run advances the refund until it is done or a step fails, in which case
+// the failure is saved for the next retry.
+func (s *RefundService) run(ctx context.Context, refund *domain.Refund) {
+	for refund.Step != domain.RefundStepDone {
+		advanced, err := s.step(ctx, refund)
+		if err != nil {
+			log.Printf("refund %s: %s failed: %v", refund.ID, refund.Step, err)
+			failed := *refund
+			failed.Attempts++
+			failed.LastError = err.Error()
+			failed.UpdatedAt = s.now()
+			saved, saveErr := s.refunds.UpdateRefund(context.WithoutCancel(ctx), failed)
+			if saveErr != nil {
+				log.Printf("refund %s: saving failure failed: %v", refund.ID, saveErr)
+			}
+			if saved {
+				failed.Version++
+				*refund = failed
+			}
+			return
+		}
+		if !advanced {
+			// Another server claimed the refund
+			return
+		}
+	}
+	log.Printf("refund %s: order %s refunded", refund.ID, refund.OrderID)
+}
+
+// step runs the refund's current step and moves it to the next one. It
+// returns false if the refund was changed by someone else meanwhile.
+func (s *RefundService) step(ctx context.Context, refund *domain.Refund) (bool, error) {
+	switch refund.Step {
+	case domain.RefundStepPayment:
+		switch {
+		case refund.PaymentID == "":
+			log.Printf("refund %s: order %s was not paid through a gateway, its payment must be refunded by hand", refund.ID, refund.OrderID)
+		case s.payments == nil:
+			return false, fmt.Errorf("no payment gateway to refund payment %s", refund.PaymentID)
+		default:
+			if err := s.payments.Refund(ctx, refund.PaymentID, refund.Amount); err != nil {
+				return false, fmt.Errorf("refund payment: %w", err)
+			}
+		}
+		return s.advance(ctx, refund, domain.RefundStepInventory)
+
+	case domain.RefundStepInventory:
+		restocked := *refund
+		restocked.UpdatedAt = s.now()
+		ok, err := s.refunds.RestockRefund(ctx, restocked)
+		if err != nil {
+			return false, fmt.Errorf("restore inventory: %w", err)
+		}
+		if ok {
+			restocked.Step = domain.RefundStepStatus
+			restocked.Attempts = 0
+			restocked.LastError = ""
+			restocked.Version++
+			*refund = restocked
+		}
+		return ok, nil
+
+	case domain.RefundStepStatus:
+		updated, err := s.db.UpdateOrderStatus(ctx, refund.OrderID, domain.OrderStatusConfirmed, domain.OrderStatusRefunded)
+		if err != nil {
+			return false, fmt.Errorf("update order status: %w", err)
+		}
+		if !updated {
+			// Updated by an earlier run that failed before saving the step
+			order, err := s.db.GetOrder(ctx, refund.OrderID)
+			if err != nil {
+				return false, fmt.Errorf("get order: %w", err)
+			}
+			if order == nil || order.Status != domain.OrderStatusRefunded {
+				return false, fmt.Errorf("order %s is no longer confirmed", refund.OrderID)
+			}
+		}
+		return s.advance(ctx, refund, domain.RefundStepDone)
+
+	default:
+		return false, fmt.Errorf("unknown refund step %q", refund.Step)
+	}
+}
+
+// advance saves the refund as having reached step.
+func (s *RefundService) advance(ctx context.Context, refund *domain.Refund, step domain.RefundStep) (bool, error) {
+	next := *refund
+	next.Step = step
+	next.Attempts = 0
+	next.LastError = ""
+	next.UpdatedAt = s.now()
+
+	ok, err := s.refunds.UpdateRefund(ctx, next)
+	if err != nil {
+		return false, fmt.Errorf("save refund: %w", err)
+	}
+	if ok {
+		next.Version++
+		*refund = next
+	}
+	return ok, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockRefundRepo keeps refunds in memory, keyed by order ID
+type mockRefundRepo struct {
+	refunds   map[string]domain.Refund
+	restocked int
+}
+
+func newMockRefundRepo() *mockRefundRepo {
+	return &mockRefundRepo{refunds: make(map[string]domain.Refund)}
+}
+
+func (m *mockRefundRepo) CreateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	if _, ok := m.refunds[refund.OrderID]; ok {
+		return false, nil
+	}
+	m.refunds[refund.OrderID] = refund
+	return true, nil
+}
+
+func (m *mockRefundRepo) GetRefundByOrder(ctx context.Context, orderID string) (*domain.Refund, error) {
+	refund, ok := m.refunds[orderID]
+	if !ok {
+		return nil, nil
+	}
+	return &refund, nil
+}
+
+func (m *mockRefundRepo) StaleRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Refund, error) {
+	var stale []domain.Refund
+	for _, refund := range m.refunds {
+		if refund.Step != domain.RefundStepDone && refund.UpdatedAt.Before(before) && len(stale) < limit {
+			stale = append(stale, refund)
+		}
+	}
+	return stale, nil
+}
+
+func (m *mockRefundRepo) UpdateRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	if m.refunds[refund.OrderID].Version != refund.Version {
+		return false, nil
+	}
+	refund.Version++
+	m.refunds[refund.OrderID] = refund
+	return true, nil
+}
+
+func (m *mockRefundRepo) RestockRefund(ctx context.Context, refund domain.Refund) (bool, error) {
+	current := m.refunds[refund.OrderID]
+	if current.Version != refund.Version || current.Step != domain.RefundStepInventory {
+		return false, nil
+	}
+	m.restocked++
+	refund.Step = domain.RefundStepStatus
+	refund.Attempts = 0
+	refund.LastError = ""
+	refund.Version++
+	m.refunds[refund.OrderID] = refund
+	return true, nil
+}
+
+func TestRefund(t *testing.T) {
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", TotalPrice: 500, PaymentID: "auth-1", Status: domain.OrderStatusConfirmed}
+	db.orders["order-2"] = domain.Order{ID: "order-2", Status: domain.OrderStatusPending}
+	refunds := newMockRefundRepo()
+	gateway := newMockGateway()
+	svc := NewRefundService(db, refunds, gateway, time.Minute)
+	ctx := context.Background()
+
+	refund, err := svc.Refund(ctx, "order-1", "damaged")
+	if err != nil || refund.Step != domain.RefundStepDone {
+		t.Fatalf("expected a finished refund, got %+v, %v", refund, err)
+	}
+	if gateway.refunded["auth-1"] != 500 || refunds.restocked != 1 {
+		t.Errorf("expected 500 refunded and the units restocked, got %d and %d", gateway.refunded["auth-1"], refunds.restocked)
+	}
+	if db.orders["order-1"].Status != domain.OrderStatusRefunded {
+		t.Errorf("expected a refunded order, got %s", db.orders["order-1"].Status)
+	}
+
+	// Refunding again returns the same refund without repeating it
+	again, err := svc.Refund(ctx, "order-1", "damaged")
+	if err != nil || again.ID != refund.ID || gateway.refunded["auth-1"] != 500 {
+		t.Errorf("expected the existing refund, got %+v, %v", again, err)
+	}
+
+	if _, err := svc.Refund(ctx, "order-2", ""); !errors.Is(err, ErrOrderNotConfirmed) {
+		t.Errorf("expected ErrOrderNotConfirmed, got %v", err)
+	}
+	if _, err := svc.Refund(ctx, "missing", ""); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestRefund_ResumesAfterFailure(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", TotalPrice: 500, PaymentID: "auth-1", Status: domain.OrderStatusConfirmed}
+	refunds := newMockRefundRepo()
+	gateway := newMockGateway()
+	gateway.refundErr = errors.New("gateway timeout")
+	svc := NewRefundService(db, refunds, gateway, time.Minute)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	refund, err := svc.Refund(ctx, "order-1", "")
+	if err != nil {
+		t.Fatalf("expected the failure to be recorded, got: %v", err)
+	}
+	if refund.Step != domain.RefundStepPayment || refund.Attempts != 1 || refund.LastError == "" {
+		t.Fatalf("expected a stalled payment step, got %+v", refund)
+	}
+	if refunds.restocked != 0 || db.orders["order-1"].Status != domain.OrderStatusConfirmed {
+		t.Fatal("later steps should wait for the payment refund")
+	}
+
+	// Not stalled for long enough yet
+	if n, err := svc.ResumeStalled(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing resumed, got %d, %v", n, err)
+	}
+
+	gateway.refundErr = nil
+	now = now.Add(2 * time.Minute)
+	if n, err := svc.ResumeStalled(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 finished, got %d, %v", n, err)
+	}
+	if gateway.refunded["auth-1"] != 500 || refunds.restocked != 1 || db.orders["order-1"].Status != domain.OrderStatusRefunded {
+		t.Errorf("expected the refund completed, got %+v", refunds.refunds["order-1"])
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var (
+	ErrUnknownRegion    = errors.New("unknown region")
+	ErrRegionStockShort = errors.New("region has too little unsold stock")
+)
+
+// RegionalStock splits each item's stock between regions that sell from
+// their own caches, such as one Redis cluster per region, so purchases
+// never cross regions. Stock is split by the regions' shares when it is
+// set or added, and unsold units can be moved between regions later in the
+// sale to follow demand.
+type RegionalStock struct {
+	local   string
+	shares  map[string]int
+	regions map[string]port.CacheRepository
+}
+
+// NewRegionalStock returns the stock of the regions in shares, this
+// server's being local. regions has the cache of every region.
+func NewRegionalStock(local string, shares map[string]int, regions map[string]port.CacheRepository) *RegionalStock {
+	return &RegionalStock{local: local, shares: shares, regions: regions}
+}
+
+// LocalShare is the part of total units allotted to this server's region.
+func (s *RegionalStock) LocalShare(total int) int {
+	return domain.SplitStock(total, s.shares)[s.local]
+}
+
+// Allocate overwrites an item's stock in every region with its share of
+// total.
+func (s *RegionalStock) Allocate(ctx context.Context, itemID string, total int) error {
+	for region, stock := range domain.SplitStock(total, s.shares) {
+		if err := s.regions[region].SetStock(ctx, itemID, stock); err != nil {
+			return fmt.Errorf("set stock in %s: %w", region, err)
+		}
+	}
+	return nil
+}
+
+// Add adds units to an item, each region getting its share of them.
+func (s *RegionalStock) Add(ctx context.Context, itemID string, quantity int) error {
+	for region, units := range domain.SplitStock(quantity, s.shares) {
+		if units == 0 {
+			continue
+		}
+		if err := s.regions[region].IncrementStock(ctx, itemID, units); err != nil {
+			return fmt.Errorf("add stock in %s: %w", region, err)
+		}
+	}
+	return nil
+}
+
+// Stock returns the unsold stock of an item in every region, by region.
+func (s *RegionalStock) Stock(ctx context.Context, itemID string) ([]domain.RegionStock, error) {
+	stocks := make([]domain.RegionStock, 0, len(s.regions))
+	for region, cache := range s.regions {
+		stock, err := cache.GetStock(ctx, itemID)
+		if err != nil {
+			return nil, fmt.Errorf("get stock in %s: %w", region, err)
+		}
+		stocks = append(stocks, domain.RegionStock{Region: region, Stock: stock})
+	}
+	slices.SortFunc(stocks, func(a, b domain.RegionStock) int { return cmp.Compare(a.Region, b.Region) })
+	return stocks, nil
+}
+
+// Rebalance moves unsold units of an item from one region to another. The
+// units are taken from the source as a purchase would take them, so they
+// are never sold in both regions; if they cannot be added to the target
+// they are put back. A source without that many unsold units is
+// ErrRegionStockShort.
+func (s *RegionalStock) Rebalance(ctx context.Context, itemID, from, to string, quantity int) (*domain.StockRebalance, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	source, ok := s.regions[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRegion, from)
+	}
+	target, ok := s.regions[to]
+	if !ok || to == from {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRegion, to)
+	}
+
+	result, err := source.DecrementStock(ctx, itemID, quantity)
+	if err != nil {
+		return nil, fmt.Errorf("take stock from %s: %w", from, err)
+	}
+	switch result {
+	case domain.StockDecremented:
+	case domain.StockNoSuchItem:
+		return nil, ErrItemNotFound
+	default:
+		return nil, fmt.Errorf("%w: %s is %s", ErrRegionStockShort, from, result)
+	}
+
+	if err := target.IncrementStock(ctx, itemID, quantity); err != nil {
+		if err := source.IncrementStock(context.WithoutCancel(ctx), itemID, quantity); err != nil {
+			log.Printf("CRITICAL rebalance %s: %d units taken from %s were neither moved nor put back: %v", itemID, quantity, from, err)
+		}
+		return nil, fmt.Errorf("add stock to %s: %w", to, err)
+	}
+	log.Printf("rebalanced %s: moved %d units from %s to %s", itemID, quantity, from, to)
+
+	rebalance := &domain.StockRebalance{ItemID: itemID, From: from, To: to, Quantity: quantity, RebalancedAt: time.Now()}
+	if rebalance.Regions, err = s.Stock(ctx, itemID); err != nil {
+		return nil, err
+	}
+	return rebalance, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestSplitStock(t *testing.T) {
+	tests := []struct {
+		total  int
+		shares map[string]int
+		want   map[string]int
+	}{
+		{100, map[string]int{"us": 60, "eu": 40}, map[string]int{"us": 60, "eu": 40}},
+		{7, map[string]int{"us": 60, "eu": 40}, map[string]int{"us": 4, "eu": 3}},
+		{10, map[string]int{"ap": 1, "eu": 1, "us": 1}, map[string]int{"ap": 4, "eu": 3, "us": 3}},
+		{1, map[string]int{"us": 1, "eu": 0}, map[string]int{"us": 1, "eu": 0}},
+	}
+	for _, tt := range tests {
+		got := domain.SplitStock(tt.total, tt.shares)
+		for region, want := range tt.want {
+			if got[region] != want {
+				t.Errorf("SplitStock(%d, %v) = %v, want %v", tt.total, tt.shares, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func newTestRegions() (*RegionalStock, *mockCacheRepo, *mockCacheRepo) {
+	us, eu := newMockCacheRepo(0), newMockCacheRepo(0)
+	regions := NewRegionalStock("us", map[string]int{"us": 60, "eu": 40}, map[string]port.CacheRepository{"us": us, "eu": eu})
+	return regions, us, eu
+}
+
+func TestRegionalStock_Rebalance(t *testing.T) {
+	ctx := context.Background()
+	regions, us, eu := newTestRegions()
+	if err := regions.Allocate(ctx, "item", 100); err != nil {
+		t.Fatalf("allocate: %v", err)
+	}
+	if us.stock != 60 || eu.stock != 40 {
+		t.Fatalf("allocated us %d, eu %d, want 60 and 40", us.stock, eu.stock)
+	}
+
+	rebalance, err := regions.Rebalance(ctx, "item", "eu", "us", 30)
+	if err != nil {
+		t.Fatalf("rebalance: %v", err)
+	}
+	want := []domain.RegionStock{{Region: "eu", Stock: 10}, {Region: "us", Stock: 90}}
+	if len(rebalance.Regions) != 2 || rebalance.Regions[0] != want[0] || rebalance.Regions[1] != want[1] {
+		t.Errorf("regions after rebalance = %+v, want %+v", rebalance.Regions, want)
+	}
+
+	if _, err := regions.Rebalance(ctx, "item", "eu", "us", 11); !errors.Is(err, ErrRegionStockShort) {
+		t.Errorf("rebalance of more than unsold: %v, want ErrRegionStockShort", err)
+	}
+	if _, err := regions.Rebalance(ctx, "item", "eu", "ap", 1); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("rebalance to unknown region: %v, want ErrUnknownRegion", err)
+	}
+	if _, err := regions.Rebalance(ctx, "item", "eu", "eu", 1); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("rebalance within a region: %v, want ErrUnknownRegion", err)
+	}
+	if us.stock != 90 || eu.stock != 10 {
+		t.Errorf("rejected rebalances moved stock: us %d, eu %d", us.stock, eu.stock)
+	}
+}
+
+func TestInventoryService_RegionalStock(t *testing.T) {
+	ctx := context.Background()
+	regions, us, eu := newTestRegions()
+	db := newMockDatabaseRepo()
+	svc := NewInventoryService(us, db, newMockLocker(), WithRegionalStock(regions))
+
+	if _, err := svc.CreateItem(ctx, domain.Item{ID: "item", Name: "Item", Stock: 50}); err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if _, err := svc.Restock(ctx, "item", 10, "ops", ""); err != nil {
+		t.Fatalf("restock: %v", err)
+	}
+	if us.stock != 36 || eu.stock != 24 {
+		t.Errorf("us %d, eu %d, want 36 and 24", us.stock, eu.stock)
+	}
+}
+
+func TestWarmup_RegionalStock(t *testing.T) {
+	ctx := context.Background()
+	regions, _, _ := newTestRegions()
+	db := newMockDatabaseRepo()
+	db.CreateItem(ctx, domain.Item{ID: "item", Name: "Item", Stock: 50})
+	db.CreateCampaign(ctx, domain.Campaign{ID: "later", ItemIDs: []string{"item"}, StartsAt: time.Now().Add(time.Hour), EndsAt: time.Now().Add(2 * time.Hour)})
+	keyspace := &mockKeyspace{}
+	svc := NewCampaignService(keyspace, db, "", WithWarmupRegions(regions))
+
+	warmup, err := svc.Warmup(ctx, "later")
+	if err != nil {
+		t.Fatalf("warmup: %v", err)
+	}
+	if !warmup.Ready || warmup.Items[0].Share != 30 || keyspace.stock["item"] != 30 {
+		t.Errorf("warmup = %+v, cache holds %d, want this region's 30 units", warmup, keyspace.stock["item"])
+	}
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const holdSweepBatchSize = 100
+
+var (
+	ErrHoldExpired     = errors.New("stock hold expired")
+	ErrOrderCancelled  = errors.New("order cancelled")
+	ErrPaymentRequired = errors.New("payment required")
+	ErrPaymentDeclined = errors.New("payment declined")
+	ErrOrderConfirmed  = errors.New("order already confirmed")
+)
+
+// ReservationService finishes two-phase purchases: an order placed with a
+// hold TTL keeps its stock only until it is confirmed, after which a sweeper
+// cancels it and returns its units to MySQL inventory and Redis stock. Users
+// may also cancel their pending orders themselves.
+type ReservationService struct {
+	db          port.DatabaseRepository
+	compensator *StockCompensator
+	payments    port.PaymentGateway
+	rebuy       *OrderService
+	events      port.OrderEventFeed
+	now         func() time.Time
+}
+
+type ReservationServiceOption func(*ReservationService)
+
+// WithPaymentGateway charges orders through payments when they are
+// confirmed. Without a gateway, confirming trusts that the client paid.
+func WithPaymentGateway(payments port.PaymentGateway) ReservationServiceOption {
+	return func(s *ReservationService) {
+		s.payments = payments
+	}
+}
+
+// WithRebuyAfterCancel lets the user purchase a cancelled order's items
+// again: orders releases the order's idempotency key, which under per-user
+// idempotency is also their one-purchase limit, and gives its units back to
+// their per-user limits.
+func WithRebuyAfterCancel(orders *OrderService) ReservationServiceOption {
+	return func(s *ReservationService) {
+		s.rebuy = orders
+	}
+}
+
+// WithOrderEvents publishes an event for every order whose hold expires, so
+// the buyer can be told.
+func WithOrderEvents(events port.OrderEventFeed) ReservationServiceOption {
+	return func(s *ReservationService) {
+		s.events = events
+	}
+}
+
+// NewReservationService returns the Redis stock of expired holds through
+// compensator.
+func NewReservationService(db port.DatabaseRepository, compensator *StockCompensator, opts ...ReservationServiceOption) *ReservationService {
+	s := &ReservationService{db: db, compensator: compensator, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Order returns the user's order. Like Confirm, it reports orders of other
+// users and orders the worker has not persisted yet as ErrOrderNotFound.
+func (s *ReservationService) Order(ctx context.Context, orderID, userID string) (*domain.Order, error) {
+	order, err := s.db.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+	if order == nil || order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// Confirm charges the user's held order with the payment token and finalizes
+// it. The payment is authorized and captured before the order is confirmed,
+// and refunded if the order cannot be, so a confirmed order is always paid
+// for. Confirming an order twice is harmless. Orders the worker has not
+// persisted yet are reported as ErrOrderNotFound, so clients should retry.
+func (s *ReservationService) Confirm(ctx context.Context, orderID, userID, paymentToken string) (*domain.Order, error) {
+	order, err := s.db.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+	// Other users' orders are reported as missing rather than forbidden so
+	// order IDs cannot be probed
+	if order == nil || order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+
+	if order.Status == domain.OrderStatusPending {
+		if !order.ExpiresAt.IsZero() && !s.now().Before(order.ExpiresAt) {
+			return nil, ErrHoldExpired
+		}
+		paymentID, err := s.charge(ctx, order, paymentToken)
+		if err != nil {
+			return nil, err
+		}
+
+		updated, err := s.db.ConfirmOrder(ctx, order.ID, paymentID)
+		if err == nil && updated {
+			order.Status = domain.OrderStatusConfirmed
+			order.PaymentID = paymentID
+			return order, nil
+		}
+
+		// Settled concurrently by the sweeper or a payment event, or the
+		// update failed and may not have applied
+		current, getErr := s.db.GetOrder(port.ReadPrimary(ctx), orderID)
+		if getErr != nil {
+			if paymentID != "" {
+				log.Printf("CRITICAL order %s: payment %s captured but confirmation unknown: %v", order.ID, paymentID, getErr)
+			}
+			return nil, fmt.Errorf("get order: %w", getErr)
+		}
+		// Archived or deleted since it was read, so it can no longer be
+		// confirmed with this payment
+		if current == nil {
+			if paymentID != "" {
+				s.refund(ctx, order, paymentID)
+			}
+			return nil, ErrOrderNotFound
+		}
+		if paymentID != "" && current.PaymentID != paymentID {
+			s.refund(ctx, order, paymentID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("confirm order: %w", err)
+		}
+		order = current
+	}
+
+	switch order.Status {
+	case domain.OrderStatusConfirmed:
+		return order, nil
+	case domain.OrderStatusExpired:
+		return nil, ErrHoldExpired
+	case domain.OrderStatusCancelled:
+		if !order.ExpiresAt.IsZero() && !s.now().Before(order.ExpiresAt) {
+			return nil, ErrHoldExpired
+		}
+		return nil, ErrOrderCancelled
+	default:
+		return nil, fmt.Errorf("order %s has unexpected status %q", order.ID, order.Status)
+	}
+}
+
+// Cancel cancels the user's pending order, returning its units to MySQL
+// inventory and Redis stock. Cancelling an order twice is harmless;
+// confirmed orders cannot be cancelled.
+func (s *ReservationService) Cancel(ctx context.Context, orderID, userID string) (*domain.Order, error) {
+	order, err := s.db.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+	if order == nil || order.UserID != userID {
+		return nil, ErrOrderNotFound
+	}
+
+	if order.Status == domain.OrderStatusPending {
+		// The status change returns the MySQL units in the same transaction
+		cancelled, err := s.db.UpdateOrderStatus(ctx, order.ID, domain.OrderStatusPending, domain.OrderStatusCancelled)
+		if err != nil {
+			return nil, fmt.Errorf("cancel order: %w", err)
+		}
+		if cancelled {
+			s.restoreStock(ctx, order, "cancelled order "+order.ID)
+			s.allowRebuy(ctx, order)
+			log.Printf("order %s: cancelled by user, released %d x %s", order.ID, order.Quantity, order.ItemID)
+			order.Status = domain.OrderStatusCancelled
+			return order, nil
+		}
+
+		// Settled concurrently by a confirmation, the sweeper or a payment event
+		if order, err = s.db.GetOrder(port.ReadPrimary(ctx), orderID); err != nil {
+			return nil, fmt.Errorf("get order: %w", err)
+		}
+		if order == nil {
+			return nil, ErrOrderNotFound
+		}
+	}
+
+	switch order.Status {
+	case domain.OrderStatusCancelled, domain.OrderStatusExpired:
+		return order, nil
+	case domain.OrderStatusConfirmed:
+		return nil, ErrOrderConfirmed
+	default:
+		return nil, fmt.Errorf("order %s has unexpected status %q", order.ID, order.Status)
+	}
+}
+
+// restoreStock returns a cancelled order's units to the cache. Allocation
+// orders never took from the cache.
+func (s *ReservationService) restoreStock(ctx context.Context, order *domain.Order, reason string) {
+	if order.AllocationID != "" {
+		return
+	}
+	if err := s.compensator.RestoreOrder(ctx, *order, reason); err != nil {
+		log.Printf("CRITICAL restoring stock failed for %s: %v", reason, err)
+	}
+}
+
+// allowRebuy lets the user purchase a cancelled order's items again.
+func (s *ReservationService) allowRebuy(ctx context.Context, order *domain.Order) {
+	if s.rebuy == nil {
+		return
+	}
+	s.rebuy.AllowRebuy(ctx, *order)
+}
+
+// charge authorizes and captures the order's total, returning the payment
+// ID, or "" when no gateway is configured.
+func (s *ReservationService) charge(ctx context.Context, order *domain.Order, paymentToken string) (string, error) {
+	if s.payments == nil {
+		return "", nil
+	}
+	if paymentToken == "" {
+		return "", ErrPaymentRequired
+	}
+
+	auth, err := s.payments.Authorize(ctx, domain.PaymentRequest{
+		OrderID: order.ID,
+		UserID:  order.UserID,
+		Amount:  order.TotalPrice,
+		Token:   paymentToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("authorize payment: %w", err)
+	}
+	if !auth.Approved {
+		return "", fmt.Errorf("%w: %s", ErrPaymentDeclined, auth.DeclineReason)
+	}
+
+	if err := s.payments.Capture(ctx, auth.ID, order.TotalPrice); err != nil {
+		// Release the authorization so the buyer's funds are not held
+		s.refund(ctx, order, auth.ID)
+		return "", fmt.Errorf("capture payment: %w", err)
+	}
+	return auth.ID, nil
+}
+
+// refund returns a payment for an order that was not confirmed.
+func (s *ReservationService) refund(ctx context.Context, order *domain.Order, paymentID string) {
+	if err := s.payments.Refund(context.WithoutCancel(ctx), paymentID, order.TotalPrice); err != nil {
+		log.Printf("CRITICAL order %s: refund of payment %s failed: %v", order.ID, paymentID, err)
+		return
+	}
+	log.Printf("order %s: refunded payment %s", order.ID, paymentID)
+}
+
+// ReleaseExpired marks pending orders whose hold has lapsed as expired and
+// returns their units, reporting how many it released. The status change is
+// conditional on the order still being pending, so a confirmation racing the
+// sweep wins or loses as a whole, and two sweeps never release an order twice.
+func (s *ReservationService) ReleaseExpired(ctx context.Context) (int, error) {
+	released := 0
+	for {
+		expired, err := s.db.ExpiredOrders(ctx, s.now(), holdSweepBatchSize)
+		if err != nil {
+			return released, fmt.Errorf("list expired orders: %w", err)
+		}
+
+		for _, order := range expired {
+			// The status change returns the MySQL units in the same transaction
+			updated, err := s.db.UpdateOrderStatus(ctx, order.ID, domain.OrderStatusPending, domain.OrderStatusExpired)
+			if err != nil {
+				return released, fmt.Errorf("expire order %s: %w", order.ID, err)
+			}
+			if !updated {
+				continue
+			}
+			s.restoreStock(ctx, &order, "expired order "+order.ID)
+			s.publishExpired(ctx, &order)
+			log.Printf("order %s: hold expired, released %d x %s", order.ID, order.Quantity, order.ItemID)
+			released++
+		}
+
+		if len(expired) < holdSweepBatchSize {
+			return released, nil
+		}
+	}
+}
+
+// publishExpired tells the order's buyer, through the event feed, that the
+// hold lapsed. The order has already expired, so a lost event is only logged.
+func (s *ReservationService) publishExpired(ctx context.Context, order *domain.Order) {
+	if s.events == nil {
+		return
+	}
+	event := domain.OrderEvent{
+		Type:       domain.OrderEventExpired,
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		ItemID:     order.ItemID,
+		Quantity:   order.Quantity,
+		OccurredAt: s.now(),
+	}
+	if err := s.events.PublishOrderEvent(ctx, event); err != nil {
+		log.Printf("order %s: publish expiry failed: %v", order.ID, err)
+	}
+}
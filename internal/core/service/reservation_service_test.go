@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func newTestReservations(db *mockDatabaseRepo, cache *mockCacheRepo, now time.Time) *ReservationService {
+	s := NewReservationService(db, NewStockCompensator(cache, nil))
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestConfirm(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", UserID: "user-1", Status: domain.OrderStatusPending, ExpiresAt: now.Add(time.Minute)}
+	db.orders["order-2"] = domain.Order{ID: "order-2", UserID: "user-1", Status: domain.OrderStatusPending, ExpiresAt: now}
+	db.orders["order-3"] = domain.Order{ID: "order-3", UserID: "user-1", Status: domain.OrderStatusCancelled}
+	svc := newTestReservations(db, newMockCacheRepo(0), now)
+	ctx := context.Background()
+
+	order, err := svc.Confirm(ctx, "order-1", "user-1", "")
+	if err != nil || order.Status != domain.OrderStatusConfirmed {
+		t.Fatalf("expected confirmed order, got %+v, %v", order, err)
+	}
+	if _, err := svc.Confirm(ctx, "order-1", "user-1", ""); err != nil {
+		t.Errorf("expected repeated confirm to succeed, got: %v", err)
+	}
+
+	tests := []struct {
+		orderID, userID string
+		wantErr         error
+	}{
+		{"order-1", "user-2", ErrOrderNotFound},
+		{"missing", "user-1", ErrOrderNotFound},
+		{"order-2", "user-1", ErrHoldExpired},
+		{"order-3", "user-1", ErrOrderCancelled},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Confirm(ctx, tt.orderID, tt.userID, ""); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s by %s: expected %v, got %v", tt.orderID, tt.userID, tt.wantErr, err)
+		}
+	}
+	if db.orders["order-2"].Status != domain.OrderStatusPending {
+		t.Error("an expired hold is left for the sweeper")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", UserID: "user-1", ItemID: "item-1", Quantity: 2, Status: domain.OrderStatusPending, IdempotencyKey: "idempotency:summer:user-1:item-1"}
+	db.orders["order-2"] = domain.Order{ID: "order-2", UserID: "user-1", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusConfirmed}
+	cache := newMockCacheRepo(5)
+	cache.idempotencySet["idempotency:summer:user-1:item-1"] = true
+	svc := newTestReservations(db, cache, now)
+	orders := NewOrderService(cache, 10)
+	defer orders.Close()
+	WithRebuyAfterCancel(orders)(svc)
+	ctx := context.Background()
+
+	order, err := svc.Cancel(ctx, "order-1", "user-1")
+	if err != nil || order.Status != domain.OrderStatusCancelled {
+		t.Fatalf("expected cancelled order, got %+v, %v", order, err)
+	}
+	if cache.stock != 7 {
+		t.Errorf("expected stock 7, got %d", cache.stock)
+	}
+	if cache.idempotencySet["idempotency:summer:user-1:item-1"] {
+		t.Error("expected the purchase limit released")
+	}
+
+	// Cancelling again does not return the units twice
+	if _, err := svc.Cancel(ctx, "order-1", "user-1"); err != nil || cache.stock != 7 {
+		t.Errorf("expected a harmless repeat, got stock %d, %v", cache.stock, err)
+	}
+
+	tests := []struct {
+		orderID, userID string
+		wantErr         error
+	}{
+		{"order-1", "user-2", ErrOrderNotFound},
+		{"missing", "user-1", ErrOrderNotFound},
+		{"order-2", "user-1", ErrOrderConfirmed},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Cancel(ctx, tt.orderID, tt.userID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s by %s: expected %v, got %v", tt.orderID, tt.userID, tt.wantErr, err)
+		}
+	}
+	if db.orders["order-2"].Status != domain.OrderStatusConfirmed || cache.stock != 7 {
+		t.Error("a confirmed order should be left alone")
+	}
+}
+
+func TestCancel_RebuyAtLimit(t *testing.T) {
+	cache := newMockCacheRepo(10)
+	quota := &mockQuota{bought: make(map[string]int)}
+	catalog := newTestCatalog(t, domain.Item{ID: "item-1", Currency: "USD", MaxPerUser: 2})
+	orders := NewOrderService(cache, 100, WithCatalog(catalog), WithPurchaseQuota(quota))
+	defer orders.Close()
+	db := newMockDatabaseRepo()
+	svc := newTestReservations(db, cache, time.Now())
+	WithRebuyAfterCancel(orders)(svc)
+	ctx := context.Background()
+
+	if _, err := orders.Purchase(ctx, "req-1", "user-1", "item-1", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-orders.GetOrderQueue()
+	order.Status = domain.OrderStatusPending
+	db.orders[order.ID] = order
+	if _, err := orders.Purchase(ctx, "req-2", "user-1", "item-1", 1); !errors.Is(err, ErrPurchaseLimit) {
+		t.Fatalf("expected ErrPurchaseLimit at the limit, got %v", err)
+	}
+
+	if _, err := svc.Cancel(ctx, order.ID, "user-1"); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if quota.bought["item-1/user-1"] != 0 {
+		t.Errorf("expected the cancelled units released, got %d", quota.bought["item-1/user-1"])
+	}
+	if _, err := orders.Purchase(ctx, "req-3", "user-1", "item-1", 2); err != nil {
+		t.Errorf("expected a rebuy after cancelling, got %v", err)
+	}
+}
+
+// mockGateway approves tokens other than "declined" and records captures
+// and refunds. onCapture runs after a capture, to simulate races; refunds
+// fail with refundErr while it is set.
+type mockGateway struct {
+	captured  map[string]int64
+	refunded  map[string]int64
+	onCapture func()
+	refundErr error
+}
+
+func newMockGateway() *mockGateway {
+	return &mockGateway{captured: make(map[string]int64), refunded: make(map[string]int64)}
+}
+
+func (g *mockGateway) Authorize(ctx context.Context, req domain.PaymentRequest) (*domain.PaymentAuthorization, error) {
+	if req.Token == "declined" {
+		return &domain.PaymentAuthorization{DeclineReason: "insufficient_funds"}, nil
+	}
+	return &domain.PaymentAuthorization{ID: "auth-" + req.OrderID, Approved: true}, nil
+}
+
+func (g *mockGateway) Capture(ctx context.Context, authorizationID string, amount int64) error {
+	g.captured[authorizationID] = amount
+	if g.onCapture != nil {
+		g.onCapture()
+	}
+	return nil
+}
+
+func (g *mockGateway) Refund(ctx context.Context, authorizationID string, amount int64) error {
+	if g.refundErr != nil {
+		return g.refundErr
+	}
+	g.refunded[authorizationID] += amount
+	return nil
+}
+
+func TestConfirm_Payment(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", UserID: "user-1", TotalPrice: 500, Status: domain.OrderStatusPending, ExpiresAt: now.Add(time.Minute)}
+	gateway := newMockGateway()
+	svc := newTestReservations(db, newMockCacheRepo(0), now)
+	WithPaymentGateway(gateway)(svc)
+	ctx := context.Background()
+
+	if _, err := svc.Confirm(ctx, "order-1", "user-1", ""); !errors.Is(err, ErrPaymentRequired) {
+		t.Errorf("expected ErrPaymentRequired, got %v", err)
+	}
+	if _, err := svc.Confirm(ctx, "order-1", "user-1", "declined"); !errors.Is(err, ErrPaymentDeclined) {
+		t.Errorf("expected ErrPaymentDeclined, got %v", err)
+	}
+	if db.orders["order-1"].Status != domain.OrderStatusPending {
+		t.Fatal("a declined payment should leave the hold in place")
+	}
+
+	order, err := svc.Confirm(ctx, "order-1", "user-1", "tok_visa")
+	if err != nil || order.PaymentID != "auth-order-1" {
+		t.Fatalf("expected a paid order, got %+v, %v", order, err)
+	}
+	if gateway.captured["auth-order-1"] != 500 || db.orders["order-1"].PaymentID != "auth-order-1" {
+		t.Errorf("expected 500 captured and recorded, got %d", gateway.captured["auth-order-1"])
+	}
+	if len(gateway.refunded) != 0 {
+		t.Errorf("unexpected refunds: %v", gateway.refunded)
+	}
+}
+
+func TestConfirm_PaymentRefundedWhenHoldLost(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", UserID: "user-1", TotalPrice: 500, Status: domain.OrderStatusPending, ExpiresAt: now.Add(time.Minute)}
+	gateway := newMockGateway()
+	// The sweeper cancels the order while the payment is in flight
+	gateway.onCapture = func() {
+		db.UpdateOrderStatus(context.Background(), "order-1", domain.OrderStatusPending, domain.OrderStatusCancelled)
+	}
+	svc := newTestReservations(db, newMockCacheRepo(0), now)
+	WithPaymentGateway(gateway)(svc)
+
+	if _, err := svc.Confirm(context.Background(), "order-1", "user-1", "tok_visa"); !errors.Is(err, ErrOrderCancelled) {
+		t.Errorf("expected ErrOrderCancelled, got %v", err)
+	}
+	if gateway.refunded["auth-order-1"] != 500 {
+		t.Errorf("expected the capture refunded, got %v", gateway.refunded)
+	}
+}
+
+func TestConfirm_PaymentRefundedWhenOrderGone(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["order-1"] = domain.Order{ID: "order-1", UserID: "user-1", TotalPrice: 500, Status: domain.OrderStatusPending, ExpiresAt: now.Add(time.Minute)}
+	gateway := newMockGateway()
+	// The order is archived while the payment is in flight
+	gateway.onCapture = func() {
+		db.mu.Lock()
+		delete(db.orders, "order-1")
+		db.mu.Unlock()
+	}
+	svc := newTestReservations(db, newMockCacheRepo(0), now)
+	WithPaymentGateway(gateway)(svc)
+
+	if _, err := svc.Confirm(context.Background(), "order-1", "user-1", "tok_visa"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("expected ErrOrderNotFound, got %v", err)
+	}
+	if gateway.refunded["auth-order-1"] != 500 {
+		t.Errorf("expected the capture refunded, got %v", gateway.refunded)
+	}
+}
+
+// mockOrderEvents records the published order events.
+type mockOrderEvents struct {
+	published []domain.OrderEvent
+}
+
+func (m *mockOrderEvents) PublishOrderEvent(ctx context.Context, event domain.OrderEvent) error {
+	m.published = append(m.published, event)
+	return nil
+}
+
+func (m *mockOrderEvents) WatchOrderEvents(ctx context.Context) (<-chan domain.OrderEvent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestReleaseExpired(t *testing.T) {
+	now := time.Now()
+	db := newMockDatabaseRepo()
+	db.orders["expired"] = domain.Order{ID: "expired", UserID: "user-1", ItemID: "item-1", Quantity: 2, Status: domain.OrderStatusPending, ExpiresAt: now.Add(-time.Second)}
+	db.orders["allocated"] = domain.Order{ID: "allocated", ItemID: "item-1", Quantity: 4, Status: domain.OrderStatusPending, ExpiresAt: now.Add(-time.Second), AllocationID: "alloc-1"}
+	db.orders["held"] = domain.Order{ID: "held", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending, ExpiresAt: now.Add(time.Minute)}
+	db.orders["no-hold"] = domain.Order{ID: "no-hold", ItemID: "item-1", Quantity: 1, Status: domain.OrderStatusPending}
+	cache := newMockCacheRepo(10)
+	events := &mockOrderEvents{}
+	svc := newTestReservations(db, cache, now)
+	WithOrderEvents(events)(svc)
+
+	released, err := svc.ReleaseExpired(context.Background())
+	if err != nil || released != 2 {
+		t.Fatalf("expected 2 released, got %d, %v", released, err)
+	}
+	if cache.stock != 12 {
+		t.Errorf("expected only the consumer order's stock back, got %d", cache.stock)
+	}
+	for id, want := range map[string]domain.OrderStatus{
+		"expired":   domain.OrderStatusExpired,
+		"allocated": domain.OrderStatusExpired,
+		"held":      domain.OrderStatusPending,
+		"no-hold":   domain.OrderStatusPending,
+	} {
+		if got := db.orders[id].Status; got != want {
+			t.Errorf("%s: expected %s, got %s", id, want, got)
+		}
+	}
+
+	if len(events.published) != 2 {
+		t.Fatalf("expected an event per expired order, got %+v", events.published)
+	}
+	for _, event := range events.published {
+		if event.Type != domain.OrderEventExpired || (event.OrderID == "expired" && (event.UserID != "user-1" || event.Quantity != 2)) {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	// Confirming after the sweep reports the expiry
+	if _, err := svc.Confirm(context.Background(), "expired", "user-1", ""); !errors.Is(err, ErrHoldExpired) {
+		t.Errorf("expected ErrHoldExpired, got %v", err)
+	}
+	// Cancelling it again is harmless
+	if order, err := svc.Cancel(context.Background(), "expired", "user-1"); err != nil || order.Status != domain.OrderStatusExpired {
+		t.Errorf("expected the expired order back, got %+v, %v", order, err)
+	}
+}
+
+func TestPurchase_HoldTTL(t *testing.T) {
+	svc := NewOrderService(newMockCacheRepo(10), 10, WithHoldTTL(time.Minute))
+	defer svc.Close()
+
+	if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	order := <-svc.GetOrderQueue()
+	if d := time.Until(order.ExpiresAt); d <= 0 || d > time.Minute {
+		t.Errorf("expected a hold expiring within a minute, got %v", order.ExpiresAt)
+	}
+}
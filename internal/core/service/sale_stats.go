@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// saleRateWindow is how far back the order rate is averaged over.
+const saleRateWindow = 10 * time.Second
+
+// SaleStatsService reports how a campaign's sale is going from the counters
+// the order service and workers keep, and totals the campaign's saved
+// orders from the order read model.
+type SaleStatsService struct {
+	counters port.SaleCounters
+	db       port.DatabaseRepository
+	orders   port.OrderReadModel
+	now      func() time.Time
+}
+
+func NewSaleStatsService(counters port.SaleCounters, db port.DatabaseRepository, orders port.OrderReadModel) *SaleStatsService {
+	return &SaleStatsService{counters: counters, db: db, orders: orders, now: time.Now}
+}
+
+// Stats returns the statistics of a campaign. A campaign that is not in
+// the database, such as the default one, has its counters but is never
+// reported sold out, since its items are unknown.
+func (s *SaleStatsService) Stats(ctx context.Context, campaignID string) (*domain.SaleStats, error) {
+	now := s.now()
+	counters, err := s.counters.SaleCounters(ctx, campaignID, now, saleRateWindow)
+	if err != nil {
+		return nil, fmt.Errorf("read sale counters: %w", err)
+	}
+	campaign, err := s.db.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("get campaign: %w", err)
+	}
+
+	stats := &domain.SaleStats{
+		CampaignID:      campaignID,
+		SaleCounters:    *counters,
+		OrdersPerSecond: float64(counters.RecentOrders) / saleRateWindow.Seconds(),
+	}
+	if campaign == nil || len(campaign.ItemIDs) == 0 {
+		return stats, nil
+	}
+	if stats.Items, err = s.orders.ItemOrderTotals(ctx, campaign.ItemIDs); err != nil {
+		return nil, fmt.Errorf("total orders: %w", err)
+	}
+
+	var last time.Time
+	for _, itemID := range campaign.ItemIDs {
+		at, ok := counters.SoldOutAt[itemID]
+		if !ok {
+			return stats, nil
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	stats.SoldOut = true
+	stats.TimeToSellout = max(last.Sub(saleStart(campaign, counters)), 0)
+	return stats, nil
+}
+
+// saleStart is when the campaign opened, or when its first order was saved
+// if it has no start time.
+func saleStart(campaign *domain.Campaign, counters *domain.SaleCounters) time.Time {
+	if !campaign.StartsAt.IsZero() {
+		return campaign.StartsAt
+	}
+	return counters.StartedAt
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+type mockSaleCounters struct {
+	mu       sync.Mutex
+	counters domain.SaleCounters
+}
+
+func newMockSaleCounters() *mockSaleCounters {
+	return &mockSaleCounters{counters: domain.SaleCounters{
+		Failures:  make(map[string]int64),
+		SoldOutAt: make(map[string]time.Time),
+	}}
+}
+
+func (m *mockSaleCounters) RecordOrders(ctx context.Context, orders, units int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters.Orders += int64(orders)
+	m.counters.RecentOrders += int64(orders)
+	m.counters.SoldUnits += int64(units)
+	if m.counters.StartedAt.IsZero() {
+		m.counters.StartedAt = at
+	}
+	return nil
+}
+
+func (m *mockSaleCounters) RecordFailure(ctx context.Context, outcome string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters.Failures[outcome]++
+	return nil
+}
+
+func (m *mockSaleCounters) RecordSoldOut(ctx context.Context, itemID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.counters.SoldOutAt[itemID]; !ok {
+		m.counters.SoldOutAt[itemID] = at
+	}
+	return nil
+}
+
+func (m *mockSaleCounters) AddQueued(ctx context.Context, delta int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.counters.QueueDepth += int64(delta)
+	return nil
+}
+
+func (m *mockSaleCounters) SaleCounters(ctx context.Context, campaignID string, now time.Time, window time.Duration) (*domain.SaleCounters, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters := m.counters
+	return &counters, nil
+}
+
+func TestSaleStats(t *testing.T) {
+	ctx := context.Background()
+	counters := newMockSaleCounters()
+	db := newMockDatabaseRepo()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db.campaigns["spring"] = domain.Campaign{ID: "spring", ItemIDs: []string{"item-1", "item-2"}, StartsAt: start, EndsAt: start.Add(time.Hour)}
+	db.orders["order-1"] = domain.Order{ID: "order-1", ItemID: "item-1", Quantity: 2, TotalPrice: 500, Status: domain.OrderStatusConfirmed}
+	stats := NewSaleStatsService(counters, db, db)
+
+	counters.RecordOrders(ctx, 50, 60, start.Add(time.Second))
+	counters.RecordSoldOut(ctx, "item-1", start.Add(30*time.Second))
+
+	got, err := stats.Stats(ctx, "spring")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.OrdersPerSecond != 5 || got.SoldUnits != 60 || got.SoldOut {
+		t.Errorf("unexpected stats: %+v", got)
+	}
+	want := domain.ItemOrderTotals{ItemID: "item-1", Status: domain.OrderStatusConfirmed, Orders: 1, Units: 2, Revenue: 500}
+	if len(got.Items) != 1 || got.Items[0] != want {
+		t.Errorf("expected the totals of item-1, got %+v", got.Items)
+	}
+
+	counters.RecordSoldOut(ctx, "item-2", start.Add(90*time.Second))
+	got, _ = stats.Stats(ctx, "spring")
+	if !got.SoldOut || got.TimeToSellout != 90*time.Second {
+		t.Errorf("expected sold out after 90s, got %+v", got)
+	}
+
+	// Without a campaign record the items are unknown
+	got, err = stats.Stats(ctx, "default")
+	if err != nil || got.SoldOut || got.Orders != 50 {
+		t.Errorf("unexpected stats for an unknown campaign: %+v, %v", got, err)
+	}
+}
+
+func TestPurchase_SaleCounters(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(1)
+	counters := newMockSaleCounters()
+	svc := NewOrderService(cache, 100, WithSaleCounters(counters))
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("purchase failed: %v", err)
+	}
+	for _, requestID := range []string{"req-2", "req-3"} {
+		if _, err := svc.Purchase(ctx, requestID, "user-2", "item-1", 1); err == nil {
+			t.Fatal("expected the item to be sold out")
+		}
+	}
+
+	got, _ := counters.SaleCounters(ctx, "default", time.Now(), time.Second)
+	if got.QueueDepth != 1 || got.Failures[OutcomeSoldOut] != 2 || len(got.Failures) != 1 {
+		t.Errorf("unexpected counters: %+v", got)
+	}
+	if _, ok := got.SoldOutAt["item-1"]; !ok {
+		t.Errorf("expected item-1 reported sold out, got %+v", got.SoldOutAt)
+	}
+
+	// The worker takes the order off the queue and counts it saved
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	svc.Close()
+	NewOrderWorker(0, svc.GetOrderQueue(), newMockDatabaseRepo(), cache, tuning, WithWorkerSaleCounters(counters)).Run()
+
+	got, _ = counters.SaleCounters(ctx, "default", time.Now(), time.Second)
+	if got.QueueDepth != 0 || got.Orders != 1 || got.SoldUnits != 1 {
+		t.Errorf("unexpected counters after the worker ran: %+v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Job is background work the Scheduler runs periodically, such as sweeping
+// expired holds or archiving old orders.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Jitter adds up to this much to each wait, so servers started together
+	// do not all run the job at the same moment
+	Jitter time.Duration
+	// LeaderOnly runs the job on one server per interval: the first server
+	// to get to it takes a lock held for most of the interval, and the
+	// others skip their run. A run outlasting the interval may overlap the
+	// next one elsewhere, so the job must still tolerate that
+	LeaderOnly bool
+	Run        func(ctx context.Context) error
+}
+
+// Scheduler runs the registered jobs each on its own interval, logging and
+// counting failed runs instead of stopping the job.
+type Scheduler struct {
+	locker  port.Locker
+	metrics port.JobMetrics
+	jobs    []Job
+}
+
+type SchedulerOption func(*Scheduler)
+
+// WithJobMetrics records the duration and failures of every run.
+func WithJobMetrics(metrics port.JobMetrics) SchedulerOption {
+	return func(s *Scheduler) {
+		s.metrics = metrics
+	}
+}
+
+// NewScheduler elects the server running LeaderOnly jobs through locker.
+func NewScheduler(locker port.Locker, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{locker: locker}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add registers a job. Jobs must be added before Run.
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Run runs every job until ctx is cancelled, the first run of each after
+// at most its jitter, and returns once they have all stopped.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	timer := time.NewTimer(jitter(job.Jitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		s.RunJob(ctx, job)
+		timer.Reset(job.Interval + jitter(job.Jitter))
+	}
+}
+
+// RunJob makes one run of job, reporting false if it was skipped because
+// another server is running it this interval.
+func (s *Scheduler) RunJob(ctx context.Context, job Job) bool {
+	start := time.Now()
+	if job.LeaderOnly {
+		// The lock is left to expire so no other server runs the job until
+		// the next interval
+		_, ok, err := s.locker.TryLock(ctx, "job:"+job.Name, job.Interval-job.Interval/10)
+		if err != nil {
+			log.Printf("job %s: acquire lock: %v", job.Name, err)
+			s.completed(job, start, true)
+			return false
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	err := job.Run(ctx)
+	if err != nil {
+		log.Printf("job %s failed: %v", job.Name, err)
+	}
+	s.completed(job, start, err != nil)
+	return true
+}
+
+func (s *Scheduler) completed(job Job, start time.Time, failed bool) {
+	if s.metrics != nil {
+		s.metrics.JobCompleted(job.Name, time.Since(start), failed)
+	}
+}
+
+func jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
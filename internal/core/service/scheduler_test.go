@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockJobMetrics struct {
+	mu       sync.Mutex
+	runs     map[string]int
+	failures map[string]int
+}
+
+func (m *mockJobMetrics) JobCompleted(job string, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[job]++
+	if failed {
+		m.failures[job]++
+	}
+}
+
+func TestScheduler_LeaderOnly(t *testing.T) {
+	ctx := context.Background()
+	locker := newMockLocker()
+	metrics := &mockJobMetrics{runs: map[string]int{}, failures: map[string]int{}}
+	leader := NewScheduler(locker, WithJobMetrics(metrics))
+	follower := NewScheduler(locker, WithJobMetrics(metrics))
+
+	var runs int
+	job := Job{Name: "sweep", Interval: time.Minute, LeaderOnly: true, Run: func(context.Context) error {
+		runs++
+		return errors.New("database down")
+	}}
+	if !leader.RunJob(ctx, job) {
+		t.Fatal("expected the first server to run the job")
+	}
+	if follower.RunJob(ctx, job) {
+		t.Error("expected another server to skip the job this interval")
+	}
+	if runs != 1 || metrics.runs["sweep"] != 1 || metrics.failures["sweep"] != 1 {
+		t.Errorf("expected one failed run, got %d runs, metrics %v failures %v", runs, metrics.runs, metrics.failures)
+	}
+
+	job.LeaderOnly = false
+	if !follower.RunJob(ctx, job) || runs != 2 {
+		t.Errorf("expected a job for every server to run, got %d runs", runs)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := NewScheduler(newMockLocker())
+
+	var runs atomic.Int32
+	s.Add(Job{Name: "tick", Interval: time.Millisecond, Jitter: time.Millisecond, Run: func(context.Context) error {
+		if runs.Add(1) == 3 {
+			cancel()
+		}
+		return nil
+	}})
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop after cancel")
+	}
+	if got := runs.Load(); got != 3 {
+		t.Errorf("expected 3 runs before cancel, got %d", got)
+	}
+}
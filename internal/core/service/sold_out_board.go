@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// SoldOutBoard remembers on every server which items are sold out, so
+// purchases of them are turned away without a round trip to the cache. The
+// server that sees an item sell out publishes it on the feed, and each
+// board then watches the item's stock and takes it off as soon as units
+// come back, from a rolled back or cancelled order or a restock.
+type SoldOutBoard struct {
+	feed  port.SoldOutFeed
+	stock port.StockFeed
+	cache port.CacheRepository
+
+	mu sync.RWMutex
+	// items holds the sold out items, each with the cancel of its stock watch
+	items map[string]context.CancelFunc
+}
+
+func NewSoldOutBoard(feed port.SoldOutFeed, stock port.StockFeed, cache port.CacheRepository) *SoldOutBoard {
+	return &SoldOutBoard{
+		feed:  feed,
+		stock: stock,
+		cache: cache,
+		items: make(map[string]context.CancelFunc),
+	}
+}
+
+// SoldOut reports whether any of the lines is of an item on the board.
+func (b *SoldOutBoard) SoldOut(lines []domain.OrderItem) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, line := range lines {
+		if _, ok := b.items[line.ItemID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish tells every server's board, this one's included, that the item
+// sold out.
+func (b *SoldOutBoard) Publish(ctx context.Context, itemID string) error {
+	return b.feed.PublishSoldOut(ctx, itemID)
+}
+
+// Run puts items on the board as they are published until ctx is done.
+// Nothing is put on the board while the feed cannot be watched, so
+// purchases go to the cache as usual.
+func (b *SoldOutBoard) Run(ctx context.Context) {
+	items, err := b.feed.WatchSoldOut(ctx)
+	if err != nil {
+		log.Printf("sold out board: watch feed: %v", err)
+		return
+	}
+	for itemID := range items {
+		b.add(ctx, itemID)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for itemID, cancel := range b.items {
+		cancel()
+		delete(b.items, itemID)
+	}
+}
+
+// add puts the item on the board until its stock is seen above zero. The
+// stock is read once the watch has started, so units returned in between
+// are not missed.
+func (b *SoldOutBoard) add(ctx context.Context, itemID string) {
+	b.mu.RLock()
+	_, listed := b.items[itemID]
+	b.mu.RUnlock()
+	if listed {
+		return
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	levels, err := b.stock.WatchStock(watchCtx, itemID)
+	if err != nil {
+		cancel()
+		log.Printf("sold out board: watch stock of %s: %v", itemID, err)
+		return
+	}
+	if stock, err := b.cache.GetStock(ctx, itemID); err != nil || stock > 0 {
+		cancel()
+		return
+	}
+
+	b.mu.Lock()
+	b.items[itemID] = cancel
+	b.mu.Unlock()
+	log.Printf("sold out board: %s sold out", itemID)
+
+	go func() {
+		// A watch that ends for any reason takes the item off, since the
+		// board would no longer hear of it coming back
+		for level := range levels {
+			if level > 0 {
+				break
+			}
+		}
+		cancel()
+		b.remove(itemID)
+	}()
+}
+
+func (b *SoldOutBoard) remove(itemID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.items[itemID]; ok {
+		delete(b.items, itemID)
+		log.Printf("sold out board: %s taken off", itemID)
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockSoldOutFeed delivers published items to its one watcher
+type mockSoldOutFeed struct {
+	items chan string
+}
+
+func (f *mockSoldOutFeed) PublishSoldOut(ctx context.Context, itemID string) error {
+	f.items <- itemID
+	return nil
+}
+
+func (f *mockSoldOutFeed) WatchSoldOut(ctx context.Context) (<-chan string, error) {
+	return f.items, nil
+}
+
+// countingCache counts idempotency checks, which every purchase that
+// reaches the cache makes
+type countingCache struct {
+	*mockCacheRepo
+	checks int
+}
+
+func (c *countingCache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	c.checks++
+	return c.mockCacheRepo.SetIdempotency(ctx, key, ttl)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSoldOutBoard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := &countingCache{mockCacheRepo: newMockCacheRepo(1)}
+	stock := &mockStockFeed{updates: make(chan int, 1)}
+	board := NewSoldOutBoard(&mockSoldOutFeed{items: make(chan string, 1)}, stock, cache)
+	go board.Run(ctx)
+	svc := NewOrderService(cache, 10, WithSoldOutBoard(board))
+	lines := []domain.OrderItem{{ItemID: "item", Quantity: 1}}
+
+	if _, err := svc.Purchase(ctx, "req-1", "user", "item", 1); err != nil {
+		t.Fatalf("purchase: %v", err)
+	}
+	// The purchase turned away by the cache publishes the item
+	if _, err := svc.Purchase(ctx, "req-2", "user", "item", 1); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("purchase of sold out item: %v, want ErrInsufficientStock", err)
+	}
+	waitFor(t, "item on the board", func() bool { return board.SoldOut(lines) })
+
+	checks := cache.checks
+	if _, err := svc.Purchase(ctx, "req-3", "user", "item", 1); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("purchase of item on the board: %v, want ErrInsufficientStock", err)
+	}
+	if cache.checks != checks {
+		t.Error("purchase of item on the board reached the cache")
+	}
+
+	// Units coming back take the item off the board
+	stock.updates <- 1
+	waitFor(t, "item off the board", func() bool { return !board.SoldOut(lines) })
+}
+
+func TestSoldOutBoard_SkipsItemsInStock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed := &mockSoldOutFeed{items: make(chan string)}
+	board := NewSoldOutBoard(feed, &mockStockFeed{updates: make(chan int)}, newMockCacheRepo(3))
+	done := make(chan struct{})
+	go func() {
+		board.Run(ctx)
+		close(done)
+	}()
+
+	// Units returned before the stock watch started keep the item off
+	feed.items <- "item"
+	close(feed.items)
+	<-done
+	if board.SoldOut([]domain.OrderItem{{ItemID: "item", Quantity: 1}}) {
+		t.Error("item with stock put on the board")
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// stockCheckCompensations caps the pending compensations a stock check
+// reads; any beyond it are left out of the expected stock.
+const stockCheckCompensations = 10000
+
+// StockCheck compares the cache stock of items with the database, so a
+// server restarted mid-sale does not sell from a counter that was reset or
+// lost writes. The expected stock is the item's inventory, which workers
+// lower as they save orders, less the units of spooled orders and pending
+// compensations that have not reached the database or the cache yet.
+//
+// Orders queued on other servers are not visible to the check and make the
+// cache look short, so only a cache holding more than expected counts as
+// drift. Lowering such a cache to the expected stock never leaves it short.
+type StockCheck struct {
+	cache         port.CacheRepository
+	db            port.DatabaseRepository
+	spool         port.OrderSpool
+	compensations port.CompensationLog
+}
+
+// NewStockCheck returns a check of cache against db. spool and
+// compensations may be nil when the server keeps neither.
+func NewStockCheck(cache port.CacheRepository, db port.DatabaseRepository, spool port.OrderSpool, compensations port.CompensationLog) *StockCheck {
+	return &StockCheck{cache: cache, db: db, spool: spool, compensations: compensations}
+}
+
+// Check returns the items whose cache stock is above the expected stock.
+// Items not in the database are skipped.
+func (c *StockCheck) Check(ctx context.Context, itemIDs []string) ([]domain.StockDrift, error) {
+	unsaved, err := c.unsaved(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []domain.StockDrift
+	for _, itemID := range itemIDs {
+		inv, err := c.db.GetInventory(port.ReadPrimary(ctx), itemID)
+		if err != nil {
+			return nil, fmt.Errorf("get inventory of %s: %w", itemID, err)
+		}
+		if inv == nil {
+			continue
+		}
+		stock, err := c.cache.GetStock(ctx, itemID)
+		if err != nil {
+			return nil, fmt.Errorf("get stock of %s: %w", itemID, err)
+		}
+
+		drift := domain.StockDrift{ItemID: itemID, Cache: stock, Expected: inv.Quantity - unsaved[itemID]}
+		switch {
+		case drift.Excess() > 0:
+			drifts = append(drifts, drift)
+		case drift.Excess() < 0:
+			log.Printf("stock check: %s has %d units in the cache, %d expected; orders queued on other servers may account for it", itemID, drift.Cache, drift.Expected)
+		}
+	}
+	return drifts, nil
+}
+
+// Correct takes the excess units of each drift off the cache. The change
+// is relative, so purchases made since the check are kept.
+func (c *StockCheck) Correct(ctx context.Context, drifts []domain.StockDrift) error {
+	for _, drift := range drifts {
+		if err := c.cache.IncrementStock(ctx, drift.ItemID, -drift.Excess()); err != nil {
+			return fmt.Errorf("correct stock of %s: %w", drift.ItemID, err)
+		}
+		log.Printf("stock check: took %d excess units of %s off the cache", drift.Excess(), drift.ItemID)
+	}
+	return nil
+}
+
+// unsaved returns, per item, the units the cache has already given out or
+// is still owed that the database does not know about: those of spooled
+// orders and of compensations waiting to be applied.
+func (c *StockCheck) unsaved(ctx context.Context) (map[string]int, error) {
+	unsaved := make(map[string]int)
+	if c.spool != nil {
+		orders, err := c.spool.SpooledOrders(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read spooled orders: %w", err)
+		}
+		for _, order := range orders {
+			for _, line := range order.Lines() {
+				unsaved[line.ItemID] += line.Quantity
+			}
+		}
+	}
+
+	if c.compensations != nil {
+		pending, err := c.compensations.PendingCompensations(ctx, stockCheckCompensations)
+		if err != nil {
+			return nil, fmt.Errorf("read pending compensations: %w", err)
+		}
+		if len(pending) == stockCheckCompensations {
+			log.Printf("stock check: only the oldest %d pending compensations counted", stockCheckCompensations)
+		}
+		for _, compensation := range pending {
+			unsaved[compensation.ItemID] += compensation.Quantity
+		}
+	}
+	return unsaved, nil
+}
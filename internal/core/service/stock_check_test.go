@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+func TestStockCheck(t *testing.T) {
+	ctx := context.Background()
+	db := newMockDatabaseRepo()
+	db.inventory["item"] = domain.Inventory{ItemID: "item", Quantity: 10}
+	spool := &mockSpool{orders: []domain.Order{{ID: "order-1", ItemID: "item", Quantity: 2}}}
+	compensations := newMockCompensationLog()
+	compensations.RecordCompensation(ctx, domain.StockCompensation{ID: "c-1", ItemID: "item", Quantity: 1})
+
+	tests := []struct {
+		name   string
+		cache  int
+		excess int
+	}{
+		// 10 in the database, 2 sold but not saved, 1 owed back to the cache
+		{"matches", 7, 0},
+		{"reset to initial stock", 10, 3},
+		{"short", 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newMockCacheRepo(tt.cache)
+			check := NewStockCheck(cache, db, spool, compensations)
+
+			drifts, err := check.Check(ctx, []string{"item", "unknown"})
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if tt.excess == 0 {
+				if len(drifts) != 0 {
+					t.Errorf("drifts = %+v, want none", drifts)
+				}
+				return
+			}
+			if len(drifts) != 1 || drifts[0].Excess() != tt.excess {
+				t.Fatalf("drifts = %+v, want %d excess units of item", drifts, tt.excess)
+			}
+
+			if err := check.Correct(ctx, drifts); err != nil {
+				t.Fatalf("correct: %v", err)
+			}
+			if cache.stock != 7 {
+				t.Errorf("cache stock after correction = %d, want 7", cache.stock)
+			}
+		})
+	}
+}
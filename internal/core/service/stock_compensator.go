@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+const compensationBatchSize = 100
+
+// StockCompensator returns units to the cache stock counter. Returns that
+// fail are written to a compensation log and retried in the background
+// until they succeed, so a Redis outage cannot permanently lose stock.
+type StockCompensator struct {
+	cache port.CacheRepository
+	log   port.CompensationLog
+}
+
+// NewStockCompensator logs failed returns to compensations for RetryPending.
+// With a nil log, failed returns are only reported to the caller.
+func NewStockCompensator(cache port.CacheRepository, compensations port.CompensationLog) *StockCompensator {
+	return &StockCompensator{cache: cache, log: compensations}
+}
+
+// Restore returns quantity units of an item to the cache. If that fails the
+// units are logged for the retrier; the error is only returned when they
+// could not be logged either, meaning they are lost.
+func (c *StockCompensator) Restore(ctx context.Context, itemID string, quantity int, reason string) error {
+	err := c.cache.IncrementStock(ctx, itemID, quantity)
+	if err == nil || c.log == nil {
+		return err
+	}
+
+	now := time.Now()
+	compensation := domain.StockCompensation{
+		ID:        uuid.New().String(),
+		ItemID:    itemID,
+		Quantity:  quantity,
+		Reason:    reason,
+		Attempts:  1,
+		LastError: err.Error(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if logErr := c.log.RecordCompensation(context.WithoutCancel(ctx), compensation); logErr != nil {
+		return fmt.Errorf("%w (recording compensation failed: %v)", err, logErr)
+	}
+	log.Printf("compensation %s: returning %d x %s failed, will retry: %v", compensation.ID, quantity, itemID, err)
+	return nil
+}
+
+// Schedule logs quantity units for the retrier to apply to the cache without
+// trying the cache first, for when it is known to be down. A negative
+// quantity takes units off the cache stock counter.
+func (c *StockCompensator) Schedule(ctx context.Context, itemID string, quantity int, reason string) error {
+	if c.log == nil {
+		return errors.New("no compensation log")
+	}
+
+	now := time.Now()
+	compensation := domain.StockCompensation{
+		ID:        uuid.New().String(),
+		ItemID:    itemID,
+		Quantity:  quantity,
+		Reason:    reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := c.log.RecordCompensation(ctx, compensation); err != nil {
+		return fmt.Errorf("record compensation: %w", err)
+	}
+	return nil
+}
+
+// RestoreOrder returns the units of every line of an order, as Restore.
+func (c *StockCompensator) RestoreOrder(ctx context.Context, order domain.Order, reason string) error {
+	var errs []error
+	for _, line := range order.Lines() {
+		if err := c.Restore(ctx, line.ItemID, line.Quantity, reason); err != nil {
+			errs = append(errs, fmt.Errorf("%d x %s: %w", line.Quantity, line.ItemID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RetryPending makes one pass over the logged compensations and returns how
+// many it applied. Each is resolved before its units are returned, so two
+// servers retrying at once never return the same units twice.
+func (c *StockCompensator) RetryPending(ctx context.Context) (int, error) {
+	if c.log == nil {
+		return 0, nil
+	}
+
+	pending, err := c.log.PendingCompensations(ctx, compensationBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("list compensations: %w", err)
+	}
+
+	applied := 0
+	for _, compensation := range pending {
+		claimed, err := c.log.ResolveCompensation(ctx, compensation.ID, time.Now())
+		if err != nil {
+			return applied, fmt.Errorf("resolve compensation %s: %w", compensation.ID, err)
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := c.cache.IncrementStock(ctx, compensation.ItemID, compensation.Quantity); err != nil {
+			if reopenErr := c.log.ReopenCompensation(context.WithoutCancel(ctx), compensation.ID, err.Error(), time.Now()); reopenErr != nil {
+				log.Printf("CRITICAL compensation %s: %d x %s lost: %v (reopen failed: %v)",
+					compensation.ID, compensation.Quantity, compensation.ItemID, err, reopenErr)
+			}
+			continue
+		}
+		log.Printf("compensation %s: returned %d x %s after %d failed attempts",
+			compensation.ID, compensation.Quantity, compensation.ItemID, compensation.Attempts)
+		applied++
+	}
+	return applied, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// flakyCache fails IncrementStock while down is set
+type flakyCache struct {
+	*mockCacheRepo
+	down bool
+}
+
+func (f *flakyCache) IncrementStock(ctx context.Context, itemID string, quantity int) error {
+	if f.down {
+		return errors.New("connection refused")
+	}
+	return f.mockCacheRepo.IncrementStock(ctx, itemID, quantity)
+}
+
+// mockCompensationLog keeps compensations in memory
+type mockCompensationLog struct {
+	entries  []domain.StockCompensation
+	resolved map[string]bool
+	mu       sync.Mutex
+}
+
+func newMockCompensationLog() *mockCompensationLog {
+	return &mockCompensationLog{resolved: make(map[string]bool)}
+}
+
+func (m *mockCompensationLog) RecordCompensation(ctx context.Context, c domain.StockCompensation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, c)
+	return nil
+}
+
+func (m *mockCompensationLog) PendingCompensations(ctx context.Context, limit int) ([]domain.StockCompensation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []domain.StockCompensation
+	for _, c := range m.entries {
+		if !m.resolved[c.ID] && len(pending) < limit {
+			pending = append(pending, c)
+		}
+	}
+	return pending, nil
+}
+
+func (m *mockCompensationLog) ResolveCompensation(ctx context.Context, id string, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.resolved[id] {
+		return false, nil
+	}
+	m.resolved[id] = true
+	return true, nil
+}
+
+func (m *mockCompensationLog) ReopenCompensation(ctx context.Context, id, lastError string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.resolved, id)
+	for i := range m.entries {
+		if m.entries[i].ID == id {
+			m.entries[i].Attempts++
+			m.entries[i].LastError = lastError
+		}
+	}
+	return nil
+}
+
+func TestStockCompensator_RetriesUntilRestored(t *testing.T) {
+	cache := &flakyCache{mockCacheRepo: newMockCacheRepo(5), down: true}
+	compensations := newMockCompensationLog()
+	c := NewStockCompensator(cache, compensations)
+	ctx := context.Background()
+
+	if err := c.Restore(ctx, "item-1", 2, "order-1"); err != nil {
+		t.Fatalf("expected the failure to be logged, got: %v", err)
+	}
+	if len(compensations.entries) != 1 || compensations.entries[0].Quantity != 2 {
+		t.Fatalf("unexpected compensations: %+v", compensations.entries)
+	}
+
+	// Still down: the compensation stays pending with another attempt counted
+	if n, err := c.RetryPending(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing applied, got %d, %v", n, err)
+	}
+	if compensations.entries[0].Attempts != 2 || compensations.resolved[compensations.entries[0].ID] {
+		t.Errorf("expected a pending compensation with 2 attempts, got %+v", compensations.entries[0])
+	}
+
+	cache.down = false
+	if n, err := c.RetryPending(ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 applied, got %d, %v", n, err)
+	}
+	if cache.stock != 7 {
+		t.Errorf("expected stock 7, got %d", cache.stock)
+	}
+
+	// Applied compensations are not applied again
+	if n, _ := c.RetryPending(ctx); n != 0 || cache.stock != 7 {
+		t.Errorf("expected no further returns, got %d applied and stock %d", n, cache.stock)
+	}
+}
+
+func TestStockCompensator_WithoutLog(t *testing.T) {
+	cache := &flakyCache{mockCacheRepo: newMockCacheRepo(5), down: true}
+	c := NewStockCompensator(cache, nil)
+
+	if err := c.Restore(context.Background(), "item-1", 2, "order-1"); err == nil {
+		t.Error("expected the failure to be returned")
+	}
+}
+
+func TestOrderWorker_RollbackFailureIsCompensated(t *testing.T) {
+	cache := &flakyCache{mockCacheRepo: newMockCacheRepo(5), down: true}
+	db := newMockDatabaseRepo()
+	db.failOrders = 10
+	compensations := newMockCompensationLog()
+	compensator := NewStockCompensator(cache, compensations)
+
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	queue := make(chan domain.Order, 1)
+	queue <- domain.Order{ID: "order-1", ItemID: "item-1", Quantity: 3}
+	close(queue)
+	NewOrderWorker(0, queue, db, cache, tuning, WithWorkerCompensator(compensator)).Run()
+
+	if len(compensations.entries) != 1 || compensations.entries[0].Reason != "order order-1" {
+		t.Fatalf("unexpected compensations: %+v", compensations.entries)
+	}
+
+	cache.down = false
+	compensator.RetryPending(context.Background())
+	if cache.stock != 8 {
+		t.Errorf("expected stock 8, got %d", cache.stock)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// StockService lets clients follow an item's stock level live.
+type StockService struct {
+	cache port.CacheRepository
+	feed  port.StockFeed
+
+	// shutdown ends every watch on Close so long-lived streams do not hold
+	// up a graceful shutdown.
+	shutdown context.Context
+	cancel   context.CancelFunc
+}
+
+func NewStockService(cache port.CacheRepository, feed port.StockFeed) *StockService {
+	shutdown, cancel := context.WithCancel(context.Background())
+	return &StockService{cache: cache, feed: feed, shutdown: shutdown, cancel: cancel}
+}
+
+// Watch delivers the current stock level of an item followed by every
+// change, until ctx is done or the service is closed. Levels a slow receiver
+// has not yet read are replaced by newer ones.
+func (s *StockService) Watch(ctx context.Context, itemID string) (<-chan int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.shutdown, cancel)
+
+	// Subscribe before reading the level so no change falls in between
+	updates, err := s.feed.WatchStock(ctx, itemID)
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+	current, err := s.cache.GetStock(ctx, itemID)
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+
+	levels := make(chan int, 1)
+	levels <- current
+	go func() {
+		defer close(levels)
+		defer stop()
+		defer cancel()
+		for level := range updates {
+			select {
+			case <-levels:
+			default:
+			}
+			levels <- level
+		}
+	}()
+
+	return levels, nil
+}
+
+// Close ends all active watches.
+func (s *StockService) Close() {
+	s.cancel()
+}
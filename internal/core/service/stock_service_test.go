@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// mockStockFeed hands out a single updates channel
+type mockStockFeed struct {
+	updates chan int
+}
+
+func (f *mockStockFeed) WatchStock(ctx context.Context, itemID string) (<-chan int, error) {
+	return f.updates, nil
+}
+
+func receiveLevel(t *testing.T, levels <-chan int) int {
+	t.Helper()
+	select {
+	case level, ok := <-levels:
+		if !ok {
+			t.Fatal("levels closed")
+		}
+		return level
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for stock level")
+		return 0
+	}
+}
+
+func TestStockService_Watch(t *testing.T) {
+	feed := &mockStockFeed{updates: make(chan int)}
+	svc := NewStockService(newMockCacheRepo(10), feed)
+
+	levels, err := svc.Watch(context.Background(), "item-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if level := receiveLevel(t, levels); level != 10 {
+		t.Errorf("expected current level 10 first, got %d", level)
+	}
+	feed.updates <- 9
+	if level := receiveLevel(t, levels); level != 9 {
+		t.Errorf("expected update 9, got %d", level)
+	}
+
+	// A slow receiver only sees the latest level
+	feed.updates <- 8
+	feed.updates <- 7
+	time.Sleep(10 * time.Millisecond)
+	if level := receiveLevel(t, levels); level != 7 {
+		t.Errorf("expected latest level 7, got %d", level)
+	}
+
+	close(feed.updates)
+	select {
+	case _, ok := <-levels:
+		if ok {
+			t.Error("expected levels to close with the feed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("levels not closed")
+	}
+}
+
+func TestStockService_CloseEndsWatches(t *testing.T) {
+	var watchCtx context.Context
+	feed := &ctxFeed{onWatch: func(ctx context.Context) { watchCtx = ctx }}
+	svc := NewStockService(newMockCacheRepo(10), feed)
+
+	if _, err := svc.Watch(context.Background(), "item-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.Close()
+
+	select {
+	case <-watchCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Close did not cancel the feed subscription")
+	}
+}
+
+// ctxFeed closes its updates when the watch context ends, like the real feeds
+type ctxFeed struct {
+	onWatch func(ctx context.Context)
+}
+
+func (f *ctxFeed) WatchStock(ctx context.Context, itemID string) (<-chan int, error) {
+	f.onWatch(ctx)
+	updates := make(chan int)
+	context.AfterFunc(ctx, func() { close(updates) })
+	return updates, nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// TenantScope limits the items, campaigns, inventory and orders a request
+// sees to those of the tenant it was made for, the one port.WithTenant
+// marked its context with, so merchants sharing a database cannot read or
+// change each other's sales. Rows created in a tenant's context are stamped
+// with the tenant, and those of other tenants read as not found. Updates
+// never move a row to another tenant. Work with no tenant in its context,
+// such as the workers and scheduled jobs, passes straight through.
+//
+// The order lists are narrowed by the repository itself, so pages stay
+// full; TenantScope guards the reads and writes of single rows.
+//
+// Item and campaign IDs stay unique across the deployment; a tenant cannot
+// create an item with the ID of another tenant's.
+type TenantScope struct {
+	port.DatabaseRepository
+}
+
+// NewTenantScope scopes db to the tenant of each call's context.
+func NewTenantScope(db port.DatabaseRepository) *TenantScope {
+	return &TenantScope{DatabaseRepository: db}
+}
+
+func (t *TenantScope) CreateItem(ctx context.Context, item domain.Item) (bool, error) {
+	if tenant, ok := port.TenantOf(ctx); ok {
+		item.TenantID = tenant
+	}
+	return t.DatabaseRepository.CreateItem(ctx, item)
+}
+
+func (t *TenantScope) GetItem(ctx context.Context, id string) (*domain.Item, error) {
+	item, err := t.DatabaseRepository.GetItem(ctx, id)
+	if err != nil || item == nil || !visible(ctx, item.TenantID) {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (t *TenantScope) ListItems(ctx context.Context) ([]domain.Item, error) {
+	items, err := t.DatabaseRepository.ListItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ownedBy(ctx, items, func(item domain.Item) string { return item.TenantID }), nil
+}
+
+func (t *TenantScope) UpdateItem(ctx context.Context, item domain.Item) (bool, error) {
+	current, err := t.GetItem(port.ReadPrimary(ctx), item.ID)
+	if err != nil || current == nil {
+		return false, err
+	}
+	item.TenantID = current.TenantID
+	return t.DatabaseRepository.UpdateItem(ctx, item)
+}
+
+func (t *TenantScope) CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	if tenant, ok := port.TenantOf(ctx); ok {
+		campaign.TenantID = tenant
+	}
+	return t.DatabaseRepository.CreateCampaign(ctx, campaign)
+}
+
+func (t *TenantScope) GetCampaign(ctx context.Context, id string) (*domain.Campaign, error) {
+	campaign, err := t.DatabaseRepository.GetCampaign(ctx, id)
+	if err != nil || campaign == nil || !visible(ctx, campaign.TenantID) {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+func (t *TenantScope) ListCampaigns(ctx context.Context) ([]domain.Campaign, error) {
+	campaigns, err := t.DatabaseRepository.ListCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ownedBy(ctx, campaigns, func(campaign domain.Campaign) string { return campaign.TenantID }), nil
+}
+
+func (t *TenantScope) UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error) {
+	current, err := t.GetCampaign(port.ReadPrimary(ctx), campaign.ID)
+	if err != nil || current == nil {
+		return false, err
+	}
+	campaign.TenantID = current.TenantID
+	return t.DatabaseRepository.UpdateCampaign(ctx, campaign)
+}
+
+func (t *TenantScope) GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error) {
+	inv, err := t.DatabaseRepository.GetInventory(ctx, itemID)
+	if err != nil || inv == nil || !visible(ctx, inv.TenantID) {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// UpdateInventory and RestockInventory check the row's tenant on the
+// primary rather than trusting the one inv carries.
+func (t *TenantScope) UpdateInventory(ctx context.Context, inv domain.Inventory) error {
+	if err := t.ownsInventory(ctx, inv.ItemID); err != nil {
+		return err
+	}
+	return t.DatabaseRepository.UpdateInventory(ctx, inv)
+}
+
+func (t *TenantScope) RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error {
+	if err := t.ownsInventory(ctx, inv.ItemID); err != nil {
+		return err
+	}
+	return t.DatabaseRepository.RestockInventory(ctx, inv, restock)
+}
+
+func (t *TenantScope) ownsInventory(ctx context.Context, itemID string) error {
+	if _, ok := port.TenantOf(ctx); !ok {
+		return nil
+	}
+	inv, err := t.GetInventory(port.ReadPrimary(ctx), itemID)
+	if err != nil {
+		return err
+	}
+	if inv == nil {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+func (t *TenantScope) CreateOrder(ctx context.Context, order domain.Order) error {
+	return t.CreateOrders(ctx, []domain.Order{order})
+}
+
+func (t *TenantScope) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	if tenant, ok := port.TenantOf(ctx); ok {
+		orders = slices.Clone(orders)
+		for i := range orders {
+			orders[i].TenantID = tenant
+		}
+	}
+	return t.DatabaseRepository.CreateOrders(ctx, orders)
+}
+
+func (t *TenantScope) GetOrder(ctx context.Context, id string) (*domain.Order, error) {
+	order, err := t.DatabaseRepository.GetOrder(ctx, id)
+	if err != nil || order == nil || !visible(ctx, order.TenantID) {
+		return nil, err
+	}
+	return order, nil
+}
+
+// UpdateOrderStatus and ConfirmOrder leave another tenant's order alone, as
+// if it were not in the status the change expects.
+func (t *TenantScope) UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error) {
+	if ok, err := t.ownsOrder(ctx, id); !ok {
+		return false, err
+	}
+	return t.DatabaseRepository.UpdateOrderStatus(ctx, id, from, to)
+}
+
+func (t *TenantScope) ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error) {
+	if ok, err := t.ownsOrder(ctx, id); !ok {
+		return false, err
+	}
+	return t.DatabaseRepository.ConfirmOrder(ctx, id, paymentID)
+}
+
+func (t *TenantScope) ownsOrder(ctx context.Context, id string) (bool, error) {
+	if _, ok := port.TenantOf(ctx); !ok {
+		return true, nil
+	}
+	order, err := t.GetOrder(port.ReadPrimary(ctx), id)
+	return order != nil, err
+}
+
+// visible reports whether a row of tenant may be seen in ctx.
+func visible(ctx context.Context, tenant string) bool {
+	scoped, ok := port.TenantOf(ctx)
+	return !ok || scoped == tenant
+}
+
+// ownedBy returns the rows visible in ctx, reusing the backing array.
+func ownedBy[T any](ctx context.Context, rows []T, tenantOf func(T) string) []T {
+	if _, ok := port.TenantOf(ctx); !ok {
+		return rows
+	}
+	owned := rows[:0]
+	for _, row := range rows {
+		if visible(ctx, tenantOf(row)) {
+			owned = append(owned, row)
+		}
+	}
+	return owned
+}
+
+// ItemTenants tells which tenant owns an item, for keying work done on an
+// item outside any request, such as stock lease renewals. An item never
+// moves to another tenant, so each owner is read from the database once.
+type ItemTenants struct {
+	db     port.DatabaseRepository
+	owners sync.Map // item ID -> tenant
+}
+
+func NewItemTenants(db port.DatabaseRepository) *ItemTenants {
+	return &ItemTenants{db: db}
+}
+
+// TenantOf returns the tenant owning the item. Items that cannot be read,
+// or do not exist yet, are the default tenant's until they can.
+func (t *ItemTenants) TenantOf(ctx context.Context, itemID string) string {
+	if tenant, ok := t.owners.Load(itemID); ok {
+		return tenant.(string)
+	}
+	item, err := t.db.GetItem(port.ReadPrimary(context.WithoutCancel(ctx)), itemID)
+	if err != nil {
+		log.Printf("tenant of item %s: %v", itemID, err)
+		return ""
+	}
+	if item == nil {
+		return ""
+	}
+	t.owners.Store(itemID, item.TenantID)
+	return item.TenantID
+}
+
+// byTenant groups orders by the tenant they belong to, for the counters each
+// tenant keeps of its own sale.
+func byTenant(orders []domain.Order) map[string][]domain.Order {
+	groups := make(map[string][]domain.Order)
+	for _, order := range orders {
+		groups[order.TenantID] = append(groups[order.TenantID], order)
+	}
+	return groups
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+func TestTenantScope(t *testing.T) {
+	acme, globex := port.WithTenant(context.Background(), "acme"), port.WithTenant(context.Background(), "globex")
+	db := newMockDatabaseRepo()
+	scope := NewTenantScope(db)
+	items := NewInventoryService(newMockCacheRepo(0), scope, newMockLocker())
+	campaigns := NewCampaignService(&mockKeyspace{}, scope, "")
+
+	if _, err := items.CreateItem(acme, domain.Item{ID: "anvil", Name: "Anvil", Stock: 5}); err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if db.items["anvil"].TenantID != "acme" {
+		t.Errorf("item tenant = %q, want acme", db.items["anvil"].TenantID)
+	}
+
+	if _, err := items.GetItem(globex, "anvil"); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("other tenant's item: %v, want ErrItemNotFound", err)
+	}
+	if items, _ := items.ListItems(globex); len(items) != 0 {
+		t.Errorf("other tenant listed %+v", items)
+	}
+	if _, err := items.UpdateItem(globex, domain.Item{ID: "anvil", Name: "Stolen"}); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("update of other tenant's item: %v, want ErrItemNotFound", err)
+	}
+	if _, err := items.Restock(globex, "anvil", 10, "", ""); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("restock of other tenant's item: %v, want ErrItemNotFound", err)
+	}
+	if _, err := items.CreateItem(globex, domain.Item{ID: "anvil", Name: "Anvil"}); !errors.Is(err, ErrItemExists) {
+		t.Errorf("item with a taken ID: %v, want ErrItemExists", err)
+	}
+
+	updated, err := items.UpdateItem(acme, domain.Item{ID: "anvil", Name: "Heavy anvil"})
+	if err != nil {
+		t.Fatalf("update item: %v", err)
+	}
+	if updated.TenantID != "acme" || updated.Name != "Heavy anvil" {
+		t.Errorf("updated item = %+v", updated)
+	}
+
+	campaign := domain.Campaign{ID: "spring", ItemIDs: []string{"anvil"}, StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}
+	if _, err := campaigns.CreateCampaign(globex, campaign); !errors.Is(err, ErrInvalidCampaign) {
+		t.Errorf("campaign of other tenant's item: %v, want ErrInvalidCampaign", err)
+	}
+	if _, err := campaigns.CreateCampaign(acme, campaign); err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+	if _, err := campaigns.GetCampaign(globex, "spring"); !errors.Is(err, ErrCampaignNotFound) {
+		t.Errorf("other tenant's campaign: %v, want ErrCampaignNotFound", err)
+	}
+	if campaigns, _ := campaigns.ListCampaigns(acme); len(campaigns) != 1 || campaigns[0].TenantID != "acme" {
+		t.Errorf("campaigns = %+v, want spring of acme", campaigns)
+	}
+	if campaigns, _ := campaigns.ListCampaigns(context.Background()); len(campaigns) != 1 {
+		t.Errorf("unscoped campaigns = %+v, want spring", campaigns)
+	}
+}
+
+func TestTenantScope_InventoryAndOrders(t *testing.T) {
+	acme, globex := port.WithTenant(context.Background(), "acme"), port.WithTenant(context.Background(), "globex")
+	db := newMockDatabaseRepo()
+	db.items["anvil"] = domain.Item{ID: "anvil", TenantID: "acme"}
+	db.inventory["anvil"] = domain.Inventory{ItemID: "anvil", TenantID: "acme", Quantity: 5}
+	scope := NewTenantScope(db)
+
+	if inv, err := scope.GetInventory(globex, "anvil"); err != nil || inv != nil {
+		t.Errorf("other tenant's inventory = %+v, %v; want none", inv, err)
+	}
+	if inv, _ := scope.GetInventory(acme, "anvil"); inv == nil {
+		t.Error("own inventory not found")
+	}
+	if err := scope.UpdateInventory(globex, domain.Inventory{ItemID: "anvil", Quantity: 0}); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("update of other tenant's inventory: %v, want ErrItemNotFound", err)
+	}
+
+	if err := scope.CreateOrder(acme, domain.Order{ID: "o1", TenantID: "globex", ItemID: "anvil", Status: domain.OrderStatusPending}); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if db.orders["o1"].TenantID != "acme" {
+		t.Errorf("order tenant = %q, want acme", db.orders["o1"].TenantID)
+	}
+	if order, _ := scope.GetOrder(globex, "o1"); order != nil {
+		t.Errorf("other tenant read order %+v", order)
+	}
+	if ok, _ := scope.ConfirmOrder(globex, "o1", "pay-1"); ok {
+		t.Error("other tenant confirmed the order")
+	}
+	if ok, _ := scope.UpdateOrderStatus(globex, "o1", domain.OrderStatusPending, domain.OrderStatusCancelled); ok {
+		t.Error("other tenant cancelled the order")
+	}
+	if ok, err := scope.ConfirmOrder(acme, "o1", "pay-1"); !ok || err != nil {
+		t.Errorf("confirm own order: %v, %v", ok, err)
+	}
+	// Workers run with no tenant and reach every tenant's orders
+	if order, _ := scope.GetOrder(context.Background(), "o1"); order == nil || order.Status != domain.OrderStatusConfirmed {
+		t.Errorf("unscoped order = %+v, want confirmed", order)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+var ErrInvalidTier = errors.New("invalid tier")
+
+// TierService manages user tiers. Like the Catalog, purchases read tiers
+// from a snapshot reloaded every interval, so a change made on another
+// server reaches purchases within one interval.
+type TierService struct {
+	db       port.UserTierRepository
+	interval time.Duration
+	tiers    atomic.Pointer[map[string]domain.UserTier]
+}
+
+func NewTierService(db port.UserTierRepository, interval time.Duration) *TierService {
+	s := &TierService{db: db, interval: interval}
+	s.tiers.Store(&map[string]domain.UserTier{})
+	return s
+}
+
+// Run refreshes the snapshot every interval until ctx is done, keeping the
+// last snapshot when a refresh fails.
+func (s *TierService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := s.Refresh(ctx); err != nil {
+			log.Printf("tier refresh failed: %v", err)
+		}
+	}
+}
+
+// Refresh replaces the snapshot with the tiers currently in the database.
+func (s *TierService) Refresh(ctx context.Context) error {
+	tiers, err := s.db.ListUserTiers(ctx)
+	if err != nil {
+		return fmt.Errorf("list user tiers: %w", err)
+	}
+	s.tiers.Store(&tiers)
+	return nil
+}
+
+// SetTier records a user's tier. It applies on this server right away and
+// on others after their next refresh.
+func (s *TierService) SetTier(ctx context.Context, userID string, tier domain.UserTier) error {
+	if userID == "" || !tier.Valid() {
+		return fmt.Errorf("%w: tier must be %q or %q", ErrInvalidTier, domain.TierNormal, domain.TierVIP)
+	}
+	if err := s.db.SetUserTier(ctx, userID, tier); err != nil {
+		return fmt.Errorf("set user tier: %w", err)
+	}
+
+	for {
+		old := s.tiers.Load()
+		snapshot := maps.Clone(*old)
+		if snapshot == nil {
+			snapshot = make(map[string]domain.UserTier)
+		}
+		if tier == domain.TierNormal {
+			delete(snapshot, userID)
+		} else {
+			snapshot[userID] = tier
+		}
+		if s.tiers.CompareAndSwap(old, &snapshot) {
+			return nil
+		}
+	}
+}
+
+// Tiers returns the users in the snapshot who are not TierNormal.
+func (s *TierService) Tiers() map[string]domain.UserTier {
+	return maps.Clone(*s.tiers.Load())
+}
+
+// Tier returns the user's tier.
+func (s *TierService) Tier(userID string) domain.UserTier {
+	if tier, ok := (*s.tiers.Load())[userID]; ok {
+		return tier
+	}
+	return domain.TierNormal
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// mockTiers stores the tiers of users who are not normal
+type mockTiers struct {
+	tiers map[string]domain.UserTier
+	mu    sync.Mutex
+}
+
+func (m *mockTiers) SetUserTier(ctx context.Context, userID string, tier domain.UserTier) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tier == domain.TierNormal {
+		delete(m.tiers, userID)
+	} else {
+		m.tiers[userID] = tier
+	}
+	return nil
+}
+
+func (m *mockTiers) ListUserTiers(ctx context.Context) (map[string]domain.UserTier, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.tiers), nil
+}
+
+func newTestTiers(t *testing.T, vips ...string) *TierService {
+	t.Helper()
+	db := &mockTiers{tiers: make(map[string]domain.UserTier)}
+	for _, userID := range vips {
+		db.tiers[userID] = domain.TierVIP
+	}
+	tiers := NewTierService(db, time.Minute)
+	if err := tiers.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tiers
+}
+
+func TestTierService_SetTier(t *testing.T) {
+	ctx := context.Background()
+	tiers := newTestTiers(t, "user-1")
+
+	if tiers.Tier("user-1") != domain.TierVIP || tiers.Tier("user-2") != domain.TierNormal {
+		t.Fatalf("unexpected tiers: %v", tiers.Tiers())
+	}
+	if err := tiers.SetTier(ctx, "user-2", "gold"); !errors.Is(err, ErrInvalidTier) {
+		t.Errorf("expected ErrInvalidTier, got %v", err)
+	}
+
+	// Changes apply without waiting for a refresh
+	if err := tiers.SetTier(ctx, "user-2", domain.TierVIP); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tiers.SetTier(ctx, "user-1", domain.TierNormal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := tiers.Tiers(); len(got) != 1 || got["user-2"] != domain.TierVIP {
+		t.Errorf("expected only user-2 to be VIP, got %v", got)
+	}
+}
+
+func TestOrderService_VIPPriority(t *testing.T) {
+	ctx := context.Background()
+	svc := NewOrderService(newMockCacheRepo(10), 10, WithUserTiers(newTestTiers(t, "vip")), WithVIPPriority())
+	defer svc.Close()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-2", "vip", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	priority := svc.PriorityQueues()
+	if len(priority) != 1 || len(priority[0]) != 1 || len(svc.GetOrderQueue()) != 1 {
+		t.Fatalf("expected one order in each queue, got %d and %d", len(priority[0]), len(svc.GetOrderQueue()))
+	}
+	if order := <-priority[0]; order.UserID != "vip" || order.Tier != domain.TierVIP {
+		t.Errorf("expected the VIP order in the priority queue, got %+v", order)
+	}
+	if svc.QueueCapacity() != 20 {
+		t.Errorf("expected capacity of both queues, got %d", svc.QueueCapacity())
+	}
+}
+
+func TestOrderService_VIPReserve(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockCacheRepo(4)
+	svc := NewOrderService(cache, 10,
+		WithUserTiers(newTestTiers(t, "vip")),
+		WithVIPReserve(cache, map[string]int{"item-1": 2}),
+	)
+	defer svc.Close()
+
+	if _, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A cart is given back whole when a line would reach the reserve
+	_, err := svc.PurchaseCart(ctx, "req-2", "user-2", []domain.OrderItem{{ItemID: "item-2", Quantity: 1}, {ItemID: "item-1", Quantity: 1}})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock, got %v", err)
+	}
+	if cache.stock != 3 {
+		t.Errorf("expected the cart's stock returned, got %d", cache.stock)
+	}
+
+	if _, err := svc.Purchase(ctx, "req-3", "user-3", "item-1", 2); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("expected the reserve to be kept from normal users, got %v", err)
+	}
+	if _, err := svc.Purchase(ctx, "req-4", "vip", "item-1", 3); err != nil {
+		t.Errorf("expected a VIP to buy into the reserve, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// Stages of a purchase with their own deadline, as reported to
+// port.Metrics.StageTimedOut.
+const (
+	StageIdempotency = "idempotency"
+	StageDecrement   = "decrement"
+	StageEnqueue     = "enqueue"
+	StagePersist     = "persist"
+)
+
+// ErrStageTimeout is an ErrOverloaded returned when a stage of a purchase
+// misses its deadline. Like any failure of the stage, the call that timed
+// out may still have taken effect.
+var ErrStageTimeout = fmt.Errorf("%w: deadline exceeded", ErrOverloaded)
+
+// StageTimeouts bounds how long each dependency call of a purchase may
+// take, on top of the caller's context. 0 leaves a stage bounded by the
+// caller's context alone. How long a purchase waits for room in the order
+// queue is set with WithEnqueueTimeout.
+type StageTimeouts struct {
+	// Idempotency bounds claiming the request's idempotency key.
+	Idempotency time.Duration
+	// Decrement bounds taking the stock of the order.
+	Decrement time.Duration
+	// Persist bounds each database write of the order workers.
+	Persist time.Duration
+}
+
+func DefaultStageTimeouts() StageTimeouts {
+	return StageTimeouts{
+		Idempotency: time.Second,
+		Decrement:   time.Second,
+		Persist:     5 * time.Second,
+	}
+}
+
+func (t StageTimeouts) Validate() error {
+	if t.Idempotency < 0 || t.Decrement < 0 || t.Persist < 0 {
+		return errors.New("stage timeouts must not be negative")
+	}
+	return nil
+}
+
+// stageContext bounds ctx by timeout, if it is set.
+func stageContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// stageError turns err, returned by a stage run under stageCtx, into an
+// ErrStageTimeout and counts it in metrics when the stage's own deadline
+// passed rather than the caller's.
+func stageError(ctx, stageCtx context.Context, metrics port.Metrics, stage string, err error) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	metrics.StageTimedOut(stage)
+	return fmt.Errorf("%w: %s: %w", ErrStageTimeout, stage, err)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// stallingCache blocks the calls of the stalled stage until their context
+// is done.
+type stallingCache struct {
+	*mockCacheRepo
+	stalled atomic.Value // stage name
+}
+
+func (c *stallingCache) stall(ctx context.Context, stage string) error {
+	if c.stalled.Load() != stage {
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (c *stallingCache) SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if err := c.stall(ctx, StageIdempotency); err != nil {
+		return false, err
+	}
+	return c.mockCacheRepo.SetIdempotency(ctx, key, ttl)
+}
+
+func (c *stallingCache) DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error) {
+	if err := c.stall(ctx, StageDecrement); err != nil {
+		return 0, err
+	}
+	return c.mockCacheRepo.DecrementStock(ctx, itemID, quantity)
+}
+
+func TestPurchase_StageTimeouts(t *testing.T) {
+	timeouts := StageTimeouts{Idempotency: 10 * time.Millisecond, Decrement: 10 * time.Millisecond}
+
+	for _, stage := range []string{StageIdempotency, StageDecrement} {
+		t.Run(stage, func(t *testing.T) {
+			cache := &stallingCache{mockCacheRepo: newMockCacheRepo(5)}
+			cache.stalled.Store(stage)
+			m := &recordingMetrics{outcomes: make(map[string]int)}
+			svc := NewOrderService(cache, 10, WithStageTimeouts(timeouts), WithMetrics(m))
+			defer svc.Close()
+
+			_, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+			if !errors.Is(err, ErrStageTimeout) || !errors.Is(err, ErrOverloaded) {
+				t.Fatalf("expected a stage timeout, got %v", err)
+			}
+			if m.timeouts[stage] != 1 || m.outcomes[OutcomeTimeout] != 1 {
+				t.Errorf("expected the timeout counted, got timeouts %v and outcomes %v", m.timeouts, m.outcomes)
+			}
+
+			if stage == StageDecrement {
+				// The key is released, so the purchase can be retried
+				cache.stalled.Store("")
+				if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1); err != nil {
+					t.Errorf("expected the retry to succeed, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestPurchase_CallerDeadlineIsNotAStageTimeout(t *testing.T) {
+	cache := &stallingCache{mockCacheRepo: newMockCacheRepo(5)}
+	cache.stalled.Store(StageDecrement)
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+	svc := NewOrderService(cache, 10, WithStageTimeouts(StageTimeouts{Decrement: time.Minute}), WithMetrics(m))
+	defer svc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := svc.Purchase(ctx, "req-1", "user-1", "item-1", 1)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrStageTimeout) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+	if len(m.timeouts) != 0 {
+		t.Errorf("expected no stage timeouts, got %v", m.timeouts)
+	}
+}
+
+func TestPurchase_EnqueueTimeoutCounted(t *testing.T) {
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+	svc := NewOrderService(newMockCacheRepo(5), 1, WithEnqueueTimeout(10*time.Millisecond), WithMetrics(m))
+	defer svc.Close()
+
+	svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1)
+	if _, err := svc.Purchase(context.Background(), "req-2", "user-1", "item-1", 1); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if m.timeouts[StageEnqueue] != 1 {
+		t.Errorf("expected the enqueue timeout counted, got %v", m.timeouts)
+	}
+}
+
+// stallingDatabase blocks order writes until their context is done.
+type stallingDatabase struct {
+	*mockDatabaseRepo
+}
+
+func (d stallingDatabase) CreateOrder(ctx context.Context, order domain.Order) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestOrderWorker_PersistTimeout(t *testing.T) {
+	settings := testWorkerSettings()
+	settings.BatchSize = 1
+	settings.RetryAttempts = 1
+	tuning, _ := NewWorkerTuning(settings)
+	records := newMockPurchaseRecords()
+	m := &recordingMetrics{outcomes: make(map[string]int)}
+
+	order := newTestOrder("order-1")
+	order.RequestID = "req-1"
+	queue := make(chan domain.Order, 1)
+	queue <- order
+	close(queue)
+
+	NewOrderWorker(0, queue, stallingDatabase{newMockDatabaseRepo()}, newMockCacheRepo(0), tuning,
+		WithWorkerTimeouts(StageTimeouts{Persist: 10 * time.Millisecond}),
+		WithWorkerMetrics(m),
+		WithWorkerRecords(records, time.Hour),
+	).Run()
+
+	if m.timeouts[StagePersist] != 2 {
+		t.Errorf("expected both attempts to time out, got %v", m.timeouts)
+	}
+	record, _ := records.GetPurchaseRecord(context.Background(), "req-1")
+	if record == nil || record.Status != domain.PurchaseStatusFailed {
+		t.Errorf("expected the order to fail, got %+v", record)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_PurchaseTraceReachesWorker(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	cache := newMockCacheRepo(10)
+	db := newMockDatabaseRepo()
+	svc := NewOrderService(cache, 10)
+
+	if _, err := svc.Purchase(context.Background(), "req-1", "user-1", "item-1", 1); err != nil {
+		t.Fatalf("purchase failed: %v", err)
+	}
+	svc.Close()
+
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	NewOrderWorker(0, svc.GetOrderQueue(), db, cache, tuning).Run()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	purchase, ok := spans["OrderService.Purchase"]
+	if !ok {
+		t.Fatal("missing purchase span")
+	}
+	persist, ok := spans["OrderWorker.persist"]
+	if !ok {
+		t.Fatal("missing persist span")
+	}
+
+	if persist.SpanContext().TraceID() != purchase.SpanContext().TraceID() {
+		t.Error("persist span is not part of the purchase trace")
+	}
+	if persist.Parent().SpanID() != purchase.SpanContext().SpanID() {
+		t.Error("persist span is not a child of the purchase span")
+	}
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/port"
+)
+
+// WorkerPoolSettings bounds the number of workers and controls how fast the
+// pool resizes.
+type WorkerPoolSettings struct {
+	// Min workers always run; the pool grows up to Max.
+	Min int
+	Max int
+	// Interval is how often the queue is checked.
+	Interval time.Duration
+	// ScaleUpLatency adds a worker once orders wait this long to be picked
+	// up. A worker is also added when more than a batch per worker is queued.
+	ScaleUpLatency time.Duration
+	// IdleTimeout removes a worker once the queue has been empty this long.
+	IdleTimeout time.Duration
+}
+
+func (s WorkerPoolSettings) Validate() error {
+	if s.Min <= 0 || s.Max < s.Min {
+		return errors.New("min workers must be positive and not exceed max workers")
+	}
+	if s.Interval <= 0 || s.ScaleUpLatency <= 0 || s.IdleTimeout <= 0 {
+		return errors.New("interval, scale up latency and idle timeout must be positive")
+	}
+	return nil
+}
+
+// WorkerPool runs OrderWorkers on a queue, adding workers while orders back
+// up and retiring them while the queue is idle. Retired workers finish the
+// batch they hold before exiting.
+type WorkerPool struct {
+	settings WorkerPoolSettings
+	queue    <-chan domain.Order
+	tuning   *WorkerTuning
+	spawn    func(id int, opts ...OrderWorkerOption) *OrderWorker
+
+	mu     sync.Mutex
+	stops  []chan struct{}
+	nextID int
+	closed bool
+	wg     sync.WaitGroup
+
+	size      atomic.Int64
+	wait      atomic.Int64
+	idleSince time.Time
+	now       func() time.Time
+}
+
+// NewWorkerPool creates a pool whose workers are built like
+// NewOrderWorker(id, queue, db, cache, tuning, opts...). Call Start to run
+// the minimum number of workers.
+func NewWorkerPool(settings WorkerPoolSettings, queue <-chan domain.Order, db port.DatabaseRepository, cache port.CacheRepository, tuning *WorkerTuning, opts ...OrderWorkerOption) (*WorkerPool, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	p := &WorkerPool{settings: settings, queue: queue, tuning: tuning, now: time.Now}
+	p.spawn = func(id int, extra ...OrderWorkerOption) *OrderWorker {
+		return NewOrderWorker(id, queue, db, cache, tuning, append(opts[:len(opts):len(opts)], extra...)...)
+	}
+	return p, nil
+}
+
+// Start runs the minimum number of workers.
+func (p *WorkerPool) Start() {
+	for range p.settings.Min {
+		p.add()
+	}
+}
+
+// Run resizes the pool every interval until ctx is cancelled.
+func (p *WorkerPool) Run(ctx context.Context) {
+	if p.settings.Min == p.settings.Max {
+		return
+	}
+
+	ticker := time.NewTicker(p.settings.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.scale()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scale adds a worker if orders are backing up, or retires one if the queue
+// has been idle for the idle timeout.
+func (p *WorkerPool) scale() {
+	depth := len(p.queue)
+	wait := time.Duration(p.wait.Swap(0))
+	size := p.Size()
+
+	if depth == 0 {
+		if p.idleSince.IsZero() {
+			p.idleSince = p.now()
+		}
+		if size > p.settings.Min && p.now().Sub(p.idleSince) >= p.settings.IdleTimeout {
+			p.remove()
+			p.idleSince = p.now()
+			log.Printf("worker pool: queue idle, scaled down to %d workers", p.Size())
+		}
+		return
+	}
+	p.idleSince = time.Time{}
+
+	backlog := depth > size*p.tuning.Settings().BatchSize
+	if size < p.settings.Max && (backlog || wait >= p.settings.ScaleUpLatency) {
+		p.add()
+		log.Printf("worker pool: %d queued, waited %v, scaled up to %d workers", depth, wait, p.Size())
+	}
+}
+
+func (p *WorkerPool) add() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// No workers may be added once Wait has started
+	if p.closed {
+		return
+	}
+
+	stop := make(chan struct{})
+	worker := p.spawn(p.nextID, withWorkerStop(stop, p.observeWait))
+	p.nextID++
+	p.stops = append(p.stops, stop)
+	p.size.Add(1)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		worker.Run()
+	}()
+}
+
+// remove retires the newest worker.
+func (p *WorkerPool) remove() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.stops) == 0 {
+		return
+	}
+	last := len(p.stops) - 1
+	close(p.stops[last])
+	p.stops = p.stops[:last]
+	p.size.Add(-1)
+}
+
+func (p *WorkerPool) observeWait(wait time.Duration) {
+	p.wait.Store(int64(wait))
+}
+
+// Size returns the number of running workers, excluding retired workers
+// finishing their last batch.
+func (p *WorkerPool) Size() int {
+	return int(p.size.Load())
+}
+
+// Wait blocks until every worker has exited, which happens once the queue
+// is closed and drained. The pool cannot grow afterwards.
+func (p *WorkerPool) Wait() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// blockingDB holds batch writes until release is closed
+type blockingDB struct {
+	*mockDatabaseRepo
+	release chan struct{}
+}
+
+func (b *blockingDB) CreateOrders(ctx context.Context, orders []domain.Order) error {
+	<-b.release
+	return b.mockDatabaseRepo.CreateOrders(context.Background(), orders)
+}
+
+func TestWorkerPool_Scales(t *testing.T) {
+	db := &blockingDB{mockDatabaseRepo: newMockDatabaseRepo(), release: make(chan struct{})}
+	queue := make(chan domain.Order, 100)
+	for i := 0; i < 50; i++ {
+		order := newTestOrder("order-" + strconv.Itoa(i))
+		order.CreatedAt = time.Now()
+		queue <- order
+	}
+
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	pool, err := NewWorkerPool(WorkerPoolSettings{
+		Min: 1, Max: 3, Interval: time.Second, ScaleUpLatency: time.Minute, IdleTimeout: time.Minute,
+	}, queue, db, newMockCacheRepo(0), tuning)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+	pool.Start()
+
+	// Each blocked worker holds at most a batch of 10, leaving more than a
+	// batch per worker queued
+	pool.scale()
+	pool.scale()
+	pool.scale()
+	if pool.Size() != 3 {
+		t.Fatalf("expected 3 workers, got %d", pool.Size())
+	}
+
+	close(db.release)
+	deadline := time.Now().Add(time.Second)
+	for len(queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	pool.scale()
+	if pool.Size() != 3 {
+		t.Errorf("expected no change before the idle timeout, got %d workers", pool.Size())
+	}
+	for _, want := range []int{2, 1, 1} {
+		now = now.Add(time.Minute)
+		pool.scale()
+		if pool.Size() != want {
+			t.Errorf("expected %d workers, got %d", want, pool.Size())
+		}
+	}
+
+	close(queue)
+	pool.Wait()
+	if len(db.orders) != 50 {
+		t.Errorf("expected all 50 orders saved, got %d", len(db.orders))
+	}
+}
+
+func TestWorkerPool_ScalesOnLatency(t *testing.T) {
+	db := &blockingDB{mockDatabaseRepo: newMockDatabaseRepo(), release: make(chan struct{})}
+	queue := make(chan domain.Order, 20)
+	for i := 0; i < 11; i++ {
+		// Orders created long ago have waited past the scale up latency
+		queue <- newTestOrder("order-" + strconv.Itoa(i))
+	}
+
+	tuning, _ := NewWorkerTuning(testWorkerSettings())
+	pool, _ := NewWorkerPool(WorkerPoolSettings{
+		Min: 1, Max: 2, Interval: time.Second, ScaleUpLatency: time.Second, IdleTimeout: time.Minute,
+	}, queue, db, newMockCacheRepo(0), tuning)
+	pool.Start()
+
+	// The worker blocks on a full batch, leaving one order queued: less than
+	// a batch, but late
+	deadline := time.Now().Add(time.Second)
+	for len(queue) > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	pool.scale()
+	if pool.Size() != 2 {
+		t.Errorf("expected a worker added for latency, got %d", pool.Size())
+	}
+
+	close(db.release)
+	close(queue)
+	pool.Wait()
+	if len(db.orders) != 11 {
+		t.Errorf("expected all 11 orders saved, got %d", len(db.orders))
+	}
+}
@@ -0,0 +1,168 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/loadgen/pb"
+)
+
+// HealthProbe returns an error while the target is degraded.
+type HealthProbe func(ctx context.Context) error
+
+// HTTPHealthProbe treats anything but a 200 from url, such as the server's
+// /readyz, as degraded.
+func HTTPHealthProbe(client *http.Client, url string) HealthProbe {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("health check returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Plan describes a distributed load test.
+type Plan struct {
+	Target   string
+	ItemID   string
+	Requests int // total across all generators
+
+	// Each round sends up to RoundSize requests per generator with
+	// Concurrency in flight on each
+	RoundSize   int
+	Concurrency int
+
+	// Backoff while the target is degraded, doubling up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Report aggregates the results of every generator.
+type Report struct {
+	Succeeded int
+	Rejected  int
+	Failed    int
+	Rounds    int
+	Backoffs  int
+	WorstP99  time.Duration
+	Duration  time.Duration
+}
+
+// Coordinator drives a set of generators in rounds, checking the target's
+// health before each round. While the target is degraded it waits with
+// exponential backoff and halves the concurrency, then ramps back up once
+// the target recovers.
+type Coordinator struct {
+	generators []pb.LoadGeneratorClient
+	probe      HealthProbe
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+func NewCoordinator(generators []pb.LoadGeneratorClient, probe HealthProbe) *Coordinator {
+	return &Coordinator{generators: generators, probe: probe, sleep: sleepContext}
+}
+
+func (c *Coordinator) Run(ctx context.Context, plan Plan) (*Report, error) {
+	if len(c.generators) == 0 {
+		return nil, fmt.Errorf("no generators")
+	}
+
+	report := &Report{}
+	start := time.Now()
+	remaining := plan.Requests
+	concurrency := plan.Concurrency
+	backoff := plan.MinBackoff
+
+	for remaining > 0 {
+		if err := c.probe(ctx); err != nil {
+			report.Backoffs++
+			concurrency = max(1, concurrency/2)
+			log.Printf("target degraded (%v), backing off %v at concurrency %d", err, backoff, concurrency)
+			if err := c.sleep(ctx, backoff); err != nil {
+				report.Duration = time.Since(start)
+				return report, err
+			}
+			backoff = min(backoff*2, plan.MaxBackoff)
+			continue
+		}
+		backoff = plan.MinBackoff
+		concurrency = min(plan.Concurrency, concurrency*2)
+
+		round := min(remaining, plan.RoundSize*len(c.generators))
+		c.runRound(ctx, plan, round, concurrency, report)
+		remaining -= round
+		report.Rounds++
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// runRound splits requests evenly across the generators. A generator that
+// fails to report counts its whole share as failed.
+func (c *Coordinator) runRound(ctx context.Context, plan Plan, requests, concurrency int, report *Report) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	share := requests / len(c.generators)
+	extra := requests % len(c.generators)
+
+	for i, gen := range c.generators {
+		n := share
+		if i < extra {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := gen.Run(ctx, &pb.RunRequest{
+				Target:      plan.Target,
+				ItemId:      plan.ItemID,
+				Requests:    int32(n),
+				Concurrency: int32(min(concurrency, n)),
+				UserPrefix:  fmt.Sprintf("gen%d-user-", i),
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("generator %d failed: %v", i, err)
+				report.Failed += n
+				return
+			}
+			report.Succeeded += int(result.GetSucceeded())
+			report.Rejected += int(result.GetRejected())
+			report.Failed += int(result.GetFailed())
+			report.WorstP99 = max(report.WorstP99, time.Duration(result.GetP99LatencyUs())*time.Microsecond)
+		}()
+	}
+	wg.Wait()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
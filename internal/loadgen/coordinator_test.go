@@ -0,0 +1,94 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/rl1809/flash-sale/internal/loadgen/pb"
+)
+
+// fakeGenerator reports every request as succeeded
+type fakeGenerator struct {
+	mu    sync.Mutex
+	calls []*pb.RunRequest
+	fail  bool
+}
+
+func (f *fakeGenerator) Run(ctx context.Context, in *pb.RunRequest, opts ...grpc.CallOption) (*pb.RunResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, in)
+	if f.fail {
+		return nil, errors.New("unreachable")
+	}
+	return &pb.RunResult{Succeeded: in.Requests, P99LatencyUs: 1500}, nil
+}
+
+func TestCoordinator_SplitsRequests(t *testing.T) {
+	a, b := &fakeGenerator{}, &fakeGenerator{}
+	c := NewCoordinator([]pb.LoadGeneratorClient{a, b}, func(ctx context.Context) error { return nil })
+
+	report, err := c.Run(context.Background(), Plan{Requests: 25, RoundSize: 5, Concurrency: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Succeeded != 25 || report.Rounds != 3 {
+		t.Errorf("expected 25 succeeded over 3 rounds, got %+v", report)
+	}
+	if report.WorstP99 != 1500*time.Microsecond {
+		t.Errorf("unexpected worst p99 %v", report.WorstP99)
+	}
+	if len(a.calls) != 3 || a.calls[2].Requests != 3 || b.calls[2].Requests != 2 {
+		t.Errorf("unexpected split: a=%v b=%v", a.calls, b.calls)
+	}
+}
+
+func TestCoordinator_BacksOffWhileDegraded(t *testing.T) {
+	gen := &fakeGenerator{}
+	probes := 0
+	c := NewCoordinator([]pb.LoadGeneratorClient{gen}, func(ctx context.Context) error {
+		probes++
+		if probes <= 2 {
+			return errors.New("503")
+		}
+		return nil
+	})
+	var slept []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	report, err := c.Run(context.Background(), Plan{
+		Requests: 10, RoundSize: 10, Concurrency: 8,
+		MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Backoffs != 2 || len(slept) != 2 || slept[1] != 200*time.Millisecond {
+		t.Errorf("expected two doubling backoffs, got %d %v", report.Backoffs, slept)
+	}
+	// Concurrency halved twice (8 -> 2), then doubled once on recovery
+	if got := gen.calls[0].Concurrency; got != 4 {
+		t.Errorf("expected concurrency 4 after recovery, got %d", got)
+	}
+}
+
+func TestCoordinator_GeneratorFailureCountsAsFailed(t *testing.T) {
+	c := NewCoordinator([]pb.LoadGeneratorClient{&fakeGenerator{}, &fakeGenerator{fail: true}},
+		func(ctx context.Context) error { return nil })
+
+	report, err := c.Run(context.Background(), Plan{Requests: 10, RoundSize: 5, Concurrency: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Succeeded != 5 || report.Failed != 5 {
+		t.Errorf("expected 5/5, got %+v", report)
+	}
+}
@@ -0,0 +1,141 @@
+// Package loadgen drives distributed load against the purchase API. Each
+// Generator process fires purchases at the target over gRPC; a Coordinator
+// fans rounds out to the generators and backs off while the target is
+// unhealthy. Drive runs load from a single process over either the HTTP or
+// the gRPC API.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/rl1809/flash-sale/internal/loadgen/pb"
+	orderpb "github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// Generator serves LoadGenerator, keeping one connection per target.
+type Generator struct {
+	pb.UnimplementedLoadGeneratorServer
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	seq   atomic.Int64
+}
+
+func NewGenerator() *Generator {
+	return &Generator{conns: make(map[string]*grpc.ClientConn)}
+}
+
+func (g *Generator) Run(ctx context.Context, req *pb.RunRequest) (*pb.RunResult, error) {
+	if req.GetRequests() <= 0 || req.GetConcurrency() <= 0 {
+		return nil, fmt.Errorf("requests and concurrency must be positive")
+	}
+
+	conn, err := g.conn(req.GetTarget())
+	if err != nil {
+		return nil, err
+	}
+	client := orderpb.NewOrderServiceClient(conn)
+
+	var succeeded, rejected, failed atomic.Int32
+	latencies := make([]time.Duration, req.GetRequests())
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for w := 0; w < int(req.GetConcurrency()); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				begin := time.Now()
+				resp, err := client.Purchase(ctx, &orderpb.PurchaseRequest{
+					RequestId: uuid.New().String(),
+					UserId:    fmt.Sprintf("%s%d", req.GetUserPrefix(), g.seq.Add(1)),
+					ItemId:    req.GetItemId(),
+					Quantity:  1,
+				})
+				latencies[i] = time.Since(begin)
+
+				switch {
+				case err == nil && resp.GetSuccess():
+					succeeded.Add(1)
+				case isRejection(err):
+					rejected.Add(1)
+				default:
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < int(req.GetRequests()); i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	slices.Sort(latencies)
+	return &pb.RunResult{
+		Succeeded:    succeeded.Load(),
+		Rejected:     rejected.Load(),
+		Failed:       failed.Load(),
+		DurationMs:   time.Since(start).Milliseconds(),
+		P50LatencyUs: percentile(latencies, 0.50).Microseconds(),
+		P99LatencyUs: percentile(latencies, 0.99).Microseconds(),
+	}, nil
+}
+
+// Close closes the connections to all targets.
+func (g *Generator) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, conn := range g.conns {
+		conn.Close()
+	}
+}
+
+func (g *Generator) conn(target string) (*grpc.ClientConn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if conn, ok := g.conns[target]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial target: %w", err)
+	}
+	g.conns[target] = conn
+	return conn, nil
+}
+
+// isRejection reports whether the server declined the purchase, as opposed
+// to failing to process it.
+func isRejection(err error) bool {
+	switch status.Code(err) {
+	case codes.AlreadyExists, codes.ResourceExhausted, codes.NotFound, codes.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
+}
+
+// percentile expects sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
@@ -0,0 +1,261 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.4
+// source: proto/loadgen.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type RunRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// gRPC address of the flash sale server under test
+	Target      string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	ItemId      string `protobuf:"bytes,2,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Requests    int32  `protobuf:"varint,3,opt,name=requests,proto3" json:"requests,omitempty"`
+	Concurrency int32  `protobuf:"varint,4,opt,name=concurrency,proto3" json:"concurrency,omitempty"`
+	// User IDs are user_prefix followed by a sequence number
+	UserPrefix    string `protobuf:"bytes,5,opt,name=user_prefix,json=userPrefix,proto3" json:"user_prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunRequest) Reset() {
+	*x = RunRequest{}
+	mi := &file_proto_loadgen_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunRequest) ProtoMessage() {}
+
+func (x *RunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_loadgen_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunRequest.ProtoReflect.Descriptor instead.
+func (*RunRequest) Descriptor() ([]byte, []int) {
+	return file_proto_loadgen_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *RunRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *RunRequest) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+func (x *RunRequest) GetRequests() int32 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+func (x *RunRequest) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *RunRequest) GetUserPrefix() string {
+	if x != nil {
+		return x.UserPrefix
+	}
+	return ""
+}
+
+type RunResult struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Succeeded int32                  `protobuf:"varint,1,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	// Purchases the server declined, such as sold out or duplicate
+	Rejected int32 `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	// Transport or server errors
+	Failed        int32 `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`
+	DurationMs    int64 `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	P50LatencyUs  int64 `protobuf:"varint,5,opt,name=p50_latency_us,json=p50LatencyUs,proto3" json:"p50_latency_us,omitempty"`
+	P99LatencyUs  int64 `protobuf:"varint,6,opt,name=p99_latency_us,json=p99LatencyUs,proto3" json:"p99_latency_us,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunResult) Reset() {
+	*x = RunResult{}
+	mi := &file_proto_loadgen_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunResult) ProtoMessage() {}
+
+func (x *RunResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_loadgen_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunResult.ProtoReflect.Descriptor instead.
+func (*RunResult) Descriptor() ([]byte, []int) {
+	return file_proto_loadgen_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RunResult) GetSucceeded() int32 {
+	if x != nil {
+		return x.Succeeded
+	}
+	return 0
+}
+
+func (x *RunResult) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *RunResult) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *RunResult) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *RunResult) GetP50LatencyUs() int64 {
+	if x != nil {
+		return x.P50LatencyUs
+	}
+	return 0
+}
+
+func (x *RunResult) GetP99LatencyUs() int64 {
+	if x != nil {
+		return x.P99LatencyUs
+	}
+	return 0
+}
+
+var File_proto_loadgen_proto protoreflect.FileDescriptor
+
+const file_proto_loadgen_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/loadgen.proto\x12\x11flashsale.loadgen\"\x9c\x01\n" +
+	"\n" +
+	"RunRequest\x12\x16\n" +
+	"\x06target\x18\x01 \x01(\tR\x06target\x12\x17\n" +
+	"\aitem_id\x18\x02 \x01(\tR\x06itemId\x12\x1a\n" +
+	"\brequests\x18\x03 \x01(\x05R\brequests\x12 \n" +
+	"\vconcurrency\x18\x04 \x01(\x05R\vconcurrency\x12\x1f\n" +
+	"\vuser_prefix\x18\x05 \x01(\tR\n" +
+	"userPrefix\"\xca\x01\n" +
+	"\tRunResult\x12\x1c\n" +
+	"\tsucceeded\x18\x01 \x01(\x05R\tsucceeded\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x05R\brejected\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\x05R\x06failed\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x03R\n" +
+	"durationMs\x12$\n" +
+	"\x0ep50_latency_us\x18\x05 \x01(\x03R\fp50LatencyUs\x12$\n" +
+	"\x0ep99_latency_us\x18\x06 \x01(\x03R\fp99LatencyUs2S\n" +
+	"\rLoadGenerator\x12B\n" +
+	"\x03Run\x12\x1d.flashsale.loadgen.RunRequest\x1a\x1c.flashsale.loadgen.RunResultB2Z0github.com/rl1809/flash-sale/internal/loadgen/pbb\x06proto3"
+
+var (
+	file_proto_loadgen_proto_rawDescOnce sync.Once
+	file_proto_loadgen_proto_rawDescData []byte
+)
+
+func file_proto_loadgen_proto_rawDescGZIP() []byte {
+	file_proto_loadgen_proto_rawDescOnce.Do(func() {
+		file_proto_loadgen_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_loadgen_proto_rawDesc), len(file_proto_loadgen_proto_rawDesc)))
+	})
+	return file_proto_loadgen_proto_rawDescData
+}
+
+var file_proto_loadgen_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_loadgen_proto_goTypes = []any{
+	(*RunRequest)(nil), // 0: flashsale.loadgen.RunRequest
+	(*RunResult)(nil),  // 1: flashsale.loadgen.RunResult
+}
+var file_proto_loadgen_proto_depIdxs = []int32{
+	0, // 0: flashsale.loadgen.LoadGenerator.Run:input_type -> flashsale.loadgen.RunRequest
+	1, // 1: flashsale.loadgen.LoadGenerator.Run:output_type -> flashsale.loadgen.RunResult
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_loadgen_proto_init() }
+func file_proto_loadgen_proto_init() {
+	if File_proto_loadgen_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_loadgen_proto_rawDesc), len(file_proto_loadgen_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_loadgen_proto_goTypes,
+		DependencyIndexes: file_proto_loadgen_proto_depIdxs,
+		MessageInfos:      file_proto_loadgen_proto_msgTypes,
+	}.Build()
+	File_proto_loadgen_proto = out.File
+	file_proto_loadgen_proto_goTypes = nil
+	file_proto_loadgen_proto_depIdxs = nil
+}
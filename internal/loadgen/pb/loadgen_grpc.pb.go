@@ -0,0 +1,127 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.0
+// - protoc             v6.33.4
+// source: proto/loadgen.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LoadGenerator_Run_FullMethodName = "/flashsale.loadgen.LoadGenerator/Run"
+)
+
+// LoadGeneratorClient is the client API for LoadGenerator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LoadGenerator is served by stress_test generator processes and driven by
+// a coordinator.
+type LoadGeneratorClient interface {
+	Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResult, error)
+}
+
+type loadGeneratorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLoadGeneratorClient(cc grpc.ClientConnInterface) LoadGeneratorClient {
+	return &loadGeneratorClient{cc}
+}
+
+func (c *loadGeneratorClient) Run(ctx context.Context, in *RunRequest, opts ...grpc.CallOption) (*RunResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RunResult)
+	err := c.cc.Invoke(ctx, LoadGenerator_Run_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoadGeneratorServer is the server API for LoadGenerator service.
+// All implementations must embed UnimplementedLoadGeneratorServer
+// for forward compatibility.
+//
+// LoadGenerator is served by stress_test generator processes and driven by
+// a coordinator.
+type LoadGeneratorServer interface {
+	Run(context.Context, *RunRequest) (*RunResult, error)
+	mustEmbedUnimplementedLoadGeneratorServer()
+}
+
+// UnimplementedLoadGeneratorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLoadGeneratorServer struct{}
+
+func (UnimplementedLoadGeneratorServer) Run(context.Context, *RunRequest) (*RunResult, error) {
+	return nil, status.Error(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedLoadGeneratorServer) mustEmbedUnimplementedLoadGeneratorServer() {}
+func (UnimplementedLoadGeneratorServer) testEmbeddedByValue()                       {}
+
+// UnsafeLoadGeneratorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LoadGeneratorServer will
+// result in compilation errors.
+type UnsafeLoadGeneratorServer interface {
+	mustEmbedUnimplementedLoadGeneratorServer()
+}
+
+func RegisterLoadGeneratorServer(s grpc.ServiceRegistrar, srv LoadGeneratorServer) {
+	// If the following call panics, it indicates UnimplementedLoadGeneratorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LoadGenerator_ServiceDesc, srv)
+}
+
+func _LoadGenerator_Run_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoadGeneratorServer).Run(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoadGenerator_Run_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoadGeneratorServer).Run(ctx, req.(*RunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LoadGenerator_ServiceDesc is the grpc.ServiceDesc for LoadGenerator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LoadGenerator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "flashsale.loadgen.LoadGenerator",
+	HandlerType: (*LoadGeneratorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Run",
+			Handler:    _LoadGenerator_Run_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/loadgen.proto",
+}
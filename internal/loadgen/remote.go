@@ -0,0 +1,332 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	orderpb "github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// maxResponseBytes bounds how much of a purchase response is read.
+const maxResponseBytes = 64 << 10
+
+// Result is how the target answered a purchase.
+type Result int
+
+const (
+	Succeeded Result = iota
+	// Rejected purchases were declined by the server, such as sold out,
+	// duplicate or busy ones
+	Rejected
+	// Failed purchases got an error or no answer at all
+	Failed
+)
+
+// Purchaser buys one unit of an item for a user from the server under
+// test. Besides the result it returns the answer, such as "sold_out", so a
+// run can report what the server said.
+type Purchaser interface {
+	Purchase(ctx context.Context, requestID, userID, itemID string) (Result, string)
+}
+
+// HTTPPurchaser buys through POST /v1/purchase, as browsers and apps do.
+type HTTPPurchaser struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+// NewHTTPPurchaser buys from the server at baseURL, keeping up to conns
+// connections open to it. A token, if set, is sent as a bearer token.
+func NewHTTPPurchaser(baseURL, token string, conns int, timeout time.Duration) *HTTPPurchaser {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = conns
+	return &HTTPPurchaser{
+		client: &http.Client{Transport: transport, Timeout: timeout},
+		url:    strings.TrimRight(baseURL, "/") + "/v1/purchase",
+		token:  token,
+	}
+}
+
+type purchaseBody struct {
+	RequestID string `json:"request_id"`
+	UserID    string `json:"user_id"`
+	ItemID    string `json:"item_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type errorBody struct {
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+}
+
+func (p *HTTPPurchaser) Purchase(ctx context.Context, requestID, userID, itemID string) (Result, string) {
+	body, _ := json.Marshal(purchaseBody{RequestID: requestID, UserID: userID, ItemID: itemID, Quantity: 1})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return Failed, "invalid_request"
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Failed, "transport_error"
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return Succeeded, "ok"
+	case http.StatusAccepted:
+		// Asynchronous purchases are queued; their outcome is not awaited
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return Succeeded, "accepted"
+	}
+	var answer errorBody
+	json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&answer)
+	code := answer.Error.Code
+	if code == "" {
+		code = fmt.Sprintf("status_%d", resp.StatusCode)
+	}
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusGone,
+		http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return Rejected, code
+	default:
+		return Failed, code
+	}
+}
+
+// GRPCPurchaser buys through the OrderService gRPC API.
+type GRPCPurchaser struct {
+	client  orderpb.OrderServiceClient
+	token   string
+	timeout time.Duration
+}
+
+// NewGRPCPurchaser buys over conn, each purchase bounded by timeout. A
+// token, if set, is sent as a bearer token.
+func NewGRPCPurchaser(conn grpc.ClientConnInterface, token string, timeout time.Duration) *GRPCPurchaser {
+	return &GRPCPurchaser{client: orderpb.NewOrderServiceClient(conn), token: token, timeout: timeout}
+}
+
+func (p *GRPCPurchaser) Purchase(ctx context.Context, requestID, userID, itemID string) (Result, string) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	if p.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Purchase(ctx, &orderpb.PurchaseRequest{
+		RequestId: requestID,
+		UserId:    userID,
+		ItemId:    itemID,
+		Quantity:  1,
+	})
+	if err == nil {
+		if resp.GetSuccess() {
+			return Succeeded, "ok"
+		}
+		return Failed, "unsuccessful"
+	}
+
+	st := status.Convert(err)
+	answer := strings.ToLower(st.Code().String())
+	declined := isRejection(err)
+	for _, detail := range st.Details() {
+		// The server names why it declined in an ErrorInfo, with the same
+		// reason as the HTTP error code. Busy, paused and forbidden purchases
+		// are Unavailable or PermissionDenied, which without one mean the
+		// server could not be reached or refused the caller
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			answer = strings.ToLower(info.GetReason())
+			declined = declined || st.Code() == codes.Unavailable || st.Code() == codes.PermissionDenied
+		}
+	}
+	if declined {
+		return Rejected, answer
+	}
+	return Failed, answer
+}
+
+// Load describes a run of purchases against one server.
+type Load struct {
+	ItemID string
+	// UserPrefix and a number name each purchase's user. With Users set,
+	// the numbers cycle through that many users, so they hit duplicate
+	// and per-user limits as real repeat buyers do; otherwise each
+	// purchase is a new user
+	UserPrefix string
+	Users      int
+
+	// Concurrency purchases are in flight at most. With QPS set, purchases
+	// start at that rate and those due while all Concurrency are in flight
+	// are skipped; otherwise each starts as soon as another finishes
+	Concurrency int
+	QPS         float64
+
+	// The run starts purchases for Duration, or until Requests have
+	// started if that is sooner; purchases in flight are waited for
+	Duration time.Duration
+	Requests int
+}
+
+// RunReport is what a run of a Load saw.
+type RunReport struct {
+	Sent      int
+	Succeeded int
+	Rejected  int
+	Failed    int
+	// Skipped purchases were due under the QPS while every worker was busy
+	Skipped int
+	// Answers counts the purchases by what the server answered
+	Answers  map[string]int
+	Duration time.Duration
+	P50      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Throughput is the purchases answered per second.
+func (r RunReport) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Succeeded+r.Rejected+r.Failed) / r.Duration.Seconds()
+}
+
+// AnswerNames returns the answers in the report, most frequent first.
+func (r RunReport) AnswerNames() []string {
+	names := slices.Collect(maps.Keys(r.Answers))
+	slices.SortFunc(names, func(a, b string) int {
+		if r.Answers[a] != r.Answers[b] {
+			return r.Answers[b] - r.Answers[a]
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
+// workerStats is what one worker of a run saw.
+type workerStats struct {
+	latencies []time.Duration
+	results   [Failed + 1]int
+	answers   map[string]int
+}
+
+// Drive runs load against purchaser until its duration or requests are
+// done or ctx is cancelled. Purchases in flight then are finished, not
+// cancelled, so they count as what the server answered.
+func Drive(ctx context.Context, purchaser Purchaser, load Load) RunReport {
+	purchaseCtx := context.WithoutCancel(ctx)
+	concurrency := max(load.Concurrency, 1)
+	jobs := make(chan int)
+	stats := make([]workerStats, concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for w := range stats {
+		stats[w].answers = make(map[string]int)
+		wg.Add(1)
+		go func(s *workerStats) {
+			defer wg.Done()
+			for seq := range jobs {
+				user := seq
+				if load.Users > 0 {
+					user = seq % load.Users
+				}
+				begin := time.Now()
+				result, answer := purchaser.Purchase(purchaseCtx, uuid.New().String(), fmt.Sprintf("%s%d", load.UserPrefix, user), load.ItemID)
+				s.latencies = append(s.latencies, time.Since(begin))
+				s.results[result]++
+				s.answers[answer]++
+			}
+		}(&stats[w])
+	}
+
+	var deadline <-chan time.Time
+	if load.Duration > 0 {
+		timer := time.NewTimer(load.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var tick <-chan time.Time
+	if load.QPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / load.QPS))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	report := RunReport{Answers: make(map[string]int)}
+dispatch:
+	for load.Requests <= 0 || report.Sent < load.Requests {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-deadline:
+				break dispatch
+			case <-ctx.Done():
+				break dispatch
+			}
+			select {
+			case jobs <- report.Sent:
+				report.Sent++
+			default:
+				report.Skipped++
+			}
+			continue
+		}
+		select {
+		case jobs <- report.Sent:
+			report.Sent++
+		case <-deadline:
+			break dispatch
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	var latencies []time.Duration
+	for _, s := range stats {
+		latencies = append(latencies, s.latencies...)
+		report.Succeeded += s.results[Succeeded]
+		report.Rejected += s.results[Rejected]
+		report.Failed += s.results[Failed]
+		for answer, n := range s.answers {
+			report.Answers[answer] += n
+		}
+	}
+	slices.Sort(latencies)
+	report.P50 = percentile(latencies, 0.50)
+	report.P99 = percentile(latencies, 0.99)
+	if len(latencies) > 0 {
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report
+}
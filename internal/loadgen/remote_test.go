@@ -0,0 +1,147 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	orderpb "github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// fakePurchaser sells stock units and then reports sold out, blocking each
+// purchase until release is closed if it is set.
+type fakePurchaser struct {
+	mu      sync.Mutex
+	stock   int
+	users   map[string]int
+	release chan struct{}
+}
+
+func (f *fakePurchaser) Purchase(ctx context.Context, requestID, userID, itemID string) (Result, string) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[userID]++
+	if f.stock == 0 {
+		return Rejected, "sold_out"
+	}
+	f.stock--
+	return Succeeded, "ok"
+}
+
+func TestDrive_Requests(t *testing.T) {
+	purchaser := &fakePurchaser{stock: 3, users: make(map[string]int)}
+	report := Drive(context.Background(), purchaser, Load{ItemID: "item-1", UserPrefix: "user-", Users: 4, Concurrency: 3, Requests: 10})
+
+	if report.Sent != 10 || report.Succeeded != 3 || report.Rejected != 7 || report.Failed != 0 {
+		t.Fatalf("expected 3 of 10 to succeed, got %+v", report)
+	}
+	if report.Answers["ok"] != 3 || report.Answers["sold_out"] != 7 {
+		t.Errorf("unexpected answers %v", report.Answers)
+	}
+	if names := report.AnswerNames(); names[0] != "sold_out" {
+		t.Errorf("expected the most frequent answer first, got %v", names)
+	}
+	if len(purchaser.users) != 4 || purchaser.users["user-0"] != 3 {
+		t.Errorf("expected 4 users buying in turn, got %v", purchaser.users)
+	}
+}
+
+func TestDrive_QPSSkipsWhileBusy(t *testing.T) {
+	purchaser := &fakePurchaser{users: make(map[string]int), release: make(chan struct{})}
+	time.AfterFunc(100*time.Millisecond, func() { close(purchaser.release) })
+	report := Drive(context.Background(), purchaser, Load{Concurrency: 1, QPS: 200, Duration: 50 * time.Millisecond})
+
+	if report.Sent != 1 || report.Skipped == 0 {
+		t.Errorf("expected one purchase in flight and the rest skipped, got %+v", report)
+	}
+	if report.Duration < 100*time.Millisecond {
+		t.Errorf("expected the run to wait for the purchase in flight, took %v", report.Duration)
+	}
+}
+
+func TestHTTPPurchaser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body purchaseBody
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path != "/v1/purchase" || r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case body.ItemID == "sold-out":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"error":{"code":"sold_out","message":"insufficient stock"}}`))
+		case body.ItemID == "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"code":"internal_error"}}`))
+		default:
+			w.Write([]byte(`{"success":true,"order_id":"order-1"}`))
+		}
+	}))
+	defer server.Close()
+	purchaser := NewHTTPPurchaser(server.URL+"/", "secret", 1, time.Second)
+
+	tests := []struct {
+		itemID string
+		result Result
+		answer string
+	}{
+		{"item-1", Succeeded, "ok"},
+		{"sold-out", Rejected, "sold_out"},
+		{"broken", Failed, "internal_error"},
+	}
+	for _, tt := range tests {
+		if result, answer := purchaser.Purchase(context.Background(), "req-1", "user-1", tt.itemID); result != tt.result || answer != tt.answer {
+			t.Errorf("%s: expected %v %q, got %v %q", tt.itemID, tt.result, tt.answer, result, answer)
+		}
+	}
+
+	unauthorized := NewHTTPPurchaser(server.URL, "", 1, time.Second)
+	if result, answer := unauthorized.Purchase(context.Background(), "req-1", "user-1", "item-1"); result != Failed || answer != "status_401" {
+		t.Errorf("expected a failure without credentials, got %v %q", result, answer)
+	}
+}
+
+// fakeOrderClient answers purchases with err.
+type fakeOrderClient struct {
+	orderpb.OrderServiceClient
+	err error
+}
+
+func (f *fakeOrderClient) Purchase(ctx context.Context, in *orderpb.PurchaseRequest, opts ...grpc.CallOption) (*orderpb.PurchaseResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &orderpb.PurchaseResponse{Success: true}, nil
+}
+
+func TestGRPCPurchaser(t *testing.T) {
+	busy, _ := status.New(codes.Unavailable, "server busy").WithDetails(&errdetails.ErrorInfo{Reason: "OVERLOADED"})
+	tests := []struct {
+		name   string
+		err    error
+		result Result
+		answer string
+	}{
+		{"success", nil, Succeeded, "ok"},
+		{"sold out", status.Error(codes.ResourceExhausted, "sold out"), Rejected, "resourceexhausted"},
+		{"busy", busy.Err(), Rejected, "overloaded"},
+		{"unreachable", status.Error(codes.Unavailable, "connection refused"), Failed, "unavailable"},
+	}
+	for _, tt := range tests {
+		purchaser := &GRPCPurchaser{client: &fakeOrderClient{err: tt.err}}
+		if result, answer := purchaser.Purchase(context.Background(), "req-1", "user-1", "item-1"); result != tt.result || answer != tt.answer {
+			t.Errorf("%s: expected %v %q, got %v %q", tt.name, tt.result, tt.answer, result, answer)
+		}
+	}
+}
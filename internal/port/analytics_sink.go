@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// AnalyticsSink stores purchase attempts for analysis after a sale, such as
+// in a ClickHouse or BigQuery table.
+type AnalyticsSink interface {
+	// WritePurchaseOutcomes stores a batch of attempts. An error means some
+	// or all of them were not stored
+	WritePurchaseOutcomes(ctx context.Context, attempts []domain.PurchaseOutcome) error
+}
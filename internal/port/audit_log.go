@@ -0,0 +1,17 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// AuditLog stores operator changes. Records can be appended and read but
+// never updated or deleted.
+type AuditLog interface {
+	// AppendAudit saves a record and returns it with its ID assigned
+	AppendAudit(ctx context.Context, record domain.AuditRecord) (*domain.AuditRecord, error)
+
+	// ListAudit returns the records selected by filter, newest first
+	ListAudit(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditRecord, error)
+}
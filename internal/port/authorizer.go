@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// Authorizer resolves request credentials to a principal, so an identity
+// provider can be plugged in without touching the handlers.
+type Authorizer interface {
+	// Authenticate returns the principal the credentials belong to, or nil if they are
+	// missing, unknown or invalid. Errors are reserved for failures to check them
+	Authenticate(ctx context.Context, creds domain.Credentials) (*domain.Principal, error)
+}
@@ -0,0 +1,31 @@
+package port
+
+import (
+	"context"
+	"net/netip"
+)
+
+// Blacklist holds the users and client IP ranges banned from purchasing. It
+// is shared by every server and is not tied to a campaign.
+type Blacklist interface {
+	// BanUser adds the user to the blacklist
+	BanUser(ctx context.Context, userID string) error
+
+	// UnbanUser removes the user from the blacklist
+	UnbanUser(ctx context.Context, userID string) error
+
+	// IsUserBanned reports whether the user is on the blacklist
+	IsUserBanned(ctx context.Context, userID string) (bool, error)
+
+	// BannedUsers returns every banned user
+	BannedUsers(ctx context.Context) ([]string, error)
+
+	// BanIPRange adds the client IP range to the blacklist
+	BanIPRange(ctx context.Context, prefix netip.Prefix) error
+
+	// UnbanIPRange removes the client IP range from the blacklist
+	UnbanIPRange(ctx context.Context, prefix netip.Prefix) error
+
+	// BannedIPRanges returns every banned client IP range
+	BannedIPRanges(ctx context.Context) ([]netip.Prefix, error)
+}
@@ -0,0 +1,12 @@
+package port
+
+import "context"
+
+// BlobStore keeps objects by key in object storage, such as the batches of
+// orders archived out of the database.
+type BlobStore interface {
+	// PutBlob stores data under key, replacing any object there
+	PutBlob(ctx context.Context, key string, data []byte, contentType string) error
+	// GetBlob returns the object under key, or nil if there is none
+	GetBlob(ctx context.Context, key string) ([]byte, error)
+}
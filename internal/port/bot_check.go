@@ -0,0 +1,11 @@
+package port
+
+import "context"
+
+// BotCheck verifies the challenge token, such as a CAPTCHA response, that a
+// client solved before purchasing.
+type BotCheck interface {
+	// Verify reports whether token proves a human solved the challenge. The
+	// client IP is passed on to providers that check it; it may be empty
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
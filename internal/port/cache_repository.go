@@ -1,14 +1,38 @@
 package port
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
 
 type CacheRepository interface {
-	// DecrementStock atomically decreases stock in cache, returns false if insufficient
-	DecrementStock(ctx context.Context, itemID string, quantity int) (bool, error)
+	// DecrementStock atomically decreases stock in cache and reports why it did not, if so
+	DecrementStock(ctx context.Context, itemID string, quantity int) (domain.StockDecrement, error)
+
+	// DecrementStocks takes the stock of every line, or of none, and reports why not along
+	// with the item that stopped it. Lines must be for distinct items
+	DecrementStocks(ctx context.Context, lines []domain.OrderItem) (domain.StockDecrement, string, error)
+
+	// GetStock returns the current stock counter, or 0 if the item has none
+	GetStock(ctx context.Context, itemID string) (int, error)
+
+	// SetStock overwrites the stock counter, creating it if needed
+	SetStock(ctx context.Context, itemID string, quantity int) error
 
 	// IncrementStock restores stock (for rollback on failure)
 	IncrementStock(ctx context.Context, itemID string, quantity int) error
 
 	// SetIdempotency sets a key for idempotency check, returns false if already exists
-	SetIdempotency(ctx context.Context, key string) (bool, error)
+	SetIdempotency(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// ReleaseIdempotency removes a key so the request can be retried
+	ReleaseIdempotency(ctx context.Context, key string) error
+
+	// SetIdempotencyResult stores the outcome of the request owning the idempotency key
+	SetIdempotencyResult(ctx context.Context, key string, result domain.PurchaseResult) error
+
+	// GetIdempotencyResult returns the stored outcome, or nil if the request is still in flight
+	GetIdempotencyResult(ctx context.Context, key string) (*domain.PurchaseResult, error)
 }
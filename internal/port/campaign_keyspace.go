@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// CampaignKeyspace is implemented by caches that scope their keys per campaign.
+type CampaignKeyspace interface {
+	// SnapshotCampaign reads the final values of all keys of a campaign
+	SnapshotCampaign(ctx context.Context, campaignID string) (*domain.CampaignArchive, error)
+
+	// DeleteCampaign removes all keys of a campaign and returns how many were deleted
+	DeleteCampaign(ctx context.Context, campaignID string) (int, error)
+
+	// SetCampaignStock sets an item's stock counter among a campaign's keys
+	SetCampaignStock(ctx context.Context, campaignID, itemID string, quantity int) error
+}
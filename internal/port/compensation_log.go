@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// CompensationLog durably records stock that still has to be returned to the
+// cache.
+type CompensationLog interface {
+	RecordCompensation(ctx context.Context, compensation domain.StockCompensation) error
+
+	// PendingCompensations returns up to limit unresolved compensations,
+	// oldest first
+	PendingCompensations(ctx context.Context, limit int) ([]domain.StockCompensation, error)
+
+	// ResolveCompensation marks a compensation done. It returns false if it
+	// was already resolved, so only one caller applies it.
+	ResolveCompensation(ctx context.Context, id string, at time.Time) (bool, error)
+
+	// ReopenCompensation returns a resolved compensation to pending after
+	// applying it failed
+	ReopenCompensation(ctx context.Context, id, lastError string, at time.Time) error
+}
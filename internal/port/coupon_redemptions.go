@@ -0,0 +1,17 @@
+package port
+
+import "context"
+
+// CouponRedemptions counts the orders each coupon was used on, so a usage
+// limit holds across purchases and server instances.
+type CouponRedemptions interface {
+	// RedeemCoupon counts one use of the coupon and reports true, or reports false without
+	// counting it if the coupon has been used maxUses times. A maxUses of 0 never refuses
+	RedeemCoupon(ctx context.Context, code string, maxUses int) (bool, error)
+
+	// ReleaseCoupon takes back a use counted for a purchase that did not go through
+	ReleaseCoupon(ctx context.Context, code string) error
+
+	// CouponUses returns how often the coupon has been used
+	CouponUses(ctx context.Context, code string) (int, error)
+}
@@ -0,0 +1,23 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// CouponRepository persists coupon definitions. How often a coupon has been
+// used is counted by CouponRedemptions.
+type CouponRepository interface {
+	// CreateCoupon saves a new coupon and reports false if one with the same code exists
+	CreateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error)
+
+	// GetCoupon retrieves a coupon by code, or nil if there is none
+	GetCoupon(ctx context.Context, code string) (*domain.Coupon, error)
+
+	// ListCoupons retrieves all coupons ordered by code
+	ListCoupons(ctx context.Context) ([]domain.Coupon, error)
+
+	// UpdateCoupon updates a coupon and reports false if it does not exist
+	UpdateCoupon(ctx context.Context, coupon domain.Coupon) (bool, error)
+}
@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"time"
 
 	"github.com/rl1809/flash-sale/internal/core/domain"
 )
@@ -10,9 +11,80 @@ type DatabaseRepository interface {
 	// CreateOrder persists a new order with optimistic locking on inventory
 	CreateOrder(ctx context.Context, order domain.Order) error
 
+	// CreateOrders persists a batch of orders in a single transaction; it fails as a whole
+	CreateOrders(ctx context.Context, orders []domain.Order) error
+
+	// GetOrder retrieves an order by ID
+	GetOrder(ctx context.Context, id string) (*domain.Order, error)
+
+	// UpdateOrderStatus moves an order from one status to another and reports false if it
+	// was no longer in the from status. Cancelling returns the units to inventory or allocation
+	UpdateOrderStatus(ctx context.Context, id string, from, to domain.OrderStatus) (bool, error)
+
+	// ConfirmOrder moves a pending order to confirmed, recording the payment that paid for
+	// it, and reports false if it was no longer pending
+	ConfirmOrder(ctx context.Context, id, paymentID string) (bool, error)
+
+	// ExpiredOrders returns up to limit pending orders whose hold expired at or before the
+	// given time, soonest expiry first
+	ExpiredOrders(ctx context.Context, before time.Time, limit int) ([]domain.Order, error)
+
+	// ListOrdersByUser returns up to filter.Limit of a user's orders matching filter,
+	// newest first with ties broken by descending ID
+	ListOrdersByUser(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error)
+
+	// ListOrdersAfter returns up to limit orders in window with IDs after afterID, in ID
+	// order, for reading every order a page at a time
+	ListOrdersAfter(ctx context.Context, window domain.OrderWindow, afterID string, limit int) ([]domain.Order, error)
+
 	// GetInventory retrieves inventory by item ID
 	GetInventory(ctx context.Context, itemID string) (*domain.Inventory, error)
 
 	// UpdateInventory updates inventory with version check for optimistic locking
 	UpdateInventory(ctx context.Context, inventory domain.Inventory) error
+
+	// RestockInventory applies inv with the same version check as UpdateInventory and
+	// records the restock audit entry in the same transaction
+	RestockInventory(ctx context.Context, inv domain.Inventory, restock domain.Restock) error
+
+	// CreateAllocation persists a partner allocation and deducts its units
+	// from inventory, or returns ErrOptimisticLock if there are too few
+	CreateAllocation(ctx context.Context, allocation domain.Allocation) error
+
+	// GetAllocation retrieves an allocation by ID
+	GetAllocation(ctx context.Context, id string) (*domain.Allocation, error)
+
+	// SaveCampaignArchive stores the final state of a torn down campaign
+	SaveCampaignArchive(ctx context.Context, archive domain.CampaignArchive) error
+
+	// CreateItem persists a new item together with its inventory row and reports false if
+	// an item with the same ID exists
+	CreateItem(ctx context.Context, item domain.Item) (bool, error)
+
+	// GetItem retrieves an item and its inventory level by ID
+	GetItem(ctx context.Context, id string) (*domain.Item, error)
+
+	// ListItems retrieves all items ordered by ID
+	ListItems(ctx context.Context) ([]domain.Item, error)
+
+	// UpdateItem updates an item's details and reports false if it does not exist. Stock
+	// is left untouched
+	UpdateItem(ctx context.Context, item domain.Item) (bool, error)
+
+	// CreateCampaign persists a new campaign and reports false if one with the same ID exists
+	CreateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error)
+
+	// GetCampaign retrieves a campaign by ID
+	GetCampaign(ctx context.Context, id string) (*domain.Campaign, error)
+
+	// ListCampaigns retrieves all campaigns ordered by start time
+	ListCampaigns(ctx context.Context) ([]domain.Campaign, error)
+
+	// UpdateCampaign updates a campaign and reports false if it does not exist
+	UpdateCampaign(ctx context.Context, campaign domain.Campaign) (bool, error)
+
+	// FulfillAllocation records an order against an allocation without
+	// touching inventory, or returns ErrAllocationExhausted if the
+	// allocation has too few units left
+	FulfillAllocation(ctx context.Context, order domain.Order) error
 }
@@ -0,0 +1,21 @@
+package port
+
+import "errors"
+
+// Errors the repositories return for conditions the core acts on. Every
+// adapter returns these, so the core can tell them apart whichever is in
+// use.
+var (
+	// ErrOptimisticLock means a write found the row changed since it was
+	// read, or the inventory short of the units it takes
+	ErrOptimisticLock = errors.New("optimistic lock conflict")
+	// ErrAllocationExhausted means an allocation has fewer units left than
+	// an order against it asks for
+	ErrAllocationExhausted = errors.New("allocation exhausted")
+	// ErrShardDown means the work goes to a database shard that stopped
+	// answering, and was refused without waiting on it
+	ErrShardDown = errors.New("mysql shard is down")
+	// ErrCrossShard means an order, or a batch of them, has items on
+	// different shards, which no one transaction can write
+	ErrCrossShard = errors.New("orders span items on different shards")
+)
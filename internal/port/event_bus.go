@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// EventBus carries domain events from the code where they happen to the
+// subscribers that act on them, such as metrics and notifications.
+type EventBus interface {
+	// Publish hands the event to every handler subscribed to its type. The
+	// handlers run before Publish returns, so they must not block
+	Publish(ctx context.Context, event domain.Event)
+
+	// Subscribe calls handle for every event of the type published from now on
+	Subscribe(eventType domain.EventType, handle func(context.Context, domain.Event))
+}
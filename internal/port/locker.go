@@ -0,0 +1,13 @@
+package port
+
+import (
+	"context"
+	"time"
+)
+
+// Locker provides named locks shared by all server instances.
+type Locker interface {
+	// TryLock acquires the lock for at most ttl without waiting. It reports false if
+	// the lock is held; release frees it only if it is still owned by this caller
+	TryLock(ctx context.Context, name string, ttl time.Duration) (release func(context.Context) error, ok bool, err error)
+}
@@ -0,0 +1,21 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// LotteryEntries collects the entries of lottery sales until they are drawn.
+type LotteryEntries interface {
+	// AddEntry records an entry, reporting false without recording it if the user has
+	// already entered the item's lottery
+	AddEntry(ctx context.Context, entry domain.LotteryEntry) (bool, error)
+
+	// DrawEntries removes and returns up to n of the item's entries, chosen at random. It
+	// returns none once every entry has been drawn
+	DrawEntries(ctx context.Context, itemID string, n int) ([]domain.LotteryEntry, error)
+
+	// LotteryItems lists the items with entries waiting to be drawn
+	LotteryItems(ctx context.Context) ([]string, error)
+}
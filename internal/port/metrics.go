@@ -0,0 +1,31 @@
+package port
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics records business level events from the core. Latency of
+// dependencies is measured by adapters wrapping the repositories.
+type Metrics interface {
+	// PurchaseCompleted records the outcome and latency of a purchase attempt;
+	// ctx carries the trace used for exemplars
+	PurchaseCompleted(ctx context.Context, outcome string, duration time.Duration)
+
+	// OrdersPersisted records orders saved by the workers
+	OrdersPersisted(count int)
+
+	// OrderFailed records an order that could not be saved and was rolled back
+	OrderFailed()
+
+	// StageTimedOut records a stage of a purchase, such as the stock
+	// decrement, that missed its deadline
+	StageTimedOut(stage string)
+}
+
+// JobMetrics records runs of the scheduled background jobs.
+type JobMetrics interface {
+	// JobCompleted records how long a run of the named job took and whether
+	// it failed
+	JobCompleted(job string, duration time.Duration, failed bool)
+}
@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// Notifier delivers notifications to users over a channel such as email, SMS
+// or push.
+type Notifier interface {
+	// Notify sends the notification to its user. An error means it was not
+	// delivered and may be retried
+	Notify(ctx context.Context, notification domain.Notification) error
+}
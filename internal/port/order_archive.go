@@ -0,0 +1,30 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderArchive moves old orders out of the orders table, which every
+// purchase writes to, into archive tables that are only read for reporting.
+type OrderArchive interface {
+	// ArchiveOrders moves up to limit orders created before the given time,
+	// oldest first and with their lines, in one transaction, returning how
+	// many it moved. Their copies in the order read model are dropped.
+	// Pending orders with a hold are left for the hold sweep to settle first
+	ArchiveOrders(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+// OrderOffload hands old orders to the caller to keep elsewhere, such as in
+// object storage, and deletes them once it has.
+type OrderOffload interface {
+	// OffloadOrders locks up to limit orders created before the given time,
+	// oldest first and with their lines, and passes them to keep. If keep
+	// succeeds they are deleted, with their copies in the order read model,
+	// in the same transaction, and how many is returned; if it fails they
+	// are left as they were. Pending orders with a hold are left for the
+	// hold sweep to settle first
+	OffloadOrders(ctx context.Context, before time.Time, limit int, keep func([]domain.Order) error) (int, error)
+}
@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderChangeLog reads the changes the event-sourced order store appends
+// in the transaction of each write to an order. Changes are never updated or
+// deleted, archived orders included, so the log can replay a whole sale.
+type OrderChangeLog interface {
+	// OrderChanges returns the changes of one order, oldest first
+	OrderChanges(ctx context.Context, orderID string) ([]domain.OrderChange, error)
+
+	// OrderChangesAfter returns up to limit changes of any order with a Seq
+	// after afterSeq, in Seq order, for reading the log a page at a time
+	OrderChangesAfter(ctx context.Context, afterSeq int64, limit int) ([]domain.OrderChange, error)
+}
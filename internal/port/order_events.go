@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderEventFeed broadcasts changes to orders to every server, for consumers
+// such as notifiers that tell buyers about them.
+type OrderEventFeed interface {
+	// PublishOrderEvent delivers the event to every watcher of the feed
+	PublishOrderEvent(ctx context.Context, event domain.OrderEvent) error
+
+	// WatchOrderEvents delivers the events published until ctx is done, then
+	// closes the channel
+	WatchOrderEvents(ctx context.Context) (<-chan domain.OrderEvent, error)
+}
@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderReadModel is a denormalized copy of the orders kept for the heavy
+// reads, order history and sale statistics, so they never scan the tables
+// or lock the inventory rows purchases write. It lags the orders by as
+// long as it takes to project each write.
+type OrderReadModel interface {
+	// ProjectOrders copies the current state of the orders with the given
+	// IDs into the read model, replacing any earlier copy. IDs of orders
+	// that do not exist are skipped
+	ProjectOrders(ctx context.Context, ids []string) error
+
+	// ListOrderViews is ListOrdersByUser of DatabaseRepository, answered
+	// from the read model
+	ListOrderViews(ctx context.Context, userID string, filter domain.OrderFilter) ([]domain.Order, error)
+
+	// ItemOrderTotals totals the orders of each of the items by status.
+	// Items without orders are left out
+	ItemOrderTotals(ctx context.Context, itemIDs []string) ([]domain.ItemOrderTotals, error)
+}
@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderResultFeed carries final order results from whichever instance
+// produced them to clients waiting on any instance.
+type OrderResultFeed interface {
+	// PublishOrderResult announces the final result of a purchase request
+	PublishOrderResult(ctx context.Context, result domain.OrderResult) error
+
+	// WatchOrderResult delivers results published for the request until ctx
+	// is done, then closes the channel
+	WatchOrderResult(ctx context.Context, requestID string) (<-chan domain.OrderResult, error)
+}
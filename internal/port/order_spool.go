@@ -0,0 +1,21 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// OrderSpool keeps queued orders that were not persisted before shutdown so
+// the next server to start can finish them.
+type OrderSpool interface {
+	// SpoolOrders saves orders for a later RecoverOrders
+	SpoolOrders(ctx context.Context, orders []domain.Order) error
+
+	// RecoverOrders removes and returns every spooled order. Each order is
+	// returned to exactly one caller, even across servers.
+	RecoverOrders(ctx context.Context) ([]domain.Order, error)
+
+	// SpooledOrders returns the spooled orders without removing them
+	SpooledOrders(ctx context.Context) ([]domain.Order, error)
+}
@@ -0,0 +1,17 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// PaymentEventSource delivers payment events from a message topic.
+type PaymentEventSource interface {
+	// Consume calls handle for each event until ctx is cancelled. An event is
+	// only acknowledged once handle returns nil
+	Consume(ctx context.Context, handle func(context.Context, domain.PaymentEvent) error) error
+
+	// Close releases the underlying connection
+	Close() error
+}
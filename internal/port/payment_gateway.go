@@ -0,0 +1,22 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// PaymentGateway charges buyers through a payment service provider.
+// Amounts are in minor currency units.
+type PaymentGateway interface {
+	// Authorize reserves the amount on the buyer's payment method. Repeating
+	// a request for the same order returns the same authorization
+	Authorize(ctx context.Context, req domain.PaymentRequest) (*domain.PaymentAuthorization, error)
+
+	// Capture collects an authorized amount
+	Capture(ctx context.Context, authorizationID string, amount int64) error
+
+	// Refund returns a captured amount, or releases an authorization that
+	// was never captured
+	Refund(ctx context.Context, authorizationID string, amount int64) error
+}
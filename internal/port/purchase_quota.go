@@ -0,0 +1,14 @@
+package port
+
+import "context"
+
+// PurchaseQuota counts the units each user has bought of an item, so a
+// per-user limit holds across purchases and server instances.
+type PurchaseQuota interface {
+	// ReserveQuota adds quantity to the user's count for the item and reports true, or
+	// reports false without changing it if the count would exceed limit
+	ReserveQuota(ctx context.Context, itemID, userID string, quantity, limit int) (bool, error)
+
+	// ReleaseQuota takes back units reserved for a purchase that did not go through
+	ReleaseQuota(ctx context.Context, itemID, userID string, quantity int) error
+}
@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// PurchaseRecords keeps the outcome of every purchase request by request ID,
+// so any instance can say what happened to a request.
+type PurchaseRecords interface {
+	// SavePurchaseRecord stores the record, replacing any earlier one for the
+	// request, and keeps it for ttl
+	SavePurchaseRecord(ctx context.Context, record domain.PurchaseRecord, ttl time.Duration) error
+
+	// GetPurchaseRecord returns the request's record, or nil if there is none
+	GetPurchaseRecord(ctx context.Context, requestID string) (*domain.PurchaseRecord, error)
+}
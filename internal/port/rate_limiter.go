@@ -0,0 +1,13 @@
+package port
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimiter throttles requests per key, such as a user ID or client IP.
+type RateLimiter interface {
+	// Allow reports whether a request for key may proceed now and, if not, how long
+	// the caller should wait before retrying
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
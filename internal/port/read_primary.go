@@ -0,0 +1,19 @@
+package port
+
+import "context"
+
+type readPrimaryKey struct{}
+
+// ReadPrimary marks reads made with the returned context as needing the
+// primary database, for reads that must see writes just made, such as a
+// version about to be used in a conditional update. Repositories without
+// read replicas read the primary anyway.
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// ReadsPrimary reports whether ctx was marked with ReadPrimary.
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return primary
+}
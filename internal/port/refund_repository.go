@@ -0,0 +1,33 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// RefundRepository persists refund sagas. Updates are conditional on the
+// refund's Version and bump it, so only one caller advances a refund.
+type RefundRepository interface {
+	// CreateRefund saves a new refund, returning false if the order already
+	// has one
+	CreateRefund(ctx context.Context, refund domain.Refund) (bool, error)
+
+	// GetRefundByOrder returns the order's refund, or nil if it has none
+	GetRefundByOrder(ctx context.Context, orderID string) (*domain.Refund, error)
+
+	// StaleRefunds returns up to limit unfinished refunds last updated
+	// before the given time, oldest first
+	StaleRefunds(ctx context.Context, before time.Time, limit int) ([]domain.Refund, error)
+
+	// UpdateRefund saves the refund's step, attempts and last error if its
+	// version is unchanged
+	UpdateRefund(ctx context.Context, refund domain.Refund) (bool, error)
+
+	// RestockRefund moves a refund past RefundStepInventory in the same
+	// transaction that returns the order's units to inventory, or to the
+	// allocation it was fulfilled from, and records a stock compensation
+	// for the cache
+	RestockRefund(ctx context.Context, refund domain.Refund) (bool, error)
+}
@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// RiskScorer assesses how likely a purchase is to be fraudulent before any
+// stock is taken for it.
+type RiskScorer interface {
+	Score(ctx context.Context, attempt domain.PurchaseAttempt) (domain.RiskAssessment, error)
+}
+
+// RiskSignals records the activity risk rules score purchases on, shared by
+// every server instance.
+type RiskSignals interface {
+	// CountAttempt adds an attempt under key and returns how many it has in the
+	// current window, which starts with the first attempt and lasts window
+	CountAttempt(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// FirstSeen records at as the first time the user was seen unless one is
+	// already recorded, and returns the recorded time
+	FirstSeen(ctx context.Context, userID string, at time.Time) (time.Time, error)
+}
@@ -0,0 +1,29 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// SaleCounters keeps the live counters of a campaign's sale in one place,
+// so the figures add up over every server. Writes go to the campaign the
+// adapter is scoped to.
+type SaleCounters interface {
+	// RecordOrders counts orders saved at the given time and the units they sold
+	RecordOrders(ctx context.Context, orders, units int, at time.Time) error
+
+	// RecordFailure counts a purchase or order that failed with outcome
+	RecordFailure(ctx context.Context, outcome string) error
+
+	// RecordSoldOut notes when an item sold out; later calls for the item are ignored
+	RecordSoldOut(ctx context.Context, itemID string, at time.Time) error
+
+	// AddQueued changes the number of orders waiting for a worker by delta
+	AddQueued(ctx context.Context, delta int) error
+
+	// SaleCounters reads a campaign's counters, with RecentOrders counting the
+	// orders saved in the whole seconds of window before now
+	SaleCounters(ctx context.Context, campaignID string, now time.Time, window time.Duration) (*domain.SaleCounters, error)
+}
@@ -0,0 +1,9 @@
+package port
+
+// ShardRouter tells which database shard holds an item, along with its
+// inventory and orders, for databases spread over several.
+type ShardRouter interface {
+	// ShardOf returns the index of the item's shard, below Shards
+	ShardOf(itemID string) int
+	Shards() int
+}
@@ -0,0 +1,14 @@
+package port
+
+import "context"
+
+// SoldOutFeed broadcasts items selling out to every server, so each can turn
+// away purchases of them without asking the cache.
+type SoldOutFeed interface {
+	// PublishSoldOut tells every server watching the feed that the item sold out
+	PublishSoldOut(ctx context.Context, itemID string) error
+
+	// WatchSoldOut delivers the ID of each item published as sold out until ctx is
+	// done, then closes the channel
+	WatchSoldOut(ctx context.Context) (<-chan string, error)
+}
@@ -0,0 +1,10 @@
+package port
+
+import "context"
+
+// StockFeed is implemented by caches that publish stock level changes.
+type StockFeed interface {
+	// WatchStock delivers the item's stock level after each change until ctx
+	// is done, then closes the channel. Slow receivers only see the latest level.
+	WatchStock(ctx context.Context, itemID string) (<-chan int, error)
+}
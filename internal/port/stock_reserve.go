@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// StockReserve takes stock while leaving part of it untouched, so units can
+// be kept for some buyers.
+type StockReserve interface {
+	// DecrementStockAbove is DecrementStock that reports StockInsufficient rather than
+	// take the stock below floor units
+	DecrementStockAbove(ctx context.Context, itemID string, quantity, floor int) (domain.StockDecrement, error)
+}
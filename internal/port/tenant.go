@@ -0,0 +1,20 @@
+package port
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant marks work done with the returned context as done for tenant,
+// the merchant whose sale it belongs to; "" is the default tenant.
+// Repositories keep such work to the tenant's data. Work with no tenant,
+// such as the workers and scheduled jobs, spans every tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantOf returns the tenant ctx was marked with by WithTenant, and whether
+// it was.
+func TenantOf(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
@@ -0,0 +1,16 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rl1809/flash-sale/internal/core/domain"
+)
+
+// UserTierRepository stores the tiers of users who are not TierNormal.
+type UserTierRepository interface {
+	// SetUserTier records the user's tier. Setting TierNormal removes the record
+	SetUserTier(ctx context.Context, userID string, tier domain.UserTier) error
+
+	// ListUserTiers returns the tier of every user who has one recorded
+	ListUserTiers(ctx context.Context) (map[string]domain.UserTier, error)
+}
@@ -0,0 +1,265 @@
+// Package simulation runs complete flash sales in-process against the
+// in-memory adapters, so campaign behavior can be regression tested without
+// Redis or MySQL.
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// Campaign describes the sale being simulated.
+type Campaign struct {
+	ID              string
+	ItemID          string
+	Stock           int
+	IdempotencyMode service.IdempotencyMode
+}
+
+// Population describes the buyers.
+type Population struct {
+	Users           int
+	AttemptsPerUser int
+	Quantity        int
+	// RetryProbability is the chance that a client re-sends a request with
+	// the same request ID after receiving its response.
+	RetryProbability float64
+}
+
+// ArrivalCurve returns the start offset of each of n requests.
+type ArrivalCurve func(n int) []time.Duration
+
+// Burst sends every request at once.
+func Burst() ArrivalCurve {
+	return func(n int) []time.Duration {
+		return make([]time.Duration, n)
+	}
+}
+
+// Uniform spreads requests evenly over d.
+func Uniform(d time.Duration) ArrivalCurve {
+	return func(n int) []time.Duration {
+		offsets := make([]time.Duration, n)
+		for i := range offsets {
+			offsets[i] = d * time.Duration(i) / time.Duration(n)
+		}
+		return offsets
+	}
+}
+
+// RampUp spreads requests over d with the arrival rate growing linearly,
+// like traffic building up towards the sale opening.
+func RampUp(d time.Duration) ArrivalCurve {
+	return func(n int) []time.Duration {
+		offsets := make([]time.Duration, n)
+		for i := range offsets {
+			offsets[i] = time.Duration(float64(d) * math.Sqrt(float64(i)/float64(n)))
+		}
+		return offsets
+	}
+}
+
+type Scenario struct {
+	Campaign   Campaign
+	Population Population
+	Arrival    ArrivalCurve
+	Workers    int
+	QueueSize  int
+	Seed       uint64
+}
+
+// Report is the accounting of a finished sale.
+type Report struct {
+	InitialStock int
+
+	Attempts   int
+	Retries    int
+	Succeeded  int
+	SoldOut    int
+	Duplicates int
+	Errors     int
+
+	// UnitsSold counts units of distinct successful orders; replayed
+	// retries are not counted twice.
+	UnitsSold      int
+	OrdersAccepted int
+
+	OrdersPersisted int
+	UnitsPersisted  int
+	CacheStock      int
+	DatabaseStock   int
+
+	Duration time.Duration
+}
+
+// Verify checks that every unit of stock is accounted for exactly once
+// across the cache, the accepted orders and the database.
+func (r *Report) Verify() error {
+	var errs []error
+
+	if r.UnitsSold > r.InitialStock {
+		errs = append(errs, fmt.Errorf("oversold: %d units sold of %d", r.UnitsSold, r.InitialStock))
+	}
+	if r.CacheStock != r.InitialStock-r.UnitsSold {
+		errs = append(errs, fmt.Errorf("cache stock %d, expected %d", r.CacheStock, r.InitialStock-r.UnitsSold))
+	}
+	if r.OrdersPersisted != r.OrdersAccepted {
+		errs = append(errs, fmt.Errorf("%d orders persisted, expected %d", r.OrdersPersisted, r.OrdersAccepted))
+	}
+	if r.UnitsPersisted != r.UnitsSold {
+		errs = append(errs, fmt.Errorf("%d units persisted, expected %d", r.UnitsPersisted, r.UnitsSold))
+	}
+	if r.DatabaseStock != r.InitialStock-r.UnitsSold {
+		errs = append(errs, fmt.Errorf("database stock %d, expected %d", r.DatabaseStock, r.InitialStock-r.UnitsSold))
+	}
+	if total := r.Succeeded + r.SoldOut + r.Duplicates + r.Errors; total != r.Attempts+r.Retries {
+		errs = append(errs, fmt.Errorf("%d responses for %d requests", total, r.Attempts+r.Retries))
+	}
+
+	return errors.Join(errs...)
+}
+
+type request struct {
+	requestID string
+	userID    string
+	retry     bool
+}
+
+// Run executes the scenario and returns its accounting once every order has
+// been persisted.
+func Run(ctx context.Context, sc Scenario) (*Report, error) {
+	if sc.Population.Quantity <= 0 {
+		sc.Population.Quantity = 1
+	}
+	if sc.Population.AttemptsPerUser <= 0 {
+		sc.Population.AttemptsPerUser = 1
+	}
+	if sc.Workers <= 0 {
+		sc.Workers = 4
+	}
+	if sc.QueueSize <= 0 {
+		sc.QueueSize = sc.Population.Users * sc.Population.AttemptsPerUser
+	}
+	if sc.Arrival == nil {
+		sc.Arrival = Burst()
+	}
+	if sc.Campaign.IdempotencyMode == "" {
+		sc.Campaign.IdempotencyMode = service.IdempotencyPerRequest
+	}
+
+	cache := memory.NewCache()
+	db := memory.NewDatabase()
+	if err := cache.SetStock(ctx, sc.Campaign.ItemID, sc.Campaign.Stock); err != nil {
+		return nil, err
+	}
+	db.SetInventory(sc.Campaign.ItemID, sc.Campaign.Stock)
+
+	svc := service.NewOrderService(cache, sc.QueueSize,
+		service.WithIdempotency(sc.Campaign.IdempotencyMode, time.Hour),
+		service.WithCampaign(sc.Campaign.ID),
+	)
+
+	settings := service.DefaultWorkerSettings()
+	settings.FlushInterval = time.Millisecond
+	tuning, err := service.NewWorkerTuning(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < sc.Workers; i++ {
+		worker := service.NewOrderWorker(i, svc.GetOrderQueue(), db, cache, tuning)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker.Run()
+		}()
+	}
+
+	rng := rand.New(rand.NewPCG(sc.Seed, sc.Seed))
+	var requests []request
+	for u := 0; u < sc.Population.Users; u++ {
+		for a := 0; a < sc.Population.AttemptsPerUser; a++ {
+			requests = append(requests, request{
+				requestID: fmt.Sprintf("req-%d-%d", u, a),
+				userID:    fmt.Sprintf("user-%d", u),
+				retry:     rng.Float64() < sc.Population.RetryProbability,
+			})
+		}
+	}
+	rng.Shuffle(len(requests), func(i, j int) {
+		requests[i], requests[j] = requests[j], requests[i]
+	})
+	offsets := sc.Arrival(len(requests))
+
+	report := &Report{InitialStock: sc.Campaign.Stock, Attempts: len(requests)}
+	orders := make(map[string]bool)
+	var mu sync.Mutex
+
+	record := func(orderID string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case err == nil:
+			report.Succeeded++
+			if !orders[orderID] {
+				orders[orderID] = true
+				report.OrdersAccepted++
+				report.UnitsSold += sc.Population.Quantity
+			}
+		case errors.Is(err, service.ErrInsufficientStock):
+			report.SoldOut++
+		case errors.Is(err, service.ErrDuplicateRequest):
+			report.Duplicates++
+		default:
+			report.Errors++
+		}
+	}
+
+	start := time.Now()
+	var clients sync.WaitGroup
+	for i, req := range requests {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			time.Sleep(offsets[i])
+
+			record(svc.Purchase(ctx, req.requestID, req.userID, sc.Campaign.ItemID, sc.Population.Quantity))
+			if req.retry {
+				mu.Lock()
+				report.Retries++
+				mu.Unlock()
+				record(svc.Purchase(ctx, req.requestID, req.userID, sc.Campaign.ItemID, sc.Population.Quantity))
+			}
+		}()
+	}
+	clients.Wait()
+
+	svc.Close()
+	workers.Wait()
+	report.Duration = time.Since(start)
+
+	for _, order := range db.Orders() {
+		report.OrdersPersisted++
+		report.UnitsPersisted += order.Quantity
+	}
+	if report.CacheStock, err = cache.GetStock(ctx, sc.Campaign.ItemID); err != nil {
+		return nil, err
+	}
+	inv, err := db.GetInventory(ctx, sc.Campaign.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	report.DatabaseStock = inv.Quantity
+
+	return report, nil
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS stock_compensations;
+DROP TABLE IF EXISTS restock_audit;
+DROP TABLE IF EXISTS campaign_archives;
+DROP TABLE IF EXISTS campaigns;
+DROP TABLE IF EXISTS allocations;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS inventory;
+DROP TABLE IF EXISTS items;
@@ -0,0 +1,109 @@
+CREATE TABLE IF NOT EXISTS items (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS inventory (
+    item_id VARCHAR(255) PRIMARY KEY,
+    stock INT NOT NULL DEFAULT 0,
+    version INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id VARCHAR(255) PRIMARY KEY,
+    item_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL DEFAULT 1,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    allocation_id VARCHAR(255) NULL,
+    unit_price BIGINT NOT NULL DEFAULT 0,
+    total_price BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    payment_id VARCHAR(255) NULL,
+    idempotency_key VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_item_id (item_id),
+    INDEX idx_user_id (user_id),
+    INDEX idx_allocation_id (allocation_id),
+    INDEX idx_status_expires_at (status, expires_at)
+);
+
+CREATE TABLE IF NOT EXISTS allocations (
+    id VARCHAR(255) PRIMARY KEY,
+    partner_id VARCHAR(255) NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    fulfilled INT NOT NULL DEFAULT 0,
+    status VARCHAR(50) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_partner_id (partner_id)
+);
+
+CREATE TABLE IF NOT EXISTS campaigns (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    item_ids JSON NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_starts_at (starts_at)
+);
+
+CREATE TABLE IF NOT EXISTS campaign_archives (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    campaign_id VARCHAR(255) NOT NULL,
+    final_stock JSON NOT NULL,
+    frozen_items JSON NOT NULL,
+    closed_items JSON NOT NULL,
+    idempotency_keys INT NOT NULL DEFAULT 0,
+    archived_at TIMESTAMP NOT NULL,
+    INDEX idx_campaign_id (campaign_id)
+);
+
+CREATE TABLE IF NOT EXISTS restock_audit (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    stock_before INT NOT NULL,
+    stock_after INT NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    reason VARCHAR(1024) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    INDEX idx_item_id (item_id)
+);
+
+CREATE TABLE IF NOT EXISTS stock_compensations (
+    id VARCHAR(36) PRIMARY KEY,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    reason VARCHAR(1024) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1024) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP NULL,
+    INDEX idx_resolved_created (resolved_at, created_at)
+);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id VARCHAR(36) PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    payment_id VARCHAR(255) NULL,
+    amount BIGINT NOT NULL DEFAULT 0,
+    reason VARCHAR(1024) NOT NULL DEFAULT '',
+    step VARCHAR(50) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1024) NOT NULL DEFAULT '',
+    version INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE KEY uniq_order_id (order_id),
+    INDEX idx_step_updated (step, updated_at)
+);
@@ -0,0 +1,2 @@
+DELETE FROM inventory WHERE item_id = 'iphone-15';
+DELETE FROM items WHERE id = 'iphone-15';
@@ -0,0 +1,2 @@
+INSERT IGNORE INTO items (id, name) VALUES ('iphone-15', 'iPhone 15');
+INSERT IGNORE INTO inventory (item_id, stock, version) VALUES ('iphone-15', 100, 0);
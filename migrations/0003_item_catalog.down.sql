@@ -0,0 +1,6 @@
+ALTER TABLE orders DROP COLUMN currency;
+
+ALTER TABLE items
+    DROP COLUMN max_per_user,
+    DROP COLUMN currency,
+    DROP COLUMN price;
@@ -0,0 +1,7 @@
+ALTER TABLE items
+    ADD COLUMN price BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD',
+    ADD COLUMN max_per_user INT NOT NULL DEFAULT 0;
+
+ALTER TABLE orders
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id VARCHAR(255) NOT NULL,
+    line INT NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    unit_price BIGINT NOT NULL DEFAULT 0,
+    total_price BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, line),
+    INDEX idx_item_id (item_id)
+);
+
+INSERT INTO order_items (order_id, line, item_id, quantity, unit_price, total_price)
+SELECT id, 0, item_id, quantity, unit_price, total_price FROM orders;
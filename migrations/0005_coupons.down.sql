@@ -0,0 +1,5 @@
+ALTER TABLE orders
+    DROP COLUMN discount,
+    DROP COLUMN coupon_code;
+
+DROP TABLE IF EXISTS coupons;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS coupons (
+    code VARCHAR(32) PRIMARY KEY,
+    percent_off INT NOT NULL DEFAULT 0,
+    amount_off BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    max_uses INT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+ALTER TABLE orders
+    ADD COLUMN coupon_code VARCHAR(32) NULL,
+    ADD COLUMN discount BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS user_tiers (
+    user_id VARCHAR(64) PRIMARY KEY,
+    tier VARCHAR(16) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
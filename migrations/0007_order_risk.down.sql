@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP COLUMN risk_flagged,
+    DROP COLUMN risk_score;
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD COLUMN risk_score INT NOT NULL DEFAULT 0,
+    ADD COLUMN risk_flagged BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD INDEX idx_user_id (user_id),
+    DROP INDEX idx_user_created;
@@ -0,0 +1,6 @@
+-- Serves order history pages: the seek on (created_at, id) and the status
+-- filter are both resolved from the index. It has user_id as its prefix, so
+-- it replaces idx_user_id
+ALTER TABLE orders
+    ADD INDEX idx_user_created (user_id, created_at, id, status),
+    DROP INDEX idx_user_id;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    before_state JSON NULL,
+    after_state JSON NULL,
+    reason VARCHAR(1024) NOT NULL DEFAULT '',
+    created_at TIMESTAMP(6) NOT NULL,
+    INDEX idx_audit_target (target, id),
+    INDEX idx_audit_actor (actor, id),
+    INDEX idx_audit_action (action, id)
+);
+
+-- The log is append-only: refuse changes to records already written
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
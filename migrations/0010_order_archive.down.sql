@@ -0,0 +1,5 @@
+ALTER TABLE orders
+    DROP INDEX idx_created_at;
+
+DROP TABLE IF EXISTS order_items_archive;
+DROP TABLE IF EXISTS orders_archive;
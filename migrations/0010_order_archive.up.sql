@@ -0,0 +1,39 @@
+-- Orders past their retention are moved here by the archive job. The
+-- columns follow orders and order_items, so a column added to either needs
+-- adding to its archive table too.
+CREATE TABLE IF NOT EXISTS orders_archive (
+    id VARCHAR(255) PRIMARY KEY,
+    item_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL DEFAULT 1,
+    status VARCHAR(50) NOT NULL,
+    allocation_id VARCHAR(255) NULL,
+    unit_price BIGINT NOT NULL DEFAULT 0,
+    total_price BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    coupon_code VARCHAR(32) NULL,
+    discount BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NULL,
+    payment_id VARCHAR(255) NULL,
+    risk_score INT NOT NULL DEFAULT 0,
+    risk_flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    idempotency_key VARCHAR(255) NULL,
+    created_at TIMESTAMP NULL,
+    updated_at TIMESTAMP NULL,
+    archived_at TIMESTAMP NOT NULL,
+    INDEX idx_user_created (user_id, created_at),
+    INDEX idx_item_id (item_id)
+);
+
+CREATE TABLE IF NOT EXISTS order_items_archive (
+    order_id VARCHAR(255) NOT NULL,
+    line INT NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    unit_price BIGINT NOT NULL DEFAULT 0,
+    total_price BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, line)
+);
+
+ALTER TABLE orders
+    ADD INDEX idx_created_at (created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE campaigns
+    DROP INDEX idx_tenant_starts_at,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE items
+    DROP INDEX idx_tenant_id,
+    DROP COLUMN tenant_id;
@@ -0,0 +1,9 @@
+-- Items and campaigns belong to a tenant, the merchant whose sale they are
+-- part of. Rows from before tenants belong to the default tenant ''.
+ALTER TABLE items
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id,
+    ADD INDEX idx_tenant_id (tenant_id);
+
+ALTER TABLE campaigns
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id,
+    ADD INDEX idx_tenant_starts_at (tenant_id, starts_at);
@@ -0,0 +1,33 @@
+-- The order read model: one row per order line, each carrying the details
+-- of its order, copied by the servers after every write to an order. Order
+-- history reads the first lines by user and sale statistics total the lines
+-- by item, so neither scans orders or waits on the inventory rows purchases
+-- lock.
+CREATE TABLE IF NOT EXISTS order_views (
+    order_id VARCHAR(255) NOT NULL,
+    line INT NOT NULL,
+    line_count INT NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    item_id VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    total_price BIGINT NOT NULL DEFAULT 0,
+    order_quantity INT NOT NULL,
+    order_total BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    coupon_code VARCHAR(32) NULL,
+    discount BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    created_at TIMESTAMP NULL,
+    updated_at TIMESTAMP NULL,
+    PRIMARY KEY (order_id, line),
+    INDEX idx_user_line_created (user_id, line, created_at, order_id, status),
+    INDEX idx_item_status (item_id, status)
+);
+
+INSERT INTO order_views (order_id, line, line_count, user_id, item_id, quantity, total_price, order_quantity, order_total,
+    currency, coupon_code, discount, status, expires_at, created_at, updated_at)
+SELECT oi.order_id, oi.line, (SELECT COUNT(*) FROM order_items c WHERE c.order_id = o.id), o.user_id, oi.item_id,
+    oi.quantity, oi.total_price, o.quantity, o.total_price, o.currency, o.coupon_code, o.discount, o.status,
+    o.expires_at, o.created_at, o.updated_at
+FROM orders o JOIN order_items oi ON oi.order_id = o.id;
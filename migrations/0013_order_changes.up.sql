@@ -0,0 +1,14 @@
+-- The change log of the event-sourced order store (ORDER_STORE=events):
+-- every write to an order appends a row here in its transaction, and an
+-- order's current state is derived from its rows in seq order. Rows are
+-- never updated or deleted, so the log replays a whole sale. data holds
+-- the order as accepted, on accepted changes only.
+CREATE TABLE IF NOT EXISTS order_changes (
+    seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+    order_id VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    data JSON NULL,
+    payment_id VARCHAR(255) NULL,
+    occurred_at TIMESTAMP(6) NOT NULL,
+    INDEX idx_order_seq (order_id, seq)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE orders REMOVE PARTITIONING;
+
+ALTER TABLE orders
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (id),
+    MODIFY created_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,19 @@
+-- Orders are partitioned by the time they were created, so a sale day's
+-- reads and writes touch its own partition however much history the table
+-- holds, and archived days are dropped as a whole. MySQL requires the
+-- partitioning column in every unique key, so created_at joins the primary
+-- key; ids stay unique as the server generates them.
+-- The table starts with one partition holding everything. With
+-- ORDER_PARTITIONS set, the server splits day or month partitions off it
+-- ahead of time and drops the ones archiving has emptied.
+UPDATE orders SET created_at = COALESCE(updated_at, CURRENT_TIMESTAMP) WHERE created_at IS NULL;
+
+ALTER TABLE orders
+    MODIFY created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (id, created_at);
+
+ALTER TABLE orders
+    PARTITION BY RANGE (UNIX_TIMESTAMP(created_at)) (
+        PARTITION p_max VALUES LESS THAN MAXVALUE
+    );
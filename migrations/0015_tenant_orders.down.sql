@@ -0,0 +1,15 @@
+ALTER TABLE order_views
+    DROP INDEX idx_tenant_user_line_created,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE orders_archive
+    DROP INDEX idx_tenant_user_created,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE orders
+    DROP INDEX idx_tenant_user_created,
+    DROP COLUMN tenant_id;
+
+ALTER TABLE inventory
+    DROP INDEX idx_tenant_id,
+    DROP COLUMN tenant_id;
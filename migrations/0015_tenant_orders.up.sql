@@ -0,0 +1,26 @@
+-- Orders and inventory belong to the tenant of their items, so a tenant's
+-- order reads and stock writes never see another merchant's rows. Existing
+-- rows take the tenant of the item they are for.
+ALTER TABLE inventory
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER item_id,
+    ADD INDEX idx_tenant_id (tenant_id);
+
+UPDATE inventory SET tenant_id = COALESCE((SELECT tenant_id FROM items WHERE items.id = inventory.item_id), '');
+
+ALTER TABLE orders
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id,
+    ADD INDEX idx_tenant_user_created (tenant_id, user_id, created_at, id, status);
+
+UPDATE orders SET tenant_id = COALESCE((SELECT tenant_id FROM items WHERE items.id = orders.item_id), '');
+
+ALTER TABLE orders_archive
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id,
+    ADD INDEX idx_tenant_user_created (tenant_id, user_id, created_at);
+
+UPDATE orders_archive SET tenant_id = COALESCE((SELECT tenant_id FROM items WHERE items.id = orders_archive.item_id), '');
+
+ALTER TABLE order_views
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '' AFTER line_count,
+    ADD INDEX idx_tenant_user_line_created (tenant_id, user_id, line, created_at, order_id, status);
+
+UPDATE order_views SET tenant_id = COALESCE((SELECT tenant_id FROM orders WHERE orders.id = order_views.order_id), '');
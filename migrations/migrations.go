@@ -0,0 +1,8 @@
+// Package migrations embeds the MySQL schema. Each version has an up and a
+// down file, named NNNN_description.up.sql and NNNN_description.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
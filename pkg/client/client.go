@@ -0,0 +1,221 @@
+// Package client is a Go client for the flash sale OrderService gRPC API.
+//
+// A Client retries calls the server could not take, answered with
+// UNAVAILABLE: while it is down, busy or the sale is paused. Purchases are
+// safe to retry because each carries a request ID the server remembers: a
+// purchase retried after its response was lost is answered with the
+// original result instead of buying twice. Purchase fills in a request ID
+// if the request has none, and RequestIDFor derives one from a key of the
+// caller's own, so a caller that restarts retries with the same ID.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// Defaults for the retries of calls answered with UNAVAILABLE
+const (
+	DefaultAttempts   = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+// requestIDNamespace scopes the request IDs derived by RequestIDFor.
+var requestIDNamespace = uuid.MustParse("5b0c9f3e-8a53-4c55-9f0e-3c1d2e6a7b48")
+
+// Client calls the OrderService API. It is safe for concurrent use.
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  pb.OrderServiceClient
+
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+}
+
+type options struct {
+	creds       credentials.TransportCredentials
+	dialOptions []grpc.DialOption
+	client      Client
+}
+
+type Option func(*options)
+
+// WithTLS connects over TLS with config. Without it, connections are in
+// plain text.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.creds = credentials.NewTLS(config)
+	}
+}
+
+// WithDialOptions adds options to the connection, such as interceptors or
+// keepalive parameters.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.dialOptions = append(o.dialOptions, opts...)
+	}
+}
+
+// WithRetries makes up to attempts tries at calls answered with
+// UNAVAILABLE, waiting a random delay of up to backoff before the first
+// retry, doubling up to maxBackoff. A delay the server asks for is waited
+// out instead when it is longer. One attempt does not retry.
+func WithRetries(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.client.attempts = max(attempts, 1)
+		o.client.backoff = backoff
+		o.client.maxBackoff = maxBackoff
+	}
+}
+
+// WithAttemptTimeout gives up on each attempt of a purchase after timeout,
+// which counts as UNAVAILABLE and is retried. The caller's deadline still
+// bounds the call as a whole.
+func WithAttemptTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.client.timeout = timeout
+	}
+}
+
+// New returns a client of the server at target, such as
+// "flash-sale:50051". It connects when first used.
+func New(target string, opts ...Option) (*Client, error) {
+	o := options{
+		creds:  insecure.NewCredentials(),
+		client: Client{attempts: DefaultAttempts, backoff: DefaultBackoff, maxBackoff: DefaultMaxBackoff},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	conn, err := grpc.NewClient(target, append([]grpc.DialOption{grpc.WithTransportCredentials(o.creds)}, o.dialOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	c := o.client
+	c.conn, c.rpc = conn, pb.NewOrderServiceClient(conn)
+	return &c, nil
+}
+
+// Close closes the client's connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// NewRequestID returns a random request ID, for a purchase the caller
+// makes once.
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// RequestIDFor derives the request ID of a purchase from a key the caller
+// has for it, such as the ID of the message asking for it, so the purchase
+// keeps its request ID when the caller retries it after restarting. The IDs
+// are UUIDs, as servers that check request IDs require.
+func RequestIDFor(key string) string {
+	return uuid.NewSHA1(requestIDNamespace, []byte(key)).String()
+}
+
+// Purchase buys what req asks for, filling in a request ID if it has none.
+// req is not modified. A rejected purchase returns an *Error with the
+// reason.
+func (c *Client) Purchase(ctx context.Context, req *pb.PurchaseRequest, opts ...grpc.CallOption) (*pb.PurchaseResponse, error) {
+	if req.GetRequestId() == "" {
+		req = proto.CloneOf(req)
+		req.RequestId = NewRequestID()
+	}
+
+	var resp *pb.PurchaseResponse
+	err := c.retry(ctx, func(ctx context.Context) error {
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+		var err error
+		resp, err = c.rpc.Purchase(ctx, req, opts...)
+		if status.Code(err) == codes.DeadlineExceeded && c.timeout > 0 {
+			return status.Error(codes.Unavailable, "attempt timed out")
+		}
+		return err
+	})
+	if err != nil {
+		return nil, asError(err)
+	}
+	return resp, nil
+}
+
+// WatchStock calls update with the item's stock level, then with every
+// change, until ctx is done, the server ends the stream, which returns nil,
+// or the stream fails with anything but UNAVAILABLE. A stream the server drops is opened again, retrying as
+// calls are; a stream that got updates starts over with a fresh set of
+// attempts.
+func (c *Client) WatchStock(ctx context.Context, itemID string, update func(remaining int), opts ...grpc.CallOption) error {
+	for {
+		received := false
+		err := c.retry(ctx, func(ctx context.Context) error {
+			stream, err := c.rpc.WatchStock(ctx, &pb.WatchStockRequest{ItemId: itemID}, opts...)
+			if err != nil {
+				return err
+			}
+			for {
+				msg, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				received = true
+				update(int(msg.GetRemaining()))
+			}
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if !received || status.Code(err) != codes.Unavailable {
+			return asError(err)
+		}
+	}
+}
+
+// retry calls call until it returns anything but UNAVAILABLE or the
+// attempts run out.
+func (c *Client) retry(ctx context.Context, call func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 {
+			delay := rand.N(min(c.backoff<<(attempt-1), c.maxBackoff) + 1)
+			if e, ok := asError(err).(*Error); ok && e.RetryAfter > delay {
+				delay = e.RetryAfter
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		if err = call(ctx); status.Code(err) != codes.Unavailable {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// fakeServer fails the first calls it is given with failures, then places
+// one order per request ID.
+type fakeServer struct {
+	pb.UnimplementedOrderServiceServer
+
+	mu         sync.Mutex
+	failures   []error
+	requestIDs []string
+	orders     map[string]string
+}
+
+func (s *fakeServer) Purchase(ctx context.Context, req *pb.PurchaseRequest) (*pb.PurchaseResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requestIDs = append(s.requestIDs, req.GetRequestId())
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		return nil, err
+	}
+	if s.orders == nil {
+		s.orders = make(map[string]string)
+	}
+	if _, ok := s.orders[req.GetRequestId()]; !ok {
+		s.orders[req.GetRequestId()] = "order-" + req.GetRequestId()
+	}
+	return &pb.PurchaseResponse{Success: true, OrderId: s.orders[req.GetRequestId()]}, nil
+}
+
+func (s *fakeServer) WatchStock(req *pb.WatchStockRequest, stream pb.OrderService_WatchStockServer) error {
+	s.mu.Lock()
+	failed := len(s.failures) > 0
+	if failed {
+		s.failures = s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if err := stream.Send(&pb.StockUpdate{ItemId: req.GetItemId(), Remaining: 5}); err != nil {
+		return err
+	}
+	if failed {
+		return status.Error(codes.Unavailable, "stock updates unavailable")
+	}
+	return stream.Send(&pb.StockUpdate{ItemId: req.GetItemId(), Remaining: 4})
+}
+
+func newTestClient(t *testing.T, srv *fakeServer, opts ...Option) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterOrderServiceServer(server, srv)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	dial := WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	c, err := New("passthrough:///bufnet", append([]Option{dial, WithRetries(3, time.Millisecond, time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func unavailable(t *testing.T, retryAfter time.Duration) error {
+	t.Helper()
+	st, err := status.New(codes.Unavailable, "overloaded").WithDetails(
+		&errdetails.ErrorInfo{Reason: "OVERLOADED", Domain: "flashsale"},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	return st.Err()
+}
+
+func TestPurchase_RetriesUnavailableWithSameRequestID(t *testing.T) {
+	srv := &fakeServer{failures: []error{unavailable(t, 10*time.Millisecond)}}
+	c := newTestClient(t, srv)
+
+	req := &pb.PurchaseRequest{UserId: "u1", ItemId: "item", Quantity: 1}
+	start := time.Now()
+	resp, err := c.Purchase(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("retried after %v, want the server's 10ms", elapsed)
+	}
+	if req.GetRequestId() != "" {
+		t.Error("Purchase modified the caller's request")
+	}
+	if len(srv.requestIDs) != 2 || srv.requestIDs[0] == "" || srv.requestIDs[0] != srv.requestIDs[1] {
+		t.Fatalf("request IDs = %q, want the same generated ID twice", srv.requestIDs)
+	}
+	if resp.GetOrderId() != "order-"+srv.requestIDs[0] {
+		t.Errorf("order ID = %q", resp.GetOrderId())
+	}
+}
+
+func TestPurchase_GivesUpAfterAttempts(t *testing.T) {
+	srv := &fakeServer{failures: []error{
+		unavailable(t, 0), unavailable(t, 0), unavailable(t, 0), unavailable(t, 0),
+	}}
+	c := newTestClient(t, srv)
+
+	_, err := c.Purchase(context.Background(), &pb.PurchaseRequest{RequestId: "r1", UserId: "u1", ItemId: "item", Quantity: 1})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("err = %v, want UNAVAILABLE", err)
+	}
+	if ErrorCodeOf(err) != pb.ErrorCode_ERROR_CODE_OVERLOADED {
+		t.Errorf("error code = %v, want OVERLOADED", ErrorCodeOf(err))
+	}
+	if len(srv.requestIDs) != 3 {
+		t.Errorf("attempts = %d, want 3", len(srv.requestIDs))
+	}
+}
+
+func TestPurchase_DoesNotRetryRejections(t *testing.T) {
+	st, _ := status.New(codes.ResourceExhausted, "item sold out").WithDetails(
+		&errdetails.ErrorInfo{Reason: "SOLD_OUT", Domain: "flashsale"},
+		&pb.PurchaseResponse{ErrorCode: pb.ErrorCode_ERROR_CODE_SOLD_OUT, RemainingStockHint: new(int32)},
+	)
+	invalid, _ := status.New(codes.InvalidArgument, "invalid request").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "user_id", Description: "required"}}},
+	)
+	srv := &fakeServer{failures: []error{st.Err(), invalid.Err()}}
+	c := newTestClient(t, srv)
+
+	_, err := c.Purchase(context.Background(), &pb.PurchaseRequest{RequestId: "r1", UserId: "u1", ItemId: "item", Quantity: 1})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("err = %T %v, want *Error", err, err)
+	}
+	if e.Code != codes.ResourceExhausted || e.ErrorCode != pb.ErrorCode_ERROR_CODE_SOLD_OUT || e.RemainingStockHint == nil {
+		t.Errorf("err = %+v, want sold out with a stock hint", e)
+	}
+	if len(srv.requestIDs) != 1 {
+		t.Errorf("attempts = %d, want 1", len(srv.requestIDs))
+	}
+
+	_, err = c.Purchase(context.Background(), &pb.PurchaseRequest{RequestId: "r2", ItemId: "item", Quantity: 1})
+	if e, ok := err.(*Error); !ok || e.Fields["user_id"] != "required" {
+		t.Errorf("err = %v, want a user_id violation", err)
+	}
+}
+
+func TestRequestIDFor(t *testing.T) {
+	a, b := RequestIDFor("msg-1"), RequestIDFor("msg-2")
+	if a != RequestIDFor("msg-1") {
+		t.Error("RequestIDFor is not deterministic")
+	}
+	if a == b {
+		t.Error("different keys gave the same request ID")
+	}
+	if len(a) != 36 {
+		t.Errorf("request ID %q is not a UUID", a)
+	}
+}
+
+func TestWatchStock_ReconnectsWhenDropped(t *testing.T) {
+	srv := &fakeServer{failures: []error{nil}}
+	c := newTestClient(t, srv)
+
+	var levels []int
+	err := c.WatchStock(context.Background(), "item", func(remaining int) {
+		levels = append(levels, remaining)
+	})
+	if err != nil {
+		t.Fatalf("WatchStock: %v", err)
+	}
+	want := []int{5, 5, 4}
+	if len(levels) != len(want) {
+		t.Fatalf("levels = %v, want %v", levels, want)
+	}
+	for i := range want {
+		if levels[i] != want[i] {
+			t.Fatalf("levels = %v, want %v", levels, want)
+		}
+	}
+}
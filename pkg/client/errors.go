@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rl1809/flash-sale/pkg/pb"
+)
+
+// Error is a call the server rejected, with the details it gave.
+type Error struct {
+	Code    codes.Code
+	Message string
+	// ErrorCode is why a purchase was rejected, or unspecified for other
+	// calls and for rejections that carry no reason
+	ErrorCode pb.ErrorCode
+	// RetryAfter is how long the server asks callers to wait before trying
+	// again, or zero if it did not ask
+	RetryAfter time.Duration
+	// RemainingStockHint is the item's stock when a purchase was rejected,
+	// if the server knew it
+	RemainingStockHint *int32
+	// Fields maps the invalid fields of a rejected request to what is wrong
+	// with them
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	if e.ErrorCode != pb.ErrorCode_ERROR_CODE_UNSPECIFIED {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.ErrorCode)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// GRPCStatus lets status.Code and status.FromError see the call's status.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Message)
+}
+
+// ErrorCodeOf returns why the server rejected a purchase, or unspecified if
+// err carries no reason.
+func ErrorCodeOf(err error) pb.ErrorCode {
+	if e, ok := asError(err).(*Error); ok {
+		return e.ErrorCode
+	}
+	return pb.ErrorCode_ERROR_CODE_UNSPECIFIED
+}
+
+// asError decodes the details of a gRPC status error into an *Error, and
+// returns any other error as is.
+func asError(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+
+	e := &Error{Code: st.Code(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *pb.PurchaseResponse:
+			e.ErrorCode = d.GetErrorCode()
+			e.RemainingStockHint = d.RemainingStockHint
+		case *errdetails.ErrorInfo:
+			if e.ErrorCode == pb.ErrorCode_ERROR_CODE_UNSPECIFIED {
+				e.ErrorCode = pb.ErrorCode(pb.ErrorCode_value["ERROR_CODE_"+d.GetReason()])
+			}
+		case *errdetails.RetryInfo:
+			e.RetryAfter = d.GetRetryDelay().AsDuration()
+		case *errdetails.BadRequest:
+			e.Fields = make(map[string]string, len(d.GetFieldViolations()))
+			for _, v := range d.GetFieldViolations() {
+				e.Fields[v.GetField()] = v.GetDescription()
+			}
+		}
+	}
+	return e
+}
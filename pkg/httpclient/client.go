@@ -0,0 +1,272 @@
+// Package httpclient is a Go client for the flash sale HTTP API.
+//
+// Every purchase carries a request ID the server remembers, sent as the
+// Idempotency-Key header: a purchase sent again is answered with the
+// original result instead of buying twice. That makes purchases safe to
+// retry, and a Client retries those answered with a 5xx status or lost to a
+// network error, with the same request ID. Purchase generates a request ID
+// when the request has none; RequestIDFor derives one from a key of the
+// caller's own, so a caller that restarts retries with the same ID.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Defaults for the retries of requests answered with a 5xx status
+const (
+	DefaultAttempts   = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// requestIDNamespace scopes the request IDs derived by RequestIDFor. It is
+// the namespace of the gRPC client's, so both derive the same ID from a key.
+var requestIDNamespace = uuid.MustParse("5b0c9f3e-8a53-4c55-9f0e-3c1d2e6a7b48")
+
+// Client calls the HTTP API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through client instead of
+// http.DefaultClient, for timeouts, TLS settings or a custom transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.http = client
+	}
+}
+
+// WithRetries makes up to attempts tries at requests answered with a 5xx
+// status, waiting a random delay of up to backoff before the first retry,
+// doubling up to maxBackoff. A Retry-After delay is waited out instead
+// when it is longer. One attempt does not retry.
+func WithRetries(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New returns a client of the server at baseURL, such as
+// "https://flash-sale.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not an http or https URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		http:       http.DefaultClient,
+		attempts:   DefaultAttempts,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// NewRequestID returns a random request ID, for a purchase the caller
+// makes once.
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// RequestIDFor derives the request ID of a purchase from a key the caller
+// has for it, such as the ID of the message asking for it, so the purchase
+// keeps its request ID when the caller retries it after restarting.
+func RequestIDFor(key string) string {
+	return uuid.NewSHA1(requestIDNamespace, []byte(key)).String()
+}
+
+// PurchaseRequest is a purchase of one item, or of the Items of a cart.
+type PurchaseRequest struct {
+	RequestID string `json:"request_id"`
+	UserID    string `json:"user_id"`
+	ItemID    string `json:"item_id,omitempty"`
+	Quantity  int    `json:"quantity,omitempty"`
+
+	// ExpectedTotal is the total shown to the user, in minor currency units.
+	// When set, the purchase is rejected if the server price differs.
+	ExpectedTotal *int64 `json:"expected_total,omitempty"`
+
+	CouponCode    string         `json:"coupon_code,omitempty"`
+	Items         []PurchaseLine `json:"items,omitempty"`
+	CaptchaToken  string         `json:"captcha_token,omitempty"`
+	PurchaseToken string         `json:"purchase_token,omitempty"`
+	DeviceID      string         `json:"device_id,omitempty"`
+}
+
+// PurchaseLine is one item of a cart.
+type PurchaseLine struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+}
+
+// PurchaseResponse is the outcome of a purchase. Accepted purchases were
+// queued, by a server taking purchases asynchronously or into a lottery,
+// and have no order ID yet; PurchaseStatus reports how they end.
+type PurchaseResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	OrderID   string `json:"order_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Accepted  bool   `json:"-"`
+}
+
+// PurchaseStatus is the state of a purchase: queued, confirmed, sold_out,
+// item_not_found, sale_closed or failed, or for a lottery entry, entered
+// and then not_drawn if it lost.
+type PurchaseStatus struct {
+	RequestID string `json:"request_id"`
+	State     string `json:"state"`
+	OrderID   string `json:"order_id,omitempty"`
+}
+
+// Order is a user's order. Prices are in minor units of Currency.
+type Order struct {
+	OrderID    string         `json:"order_id"`
+	Status     string         `json:"status"`
+	ItemID     string         `json:"item_id"`
+	Quantity   int            `json:"quantity"`
+	Items      []PurchaseLine `json:"items,omitempty"`
+	TotalPrice int64          `json:"total_price"`
+	Currency   string         `json:"currency"`
+	CouponCode string         `json:"coupon_code,omitempty"`
+	Discount   int64          `json:"discount,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+}
+
+// Purchase buys what req asks for, filling in a request ID if it has none;
+// the response carries the request ID used either way. A rejected purchase
+// returns an *Error with the reason.
+func (c *Client) Purchase(ctx context.Context, req PurchaseRequest) (*PurchaseResponse, error) {
+	if req.RequestID == "" {
+		req.RequestID = NewRequestID()
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode purchase: %w", err)
+	}
+
+	var resp PurchaseResponse
+	status, err := c.do(ctx, http.MethodPost, "/v1/purchase", body, req.RequestID, &resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.RequestID = req.RequestID
+	resp.Accepted = status == http.StatusAccepted
+	return &resp, nil
+}
+
+// PurchaseStatus returns the state of the purchase with the request ID.
+func (c *Client) PurchaseStatus(ctx context.Context, requestID string) (*PurchaseStatus, error) {
+	var resp PurchaseStatus
+	if _, err := c.do(ctx, http.MethodGet, "/v1/purchase/"+url.PathEscape(requestID), nil, "", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetOrder returns the user's order. An order just placed may not be
+// stored yet, and is reported as CodeOrderNotFound until it is.
+func (c *Client) GetOrder(ctx context.Context, userID, orderID string) (*Order, error) {
+	var resp Order
+	path := "/v1/users/" + url.PathEscape(userID) + "/orders/" + url.PathEscape(orderID)
+	if _, err := c.do(ctx, http.MethodGet, path, nil, "", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends a request until it gets an answer below 500 or the attempts
+// run out, decoding a successful answer into out and returning its status.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, idempotencyKey string, out any) (int, error) {
+	var err error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		if attempt > 0 {
+			delay := rand.N(min(c.backoff<<(attempt-1), c.maxBackoff) + 1)
+			var apiErr *Error
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+				delay = apiErr.RetryAfter
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return 0, err
+			}
+		}
+
+		var status int
+		status, err = c.send(ctx, method, path, body, idempotencyKey, out)
+		if err == nil {
+			return status, nil
+		}
+		var apiErr *Error
+		if ctx.Err() != nil || errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+			return 0, err
+		}
+	}
+	return 0, err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte, idempotencyKey string, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return 0, decodeError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return resp.StatusCode, nil
+}
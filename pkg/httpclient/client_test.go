@@ -0,0 +1,228 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/adapter/handler"
+	"github.com/rl1809/flash-sale/internal/adapter/memory"
+	"github.com/rl1809/flash-sale/internal/core/domain"
+	"github.com/rl1809/flash-sale/internal/core/service"
+)
+
+// flakyServer serves the HTTP API behind failures: the first requests are
+// answered with the failures' statuses, either before the API sees them or,
+// for lost responses, after it has handled them.
+type flakyServer struct {
+	api http.Handler
+
+	mu       sync.Mutex
+	failures []failure
+	keys     []string
+}
+
+type failure struct {
+	status     int
+	retryAfter string
+	handled    bool
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.keys = append(s.keys, r.Header.Get("Idempotency-Key"))
+	var f *failure
+	if len(s.failures) > 0 {
+		f = &s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if f == nil {
+		s.api.ServeHTTP(w, r)
+		return
+	}
+	if f.handled {
+		s.api.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if f.retryAfter != "" {
+		w.Header().Set("Retry-After", f.retryAfter)
+	}
+	w.WriteHeader(f.status)
+}
+
+func newTestServer(t *testing.T, stock int, failures ...failure) (*flakyServer, *Client) {
+	t.Helper()
+	ctx := context.Background()
+	cache := memory.NewCache()
+	cache.SetStock(ctx, "item-1", stock)
+	db := memory.NewDatabase()
+	db.SetInventory("item-1", stock)
+	db.CreateOrder(ctx, domain.Order{ID: "order-1", UserID: "user-1", ItemID: "item-1", Quantity: 1, TotalPrice: 1000, Currency: "USD", Status: domain.OrderStatusConfirmed})
+
+	orders := service.NewOrderService(cache, 100)
+	go func() {
+		for range orders.GetOrderQueue() {
+		}
+	}()
+	t.Cleanup(orders.Close)
+	reservations := service.NewReservationService(db, service.NewStockCompensator(cache, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/purchase", handler.NewHTTPHandler(orders).Purchase)
+	mux.HandleFunc("GET /v1/purchase/{request_id}", handler.NewHTTPHandler(orders).PurchaseStatus)
+	mux.HandleFunc("GET /v1/users/{user_id}/orders/{id}", handler.NewOrderHandler(reservations).Get)
+
+	srv := &flakyServer{api: mux, failures: failures}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	c, err := New(ts.URL, WithRetries(3, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return srv, c
+}
+
+func TestPurchase_RetriesWithSameKey(t *testing.T) {
+	// The first response is lost after the purchase went through, so the
+	// retry must be answered with the same order rather than buy again
+	srv, c := newTestServer(t, 1, failure{status: http.StatusBadGateway, handled: true})
+
+	resp, err := c.Purchase(context.Background(), PurchaseRequest{UserID: "user-1", ItemID: "item-1", Quantity: 1})
+	if err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	if !resp.Success || resp.OrderID == "" || resp.Accepted {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if len(srv.keys) != 2 || srv.keys[0] == "" || srv.keys[0] != srv.keys[1] || srv.keys[0] != resp.RequestID {
+		t.Errorf("idempotency keys = %q, want the response's request ID %q twice", srv.keys, resp.RequestID)
+	}
+
+	status, err := c.PurchaseStatus(context.Background(), resp.RequestID)
+	if err != nil {
+		t.Fatalf("PurchaseStatus: %v", err)
+	}
+	if status.State != "confirmed" || status.OrderID != resp.OrderID {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestPurchase_HonoursRetryAfter(t *testing.T) {
+	_, c := newTestServer(t, 1, failure{status: http.StatusServiceUnavailable, retryAfter: "1"})
+
+	start := time.Now()
+	if _, err := c.Purchase(context.Background(), PurchaseRequest{UserID: "user-1", ItemID: "item-1", Quantity: 1}); err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the server's 1s", elapsed)
+	}
+}
+
+func TestPurchase_GivesUpAfterAttempts(t *testing.T) {
+	srv, c := newTestServer(t, 1,
+		failure{status: http.StatusInternalServerError},
+		failure{status: http.StatusInternalServerError},
+		failure{status: http.StatusInternalServerError},
+	)
+
+	_, err := c.Purchase(context.Background(), PurchaseRequest{RequestID: "req-1", UserID: "user-1", ItemID: "item-1", Quantity: 1})
+	e, ok := err.(*Error)
+	if !ok || e.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want a 500 *Error", err)
+	}
+	if len(srv.keys) != 3 {
+		t.Errorf("attempts = %d, want 3", len(srv.keys))
+	}
+}
+
+func TestPurchase_TypedErrors(t *testing.T) {
+	srv, c := newTestServer(t, 1)
+	ctx := context.Background()
+
+	if _, err := c.Purchase(ctx, PurchaseRequest{UserID: "user-1", ItemID: "item-1", Quantity: 1}); err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	_, err := c.Purchase(ctx, PurchaseRequest{UserID: "user-2", ItemID: "item-1", Quantity: 1})
+	if ErrorCodeOf(err) != CodeSoldOut {
+		t.Errorf("err = %v, want %s", err, CodeSoldOut)
+	}
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusGone || e.Retryable || e.RequestID == "" {
+		t.Errorf("err = %+v", err)
+	}
+	if len(srv.keys) != 2 {
+		t.Errorf("requests = %d, want no retries", len(srv.keys))
+	}
+
+	_, err = c.Purchase(ctx, PurchaseRequest{UserID: "user-1", ItemID: "item-1", Quantity: -1})
+	if e, ok := err.(*Error); !ok || e.Code != CodeInvalidFields || len(e.Fields) == 0 {
+		t.Errorf("err = %v, want %s with fields", err, CodeInvalidFields)
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	_, c := newTestServer(t, 1)
+	ctx := context.Background()
+
+	order, err := c.GetOrder(ctx, "user-1", "order-1")
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if order.OrderID != "order-1" || order.Status != "confirmed" || order.TotalPrice != 1000 || order.Currency != "USD" {
+		t.Errorf("unexpected order: %+v", order)
+	}
+
+	if _, err := c.GetOrder(ctx, "user-2", "order-1"); ErrorCodeOf(err) != CodeOrderNotFound {
+		t.Errorf("err = %v, want %s", err, CodeOrderNotFound)
+	}
+}
+
+func TestRequestIDFor(t *testing.T) {
+	if RequestIDFor("msg-1") != RequestIDFor("msg-1") || RequestIDFor("msg-1") == RequestIDFor("msg-2") {
+		t.Error("RequestIDFor is not a function of its key")
+	}
+}
+
+func TestErrorCodesMatchServer(t *testing.T) {
+	codes := map[ErrorCode]handler.ErrorCode{
+		CodeInvalidRequest:        handler.CodeInvalidRequest,
+		CodeInvalidIdempotencyKey: handler.CodeInvalidIdempotencyKey,
+		CodeMissingFields:         handler.CodeMissingFields,
+		CodeInvalidFields:         handler.CodeInvalidFields,
+		CodeBodyTooLarge:          handler.CodeBodyTooLarge,
+		CodeRateLimited:           handler.CodeRateLimited,
+		CodeServerBusy:            handler.CodeServerBusy,
+		CodeInternal:              handler.CodeInternal,
+		CodeDuplicateRequest:      handler.CodeDuplicateRequest,
+		CodePurchaseNotFound:      handler.CodePurchaseNotFound,
+		CodePriceMismatch:         handler.CodePriceMismatch,
+		CodeSoldOut:               handler.CodeSoldOut,
+		CodeSaleClosed:            handler.CodeSaleClosed,
+		CodeSalePaused:            handler.CodeSalePaused,
+		CodeSaleNotOpen:           handler.CodeSaleNotOpen,
+		CodePurchaseLimit:         handler.CodePurchaseLimit,
+		CodeMixedCurrency:         handler.CodeMixedCurrency,
+		CodeCartUnsupported:       handler.CodeCartUnsupported,
+		CodeCouponRejected:        handler.CodeCouponRejected,
+		CodeCouponExhausted:       handler.CodeCouponExhausted,
+		CodeAlreadyEntered:        handler.CodeAlreadyEntered,
+		CodeNotDrawn:              handler.CodeNotDrawn,
+		CodeItemNotFound:          handler.CodeItemNotFound,
+		CodeOrderNotFound:         handler.CodeOrderNotFound,
+		CodeBotCheckFailed:        handler.CodeBotCheckFailed,
+		CodeInvalidToken:          handler.CodeInvalidToken,
+		CodeTokenUsed:             handler.CodeTokenUsed,
+		CodeBlacklisted:           handler.CodeBlacklisted,
+		CodeRiskRejected:          handler.CodeRiskRejected,
+	}
+	for client, server := range codes {
+		if string(client) != string(server) {
+			t.Errorf("client code %q, server code %q", client, server)
+		}
+	}
+}
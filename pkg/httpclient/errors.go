@@ -0,0 +1,116 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorCode identifies why the server rejected a request. Codes are
+// stable; messages are meant for people and may change.
+type ErrorCode string
+
+// Codes of the errors Purchase, PurchaseStatus and GetOrder may return
+const (
+	CodeInvalidRequest        ErrorCode = "invalid_request"
+	CodeInvalidIdempotencyKey ErrorCode = "invalid_idempotency_key"
+	CodeMissingFields         ErrorCode = "missing_fields"
+	CodeInvalidFields         ErrorCode = "invalid_fields"
+	CodeBodyTooLarge          ErrorCode = "body_too_large"
+	CodeRateLimited           ErrorCode = "rate_limited"
+	CodeServerBusy            ErrorCode = "server_busy"
+	CodeInternal              ErrorCode = "internal_error"
+
+	// CodeDuplicateRequest is a purchase whose request ID is still being
+	// handled; PurchaseStatus reports how it ends
+	CodeDuplicateRequest ErrorCode = "duplicate_request"
+	CodePreviousFailure  ErrorCode = "previous_attempt_failed"
+	CodePurchaseNotFound ErrorCode = "purchase_not_found"
+	CodePriceMismatch    ErrorCode = "price_mismatch"
+	CodeSoldOut          ErrorCode = "sold_out"
+	CodeSaleClosed       ErrorCode = "sale_closed"
+	CodeSalePaused       ErrorCode = "sale_paused"
+	CodeSaleNotOpen      ErrorCode = "sale_not_open"
+	CodePurchaseLimit    ErrorCode = "purchase_limit_exceeded"
+	CodeMixedCurrency    ErrorCode = "mixed_currency"
+	CodeCartUnsupported  ErrorCode = "cart_unsupported"
+	CodeCouponRejected   ErrorCode = "coupon_rejected"
+	CodeCouponExhausted  ErrorCode = "coupon_exhausted"
+	CodeAlreadyEntered   ErrorCode = "already_entered"
+	CodeNotDrawn         ErrorCode = "not_drawn"
+	CodeItemNotFound     ErrorCode = "item_not_found"
+	CodeOrderNotFound    ErrorCode = "order_not_found"
+	CodeBotCheckFailed   ErrorCode = "bot_check_failed"
+	CodeInvalidToken     ErrorCode = "invalid_purchase_token"
+	CodeTokenUsed        ErrorCode = "purchase_token_used"
+	CodeBlacklisted      ErrorCode = "blacklisted"
+	CodeRiskRejected     ErrorCode = "risk_rejected"
+)
+
+// Error is a request the server rejected. Retryable requests may succeed
+// if sent again unchanged, after RetryAfter.
+type Error struct {
+	StatusCode int
+	Code       ErrorCode
+	Message    string
+	Retryable  bool
+	RequestID  string
+	RetryAfter time.Duration
+
+	// Fields lists the rejected fields of a CodeInvalidFields error
+	Fields []FieldError
+}
+
+// FieldError is a rejected field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// ErrorCodeOf returns why the server rejected a request, or "" if err is
+// not a rejection, such as a network error.
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// decodeError reads the error a response carries. Responses that do not
+// come from the server, such as a proxy's 502 page, have no code.
+func decodeError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var body struct {
+		Error struct {
+			Code      ErrorCode    `json:"code"`
+			Message   string       `json:"message"`
+			Retryable bool         `json:"retryable"`
+			RequestID string       `json:"request_id"`
+			Fields    []FieldError `json:"fields"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil && body.Error.Code != "" {
+		e.Code = body.Error.Code
+		e.Message = body.Error.Message
+		e.Retryable = body.Error.Retryable
+		e.RequestID = body.Error.RequestID
+		e.Fields = body.Error.Fields
+	}
+	return e
+}
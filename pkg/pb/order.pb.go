@@ -0,0 +1,620 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.4
+// source: proto/order.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ErrorCode says why a purchase was rejected. Failed calls return it in a
+// PurchaseResponse attached to the gRPC status details.
+type ErrorCode int32
+
+const (
+	ErrorCode_ERROR_CODE_UNSPECIFIED       ErrorCode = 0
+	ErrorCode_ERROR_CODE_INVALID_ARGUMENT  ErrorCode = 1
+	ErrorCode_ERROR_CODE_DUPLICATE_REQUEST ErrorCode = 2
+	ErrorCode_ERROR_CODE_SOLD_OUT          ErrorCode = 3
+	ErrorCode_ERROR_CODE_ITEM_NOT_FOUND    ErrorCode = 4
+	ErrorCode_ERROR_CODE_SALE_CLOSED       ErrorCode = 5
+	ErrorCode_ERROR_CODE_SALE_PAUSED       ErrorCode = 6
+	ErrorCode_ERROR_CODE_OVERLOADED        ErrorCode = 7
+	ErrorCode_ERROR_CODE_PRICE_MISMATCH    ErrorCode = 8
+	ErrorCode_ERROR_CODE_INTERNAL          ErrorCode = 9
+	ErrorCode_ERROR_CODE_RATE_LIMITED      ErrorCode = 10
+	ErrorCode_ERROR_CODE_PURCHASE_LIMIT    ErrorCode = 11
+	ErrorCode_ERROR_CODE_MIXED_CURRENCY    ErrorCode = 12
+	ErrorCode_ERROR_CODE_COUPON_REJECTED   ErrorCode = 13
+	ErrorCode_ERROR_CODE_COUPON_EXHAUSTED  ErrorCode = 14
+	// In lottery mode, the user has already entered the item's lottery
+	ErrorCode_ERROR_CODE_ALREADY_ENTERED ErrorCode = 15
+	// The CAPTCHA token is missing or was not accepted
+	ErrorCode_ERROR_CODE_BOT_CHECK_FAILED ErrorCode = 16
+	// The purchase_token is missing, forged, expired or for another purchase
+	ErrorCode_ERROR_CODE_INVALID_PURCHASE_TOKEN ErrorCode = 17
+	// The purchase_token has already been used
+	ErrorCode_ERROR_CODE_PURCHASE_TOKEN_USED ErrorCode = 18
+	// The user or client IP is on the blacklist
+	ErrorCode_ERROR_CODE_BLACKLISTED ErrorCode = 19
+	// Risk scoring judged the purchase fraudulent
+	ErrorCode_ERROR_CODE_RISK_REJECTED ErrorCode = 20
+	// In lottery mode, the user was not drawn for the item
+	ErrorCode_ERROR_CODE_NOT_DRAWN ErrorCode = 21
+	// An earlier attempt of the request failed; retrying it cannot change that
+	ErrorCode_ERROR_CODE_PREVIOUS_ATTEMPT_FAILED ErrorCode = 22
+)
+
+// Enum value maps for ErrorCode.
+var (
+	ErrorCode_name = map[int32]string{
+		0:  "ERROR_CODE_UNSPECIFIED",
+		1:  "ERROR_CODE_INVALID_ARGUMENT",
+		2:  "ERROR_CODE_DUPLICATE_REQUEST",
+		3:  "ERROR_CODE_SOLD_OUT",
+		4:  "ERROR_CODE_ITEM_NOT_FOUND",
+		5:  "ERROR_CODE_SALE_CLOSED",
+		6:  "ERROR_CODE_SALE_PAUSED",
+		7:  "ERROR_CODE_OVERLOADED",
+		8:  "ERROR_CODE_PRICE_MISMATCH",
+		9:  "ERROR_CODE_INTERNAL",
+		10: "ERROR_CODE_RATE_LIMITED",
+		11: "ERROR_CODE_PURCHASE_LIMIT",
+		12: "ERROR_CODE_MIXED_CURRENCY",
+		13: "ERROR_CODE_COUPON_REJECTED",
+		14: "ERROR_CODE_COUPON_EXHAUSTED",
+		15: "ERROR_CODE_ALREADY_ENTERED",
+		16: "ERROR_CODE_BOT_CHECK_FAILED",
+		17: "ERROR_CODE_INVALID_PURCHASE_TOKEN",
+		18: "ERROR_CODE_PURCHASE_TOKEN_USED",
+		19: "ERROR_CODE_BLACKLISTED",
+		20: "ERROR_CODE_RISK_REJECTED",
+		21: "ERROR_CODE_NOT_DRAWN",
+		22: "ERROR_CODE_PREVIOUS_ATTEMPT_FAILED",
+	}
+	ErrorCode_value = map[string]int32{
+		"ERROR_CODE_UNSPECIFIED":             0,
+		"ERROR_CODE_INVALID_ARGUMENT":        1,
+		"ERROR_CODE_DUPLICATE_REQUEST":       2,
+		"ERROR_CODE_SOLD_OUT":                3,
+		"ERROR_CODE_ITEM_NOT_FOUND":          4,
+		"ERROR_CODE_SALE_CLOSED":             5,
+		"ERROR_CODE_SALE_PAUSED":             6,
+		"ERROR_CODE_OVERLOADED":              7,
+		"ERROR_CODE_PRICE_MISMATCH":          8,
+		"ERROR_CODE_INTERNAL":                9,
+		"ERROR_CODE_RATE_LIMITED":            10,
+		"ERROR_CODE_PURCHASE_LIMIT":          11,
+		"ERROR_CODE_MIXED_CURRENCY":          12,
+		"ERROR_CODE_COUPON_REJECTED":         13,
+		"ERROR_CODE_COUPON_EXHAUSTED":        14,
+		"ERROR_CODE_ALREADY_ENTERED":         15,
+		"ERROR_CODE_BOT_CHECK_FAILED":        16,
+		"ERROR_CODE_INVALID_PURCHASE_TOKEN":  17,
+		"ERROR_CODE_PURCHASE_TOKEN_USED":     18,
+		"ERROR_CODE_BLACKLISTED":             19,
+		"ERROR_CODE_RISK_REJECTED":           20,
+		"ERROR_CODE_NOT_DRAWN":               21,
+		"ERROR_CODE_PREVIOUS_ATTEMPT_FAILED": 22,
+	}
+)
+
+func (x ErrorCode) Enum() *ErrorCode {
+	p := new(ErrorCode)
+	*p = x
+	return p
+}
+
+func (x ErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_order_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorCode) Type() protoreflect.EnumType {
+	return &file_proto_order_proto_enumTypes[0]
+}
+
+func (x ErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorCode.Descriptor instead.
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{0}
+}
+
+type PurchaseRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	UserId    string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ItemId    string                 `protobuf:"bytes,3,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Quantity  int32                  `protobuf:"varint,4,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// Total shown to the user in minor currency units; checked against the server price when set
+	ExpectedTotal *int64 `protobuf:"varint,5,opt,name=expected_total,json=expectedTotal,proto3,oneof" json:"expected_total,omitempty"`
+	// Lines of a multi-item purchase, bought together or not at all; when set,
+	// item_id and quantity must be empty. expected_total is the cart total.
+	Items []*PurchaseLine `protobuf:"bytes,6,rep,name=items,proto3" json:"items,omitempty"`
+	// Coupon to apply; expected_total is then the discounted total
+	CouponCode string `protobuf:"bytes,7,opt,name=coupon_code,json=couponCode,proto3" json:"coupon_code,omitempty"`
+	// Solved CAPTCHA token, required when the server checks for bots
+	CaptchaToken string `protobuf:"bytes,8,opt,name=captcha_token,json=captchaToken,proto3" json:"captcha_token,omitempty"`
+	// Token from POST /v1/token, required when purchase tokens are enabled
+	PurchaseToken string `protobuf:"bytes,9,opt,name=purchase_token,json=purchaseToken,proto3" json:"purchase_token,omitempty"`
+	// Client device ID, counted by the fraud rules when risk scoring is on
+	DeviceId      string `protobuf:"bytes,10,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseRequest) Reset() {
+	*x = PurchaseRequest{}
+	mi := &file_proto_order_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseRequest) ProtoMessage() {}
+
+func (x *PurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_order_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseRequest.ProtoReflect.Descriptor instead.
+func (*PurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PurchaseRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *PurchaseRequest) GetExpectedTotal() int64 {
+	if x != nil && x.ExpectedTotal != nil {
+		return *x.ExpectedTotal
+	}
+	return 0
+}
+
+func (x *PurchaseRequest) GetItems() []*PurchaseLine {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *PurchaseRequest) GetCouponCode() string {
+	if x != nil {
+		return x.CouponCode
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetCaptchaToken() string {
+	if x != nil {
+		return x.CaptchaToken
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetPurchaseToken() string {
+	if x != nil {
+		return x.PurchaseToken
+	}
+	return ""
+}
+
+func (x *PurchaseRequest) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+type PurchaseLine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ItemId        string                 `protobuf:"bytes,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurchaseLine) Reset() {
+	*x = PurchaseLine{}
+	mi := &file_proto_order_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseLine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseLine) ProtoMessage() {}
+
+func (x *PurchaseLine) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_order_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseLine.ProtoReflect.Descriptor instead.
+func (*PurchaseLine) Descriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PurchaseLine) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+func (x *PurchaseLine) GetQuantity() int32 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+type PurchaseResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Success bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// ID of the stored order; use it to correlate with order status and payment events.
+	// Empty in lottery mode, where success means the request was entered into the draw
+	OrderId   string    `protobuf:"bytes,3,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	ErrorCode ErrorCode `protobuf:"varint,4,opt,name=error_code,json=errorCode,proto3,enum=flashsale.ErrorCode" json:"error_code,omitempty"`
+	// Stock left after the purchase, read separately and possibly already stale
+	RemainingStockHint *int32 `protobuf:"varint,5,opt,name=remaining_stock_hint,json=remainingStockHint,proto3,oneof" json:"remaining_stock_hint,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *PurchaseResponse) Reset() {
+	*x = PurchaseResponse{}
+	mi := &file_proto_order_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseResponse) ProtoMessage() {}
+
+func (x *PurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_order_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseResponse.ProtoReflect.Descriptor instead.
+func (*PurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PurchaseResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *PurchaseResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *PurchaseResponse) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+func (x *PurchaseResponse) GetErrorCode() ErrorCode {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ErrorCode_ERROR_CODE_UNSPECIFIED
+}
+
+func (x *PurchaseResponse) GetRemainingStockHint() int32 {
+	if x != nil && x.RemainingStockHint != nil {
+		return *x.RemainingStockHint
+	}
+	return 0
+}
+
+type WatchStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ItemId        string                 `protobuf:"bytes,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStockRequest) Reset() {
+	*x = WatchStockRequest{}
+	mi := &file_proto_order_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStockRequest) ProtoMessage() {}
+
+func (x *WatchStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_order_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStockRequest.ProtoReflect.Descriptor instead.
+func (*WatchStockRequest) Descriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *WatchStockRequest) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+type StockUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ItemId        string                 `protobuf:"bytes,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Remaining     int32                  `protobuf:"varint,2,opt,name=remaining,proto3" json:"remaining,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StockUpdate) Reset() {
+	*x = StockUpdate{}
+	mi := &file_proto_order_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StockUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StockUpdate) ProtoMessage() {}
+
+func (x *StockUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_order_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StockUpdate.ProtoReflect.Descriptor instead.
+func (*StockUpdate) Descriptor() ([]byte, []int) {
+	return file_proto_order_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StockUpdate) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+func (x *StockUpdate) GetRemaining() int32 {
+	if x != nil {
+		return x.Remaining
+	}
+	return 0
+}
+
+var File_proto_order_proto protoreflect.FileDescriptor
+
+const file_proto_order_proto_rawDesc = "" +
+	"\n" +
+	"\x11proto/order.proto\x12\tflashsale\"\xf6\x02\n" +
+	"\x0fPurchaseRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x17\n" +
+	"\aitem_id\x18\x03 \x01(\tR\x06itemId\x12\x1a\n" +
+	"\bquantity\x18\x04 \x01(\x05R\bquantity\x12*\n" +
+	"\x0eexpected_total\x18\x05 \x01(\x03H\x00R\rexpectedTotal\x88\x01\x01\x12-\n" +
+	"\x05items\x18\x06 \x03(\v2\x17.flashsale.PurchaseLineR\x05items\x12\x1f\n" +
+	"\vcoupon_code\x18\a \x01(\tR\n" +
+	"couponCode\x12#\n" +
+	"\rcaptcha_token\x18\b \x01(\tR\fcaptchaToken\x12%\n" +
+	"\x0epurchase_token\x18\t \x01(\tR\rpurchaseToken\x12\x1b\n" +
+	"\tdevice_id\x18\n" +
+	" \x01(\tR\bdeviceIdB\x11\n" +
+	"\x0f_expected_total\"C\n" +
+	"\fPurchaseLine\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\tR\x06itemId\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x05R\bquantity\"\xe6\x01\n" +
+	"\x10PurchaseResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x19\n" +
+	"\border_id\x18\x03 \x01(\tR\aorderId\x123\n" +
+	"\n" +
+	"error_code\x18\x04 \x01(\x0e2\x14.flashsale.ErrorCodeR\terrorCode\x125\n" +
+	"\x14remaining_stock_hint\x18\x05 \x01(\x05H\x00R\x12remainingStockHint\x88\x01\x01B\x17\n" +
+	"\x15_remaining_stock_hint\",\n" +
+	"\x11WatchStockRequest\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\tR\x06itemId\"D\n" +
+	"\vStockUpdate\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\tR\x06itemId\x12\x1c\n" +
+	"\tremaining\x18\x02 \x01(\x05R\tremaining*\xd1\x05\n" +
+	"\tErrorCode\x12\x1a\n" +
+	"\x16ERROR_CODE_UNSPECIFIED\x10\x00\x12\x1f\n" +
+	"\x1bERROR_CODE_INVALID_ARGUMENT\x10\x01\x12 \n" +
+	"\x1cERROR_CODE_DUPLICATE_REQUEST\x10\x02\x12\x17\n" +
+	"\x13ERROR_CODE_SOLD_OUT\x10\x03\x12\x1d\n" +
+	"\x19ERROR_CODE_ITEM_NOT_FOUND\x10\x04\x12\x1a\n" +
+	"\x16ERROR_CODE_SALE_CLOSED\x10\x05\x12\x1a\n" +
+	"\x16ERROR_CODE_SALE_PAUSED\x10\x06\x12\x19\n" +
+	"\x15ERROR_CODE_OVERLOADED\x10\a\x12\x1d\n" +
+	"\x19ERROR_CODE_PRICE_MISMATCH\x10\b\x12\x17\n" +
+	"\x13ERROR_CODE_INTERNAL\x10\t\x12\x1b\n" +
+	"\x17ERROR_CODE_RATE_LIMITED\x10\n" +
+	"\x12\x1d\n" +
+	"\x19ERROR_CODE_PURCHASE_LIMIT\x10\v\x12\x1d\n" +
+	"\x19ERROR_CODE_MIXED_CURRENCY\x10\f\x12\x1e\n" +
+	"\x1aERROR_CODE_COUPON_REJECTED\x10\r\x12\x1f\n" +
+	"\x1bERROR_CODE_COUPON_EXHAUSTED\x10\x0e\x12\x1e\n" +
+	"\x1aERROR_CODE_ALREADY_ENTERED\x10\x0f\x12\x1f\n" +
+	"\x1bERROR_CODE_BOT_CHECK_FAILED\x10\x10\x12%\n" +
+	"!ERROR_CODE_INVALID_PURCHASE_TOKEN\x10\x11\x12\"\n" +
+	"\x1eERROR_CODE_PURCHASE_TOKEN_USED\x10\x12\x12\x1a\n" +
+	"\x16ERROR_CODE_BLACKLISTED\x10\x13\x12\x1c\n" +
+	"\x18ERROR_CODE_RISK_REJECTED\x10\x14\x12\x18\n" +
+	"\x14ERROR_CODE_NOT_DRAWN\x10\x15\x12&\n" +
+	"\"ERROR_CODE_PREVIOUS_ATTEMPT_FAILED\x10\x162\x99\x01\n" +
+	"\fOrderService\x12C\n" +
+	"\bPurchase\x12\x1a.flashsale.PurchaseRequest\x1a\x1b.flashsale.PurchaseResponse\x12D\n" +
+	"\n" +
+	"WatchStock\x12\x1c.flashsale.WatchStockRequest\x1a\x16.flashsale.StockUpdate0\x01B%Z#github.com/rl1809/flash-sale/pkg/pbb\x06proto3"
+
+var (
+	file_proto_order_proto_rawDescOnce sync.Once
+	file_proto_order_proto_rawDescData []byte
+)
+
+func file_proto_order_proto_rawDescGZIP() []byte {
+	file_proto_order_proto_rawDescOnce.Do(func() {
+		file_proto_order_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_order_proto_rawDesc), len(file_proto_order_proto_rawDesc)))
+	})
+	return file_proto_order_proto_rawDescData
+}
+
+var file_proto_order_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_order_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_order_proto_goTypes = []any{
+	(ErrorCode)(0),            // 0: flashsale.ErrorCode
+	(*PurchaseRequest)(nil),   // 1: flashsale.PurchaseRequest
+	(*PurchaseLine)(nil),      // 2: flashsale.PurchaseLine
+	(*PurchaseResponse)(nil),  // 3: flashsale.PurchaseResponse
+	(*WatchStockRequest)(nil), // 4: flashsale.WatchStockRequest
+	(*StockUpdate)(nil),       // 5: flashsale.StockUpdate
+}
+var file_proto_order_proto_depIdxs = []int32{
+	2, // 0: flashsale.PurchaseRequest.items:type_name -> flashsale.PurchaseLine
+	0, // 1: flashsale.PurchaseResponse.error_code:type_name -> flashsale.ErrorCode
+	1, // 2: flashsale.OrderService.Purchase:input_type -> flashsale.PurchaseRequest
+	4, // 3: flashsale.OrderService.WatchStock:input_type -> flashsale.WatchStockRequest
+	3, // 4: flashsale.OrderService.Purchase:output_type -> flashsale.PurchaseResponse
+	5, // 5: flashsale.OrderService.WatchStock:output_type -> flashsale.StockUpdate
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_proto_order_proto_init() }
+func file_proto_order_proto_init() {
+	if File_proto_order_proto != nil {
+		return
+	}
+	file_proto_order_proto_msgTypes[0].OneofWrappers = []any{}
+	file_proto_order_proto_msgTypes[2].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_order_proto_rawDesc), len(file_proto_order_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_order_proto_goTypes,
+		DependencyIndexes: file_proto_order_proto_depIdxs,
+		EnumInfos:         file_proto_order_proto_enumTypes,
+		MessageInfos:      file_proto_order_proto_msgTypes,
+	}.Build()
+	File_proto_order_proto = out.File
+	file_proto_order_proto_goTypes = nil
+	file_proto_order_proto_depIdxs = nil
+}
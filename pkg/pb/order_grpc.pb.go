@@ -19,7 +19,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	OrderService_Purchase_FullMethodName = "/flashsale.OrderService/Purchase"
+	OrderService_Purchase_FullMethodName   = "/flashsale.OrderService/Purchase"
+	OrderService_WatchStock_FullMethodName = "/flashsale.OrderService/WatchStock"
 )
 
 // OrderServiceClient is the client API for OrderService service.
@@ -27,6 +28,8 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type OrderServiceClient interface {
 	Purchase(ctx context.Context, in *PurchaseRequest, opts ...grpc.CallOption) (*PurchaseResponse, error)
+	// WatchStock sends the current stock level of an item and then every change
+	WatchStock(ctx context.Context, in *WatchStockRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StockUpdate], error)
 }
 
 type orderServiceClient struct {
@@ -47,11 +50,32 @@ func (c *orderServiceClient) Purchase(ctx context.Context, in *PurchaseRequest,
 	return out, nil
 }
 
+func (c *orderServiceClient) WatchStock(ctx context.Context, in *WatchStockRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StockUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OrderService_ServiceDesc.Streams[0], OrderService_WatchStock_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStockRequest, StockUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderService_WatchStockClient = grpc.ServerStreamingClient[StockUpdate]
+
 // OrderServiceServer is the server API for OrderService service.
 // All implementations must embed UnimplementedOrderServiceServer
 // for forward compatibility.
 type OrderServiceServer interface {
 	Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error)
+	// WatchStock sends the current stock level of an item and then every change
+	WatchStock(*WatchStockRequest, grpc.ServerStreamingServer[StockUpdate]) error
 	mustEmbedUnimplementedOrderServiceServer()
 }
 
@@ -65,6 +89,9 @@ type UnimplementedOrderServiceServer struct{}
 func (UnimplementedOrderServiceServer) Purchase(context.Context, *PurchaseRequest) (*PurchaseResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Purchase not implemented")
 }
+func (UnimplementedOrderServiceServer) WatchStock(*WatchStockRequest, grpc.ServerStreamingServer[StockUpdate]) error {
+	return status.Error(codes.Unimplemented, "method WatchStock not implemented")
+}
 func (UnimplementedOrderServiceServer) mustEmbedUnimplementedOrderServiceServer() {}
 func (UnimplementedOrderServiceServer) testEmbeddedByValue()                      {}
 
@@ -104,6 +131,17 @@ func _OrderService_Purchase_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OrderService_WatchStock_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStockRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OrderServiceServer).WatchStock(m, &grpc.GenericServerStream[WatchStockRequest, StockUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OrderService_WatchStockServer = grpc.ServerStreamingServer[StockUpdate]
+
 // OrderService_ServiceDesc is the grpc.ServiceDesc for OrderService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -116,6 +154,12 @@ var OrderService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _OrderService_Purchase_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStock",
+			Handler:       _OrderService_WatchStock_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "proto/order.proto",
 }
@@ -14,9 +14,7 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"github.com/rl1809/flash-sale/internal/adapter/storage"
-	"github.com/rl1809/flash-sale/internal/core/domain"
 	"github.com/rl1809/flash-sale/internal/core/service"
-	"github.com/rl1809/flash-sale/internal/port"
 )
 
 type testEnv struct {
@@ -92,7 +90,7 @@ func TestIntegration_FullFlashSaleFlow(t *testing.T) {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			workerLoop(id, svc.GetOrderQueue(), env.db, env.cache)
+			service.NewOrderWorker(id, svc.GetOrderQueue(), env.db, env.cache, newWorkerTuning(t)).Run()
 		}(i)
 	}
 
@@ -106,7 +104,7 @@ func TestIntegration_FullFlashSaleFlow(t *testing.T) {
 		go func(userID int) {
 			defer purchaseWg.Done()
 			requestID := uuid.New().String()
-			err := svc.Purchase(ctx, requestID, "user", itemID, 1)
+			_, err := svc.Purchase(ctx, requestID, "user", itemID, 1)
 			if err == nil {
 				successCount.Add(1)
 			}
@@ -171,12 +169,12 @@ func TestIntegration_RollbackOnMySQLFailure(t *testing.T) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		workerLoop(0, svc.GetOrderQueue(), env.db, env.cache)
+		service.NewOrderWorker(0, svc.GetOrderQueue(), env.db, env.cache, newWorkerTuning(t)).Run()
 	}()
 
 	// Purchase should succeed (Redis OK)
 	requestID := uuid.New().String()
-	err := svc.Purchase(ctx, requestID, "user", itemID, 1)
+	_, err := svc.Purchase(ctx, requestID, "user", itemID, 1)
 	if err != nil {
 		t.Fatalf("purchase failed: %v", err)
 	}
@@ -216,15 +214,18 @@ func TestIntegration_IdempotencyPreventsDoubleOrder(t *testing.T) {
 	}()
 
 	// First call
-	err := svc.Purchase(ctx, requestID, "user", itemID, 1)
+	orderID, err := svc.Purchase(ctx, requestID, "user", itemID, 1)
 	if err != nil {
 		t.Fatalf("first purchase failed: %v", err)
 	}
 
-	// Second call with same requestID
-	err = svc.Purchase(ctx, requestID, "user", itemID, 1)
-	if err != service.ErrDuplicateRequest {
-		t.Errorf("expected ErrDuplicateRequest, got: %v", err)
+	// Second call with same requestID replays the first result
+	replayedID, err := svc.Purchase(ctx, requestID, "user", itemID, 1)
+	if err != nil {
+		t.Errorf("expected replayed success, got: %v", err)
+	}
+	if replayedID != orderID {
+		t.Errorf("expected order ID %s, got %s", orderID, replayedID)
 	}
 
 	// Verify only 1 stock decremented
@@ -234,15 +235,13 @@ func TestIntegration_IdempotencyPreventsDoubleOrder(t *testing.T) {
 	}
 }
 
-func workerLoop(id int, queue <-chan domain.Order, db port.DatabaseRepository, cache port.CacheRepository) {
-	for order := range queue {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func newWorkerTuning(t *testing.T) *service.WorkerTuning {
+	settings := service.DefaultWorkerSettings()
+	settings.RetryAttempts = 0
 
-		if err := db.CreateOrder(ctx, order); err != nil {
-			// Rollback
-			cache.IncrementStock(ctx, order.ItemID, order.Quantity)
-		}
-
-		cancel()
+	tuning, err := service.NewWorkerTuning(settings)
+	if err != nil {
+		t.Fatalf("worker tuning: %v", err)
 	}
+	return tuning
 }
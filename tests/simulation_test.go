@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rl1809/flash-sale/internal/core/service"
+	"github.com/rl1809/flash-sale/internal/simulation"
+)
+
+func runScenario(t *testing.T, sc simulation.Scenario) *simulation.Report {
+	t.Helper()
+
+	report, err := simulation.Run(context.Background(), sc)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	if err := report.Verify(); err != nil {
+		t.Fatalf("accounting mismatch: %v\n%+v", err, report)
+	}
+	return report
+}
+
+func TestSimulation_OversubscribedBurst(t *testing.T) {
+	report := runScenario(t, simulation.Scenario{
+		Campaign:   simulation.Campaign{ID: "burst", ItemID: "sim-item", Stock: 100},
+		Population: simulation.Population{Users: 1000},
+		Arrival:    simulation.Burst(),
+		Seed:       1,
+	})
+
+	if report.UnitsSold != 100 {
+		t.Errorf("expected sellout of 100 units, got %d", report.UnitsSold)
+	}
+	if report.SoldOut != 900 {
+		t.Errorf("expected 900 sold out responses, got %d", report.SoldOut)
+	}
+}
+
+func TestSimulation_RetriesReplayOutcome(t *testing.T) {
+	report := runScenario(t, simulation.Scenario{
+		Campaign:   simulation.Campaign{ID: "retries", ItemID: "sim-item", Stock: 50},
+		Population: simulation.Population{Users: 200, Quantity: 1, RetryProbability: 0.5},
+		Arrival:    simulation.Uniform(50 * time.Millisecond),
+		Seed:       2,
+	})
+
+	if report.Retries == 0 {
+		t.Fatal("expected some retries")
+	}
+	if report.OrdersAccepted != 50 {
+		t.Errorf("expected 50 distinct orders, got %d", report.OrdersAccepted)
+	}
+}
+
+func TestSimulation_OnePurchasePerUser(t *testing.T) {
+	report := runScenario(t, simulation.Scenario{
+		Campaign: simulation.Campaign{
+			ID:              "per-user",
+			ItemID:          "sim-item",
+			Stock:           1000,
+			IdempotencyMode: service.IdempotencyPerUserItem,
+		},
+		Population: simulation.Population{Users: 100, AttemptsPerUser: 5, Quantity: 2},
+		Arrival:    simulation.RampUp(50 * time.Millisecond),
+		Seed:       3,
+	})
+
+	if report.OrdersAccepted != 100 {
+		t.Errorf("expected one order per user, got %d", report.OrdersAccepted)
+	}
+	if report.UnitsSold != 200 {
+		t.Errorf("expected 200 units sold, got %d", report.UnitsSold)
+	}
+}